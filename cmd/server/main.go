@@ -1,16 +1,76 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 
 	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/selftest"
 	"anti2api-golang/internal/server"
+	"anti2api-golang/internal/version"
 )
 
+// 子命令
+const (
+	cmdServe       = "serve"
+	cmdVersion     = "version"
+	cmdHealthcheck = "healthcheck"
+	cmdSelftest    = "selftest"
+)
+
+// healthcheckTimeout healthcheck 子命令的请求超时
+const healthcheckTimeout = 5 * time.Second
+
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run 按第一个参数分发子命令，返回进程退出码
+func run(args []string) int {
+	command, rest := parseCommand(args)
+	switch command {
+	case cmdVersion:
+		fmt.Println(version.Get())
+		return 0
+	case cmdHealthcheck:
+		return healthcheck(rest)
+	case cmdSelftest:
+		return runSelftest(rest)
+	default:
+		return serve()
+	}
+}
+
+// parseCommand 解析子命令：version（或 --version / -version / -v）、healthcheck、selftest，
+// 其他参数（如 -debug）原样交给 serve 处理
+func parseCommand(args []string) (string, []string) {
+	if len(args) == 0 {
+		return cmdServe, nil
+	}
+	switch args[0] {
+	case "version", "--version", "-version", "-v":
+		return cmdVersion, args[1:]
+	case "healthcheck", "--healthcheck":
+		return cmdHealthcheck, args[1:]
+	case "selftest":
+		return cmdSelftest, args[1:]
+	case "serve":
+		return cmdServe, args[1:]
+	}
+	return cmdServe, args
+}
+
+func serve() int {
 	// 加载 .env 文件（可选）
 	godotenv.Load()
 
@@ -20,13 +80,117 @@ func main() {
 	// 验证必要配置
 	if cfg.PanelPassword == "" {
 		fmt.Println("Error: PANEL_PASSWORD is required")
-		os.Exit(1)
+		return 1
 	}
 
 	// 创建并启动服务器
 	srv := server.New()
 	if err := srv.Start(); err != nil {
 		fmt.Printf("Server error: %v\n", err)
-		os.Exit(1)
+		return 1
+	}
+	return 0
+}
+
+// healthcheck 请求本机 /healthz，失败时返回非零退出码（供 Docker HEALTHCHECK 使用，镜像中无需 curl/wget）。
+// 可通过 -url 指定完整地址
+func healthcheck(args []string) int {
+	url, err := healthcheckURL(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "healthcheck:", err)
+		return 2
+	}
+
+	client := &http.Client{Timeout: healthcheckTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "healthcheck:", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "healthcheck: %s returned %s\n", url, resp.Status)
+		return 1
+	}
+	return 0
+}
+
+// healthcheckURL 确定健康检查地址：-url 参数，否则按 HOST/PORT 配置访问本机
+func healthcheckURL(args []string) (string, error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-url" || arg == "--url":
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("%s requires a value", arg)
+			}
+			return args[i+1], nil
+		case strings.HasPrefix(arg, "-url=") || strings.HasPrefix(arg, "--url="):
+			return arg[strings.Index(arg, "=")+1:], nil
+		default:
+			return "", fmt.Errorf("unknown argument %q", arg)
+		}
+	}
+
+	godotenv.Load()
+	cfg := config.Load()
+	host := strings.TrimSpace(strings.Split(cfg.Host, ",")[0])
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	// 监听所有地址时访问回环地址
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(cfg.Port)) + "/healthz", nil
+}
+
+// runSelftest 在本进程内执行安装自检（不需要服务正在运行），全部通过时退出码为 0，有失败阶段时为 1，参数错误为 2
+func runSelftest(args []string) int {
+	fs := flag.NewFlagSet(cmdSelftest, flag.ContinueOnError)
+	skip := fs.String("skip", "", "comma-separated stages to skip ("+strings.Join(selftest.Stages, ", ")+")")
+	timeout := fs.Duration("timeout", selftest.DefaultStageTimeout, "time limit for each stage")
+	model := fs.String("model", selftest.DefaultModel, "model used for the generation stages")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := selftest.Options{Skip: make(map[string]bool), StageTimeout: *timeout, Model: *model}
+	for _, stage := range strings.Split(*skip, ",") {
+		stage = strings.TrimSpace(stage)
+		if stage == "" {
+			continue
+		}
+		if !selftest.ValidStage(stage) {
+			fmt.Fprintf(os.Stderr, "selftest: unknown stage %q (available: %s)\n", stage, strings.Join(selftest.Stages, ", "))
+			return 2
+		}
+		opts.Skip[stage] = true
+	}
+
+	godotenv.Load()
+	config.Load()
+
+	var progress func(selftest.StageResult)
+	if !*asJSON {
+		progress = printStageResult
+	}
+	report := selftest.Run(context.Background(), opts, progress)
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+	} else if report.Passed {
+		fmt.Println("Self-test passed")
+	} else {
+		fmt.Println("Self-test failed")
+	}
+	return report.ExitCode()
+}
+
+// printStageResult 输出一个阶段的结果
+func printStageResult(result selftest.StageResult) {
+	fmt.Printf("[%s] %-9s %6dms  %s\n", strings.ToUpper(result.Status), result.Stage, result.DurationMs, result.Message)
+	if result.Hint != "" {
+		fmt.Printf("       hint: %s\n", result.Hint)
 	}
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/testutil"
+)
+
+func TestMain(m *testing.M) {
+	// healthcheck 未指定 -url 时按 HOST/PORT 访问本机
+	os.Setenv("HOST", "0.0.0.0")
+	os.Setenv("PORT", "18045")
+	testutil.Main(m)
+}
+
+func TestParseCommand(t *testing.T) {
+	for _, tc := range []struct {
+		args    []string
+		command string
+		rest    []string
+	}{
+		{nil, cmdServe, nil},
+		{[]string{"serve"}, cmdServe, []string{}},
+		{[]string{"-debug"}, cmdServe, []string{"-debug"}},
+		{[]string{"version"}, cmdVersion, []string{}},
+		{[]string{"--version"}, cmdVersion, []string{}},
+		{[]string{"-version"}, cmdVersion, []string{}},
+		{[]string{"-v"}, cmdVersion, []string{}},
+		{[]string{"healthcheck", "-url", "http://x/healthz"}, cmdHealthcheck, []string{"-url", "http://x/healthz"}},
+		{[]string{"--healthcheck"}, cmdHealthcheck, []string{}},
+		{[]string{"selftest", "-json"}, cmdSelftest, []string{"-json"}},
+		// 子命令只识别第一个参数
+		{[]string{"-debug", "version"}, cmdServe, []string{"-debug", "version"}},
+	} {
+		command, rest := parseCommand(tc.args)
+		if command != tc.command || !reflect.DeepEqual(rest, tc.rest) {
+			t.Errorf("parseCommand(%q) = %s %q, want %s %q", tc.args, command, rest, tc.command, tc.rest)
+		}
+	}
+}
+
+func TestHealthcheckURL(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		url  string
+		fail bool
+	}{
+		{nil, "http://127.0.0.1:18045/healthz", false},
+		{[]string{"-url", "http://app:8045/healthz"}, "http://app:8045/healthz", false},
+		{[]string{"--url", "http://app:8045/healthz"}, "http://app:8045/healthz", false},
+		{[]string{"-url=http://app/healthz"}, "http://app/healthz", false},
+		{[]string{"--url=http://app/healthz"}, "http://app/healthz", false},
+		{[]string{"-url"}, "", true},
+		{[]string{"-timeout", "1s"}, "", true},
+	} {
+		url, err := healthcheckURL(tc.args)
+		if (err != nil) != tc.fail || url != tc.url {
+			t.Errorf("healthcheckURL(%q) = %q, %v; want %q (fail=%v)", tc.args, url, err, tc.url, tc.fail)
+		}
+	}
+}
+
+func TestHealthcheckExitCodes(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+	stopped := httptest.NewServer(http.NotFoundHandler())
+	stopped.Close()
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"healthy", []string{"healthcheck", "-url", healthy.URL + "/healthz"}, 0},
+		{"unhealthy", []string{"healthcheck", "-url", unhealthy.URL + "/healthz"}, 1},
+		{"not listening", []string{"healthcheck", "-url", stopped.URL + "/healthz"}, 1},
+		{"bad arguments", []string{"healthcheck", "-port"}, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := run(tc.args); code != tc.code {
+				t.Errorf("exit code %d, want %d", code, tc.code)
+			}
+		})
+	}
+}
+
+func TestVersionCommand(t *testing.T) {
+	for _, arg := range []string{"version", "--version"} {
+		out, code := captureStdout(t, func() int { return run([]string{arg}) })
+		if code != 0 || !strings.HasPrefix(out, "anti2api dev (commit unknown") {
+			t.Errorf("%s: exit %d, output %q", arg, code, out)
+		}
+	}
+}
+
+// captureStdout 执行 fn 并返回其标准输出
+func captureStdout(t *testing.T, fn func() int) (string, int) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	code := fn()
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return string(out), code
+}
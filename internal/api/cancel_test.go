@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/testutil"
+)
+
+// slowBody 写入一段数据后阻塞的上游响应体，记录是否被关闭
+type slowBody struct {
+	*io.PipeReader
+	closed atomic.Bool
+}
+
+func (b *slowBody) Close() error {
+	b.closed.Store(true)
+	return b.PipeReader.CloseWithError(errors.New("body closed"))
+}
+
+// startSlowStream 返回输出第一段正文后不再结束的上游响应
+func startSlowStream(t *testing.T) (*http.Response, *slowBody) {
+	t.Helper()
+	pr, pw := io.Pipe()
+	t.Cleanup(func() { pw.Close() })
+	body := &slowBody{PipeReader: pr}
+	go io.WriteString(pw, sseBody(testutil.Chunk("", testutil.Text("first"))))
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: body}, body
+}
+
+func TestProcessStreamResponseCanceled(t *testing.T) {
+	resp, body := startSlowStream(t)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	first := make(chan struct{})
+	done := make(chan error, 1)
+	var texts []string
+	go func() {
+		_, err := ProcessStreamResponse(ctx, resp, func(chunk StreamChunk) {
+			if chunk.Type == "text" {
+				texts = append(texts, chunk.Content)
+				close(first)
+			}
+		})
+		done <- err
+	}()
+
+	select {
+	case <-first:
+	case <-time.After(2 * time.Second):
+		t.Fatal("first chunk not delivered")
+	}
+	cancel(errors.New("client went away"))
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrStreamCanceled) || !strings.Contains(err.Error(), "client went away") {
+			t.Errorf("err = %v, want ErrStreamCanceled with the cause", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ProcessStreamResponse kept reading after the context was canceled")
+	}
+	if !body.closed.Load() {
+		t.Error("upstream body not closed")
+	}
+	if strings.Join(texts, "") != "first" {
+		t.Errorf("texts = %q", texts)
+	}
+}
+
+func TestProcessStreamResponseAlreadyCanceled(t *testing.T) {
+	resp, body := startSlowStream(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	chunks := 0
+	_, err := ProcessStreamResponse(ctx, resp, func(StreamChunk) { chunks++ })
+	if !errors.Is(err, ErrStreamCanceled) {
+		t.Errorf("err = %v, want ErrStreamCanceled", err)
+	}
+	if !body.closed.Load() || chunks != 0 {
+		t.Errorf("closed = %v, chunks = %d, want closed without chunks", body.closed.Load(), chunks)
+	}
+}
+
+// failingWriter 写入总是失败的响应（客户端已断开）
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("broken pipe")
+}
+
+func TestStreamWriterOnWriteError(t *testing.T) {
+	w := &failingWriter{ResponseRecorder: httptest.NewRecorder()}
+	sw := NewStreamWriter(w, "chatcmpl-1", 1, "m")
+	var calls []error
+	sw.OnWriteError(func(err error) { calls = append(calls, err) })
+
+	if err := sw.WriteContent("hello"); err == nil {
+		t.Fatal("WriteContent succeeded on a broken connection")
+	}
+	// 首次失败后不再写入连接，回调只调用一次
+	sw.WriteContent("more")
+	sw.WriteFinish("stop", nil)
+	if len(calls) != 1 || !strings.Contains(calls[0].Error(), "broken pipe") {
+		t.Errorf("callbacks = %v, want one broken pipe error", calls)
+	}
+	if w.writes != 1 {
+		t.Errorf("writes = %d, want 1", w.writes)
+	}
+	if sw.Err() == nil {
+		t.Error("Err() = nil after a failed write")
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"anti2api-golang/internal/chaos"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/store"
+)
+
+// ChaosHeader 注入故障的响应会带上该头（值为规则 ID）
+const ChaosHeader = "X-Chaos-Fault"
+
+// do 发送上游请求，启用故障注入时按规则注入故障
+func (c *Client) do(httpReq *http.Request, model string, token *store.Account, stream bool) (*http.Response, error) {
+	rule := chaos.Get().Match(model, token.Email, token.ProjectID)
+	if rule == nil {
+		return c.httpClient.Do(httpReq)
+	}
+
+	logger.Warn("Injecting chaos fault %s (%s) for model=%s account=%s", rule.Fault, rule.ID, model, token.Email)
+
+	switch rule.Fault {
+	case chaos.FaultStatus:
+		body, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]interface{}{
+				"code":    rule.Status,
+				"message": chaos.Message(rule, http.StatusText(rule.Status)),
+			},
+		})
+		return syntheticResponse(httpReq, rule, rule.Status, io.NopCloser(strings.NewReader(string(body)))), nil
+
+	case chaos.FaultMalformed:
+		body := `{"response": {"candidates": [{"content": `
+		if stream {
+			body = "data: " + body + "\n\n"
+		}
+		return syntheticResponse(httpReq, rule, http.StatusOK, &faultReader{
+			r:   strings.NewReader(body),
+			err: errors.New(chaos.Message(rule, "malformed upstream response")),
+		}), nil
+
+	case chaos.FaultSlow:
+		if err := sleepContext(httpReq.Context(), time.Duration(rule.DelayMs)*time.Millisecond); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	resp.Header.Set(ChaosHeader, rule.ID)
+
+	if rule.Fault == chaos.FaultTruncate && resp.StatusCode == http.StatusOK {
+		resp.Body = &faultReader{
+			r:      io.LimitReader(resp.Body, int64(rule.TruncateAt)),
+			err:    errors.New(chaos.Message(rule, "upstream response truncated")),
+			closer: resp.Body,
+		}
+		resp.ContentLength = -1
+	}
+	return resp, nil
+}
+
+// wrapChaosError 注入故障导致的解析错误带上标记，便于在日志中区分
+func wrapChaosError(resp *http.Response, err error) error {
+	if id := resp.Header.Get(ChaosHeader); id != "" && !chaos.IsInjected(err.Error()) {
+		return errors.New(chaos.Marker + " " + id + ": " + err.Error())
+	}
+	return err
+}
+
+// syntheticResponse 构造合成响应
+func syntheticResponse(req *http.Request, rule *chaos.Rule, status int, body io.ReadCloser) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}, ChaosHeader: {rule.ID}},
+		Body:          body,
+		ContentLength: -1,
+		Request:       req,
+	}
+}
+
+// faultReader 读完数据后返回指定错误（而不是 io.EOF）
+type faultReader struct {
+	r      io.Reader
+	err    error
+	closer io.Closer
+}
+
+func (f *faultReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+func (f *faultReader) Close() error {
+	if f.closer != nil {
+		return f.closer.Close()
+	}
+	return nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -1,12 +1,11 @@
 package api
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -17,7 +16,10 @@ import (
 	"anti2api-golang/internal/config"
 	"anti2api-golang/internal/converter"
 	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/notify"
 	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/tracing"
 )
 
 // Client API 客户端
@@ -32,17 +34,63 @@ type APIError struct {
 	Message      string
 	RetryDelay   time.Duration
 	DisableToken bool
+	Class        string // 错误分类（见 ErrorClassAuth 等）
 }
 
 func (e *APIError) Error() string {
 	return fmt.Sprintf("API error %d: %s", e.Status, e.Message)
 }
 
+// endpointContextKey 请求级端点覆盖的 context key
+type endpointContextKey struct{}
+
+// WithEndpoint 返回强制使用指定端点的 context
+func WithEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointContextKey{}, endpoint)
+}
+
+// resolveEndpoint 选择请求端点：请求级覆盖 > 账号固定端点 > 全局端点模式（按权重分流时同一会话固定端点）
+func resolveEndpoint(ctx context.Context, token *store.Account, req *converter.AntigravityRequest) config.Endpoint {
+	route := store.RouteTraceFromContext(ctx)
+	if forced, ok := ctx.Value(endpointContextKey{}).(string); ok {
+		if ep, ok := config.APIEndpoints[forced]; ok {
+			route.Upstream(store.RouteUpstream{Account: token.ID, Endpoint: ep.Key, Source: store.RouteEndpointOverride})
+			return ep
+		}
+	}
+	if token.Endpoint != "" {
+		if ep, ok := config.APIEndpoints[token.Endpoint]; ok {
+			route.Upstream(store.RouteUpstream{Account: token.ID, Endpoint: ep.Key, Source: store.RouteEndpointAccount})
+			return ep
+		}
+	}
+	manager := config.GetEndpointManager()
+	ep := manager.EndpointFor(converter.ConversationKey(req))
+	if route != nil {
+		upstream := store.RouteUpstream{Account: token.ID, Endpoint: ep.Key, Source: store.RouteEndpointMode, Mode: manager.GetMode()}
+		// 未配置备用端点时没有自动切换状态
+		if circuit := manager.AutoFailoverStatus(); circuit.State != config.AutoFailoverDisabled {
+			upstream.Circuit = &circuit
+		}
+		route.Upstream(upstream)
+	}
+	return ep
+}
+
 // NewClient 创建新的 API 客户端
 func NewClient() *Client {
 	cfg := config.Get()
 
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
 	transport := &http.Transport{
+		// 统计打开的上游连接数（运行时监控）
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return monitor.CountConn(conn), nil
+		},
 		MaxIdleConns:          100,
 		MaxIdleConnsPerHost:   10,
 		IdleConnTimeout:       90 * time.Second,
@@ -68,6 +116,11 @@ func NewClient() *Client {
 	}
 }
 
+// CloseIdleConnections 关闭连接池中空闲的上游连接（正在读取响应体的连接不受影响）
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+}
+
 // BuildHeaders 构建请求头（非流式请求）
 func (c *Client) BuildHeaders(token *store.Account, endpoint config.Endpoint) http.Header {
 	return http.Header{
@@ -75,65 +128,87 @@ func (c *Client) BuildHeaders(token *store.Account, endpoint config.Endpoint) ht
 		"User-Agent":      {c.config.UserAgent},
 		"Authorization":   {"Bearer " + token.AccessToken},
 		"Content-Type":    {"application/json"},
-		"Accept-Encoding": {"gzip"},
+		"Accept-Encoding": {AcceptEncoding},
 	}
 }
 
-// BuildStreamHeaders 构建流式请求头（禁用 gzip 以保证流式输出平滑）
+// BuildStreamHeaders 构建流式请求头（禁用压缩以保证流式输出平滑）
 func (c *Client) BuildStreamHeaders(token *store.Account, endpoint config.Endpoint) http.Header {
 	return http.Header{
 		"Host":          {endpoint.Host},
 		"User-Agent":    {c.config.UserAgent},
 		"Authorization": {"Bearer " + token.AccessToken},
 		"Content-Type":  {"application/json"},
-		// 不设置 Accept-Encoding: gzip，避免上游服务器缓冲压缩数据导致流式输出不平滑
+		// 显式声明 identity，避免上游服务器缓冲压缩数据导致流式输出不平滑
+		"Accept-Encoding": {StreamAcceptEncoding},
 	}
 }
 
+// startUpstreamSpan 为一次上游调用创建 span（每次重试单独记录）
+func startUpstreamSpan(ctx context.Context, name string, endpoint config.Endpoint, req *converter.AntigravityRequest) (context.Context, *tracing.Span) {
+	ctx, span := tracing.StartClient(ctx, name)
+	span.SetAttr("server.address", endpoint.Host)
+	span.SetAttr("upstream.endpoint", endpoint.Key)
+	span.SetAttr("gen_ai.request.model", req.Model)
+	return ctx, span
+}
+
 // SendRequest 发送非流式请求
-func (c *Client) SendRequest(ctx context.Context, req *converter.AntigravityRequest, token *store.Account) (*converter.AntigravityResponse, error) {
-	endpoint := config.GetEndpointManager().GetActiveEndpoint()
+func (c *Client) SendRequest(ctx context.Context, req *converter.AntigravityRequest, token *store.Account) (_ *converter.AntigravityResponse, err error) {
+	endpoint := resolveEndpoint(ctx, token, req)
 	reqURL := endpoint.NoStreamURL()
 
-	body, err := json.Marshal(req)
+	ctx, span := startUpstreamSpan(ctx, "upstream.generateContent", endpoint, req)
+	defer func() {
+		captureOutcome(ctx, endpoint.Key, err)
+		if err != nil {
+			span.SetAttr("error.type", ErrorClass(err))
+		}
+		span.SetError(err)
+		span.End()
+	}()
+
+	body, size, err := converter.NewRequestBody(req)
 	if err != nil {
 		return nil, err
 	}
 
 	logger.BackendRequest("POST", reqURL, req)
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", reqURL, body)
 	if err != nil {
 		return nil, err
 	}
+	httpReq.ContentLength = size
 
 	for key, values := range c.BuildHeaders(token, endpoint) {
 		for _, value := range values {
 			httpReq.Header.Add(key, value)
 		}
 	}
+	applyHeaderOverrides(httpReq.Header, endpoint, req)
+	tracing.Inject(ctx, httpReq.Header)
+	captureHeaders(ctx, httpReq.Header)
 
 	startTime := time.Now()
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq, req.Model, token, false)
+	config.GetEndpointManager().RecordResult(endpoint.Key, err == nil && resp.StatusCode == 200)
 	if err != nil {
 		return nil, err
 	}
+	span.SetAttr("http.response.status_code", resp.StatusCode)
 	defer resp.Body.Close()
 
-	// 处理 gzip
-	var reader io.Reader = resp.Body
-	if resp.Header.Get("Content-Encoding") == "gzip" {
-		gzReader, err := gzip.NewReader(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		defer gzReader.Close()
-		reader = gzReader
+	// 处理压缩（gzip/br/zstd）
+	reader, err := DecodeBody(resp)
+	if err != nil {
+		return nil, err
 	}
+	defer reader.Close()
 
 	respBody, err := io.ReadAll(reader)
 	if err != nil {
-		return nil, err
+		return nil, wrapChaosError(resp, err)
 	}
 
 	duration := time.Since(startTime)
@@ -141,35 +216,50 @@ func (c *Client) SendRequest(ctx context.Context, req *converter.AntigravityRequ
 	if resp.StatusCode != 200 {
 		apiErr := ExtractErrorDetails(resp, respBody)
 		logger.BackendResponse(resp.StatusCode, duration, string(respBody))
+		recordRateLimit(resp, token, apiErr.RetryDelay)
+		handleRevoked(apiErr, token)
+		handleRateLimited(apiErr, token)
 		return nil, apiErr
 	}
+	recordRateLimit(resp, token, 0)
 
 	var antigravityResp converter.AntigravityResponse
 	if err := json.Unmarshal(respBody, &antigravityResp); err != nil {
 		logger.BackendResponse(resp.StatusCode, duration, string(respBody))
-		return nil, err
+		return nil, wrapChaosError(resp, err)
 	}
 
 	logger.BackendResponse(resp.StatusCode, duration, antigravityResp)
 	return &antigravityResp, nil
 }
 
-// SendStreamRequest 发送流式请求
-func (c *Client) SendStreamRequest(ctx context.Context, req *converter.AntigravityRequest, token *store.Account) (*http.Response, error) {
-	endpoint := config.GetEndpointManager().GetActiveEndpoint()
+// SendStreamRequest 发送流式请求（span 在收到响应头时结束，之后的流处理由调用方记录）
+func (c *Client) SendStreamRequest(ctx context.Context, req *converter.AntigravityRequest, token *store.Account) (_ *http.Response, err error) {
+	endpoint := resolveEndpoint(ctx, token, req)
 	reqURL := endpoint.StreamURL()
 
-	body, err := json.Marshal(req)
+	ctx, span := startUpstreamSpan(ctx, "upstream.streamGenerateContent", endpoint, req)
+	defer func() {
+		captureOutcome(ctx, endpoint.Key, err)
+		if err != nil {
+			span.SetAttr("error.type", ErrorClass(err))
+		}
+		span.SetError(err)
+		span.End()
+	}()
+
+	body, size, err := converter.NewRequestBody(req)
 	if err != nil {
 		return nil, err
 	}
 
 	logger.BackendRequest("POST", reqURL, req)
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", reqURL, body)
 	if err != nil {
 		return nil, err
 	}
+	httpReq.ContentLength = size
 
 	// 流式请求使用专用请求头（禁用 gzip）
 	for key, values := range c.BuildStreamHeaders(token, endpoint) {
@@ -177,31 +267,36 @@ func (c *Client) SendStreamRequest(ctx context.Context, req *converter.Antigravi
 			httpReq.Header.Add(key, value)
 		}
 	}
+	applyHeaderOverrides(httpReq.Header, endpoint, req)
+	tracing.Inject(ctx, httpReq.Header)
+	captureHeaders(ctx, httpReq.Header)
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq, req.Model, token, true)
+	config.GetEndpointManager().RecordResult(endpoint.Key, err == nil && resp.StatusCode == 200)
 	if err != nil {
 		return nil, err
 	}
+	span.SetAttr("http.response.status_code", resp.StatusCode)
 
 	if resp.StatusCode != 200 {
 		defer resp.Body.Close()
 
-		// 处理 gzip
-		var reader io.Reader = resp.Body
-		if resp.Header.Get("Content-Encoding") == "gzip" {
-			gzReader, err := gzip.NewReader(resp.Body)
-			if err != nil {
-				return nil, &APIError{Status: resp.StatusCode, Message: "failed to decompress response"}
-			}
-			defer gzReader.Close()
-			reader = gzReader
+		// 处理压缩（gzip/br/zstd）
+		reader, err := DecodeBody(resp)
+		if err != nil {
+			return nil, &APIError{Status: resp.StatusCode, Message: "failed to decompress response: " + err.Error()}
 		}
+		defer reader.Close()
 
 		respBody, _ := io.ReadAll(reader)
 		apiErr := ExtractErrorDetails(resp, respBody)
 		logger.BackendResponse(resp.StatusCode, 0, string(respBody))
+		recordRateLimit(resp, token, apiErr.RetryDelay)
+		handleRevoked(apiErr, token)
+		handleRateLimited(apiErr, token)
 		return nil, apiErr
 	}
+	recordRateLimit(resp, token, 0)
 
 	return resp, nil
 }
@@ -225,12 +320,15 @@ func ExtractErrorDetails(resp *http.Response, body []byte) *APIError {
 		} `json:"error"`
 	}
 
+	upstreamStatus := ""
 	if json.Unmarshal(body, &errorResp) == nil {
 		apiErr.Message = errorResp.Error.Message
+		upstreamStatus = errorResp.Error.Status
 
 		// 解析状态码
 		switch v := errorResp.Error.Code.(type) {
 		case string:
+			upstreamStatus = v
 			switch strings.ToUpper(v) {
 			case "RESOURCE_EXHAUSTED":
 				apiErr.Status = 429
@@ -257,9 +355,46 @@ func ExtractErrorDetails(resp *http.Response, body []byte) *APIError {
 		}
 	}
 
+	// 错误详情中没有 RetryInfo 时使用 Retry-After 头
+	if apiErr.RetryDelay == 0 {
+		apiErr.RetryDelay = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	apiErr.Class = ClassifyError(apiErr.Status, upstreamStatus, apiErr.Message)
+
 	return apiErr
 }
 
+// handleRevoked 上游返回 UNAUTHENTICATED 时暂停选用账号并强制下次使用前刷新 Token，发送账号撤销告警
+// （只有刷新时 refresh_token 被撤销才禁用账号）
+func handleRevoked(apiErr *APIError, token *store.Account) {
+	if !apiErr.DisableToken {
+		return
+	}
+	// 透传凭证不在账号存储中，凭证无效只返回认证错误
+	if token.Passthrough {
+		apiErr.DisableToken = false
+		return
+	}
+	store.GetAccountStore().MarkUnauthenticated(token.ID, time.Duration(config.Get().AccountFailoverCooldown)*time.Second)
+	notify.Fire(notify.EventAccountRevoked, "Upstream rejected account credentials", map[string]interface{}{
+		"email":     token.Email,
+		"projectId": token.ProjectID,
+		"message":   apiErr.Message,
+	})
+}
+
+// handleRateLimited 上游返回 429 时暂停选用账号，时长优先使用上游给出的重试时间
+func handleRateLimited(apiErr *APIError, token *store.Account) {
+	if apiErr.Status != http.StatusTooManyRequests || token.Passthrough {
+		return
+	}
+	d := apiErr.RetryDelay
+	if d == 0 {
+		d = time.Duration(config.Get().RateLimitCooldown) * time.Second
+	}
+	store.GetAccountStore().MarkRateLimited(token.ID, d)
+}
+
 // WithRetry 带重试的请求
 func (c *Client) WithRetry(ctx context.Context, operation func() error) error {
 	var lastErr error
@@ -308,6 +443,9 @@ func (c *Client) WithRetry(ctx context.Context, operation func() error) error {
 		}
 
 		logger.Warn("Retrying request (attempt %d/%d)", attempt+2, c.config.RetryMaxAttempts)
+		tracing.FromContext(ctx).AddEvent("upstream.retry",
+			"retry.attempt", attempt+2, "retry.status", apiErr.Status, "retry.delay_ms", delay.Milliseconds())
+		store.RouteTraceFromContext(ctx).Retry(attempt+2, apiErr.Status, delay)
 	}
 
 	return lastErr
@@ -325,6 +463,9 @@ func GetClient() *Client {
 
 // GenerateContent 非流式生成内容
 func GenerateContent(ctx context.Context, req *converter.AntigravityRequest, token *store.Account) (*converter.AntigravityResponse, error) {
+	ctx, done := monitor.Track(ctx, monitor.KindRequest, req.Model, token.ID)
+	defer done()
+
 	client := GetClient()
 	var result *converter.AntigravityResponse
 	var err error
@@ -359,6 +500,32 @@ func GenerateContentStream(ctx context.Context, req *converter.AntigravityReques
 	return result, nil
 }
 
+// ErrorStatus 获取错误对应的 HTTP 状态码
+func ErrorStatus(err error) int {
+	if apiErr, ok := err.(*APIError); ok {
+		return apiErr.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorType 获取状态码对应的 OpenAI 错误类型
+func ErrorType(status int) string {
+	switch {
+	case status == 400:
+		return "invalid_request_error"
+	case status == 401:
+		return "authentication_error"
+	case status == 403:
+		return "permission_error"
+	case status == 404:
+		return "not_found_error"
+	case status == 429:
+		return "rate_limit_error"
+	default:
+		return "server_error"
+	}
+}
+
 // IsRetryableError 检查是否为可重试错误
 func IsRetryableError(err error) bool {
 	apiErr, ok := err.(*APIError)
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/converter"
+)
+
+// emittedText 客户端拼接 SSE 输出中所有 delta 得到的正文和思考内容
+func emittedText(t *testing.T, body string) (content, reasoning string) {
+	t.Helper()
+	var c, r strings.Builder
+	for _, line := range strings.Split(body, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || !strings.HasPrefix(data, "{") {
+			continue
+		}
+		var chunk converter.OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("decode %q: %v", data, err)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta != nil {
+				c.WriteString(choice.Delta.Content)
+				r.WriteString(choice.Delta.Reasoning)
+			}
+		}
+	}
+	return c.String(), r.String()
+}
+
+func TestStreamDigestMatchesEmittedContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		coalesce time.Duration
+		write    func(sw *StreamWriter)
+	}{
+		{"plain", 0, func(sw *StreamWriter) {
+			sw.WriteContent("Hello")
+			sw.WriteContent(", world")
+		}},
+		{"interleaved reasoning", 0, func(sw *StreamWriter) {
+			sw.WriteReasoning("Let me think")
+			sw.WriteContent("The answer")
+			sw.WriteReasoning(" again")
+			sw.WriteContent(" is 42")
+		}},
+		{"coalesced", time.Hour, func(sw *StreamWriter) {
+			for _, part := range []string{"a", "b", "c"} {
+				sw.WriteReasoning(part)
+			}
+			for _, part := range []string{"one ", "two ", "three"} {
+				sw.WriteContent(part)
+			}
+		}},
+		// 多字节字符跨 chunk 拆分时按完整字符输出
+		{"split utf-8", 0, func(sw *StreamWriter) {
+			emoji := "你好🙂"
+			sw.WriteContent(emoji[:4])
+			sw.WriteContent(emoji[4:8])
+			sw.WriteContent(emoji[8:])
+		}},
+		// 结束时残留的不完整字节按 JSON 编码替换为 U+FFFD
+		{"dangling bytes", 0, func(sw *StreamWriter) {
+			sw.WriteContent("ok " + "🙂"[:2])
+			sw.WriteReasoning("hm " + "你"[:1])
+		}},
+		{"empty", 0, func(sw *StreamWriter) {}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			sw := NewStreamWriter(rec, "chatcmpl-1", 1, "m")
+			sw.SetCoalesce(tt.coalesce, 0)
+			tt.write(sw)
+			if err := sw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if err := sw.WriteFinish("stop", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			body := rec.Body.String()
+			content, reasoning := emittedText(t, body)
+			digest := finishChunk(t, body).ContentDigest
+			if digest == nil || digest.Content != ContentDigest(content) {
+				t.Fatalf("content digest = %+v, client computed %s for %q", digest, ContentDigest(content), content)
+			}
+			trailer := rec.Result().Trailer
+			if got := trailer.Get(ContentDigestHeader); got != digest.Content {
+				t.Fatalf("trailer %s = %q", ContentDigestHeader, got)
+			}
+			if reasoning == "" {
+				if digest.Reasoning != "" || trailer.Get(ReasoningDigestHeader) != "" {
+					t.Fatalf("reasoning digest without reasoning: %+v", digest)
+				}
+				return
+			}
+			if digest.Reasoning != ContentDigest(reasoning) || trailer.Get(ReasoningDigestHeader) != digest.Reasoning {
+				t.Fatalf("reasoning digest = %q, trailer %q, client computed %s", digest.Reasoning, trailer.Get(ReasoningDigestHeader), ContentDigest(reasoning))
+			}
+		})
+	}
+}
+
+func TestContentDigestFormat(t *testing.T) {
+	// sha256("") 的十六进制
+	if got := ContentDigest(""); got != "sha256=e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Fatalf("ContentDigest(\"\") = %s", got)
+	}
+	if ContentDigest("a") == ContentDigest("b") {
+		t.Fatal("different content has the same digest")
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// AcceptEncoding 非流式请求声明的可接受压缩格式
+const AcceptEncoding = "gzip, br, zstd"
+
+// StreamAcceptEncoding 流式请求显式要求不压缩，避免上游缓冲压缩数据
+const StreamAcceptEncoding = "identity"
+
+// ErrUndecodableStream 流首行不是可识别的文本时返回的错误
+type ErrUndecodableStream struct {
+	ContentEncoding string
+	Preview         string
+}
+
+func (e *ErrUndecodableStream) Error() string {
+	encoding := e.ContentEncoding
+	if encoding == "" {
+		encoding = "none"
+	}
+	return fmt.Sprintf("upstream stream is not valid text (Content-Encoding: %s, first bytes: %q)", encoding, e.Preview)
+}
+
+// DecodeBody 根据 Content-Encoding 返回解压后的响应体，调用者负责 Close
+func DecodeBody(resp *http.Response) (io.ReadCloser, error) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+
+	switch encoding {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip", "x-gzip":
+		gzReader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("gzip decode failed: %w", err)
+		}
+		return &decodedBody{Reader: gzReader, closeFn: gzReader.Close, body: resp.Body}, nil
+	case "br":
+		return &decodedBody{Reader: brotli.NewReader(resp.Body), body: resp.Body}, nil
+	case "zstd":
+		zReader, err := zstd.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("zstd decode failed: %w", err)
+		}
+		return &decodedBody{
+			Reader:  zReader,
+			closeFn: func() error { zReader.Close(); return nil },
+			body:    resp.Body,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding: %s", encoding)
+	}
+}
+
+// decodedBody 包装解压读取器，关闭时同时关闭底层响应体
+type decodedBody struct {
+	io.Reader
+	closeFn func() error
+	body    io.Closer
+}
+
+func (d *decodedBody) Close() error {
+	if d.closeFn != nil {
+		d.closeFn()
+	}
+	return d.body.Close()
+}
+
+// checkTextLine 检查流首行是否为可读文本，用于发现未识别的压缩数据
+func checkTextLine(line string, contentEncoding string) error {
+	if line == "" {
+		return nil
+	}
+	if utf8.ValidString(line) && !strings.ContainsRune(line, 0) {
+		return nil
+	}
+
+	preview := line
+	if len(preview) > 16 {
+		preview = preview[:16]
+	}
+	return &ErrUndecodableStream{
+		ContentEncoding: contentEncoding,
+		Preview:         preview,
+	}
+}
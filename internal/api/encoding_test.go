@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+
+	"anti2api-golang/internal/testutil"
+)
+
+// encodedResponse 以 body 和 Content-Encoding 构造上游响应
+func encodedResponse(body []byte, encoding string) *http.Response {
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(bytes.NewReader(body))}
+	if encoding != "" {
+		resp.Header.Set("Content-Encoding", encoding)
+	}
+	return resp
+}
+
+// collectStream 处理上游流，返回收到的数据块
+func collectStream(t *testing.T, resp *http.Response) ([]StreamChunk, error) {
+	t.Helper()
+	var chunks []StreamChunk
+	_, err := ProcessStreamResponse(context.Background(), resp, func(chunk StreamChunk) {
+		chunks = append(chunks, chunk)
+	})
+	return chunks, err
+}
+
+func TestProcessStreamResponseDecodesEncodings(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/upstream.sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := collectStream(t, encodedResponse(fixture, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) == 0 || want[len(want)-1].Type != "finish" {
+		t.Fatalf("identity stream produced %+v", want)
+	}
+
+	for _, encoding := range testutil.Encodings {
+		t.Run(encoding, func(t *testing.T) {
+			got, err := collectStream(t, encodedResponse(testutil.Compress(encoding, fixture), encoding))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("chunks = %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestProcessStreamResponseRejectsUndeclaredCompression(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/upstream.sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, encoding := range testutil.Encodings {
+		t.Run(encoding, func(t *testing.T) {
+			// 上游或中间代理压缩了响应却没有声明 Content-Encoding
+			chunks, err := collectStream(t, encodedResponse(testutil.Compress(encoding, fixture), ""))
+			var undecodable *ErrUndecodableStream
+			if !errors.As(err, &undecodable) {
+				t.Fatalf("err = %v, want ErrUndecodableStream", err)
+			}
+			if len(chunks) != 0 {
+				t.Errorf("undecodable stream produced chunks: %+v", chunks)
+			}
+		})
+	}
+}
+
+func TestProcessStreamResponseRejectsUnknownEncoding(t *testing.T) {
+	_, err := collectStream(t, encodedResponse([]byte("data: {}\n"), "compress"))
+	if err == nil {
+		t.Fatal("unsupported Content-Encoding should fail")
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	body := []byte(`{"response":{"candidates":[{"content":{"parts":[{"text":"Hello"}]},"finishReason":"STOP"}]}}`)
+	for _, encoding := range testutil.Encodings {
+		t.Run(encoding, func(t *testing.T) {
+			closed := false
+			resp := encodedResponse(testutil.Compress(encoding, body), encoding)
+			resp.Body = closeRecorder{resp.Body, &closed}
+
+			reader, err := DecodeBody(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, body) {
+				t.Errorf("decoded %q, want %q", got, body)
+			}
+			reader.Close()
+			if !closed {
+				t.Error("closing the decoder did not close the response body")
+			}
+		})
+	}
+}
+
+// closeRecorder 记录响应体是否被关闭
+type closeRecorder struct {
+	io.Reader
+	closed *bool
+}
+
+func (c closeRecorder) Close() error {
+	*c.closed = true
+	return nil
+}
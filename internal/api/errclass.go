@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 上游错误分类（日志、追踪和错误看板使用）
+const (
+	ErrorClassAuth      = "auth"      // 凭证无效或无权限
+	ErrorClassQuota     = "quota"     // 限流或配额耗尽
+	ErrorClassSafety    = "safety"    // 内容安全策略拦截
+	ErrorClassSchema    = "schema"    // 请求格式或参数不被接受
+	ErrorClassTimeout   = "timeout"   // 上游或请求超时
+	ErrorClassTransport = "transport" // 网络错误、上游不可用、响应无法解析
+	ErrorClassUnknown   = "unknown"
+)
+
+// ErrorClasses 全部错误分类
+var ErrorClasses = []string{
+	ErrorClassAuth, ErrorClassQuota, ErrorClassSafety, ErrorClassSchema,
+	ErrorClassTimeout, ErrorClassTransport, ErrorClassUnknown,
+}
+
+// safetyKeywords 安全策略拦截的错误消息特征（Gemini 和 Claude 模型的措辞不同）
+var safetyKeywords = []string{
+	"safety", "blocked", "prohibited content", "content filter", "content policy",
+	"recitation", "harm_category", "usage policy",
+}
+
+// schemaKeywords 请求格式错误的消息特征（上游有时对这类错误返回 500）
+var schemaKeywords = []string{
+	"invalid json payload", "unknown name", "cannot find field", "schema",
+	"function_declarations", "invalid argument", "invalid_argument",
+}
+
+// ClassifyError 按 HTTP 状态码、上游错误状态（如 RESOURCE_EXHAUSTED）和错误消息分类
+func ClassifyError(status int, upstreamStatus, message string) string {
+	upstreamStatus = strings.ToUpper(upstreamStatus)
+	msg := strings.ToLower(message)
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden ||
+		upstreamStatus == "UNAUTHENTICATED" || upstreamStatus == "PERMISSION_DENIED":
+		return ErrorClassAuth
+	case status == http.StatusTooManyRequests || upstreamStatus == "RESOURCE_EXHAUSTED" ||
+		strings.Contains(msg, "quota") || strings.Contains(msg, "rate limit"):
+		return ErrorClassQuota
+	case containsAny(msg, safetyKeywords):
+		return ErrorClassSafety
+	case status == http.StatusGatewayTimeout || status == http.StatusRequestTimeout ||
+		upstreamStatus == "DEADLINE_EXCEEDED" || strings.Contains(msg, "deadline exceeded") || strings.Contains(msg, "timeout"):
+		return ErrorClassTimeout
+	case status == http.StatusBadRequest || status == http.StatusNotFound || status == http.StatusUnprocessableEntity ||
+		upstreamStatus == "INVALID_ARGUMENT" || upstreamStatus == "FAILED_PRECONDITION" || containsAny(msg, schemaKeywords):
+		return ErrorClassSchema
+	case status == http.StatusBadGateway || status == http.StatusServiceUnavailable || upstreamStatus == "UNAVAILABLE":
+		return ErrorClassTransport
+	}
+	return ErrorClassUnknown
+}
+
+// ErrorClass 获取错误的分类（不是上游错误响应时按超时或网络错误处理）
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Class != "" {
+			return apiErr.Class
+		}
+		return ClassifyError(apiErr.Status, "", apiErr.Message)
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrorClassTimeout
+	}
+	return ErrorClassTransport
+}
+
+func containsAny(s string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.Contains(s, keyword) {
+			return true
+		}
+	}
+	return false
+}
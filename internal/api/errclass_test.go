@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// errorFixture 读取 testdata/errors 中记录的上游错误响应体
+func errorFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", "errors", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestClassifyUpstreamErrorBodies(t *testing.T) {
+	tests := []struct {
+		fixture string
+		status  int
+		class   string
+	}{
+		{"unauthenticated.json", 401, ErrorClassAuth},
+		{"unauthenticated_string_code.json", 400, ErrorClassAuth},
+		{"permission_denied.json", 403, ErrorClassAuth},
+		{"resource_exhausted.json", 429, ErrorClassQuota},
+		{"model_capacity_exhausted.json", 429, ErrorClassQuota},
+		{"content_filter.json", 400, ErrorClassSafety}, // 安全拦截以 INVALID_ARGUMENT 返回
+		{"prohibited_content.json", 400, ErrorClassSafety},
+		{"invalid_json_payload.json", 400, ErrorClassSchema},
+		{"claude_invalid_request.json", 400, ErrorClassSchema},
+		{"internal_invalid_argument.json", 500, ErrorClassSchema}, // 参数错误以 500 返回
+		{"model_not_found.json", 404, ErrorClassSchema},
+		{"deadline_exceeded.json", 504, ErrorClassTimeout},
+		{"unavailable.json", 503, ErrorClassTransport},
+		{"claude_overloaded.json", 529, ErrorClassTransport},
+		{"bad_gateway.html", 502, ErrorClassTransport}, // 前端代理返回的 HTML 错误页
+		{"internal.json", 500, ErrorClassUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: make(http.Header)}
+			apiErr := ExtractErrorDetails(resp, errorFixture(t, tt.fixture))
+			if apiErr.Class != tt.class {
+				t.Fatalf("class = %q, want %q (status %d, message %q)", apiErr.Class, tt.class, apiErr.Status, apiErr.Message)
+			}
+			if got := ErrorClass(apiErr); got != tt.class {
+				t.Fatalf("ErrorClass = %q, want %q", got, tt.class)
+			}
+		})
+	}
+}
+
+func TestExtractErrorDetailsFromFixtures(t *testing.T) {
+	resp := &http.Response{StatusCode: 429, Header: make(http.Header)}
+	apiErr := ExtractErrorDetails(resp, errorFixture(t, "resource_exhausted.json"))
+	if apiErr.RetryDelay < 17*time.Second || apiErr.RetryDelay > 18*time.Second {
+		t.Errorf("retry delay = %v, want the RetryInfo delay", apiErr.RetryDelay)
+	}
+
+	// 字符串形式的错误码映射为 HTTP 状态
+	resp = &http.Response{StatusCode: 400, Header: make(http.Header)}
+	apiErr = ExtractErrorDetails(resp, errorFixture(t, "unauthenticated_string_code.json"))
+	if apiErr.Status != 401 || !apiErr.DisableToken {
+		t.Errorf("status = %d, disable = %v", apiErr.Status, apiErr.DisableToken)
+	}
+
+	resp = &http.Response{StatusCode: 502, Header: make(http.Header)}
+	apiErr = ExtractErrorDetails(resp, errorFixture(t, "bad_gateway.html"))
+	if apiErr.Status != 502 || apiErr.Message != "Unknown error" {
+		t.Errorf("html error page = %d %q", apiErr.Status, apiErr.Message)
+	}
+}
+
+// timeoutError 超时的网络错误
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestErrorClassOfLocalErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		class string
+	}{
+		{"nil", nil, ""},
+		{"deadline", context.DeadlineExceeded, ErrorClassTimeout},
+		{"wrapped deadline", fmt.Errorf("send: %w", context.DeadlineExceeded), ErrorClassTimeout},
+		{"net timeout", &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, ErrorClassTimeout},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, ErrorClassTransport},
+		{"other", errors.New("unexpected EOF"), ErrorClassTransport},
+		{"classified api error", fmt.Errorf("retry: %w", &APIError{Status: 500, Class: ErrorClassSafety}), ErrorClassSafety},
+		// 本地构造的 APIError 没有分类时按状态码和消息分类
+		{"unclassified api error", &APIError{Status: 429, Message: "too many requests"}, ErrorClassQuota},
+		{"decompress failure", &APIError{Status: 502, Message: "failed to decompress response: EOF"}, ErrorClassTransport},
+	}
+	for _, tt := range tests {
+		if got := ErrorClass(tt.err); got != tt.class {
+			t.Errorf("%s: ErrorClass = %q, want %q", tt.name, got, tt.class)
+		}
+	}
+}
+
+func TestClassifyErrorPrecedence(t *testing.T) {
+	tests := []struct {
+		status         int
+		upstreamStatus string
+		message        string
+		class          string
+	}{
+		// 鉴权优先于消息内容
+		{403, "", "quota project not set", ErrorClassAuth},
+		{0, "unauthenticated", "", ErrorClassAuth},
+		{500, "", "Quota exceeded for quota metric", ErrorClassQuota},
+		{400, "", "Rate limit reached", ErrorClassQuota},
+		// 安全拦截优先于格式错误
+		{400, "INVALID_ARGUMENT", "Candidate was blocked due to SAFETY", ErrorClassSafety},
+		{500, "", "upstream request timeout", ErrorClassTimeout},
+		{408, "", "", ErrorClassTimeout},
+		{422, "", "", ErrorClassSchema},
+		{500, "FAILED_PRECONDITION", "", ErrorClassSchema},
+		{500, "", "function_declarations[2].parameters missing", ErrorClassSchema},
+		{0, "UNAVAILABLE", "", ErrorClassTransport},
+		{500, "", "", ErrorClassUnknown},
+	}
+	for _, tt := range tests {
+		if got := ClassifyError(tt.status, tt.upstreamStatus, tt.message); got != tt.class {
+			t.Errorf("ClassifyError(%d, %q, %q) = %q, want %q", tt.status, tt.upstreamStatus, tt.message, got, tt.class)
+		}
+	}
+}
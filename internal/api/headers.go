@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/logger"
+)
+
+// applyHeaderOverrides 应用配置的上游请求头（空值移除默认头）
+// 支持模板变量：{{requestId}}、{{model}}、{{endpointHost}}、{{endpointKey}}
+func applyHeaderOverrides(header http.Header, endpoint config.Endpoint, req *converter.AntigravityRequest) {
+	overrides := config.GetEndpointManager().HeadersFor(endpoint.Key)
+	if len(overrides) == 0 {
+		return
+	}
+
+	replacer := strings.NewReplacer(
+		"{{requestId}}", req.RequestID,
+		"{{model}}", req.Model,
+		"{{endpointHost}}", endpoint.Host,
+		"{{endpointKey}}", endpoint.Key,
+	)
+	for key, value := range overrides {
+		if value == "" {
+			header.Del(key)
+			continue
+		}
+		header.Set(key, replacer.Replace(value))
+	}
+}
+
+// headerCapture 记录发往上游的请求头（调试用）及最后一次上游调用的端点和错误分类
+type headerCapture struct {
+	mu         sync.Mutex
+	headers    map[string]string
+	endpoint   string
+	errorClass string
+}
+
+// headerCaptureKey 请求头捕获的 context key
+type headerCaptureKey struct{}
+
+// WithHeaderCapture 返回可捕获上游请求头（仅在 API 调试级别为 high 时记录）和上游调用结果的 context
+func WithHeaderCapture(ctx context.Context) context.Context {
+	return context.WithValue(ctx, headerCaptureKey{}, &headerCapture{})
+}
+
+// CapturedHeaders 获取捕获的上游请求头（重试时为最后一次请求）
+func CapturedHeaders(ctx context.Context) map[string]string {
+	capture, ok := ctx.Value(headerCaptureKey{}).(*headerCapture)
+	if !ok {
+		return nil
+	}
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	return capture.headers
+}
+
+// CapturedOutcome 获取最后一次上游调用的端点和错误分类（成功时分类为空）
+func CapturedOutcome(ctx context.Context) (endpoint, errorClass string) {
+	capture, ok := ctx.Value(headerCaptureKey{}).(*headerCapture)
+	if !ok {
+		return "", ""
+	}
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	return capture.endpoint, capture.errorClass
+}
+
+// captureOutcome 记录上游调用的端点和错误分类（不受调试级别限制）
+func captureOutcome(ctx context.Context, endpoint string, err error) {
+	capture, ok := ctx.Value(headerCaptureKey{}).(*headerCapture)
+	if !ok {
+		return
+	}
+	capture.mu.Lock()
+	capture.endpoint = endpoint
+	capture.errorClass = ErrorClass(err)
+	capture.mu.Unlock()
+}
+
+// captureHeaders 记录请求头，Authorization 脱敏
+func captureHeaders(ctx context.Context, header http.Header) {
+	capture, ok := ctx.Value(headerCaptureKey{}).(*headerCapture)
+	if !ok || !logger.Enabled(logger.ComponentAPI, logger.LogHigh) {
+		return
+	}
+
+	headers := make(map[string]string, len(header))
+	for key, values := range header {
+		if key == "Authorization" {
+			headers[key] = "Bearer ******"
+			continue
+		}
+		headers[key] = strings.Join(values, ", ")
+	}
+
+	capture.mu.Lock()
+	capture.headers = headers
+	capture.mu.Unlock()
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"anti2api-golang/internal/converter"
+)
+
+func TestHeartbeatStyles(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sw := NewStreamWriter(rec, "chatcmpl-1", 1, "m")
+	if err := sw.WriteHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"delta":{}`) || strings.Contains(body, "keepalive") {
+		t.Errorf("chunk heartbeat = %q, want an empty delta chunk", body)
+	}
+
+	rec = httptest.NewRecorder()
+	sw = NewStreamWriter(rec, "chatcmpl-2", 1, "m")
+	sw.SetHeartbeatStyle(HeartbeatStyleComment)
+	if err := sw.WriteHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if body := rec.Body.String(); body != ": keepalive\n\n" {
+		t.Errorf("comment heartbeat = %q, want only an SSE comment", body)
+	}
+}
+
+func TestNoHeartbeatAfterContent(t *testing.T) {
+	for name, write := range map[string]func(sw *StreamWriter) error{
+		"content":   func(sw *StreamWriter) error { return sw.WriteContent("hi") },
+		"reasoning": func(sw *StreamWriter) error { return sw.WriteReasoning("hmm") },
+		"tool calls": func(sw *StreamWriter) error {
+			return sw.WriteToolCalls([]converter.OpenAIToolCall{{ID: "call-1", Type: "function"}})
+		},
+		"finish": func(sw *StreamWriter) error { return sw.WriteFinish("stop", nil) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			sw := NewStreamWriter(rec, "chatcmpl-1", 1, "m")
+			sw.SetHeartbeatStyle(HeartbeatStyleComment)
+			if err := write(sw); err != nil {
+				t.Fatal(err)
+			}
+			if !sw.ContentStarted() {
+				t.Fatal("ContentStarted should be set")
+			}
+			before := rec.Body.String()
+			if err := sw.WriteHeartbeat(); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Body.String() != before {
+				t.Errorf("heartbeat written after %s: %q", name, strings.TrimPrefix(rec.Body.String(), before))
+			}
+		})
+	}
+}
+
+func TestHeartbeatRacingFirstContent(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		rec := httptest.NewRecorder()
+		sw := NewStreamWriter(rec, "chatcmpl-1", 1, "m")
+		sw.SetHeartbeatStyle(HeartbeatStyleComment)
+
+		var wg sync.WaitGroup
+		stop := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					sw.WriteHeartbeat()
+				}
+			}
+		}()
+		sw.WriteContent("first")
+		sw.WriteContent("second")
+		close(stop)
+		wg.Wait()
+
+		// 首个内容之后不能再出现心跳
+		body := rec.Body.String()
+		first := strings.Index(body, "first")
+		if first < 0 {
+			t.Fatalf("content missing: %q", body)
+		}
+		if strings.Contains(body[first:], "keepalive") {
+			t.Fatalf("heartbeat written after content:\n%s", body)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+)
+
+// ProbeEndpoint 检查端点是否可达（与上游请求使用相同的代理和连接设置），返回耗时和 HTTP 状态码。
+// 任何 HTTP 响应都表示可达
+func ProbeEndpoint(ctx context.Context, endpoint config.Endpoint) (time.Duration, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+endpoint.Host+"/", nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	start := time.Now()
+	resp, err := GetClient().httpClient.Do(req)
+	if err != nil {
+		return time.Since(start), 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	return time.Since(start), resp.StatusCode, nil
+}
+
+var endpointProbation monitor.Loop
+
+// StartEndpointProbation 启动原端点探测：错误预算触发降级后按 ENDPOINT_PROBE_INTERVAL 探测原端点，
+// 通过观察期时由 EndpointManager 切回（未配置备用端点时不启动）
+func StartEndpointProbation() {
+	cfg := config.Get()
+	interval := time.Duration(cfg.EndpointProbeInterval) * time.Second
+	if interval <= 0 || config.GetEndpointManager().AutoFailoverStatus().State == config.AutoFailoverDisabled {
+		return
+	}
+	startEndpointProbation(interval)
+}
+
+func startEndpointProbation(interval time.Duration) {
+	endpointProbation.Start("endpoint-probation", func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				probeOriginalEndpoint(ctx)
+			}
+		}
+	})
+}
+
+// StopEndpointProbation 停止原端点探测，等待进行中的探测结束（探测随之取消）
+func StopEndpointProbation(ctx context.Context) error {
+	return endpointProbation.Stop(ctx)
+}
+
+// probeOriginalEndpoint 探测一次降级前的端点（5xx 和连接失败视为未恢复，停止时中断的探测不计入）
+func probeOriginalEndpoint(ctx context.Context) {
+	manager := config.GetEndpointManager()
+	endpoint, ok := manager.ProbationEndpoint()
+	if !ok {
+		return
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_, status, err := ProbeEndpoint(probeCtx, endpoint)
+	if ctx.Err() != nil {
+		return
+	}
+	healthy := err == nil && status < http.StatusInternalServerError
+	if !healthy {
+		logger.Warn("Probation probe of endpoint %s failed (status %d): %v", endpoint.Key, status, err)
+	}
+	manager.RecordProbe(healthy)
+}
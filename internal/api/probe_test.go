@@ -0,0 +1,31 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/monitor"
+)
+
+func TestEndpointProbationStops(t *testing.T) {
+	startEndpointProbation(5 * time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for monitor.GoroutinesByStage()["endpoint-probation"] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("endpoint probation did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := StopEndpointProbation(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	deadline = time.Now().Add(time.Second)
+	for monitor.GoroutinesByStage()["endpoint-probation"] > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("endpoint probation still running after stop")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
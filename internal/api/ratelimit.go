@@ -0,0 +1,136 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"anti2api-golang/internal/store"
+)
+
+// 上游可能使用的限额头（按优先级）
+var (
+	remainingRequestsHeaders = []string{"X-Ratelimit-Remaining-Requests", "X-Ratelimit-Remaining", "Ratelimit-Remaining"}
+	remainingTokensHeaders   = []string{"X-Ratelimit-Remaining-Tokens"}
+	resetRequestsHeaders     = []string{"X-Ratelimit-Reset-Requests", "X-Ratelimit-Reset", "Ratelimit-Reset"}
+	resetTokensHeaders       = []string{"X-Ratelimit-Reset-Tokens"}
+)
+
+// defaultRetryAfter 429 响应没有更准确的重试时间时使用的 Retry-After
+const defaultRetryAfter = time.Second
+
+// ParseRateLimitHeaders 解析上游响应中的限额头，retryDelay 为错误详情中的 RetryInfo（没有时为 0）。
+// 没有任何限额信息时返回 false
+func ParseRateLimitHeaders(h http.Header, retryDelay time.Duration, now time.Time) (store.RateLimitSnapshot, bool) {
+	snap := store.RateLimitSnapshot{UpdatedAt: now, Raw: make(map[string]string)}
+
+	lookup := func(names []string) string {
+		for _, name := range names {
+			if v := strings.TrimSpace(h.Get(name)); v != "" {
+				snap.Raw[name] = v
+				return v
+			}
+		}
+		return ""
+	}
+
+	if v, err := strconv.ParseInt(lookup(remainingRequestsHeaders), 10, 64); err == nil {
+		snap.RemainingRequests = &v
+	}
+	if v, err := strconv.ParseInt(lookup(remainingTokensHeaders), 10, 64); err == nil {
+		snap.RemainingTokens = &v
+	}
+	if t, ok := parseReset(lookup(resetRequestsHeaders), now); ok {
+		snap.ResetRequests = &t
+	}
+	if t, ok := parseReset(lookup(resetTokensHeaders), now); ok {
+		snap.ResetTokens = &t
+	}
+
+	retryAfter := parseRetryAfter(lookup([]string{"Retry-After"}), now)
+	if retryAfter < retryDelay {
+		retryAfter = retryDelay
+	}
+	if retryAfter > 0 {
+		t := now.Add(retryAfter)
+		snap.RetryAt = &t
+	}
+
+	found := snap.RemainingRequests != nil || snap.RemainingTokens != nil || snap.RetryAt != nil
+	return snap, found
+}
+
+// parseReset 解析重置时间：秒数、Unix 时间戳（秒）或时长字符串（如 "6m0s"、"20ms"）
+func parseReset(v string, now time.Time) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, false
+	}
+	if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds >= 0 {
+		if seconds > 1e9 {
+			return time.Unix(int64(seconds), 0), true
+		}
+		return now.Add(time.Duration(seconds * float64(time.Second))), true
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(d), true
+	}
+	return time.Time{}, false
+}
+
+// parseRetryAfter 解析 Retry-After：秒数或 HTTP 日期
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// recordRateLimit 记录上游响应中的限额（429 时即使没有限额头也记录重试时间）
+func recordRateLimit(resp *http.Response, token *store.Account, retryDelay time.Duration) {
+	if resp.StatusCode == http.StatusTooManyRequests && retryDelay == 0 {
+		retryDelay = defaultRetryAfter
+	}
+	if snap, ok := ParseRateLimitHeaders(resp.Header, retryDelay, time.Now()); ok {
+		store.RecordRateLimit(token, snap)
+	}
+}
+
+// SetRateLimitHeaders 按账号池限额设置 OpenAI 风格的 x-ratelimit-* 响应头，429 响应保证带 Retry-After
+func SetRateLimitHeaders(h http.Header, pool store.PoolRateLimit, status int) {
+	if pool.RemainingRequests != nil {
+		h.Set("X-Ratelimit-Remaining-Requests", strconv.FormatInt(*pool.RemainingRequests, 10))
+		h.Set("X-Ratelimit-Reset-Requests", formatReset(pool.ResetRequests))
+	}
+	if pool.RemainingTokens != nil {
+		h.Set("X-Ratelimit-Remaining-Tokens", strconv.FormatInt(*pool.RemainingTokens, 10))
+		h.Set("X-Ratelimit-Reset-Tokens", formatReset(pool.ResetTokens))
+	}
+
+	if status != http.StatusTooManyRequests || h.Get("Retry-After") != "" {
+		return
+	}
+	retryAfter := pool.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+	h.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+}
+
+// formatReset 按 OpenAI 的格式输出重置时长（如 "1s"、"6m0s"、"20ms"）
+func formatReset(d time.Duration) string {
+	if d <= 0 {
+		return "0s"
+	}
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
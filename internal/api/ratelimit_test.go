@@ -0,0 +1,158 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/store"
+)
+
+// headerOf 由键值对构造响应头
+func headerOf(kv ...string) http.Header {
+	h := make(http.Header)
+	for i := 0; i+1 < len(kv); i += 2 {
+		h.Set(kv[i], kv[i+1])
+	}
+	return h
+}
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return now.Add(d) }
+
+	for _, tc := range []struct {
+		name     string
+		header   http.Header
+		delay    time.Duration
+		requests int64
+		reset    time.Time
+		retryAt  time.Time
+	}{
+		{"openai style", headerOf("X-Ratelimit-Remaining-Requests", "42", "X-Ratelimit-Reset-Requests", "6m0s"), 0, 42, at(6 * time.Minute), time.Time{}},
+		{"generic remaining and seconds", headerOf("X-Ratelimit-Remaining", "5", "X-Ratelimit-Reset", "30"), 0, 5, at(30 * time.Second), time.Time{}},
+		{"ietf draft", headerOf("Ratelimit-Remaining", "9", "Ratelimit-Reset", "1.5"), 0, 9, at(1500 * time.Millisecond), time.Time{}},
+		{"unix timestamp reset", headerOf("X-Ratelimit-Remaining-Requests", "1", "X-Ratelimit-Reset-Requests", "1767323045"), 0, 1, time.Unix(1767323045, 0), time.Time{}},
+		// 更具体的头优先
+		{"precedence", headerOf("X-Ratelimit-Remaining", "1", "X-Ratelimit-Remaining-Requests", "2"), 0, 2, time.Time{}, time.Time{}},
+		{"retry after seconds", headerOf("Retry-After", "7"), 0, -1, time.Time{}, at(7 * time.Second)},
+		{"retry after date", headerOf("Retry-After", now.Add(90*time.Second).Format(http.TimeFormat)), 0, -1, time.Time{}, at(90 * time.Second)},
+		// 错误详情中的 RetryInfo 更长时以它为准
+		{"retry info wins", headerOf("Retry-After", "2"), 10 * time.Second, -1, time.Time{}, at(10 * time.Second)},
+		{"retry info only", headerOf(), 3 * time.Second, -1, time.Time{}, at(3 * time.Second)},
+		{"invalid values", headerOf("X-Ratelimit-Remaining-Requests", "many", "X-Ratelimit-Reset-Requests", "soon", "Retry-After", "-1"), 0, -1, time.Time{}, time.Time{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			snap, found := ParseRateLimitHeaders(tc.header, tc.delay, now)
+			if wantFound := tc.requests >= 0 || !tc.retryAt.IsZero(); found != wantFound {
+				t.Fatalf("found = %v, want %v (%+v)", found, wantFound, snap)
+			}
+			if tc.requests >= 0 && (snap.RemainingRequests == nil || *snap.RemainingRequests != tc.requests) {
+				t.Errorf("remaining = %v, want %d", snap.RemainingRequests, tc.requests)
+			}
+			if tc.requests < 0 && snap.RemainingRequests != nil {
+				t.Errorf("remaining = %d, want unknown", *snap.RemainingRequests)
+			}
+			if got := snap.ResetRequests; (got == nil) != tc.reset.IsZero() || (got != nil && !got.Equal(tc.reset)) {
+				t.Errorf("reset = %v, want %v", got, tc.reset)
+			}
+			if got := snap.RetryAt; (got == nil) != tc.retryAt.IsZero() || (got != nil && !got.Equal(tc.retryAt)) {
+				t.Errorf("retryAt = %v, want %v", got, tc.retryAt)
+			}
+		})
+	}
+}
+
+func TestParseRateLimitHeadersKeepsRawValues(t *testing.T) {
+	snap, _ := ParseRateLimitHeaders(headerOf(
+		"X-Ratelimit-Remaining-Requests", "42",
+		"X-Ratelimit-Remaining-Tokens", "9000",
+		"X-Ratelimit-Reset-Tokens", "20ms",
+		"Content-Type", "application/json",
+	), 0, time.Now())
+	want := map[string]string{
+		"X-Ratelimit-Remaining-Requests": "42",
+		"X-Ratelimit-Remaining-Tokens":   "9000",
+		"X-Ratelimit-Reset-Tokens":       "20ms",
+	}
+	if len(snap.Raw) != len(want) {
+		t.Errorf("raw = %v, want %v", snap.Raw, want)
+	}
+	for k, v := range want {
+		if snap.Raw[k] != v {
+			t.Errorf("raw[%s] = %q, want %q", k, snap.Raw[k], v)
+		}
+	}
+	if snap.RemainingTokens == nil || *snap.RemainingTokens != 9000 {
+		t.Errorf("tokens = %v", snap.RemainingTokens)
+	}
+}
+
+func TestSetRateLimitHeaders(t *testing.T) {
+	requests, tokens := int64(40), int64(12000)
+	pool := store.PoolRateLimit{
+		RemainingRequests: &requests,
+		RemainingTokens:   &tokens,
+		ResetRequests:     6*time.Minute + 400*time.Millisecond,
+		ResetTokens:       20 * time.Millisecond,
+	}
+	h := make(http.Header)
+	SetRateLimitHeaders(h, pool, http.StatusOK)
+	for name, want := range map[string]string{
+		"X-Ratelimit-Remaining-Requests": "40",
+		"X-Ratelimit-Reset-Requests":     "6m0s",
+		"X-Ratelimit-Remaining-Tokens":   "12000",
+		"X-Ratelimit-Reset-Tokens":       "20ms",
+		"Retry-After":                    "",
+	} {
+		if got := h.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	// 限额未知时不输出 x-ratelimit-*
+	h = make(http.Header)
+	SetRateLimitHeaders(h, store.PoolRateLimit{}, http.StatusOK)
+	if len(h) != 0 {
+		t.Errorf("headers = %v, want none", h)
+	}
+}
+
+func TestSetRateLimitHeadersRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		pool     store.PoolRateLimit
+		existing string
+		want     string
+	}{
+		{"pool retry rounded up", store.PoolRateLimit{RetryAfter: 2100 * time.Millisecond}, "", "3"},
+		{"default", store.PoolRateLimit{}, "", "1"},
+		// 限流中间件或上游已给出的值不覆盖
+		{"existing kept", store.PoolRateLimit{RetryAfter: time.Minute}, "15", "15"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := make(http.Header)
+			if tc.existing != "" {
+				h.Set("Retry-After", tc.existing)
+			}
+			SetRateLimitHeaders(h, tc.pool, http.StatusTooManyRequests)
+			if got := h.Get("Retry-After"); got != tc.want {
+				t.Errorf("Retry-After = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFormatReset(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                       "0s",
+		-time.Second:            "0s",
+		20 * time.Millisecond:   "20ms",
+		1500 * time.Millisecond: "2s",
+		90 * time.Second:        "1m30s",
+	} {
+		if got := formatReset(d); got != want {
+			t.Errorf("formatReset(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
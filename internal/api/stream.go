@@ -2,25 +2,34 @@ package api
 
 import (
 	"bufio"
-	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unicode/utf8"
 
 	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/store"
 	"anti2api-golang/internal/utils"
 )
 
 // StreamChunk 流式数据块
 type StreamChunk struct {
-	Type      string                     // thinking, text, tool_calls, done
-	Content   string                     // 文本内容
-	ToolCalls []converter.OpenAIToolCall // 工具调用
-	Usage     *converter.UsageMetadata   // 使用统计
+	Type         string                       // thinking, text, tool_calls, usage, grounding, finish, done
+	Content      string                       // 文本内容
+	ToolCalls    []converter.OpenAIToolCall   // 工具调用
+	Usage        *converter.UsageMetadata     // 使用统计
+	Grounding    *converter.GroundingMetadata // 联网搜索的引用信息
+	FinishReason string                       // 上游候选的 finishReason（STOP、MAX_TOKENS、SAFETY 等）
 }
 
 // StreamData 原始流式数据
@@ -35,52 +44,86 @@ type StreamData struct {
 					ThoughtSignature string                  `json:"thoughtSignature,omitempty"` // API 签名
 				} `json:"parts"`
 			} `json:"content"`
-			FinishReason string `json:"finishReason,omitempty"`
+			FinishReason      string                       `json:"finishReason,omitempty"`
+			GroundingMetadata *converter.GroundingMetadata `json:"groundingMetadata,omitempty"`
 		} `json:"candidates"`
 		UsageMetadata *converter.UsageMetadata `json:"usageMetadata,omitempty"`
 	} `json:"response"`
 }
 
-// ProcessStreamResponse 处理流式响应
-func ProcessStreamResponse(resp *http.Response, callback func(chunk StreamChunk)) (*converter.UsageMetadata, error) {
+// ErrStreamTruncated 上游流在结束（finishReason 或 [DONE]）之前中断，已接收的工具调用可能不完整
+var ErrStreamTruncated = errors.New("upstream stream ended unexpectedly before finish")
+
+// ErrStreamCanceled 客户端断开或请求被取消，已停止读取上游流
+var ErrStreamCanceled = errors.New("stream canceled")
+
+// ProcessStreamResponse 处理流式响应。上游在结束前断开（EOF、连接重置）时返回 ErrStreamTruncated，
+// 此时尚未完成的工具调用会被丢弃，不会通过回调发送。ctx 取消时立即关闭上游响应体并返回 ErrStreamCanceled，
+// 不再继续读取（避免客户端断开后上游仍生成到结束，消耗配额并占用连接）
+func ProcessStreamResponse(ctx context.Context, resp *http.Response, callback func(chunk StreamChunk)) (*converter.UsageMetadata, error) {
 	defer resp.Body.Close()
+	// 关闭响应体使阻塞中的读取立即返回
+	stop := context.AfterFunc(ctx, func() { resp.Body.Close() })
+	defer stop()
 
-	var reader io.Reader = resp.Body
-	if resp.Header.Get("Content-Encoding") == "gzip" {
-		gzReader, err := gzip.NewReader(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		defer gzReader.Close()
-		reader = gzReader
+	reader, err := DecodeBody(resp)
+	if err != nil {
+		return nil, err
 	}
+	defer reader.Close()
+	contentEncoding := resp.Header.Get("Content-Encoding")
 
 	// 使用较小的缓冲区以减少延迟（4KB）
 	bufReader := bufio.NewReaderSize(reader, 4*1024)
 
 	var usage *converter.UsageMetadata
-	var toolCalls []converter.OpenAIToolCall
+	firstLine := true
+	finished := false // 收到 finishReason 或 [DONE]
 
 	for {
 		// ReadString 会在读到分隔符时立即返回，不会等待缓冲区填满
 		line, err := bufReader.ReadString('\n')
+		if ctx.Err() != nil {
+			return usage, fmt.Errorf("%w: %v", ErrStreamCanceled, context.Cause(ctx))
+		}
 		if err != nil {
 			if err == io.EOF {
+				// 无换行的残留数据同样需要校验（压缩数据可能不含换行符）
+				if firstLine && line != "" {
+					if checkErr := checkTextLine(line, contentEncoding); checkErr != nil {
+						return usage, checkErr
+					}
+				}
+				if !finished {
+					return usage, ErrStreamTruncated
+				}
+				break
+			}
+			if finished {
 				break
 			}
-			return usage, err
+			return usage, fmt.Errorf("%w: %v", ErrStreamTruncated, err)
 		}
 
 		// 去掉末尾的换行符
 		line = strings.TrimSuffix(line, "\n")
 		line = strings.TrimSuffix(line, "\r")
 
+		// 首行必须是可读文本，否则说明压缩格式未被正确识别
+		if firstLine && line != "" {
+			firstLine = false
+			if err := checkTextLine(line, contentEncoding); err != nil {
+				return usage, err
+			}
+		}
+
 		if !strings.HasPrefix(line, "data: ") {
 			continue
 		}
 
 		jsonData := line[6:]
 		if jsonData == "[DONE]" {
+			finished = true
 			callback(StreamChunk{Type: "done"})
 			break
 		}
@@ -90,9 +133,10 @@ func ProcessStreamResponse(resp *http.Response, callback func(chunk StreamChunk)
 			continue
 		}
 
-		// 提取 usage
+		// 提取 usage（返回最后一次，每次都通过回调通知，由调用方按模型配置合并）
 		if data.Response.UsageMetadata != nil {
 			usage = data.Response.UsageMetadata
+			callback(StreamChunk{Type: "usage", Usage: usage})
 		}
 
 		// 检查是否有候选响应
@@ -111,13 +155,13 @@ func ProcessStreamResponse(resp *http.Response, callback func(chunk StreamChunk)
 				// 普通文本
 				callback(StreamChunk{Type: "text", Content: part.Text})
 			} else if part.FunctionCall != nil {
-				// 工具调用（累积）
+				// 工具调用（每个 functionCall 到达时立即发送）
 				argsJSON, _ := json.Marshal(part.FunctionCall.Args)
 				id := part.FunctionCall.ID
 				if id == "" {
 					id = utils.GenerateToolCallID()
 				}
-				toolCalls = append(toolCalls, converter.OpenAIToolCall{
+				callback(StreamChunk{Type: "tool_calls", ToolCalls: []converter.OpenAIToolCall{{
 					ID:   id,
 					Type: "function",
 					Function: converter.OpenAIFunctionCall{
@@ -125,30 +169,66 @@ func ProcessStreamResponse(resp *http.Response, callback func(chunk StreamChunk)
 						Arguments: string(argsJSON),
 					},
 					ThoughtSignature: part.ThoughtSignature, // 保存签名用于后续请求
-				})
+				}}})
 			}
 		}
 
-		// 响应结束时发送工具调用
-		if candidate.FinishReason != "" && len(toolCalls) > 0 {
-			callback(StreamChunk{Type: "tool_calls", ToolCalls: toolCalls})
-			toolCalls = nil
+		// 引用信息通常在流末尾出现，由调用方合并后对应到已输出的正文
+		if candidate.GroundingMetadata != nil {
+			callback(StreamChunk{Type: "grounding", Grounding: candidate.GroundingMetadata})
 		}
-	}
 
-	// 如果有未发送的工具调用
-	if len(toolCalls) > 0 {
-		callback(StreamChunk{Type: "tool_calls", ToolCalls: toolCalls})
+		if candidate.FinishReason != "" {
+			finished = true
+			callback(StreamChunk{Type: "finish", FinishReason: candidate.FinishReason})
+		}
 	}
 
 	return usage, nil
 }
 
-// SetStreamHeaders 设置流式响应头
+// ErrStreamingUnsupported 连接不支持逐块刷新（继续流式输出只会被整体缓冲）
+var ErrStreamingUnsupported = errors.New("streaming is not supported on this connection (response cannot be flushed incrementally); retry with stream disabled")
+
+// CanFlush 检查 ResponseWriter 是否支持逐块刷新（沿 Unwrap 链找到最内层的 ResponseWriter，
+// 包装器即使实现了 Flush，底层不支持时也只是空操作）
+func CanFlush(w http.ResponseWriter) bool {
+	for {
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	_, ok := w.(http.Flusher)
+	return ok
+}
+
+// PrepareStream 流式输出前检查连接并按协议设置响应头：
+// HTTP/1.1 使用 chunked 传输；HTTP/1.0 不支持 chunked，以关闭连接标记结束；HTTP/2 由帧层分块，不设置连接相关头
+func PrepareStream(w http.ResponseWriter, r *http.Request) error {
+	if !CanFlush(w) {
+		return ErrStreamingUnsupported
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	switch {
+	case r.ProtoMajor == 1 && r.ProtoMinor == 0:
+		h.Set("Connection", "close")
+	case r.ProtoMajor == 1:
+		h.Set("Transfer-Encoding", "chunked")
+		h.Set("Connection", "keep-alive")
+	}
+	return nil
+}
+
+// SetStreamHeaders 设置流式响应头（不覆盖 PrepareStream 按协议设置的 Connection）
 func SetStreamHeaders(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+	if w.Header().Get("Connection") == "" {
+		w.Header().Set("Connection", "keep-alive")
+	}
 	w.Header().Set("X-Accel-Buffering", "no")
 }
 
@@ -168,24 +248,29 @@ func WriteStreamData(w http.ResponseWriter, data interface{}) error {
 	return nil
 }
 
-// WriteStreamDone 写入流结束标记
-func WriteStreamDone(w http.ResponseWriter) {
-	w.Write([]byte("data: [DONE]\n\n"))
+// WriteStreamDone 写入流结束标记，返回写入错误（客户端已断开）
+func WriteStreamDone(w http.ResponseWriter) error {
+	if _, err := w.Write([]byte("data: [DONE]\n\n")); err != nil {
+		return err
+	}
 	if f, ok := w.(http.Flusher); ok {
 		f.Flush()
 	}
+	return nil
 }
 
-// WriteStreamError 写入流错误
-func WriteStreamError(w http.ResponseWriter, errMsg string) {
+// WriteStreamError 写入流错误（错误类型按状态码确定），返回写入错误（客户端已断开）
+func WriteStreamError(w http.ResponseWriter, status int, errMsg string) error {
 	errResp := map[string]interface{}{
 		"error": map[string]interface{}{
 			"message": errMsg,
-			"type":    "server_error",
+			"type":    ErrorType(status),
 		},
 	}
-	WriteStreamData(w, errResp)
-	WriteStreamDone(w)
+	if err := WriteStreamData(w, errResp); err != nil {
+		return err
+	}
+	return WriteStreamDone(w)
 }
 
 // StreamWriter 流式写入器（带 UTF-8 缓冲，线程安全）
@@ -198,17 +283,133 @@ type StreamWriter struct {
 	contentBuffer   []byte     // 缓冲不完整的 UTF-8 内容字节
 	reasoningBuffer []byte     // 缓冲不完整的 UTF-8 思考字节
 	mu              sync.Mutex // 保护并发写入
+
+	// 增量合并
+	coalesce    time.Duration   // 合并间隔，0 为不合并
+	coalesceMax int             // 合并缓冲达到该字节数时立即输出
+	pending     strings.Builder // 待输出的完整 UTF-8 内容
+	pendingKind deltaKind
+	lastEmit    time.Time
+	timer       *time.Timer
+	finished    bool
+
+	// 统计
+	deltas     int // 收到的增量数
+	deltaBytes int // 收到的增量字节数
+	chunks     int // 输出的内容/思考 chunk 数
+
+	toolArgsFragment int // 工具调用参数分片大小，0 为整体输出
+	toolCallIndex    int // 下一个工具调用的 index
+
+	validationFailed []string               // 结束 chunk 中标记的未通过校验器
+	truncated        bool                   // 结束 chunk 中标记上游流中断
+	toolCallsPartial bool                   // 结束 chunk 中标记已输出的工具调用可能不完整
+	warnings         []string               // 结束 chunk 中返回的警告
+	quarantine       []string               // 结束 chunk 中标记的隔离规则
+	annotations      []converter.Annotation // 结束 chunk 中返回的引用（STREAM_ANNOTATIONS=final）
+	route            *store.RouteTrace      // 结束 chunk 中返回的路由说明（X-Debug-Route: explain）
+
+	// 已输出内容的摘要（按实际写出的 delta 计算，包括后处理和截断的结果）
+	contentHash   hash.Hash
+	reasoningHash hash.Hash
+	hasReasoning  bool
+
+	// 心跳
+	heartbeatComment bool        // 以 SSE 注释行发送心跳（否则发送空 delta 的 chunk）
+	contentStarted   atomic.Bool // 已输出真实内容（在锁内设置），之后不再发送心跳
+
+	writeErr     error       // 首次写入失败的错误，之后不再向连接写入
+	onWriteError func(error) // 首次写入失败时调用（取消上游请求）
 }
 
+// 心跳格式
+const (
+	HeartbeatStyleChunk   = "chunk"   // 空 delta 的 chat.completion.chunk
+	HeartbeatStyleComment = "comment" // SSE 注释行（": keepalive"），客户端解析器会忽略
+)
+
+// deltaKind 增量类型
+type deltaKind int
+
+const (
+	deltaContent deltaKind = iota
+	deltaReasoning
+)
+
 // NewStreamWriter 创建流式写入器
 func NewStreamWriter(w http.ResponseWriter, id string, created int64, model string) *StreamWriter {
 	SetStreamHeaders(w)
 	return &StreamWriter{
-		w:       w,
-		id:      id,
-		created: created,
-		model:   model,
+		w:             w,
+		id:            id,
+		created:       created,
+		model:         model,
+		contentHash:   sha256.New(),
+		reasoningHash: sha256.New(),
+	}
+}
+
+// 内容摘要响应头（流式响应作为 trailer 发送，传输不支持 trailer 时只在结束 chunk 中返回）
+const (
+	ContentDigestHeader   = "X-Content-Digest"
+	ReasoningDigestHeader = "X-Reasoning-Digest"
+)
+
+// ContentDigest 计算文本的摘要（sha256=十六进制）
+func ContentDigest(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return "sha256=" + hex.EncodeToString(sum[:])
+}
+
+func formatDigest(h hash.Hash) string {
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// recordEmittedLocked 累计已写出的内容/思考（调用者必须持有锁）
+func (sw *StreamWriter) recordEmittedLocked(kind deltaKind, text string) {
+	if kind == deltaReasoning {
+		sw.hasReasoning = true
+		sw.reasoningHash.Write([]byte(text))
+		return
 	}
+	sw.contentHash.Write([]byte(text))
+}
+
+// writeLocked 向连接写入（调用者必须持有锁）。写入失败后记录错误，后续写入直接返回该错误，
+// 避免继续向已断开的连接写数据
+func (sw *StreamWriter) writeLocked(write func(w http.ResponseWriter) error) error {
+	if sw.writeErr != nil {
+		return sw.writeErr
+	}
+	if err := write(sw.w); err != nil {
+		sw.writeErr = err
+		if sw.onWriteError != nil {
+			sw.onWriteError(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// OnWriteError 设置首次写入失败（客户端已断开）时的回调，回调在持有写入锁时调用，不能再写入
+func (sw *StreamWriter) OnWriteError(fn func(error)) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.onWriteError = fn
+}
+
+// writeDataLocked 写入一个 data 事件（调用者必须持有锁）
+func (sw *StreamWriter) writeDataLocked(data interface{}) error {
+	return sw.writeLocked(func(w http.ResponseWriter) error {
+		return WriteStreamData(w, data)
+	})
+}
+
+// Err 返回向客户端写入时遇到的首个错误（nil 表示连接正常）
+func (sw *StreamWriter) Err() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.writeErr
 }
 
 // writeRoleLocked 写入角色（内部使用，调用者必须持有锁）
@@ -223,7 +424,7 @@ func (sw *StreamWriter) writeRoleLocked() error {
 		&converter.Delta{Role: "assistant"},
 		nil, nil,
 	)
-	return WriteStreamData(sw.w, chunk)
+	return sw.writeDataLocked(chunk)
 }
 
 // WriteRole 写入角色（首次，线程安全）
@@ -300,6 +501,15 @@ func extractValidUTF8(data []byte) (valid string, remaining []byte) {
 	return "", remaining
 }
 
+// SetCoalesce 启用增量合并：内容/思考增量最多每 interval 输出一次，或累积到 maxBytes 时立即输出
+// interval <= 0 时关闭合并（每个增量单独输出）
+func (sw *StreamWriter) SetCoalesce(interval time.Duration, maxBytes int) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.coalesce = interval
+	sw.coalesceMax = maxBytes
+}
+
 // WriteContent 写入内容（带 UTF-8 缓冲，线程安全）
 func (sw *StreamWriter) WriteContent(content string) error {
 	sw.mu.Lock()
@@ -315,17 +525,7 @@ func (sw *StreamWriter) WriteContent(content string) error {
 	validContent, remaining := extractValidUTF8(data)
 	sw.contentBuffer = remaining
 
-	// 如果没有有效内容，跳过本次写入
-	if validContent == "" {
-		return nil
-	}
-
-	chunk := converter.CreateStreamChunk(
-		sw.id, sw.created, sw.model,
-		&converter.Delta{Content: validContent},
-		nil, nil,
-	)
-	return WriteStreamData(sw.w, chunk)
+	return sw.writeDeltaLocked(deltaContent, validContent)
 }
 
 // WriteReasoning 写入思考内容（带 UTF-8 缓冲，线程安全）
@@ -343,46 +543,182 @@ func (sw *StreamWriter) WriteReasoning(reasoning string) error {
 	validReasoning, remaining := extractValidUTF8(data)
 	sw.reasoningBuffer = remaining
 
+	return sw.writeDeltaLocked(deltaReasoning, validReasoning)
+}
+
+// writeDeltaLocked 输出内容/思考增量（只接收完整的 UTF-8 字符串），启用合并时先进入待输出缓冲
+func (sw *StreamWriter) writeDeltaLocked(kind deltaKind, text string) error {
 	// 如果没有有效内容，跳过本次写入
-	if validReasoning == "" {
+	if text == "" {
 		return nil
 	}
 
-	chunk := converter.CreateStreamChunk(
-		sw.id, sw.created, sw.model,
-		&converter.Delta{Reasoning: validReasoning},
-		nil, nil,
-	)
-	return WriteStreamData(sw.w, chunk)
+	sw.deltas++
+	sw.deltaBytes += len(text)
+	sw.contentStarted.Store(true)
+
+	if sw.coalesce <= 0 {
+		return sw.emitDeltaLocked(kind, text)
+	}
+
+	// 类型切换时先输出另一类待输出内容，保证顺序
+	if sw.pendingKind != kind && sw.pending.Len() > 0 {
+		if err := sw.flushPendingLocked(); err != nil {
+			return err
+		}
+	}
+	sw.pendingKind = kind
+	sw.pending.WriteString(text)
+
+	if (sw.coalesceMax > 0 && sw.pending.Len() >= sw.coalesceMax) || time.Since(sw.lastEmit) >= sw.coalesce {
+		return sw.flushPendingLocked()
+	}
+
+	// 没有新增量时由定时器负责输出
+	if sw.timer == nil {
+		sw.timer = time.AfterFunc(sw.coalesce-time.Since(sw.lastEmit), sw.timerFlush)
+	}
+	return nil
 }
 
-// WriteToolCalls 写入工具调用（线程安全）
+// timerFlush 合并间隔到期时输出待输出内容
+func (sw *StreamWriter) timerFlush() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.timer = nil
+	if sw.finished {
+		return
+	}
+	sw.flushPendingLocked()
+}
+
+// flushPendingLocked 输出合并缓冲中的内容（调用者必须持有锁）
+func (sw *StreamWriter) flushPendingLocked() error {
+	if sw.timer != nil {
+		sw.timer.Stop()
+		sw.timer = nil
+	}
+	if sw.pending.Len() == 0 {
+		return nil
+	}
+	text := sw.pending.String()
+	sw.pending.Reset()
+	return sw.emitDeltaLocked(sw.pendingKind, text)
+}
+
+// emitDeltaLocked 写出一个内容/思考 chunk
+func (sw *StreamWriter) emitDeltaLocked(kind deltaKind, text string) error {
+	delta := &converter.Delta{Content: text}
+	if kind == deltaReasoning {
+		delta = &converter.Delta{Reasoning: text}
+	}
+
+	sw.chunks++
+	sw.lastEmit = time.Now()
+	sw.recordEmittedLocked(kind, text)
+
+	chunk := converter.CreateStreamChunk(sw.id, sw.created, sw.model, delta, nil, nil)
+	return sw.writeDataLocked(chunk)
+}
+
+// Stats 返回增量合并统计（合并前为上游增量，合并后为实际输出的 chunk）
+func (sw *StreamWriter) Stats() *store.StreamStats {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	stats := &store.StreamStats{
+		CoalesceMs: int(sw.coalesce / time.Millisecond),
+		Deltas:     sw.deltas,
+		Chunks:     sw.chunks,
+	}
+	if sw.deltas > 0 {
+		stats.AvgDeltaBytes = float64(sw.deltaBytes) / float64(sw.deltas)
+	}
+	if sw.chunks > 0 {
+		stats.AvgChunkBytes = float64(sw.deltaBytes) / float64(sw.chunks)
+	}
+	return stats
+}
+
+// SetToolArgsFragment 设置工具调用参数分片大小（字节），size <= 0 时整体输出
+func (sw *StreamWriter) SetToolArgsFragment(size int) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.toolArgsFragment = size
+}
+
+// WriteToolCalls 写入工具调用（线程安全），可以多次调用，index 在整个响应中递增
 func (sw *StreamWriter) WriteToolCalls(toolCalls []converter.OpenAIToolCall) error {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
 
+	sw.contentStarted.Store(true)
 	sw.writeRoleLocked()
+	// 工具调用前必须输出已合并的内容
+	if err := sw.flushPendingLocked(); err != nil {
+		return err
+	}
+	return sw.writeToolCallFragmentsLocked(toolCalls)
+}
+
+// writeToolCallFragmentsLocked 按 OpenAI 增量格式输出工具调用：首个 chunk 携带 index/id/name，
+// 之后每个 chunk 只携带 index 和一段 arguments（未设置分片大小时为完整参数）
+func (sw *StreamWriter) writeToolCallFragmentsLocked(toolCalls []converter.OpenAIToolCall) error {
+	for _, tc := range toolCalls {
+		index := sw.toolCallIndex
+		sw.toolCallIndex++
+		fragments := SplitToolArguments(tc.Function.Arguments, sw.toolArgsFragment)
+
+		head := tc
+		head.Index = &index
+		head.Function.Arguments = ""
+		if err := sw.writeToolCallDeltaLocked(head); err != nil {
+			return err
+		}
+		for _, fragment := range fragments {
+			if fragment == "" {
+				continue
+			}
+			if err := sw.writeToolCallDeltaLocked(converter.OpenAIToolCall{
+				Index:    &index,
+				Function: converter.OpenAIFunctionCall{Arguments: fragment},
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (sw *StreamWriter) writeToolCallDeltaLocked(tc converter.OpenAIToolCall) error {
 	chunk := converter.CreateStreamChunk(
 		sw.id, sw.created, sw.model,
-		&converter.Delta{ToolCalls: toolCalls},
+		&converter.Delta{ToolCalls: []converter.OpenAIToolCall{tc}},
 		nil, nil,
 	)
-	return WriteStreamData(sw.w, chunk)
+	return sw.writeDataLocked(chunk)
 }
 
 // flushLocked 刷新缓冲区中剩余的内容（内部使用，调用者必须持有锁）
 func (sw *StreamWriter) flushLocked() error {
-	// 刷新内容缓冲区
+	// 先输出合并缓冲中的完整内容
+	if err := sw.flushPendingLocked(); err != nil {
+		return err
+	}
+
+	// 刷新内容缓冲区（不完整的字节按 JSON 编码的方式替换为 U+FFFD，摘要与客户端收到的一致）
 	if len(sw.contentBuffer) > 0 {
-		content := string(sw.contentBuffer)
+		content := string([]rune(string(sw.contentBuffer)))
 		sw.contentBuffer = nil
 		if content != "" {
+			sw.recordEmittedLocked(deltaContent, content)
 			chunk := converter.CreateStreamChunk(
 				sw.id, sw.created, sw.model,
 				&converter.Delta{Content: content},
 				nil, nil,
 			)
-			if err := WriteStreamData(sw.w, chunk); err != nil {
+			if err := sw.writeDataLocked(chunk); err != nil {
 				return err
 			}
 		}
@@ -390,15 +726,16 @@ func (sw *StreamWriter) flushLocked() error {
 
 	// 刷新思考缓冲区
 	if len(sw.reasoningBuffer) > 0 {
-		reasoning := string(sw.reasoningBuffer)
+		reasoning := string([]rune(string(sw.reasoningBuffer)))
 		sw.reasoningBuffer = nil
 		if reasoning != "" {
+			sw.recordEmittedLocked(deltaReasoning, reasoning)
 			chunk := converter.CreateStreamChunk(
 				sw.id, sw.created, sw.model,
 				&converter.Delta{Reasoning: reasoning},
 				nil, nil,
 			)
-			if err := WriteStreamData(sw.w, chunk); err != nil {
+			if err := sw.writeDataLocked(chunk); err != nil {
 				return err
 			}
 		}
@@ -414,6 +751,72 @@ func (sw *StreamWriter) Flush() error {
 	return sw.flushLocked()
 }
 
+// SetValidationFailed 设置结束 chunk 中标记的未通过校验器（流式只能事后校验）
+func (sw *StreamWriter) SetValidationFailed(failed []string) {
+	sw.mu.Lock()
+	sw.validationFailed = failed
+	sw.mu.Unlock()
+}
+
+// SetTruncated 在结束 chunk 中标记上游流在结束前中断，toolCallsPartial 表示中断前已输出的工具调用可能不完整
+func (sw *StreamWriter) SetTruncated(toolCallsPartial bool) {
+	sw.mu.Lock()
+	sw.truncated = true
+	sw.toolCallsPartial = toolCallsPartial
+	sw.mu.Unlock()
+}
+
+// SetWarnings 设置结束 chunk 中返回的警告
+func (sw *StreamWriter) SetWarnings(warnings []string) {
+	sw.mu.Lock()
+	sw.warnings = warnings
+	sw.mu.Unlock()
+}
+
+// SetRouteTrace 在结束 chunk 中返回请求的路由说明（结束时生成，包含流式切换账号的过程）
+func (sw *StreamWriter) SetRouteTrace(trace *store.RouteTrace) {
+	sw.mu.Lock()
+	sw.route = trace
+	sw.mu.Unlock()
+}
+
+// SetQuarantine 设置结束 chunk 中标记的隔离规则
+func (sw *StreamWriter) SetQuarantine(labels []string) {
+	sw.mu.Lock()
+	sw.quarantine = labels
+	sw.mu.Unlock()
+}
+
+// 流式引用输出方式
+const (
+	AnnotationsDelta = "delta" // 正文结束后单独发送带 annotations 的 delta
+	AnnotationsFinal = "final" // 放在结束 chunk 的扩展字段中（delta 只含标准字段）
+)
+
+// WriteAnnotations 输出引用：delta 方式先刷新缓冲的正文再单独发送，final 方式暂存到结束 chunk（线程安全）
+func (sw *StreamWriter) WriteAnnotations(annotations []converter.Annotation, mode string) error {
+	if len(annotations) == 0 {
+		return nil
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if mode == AnnotationsFinal {
+		sw.annotations = annotations
+		return nil
+	}
+	if err := sw.flushLocked(); err != nil {
+		return err
+	}
+	sw.writeRoleLocked()
+	chunk := converter.CreateStreamChunk(
+		sw.id, sw.created, sw.model,
+		&converter.Delta{Annotations: annotations},
+		nil, nil,
+	)
+	return sw.writeDataLocked(chunk)
+}
+
 // WriteFinish 写入结束（线程安全）
 func (sw *StreamWriter) WriteFinish(reason string, usage *converter.Usage) error {
 	sw.mu.Lock()
@@ -421,24 +824,76 @@ func (sw *StreamWriter) WriteFinish(reason string, usage *converter.Usage) error
 
 	// 先刷新缓冲区
 	sw.flushLocked()
+	sw.finished = true
+	sw.contentStarted.Store(true)
 
 	chunk := converter.CreateStreamChunk(
 		sw.id, sw.created, sw.model,
 		&converter.Delta{},
 		&reason, usage,
 	)
-	if err := WriteStreamData(sw.w, chunk); err != nil {
+	chunk.ValidationFailed = sw.validationFailed
+	chunk.Truncated = sw.truncated
+	chunk.ToolCallsIncomplete = sw.toolCallsPartial
+	chunk.Warnings = sw.warnings
+	chunk.Annotations = sw.annotations
+	chunk.Quarantine = sw.quarantine
+	chunk.Route = sw.route.Explain()
+	digest := &converter.ContentDigest{Content: formatDigest(sw.contentHash)}
+	if sw.hasReasoning {
+		digest.Reasoning = formatDigest(sw.reasoningHash)
+	}
+	chunk.ContentDigest = digest
+	if err := sw.writeDataLocked(chunk); err != nil {
+		return err
+	}
+	if err := sw.writeLocked(WriteStreamDone); err != nil {
 		return err
 	}
-	WriteStreamDone(sw.w)
+
+	// 响应体写完后设置的 TrailerPrefix 头作为 HTTP trailer 发送（HTTP/1.0 等不支持时忽略）
+	header := sw.w.Header()
+	header.Set(http.TrailerPrefix+ContentDigestHeader, digest.Content)
+	if digest.Reasoning != "" {
+		header.Set(http.TrailerPrefix+ReasoningDigestHeader, digest.Reasoning)
+	}
 	return nil
 }
 
-// WriteHeartbeat 写入心跳（发送空 delta 的有效数据包，线程安全）
+// SetHeartbeatStyle 设置心跳格式（HeartbeatStyleChunk 或 HeartbeatStyleComment）
+func (sw *StreamWriter) SetHeartbeatStyle(style string) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.heartbeatComment = style == HeartbeatStyleComment
+}
+
+// ContentStarted 是否已输出真实内容
+func (sw *StreamWriter) ContentStarted() bool {
+	return sw.contentStarted.Load()
+}
+
+// WriteHeartbeat 写入心跳（线程安全）。只在真实内容输出前发送，
+// 与首个内容写入竞争时由锁内的 contentStarted 标记保证心跳不会出现在内容之后
 func (sw *StreamWriter) WriteHeartbeat() error {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
 
+	if sw.contentStarted.Load() {
+		return nil
+	}
+
+	if sw.heartbeatComment {
+		return sw.writeLocked(func(w http.ResponseWriter) error {
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return err
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			return nil
+		})
+	}
+
 	// 先确保 role 已发送
 	sw.writeRoleLocked()
 
@@ -449,5 +904,5 @@ func (sw *StreamWriter) WriteHeartbeat() error {
 		&converter.Delta{}, // 空 delta
 		nil, nil,
 	)
-	return WriteStreamData(sw.w, chunk)
+	return sw.writeDataLocked(chunk)
 }
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// finishChunk 解析 SSE 输出中最后一个数据 chunk
+func finishChunk(t *testing.T, body string) converter.OpenAIStreamChunk {
+	t.Helper()
+	var last string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "data: {") {
+			last = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	var chunk converter.OpenAIStreamChunk
+	if err := json.Unmarshal([]byte(last), &chunk); err != nil {
+		t.Fatalf("decode finish chunk %q: %v", last, err)
+	}
+	return chunk
+}
+
+func TestWriteFinishMarksIncompleteToolCalls(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		rec := httptest.NewRecorder()
+		sw := NewStreamWriter(rec, "chatcmpl-1", 1, "m")
+		sw.SetTruncated(partial)
+		if err := sw.WriteFinish("error", nil); err != nil {
+			t.Fatal(err)
+		}
+		chunk := finishChunk(t, rec.Body.String())
+		if !chunk.Truncated {
+			t.Error("finish chunk should be marked truncated")
+		}
+		if chunk.ToolCallsIncomplete != partial {
+			t.Errorf("tool_calls_incomplete = %v, want %v", chunk.ToolCallsIncomplete, partial)
+		}
+	}
+}
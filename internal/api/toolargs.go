@@ -0,0 +1,103 @@
+package api
+
+// SplitToolArguments 将工具参数 JSON 按约 size 字节切分为片段，用于流式增量输出 function.arguments。
+// 切分点不会落在多字节 UTF-8 字符、字符串转义序列（\n、\uXXXX）或 UTF-16 代理对中间，
+// 因此任意前缀拼接后都是合法 JSON 的前缀；所有片段拼接后与原字符串完全一致。
+// size <= 0 或参数不超过 size 时返回单个片段；单个不可分割单元超过 size 时该片段会超出 size
+func SplitToolArguments(args string, size int) []string {
+	if size <= 0 || len(args) <= size {
+		return []string{args}
+	}
+
+	unsafe := jsonUnsafeCuts(args)
+	fragments := make([]string, 0, len(args)/size+1)
+	for start := 0; start < len(args); {
+		cut := start + size
+		if cut >= len(args) {
+			fragments = append(fragments, args[start:])
+			break
+		}
+		// 不完整的 UTF-8 字符留给下一个片段
+		_, remaining := extractValidUTF8([]byte(args[start:cut]))
+		cut -= len(remaining)
+		for cut > start && unsafe[cut] {
+			cut--
+		}
+		if cut == start {
+			// 不可分割单元比 size 大，向后找到第一个安全切分点
+			cut = start + size
+			for cut < len(args) && unsafe[cut] {
+				cut++
+			}
+		}
+		fragments = append(fragments, args[start:cut])
+		start = cut
+	}
+	return fragments
+}
+
+// jsonUnsafeCuts 标记 JSON 文本中不能作为切分点的位置（unsafe[i] 为 true 表示不能在 s[i] 之前切分）
+func jsonUnsafeCuts(s string) []bool {
+	unsafe := make([]bool, len(s)+1)
+	for i := 1; i < len(s); i++ {
+		// UTF-8 后续字节
+		if s[i]&0xC0 == 0x80 {
+			unsafe[i] = true
+		}
+	}
+
+	inString := false
+	highSurrogateEnd := -1 // 上一个 \uD800-\uDBFF 转义结束的位置
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !inString {
+			if c == '"' {
+				inString = true
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = false
+		case '\\':
+			end := i + 2
+			if i+1 < len(s) && s[i+1] == 'u' {
+				end = i + 6
+			}
+			if end > len(s) {
+				end = len(s)
+			}
+			for j := i + 1; j < end; j++ {
+				unsafe[j] = true
+			}
+			if end == i+6 {
+				// 代理对的两个转义之间不切分，避免客户端解析出孤立的高位代理
+				if i == highSurrogateEnd && isLowSurrogateEscape(s[i+2:end]) {
+					unsafe[i] = true
+				}
+				highSurrogateEnd = -1
+				if isHighSurrogateEscape(s[i+2 : end]) {
+					highSurrogateEnd = end
+				}
+			}
+			i = end - 1
+		}
+	}
+	return unsafe
+}
+
+func isHighSurrogateEscape(hex string) bool {
+	return len(hex) == 4 && (hex[0] == 'd' || hex[0] == 'D') && hexIn(hex[1], '8', 'b')
+}
+
+func isLowSurrogateEscape(hex string) bool {
+	return len(hex) == 4 && (hex[0] == 'd' || hex[0] == 'D') && hexIn(hex[1], 'c', 'f')
+}
+
+// hexIn 十六进制字符是否在 [lo, hi] 范围内（lo、hi 为小写）
+func hexIn(c, lo, hi byte) bool {
+	if c >= 'A' && c <= 'F' {
+		c += 'a' - 'A'
+	}
+	return c >= lo && c <= hi
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"anti2api-golang/internal/converter"
+)
+
+// stringPieces 随机 JSON 字符串内容：普通文本、各种转义、多字节字符、代理对转义
+var stringPieces = []string{
+	"a", "hello world", " ", "0", `\n`, `\t`, `\"`, `\\`, `\/`, `\u00e9`, `\u4e2d`, `\ud83d\ude00`, `\uD83D\uDE80`,
+	"é", "中文", "😀", "🚀", "\u2028", "ß",
+}
+
+// randomJSONString 随机生成的 JSON 字符串字面量（已转义）
+func randomJSONString(r *rand.Rand) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for n := r.Intn(12); n > 0; n-- {
+		b.WriteString(stringPieces[r.Intn(len(stringPieces))])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// randomJSONValue 随机生成的 JSON 值，depth 限制嵌套层数
+func randomJSONValue(r *rand.Rand, depth int) string {
+	kind := r.Intn(6)
+	if depth <= 0 && kind >= 4 {
+		kind = r.Intn(4)
+	}
+	switch kind {
+	case 0:
+		return randomJSONString(r)
+	case 1:
+		return fmt.Sprint(r.Intn(100000) - 50000)
+	case 2:
+		return fmt.Sprintf("%g", r.Float64()*1000)
+	case 3:
+		return []string{"true", "false", "null"}[r.Intn(3)]
+	case 4:
+		items := make([]string, r.Intn(5))
+		for i := range items {
+			items[i] = randomJSONValue(r, depth-1)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	default:
+		return randomJSONObject(r, depth-1)
+	}
+}
+
+func randomJSONObject(r *rand.Rand, depth int) string {
+	fields := make([]string, r.Intn(6))
+	for i := range fields {
+		fields[i] = randomJSONString(r) + ":" + randomJSONValue(r, depth)
+	}
+	return "{" + strings.Join(fields, ",") + "}"
+}
+
+// unsafePrefixEnd 前缀结尾是否会让客户端解析出错：位于转义序列中间、
+// 代理对的两个转义之间或 UTF-8 字符中间，返回原因（安全时为空）
+func unsafePrefixEnd(prefix string) string {
+	if !utf8.ValidString(prefix) {
+		return "splits a UTF-8 character"
+	}
+	inString := false
+	pendingHigh := false // 字符串以高位代理转义结尾
+	for i := 0; i < len(prefix); i++ {
+		c := prefix[i]
+		if !inString {
+			inString = c == '"'
+			continue
+		}
+		switch c {
+		case '"':
+			inString, pendingHigh = false, false
+		case '\\':
+			if i+1 >= len(prefix) {
+				return "ends after a backslash"
+			}
+			if prefix[i+1] != 'u' {
+				pendingHigh = false
+				i++
+				continue
+			}
+			if i+6 > len(prefix) {
+				return "ends inside a \\u escape"
+			}
+			hex := strings.ToLower(prefix[i+2 : i+6])
+			pendingHigh = hex >= "d800" && hex <= "dbff"
+			i += 5
+		default:
+			pendingHigh = false
+		}
+	}
+	if pendingHigh {
+		return "ends between the escapes of a surrogate pair"
+	}
+	return ""
+}
+
+// checkFragments 片段拼接等于原文，每个前缀都在安全位置结束，片段不超过 size（不可分割单元最长 12 字节）
+func checkFragments(t *testing.T, args string, size int, fragments []string) {
+	t.Helper()
+	if joined := strings.Join(fragments, ""); joined != args {
+		t.Fatalf("size %d: fragments join to %q, want %q", size, joined, args)
+	}
+	var prefix strings.Builder
+	for i, fragment := range fragments {
+		if fragment == "" {
+			t.Fatalf("size %d: empty fragment %d in %q", size, i, fragments)
+		}
+		if len(fragment) > size+11 {
+			t.Fatalf("size %d: fragment %q is %d bytes", size, fragment, len(fragment))
+		}
+		prefix.WriteString(fragment)
+		if reason := unsafePrefixEnd(prefix.String()); reason != "" {
+			t.Fatalf("size %d: prefix %q %s", size, prefix.String(), reason)
+		}
+	}
+}
+
+func TestSplitToolArgumentsProperties(t *testing.T) {
+	r := rand.New(rand.NewSource(716))
+	for i := 0; i < 2000; i++ {
+		args := randomJSONObject(r, 3)
+		if !json.Valid([]byte(args)) {
+			t.Fatalf("generated invalid JSON: %s", args)
+		}
+		size := 1 + r.Intn(40)
+		checkFragments(t, args, size, SplitToolArguments(args, size))
+	}
+}
+
+func TestSplitToolArgumentsMarshaledArgs(t *testing.T) {
+	// 上游返回的参数经 json.Marshal 输出：HTML 字符和 U+2028 被转义，其他字符保持 UTF-8
+	args, err := json.Marshal(map[string]interface{}{
+		"query": "<b>café</b> & 中文 😀\u2028",
+		"path":  `C:\temp\"quoted"`,
+		"n":     []int{1, 2, 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for size := 1; size <= len(args); size++ {
+		checkFragments(t, string(args), size, SplitToolArguments(string(args), size))
+	}
+}
+
+func TestSplitToolArgumentsEdgeCases(t *testing.T) {
+	for _, tc := range []struct {
+		args string
+		size int
+		want []string
+	}{
+		{`{"a":1}`, 0, []string{`{"a":1}`}},
+		{`{"a":1}`, -1, []string{`{"a":1}`}},
+		{`{"a":1}`, 7, []string{`{"a":1}`}},
+		{``, 4, []string{``}},
+		{`{"a":"\n"}`, 6, []string{`{"a":"`, `\n"}`}},
+		{`{"a":"é"}`, 7, []string{`{"a":"`, `é"}`}},
+		{`{"a":"\u00e9"}`, 8, []string{`{"a":"`, `\u00e9"}`}},
+		{`{"a":"\ud83d\ude00"}`, 12, []string{`{"a":"`, `\ud83d\ude00`, `"}`}},
+		// 字符串外的反斜杠和引号不影响切分
+		{`["\\",1]`, 4, []string{`["\\`, `",1]`}},
+	} {
+		if got := SplitToolArguments(tc.args, tc.size); strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("SplitToolArguments(%q, %d) = %q, want %q", tc.args, tc.size, got, tc.want)
+		}
+	}
+}
+
+func TestWriteToolCallFragments(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sw := NewStreamWriter(rec, "chatcmpl-1", 1, "m")
+	sw.SetToolArgsFragment(8)
+	calls := []converter.OpenAIToolCall{
+		{ID: "call-1", Type: "function", Function: converter.OpenAIFunctionCall{Name: "search", Arguments: `{"query":"café 😀","limit":10}`}},
+		{ID: "call-2", Type: "function", Function: converter.OpenAIFunctionCall{Name: "noop", Arguments: `{}`}},
+	}
+	if err := sw.WriteToolCalls(calls); err != nil {
+		t.Fatal(err)
+	}
+
+	// 按 index 累积增量，首个增量携带 id 和函数名
+	args := map[int]string{}
+	heads := map[int]converter.OpenAIToolCall{}
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if !strings.HasPrefix(line, "data: {") {
+			continue
+		}
+		var chunk converter.OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range chunk.Choices[0].Delta.ToolCalls {
+			if tc.Index == nil {
+				t.Fatalf("tool call delta without index: %s", line)
+			}
+			if _, seen := heads[*tc.Index]; !seen {
+				heads[*tc.Index] = tc
+			} else if tc.ID != "" || tc.Function.Name != "" {
+				t.Errorf("later delta repeats id or name: %s", line)
+			}
+			args[*tc.Index] += tc.Function.Arguments
+		}
+	}
+	for i, call := range calls {
+		if heads[i].ID != call.ID || heads[i].Function.Name != call.Function.Name {
+			t.Errorf("call %d head = %+v", i, heads[i])
+		}
+		if args[i] != call.Function.Arguments {
+			t.Errorf("call %d arguments = %q, want %q", i, args[i], call.Function.Arguments)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+
+	"anti2api-golang/internal/testutil"
+)
+
+// cutReader 返回 data 后以 err 结束的响应体（模拟连接中断）
+type cutReader struct {
+	data io.Reader
+	err  error
+}
+
+func (c *cutReader) Read(p []byte) (int, error) {
+	n, err := c.data.Read(p)
+	if err == io.EOF {
+		return n, c.err
+	}
+	return n, err
+}
+
+func (c *cutReader) Close() error { return nil }
+
+// sseBody 按上游流式格式拼接 chunks
+func sseBody(chunks ...string) string {
+	var b strings.Builder
+	for _, c := range chunks {
+		b.WriteString("data: " + c + "\n\n")
+	}
+	return b.String()
+}
+
+// streamTypes 处理上游流，返回收到的数据块类型
+func streamTypes(t *testing.T, body string, cut error) ([]string, error) {
+	t.Helper()
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: &cutReader{strings.NewReader(body), cut}}
+	chunks, err := collectStream(t, resp)
+	var types []string
+	for _, c := range chunks {
+		types = append(types, c.Type)
+	}
+	return types, err
+}
+
+func TestProcessStreamResponseTruncated(t *testing.T) {
+	text := testutil.Chunk("", testutil.Text("checking"))
+	call := testutil.Chunk("", testutil.FunctionCall("call-1", "delete_files", map[string]interface{}{"path": "/tmp"}))
+
+	for _, tc := range []struct {
+		name string
+		body string
+		cut  error
+		want []string
+	}{
+		{"before any data", "", io.EOF, nil},
+		{"after text", sseBody(text), io.EOF, []string{"text"}},
+		{"after a tool call", sseBody(text, call), io.EOF, []string{"text", "tool_calls"}},
+		{"inside a line", sseBody(text) + "data: " + call[:len(call)/2], io.EOF, []string{"text"}},
+		{"unexpected EOF", sseBody(text, call), io.ErrUnexpectedEOF, []string{"text", "tool_calls"}},
+		{"connection reset", sseBody(text), syscall.ECONNRESET, []string{"text"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			types, err := streamTypes(t, tc.body, tc.cut)
+			if !errors.Is(err, ErrStreamTruncated) {
+				t.Fatalf("err = %v, want ErrStreamTruncated", err)
+			}
+			if tc.cut != io.EOF && !strings.Contains(err.Error(), tc.cut.Error()) {
+				t.Errorf("err = %v, want the cause %v", err, tc.cut)
+			}
+			if strings.Join(types, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("chunks = %v, want %v", types, tc.want)
+			}
+		})
+	}
+}
+
+func TestProcessStreamResponseFinished(t *testing.T) {
+	call := testutil.Chunk("", testutil.FunctionCall("call-1", "read_file", map[string]interface{}{"path": "a"}))
+	for _, tc := range []struct {
+		name string
+		body string
+		cut  error
+		want []string
+	}{
+		{"finish reason", sseBody(call, testutil.Chunk("STOP")), io.EOF, []string{"tool_calls", "finish"}},
+		{"done marker", sseBody(call, "[DONE]"), io.EOF, []string{"tool_calls", "done"}},
+		// 结束之后的连接错误不影响结果
+		{"reset after finish", sseBody(call, testutil.Chunk("STOP")), syscall.ECONNRESET, []string{"tool_calls", "finish"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			types, err := streamTypes(t, tc.body, tc.cut)
+			if err != nil {
+				t.Fatalf("err = %v, want a complete stream", err)
+			}
+			if strings.Join(types, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("chunks = %v, want %v", types, tc.want)
+			}
+		})
+	}
+}
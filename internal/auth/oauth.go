@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -11,6 +12,7 @@ import (
 
 	"anti2api-golang/internal/config"
 	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/notify"
 	"anti2api-golang/internal/store"
 )
 
@@ -39,8 +41,13 @@ type UserInfo struct {
 }
 
 func init() {
-	// 注册刷新函数到 store
-	store.SetRefreshFunc(RefreshToken)
+	// 注册凭证实现到 store
+	store.RegisterCredentialProvider(store.CredentialOAuth, func(a *store.Account) store.CredentialProvider {
+		return refreshTokenCredential{account: a}
+	})
+	store.RegisterCredentialProvider(store.CredentialServiceAccount, func(a *store.Account) store.CredentialProvider {
+		return serviceAccountCredential{account: a}
+	})
 }
 
 // BuildAuthURL 构建授权 URL
@@ -90,10 +97,16 @@ func ExchangeCodeForToken(code, redirectURI string) (*TokenResponse, error) {
 	return &tokenResp, nil
 }
 
-// RefreshToken 刷新 Token
-func RefreshToken(account *store.Account) error {
+// refreshTokenCredential OAuth refresh_token 凭证
+type refreshTokenCredential struct {
+	account *store.Account
+}
+
+// Token 用 refresh_token 换取新的 access_token（返回新的 refresh_token 时同时更新）
+func (c refreshTokenCredential) Token(ctx context.Context) (string, time.Time, error) {
+	account := c.account
 	if account.RefreshToken == "" {
-		return errors.New("no refresh token")
+		return "", time.Time{}, errors.New("no refresh token")
 	}
 
 	data := url.Values{
@@ -103,39 +116,57 @@ func RefreshToken(account *store.Account) error {
 		"refresh_token": {account.RefreshToken},
 	}
 
-	resp, err := http.PostForm("https://oauth2.googleapis.com/token", data)
+	tokenResp, err := postTokenRequest(ctx, "https://oauth2.googleapis.com/token", data, account)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// 如果返回了新的 refresh_token，也更新
+	if tokenResp.RefreshToken != "" {
+		account.RefreshToken = tokenResp.RefreshToken
+	}
+
+	logger.Info("Token refreshed for %s", account.Email)
+	return tokenResp.AccessToken, time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second), nil
+}
+
+// postTokenRequest 请求 Token 端点，invalid_grant 视为凭证已撤销
+func postTokenRequest(ctx context.Context, tokenURL string, data url.Values, account *store.Account) (*TokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if resp.StatusCode != 200 {
 		logger.Warn("Token refresh failed: %s", string(body))
-		return errors.New("token refresh failed")
+		// invalid_grant 表示 refresh_token 已被撤销或失效（服务账号为密钥被删除或禁用）
+		if strings.Contains(string(body), "invalid_grant") {
+			notify.Fire(notify.EventAccountRevoked, "Refresh token revoked", map[string]interface{}{
+				"email":     account.Email,
+				"projectId": account.ProjectID,
+			})
+			return nil, store.ErrTokenRevoked
+		}
+		return nil, &store.OAuthStatusError{Status: resp.StatusCode, Body: string(body)}
 	}
 
 	var tokenResp TokenResponse
 	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return err
-	}
-
-	// 更新账号信息
-	account.AccessToken = tokenResp.AccessToken
-	account.ExpiresIn = tokenResp.ExpiresIn
-	account.Timestamp = time.Now().UnixMilli()
-
-	// 如果返回了新的 refresh_token，也更新
-	if tokenResp.RefreshToken != "" {
-		account.RefreshToken = tokenResp.RefreshToken
+		return nil, err
 	}
-
-	logger.Info("Token refreshed for %s", account.Email)
-	return nil
+	return &tokenResp, nil
 }
 
 // GetUserInfo 获取用户信息
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/store"
+)
+
+// defaultTokenURI 服务账号密钥未指定 token_uri 时使用的端点
+const defaultTokenURI = "https://oauth2.googleapis.com/token"
+
+// serviceAccountCredential 服务账号凭证：用私钥签名 JWT 换取 access_token
+type serviceAccountCredential struct {
+	account *store.Account
+}
+
+// Token 签名 JWT 断言并换取 access_token
+func (c serviceAccountCredential) Token(ctx context.Context) (string, time.Time, error) {
+	key := c.account.ServiceAccount
+	if key == nil {
+		return "", time.Time{}, errors.New("no service account key")
+	}
+	rsaKey, err := key.RSAKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	tokenURI := key.TokenURI
+	if tokenURI == "" {
+		tokenURI = defaultTokenURI
+	}
+	assertion, err := signJWT(rsaKey, key.PrivateKeyID, map[string]interface{}{
+		"iss":   key.ClientEmail,
+		"scope": strings.Join(OAuthScopes, " "),
+		"aud":   tokenURI,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	data := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	tokenResp, err := postTokenRequest(ctx, tokenURI, data, c.account)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	logger.Info("Service account token issued for %s", key.ClientEmail)
+	return tokenResp.AccessToken, time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second), nil
+}
+
+// signJWT 生成 RS256 签名的 JWT
+func signJWT(key *rsa.PrivateKey, keyID string, claims map[string]interface{}) (string, error) {
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(headerJSON) + "." + enc.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
@@ -4,38 +4,62 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
 
 // 会话管理
 var (
-	panelSessions = sync.Map{} // token -> expiresAt
+	panelSessions = sync.Map{} // token -> panelSession
 	sessionTTL    = 2 * time.Hour
 )
 
-// CreateSession 创建会话
-func CreateSession() string {
+// panelSession 面板会话
+type panelSession struct {
+	expiresAt time.Time
+	tenant    string // 租户管理员所属租户，为空表示超级管理员
+	user      string
+	role      string // 管理接口角色（viewer、operator、admin）
+}
+
+// CreateSession 创建会话（tenant 为空表示超级管理员），会话携带登录用户和角色
+func CreateSession(tenant, user, role string) string {
 	token := generateSecureToken(24)
-	expiresAt := time.Now().Add(sessionTTL)
-	panelSessions.Store(token, expiresAt)
+	panelSessions.Store(token, panelSession{
+		expiresAt: time.Now().Add(sessionTTL),
+		tenant:    tenant,
+		user:      user,
+		role:      role,
+	})
 	return token
 }
 
 // ValidateSession 验证会话
 func ValidateSession(token string) bool {
+	_, ok := lookupSession(token)
+	return ok
+}
+
+// SessionIdentity 获取会话所属租户、登录用户和角色
+func SessionIdentity(token string) (tenant, user, role string, ok bool) {
+	session, ok := lookupSession(token)
+	return session.tenant, session.user, session.role, ok
+}
+
+func lookupSession(token string) (panelSession, bool) {
 	value, ok := panelSessions.Load(token)
 	if !ok {
-		return false
+		return panelSession{}, false
 	}
 
-	expiresAt := value.(time.Time)
-	if time.Now().After(expiresAt) {
+	session := value.(panelSession)
+	if time.Now().After(session.expiresAt) {
 		panelSessions.Delete(token)
-		return false
+		return panelSession{}, false
 	}
 
-	return true
+	return session, true
 }
 
 // DeleteSession 删除会话
@@ -43,8 +67,9 @@ func DeleteSession(token string) {
 	panelSessions.Delete(token)
 }
 
-// SetSessionCookie 设置会话 Cookie
-func SetSessionCookie(w http.ResponseWriter, token string) {
+// SetSessionCookie 设置会话 Cookie。角色同时写入面板脚本可读的 panel_role Cookie（只用于界面显示，
+// 权限以服务端会话中的角色为准）
+func SetSessionCookie(w http.ResponseWriter, token, role string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "panel_session",
 		Value:    token,
@@ -53,20 +78,29 @@ func SetSessionCookie(w http.ResponseWriter, token string) {
 		SameSite: http.SameSiteLaxMode,
 		MaxAge:   int(sessionTTL.Seconds()),
 	})
-}
-
-// ClearSessionCookie 清除会话 Cookie
-func ClearSessionCookie(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     "panel_session",
-		Value:    "",
+		Name:     "panel_role",
+		Value:    role,
 		Path:     "/",
-		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
-		MaxAge:   -1,
+		MaxAge:   int(sessionTTL.Seconds()),
 	})
 }
 
+// ClearSessionCookie 清除会话 Cookie
+func ClearSessionCookie(w http.ResponseWriter) {
+	for _, name := range []string{"panel_session", "panel_role"} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			HttpOnly: name == "panel_session",
+			SameSite: http.SameSiteLaxMode,
+			MaxAge:   -1,
+		})
+	}
+}
+
 // GetSessionToken 从请求中获取会话 Token
 func GetSessionToken(r *http.Request) string {
 	// 从 cookie 获取
@@ -76,7 +110,12 @@ func GetSessionToken(r *http.Request) string {
 	}
 
 	// 从 header 获取
-	return r.Header.Get("X-Session-Token")
+	if token := r.Header.Get("X-Session-Token"); token != "" {
+		return token
+	}
+
+	// 管理 API 令牌也可以通过 Authorization: Bearer 传入
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
 }
 
 func generateSecureToken(length int) string {
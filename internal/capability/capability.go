@@ -0,0 +1,440 @@
+// Package capability 模型能力探测：通过 CAPABILITY_PROBE_ACCOUNT 指定的账号向每个模型发送小请求，
+// 验证工具、图片输入和输出上限是否与声明一致，结果记入模型注册表（converter.RecordCapabilityProbe）。
+// 探测直接调用上游，不经过 API 处理器，因此不计入请求日志和用量统计
+package capability
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/store"
+)
+
+// 单个探测的结果状态
+const (
+	StatusSupported   = "supported"
+	StatusUnsupported = "unsupported"
+	StatusError       = "error"   // 无法得出结论（限流、网络错误等），不记录
+	StatusSkipped     = "skipped" // 当日额度已用完
+)
+
+// 触发方式
+const (
+	TriggerManual     = "manual"
+	TriggerSchedule   = "schedule"
+	TriggerRevalidate = "revalidate" // 模型列表读取到过期结果
+)
+
+// probeTimeout 单个探测请求的时间上限
+const probeTimeout = 60 * time.Second
+
+// revalidateGap 同一模型两次后台重新探测的最小间隔
+const revalidateGap = time.Hour
+
+var (
+	ErrDisabled = errors.New("CAPABILITY_PROBE_ACCOUNT is not set")
+	ErrRunning  = errors.New("a capability probe is already running")
+)
+
+// Result 单个探测的结果
+type Result struct {
+	Model      string `json:"model"`
+	Capability string `json:"capability"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Report 一次探测的报告
+type Report struct {
+	Trigger    string                `json:"trigger"`
+	Account    string                `json:"account"`
+	StartedAt  time.Time             `json:"startedAt"`
+	FinishedAt time.Time             `json:"finishedAt"`
+	Results    []Result              `json:"results"`
+	Budget     converter.ProbeBudget `json:"budget"`
+}
+
+// prober 探测状态（同一时间只进行一次探测）
+type prober struct {
+	mu          sync.Mutex
+	running     bool
+	last        *Report
+	revalidated map[string]time.Time
+	cancel      context.CancelFunc // 停止定期探测并中止进行中的探测
+	done        chan struct{}
+}
+
+var p = &prober{revalidated: make(map[string]time.Time)}
+
+// Enabled 是否配置了探测账号
+func Enabled() bool {
+	return config.Get().CapProbeAccount != ""
+}
+
+// LastReport 最近一次探测的报告（没有时为 nil）
+func LastReport() *Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last
+}
+
+// DefaultModels 默认探测的模型（真实模型名，别名共用结果）
+func DefaultModels() []string {
+	seen := make(map[string]bool)
+	var models []string
+	for _, m := range converter.SupportedModels {
+		actual := converter.ResolveModelName(m.ID)
+		if !seen[actual] {
+			seen[actual] = true
+			models = append(models, actual)
+		}
+	}
+	return models
+}
+
+// Running 是否有探测正在进行
+func Running() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running
+}
+
+// begin 标记探测开始（未配置探测账号或已有探测在进行时返回错误）
+func begin() error {
+	if !Enabled() {
+		return ErrDisabled
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running {
+		return ErrRunning
+	}
+	p.running = true
+	return nil
+}
+
+func end() {
+	p.mu.Lock()
+	p.running = false
+	p.mu.Unlock()
+}
+
+// Run 依次探测模型的各项声明能力（models 为空时探测 DefaultModels），每个请求占用一次当日额度
+func Run(ctx context.Context, models []string, trigger string) (*Report, error) {
+	if err := begin(); err != nil {
+		return nil, err
+	}
+	defer end()
+	return run(ctx, models, trigger)
+}
+
+// Trigger 在后台开始探测，立即返回（结果通过 LastReport 获取）
+func Trigger(models []string) error {
+	if err := begin(); err != nil {
+		return err
+	}
+	monitor.Go("capability-probe", func() {
+		defer end()
+		if _, err := run(context.Background(), models, TriggerManual); err != nil {
+			logger.Warn("Capability probe failed: %v", err)
+		}
+	})
+	return nil
+}
+
+func run(ctx context.Context, models []string, trigger string) (*Report, error) {
+	cfg := config.Get()
+	// 探测账号由全局配置指定，不受请求租户的可见范围限制
+	account, err := store.GetAccountStore().GetTokenByEmail(context.Background(), cfg.CapProbeAccount)
+	if err != nil {
+		return nil, fmt.Errorf("probe account %s: %w", cfg.CapProbeAccount, err)
+	}
+	if len(models) == 0 {
+		models = DefaultModels()
+	}
+
+	report := &Report{Trigger: trigger, Account: cfg.CapProbeAccount, StartedAt: time.Now()}
+	for _, model := range models {
+		model = converter.ResolveModelName(model)
+		declared := converter.DeclaredCapabilities(model)
+		for _, capability := range []string{converter.CapabilityTools, converter.CapabilityVision, converter.CapabilityOutputLimit} {
+			if _, ok := declared[capability]; !ok {
+				continue
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			report.Results = append(report.Results, probe(ctx, account, model, capability))
+		}
+	}
+	report.FinishedAt = time.Now()
+	report.Budget = converter.ProbeBudgetUsage()
+
+	p.mu.Lock()
+	p.last = report
+	p.mu.Unlock()
+	logSummary(report)
+	return report, ctx.Err()
+}
+
+// probe 执行一项探测并记录结论
+func probe(ctx context.Context, account *store.Account, model, capability string) Result {
+	result := Result{Model: model, Capability: capability}
+	if !converter.ReserveProbe(config.Get().CapProbeDailyLimit) {
+		result.Status = StatusSkipped
+		result.Detail = "daily probe budget exhausted"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	start := time.Now()
+	var supported bool
+	var err error
+	switch capability {
+	case converter.CapabilityTools:
+		supported, result.Detail, err = probeTools(ctx, account, model)
+	case converter.CapabilityVision:
+		supported, result.Detail, err = probeVision(ctx, account, model)
+	case converter.CapabilityOutputLimit:
+		supported, result.Detail, err = probeOutputLimit(ctx, account, model)
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	if err != nil {
+		result.Status = StatusError
+		result.Detail = err.Error()
+		return result
+	}
+	result.Status = StatusUnsupported
+	if supported {
+		result.Status = StatusSupported
+	}
+	converter.RecordCapabilityProbe(model, capability, converter.CapabilityObservation{
+		Supported: supported,
+		ProbedAt:  time.Now(),
+		Detail:    result.Detail,
+	})
+	return result
+}
+
+// probeRequest 构建探测请求（不启用思考，max_tokens 为 CAPABILITY_PROBE_MAX_TOKENS）
+func probeRequest(account *store.Account, model string, content interface{}, tools []converter.OpenAITool) *converter.AntigravityRequest {
+	maxTokens := config.Get().CapProbeMaxTokens
+	req := converter.ConvertOpenAIToAntigravity(&converter.OpenAIChatRequest{
+		Model:     model,
+		MaxTokens: maxTokens,
+		Messages:  []converter.OpenAIMessage{{Role: "user", Content: content}},
+		Tools:     tools,
+	}, account)
+	if req.Request.GenerationConfig == nil {
+		req.Request.GenerationConfig = &converter.GenerationConfig{}
+	}
+	req.Request.GenerationConfig.ThinkingConfig = nil
+	req.Request.GenerationConfig.MaxOutputTokens = maxTokens
+	return req
+}
+
+// send 发送探测请求（不重试，每个请求只占用一次额度）。后端以 400 拒绝时通过 rejected 返回该错误，
+// 其他错误无法说明能力是否可用
+func send(ctx context.Context, account *store.Account, req *converter.AntigravityRequest) (reply *converter.Message, rejected error, err error) {
+	resp, err := api.GetClient().SendRequest(ctx, req, account)
+	if err != nil {
+		if api.ErrorStatus(err) == 400 {
+			return nil, err, nil
+		}
+		return nil, nil, err
+	}
+	if len(resp.Response.Candidates) == 0 {
+		return nil, nil, errors.New("upstream returned no candidates")
+	}
+	completion := converter.ConvertToOpenAIResponse(resp, req.Model, req.Request.Tools)
+	if len(completion.Choices) == 0 {
+		return nil, nil, errors.New("upstream returned no choices")
+	}
+	return &completion.Choices[0].Message, nil, nil
+}
+
+// probeTools 声明一个无参数的工具：后端接受请求即视为支持
+func probeTools(ctx context.Context, account *store.Account, model string) (bool, string, error) {
+	tools := []converter.OpenAITool{{
+		Type: "function",
+		Function: converter.OpenAIFunction{
+			Name:        "get_probe_value",
+			Description: "Returns a value. Call it when asked.",
+			Parameters:  converter.ToolParameters{"type": "object", "properties": map[string]interface{}{}},
+		},
+	}}
+	reply, rejected, err := send(ctx, account, probeRequest(account, model, "Call the get_probe_value tool.", tools))
+	if err != nil {
+		return false, "", err
+	}
+	if rejected != nil {
+		return false, "request with tools rejected: " + truncate(rejected.Error()), nil
+	}
+	if len(reply.ToolCalls) > 0 {
+		return true, "model called the tool", nil
+	}
+	return true, "tools accepted; the model replied without calling the tool", nil
+}
+
+// probeVision 发送 1 像素的红色图片：回答中没有提到颜色时视为图片被忽略
+func probeVision(ctx context.Context, account *store.Account, model string) (bool, string, error) {
+	content := []interface{}{
+		map[string]interface{}{"type": "text", "text": "What color is this image? Answer with one word."},
+		map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:image/png;base64," + probePixel}},
+	}
+	reply, rejected, err := send(ctx, account, probeRequest(account, model, content, nil))
+	if err != nil {
+		return false, "", err
+	}
+	if rejected != nil {
+		return false, "request with an image rejected: " + truncate(rejected.Error()), nil
+	}
+	answer := strings.TrimSpace(reply.Content)
+	switch {
+	case answer == "":
+		return true, "image accepted; the reply was empty", nil
+	case strings.Contains(strings.ToLower(answer), "red"):
+		return true, fmt.Sprintf("identified the color (%q)", truncate(answer)), nil
+	}
+	return false, fmt.Sprintf("image was ignored (reply %q)", truncate(answer)), nil
+}
+
+// probeOutputLimit 请求比声明上限多 1 的 maxOutputTokens：后端拒绝说明声明的上限即真实上限。
+// 提示只要求回答一个词，实际输出仍然很短
+func probeOutputLimit(ctx context.Context, account *store.Account, model string) (bool, string, error) {
+	limit := converter.GetModelConfig(model).EffectiveMaxOutputTokens()
+	req := probeRequest(account, model, "Reply with the single word OK.", nil)
+	req.Request.GenerationConfig.MaxOutputTokens = limit + 1
+
+	_, rejected, err := send(ctx, account, req)
+	if err != nil {
+		return false, "", err
+	}
+	if rejected != nil {
+		return true, fmt.Sprintf("max_output_tokens %d rejected", limit+1), nil
+	}
+	return false, fmt.Sprintf("backend accepted max_output_tokens %d above the declared limit %d", limit+1, limit), nil
+}
+
+// probePixel 1×1 红色 PNG（base64）
+var probePixel = func() string {
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}()
+
+func truncate(s string) string {
+	if r := []rune(s); len(r) > 120 {
+		return string(r[:120]) + "…"
+	}
+	return s
+}
+
+// logSummary 记录探测结果，声明与探测不一致的能力单独记录警告
+func logSummary(report *Report) {
+	counts := make(map[string]int)
+	for _, r := range report.Results {
+		counts[r.Status]++
+		if r.Status == StatusUnsupported {
+			logger.Warn("Capability probe: %s %s unsupported: %s", r.Model, r.Capability, r.Detail)
+		}
+	}
+	logger.Info("Capability probe (%s): %d supported, %d unsupported, %d errors, %d skipped; budget %d/%d today",
+		report.Trigger, counts[StatusSupported], counts[StatusUnsupported], counts[StatusError], counts[StatusSkipped],
+		report.Budget.Used, config.Get().CapProbeDailyLimit)
+}
+
+// Start 启动定期探测（CAPABILITY_PROBE_INTERVAL 小时一次），并在模型列表读取到过期结果时在后台重新探测该模型。
+// 未配置探测账号或间隔为 0 时不启动
+func Start() {
+	cfg := config.Get()
+	interval := time.Duration(cfg.CapProbeInterval) * time.Hour
+	if cfg.CapProbeAccount == "" || interval <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	p.cancel, p.done = cancel, done
+
+	converter.SetCapabilityRevalidateHook(revalidate(ctx))
+	monitor.Go("capability-probe", func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, err := Run(ctx, nil, TriggerSchedule); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Warn("Scheduled capability probe failed: %v", err)
+			}
+		}
+	})
+}
+
+// revalidate 返回重新探测回调：同一模型每 revalidateGap 最多一次，已有探测在进行时跳过
+func revalidate(ctx context.Context) func(model string) {
+	return func(model string) {
+		p.mu.Lock()
+		if p.running || time.Since(p.revalidated[model]) < revalidateGap {
+			p.mu.Unlock()
+			return
+		}
+		p.revalidated[model] = time.Now()
+		p.mu.Unlock()
+
+		monitor.Go("capability-revalidate", func() {
+			if _, err := Run(ctx, []string{model}, TriggerRevalidate); err != nil && !errors.Is(err, ErrRunning) &&
+				!errors.Is(err, context.Canceled) {
+				logger.Warn("Capability revalidation of %s failed: %v", model, err)
+			}
+		})
+	}
+}
+
+// Stop 停止定期探测并等待正在进行的探测结束
+func Stop(ctx context.Context) error {
+	converter.SetCapabilityRevalidateHook(nil)
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.cancel, p.done = nil, nil
+	p.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,192 @@
+package chaos
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"anti2api-golang/internal/config"
+)
+
+// 故障类型
+const (
+	FaultStatus    = "status"    // 返回合成的错误状态码（429/5xx）
+	FaultSlow      = "slow"      // 延迟后再请求上游
+	FaultTruncate  = "truncate"  // 请求上游后截断响应
+	FaultMalformed = "malformed" // 返回无法解析的 JSON
+)
+
+// Marker 注入故障产生的错误信息前缀，用于在日志中区分真实故障
+const Marker = "[chaos]"
+
+// Rule 故障注入规则
+type Rule struct {
+	ID          string  `json:"id"`
+	Fault       string  `json:"fault"`
+	Status      int     `json:"status,omitempty"`      // status: 状态码，默认 503
+	DelayMs     int     `json:"delayMs,omitempty"`     // slow: 延迟时长
+	TruncateAt  int     `json:"truncateAt,omitempty"`  // truncate: 保留的字节数，默认 256
+	Model       string  `json:"model,omitempty"`       // 为空时匹配所有模型
+	Account     string  `json:"account,omitempty"`     // 邮箱或项目 ID，为空时匹配所有账号
+	Probability float64 `json:"probability,omitempty"` // 0~1，默认 1
+	Remaining   int     `json:"remaining,omitempty"`   // 剩余触发次数，0 为不限
+	Hits        int64   `json:"hits"`
+	CreatedAt   string  `json:"createdAt"`
+}
+
+// Engine 故障注入引擎（仅在 CHAOS_ENABLED=true 时生效）
+type Engine struct {
+	mu      sync.Mutex
+	enabled bool
+	rules   []*Rule
+	nextID  int
+	rand    *rand.Rand
+}
+
+var (
+	engine     *Engine
+	engineOnce sync.Once
+
+	injected atomic.Int64
+)
+
+// Get 获取故障注入引擎单例
+func Get() *Engine {
+	engineOnce.Do(func() {
+		engine = &Engine{
+			enabled: config.Get().ChaosEnabled,
+			rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		}
+	})
+	return engine
+}
+
+// Enabled 是否启用故障注入
+func (e *Engine) Enabled() bool {
+	return e.enabled
+}
+
+// Add 添加规则
+func (e *Engine) Add(rule Rule) (*Rule, error) {
+	switch rule.Fault {
+	case FaultStatus:
+		if rule.Status == 0 {
+			rule.Status = 503
+		}
+		if rule.Status < 400 || rule.Status > 599 {
+			return nil, fmt.Errorf("status must be 4xx or 5xx")
+		}
+	case FaultSlow:
+		if rule.DelayMs <= 0 {
+			return nil, fmt.Errorf("delayMs is required for slow fault")
+		}
+	case FaultTruncate:
+		if rule.TruncateAt <= 0 {
+			rule.TruncateAt = 256
+		}
+	case FaultMalformed:
+	default:
+		return nil, fmt.Errorf("unknown fault: %s", rule.Fault)
+	}
+
+	if rule.Probability <= 0 || rule.Probability > 1 {
+		rule.Probability = 1
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.nextID++
+	rule.ID = fmt.Sprintf("chaos-%d", e.nextID)
+	rule.Hits = 0
+	rule.CreatedAt = time.Now().Format(time.RFC3339)
+	e.rules = append(e.rules, &rule)
+	return &rule, nil
+}
+
+// Remove 删除规则
+func (e *Engine) Remove(id string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, rule := range e.rules {
+		if rule.ID == id {
+			e.rules = append(e.rules[:i], e.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Clear 清空规则
+func (e *Engine) Clear() {
+	e.mu.Lock()
+	e.rules = nil
+	e.mu.Unlock()
+}
+
+// List 列出规则
+func (e *Engine) List() []Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result := make([]Rule, 0, len(e.rules))
+	for _, rule := range e.rules {
+		result = append(result, *rule)
+	}
+	return result
+}
+
+// Match 查找本次请求要注入的故障（按添加顺序匹配第一条命中的规则）
+func (e *Engine) Match(model, email, projectID string) *Rule {
+	if !e.enabled {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, rule := range e.rules {
+		if rule.Model != "" && rule.Model != model {
+			continue
+		}
+		if rule.Account != "" && rule.Account != email && rule.Account != projectID {
+			continue
+		}
+		if rule.Probability < 1 && e.rand.Float64() >= rule.Probability {
+			continue
+		}
+
+		rule.Hits++
+		injected.Add(1)
+		matched := *rule
+
+		// 次数用尽后移除
+		if rule.Remaining > 0 {
+			rule.Remaining--
+			if rule.Remaining == 0 {
+				e.rules = append(e.rules[:i], e.rules[i+1:]...)
+			}
+		}
+		return &matched
+	}
+	return nil
+}
+
+// Injected 累计注入的故障数
+func Injected() int64 {
+	return injected.Load()
+}
+
+// Message 生成带标记的错误信息
+func Message(rule *Rule, detail string) string {
+	return fmt.Sprintf("%s %s (%s): %s", Marker, rule.Fault, rule.ID, detail)
+}
+
+// IsInjected 检查错误信息是否来自注入的故障
+func IsInjected(message string) bool {
+	return strings.Contains(message, Marker)
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+)
+
+// EndpointModeWeighted 按权重分流模式
+const EndpointModeWeighted = "weighted"
+
+// EndpointStats 端点流量统计（自启动或最近一次设置权重起）
+type EndpointStats struct {
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"errorRate"` // 百分比
+}
+
+// SetWeights 设置端点权重并切换到按权重分流模式（重置流量统计）
+func (m *EndpointManager) SetWeights(weights map[string]int) error {
+	total := 0
+	for key, weight := range weights {
+		if _, ok := APIEndpoints[key]; !ok {
+			return fmt.Errorf("unknown endpoint: %s", key)
+		}
+		if weight < 0 {
+			return fmt.Errorf("weight for %s must not be negative", key)
+		}
+		total += weight
+	}
+	if total <= 0 {
+		return fmt.Errorf("at least one endpoint must have a positive weight")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.weights = make(map[string]int, len(weights))
+	for key, weight := range weights {
+		if weight > 0 {
+			m.weights[key] = weight
+		}
+	}
+	m.mode = EndpointModeWeighted
+	m.stats = make(map[string]*EndpointStats)
+	m.pinModeLocked()
+	return m.saveSettings()
+}
+
+// GetWeights 获取端点权重
+func (m *EndpointManager) GetWeights() map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	weights := make(map[string]int, len(m.weights))
+	for key, weight := range m.weights {
+		weights[key] = weight
+	}
+	return weights
+}
+
+// EndpointFor 选择端点：按权重分流模式下同一会话 key 总是分配到同一端点（key 为空时随机），
+// 其他模式与 GetActiveEndpoint 相同
+func (m *EndpointManager) EndpointFor(conversationKey string) Endpoint {
+	m.mu.Lock()
+	if m.mode != EndpointModeWeighted {
+		m.mu.Unlock()
+		return m.GetActiveEndpoint()
+	}
+	defer m.mu.Unlock()
+	return APIEndpoints[m.pickWeightedLocked(conversationKey)]
+}
+
+// pickWeightedLocked 按权重选择端点 key（调用者必须持有锁）
+func (m *EndpointManager) pickWeightedLocked(conversationKey string) string {
+	keys := make([]string, 0, len(m.weights))
+	total := 0
+	for key, weight := range m.weights {
+		keys = append(keys, key)
+		total += weight
+	}
+	if total <= 0 {
+		return "daily"
+	}
+	// 固定顺序，保证同一 key 的分配结果稳定
+	sort.Strings(keys)
+
+	var n int
+	if conversationKey != "" {
+		h := fnv.New32a()
+		h.Write([]byte(conversationKey))
+		n = int(h.Sum32() % uint32(total))
+	} else {
+		n = rand.Intn(total)
+	}
+	for _, key := range keys {
+		n -= m.weights[key]
+		if n < 0 {
+			return key
+		}
+	}
+	return keys[len(keys)-1]
+}
+
+// RecordResult 记录端点请求结果（当前端点超出错误预算时切换到备用端点）
+func (m *EndpointManager) RecordResult(endpointKey string, success bool) {
+	m.mu.Lock()
+	var event *EndpointEvent
+	defer func() {
+		m.mu.Unlock()
+		emitEndpointEvent(event)
+	}()
+
+	if m.budget != nil {
+		if event = m.budget.record(&m.mode, endpointKey, success); event != nil {
+			m.saveSettings()
+		}
+	}
+	if m.stats == nil {
+		m.stats = make(map[string]*EndpointStats)
+	}
+	stats, ok := m.stats[endpointKey]
+	if !ok {
+		stats = &EndpointStats{}
+		m.stats[endpointKey] = stats
+	}
+	stats.Requests++
+	if !success {
+		stats.Errors++
+	}
+}
+
+// Stats 获取各端点的流量统计
+func (m *EndpointManager) Stats() map[string]EndpointStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make(map[string]EndpointStats, len(m.stats))
+	for key, stats := range m.stats {
+		s := *stats
+		if s.Requests > 0 {
+			s.ErrorRate = float64(s.Errors) * 100 / float64(s.Requests)
+		}
+		result[key] = s
+	}
+	return result
+}
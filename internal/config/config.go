@@ -1,17 +1,26 @@
 package config
 
 import (
+	"net"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Config 应用配置
 type Config struct {
 	// 服务配置
 	Port int
-	Host string
+	Host string // 监听地址，多个用逗号分隔（如 0.0.0.0,[::]）
+
+	// 连接超时（秒），防止慢速客户端长期占用连接
+	ReadHeaderTimeout  int // 读取请求头
+	ReadTimeout        int // 读取整个请求（含请求体）
+	WriteTimeout       int // 非流式响应的写入，0 为 TIMEOUT + 30 秒
+	IdleTimeout        int // keep-alive 连接空闲
+	StreamWriteTimeout int // 流式响应单次写入（每次写入前重新计时，不受 WriteTimeout 限制）
 
 	// API 配置
 	UserAgent string
@@ -19,29 +28,211 @@ type Config struct {
 	Proxy     string
 
 	// 安全配置
-	APIKey        string
-	PanelUser     string
-	PanelPassword string
+	APIKey         string
+	PanelUser      string
+	PanelPassword  string
+	TrustedProxies []string // 受信任的反向代理（IP 或 CIDR），仅信任其转发的 X-Forwarded-For / X-Real-IP
 
 	// 请求限制
 	MaxRequestSize string
 
+	// 客户端错误消息和管理接口标签的默认语言（请求未通过 Accept-Language 指定支持的语言时使用）
+	DefaultLocale string
+
 	// 重试配置
 	RetryStatusCodes []int
 	RetryMaxAttempts int
 
+	// 账号切换：上游返回 429/401/403 时换用其他账号重试（流式请求只在输出前切换）
+	AccountFailoverAttempts int // 单个请求最多切换的次数，0 为不切换
+	AccountFailoverCooldown int // 失败账号暂停选用的时间（秒）
+	RateLimitCooldown       int // 上游返回 429 且没有 Retry-After 时账号暂停选用的时间（秒），0 为不暂停
+
 	// 日志配置
-	Debug string
+	Debug            string
+	DebugVerboseTTL  int // verbose 级别自动恢复时间（分钟）
+	LogMaxEntries    int // 内存中保留的请求日志条数，超出时丢弃最旧的日志
+	LogDetailMaxMB   int // 日志详情（请求/响应快照）内存预算，超出时丢弃最旧的详情，0 为不限
+	LogQueueSize     int // 日志写入队列长度，队列满时丢弃日志（不阻塞请求）
+	LogSearchMaxScan int // 全文搜索单次最多检查的日志条数（从最新的开始）
 
 	// 端点模式
 	EndpointMode string
 
+	// 端点错误预算：当前端点在窗口内失败率超过阈值时自动切换到备用端点，原端点通过观察期探测后切回
+	EndpointFallback      string // 备用端点（为空不启用）
+	EndpointErrorBudget   int    // 失败率阈值（百分比）
+	EndpointBudgetWindow  int    // 统计窗口（分钟）
+	EndpointBudgetMinReqs int    // 触发切换的最少请求数
+	EndpointProbation     int    // 原端点需连续探测成功的时间（分钟）
+	EndpointProbeInterval int    // 探测间隔（秒）
+
 	// OAuth 配置
 	GoogleClientID     string
 	GoogleClientSecret string
 
 	// 数据目录
 	DataDir string
+
+	// 告警 Webhook 配置
+	WebhookURLs         []string
+	WebhookEvents       []string
+	WebhookCooldown     int // 同类事件最小间隔（秒）
+	ErrorRateThreshold  int // 错误率告警阈值（百分比）
+	ErrorRateWindow     int // 错误率统计窗口（分钟）
+	ErrorRateMinSamples int // 触发错误率告警的最少请求数
+	CooldownStorm       int // 冷却风暴告警阈值（暂停选用的账号占启用账号的百分比，0 为关闭）
+
+	// 存储的聊天完成（store: true）
+	CompletionStoreTTL      int // 保存时长（小时）
+	CompletionStoreMaxMB    int // 总容量上限（MB）
+	CompletionStoreKeyQuota int // 每个 API Key 的最大保存条数
+
+	// 批处理文件（/v1/files、/v1/batches）
+	FilesTTLHours    int // 文件保存时长（小时）
+	FilesMaxSizeMB   int // 单个文件大小上限（MB）
+	FilesMaxMB       int // 文件总容量上限（MB）
+	FilesKeyQuota    int // 每个 API Key 的最大文件数
+	BatchConcurrency int // 单个批处理的并发请求数
+	BatchMaxRequests int // 单个批处理的最大请求数
+	BatchMaxActive   int // 每个 API Key 同时进行的批处理数
+
+	// 延迟重试队列（X-Defer-On-Exhaustion）
+	DeferredMaxQueue      int // 队列中等待重试的请求数上限
+	DeferredKeyQuota      int // 每个 API Key 等待重试的请求数上限
+	DeferredMaxWait       int // 允许的最长等待时间（秒）
+	DeferredRetryInterval int // 重试间隔（秒）
+	DeferredResultTTL     int // 结果保存时长（分钟）
+
+	// 系统提示压缩（默认关闭）
+	PromptCompression       bool   // 总开关
+	PromptMinify            bool   // 去除系统提示中多余的空白（不改变内容）
+	PromptReferenceTemplate string // 支持隐式缓存的模型在同一会话重复发送相同系统提示时使用的引用说明
+	PromptReferenceTTL      int    // 引用之前发送的系统提示的有效期（秒）
+
+	// 公开状态页（GET /api/public/status，不需要面板登录）
+	PublicStatus          bool   // 是否开启，默认关闭
+	PublicStatusToken     string // 访问令牌（可选，?token= 或 Authorization: Bearer）
+	PublicStatusRateLimit int    // 每个 IP 每分钟的请求数上限（0 为不限）
+
+	// 运行时监控
+	MonitorSampleInterval int  // 采样间隔（秒，0 为关闭）
+	MonitorLeakThreshold  int  // 空闲时协程数超出基线多少视为疑似泄漏（0 为不检测）
+	StreamMaxDuration     int  // 流式输出的最长时间（分钟，0 为不限），超过时标记并告警
+	StreamWatchdogCancel  bool // 是否强制取消超时的流式输出
+
+	// 大响应落盘
+	SpillDir         string // 临时目录（启动时清空），默认系统临时目录下的 anti2api-spill
+	SpillThresholdKB int    // 单个响应超过该大小时落盘，0 为不落盘
+	SpillMaxMB       int    // 磁盘预算，超出时淘汰最旧的数据
+
+	// Token 刷新限流
+	RefreshRateLimit  int // 每分钟最多刷新次数（0 为不限）
+	RefreshBackoffMax int // 单账号刷新失败的最大退避时间（秒）
+	RefreshPause      int // OAuth 端点返回 429/5xx 时暂停所有刷新的时间（秒）
+
+	// 账号排空宽限期（分钟）：排空账号在此期间继续服务已有会话
+	DrainGraceMinutes int
+
+	// 账号选择
+	SelectionStrategy string // round_robin（默认）或 healthiest（优先健康分最高的账号）
+	HealthHalfLife    int    // 健康分统计的半衰期（分钟），无活动时健康分逐渐回到中性
+
+	// 会话绑定
+	ConversationAffinity bool // 会话保持在首次分配的账号上（不开启时只对排空账号生效）
+	AffinityMaxEntries   int  // 最多保留的绑定数（LRU 淘汰），0 为不限
+	AffinityTTLMinutes   int  // 绑定无活动后的有效期（分钟，不短于排空宽限期）
+	AffinityPersist      bool // 关闭时保存绑定，重启后恢复
+
+	// 后台 Token 刷新：定期刷新即将过期的账号
+	TokenRefreshInterval int // 检查间隔（秒），0 为不启用
+	TokenRefreshWindow   int // 提前刷新的时间（分钟）
+
+	// 流式增量合并
+	StreamCoalesceMs       int // 合并间隔（毫秒），0 为不合并
+	StreamCoalesceMaxBytes int // 合并缓冲达到该字节数时立即输出
+
+	// 流式工具调用参数分片大小（字节），0 为整体输出
+	ToolArgsFragmentSize int
+
+	// 流式首个数据块前的心跳
+	StreamHeartbeatInterval int    // 间隔（秒），0 为不发送
+	StreamHeartbeatStyle    string // chunk 发送空 delta，comment 发送 SSE 注释行
+
+	// bypass 模式分段回放（上游非流式响应按词或句逐段输出）
+	BypassPaceMs         int    // 相邻片段的间隔（毫秒），0 为整体输出
+	BypassPaceUnit       string // word 按词，sentence 按句
+	BypassPaceMaxExtraMs int    // 分段回放最多增加的总时间（毫秒）
+
+	// 流式引用（联网搜索 url_citation）输出方式：delta 单独发送带 annotations 的 delta，final 放在结束 chunk 的扩展字段中
+	StreamAnnotations string
+
+	// 故障注入（仅用于测试）
+	ChaosEnabled bool
+
+	// 请求转换预览（POST /v1/debug/convert）
+	DebugConvertEnabled bool
+
+	// 请求扩展 extra_generation_config 可设置的 GenerationConfig 字段：允许列表（* 为全部，为空不接受扩展）、禁止列表（优先）
+	ExtraGenConfigAllow []string
+	ExtraGenConfigDeny  []string
+
+	// 模型能力探测：通过指定账号（email，为空时不探测）发送小请求，记录工具、图片输入、输出上限是否与声明一致
+	CapProbeAccount    string
+	CapProbeInterval   int // 定期探测间隔（小时），0 为只在管理接口触发时探测
+	CapProbeMaxTokens  int // 单个探测请求的 max_tokens
+	CapProbeDailyLimit int // 每天（UTC）最多发送的探测请求数
+
+	// tool_choice 为 "none" 时的处理方式：omit 不发送工具，mode 发送工具并设置 Mode NONE
+	ToolChoiceNone string
+
+	// 工具声明限制（超出时截断并返回警告，STRICT_CONVERSION 开启时返回 400），0 为不限
+	ToolMaxDeclarations     int // 函数声明数量
+	ToolDescriptionMaxChars int // 函数描述长度（字符）
+	ToolSchemaMaxProperties int // 参数 schema 中单个对象的属性数量
+	ToolSchemaMaxDepth      int // 参数 schema 嵌套深度
+
+	// 透传模式：允许客户端通过 X-Upstream-Token 提供上游凭证（改变信任模型，默认关闭）
+	PassthroughEnabled bool
+
+	// 语料录制（离线评测数据集）
+	CorpusDir           string // JSONL 输出目录，为空时不录制
+	CorpusSamplePercent int    // 采样比例（0–100）
+	CorpusMaxFileMB     int    // 单个文件大小上限，超过后轮转
+	CorpusIncludeImages bool   // 是否保留图片（默认替换为占位文本）
+	CorpusDefaultOptIn  bool   // 不属于租户的 API Key 是否录制（租户通过 corpus 字段单独开启）
+
+	// 账号会话轮换：SessionID 使用达到请求数或时长后重新生成，0 为不限
+	SessionRotateRequests int
+	SessionRotateHours    int
+
+	// 严格转换：请求中无法转换的内容（非法工具参数、无法解析的图片等）直接返回 400
+	StrictConversion bool
+
+	// 不支持的请求参数处理方式：drop 丢弃，error 返回 400，warn 丢弃并返回警告
+	UnsupportedParams string
+
+	// 单个 tool 结果的大小限制（租户可单独配置）
+	ToolResultMaxKB       int    // 大小上限，0 为不限
+	ToolResultMode        string // truncate 截断中间部分，reject 返回 400
+	ToolResultHeadPercent int    // 截断时开头保留的比例（其余保留结尾）
+
+	// 图片处理（按文件头识别格式并修正 MIME 类型）
+	ImageTranscode bool // 将后端不支持但可解码的格式（BMP）转换为 PNG，关闭时返回 400
+	ImageMaxPixels int  // 像素数上限，超出时等比缩小（仅 PNG/JPEG/GIF），0 为不限
+	ImageMaxKB     int  // 解码后的大小上限，超出时等比缩小并重新编码，0 为不限
+
+	// 定时用量报表
+	UsageReportInterval int    // 生成间隔（小时），0 为关闭
+	UsageReportDir      string // 报表 CSV 写入目录
+	UsageReportWebhook  string // 报表 CSV 推送地址
+
+	// 链路追踪（OTLP/HTTP JSON 导出）
+	TraceEndpoint      string // OTLP 地址（如 http://collector:4318），为空时关闭
+	TraceSamplePercent int    // 采样比例（0–100）
+	TracePropagate     bool   // 向上游发送 traceparent 请求头
+	TraceServiceName   string // service.name 资源属性
+	TraceURLTemplate   string // 面板日志详情跳转链接，{traceId} 替换为追踪 ID
 }
 
 // Endpoint API 端点
@@ -88,22 +279,136 @@ var (
 func Load() *Config {
 	once.Do(func() {
 		cfg = &Config{
-			Port:               getEnvInt("PORT", 8045),
-			Host:               getEnv("HOST", "0.0.0.0"),
-			UserAgent:          getEnv("API_USER_AGENT", "antigravity/1.11.3 windows/amd64"),
-			Timeout:            getEnvInt("TIMEOUT", 600000),
-			Proxy:              getEnv("PROXY", ""),
-			APIKey:             getEnv("API_KEY", ""),
-			PanelUser:          getEnv("PANEL_USER", "admin"),
-			PanelPassword:      getEnv("PANEL_PASSWORD", ""),
-			MaxRequestSize:     getEnv("MAX_REQUEST_SIZE", "50mb"),
-			RetryStatusCodes:   getEnvIntSlice("RETRY_STATUS_CODES", []int{429, 500}),
-			RetryMaxAttempts:   getEnvInt("RETRY_MAX_ATTEMPTS", 3),
-			Debug:              getEnv("DEBUG", "off"),
-			EndpointMode:       getEnv("ENDPOINT_MODE", "daily"),
-			GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
-			GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
-			DataDir:            getEnv("DATA_DIR", "./data"),
+			Port:                    getEnvInt("PORT", 8045),
+			Host:                    getEnv("HOST", "0.0.0.0"),
+			TrustedProxies:          getEnvStringSlice("TRUSTED_PROXIES", nil),
+			UserAgent:               getEnv("API_USER_AGENT", "antigravity/1.11.3 windows/amd64"),
+			Timeout:                 getEnvInt("TIMEOUT", 600000),
+			ReadHeaderTimeout:       getEnvInt("SERVER_READ_HEADER_TIMEOUT", 10),
+			ReadTimeout:             getEnvInt("SERVER_READ_TIMEOUT", 60),
+			WriteTimeout:            getEnvInt("SERVER_WRITE_TIMEOUT", 0),
+			IdleTimeout:             getEnvInt("SERVER_IDLE_TIMEOUT", 120),
+			StreamWriteTimeout:      getEnvInt("STREAM_WRITE_TIMEOUT", 60),
+			Proxy:                   getEnv("PROXY", ""),
+			APIKey:                  getEnv("API_KEY", ""),
+			PanelUser:               getEnv("PANEL_USER", "admin"),
+			PanelPassword:           getEnv("PANEL_PASSWORD", ""),
+			MaxRequestSize:          getEnv("MAX_REQUEST_SIZE", "50mb"),
+			RetryStatusCodes:        getEnvIntSlice("RETRY_STATUS_CODES", []int{429, 500}),
+			RetryMaxAttempts:        getEnvInt("RETRY_MAX_ATTEMPTS", 3),
+			AccountFailoverAttempts: getEnvInt("ACCOUNT_FAILOVER_ATTEMPTS", 2),
+			AccountFailoverCooldown: getEnvInt("ACCOUNT_FAILOVER_COOLDOWN", 60),
+			RateLimitCooldown:       getEnvInt("RATE_LIMIT_COOLDOWN", 60),
+			Debug:                   getEnv("DEBUG", "off"),
+			LogMaxEntries:           getEnvInt("LOG_MAX_ENTRIES", 1000),
+			LogDetailMaxMB:          getEnvInt("LOG_DETAIL_MAX_MB", 256),
+			LogQueueSize:            getEnvInt("LOG_QUEUE_SIZE", 1024),
+			LogSearchMaxScan:        getEnvInt("LOG_SEARCH_MAX_SCAN", 2000),
+			EndpointMode:            getEnv("ENDPOINT_MODE", "daily"),
+			EndpointFallback:        getEnv("ENDPOINT_FALLBACK", ""),
+			EndpointErrorBudget:     getEnvInt("ENDPOINT_ERROR_BUDGET", 20),
+			EndpointBudgetWindow:    getEnvInt("ENDPOINT_ERROR_BUDGET_WINDOW", 5),
+			EndpointBudgetMinReqs:   getEnvInt("ENDPOINT_ERROR_BUDGET_MIN_REQUESTS", 20),
+			EndpointProbation:       getEnvInt("ENDPOINT_PROBATION", 10),
+			EndpointProbeInterval:   getEnvInt("ENDPOINT_PROBE_INTERVAL", 30),
+			GoogleClientID:          getEnv("GOOGLE_CLIENT_ID", ""),
+			GoogleClientSecret:      getEnv("GOOGLE_CLIENT_SECRET", ""),
+			DataDir:                 getEnv("DATA_DIR", "./data"),
+			WebhookURLs:             getEnvStringSlice("WEBHOOK_URLS", nil),
+			WebhookEvents:           getEnvStringSlice("WEBHOOK_EVENTS", nil),
+			WebhookCooldown:         getEnvInt("WEBHOOK_COOLDOWN", 300),
+			ErrorRateThreshold:      getEnvInt("ERROR_RATE_THRESHOLD", 50),
+			ErrorRateWindow:         getEnvInt("ERROR_RATE_WINDOW", 5),
+			ErrorRateMinSamples:     getEnvInt("ERROR_RATE_MIN_SAMPLES", 20),
+			CooldownStorm:           getEnvInt("COOLDOWN_STORM_THRESHOLD", 50),
+			CompletionStoreTTL:      getEnvInt("COMPLETION_STORE_TTL", 720),
+			CompletionStoreMaxMB:    getEnvInt("COMPLETION_STORE_MAX_MB", 100),
+			CompletionStoreKeyQuota: getEnvInt("COMPLETION_STORE_KEY_QUOTA", 1000),
+			FilesTTLHours:           getEnvInt("FILES_TTL_HOURS", 72),
+			FilesMaxSizeMB:          getEnvInt("FILES_MAX_SIZE_MB", 100),
+			FilesMaxMB:              getEnvInt("FILES_MAX_MB", 1024),
+			FilesKeyQuota:           getEnvInt("FILES_KEY_QUOTA", 100),
+			BatchConcurrency:        getEnvInt("BATCH_CONCURRENCY", 4),
+			BatchMaxRequests:        getEnvInt("BATCH_MAX_REQUESTS", 50000),
+			BatchMaxActive:          getEnvInt("BATCH_MAX_ACTIVE", 5),
+			DeferredMaxQueue:        getEnvInt("DEFERRED_MAX_QUEUE", 1000),
+			DeferredKeyQuota:        getEnvInt("DEFERRED_KEY_QUOTA", 50),
+			DeferredMaxWait:         getEnvInt("DEFERRED_MAX_WAIT", 3600),
+			DeferredRetryInterval:   getEnvInt("DEFERRED_RETRY_INTERVAL", 15),
+			DeferredResultTTL:       getEnvInt("DEFERRED_RESULT_TTL", 60),
+			PromptCompression:       getEnvBool("PROMPT_COMPRESSION", false),
+			PromptMinify:            getEnvBool("PROMPT_MINIFY", true),
+			PromptReferenceTemplate: getEnv("PROMPT_REFERENCE_TEMPLATE", "[System instructions unchanged from the previous request in this session (ref {hash}, ~{tokens} tokens). Continue following them.]"),
+			PromptReferenceTTL:      getEnvInt("PROMPT_REFERENCE_TTL", 300),
+			PublicStatus:            getEnvBool("PUBLIC_STATUS", false),
+			PublicStatusToken:       getEnv("PUBLIC_STATUS_TOKEN", ""),
+			PublicStatusRateLimit:   getEnvInt("PUBLIC_STATUS_RATE_LIMIT", 30),
+			MonitorSampleInterval:   getEnvInt("MONITOR_SAMPLE_INTERVAL", 30),
+			MonitorLeakThreshold:    getEnvInt("MONITOR_LEAK_THRESHOLD", 200),
+			StreamMaxDuration:       getEnvInt("STREAM_MAX_DURATION", 15),
+			StreamWatchdogCancel:    getEnvBool("STREAM_WATCHDOG_CANCEL", false),
+			SpillDir:                getEnv("SPILL_DIR", ""),
+			SpillThresholdKB:        getEnvInt("SPILL_THRESHOLD_KB", 256),
+			SpillMaxMB:              getEnvInt("SPILL_MAX_MB", 1024),
+			RefreshRateLimit:        getEnvInt("REFRESH_RATE_LIMIT", 30),
+			RefreshBackoffMax:       getEnvInt("REFRESH_BACKOFF_MAX", 3600),
+			RefreshPause:            getEnvInt("REFRESH_PAUSE", 300),
+			DrainGraceMinutes:       getEnvInt("DRAIN_GRACE_MINUTES", 30),
+			SelectionStrategy:       getEnv("SELECTION_STRATEGY", "round_robin"),
+			HealthHalfLife:          getEnvInt("HEALTH_HALF_LIFE", 30),
+			ConversationAffinity:    getEnvBool("CONVERSATION_AFFINITY", false),
+			AffinityMaxEntries:      getEnvInt("AFFINITY_MAX_ENTRIES", 10000),
+			AffinityTTLMinutes:      getEnvInt("AFFINITY_TTL_MINUTES", 30),
+			AffinityPersist:         getEnvBool("AFFINITY_PERSIST", false),
+			TokenRefreshInterval:    getEnvInt("TOKEN_REFRESH_INTERVAL", 60),
+			TokenRefreshWindow:      getEnvInt("TOKEN_REFRESH_WINDOW", 10),
+			StreamCoalesceMs:        getEnvInt("STREAM_COALESCE_MS", 0),
+			StreamCoalesceMaxBytes:  getEnvInt("STREAM_COALESCE_MAX_BYTES", 1024),
+			ToolArgsFragmentSize:    getEnvInt("TOOL_ARGS_FRAGMENT_SIZE", 0),
+			StreamHeartbeatInterval: getEnvInt("STREAM_HEARTBEAT_INTERVAL", 10),
+			StreamHeartbeatStyle:    getEnv("STREAM_HEARTBEAT_STYLE", "chunk"),
+			StreamAnnotations:       getEnv("STREAM_ANNOTATIONS", "delta"),
+			BypassPaceMs:            getEnvInt("BYPASS_PACE_MS", 0),
+			BypassPaceUnit:          getEnv("BYPASS_PACE_UNIT", "word"),
+			BypassPaceMaxExtraMs:    getEnvInt("BYPASS_PACE_MAX_EXTRA_MS", 2000),
+			ChaosEnabled:            getEnvBool("CHAOS_ENABLED", false),
+			DebugConvertEnabled:     getEnvBool("DEBUG_CONVERT_ENABLED", false),
+			ToolChoiceNone:          getEnv("TOOL_CHOICE_NONE", "omit"),
+			ExtraGenConfigAllow:     getEnvStringSlice("EXTRA_GENERATION_CONFIG_ALLOW", nil),
+			ExtraGenConfigDeny:      getEnvStringSlice("EXTRA_GENERATION_CONFIG_DENY", []string{"candidateCount"}),
+			CapProbeAccount:         getEnv("CAPABILITY_PROBE_ACCOUNT", ""),
+			CapProbeInterval:        getEnvInt("CAPABILITY_PROBE_INTERVAL", 24),
+			CapProbeMaxTokens:       getEnvInt("CAPABILITY_PROBE_MAX_TOKENS", 16),
+			CapProbeDailyLimit:      getEnvInt("CAPABILITY_PROBE_DAILY_LIMIT", 30),
+			ToolMaxDeclarations:     getEnvInt("TOOL_MAX_DECLARATIONS", 128),
+			ToolDescriptionMaxChars: getEnvInt("TOOL_DESCRIPTION_MAX_CHARS", 8192),
+			ToolSchemaMaxProperties: getEnvInt("TOOL_SCHEMA_MAX_PROPERTIES", 100),
+			ToolSchemaMaxDepth:      getEnvInt("TOOL_SCHEMA_MAX_DEPTH", 10),
+			UnsupportedParams:       getEnv("UNSUPPORTED_PARAMS", "drop"),
+			ToolResultMaxKB:         getEnvInt("TOOL_RESULT_MAX_KB", 256),
+			ToolResultMode:          getEnv("TOOL_RESULT_MODE", "truncate"),
+			ToolResultHeadPercent:   getEnvInt("TOOL_RESULT_HEAD_PERCENT", 70),
+			DefaultLocale:           getEnv("DEFAULT_LOCALE", "en"),
+			ImageTranscode:          getEnvBool("IMAGE_TRANSCODE", false),
+			ImageMaxPixels:          getEnvInt("IMAGE_MAX_PIXELS", 0),
+			ImageMaxKB:              getEnvInt("IMAGE_MAX_KB", 0),
+			PassthroughEnabled:      getEnvBool("PASSTHROUGH_ENABLED", false),
+			StrictConversion:        getEnvBool("STRICT_CONVERSION", false),
+			SessionRotateRequests:   getEnvInt("SESSION_ROTATE_REQUESTS", 0),
+			SessionRotateHours:      getEnvInt("SESSION_ROTATE_HOURS", 0),
+			CorpusDir:               getEnv("CORPUS_DIR", ""),
+			CorpusSamplePercent:     getEnvInt("CORPUS_SAMPLE_PERCENT", 100),
+			CorpusMaxFileMB:         getEnvInt("CORPUS_MAX_FILE_MB", 64),
+			CorpusIncludeImages:     getEnvBool("CORPUS_INCLUDE_IMAGES", false),
+			CorpusDefaultOptIn:      getEnvBool("CORPUS_DEFAULT_OPT_IN", false),
+			UsageReportInterval:     getEnvInt("USAGE_REPORT_INTERVAL", 0),
+			UsageReportDir:          getEnv("USAGE_REPORT_DIR", ""),
+			UsageReportWebhook:      getEnv("USAGE_REPORT_WEBHOOK", ""),
+			TraceEndpoint:           getEnv("OTLP_ENDPOINT", ""),
+			TraceSamplePercent:      getEnvInt("TRACE_SAMPLE_PERCENT", 100),
+			TracePropagate:          getEnvBool("TRACE_PROPAGATE", false),
+			TraceServiceName:        getEnv("TRACE_SERVICE_NAME", "anti2api"),
+			TraceURLTemplate:        getEnv("TRACE_URL_TEMPLATE", ""),
 		}
 
 		// 检查命令行参数
@@ -116,6 +421,26 @@ func Load() *Config {
 	return cfg
 }
 
+// EffectiveWriteTimeout 非流式响应写超时：未配置时为上游超时加 30 秒，保证等待上游的请求不会先被切断
+func (c *Config) EffectiveWriteTimeout() time.Duration {
+	if c.WriteTimeout > 0 {
+		return time.Duration(c.WriteTimeout) * time.Second
+	}
+	return time.Duration(c.Timeout)*time.Millisecond + 30*time.Second
+}
+
+// ListenAddrs 监听地址列表（HOST 逗号分隔，IPv6 地址可带方括号）
+func (c *Config) ListenAddrs() []string {
+	port := strconv.Itoa(c.Port)
+	var addrs []string
+	for _, host := range strings.Split(c.Host, ",") {
+		host = strings.TrimSpace(host)
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		addrs = append(addrs, net.JoinHostPort(host, port))
+	}
+	return addrs
+}
+
 // Get 获取配置实例
 func Get() *Config {
 	if cfg == nil {
@@ -168,6 +493,15 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
 func getEnvIntSlice(key string, defaultValue []int) []int {
 	if value := os.Getenv(key); value != "" {
 		parts := strings.Split(value, ",")
@@ -183,3 +517,19 @@ func getEnvIntSlice(key string, defaultValue []int) []int {
 	}
 	return defaultValue
 }
+
+func getEnvStringSlice(key string, defaultValue []string) []string {
+	if value := os.Getenv(key); value != "" {
+		parts := strings.Split(value, ",")
+		result := make([]string, 0, len(parts))
+		for _, p := range parts {
+			if p = strings.TrimSpace(p); p != "" {
+				result = append(result, p)
+			}
+		}
+		if len(result) > 0 {
+			return result
+		}
+	}
+	return defaultValue
+}
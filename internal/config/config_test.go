@@ -0,0 +1,20 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListenAddrs(t *testing.T) {
+	for host, want := range map[string][]string{
+		"0.0.0.0":         {"0.0.0.0:8045"},
+		"0.0.0.0, [::]":   {"0.0.0.0:8045", "[::]:8045"},
+		"::1":             {"[::1]:8045"},
+		"127.0.0.1,[::1]": {"127.0.0.1:8045", "[::1]:8045"},
+	} {
+		cfg := &Config{Host: host, Port: 8045}
+		if got := cfg.ListenAddrs(); !reflect.DeepEqual(got, want) {
+			t.Errorf("HOST=%q: addrs = %v, want %v", host, got, want)
+		}
+	}
+}
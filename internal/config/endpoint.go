@@ -2,6 +2,8 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
@@ -15,13 +17,22 @@ type EndpointManager struct {
 	roundRobinIndex   int
 	roundRobinDpIndex int
 	settingsPath      string
+	headers           map[string]string            // 上游请求附加头（空值表示移除默认头）
+	endpointHeaders   map[string]map[string]string // 按端点覆盖的请求头
+	weights           map[string]int               // 按权重分流模式的端点权重
+	stats             map[string]*EndpointStats    // 端点流量统计
+	budget            *errorBudget                 // 错误预算（未配置备用端点时为 nil）
 }
 
 // Settings 持久化设置
 type Settings struct {
-	EndpointMode    string    `json:"endpointMode"`
-	CurrentEndpoint string    `json:"currentEndpoint"`
-	UpdatedAt       time.Time `json:"updatedAt"`
+	EndpointMode    string                       `json:"endpointMode"`
+	CurrentEndpoint string                       `json:"currentEndpoint"`
+	Headers         map[string]string            `json:"headers,omitempty"`
+	EndpointHeaders map[string]map[string]string `json:"endpointHeaders,omitempty"`
+	Weights         map[string]int               `json:"weights,omitempty"`
+	AutoFailover    *autoFailoverSettings        `json:"autoFailover,omitempty"`
+	UpdatedAt       time.Time                    `json:"updatedAt"`
 }
 
 var (
@@ -29,6 +40,18 @@ var (
 	endpointMgrOnce sync.Once
 )
 
+// 设置文件读写函数，默认直接读写，persist 包初始化时替换为崩溃安全实现（避免循环依赖）
+var (
+	readSettingsFile  = os.ReadFile
+	writeSettingsFile = os.WriteFile
+)
+
+// SetSettingsFileIO 设置设置文件的读写函数
+func SetSettingsFileIO(read func(string) ([]byte, error), write func(string, []byte, os.FileMode) error) {
+	readSettingsFile = read
+	writeSettingsFile = write
+}
+
 // GetEndpointManager 获取端点管理器单例
 func GetEndpointManager() *EndpointManager {
 	endpointMgrOnce.Do(func() {
@@ -36,6 +59,7 @@ func GetEndpointManager() *EndpointManager {
 		endpointMgr = &EndpointManager{
 			mode:         cfg.EndpointMode,
 			settingsPath: filepath.Join(cfg.DataDir, "settings.json"),
+			budget:       errorBudgetFromConfig(cfg),
 		}
 		endpointMgr.loadSettings()
 	})
@@ -44,7 +68,7 @@ func GetEndpointManager() *EndpointManager {
 
 // loadSettings 加载持久化设置
 func (m *EndpointManager) loadSettings() {
-	data, err := os.ReadFile(m.settingsPath)
+	data, err := readSettingsFile(m.settingsPath)
 	if err != nil {
 		return
 	}
@@ -58,6 +82,12 @@ func (m *EndpointManager) loadSettings() {
 	if os.Getenv("ENDPOINT_MODE") == "" && settings.EndpointMode != "" {
 		m.mode = settings.EndpointMode
 	}
+	m.headers = settings.Headers
+	m.endpointHeaders = settings.EndpointHeaders
+	m.weights = settings.Weights
+	if m.budget != nil {
+		m.budget.restore(settings.AutoFailover, m.mode)
+	}
 }
 
 // saveSettings 保存设置
@@ -65,8 +95,14 @@ func (m *EndpointManager) saveSettings() error {
 	settings := Settings{
 		EndpointMode:    m.mode,
 		CurrentEndpoint: m.getCurrentEndpointKey(),
+		Headers:         m.headers,
+		EndpointHeaders: m.endpointHeaders,
+		Weights:         m.weights,
 		UpdatedAt:       time.Now(),
 	}
+	if m.budget != nil {
+		settings.AutoFailover = m.budget.settings()
+	}
 
 	data, err := json.MarshalIndent(settings, "", "  ")
 	if err != nil {
@@ -79,7 +115,20 @@ func (m *EndpointManager) saveSettings() error {
 		return err
 	}
 
-	return os.WriteFile(m.settingsPath, data, 0644)
+	return writeSettingsFile(m.settingsPath, data, 0644)
+}
+
+// SettingsPath 持久化设置文件路径
+func (m *EndpointManager) SettingsPath() string {
+	return m.settingsPath
+}
+
+// ReloadSettings 从磁盘重新加载持久化设置（恢复备份后调用）
+func (m *EndpointManager) ReloadSettings() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loadSettings()
+	return nil
 }
 
 func (m *EndpointManager) getCurrentEndpointKey() string {
@@ -96,6 +145,15 @@ func (m *EndpointManager) getCurrentEndpointKey() string {
 			idx = 0
 		}
 		return RoundRobinDpEndpoints[idx%len(RoundRobinDpEndpoints)]
+	case EndpointModeWeighted:
+		// 权重最高的端点
+		current, best := "daily", 0
+		for key, weight := range m.weights {
+			if weight > best || (weight == best && key < current) {
+				current, best = key, weight
+			}
+		}
+		return current
 	default:
 		return m.mode
 	}
@@ -115,6 +173,8 @@ func (m *EndpointManager) GetActiveEndpoint() Endpoint {
 		key := RoundRobinDpEndpoints[m.roundRobinDpIndex]
 		m.roundRobinDpIndex = (m.roundRobinDpIndex + 1) % len(RoundRobinDpEndpoints)
 		return APIEndpoints[key]
+	case EndpointModeWeighted:
+		return APIEndpoints[m.pickWeightedLocked("")]
 	default:
 		if ep, ok := APIEndpoints[m.mode]; ok {
 			return ep
@@ -130,7 +190,7 @@ func (m *EndpointManager) GetMode() string {
 	return m.mode
 }
 
-// SetMode 设置端点模式
+// SetMode 设置端点模式（手动设置，暂停错误预算触发的自动切换）
 func (m *EndpointManager) SetMode(mode string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -140,11 +200,12 @@ func (m *EndpointManager) SetMode(mode string) error {
 		"daily": true, "autopush": true, "production": true,
 		"round-robin": true, "round-robin-dp": true,
 	}
-	if !validModes[mode] {
-		return nil // 忽略无效模式
+	if !validModes[mode] && !(mode == EndpointModeWeighted && len(m.weights) > 0) {
+		return nil // 忽略无效模式（按权重分流需先设置权重）
 	}
 
 	m.mode = mode
+	m.pinModeLocked()
 	return m.saveSettings()
 }
 
@@ -152,3 +213,56 @@ func (m *EndpointManager) SetMode(mode string) error {
 func (m *EndpointManager) GetAllEndpoints() map[string]Endpoint {
 	return APIEndpoints
 }
+
+// GetHeaders 获取上游请求头配置（全局和按端点覆盖）
+func (m *EndpointManager) GetHeaders() (map[string]string, map[string]map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	headers := make(map[string]string, len(m.headers))
+	for k, v := range m.headers {
+		headers[k] = v
+	}
+	endpointHeaders := make(map[string]map[string]string, len(m.endpointHeaders))
+	for ep, h := range m.endpointHeaders {
+		endpointHeaders[ep] = make(map[string]string, len(h))
+		for k, v := range h {
+			endpointHeaders[ep][k] = v
+		}
+	}
+	return headers, endpointHeaders
+}
+
+// SetHeaders 设置上游请求头配置并持久化
+func (m *EndpointManager) SetHeaders(headers map[string]string, endpointHeaders map[string]map[string]string) error {
+	for ep := range endpointHeaders {
+		if _, ok := APIEndpoints[ep]; !ok {
+			return fmt.Errorf("unknown endpoint: %s", ep)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.headers = headers
+	m.endpointHeaders = endpointHeaders
+	return m.saveSettings()
+}
+
+// HeadersFor 获取指定端点生效的请求头（端点配置覆盖全局配置）
+func (m *EndpointManager) HeadersFor(endpointKey string) map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.headers) == 0 && len(m.endpointHeaders[endpointKey]) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(m.headers))
+	for k, v := range m.headers {
+		result[http.CanonicalHeaderKey(k)] = v
+	}
+	for k, v := range m.endpointHeaders[endpointKey] {
+		result[http.CanonicalHeaderKey(k)] = v
+	}
+	return result
+}
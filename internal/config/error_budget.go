@@ -0,0 +1,344 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// 端点自动切换事件
+const (
+	EndpointEventDowngraded = "endpoint_downgraded" // 当前端点超出错误预算，已切换到备用端点
+	EndpointEventRestored   = "endpoint_restored"   // 原端点通过观察期探测，已切回
+)
+
+// 端点自动切换状态
+const (
+	AutoFailoverDisabled   = "disabled"   // 未配置备用端点
+	AutoFailoverIdle       = "idle"       // 当前模式不是单个端点（轮询、按权重分流等），不监控
+	AutoFailoverMonitoring = "monitoring" // 监控当前端点的错误率
+	AutoFailoverDegraded   = "degraded"   // 已切换到备用端点，探测原端点
+	AutoFailoverSuspended  = "suspended"  // 手动切换过模式，暂停自动切换
+)
+
+// budgetBucketWidth 错误率统计的分桶宽度
+const budgetBucketWidth = 10 * time.Second
+
+// ErrorBudgetPolicy 端点错误预算
+type ErrorBudgetPolicy struct {
+	Fallback    string        // 备用端点
+	Threshold   int           // 失败率超过该百分比时切换
+	Window      time.Duration // 统计窗口
+	MinRequests int           // 窗口内请求数达到该值才判断
+	Probation   time.Duration // 原端点需连续探测成功的时间
+}
+
+// EndpointEvent 端点自动切换事件
+type EndpointEvent struct {
+	Type     string
+	From     string // 切换前的端点模式
+	To       string // 切换后的端点模式
+	Requests int    // 触发切换时窗口内的请求数（切回时为探测次数）
+	Errors   int    // 触发切换时窗口内的失败数
+}
+
+// Message 事件说明
+func (e EndpointEvent) Message() string {
+	if e.Type == EndpointEventDowngraded {
+		return fmt.Sprintf("Endpoint %s exceeded its error budget (%d/%d failed), switched to %s", e.From, e.Errors, e.Requests, e.To)
+	}
+	return fmt.Sprintf("Endpoint %s passed probation (%d probes), switched back from %s", e.To, e.Requests, e.From)
+}
+
+// AutoFailoverStatus 端点自动切换状态（管理接口展示）
+type AutoFailoverStatus struct {
+	State          string     `json:"state"`
+	Fallback       string     `json:"fallback,omitempty"`
+	Monitored      string     `json:"monitored,omitempty"`      // 正在监控的端点
+	WindowRequests int        `json:"windowRequests"`           // 窗口内的请求数
+	WindowErrors   int        `json:"windowErrors"`             // 窗口内的失败数
+	DegradedFrom   string     `json:"degradedFrom,omitempty"`   // 降级前的端点
+	DegradedAt     *time.Time `json:"degradedAt,omitempty"`     // 降级时间
+	ProbationSince *time.Time `json:"probationSince,omitempty"` // 原端点连续探测成功的开始时间
+}
+
+// autoFailoverSettings 持久化的自动切换状态（重启后保持暂停或降级）
+type autoFailoverSettings struct {
+	Suspended    bool       `json:"suspended,omitempty"`
+	DegradedFrom string     `json:"degradedFrom,omitempty"`
+	DegradedAt   *time.Time `json:"degradedAt,omitempty"`
+}
+
+type budgetBucket struct {
+	start    time.Time
+	requests int
+	errors   int
+}
+
+// errorBudget 端点错误预算状态机（由 EndpointManager 的锁保护）：
+// monitoring --失败率超过阈值--> degraded --原端点连续探测成功满观察期--> monitoring；
+// 手动切换模式时进入 suspended，恢复自动切换后回到 monitoring
+type errorBudget struct {
+	policy ErrorBudgetPolicy
+	now    func() time.Time
+
+	monitored string         // buckets 对应的端点
+	buckets   []budgetBucket // 按 budgetBucketWidth 分桶的请求结果
+
+	suspended      bool
+	degradedFrom   string    // 降级前的端点（为空表示未降级）
+	degradedAt     time.Time // 降级时间
+	probationStart time.Time // 原端点连续探测成功的开始时间（为零表示尚未成功）
+	probes         int       // 连续成功的探测次数
+}
+
+func newErrorBudget(policy ErrorBudgetPolicy) *errorBudget {
+	return &errorBudget{policy: policy, now: time.Now}
+}
+
+// errorBudgetFromConfig 按配置创建错误预算，未配置或备用端点无效时返回 nil
+func errorBudgetFromConfig(cfg *Config) *errorBudget {
+	if _, ok := APIEndpoints[cfg.EndpointFallback]; !ok || cfg.EndpointErrorBudget <= 0 || cfg.EndpointBudgetWindow <= 0 {
+		return nil
+	}
+	return newErrorBudget(ErrorBudgetPolicy{
+		Fallback:    cfg.EndpointFallback,
+		Threshold:   cfg.EndpointErrorBudget,
+		Window:      time.Duration(cfg.EndpointBudgetWindow) * time.Minute,
+		MinRequests: cfg.EndpointBudgetMinReqs,
+		Probation:   time.Duration(cfg.EndpointProbation) * time.Minute,
+	})
+}
+
+// monitors 该模式下是否监控错误率（单个端点且不是备用端点）
+func (b *errorBudget) monitors(mode string) bool {
+	_, single := APIEndpoints[mode]
+	return single && mode != b.policy.Fallback && !b.suspended && b.degradedFrom == ""
+}
+
+// record 记录当前模式下端点的请求结果，超出错误预算时切换模式并返回事件
+func (b *errorBudget) record(mode *string, endpointKey string, success bool) *EndpointEvent {
+	if !b.monitors(*mode) || endpointKey != *mode {
+		return nil
+	}
+	if b.monitored != endpointKey {
+		b.monitored = endpointKey
+		b.buckets = nil
+	}
+
+	now := b.now()
+	start := now.Truncate(budgetBucketWidth)
+	if n := len(b.buckets); n == 0 || !b.buckets[n-1].start.Equal(start) {
+		b.buckets = append(b.buckets, budgetBucket{start: start})
+	}
+	last := &b.buckets[len(b.buckets)-1]
+	last.requests++
+	if !success {
+		last.errors++
+	}
+
+	requests, errors := b.window(now)
+	if requests < b.policy.MinRequests || requests == 0 || errors*100 <= b.policy.Threshold*requests {
+		return nil
+	}
+
+	event := &EndpointEvent{Type: EndpointEventDowngraded, From: *mode, To: b.policy.Fallback, Requests: requests, Errors: errors}
+	b.degradedFrom = *mode
+	b.degradedAt = now
+	b.probationStart = time.Time{}
+	b.probes = 0
+	b.buckets = nil
+	*mode = b.policy.Fallback
+	return event
+}
+
+// window 移除窗口外的分桶，返回窗口内的请求数和失败数
+func (b *errorBudget) window(now time.Time) (requests, errors int) {
+	cutoff := now.Add(-b.policy.Window)
+	kept := b.buckets[:0]
+	for _, bucket := range b.buckets {
+		if bucket.start.Add(budgetBucketWidth).After(cutoff) {
+			kept = append(kept, bucket)
+			requests += bucket.requests
+			errors += bucket.errors
+		}
+	}
+	b.buckets = kept
+	return requests, errors
+}
+
+// probe 记录原端点的探测结果，连续成功满观察期时切回原端点并返回事件。
+// 当前模式已不是备用端点（被手动修改）时放弃降级状态
+func (b *errorBudget) probe(mode *string, ok bool) *EndpointEvent {
+	if b.degradedFrom == "" || b.suspended {
+		return nil
+	}
+	if *mode != b.policy.Fallback {
+		b.clearDegraded()
+		return nil
+	}
+	if !ok {
+		b.probationStart = time.Time{}
+		b.probes = 0
+		return nil
+	}
+
+	now := b.now()
+	if b.probationStart.IsZero() {
+		b.probationStart = now
+	}
+	b.probes++
+	if now.Sub(b.probationStart) < b.policy.Probation || b.probes < 2 {
+		return nil
+	}
+
+	event := &EndpointEvent{Type: EndpointEventRestored, From: *mode, To: b.degradedFrom, Requests: b.probes}
+	*mode = b.degradedFrom
+	b.clearDegraded()
+	return event
+}
+
+func (b *errorBudget) clearDegraded() {
+	b.degradedFrom = ""
+	b.degradedAt = time.Time{}
+	b.probationStart = time.Time{}
+	b.probes = 0
+	b.buckets = nil
+}
+
+// pin 手动修改模式：暂停自动切换并放弃降级状态
+func (b *errorBudget) pin() {
+	b.suspended = true
+	b.clearDegraded()
+}
+
+// resume 恢复自动切换，从当前模式开始重新统计
+func (b *errorBudget) resume() {
+	b.suspended = false
+	b.clearDegraded()
+}
+
+func (b *errorBudget) status(mode string) AutoFailoverStatus {
+	status := AutoFailoverStatus{Fallback: b.policy.Fallback}
+	switch {
+	case b.suspended:
+		status.State = AutoFailoverSuspended
+	case b.degradedFrom != "":
+		status.State = AutoFailoverDegraded
+		status.DegradedFrom = b.degradedFrom
+		degradedAt := b.degradedAt
+		status.DegradedAt = &degradedAt
+		if !b.probationStart.IsZero() {
+			since := b.probationStart
+			status.ProbationSince = &since
+		}
+	case b.monitors(mode):
+		status.State = AutoFailoverMonitoring
+		status.Monitored = mode
+		if b.monitored == mode {
+			status.WindowRequests, status.WindowErrors = b.window(b.now())
+		}
+	default:
+		status.State = AutoFailoverIdle
+	}
+	return status
+}
+
+func (b *errorBudget) settings() *autoFailoverSettings {
+	if !b.suspended && b.degradedFrom == "" {
+		return nil
+	}
+	settings := &autoFailoverSettings{Suspended: b.suspended, DegradedFrom: b.degradedFrom}
+	if b.degradedFrom != "" {
+		degradedAt := b.degradedAt
+		settings.DegradedAt = &degradedAt
+	}
+	return settings
+}
+
+// restore 恢复持久化的状态（当前模式不是备用端点时降级状态已失效）
+func (b *errorBudget) restore(s *autoFailoverSettings, mode string) {
+	b.suspended = false
+	b.clearDegraded()
+	if s == nil {
+		return
+	}
+	b.suspended = s.Suspended
+	if _, ok := APIEndpoints[s.DegradedFrom]; ok && mode == b.policy.Fallback && !s.Suspended {
+		b.degradedFrom = s.DegradedFrom
+		if s.DegradedAt != nil {
+			b.degradedAt = *s.DegradedAt
+		}
+	}
+}
+
+// 端点自动切换事件的处理函数（由 server 包设置，发送 Webhook 和记录审计日志，避免循环依赖）
+var endpointEventHook func(EndpointEvent)
+
+// SetEndpointEventHook 设置端点自动切换事件的处理函数
+func SetEndpointEventHook(fn func(EndpointEvent)) {
+	endpointEventHook = fn
+}
+
+func emitEndpointEvent(event *EndpointEvent) {
+	if event != nil && endpointEventHook != nil {
+		endpointEventHook(*event)
+	}
+}
+
+// AutoFailoverStatus 端点自动切换状态
+func (m *EndpointManager) AutoFailoverStatus() AutoFailoverStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.budget == nil {
+		return AutoFailoverStatus{State: AutoFailoverDisabled}
+	}
+	return m.budget.status(m.mode)
+}
+
+// SetAutoFailover 恢复（true）或暂停（false）自动切换，未配置备用端点时返回错误
+func (m *EndpointManager) SetAutoFailover(enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.budget == nil {
+		return fmt.Errorf("automatic endpoint failover is not configured (set ENDPOINT_FALLBACK)")
+	}
+	if enabled {
+		m.budget.resume()
+	} else {
+		m.budget.pin()
+	}
+	return m.saveSettings()
+}
+
+// ProbationEndpoint 降级期间需要探测的原端点
+func (m *EndpointManager) ProbationEndpoint() (Endpoint, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.budget == nil || m.budget.degradedFrom == "" || m.budget.suspended {
+		return Endpoint{}, false
+	}
+	ep, ok := APIEndpoints[m.budget.degradedFrom]
+	return ep, ok
+}
+
+// RecordProbe 记录原端点的探测结果，通过观察期时切回原端点
+func (m *EndpointManager) RecordProbe(ok bool) {
+	m.mu.Lock()
+	var event *EndpointEvent
+	if m.budget != nil {
+		degraded := m.budget.degradedFrom
+		event = m.budget.probe(&m.mode, ok)
+		if m.budget.degradedFrom != degraded {
+			m.saveSettings()
+		}
+	}
+	m.mu.Unlock()
+	emitEndpointEvent(event)
+}
+
+// pinModeLocked 手动修改模式时暂停自动切换（调用者必须持有锁）
+func (m *EndpointManager) pinModeLocked() {
+	if m.budget != nil {
+		m.budget.pin()
+	}
+}
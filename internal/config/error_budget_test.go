@@ -0,0 +1,361 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testPolicy 5 分钟内至少 20 个请求且失败率超过 20% 时切换到 production，观察期 10 分钟
+var testPolicy = ErrorBudgetPolicy{
+	Fallback:    "production",
+	Threshold:   20,
+	Window:      5 * time.Minute,
+	MinRequests: 20,
+	Probation:   10 * time.Minute,
+}
+
+// fakeBudget 使用可手动推进的时钟的错误预算
+func fakeBudget() (*errorBudget, *time.Time) {
+	clock := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	b := newErrorBudget(testPolicy)
+	b.now = func() time.Time { return clock }
+	return b, &clock
+}
+
+// feed 按顺序记录一串结果（'.' 成功，'x' 失败），每个结果间隔 step，返回第一个事件
+func feed(b *errorBudget, clock *time.Time, mode *string, endpoint string, results string, step time.Duration) *EndpointEvent {
+	var first *EndpointEvent
+	for _, r := range results {
+		if event := b.record(mode, endpoint, r == '.'); event != nil && first == nil {
+			first = event
+		}
+		*clock = clock.Add(step)
+	}
+	return first
+}
+
+func TestErrorBudgetThreshold(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		results  string
+		switched bool
+	}{
+		{"all failures below min requests", "xxxxxxxxxxxxxxxxxxx", false},
+		{"exactly at threshold", "xxxx................", false},
+		{"just over threshold", "xxxxx...............", true},
+		{"healthy", "....................x.x.", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, clock := fakeBudget()
+			mode := "daily"
+			event := feed(b, clock, &mode, "daily", tc.results, time.Second)
+			if (event != nil) != tc.switched {
+				t.Fatalf("event = %+v, want switched %v", event, tc.switched)
+			}
+			if !tc.switched {
+				if mode != "daily" || b.status(mode).State != AutoFailoverMonitoring {
+					t.Errorf("mode = %s, status = %+v, want still monitoring daily", mode, b.status(mode))
+				}
+				return
+			}
+			want := EndpointEvent{Type: EndpointEventDowngraded, From: "daily", To: "production", Requests: 20, Errors: 5}
+			if *event != want {
+				t.Errorf("event = %+v, want %+v", *event, want)
+			}
+			if mode != "production" {
+				t.Errorf("mode = %s, want production", mode)
+			}
+			status := b.status(mode)
+			if status.State != AutoFailoverDegraded || status.DegradedFrom != "daily" || status.DegradedAt == nil || status.ProbationSince != nil {
+				t.Errorf("status = %+v", status)
+			}
+		})
+	}
+}
+
+func TestErrorBudgetWindow(t *testing.T) {
+	b, clock := fakeBudget()
+	mode := "daily"
+
+	// 早期的一批失败在窗口之外后不再计入
+	feed(b, clock, &mode, "daily", "xxxxxxxxxx", time.Second)
+	*clock = clock.Add(6 * time.Minute)
+	if event := feed(b, clock, &mode, "daily", "xx..................", time.Second); event != nil {
+		t.Fatalf("old failures counted: %+v", event)
+	}
+	if status := b.status(mode); status.WindowRequests != 20 || status.WindowErrors != 2 {
+		t.Errorf("window = %d/%d, want 2/20", status.WindowErrors, status.WindowRequests)
+	}
+
+	// 之后的失败与窗口内的请求累积到超出阈值时切换（6/27 > 20%）
+	event := feed(b, clock, &mode, "daily", "x.x.x.x.x.x.x.x.x.x.", 5*time.Second)
+	if event == nil || event.Requests != 27 || event.Errors != 6 {
+		t.Errorf("event = %+v, want 6/27 failed", event)
+	}
+}
+
+func TestErrorBudgetIgnoredResults(t *testing.T) {
+	b, clock := fakeBudget()
+
+	// 其他端点的结果（按权重分流前的残留请求等）不计入
+	mode := "daily"
+	if event := feed(b, clock, &mode, "autopush", "xxxxxxxxxxxxxxxxxxxxxxxxx", time.Second); event != nil || mode != "daily" {
+		t.Errorf("other endpoint results switched to %s: %+v", mode, event)
+	}
+
+	// 轮询、按权重分流和备用端点本身都不监控
+	for _, m := range []string{"round-robin", EndpointModeWeighted, "production"} {
+		mode := m
+		if event := feed(b, clock, &mode, m, "xxxxxxxxxxxxxxxxxxxxxxxxx", time.Second); event != nil || mode != m {
+			t.Errorf("%s: switched to %s", m, mode)
+		}
+		if state := b.status(m).State; state != AutoFailoverIdle {
+			t.Errorf("%s: state = %s, want idle", m, state)
+		}
+	}
+
+	// 切换监控的端点时重新统计
+	feed(b, clock, &mode, "daily", "xxxxxxxxxx", time.Second)
+	mode = "autopush"
+	if event := feed(b, clock, &mode, "autopush", "xxxxxxxxxx..........", time.Second); event == nil || event.Requests != 20 || event.From != "autopush" {
+		t.Errorf("event = %+v, want 10/20 on autopush", event)
+	}
+}
+
+func TestErrorBudgetProbation(t *testing.T) {
+	b, clock := fakeBudget()
+	mode := "daily"
+	feed(b, clock, &mode, "daily", "xxxxxxxxxxxxxxxxxxxx", time.Second)
+	if mode != "production" {
+		t.Fatalf("mode = %s, want production", mode)
+	}
+	// 降级期间备用端点的结果不计入
+	if event := feed(b, clock, &mode, "production", "xxxxxxxxxxxxxxxxxxxx", time.Second); event != nil {
+		t.Fatalf("fallback results triggered %+v", event)
+	}
+
+	probe := func(ok bool, after time.Duration) *EndpointEvent {
+		*clock = clock.Add(after)
+		return b.probe(&mode, ok)
+	}
+	probe(true, 0)
+	since := *b.status(mode).ProbationSince
+	if event := probe(true, 6*time.Minute); event != nil {
+		t.Fatalf("restored before probation: %+v", event)
+	}
+	// 探测失败重新开始观察期
+	probe(false, time.Minute)
+	if b.status(mode).ProbationSince != nil {
+		t.Fatal("failed probe did not reset probation")
+	}
+	probe(true, time.Minute)
+	if got := *b.status(mode).ProbationSince; !got.After(since) {
+		t.Errorf("probation restarted at %v, want after %v", got, since)
+	}
+	for i := 0; i < 9; i++ {
+		if event := probe(true, time.Minute); event != nil {
+			t.Fatalf("restored after %d minutes: %+v", i+1, event)
+		}
+	}
+	event := probe(true, time.Minute)
+	want := EndpointEvent{Type: EndpointEventRestored, From: "production", To: "daily", Requests: 11}
+	if event == nil || *event != want {
+		t.Fatalf("event = %+v, want %+v", event, want)
+	}
+	if mode != "daily" || b.status(mode).State != AutoFailoverMonitoring {
+		t.Errorf("mode = %s, status = %+v, want monitoring daily", mode, b.status(mode))
+	}
+
+	// 切回后重新统计，之前的失败不会立即再次触发切换
+	if status := b.status(mode); status.WindowRequests != 0 {
+		t.Errorf("window after restore = %+v, want empty", status)
+	}
+}
+
+func TestErrorBudgetProbationNeedsTwoProbes(t *testing.T) {
+	b, clock := fakeBudget()
+	b.policy.Probation = 0
+	mode := "daily"
+	feed(b, clock, &mode, "daily", "xxxxxxxxxxxxxxxxxxxx", time.Second)
+	if event := b.probe(&mode, true); event != nil {
+		t.Fatalf("restored after a single probe: %+v", event)
+	}
+	if event := b.probe(&mode, true); event == nil || mode != "daily" {
+		t.Errorf("event = %+v, mode = %s, want restored after two probes", event, mode)
+	}
+}
+
+func TestErrorBudgetManualOverride(t *testing.T) {
+	b, clock := fakeBudget()
+	mode := "daily"
+	feed(b, clock, &mode, "daily", "xxxxxxxxxxxxxxxxxxxx", time.Second)
+
+	// 降级期间手动改为其他模式：放弃降级，探测不再切回
+	mode = "autopush"
+	if event := b.probe(&mode, true); event != nil || b.degradedFrom != "" {
+		t.Errorf("probe after manual change: event %+v, degradedFrom %q", event, b.degradedFrom)
+	}
+
+	// pin 暂停自动切换
+	b.pin()
+	if event := feed(b, clock, &mode, "autopush", "xxxxxxxxxxxxxxxxxxxxxxxxx", time.Second); event != nil || mode != "autopush" {
+		t.Errorf("suspended budget switched: %+v", event)
+	}
+	if state := b.status(mode).State; state != AutoFailoverSuspended {
+		t.Errorf("state = %s, want suspended", state)
+	}
+
+	// 恢复后从当前模式重新统计
+	b.resume()
+	if status := b.status(mode); status.State != AutoFailoverMonitoring || status.WindowRequests != 0 {
+		t.Errorf("status after resume = %+v", status)
+	}
+	if event := feed(b, clock, &mode, "autopush", "xxxxxxxxxxxxxxxxxxxx", time.Second); event == nil || mode != "production" {
+		t.Errorf("event = %+v after resume, want switched to production", event)
+	}
+
+	// 降级期间 pin 同样放弃降级状态
+	b.pin()
+	if b.degradedFrom != "" || b.status(mode).State != AutoFailoverSuspended {
+		t.Errorf("pinned while degraded: %+v", b.status(mode))
+	}
+}
+
+func TestErrorBudgetSettingsRestore(t *testing.T) {
+	b, clock := fakeBudget()
+	if b.settings() != nil {
+		t.Fatal("idle budget persisted settings")
+	}
+	mode := "daily"
+	feed(b, clock, &mode, "daily", "xxxxxxxxxxxxxxxxxxxx", time.Second)
+	data, err := json.Marshal(b.settings())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var saved autoFailoverSettings
+	json.Unmarshal(data, &saved)
+	restored, _ := fakeBudget()
+	restored.restore(&saved, "production")
+	if status := restored.status("production"); status.State != AutoFailoverDegraded || status.DegradedFrom != "daily" || !status.DegradedAt.Equal(b.degradedAt) {
+		t.Errorf("restored status = %+v", status)
+	}
+
+	// 重启时模式已不是备用端点（如 ENDPOINT_MODE 覆盖），降级状态失效
+	restored.restore(&saved, "autopush")
+	if state := restored.status("autopush").State; state != AutoFailoverMonitoring {
+		t.Errorf("state = %s, want monitoring", state)
+	}
+
+	restored.restore(&autoFailoverSettings{Suspended: true, DegradedFrom: "daily"}, "production")
+	if status := restored.status("production"); status.State != AutoFailoverSuspended || restored.degradedFrom != "" {
+		t.Errorf("suspended restore = %+v", status)
+	}
+	restored.restore(nil, "daily")
+	if state := restored.status("daily").State; state != AutoFailoverMonitoring {
+		t.Errorf("state after nil restore = %s", state)
+	}
+}
+
+func TestErrorBudgetFromConfig(t *testing.T) {
+	base := Config{EndpointFallback: "production", EndpointErrorBudget: 20, EndpointBudgetWindow: 5, EndpointBudgetMinReqs: 20, EndpointProbation: 10}
+	b := errorBudgetFromConfig(&base)
+	if b == nil || b.policy != testPolicy {
+		t.Fatalf("policy = %+v, want %+v", b, testPolicy)
+	}
+	for name, change := range map[string]func(*Config){
+		"no fallback":      func(c *Config) { c.EndpointFallback = "" },
+		"unknown fallback": func(c *Config) { c.EndpointFallback = "staging" },
+		"no threshold":     func(c *Config) { c.EndpointErrorBudget = 0 },
+		"no window":        func(c *Config) { c.EndpointBudgetWindow = 0 },
+	} {
+		cfg := base
+		change(&cfg)
+		if b := errorBudgetFromConfig(&cfg); b != nil {
+			t.Errorf("%s: budget = %+v, want nil", name, b.policy)
+		}
+	}
+}
+
+// testEndpointManager 使用临时设置文件和伪时钟错误预算的端点管理器，捕获切换事件
+func testEndpointManager(t *testing.T) (*EndpointManager, *time.Time, *[]EndpointEvent) {
+	t.Helper()
+	b, clock := fakeBudget()
+	m := &EndpointManager{mode: "daily", settingsPath: filepath.Join(t.TempDir(), "settings.json"), budget: b}
+	var events []EndpointEvent
+	prev := endpointEventHook
+	SetEndpointEventHook(func(e EndpointEvent) { events = append(events, e) })
+	t.Cleanup(func() { endpointEventHook = prev })
+	return m, clock, &events
+}
+
+func TestEndpointManagerAutoFailover(t *testing.T) {
+	m, clock, events := testEndpointManager(t)
+
+	for i := 0; i < 20; i++ {
+		m.RecordResult("daily", i%2 == 0)
+		*clock = clock.Add(time.Second)
+	}
+	if m.GetMode() != "production" || len(*events) != 1 || (*events)[0].Type != EndpointEventDowngraded {
+		t.Fatalf("mode = %s, events = %+v", m.GetMode(), *events)
+	}
+	if ep, ok := m.ProbationEndpoint(); !ok || ep.Key != "daily" {
+		t.Errorf("probation endpoint = %+v, %v", ep, ok)
+	}
+
+	// 降级状态写入设置文件，重新加载后保持
+	data, err := os.ReadFile(m.settingsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := &EndpointManager{mode: "daily", settingsPath: m.settingsPath, budget: newErrorBudget(testPolicy)}
+	reloaded.loadSettings()
+	if status := reloaded.AutoFailoverStatus(); status.State != AutoFailoverDegraded || status.DegradedFrom != "daily" {
+		t.Errorf("reloaded status = %+v from %s", status, data)
+	}
+
+	m.RecordProbe(true)
+	*clock = clock.Add(11 * time.Minute)
+	m.RecordProbe(true)
+	if m.GetMode() != "daily" || len(*events) != 2 || (*events)[1].Type != EndpointEventRestored {
+		t.Errorf("mode = %s, events = %+v, want restored to daily", m.GetMode(), *events)
+	}
+	if _, ok := m.ProbationEndpoint(); ok {
+		t.Error("probation endpoint after restore")
+	}
+}
+
+func TestEndpointManagerManualModePins(t *testing.T) {
+	m, clock, events := testEndpointManager(t)
+
+	if err := m.SetMode("autopush"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		m.RecordResult("autopush", false)
+		*clock = clock.Add(time.Second)
+	}
+	if m.GetMode() != "autopush" || len(*events) != 0 || m.AutoFailoverStatus().State != AutoFailoverSuspended {
+		t.Fatalf("manual mode not pinned: mode %s, events %+v, status %+v", m.GetMode(), *events, m.AutoFailoverStatus())
+	}
+
+	if err := m.SetAutoFailover(true); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		m.RecordResult("autopush", false)
+	}
+	if m.GetMode() != "production" || len(*events) != 1 {
+		t.Errorf("after resume: mode %s, events %+v", m.GetMode(), *events)
+	}
+
+	if err := (&EndpointManager{mode: "daily"}).SetAutoFailover(true); err == nil {
+		t.Error("SetAutoFailover without a fallback succeeded")
+	}
+	if status := (&EndpointManager{mode: "daily"}).AutoFailoverStatus(); status.State != AutoFailoverDisabled {
+		t.Errorf("status without a fallback = %+v", status)
+	}
+}
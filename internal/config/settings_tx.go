@@ -0,0 +1,227 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 可在运行时修改的端点设置（PUT /admin/settings 的键）
+const (
+	SettingEndpointMode    = "ENDPOINT_MODE"
+	SettingEndpointWeights = "ENDPOINT_WEIGHTS"
+	SettingAutoFailover    = "ENDPOINT_AUTO_FAILOVER"
+	SettingUpstreamHeaders = "UPSTREAM_HEADERS"
+	SettingEndpointHeaders = "UPSTREAM_ENDPOINT_HEADERS"
+)
+
+// SettingsChange 一次事务性设置修改（nil 字段保持不变）
+type SettingsChange struct {
+	Mode            *string
+	Weights         map[string]int
+	AutoFailover    *bool
+	Headers         *map[string]string
+	EndpointHeaders *map[string]map[string]string
+}
+
+// SettingDiff 设置的变化
+type SettingDiff struct {
+	Key string      `json:"key"`
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// SettingError 单个设置的校验错误
+type SettingError struct {
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+// SettingErrors 设置校验失败（事务未应用任何修改）
+type SettingErrors []SettingError
+
+func (e SettingErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, err := range e {
+		parts[i] = err.Key + ": " + err.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// endpointState 端点设置的快照（事务的修改先作用于副本，校验通过后整体替换）
+type endpointState struct {
+	mode            string
+	weights         map[string]int
+	headers         map[string]string
+	endpointHeaders map[string]map[string]string
+	budget          errorBudget // 未配置自动切换时为零值
+}
+
+func (m *EndpointManager) snapshotLocked() endpointState {
+	s := endpointState{
+		mode:            m.mode,
+		weights:         m.weights,
+		headers:         m.headers,
+		endpointHeaders: m.endpointHeaders,
+	}
+	if m.budget != nil {
+		s.budget = *m.budget
+	}
+	return s
+}
+
+func (m *EndpointManager) restoreLocked(s endpointState) {
+	m.mode = s.mode
+	m.weights = s.weights
+	m.headers = s.headers
+	m.endpointHeaders = s.endpointHeaders
+	if m.budget != nil {
+		*m.budget = s.budget
+	}
+}
+
+// ApplySettings 校验并整体应用一组设置：任何一项校验失败（返回 SettingErrors）或写入设置文件失败时不修改任何状态。
+// dryRun 为 true 时只校验并返回变化。手动修改模式或权重会暂停自动切换（与 SetMode 一致），
+// 同一事务中设置 ENDPOINT_AUTO_FAILOVER 为 true 时在切换模式后恢复
+func (m *EndpointManager) ApplySettings(change SettingsChange, dryRun bool) ([]SettingDiff, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prev := m.snapshotLocked()
+	next := prev
+	var errs SettingErrors
+	fail := func(key, format string, args ...interface{}) {
+		errs = append(errs, SettingError{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if change.Weights != nil {
+		total := 0
+		next.weights = make(map[string]int, len(change.Weights))
+		for key, weight := range change.Weights {
+			switch {
+			case !isEndpoint(key):
+				fail(SettingEndpointWeights, "unknown endpoint: %s", key)
+			case weight < 0:
+				fail(SettingEndpointWeights, "weight for %s must not be negative", key)
+			case weight > 0:
+				next.weights[key] = weight
+				total += weight
+			}
+		}
+		if total <= 0 {
+			fail(SettingEndpointWeights, "at least one endpoint must have a positive weight")
+		}
+		// 与 SetWeights 一致：只设置权重时切换到按权重分流
+		if change.Mode == nil {
+			next.mode = EndpointModeWeighted
+		}
+	}
+	if change.Mode != nil {
+		next.mode = *change.Mode
+		switch {
+		case next.mode == EndpointModeWeighted:
+			if len(next.weights) == 0 {
+				fail(SettingEndpointMode, "mode weighted requires %s", SettingEndpointWeights)
+			}
+		case !validEndpointMode(next.mode):
+			fail(SettingEndpointMode, "unknown endpoint mode: %s", next.mode)
+		}
+	}
+	if change.Headers != nil {
+		next.headers = *change.Headers
+		checkHeaderNames(SettingUpstreamHeaders, next.headers, fail)
+	}
+	if change.EndpointHeaders != nil {
+		next.endpointHeaders = *change.EndpointHeaders
+		for ep, headers := range next.endpointHeaders {
+			if !isEndpoint(ep) {
+				fail(SettingEndpointHeaders, "unknown endpoint: %s", ep)
+			}
+			checkHeaderNames(SettingEndpointHeaders, headers, fail)
+		}
+	}
+
+	if m.budget != nil {
+		// 模式或权重实际发生变化才视为手动切换（重复提交当前值不暂停自动切换）
+		if next.mode != prev.mode || !reflect.DeepEqual(nonNilMap(next.weights), nonNilMap(prev.weights)) {
+			next.budget.pin()
+		}
+		if change.AutoFailover != nil {
+			if *change.AutoFailover {
+				next.budget.resume()
+			} else {
+				next.budget.pin()
+			}
+		}
+	} else if change.AutoFailover != nil {
+		fail(SettingAutoFailover, "automatic endpoint failover is not configured (set ENDPOINT_FALLBACK)")
+	}
+
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Key < errs[j].Key })
+		return nil, errs
+	}
+
+	diff := m.diffLocked(prev, next)
+	if dryRun || len(diff) == 0 {
+		return diff, nil
+	}
+
+	m.restoreLocked(next)
+	if change.Weights != nil {
+		m.stats = make(map[string]*EndpointStats)
+	}
+	if err := m.saveSettings(); err != nil {
+		// 写入失败时回滚内存中的状态，避免与设置文件不一致
+		m.restoreLocked(prev)
+		return nil, fmt.Errorf("save settings: %w", err)
+	}
+	return diff, nil
+}
+
+// diffLocked 比较两个快照，按键名排序返回变化
+func (m *EndpointManager) diffLocked(prev, next endpointState) []SettingDiff {
+	var diff []SettingDiff
+	add := func(key string, old, new interface{}) {
+		if !reflect.DeepEqual(old, new) {
+			diff = append(diff, SettingDiff{Key: key, Old: old, New: new})
+		}
+	}
+	add(SettingEndpointMode, prev.mode, next.mode)
+	add(SettingEndpointWeights, nonNilMap(prev.weights), nonNilMap(next.weights))
+	add(SettingUpstreamHeaders, nonNilMap(prev.headers), nonNilMap(next.headers))
+	add(SettingEndpointHeaders, nonNilMap(prev.endpointHeaders), nonNilMap(next.endpointHeaders))
+	if m.budget != nil {
+		add(SettingAutoFailover, !prev.budget.suspended, !next.budget.suspended)
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Key < diff[j].Key })
+	return diff
+}
+
+// nonNilMap 空 map 统一为非 nil（nil 与空 map 视为相同）
+func nonNilMap[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return map[K]V{}
+	}
+	return m
+}
+
+func isEndpoint(key string) bool {
+	_, ok := APIEndpoints[key]
+	return ok
+}
+
+// validEndpointMode 单个端点或轮询模式（按权重分流另行检查）
+func validEndpointMode(mode string) bool {
+	return isEndpoint(mode) || mode == "round-robin" || mode == "round-robin-dp"
+}
+
+// checkHeaderNames 请求头名称不能为空或包含空白、冒号
+func checkHeaderNames(key string, headers map[string]string, fail func(key, format string, args ...interface{})) {
+	for name := range headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			fail(key, "invalid header name %q", name)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// settingsManager 使用临时设置文件的端点管理器（未配置自动切换）
+func settingsManager(t *testing.T) *EndpointManager {
+	t.Helper()
+	return &EndpointManager{mode: "daily", settingsPath: filepath.Join(t.TempDir(), "settings.json")}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// errorKeys 校验错误的键（按返回顺序）
+func errorKeys(t *testing.T, err error) []string {
+	t.Helper()
+	errs, ok := err.(SettingErrors)
+	if !ok {
+		t.Fatalf("err = %v, want SettingErrors", err)
+	}
+	keys := make([]string, len(errs))
+	for i, e := range errs {
+		keys[i] = e.Key
+	}
+	return keys
+}
+
+func TestApplySettingsRejectsInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change SettingsChange
+		keys   []string
+	}{
+		{"weighted without weights", SettingsChange{Mode: ptr(EndpointModeWeighted)}, []string{SettingEndpointMode}},
+		{"unknown mode", SettingsChange{Mode: ptr("staging")}, []string{SettingEndpointMode}},
+		{"unknown weight endpoint", SettingsChange{Weights: map[string]int{"daily": 1, "staging": 1}}, []string{SettingEndpointWeights}},
+		{"negative weight", SettingsChange{Weights: map[string]int{"daily": 2, "production": -1}}, []string{SettingEndpointWeights}},
+		{"no positive weight", SettingsChange{Weights: map[string]int{"daily": 0}}, []string{SettingEndpointWeights}},
+		{"empty weights", SettingsChange{Weights: map[string]int{}}, []string{SettingEndpointWeights}},
+		// 权重无效时同一事务中的 weighted 模式同样报告
+		{"weighted with invalid weights", SettingsChange{Mode: ptr(EndpointModeWeighted), Weights: map[string]int{"daily": 0}}, []string{SettingEndpointMode, SettingEndpointWeights}},
+		{"invalid header name", SettingsChange{Headers: &map[string]string{"X Bad": "1"}}, []string{SettingUpstreamHeaders}},
+		{"unknown header endpoint", SettingsChange{EndpointHeaders: &map[string]map[string]string{"staging": {"X-A": "1"}}}, []string{SettingEndpointHeaders}},
+		{"invalid endpoint header name", SettingsChange{EndpointHeaders: &map[string]map[string]string{"daily": {"X:A": "1"}}}, []string{SettingEndpointHeaders}},
+		{"auto failover not configured", SettingsChange{AutoFailover: ptr(true)}, []string{SettingAutoFailover}},
+		// 所有错误一起返回，按键排序
+		{"several keys", SettingsChange{
+			Mode:         ptr("staging"),
+			Headers:      &map[string]string{"": "x"},
+			AutoFailover: ptr(false),
+		}, []string{SettingAutoFailover, SettingEndpointMode, SettingUpstreamHeaders}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := settingsManager(t)
+			m.headers = map[string]string{"X-Keep": "1"}
+			before := m.snapshotLocked()
+
+			diff, err := m.ApplySettings(tc.change, false)
+			if diff != nil {
+				t.Errorf("diff = %+v, want none", diff)
+			}
+			if got := errorKeys(t, err); !reflect.DeepEqual(got, tc.keys) {
+				t.Errorf("error keys = %v (%v), want %v", got, err, tc.keys)
+			}
+			// 失败的事务不修改任何设置，也不写入设置文件
+			if after := m.snapshotLocked(); !reflect.DeepEqual(after, before) {
+				t.Errorf("state changed: %+v -> %+v", before, after)
+			}
+			if _, err := os.Stat(m.settingsPath); !os.IsNotExist(err) {
+				t.Errorf("settings file written: %v", err)
+			}
+		})
+	}
+}
+
+func TestApplySettingsTransaction(t *testing.T) {
+	m := settingsManager(t)
+	change := SettingsChange{
+		Mode:            ptr(EndpointModeWeighted),
+		Weights:         map[string]int{"daily": 3, "production": 1, "autopush": 0},
+		Headers:         &map[string]string{"X-Client": "a"},
+		EndpointHeaders: &map[string]map[string]string{"production": {"X-Env": "prod"}},
+	}
+
+	// dry run 返回变化但不应用
+	diff, err := m.ApplySettings(change, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKeys := []string{SettingEndpointMode, SettingEndpointWeights, SettingEndpointHeaders, SettingUpstreamHeaders}
+	if got := diffKeys(diff); !reflect.DeepEqual(got, wantKeys) {
+		t.Errorf("dry run diff keys = %v, want %v", got, wantKeys)
+	}
+	if m.mode != "daily" || m.weights != nil || m.headers != nil {
+		t.Errorf("dry run applied: mode %s, weights %v, headers %v", m.mode, m.weights, m.headers)
+	}
+	if _, err := os.Stat(m.settingsPath); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote the settings file: %v", err)
+	}
+
+	applied, err := m.ApplySettings(change, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, diff) {
+		t.Errorf("applied diff = %+v, want the dry run diff %+v", applied, diff)
+	}
+	// 权重为 0 的端点不保留
+	if m.mode != EndpointModeWeighted || !reflect.DeepEqual(m.weights, map[string]int{"daily": 3, "production": 1}) {
+		t.Errorf("mode %s, weights %v", m.mode, m.weights)
+	}
+	reloaded := &EndpointManager{settingsPath: m.settingsPath}
+	reloaded.loadSettings()
+	if reloaded.mode != EndpointModeWeighted || reloaded.headers["X-Client"] != "a" || reloaded.endpointHeaders["production"]["X-Env"] != "prod" {
+		t.Errorf("saved settings: mode %s, headers %v, endpoint headers %v", reloaded.mode, reloaded.headers, reloaded.endpointHeaders)
+	}
+
+	// 重复提交当前值没有变化
+	if diff, err := m.ApplySettings(change, false); err != nil || len(diff) != 0 {
+		t.Errorf("repeated change: diff %+v, err %v", diff, err)
+	}
+
+	// 只设置权重时切换到按权重分流
+	m.mode = "daily"
+	diff, err = m.ApplySettings(SettingsChange{Weights: map[string]int{"autopush": 1}}, false)
+	if err != nil || m.mode != EndpointModeWeighted || !reflect.DeepEqual(diffKeys(diff), []string{SettingEndpointMode, SettingEndpointWeights}) {
+		t.Errorf("weights only: mode %s, diff %+v, err %v", m.mode, diff, err)
+	}
+}
+
+func TestApplySettingsRollsBackOnSaveFailure(t *testing.T) {
+	m := settingsManager(t)
+	// 设置文件的目录是一个普通文件，写入失败
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.settingsPath = filepath.Join(blocker, "settings.json")
+	m.budget = newErrorBudget(testPolicy)
+	before := comparableState(m.snapshotLocked())
+
+	_, err := m.ApplySettings(SettingsChange{Mode: ptr("autopush"), Headers: &map[string]string{"X-A": "1"}}, false)
+	if err == nil {
+		t.Fatal("ApplySettings succeeded with an unwritable settings file")
+	}
+	if _, ok := err.(SettingErrors); ok {
+		t.Errorf("save failure reported as a validation error: %v", err)
+	}
+	if after := comparableState(m.snapshotLocked()); !reflect.DeepEqual(after, before) {
+		t.Errorf("state not rolled back: %+v -> %+v", before, after)
+	}
+	if m.budget.suspended {
+		t.Error("auto failover stayed suspended after the rollback")
+	}
+}
+
+func TestApplySettingsAutoFailover(t *testing.T) {
+	m, _, _ := testEndpointManager(t)
+
+	// 重复提交当前模式不视为手动切换
+	diff, err := m.ApplySettings(SettingsChange{Mode: ptr("daily")}, false)
+	if err != nil || len(diff) != 0 || m.budget.suspended {
+		t.Fatalf("same mode: diff %+v, err %v, suspended %v", diff, err, m.budget.suspended)
+	}
+
+	// 修改模式暂停自动切换
+	diff, err = m.ApplySettings(SettingsChange{Mode: ptr("autopush")}, false)
+	if err != nil || !m.budget.suspended {
+		t.Fatalf("mode change: err %v, suspended %v", err, m.budget.suspended)
+	}
+	if got := diffKeys(diff); !reflect.DeepEqual(got, []string{SettingAutoFailover, SettingEndpointMode}) {
+		t.Errorf("diff keys = %v", got)
+	}
+
+	// 同一事务中切换模式并恢复自动切换
+	if _, err := m.ApplySettings(SettingsChange{Mode: ptr("daily"), AutoFailover: ptr(true)}, false); err != nil {
+		t.Fatal(err)
+	}
+	if m.mode != "daily" || m.budget.suspended || m.AutoFailoverStatus().State != AutoFailoverMonitoring {
+		t.Errorf("mode %s, status %+v, want monitoring daily", m.mode, m.AutoFailoverStatus())
+	}
+
+	// 校验失败时自动切换状态同样不变
+	if _, err := m.ApplySettings(SettingsChange{Mode: ptr("staging"), AutoFailover: ptr(false)}, false); err == nil {
+		t.Fatal("invalid mode accepted")
+	}
+	if m.budget.suspended {
+		t.Error("failed transaction suspended auto failover")
+	}
+}
+
+// comparableState 去掉时钟函数后的快照（函数值不能用 DeepEqual 比较）
+func comparableState(s endpointState) endpointState {
+	s.budget.now = nil
+	return s
+}
+
+func diffKeys(diff []SettingDiff) []string {
+	keys := make([]string, len(diff))
+	for i, d := range diff {
+		keys[i] = d.Key
+	}
+	return keys
+}
@@ -0,0 +1,94 @@
+package converter
+
+import (
+	"fmt"
+	"time"
+)
+
+// AnthropicModelsResponse Anthropic 模型列表响应（GET /v1/models，带 anthropic-version 请求头）
+type AnthropicModelsResponse struct {
+	Data    []AnthropicModel `json:"data"`
+	HasMore bool             `json:"has_more"`
+	FirstID *string          `json:"first_id"`
+	LastID  *string          `json:"last_id"`
+}
+
+// AnthropicModel Anthropic 模型
+type AnthropicModel struct {
+	Type        string `json:"type"` // model
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	CreatedAt   string `json:"created_at"` // RFC 3339
+}
+
+// Anthropic 模型列表分页
+const (
+	AnthropicModelsDefaultLimit = 20
+	AnthropicModelsMaxLimit     = 1000
+)
+
+// modelsCreatedAt 注册表中的模型没有发布时间，created_at 统一使用进程启动时间
+var modelsCreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+// GetAnthropicModels 获取 Anthropic 格式的模型列表（beforeID/afterID 为游标，最多指定一个）
+func GetAnthropicModels(limit int, beforeID, afterID string) (*AnthropicModelsResponse, error) {
+	if beforeID != "" && afterID != "" {
+		return nil, fmt.Errorf("before_id and after_id cannot both be set")
+	}
+	if limit <= 0 {
+		limit = AnthropicModelsDefaultLimit
+	}
+	if limit > AnthropicModelsMaxLimit {
+		limit = AnthropicModelsMaxLimit
+	}
+
+	all := ModelsWithLimits()
+	indexOf := func(id string) (int, error) {
+		for i, m := range all {
+			if m.ID == id {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("unknown model id %q", id)
+	}
+
+	start, end := 0, len(all)
+	switch {
+	case afterID != "":
+		i, err := indexOf(afterID)
+		if err != nil {
+			return nil, err
+		}
+		start = i + 1
+		end = min(start+limit, len(all))
+	case beforeID != "":
+		i, err := indexOf(beforeID)
+		if err != nil {
+			return nil, err
+		}
+		end = i
+		start = max(end-limit, 0)
+	default:
+		end = min(limit, len(all))
+	}
+
+	resp := &AnthropicModelsResponse{Data: make([]AnthropicModel, 0, end-start)}
+	for _, m := range all[start:end] {
+		resp.Data = append(resp.Data, AnthropicModel{
+			Type:        "model",
+			ID:          m.ID,
+			DisplayName: ModelDisplayName(m.ID),
+			CreatedAt:   modelsCreatedAt,
+		})
+	}
+	if beforeID != "" {
+		resp.HasMore = start > 0
+	} else {
+		resp.HasMore = end < len(all)
+	}
+	if len(resp.Data) > 0 {
+		first, last := resp.Data[0].ID, resp.Data[len(resp.Data)-1].ID
+		resp.FirstID, resp.LastID = &first, &last
+	}
+	return resp, nil
+}
@@ -0,0 +1,98 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"anti2api-golang/internal/utils"
+)
+
+// spliceThreshold 超过该长度的 InlineData 直接拼接进请求体，不经过 JSON 编码
+const spliceThreshold = 64 * 1024
+
+// NewRequestBody 构建上游请求体
+// 大体积的 InlineData（base64 不含需要转义的字符）以占位符编码后原样拼接，
+// 避免 json.Marshal 为每张图片再复制一份数据
+func NewRequestBody(req *AntigravityRequest) (io.Reader, int64, error) {
+	shallow := *req
+	placeholders := make(map[string]string)
+
+	shallow.Request.Contents = make([]Content, len(req.Request.Contents))
+	for i, content := range req.Request.Contents {
+		shallow.Request.Contents[i] = content
+
+		var parts []Part
+		for j, part := range content.Parts {
+			if part.InlineData == nil || len(part.InlineData.Data) < spliceThreshold || !isSpliceSafe(part.InlineData.Data) {
+				continue
+			}
+			if parts == nil {
+				parts = make([]Part, len(content.Parts))
+				copy(parts, content.Parts)
+			}
+			key := "@@inline-" + utils.GenerateSecureToken(8) + "@@"
+			placeholders[key] = part.InlineData.Data
+			parts[j].InlineData = &InlineData{MimeType: part.InlineData.MimeType, Data: key}
+		}
+		if parts != nil {
+			shallow.Request.Contents[i].Parts = parts
+		}
+	}
+
+	data, err := json.Marshal(&shallow)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(placeholders) == 0 {
+		return bytes.NewReader(data), int64(len(data)), nil
+	}
+
+	var readers []io.Reader
+	var size int64
+	rest := data
+	for len(rest) > 0 {
+		start := bytes.Index(rest, []byte("@@inline-"))
+		if start == -1 {
+			break
+		}
+		end := bytes.Index(rest[start+len("@@inline-"):], []byte("@@"))
+		if end == -1 {
+			break
+		}
+		end += start + len("@@inline-") + len("@@")
+
+		payload, ok := placeholders[string(rest[start:end])]
+		if !ok {
+			// 不是占位符（如用户文本中的 "@@inline-"），结尾的 "@@" 可能是真正占位符的开头
+			skip := start + len("@@inline-")
+			readers = append(readers, bytes.NewReader(rest[:skip]))
+			size += int64(skip)
+			rest = rest[skip:]
+			continue
+		}
+
+		readers = append(readers, bytes.NewReader(rest[:start]), strings.NewReader(payload))
+		size += int64(start) + int64(len(payload))
+		rest = rest[end:]
+	}
+	readers = append(readers, bytes.NewReader(rest))
+	size += int64(len(rest))
+
+	return io.MultiReader(readers...), size, nil
+}
+
+// isSpliceSafe 检查数据是否只包含无需 JSON 转义的 base64 字符
+func isSpliceSafe(data string) bool {
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '+', c == '/', c == '=', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// readBody 读出 NewRequestBody 的结果并校验声明的长度
+func readBody(t testing.TB, req *AntigravityRequest) []byte {
+	t.Helper()
+	r, size, err := NewRequestBody(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != size {
+		t.Fatalf("declared size %d, actual %d", size, len(data))
+	}
+	return data
+}
+
+func imageData(n int) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xfb, 0x01, 0x7c}, n/4))
+}
+
+func TestNewRequestBodyMatchesMarshal(t *testing.T) {
+	image := imageData(spliceThreshold * 2)
+	tests := []struct {
+		name  string
+		parts []Part
+	}{
+		{"text only", []Part{{Text: "hello"}}},
+		{"small image", []Part{{InlineData: &InlineData{MimeType: "image/png", Data: "aGVsbG8="}}}},
+		{"large image", []Part{{Text: "look"}, {InlineData: &InlineData{MimeType: "image/png", Data: image}}}},
+		{"two images", []Part{
+			{InlineData: &InlineData{MimeType: "image/png", Data: image}},
+			{InlineData: &InlineData{MimeType: "image/jpeg", Data: image[:len(image)-4]}},
+		}},
+		// 用户文本中的 "@@inline-" 后紧跟真正的占位符：找到的 "@@" 是占位符的开头，不能跳过
+		{"marker before placeholder", []Part{{Text: "@@inline-"}, {InlineData: &InlineData{MimeType: "image/png", Data: image}}}},
+		{"marker with suffix", []Part{{Text: "see @@inline-abc"}, {InlineData: &InlineData{MimeType: "image/png", Data: image}}}},
+		{"unterminated marker", []Part{{InlineData: &InlineData{MimeType: "image/png", Data: image}}, {Text: "tail @@inline-"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &AntigravityRequest{Project: "p", Model: "m"}
+			req.Request.Contents = []Content{{Role: "user", Parts: tt.parts}}
+			want, err := json.Marshal(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readBody(t, req); !bytes.Equal(got, want) {
+				t.Errorf("spliced body differs from json.Marshal (len %d vs %d)", len(got), len(want))
+			}
+			// 原请求不被修改
+			for i, p := range req.Request.Contents[0].Parts {
+				if p.InlineData != nil && strings.HasPrefix(p.InlineData.Data, "@@inline-") {
+					t.Errorf("part %d of the original request was replaced by a placeholder", i)
+				}
+			}
+		})
+	}
+}
+
+// chatRequestBody 带一张 size 字节（base64 后）图片的 OpenAI 请求体
+func chatRequestBody(size int) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"model": "gemini-2.5-flash",
+		"messages": []interface{}{
+			map[string]interface{}{"role": "user", "content": []interface{}{
+				map[string]interface{}{"type": "text", "text": "describe"},
+				map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{
+					"url": "data:image/png;base64," + imageData(size),
+				}},
+			}},
+		},
+	})
+	return body
+}
+
+// BenchmarkImageRequest 解码、转换、构建上游请求体的完整路径（B/op 与请求体大小对比）
+func BenchmarkImageRequest(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		size int
+	}{{"1MB", 1 << 20}, {"50MB", 50 << 20}} {
+		body := chatRequestBody(tc.size)
+		account := &store.Account{ProjectID: "project"}
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				req, err := DecodeOpenAIChatRequest(bytes.NewReader(body))
+				if err != nil {
+					b.Fatal(err)
+				}
+				r, _, err := NewRequestBody(ConvertOpenAIToAntigravity(req, account))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(io.Discard, r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkNewRequestBody 只测量上游请求体的构建（图片数据直接拼接）
+func BenchmarkNewRequestBody(b *testing.B) {
+	req := &AntigravityRequest{Project: "p", Model: "m"}
+	req.Request.Contents = []Content{{Role: "user", Parts: []Part{
+		{Text: "describe"},
+		{InlineData: &InlineData{MimeType: "image/png", Data: imageData(8 << 20)}},
+	}}}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(req.Request.Contents[0].Parts[1].InlineData.Data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, _, err := NewRequestBody(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package converter
+
+import "strings"
+
+// minThinkingBudget 压缩思考预算时保留的下限（Claude 要求 budget_tokens ≥ 1024）
+const minThinkingBudget = 1024
+
+// reasoningEffortBudgets reasoning_effort 对应的思考预算（none 关闭思考）
+var reasoningEffortBudgets = map[string]int{
+	"minimal": 1024,
+	"low":     4096,
+	"medium":  12288,
+	"high":    32768,
+}
+
+// 思考预算来源
+const (
+	ThinkingFromRequest = "thinking_budget"
+	ThinkingFromEffort  = "reasoning_effort"
+	ThinkingFromModel   = "model"
+)
+
+// TokenBudget 回答与思考 Token 预算的计算过程（高调试级别时记录到日志详情）
+type TokenBudget struct {
+	Answer          int    `json:"answer"`                   // 回答预算（max_completion_tokens 或 max_tokens，0 为未限制）
+	Thinking        int    `json:"thinking"`                 // 思考预算（0 为未开启或由后端决定）
+	ThinkingSource  string `json:"thinkingSource,omitempty"` // 思考预算来源
+	CountsThinking  bool   `json:"countsThinking"`           // 后端的 maxOutputTokens 是否包含思考 Token
+	ModelLimit      int    `json:"modelLimit,omitempty"`     // 模型配置的输出上限
+	MaxOutputTokens int    `json:"maxOutputTokens"`          // 最终发送的 maxOutputTokens
+	Adjusted        string `json:"adjusted,omitempty"`       // 超出上限时的调整说明
+}
+
+// answerBudget 回答预算，max_completion_tokens 优先于 max_tokens
+func (req *OpenAIChatRequest) answerBudget() (int, string) {
+	if req.MaxCompletionTokens > 0 {
+		return req.MaxCompletionTokens, "max_completion_tokens"
+	}
+	return req.MaxTokens, "max_tokens"
+}
+
+// thinkingBudget 按请求中的 thinking_budget、reasoning_effort 或模型配置确定思考预算，
+// 请求关闭思考时返回 false。请求的预算超出模型上限时截断
+func thinkingBudget(req *OpenAIChatRequest, cfg ModelConfig, issues *ConversionResult) (int, string, bool) {
+	if req.ThinkingBudget != nil {
+		if *req.ThinkingBudget < 0 {
+			issues.fail(IssueInvalidParam, "thinking_budget", "thinking_budget must not be negative")
+			return 0, "", false
+		}
+		return capThinkingBudget(*req.ThinkingBudget, cfg, "thinking_budget", issues), ThinkingFromRequest, *req.ThinkingBudget > 0
+	}
+	if effort := strings.ToLower(req.ReasoningEffort); effort != "" {
+		if effort == "none" {
+			return 0, ThinkingFromEffort, false
+		}
+		budget, ok := reasoningEffortBudgets[effort]
+		if !ok {
+			issues.fail(IssueInvalidParam, "reasoning_effort", "reasoning_effort must be one of none, minimal, low, medium, high")
+			return 0, "", false
+		}
+		return capThinkingBudget(budget, cfg, "reasoning_effort", issues), ThinkingFromEffort, true
+	}
+	return cfg.EffectiveThinkingBudget(), ThinkingFromModel, true
+}
+
+// capThinkingBudget 将请求的思考预算限制在模型支持的上限内
+func capThinkingBudget(budget int, cfg ModelConfig, param string, issues *ConversionResult) int {
+	if limit := cfg.EffectiveMaxThinkingBudget(); limit > 0 && budget > limit {
+		issues.note(IssueParamNormalized, param, "thinking budget %d capped at the model limit %d", budget, limit)
+		return limit
+	}
+	return budget
+}
+
+// planTokenBudget 计算 maxOutputTokens 和思考预算：后端把思考计入 maxOutputTokens 时在回答预算上加上思考预算，
+// 超出模型上限时优先保留回答预算、压缩思考预算。thinking 为 false 时只计算回答预算，返回的预算中 Thinking 为 0
+func planTokenBudget(req *OpenAIChatRequest, cfg ModelConfig, thinking bool, issues *ConversionResult) (*TokenBudget, bool) {
+	answer, answerParam := req.answerBudget()
+	b := &TokenBudget{
+		Answer:         answer,
+		CountsThinking: cfg.EffectiveThinkingInOutput(),
+		ModelLimit:     cfg.EffectiveMaxOutputTokens(),
+	}
+	if thinking {
+		b.Thinking, b.ThinkingSource, thinking = thinkingBudget(req, cfg, issues)
+		if !thinking {
+			b.Thinking = 0
+		}
+	} else if req.ThinkingBudget != nil {
+		issues.note(IssueParamNormalized, "thinking_budget", "thinking_budget ignored: thinking is not enabled for %s", req.Model)
+	} else if req.ReasoningEffort != "" {
+		issues.note(IssueParamNormalized, "reasoning_effort", "reasoning_effort ignored: thinking is not enabled for %s", req.Model)
+	}
+	addThinking := thinking && b.CountsThinking && b.Thinking > 0
+
+	b.MaxOutputTokens = answer
+	if answer > 0 && addThinking {
+		b.MaxOutputTokens = answer + b.Thinking
+	}
+	if b.MaxOutputTokens == 0 {
+		b.MaxOutputTokens = b.ModelLimit
+	}
+
+	if limit := b.ModelLimit; limit > 0 && b.MaxOutputTokens > limit {
+		b.MaxOutputTokens = limit
+		if answer > 0 && addThinking {
+			// 优先保证回答预算，思考预算压缩到剩余部分（至少保留下限）
+			thinkingLeft := limit - answer
+			if thinkingLeft < minThinkingBudget {
+				thinkingLeft = min(minThinkingBudget, limit/2)
+			}
+			b.Adjusted = "thinking budget reduced to fit model limit"
+			issues.note(IssueParamNormalized, answerParam, "thinking budget %d reduced to %d: %s %d plus thinking exceeds the model limit %d",
+				b.Thinking, thinkingLeft, answerParam, answer, limit)
+			b.Thinking = thinkingLeft
+		} else {
+			b.Adjusted = "answer budget capped at model limit"
+			issues.note(IssueParamNormalized, answerParam, "%s %d capped at the model limit %d", answerParam, answer, limit)
+		}
+	}
+	if addThinking && b.MaxOutputTokens > 0 && b.Thinking >= b.MaxOutputTokens {
+		// 思考预算不能占满全部输出
+		b.Thinking = b.MaxOutputTokens / 2
+		b.Adjusted = "thinking budget reduced below maxOutputTokens"
+	}
+	return b, thinking
+}
@@ -0,0 +1,207 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// separateModel 测试用的模型：思考 Token 不计入 maxOutputTokens
+const separateModel = "gemini-budget-test-thinking"
+
+// useSeparateAccounting 为 separateModel 配置独立计算思考预算的后端
+func useSeparateAccounting(t *testing.T) {
+	t.Helper()
+	limit, thinking, counts := 65536, 8192, false
+	useModelConfig(t, separateModel, ModelConfig{MaxOutputTokens: &limit, ThinkingBudget: &thinking, ThinkingInOutput: &counts})
+}
+
+// budgetRequest model 的请求，extra 为附加的 JSON 字段
+func budgetRequest(model, extra string) string {
+	body := fmt.Sprintf(`{"model":%q,"messages":[{"role":"user","content":"hi"}]`, model)
+	if extra != "" {
+		body += "," + extra
+	}
+	return body + "}"
+}
+
+// convertBudget 转换请求，返回生成配置、预算计算过程和转换问题
+func convertBudget(t *testing.T, body string) (*GenerationConfig, *TokenBudget, *ConversionResult) {
+	t.Helper()
+	req, converted := convertChat(t, body)
+	return converted.Request.GenerationConfig, req.TokenBudget, CheckConversion(req)
+}
+
+// thinkingBudgetOf 发送的思考预算，未开启思考时为 -1
+func thinkingBudgetOf(gen *GenerationConfig) int {
+	if gen.ThinkingConfig == nil {
+		return -1
+	}
+	return gen.ThinkingConfig.ThinkingBudget
+}
+
+func TestTokenBudgetThinkingCountedInOutput(t *testing.T) {
+	useStrictConversion(t, false)
+	const model = "claude-sonnet-4-5-thinking" // 上限 64000，默认思考预算 32000
+
+	tests := []struct {
+		name      string
+		extra     string
+		maxOutput int
+		thinking  int // -1 表示关闭思考
+		answer    int
+		source    string
+	}{
+		// 回答预算加上思考预算，回答不会被思考挤占
+		{"max_tokens", `"max_tokens":500`, 32500, 32000, 500, ThinkingFromModel},
+		{"max_completion_tokens wins", `"max_tokens":9000,"max_completion_tokens":500`, 32500, 32000, 500, ThinkingFromModel},
+		{"reasoning_effort", `"max_tokens":500,"reasoning_effort":"low"`, 4596, 4096, 500, ThinkingFromEffort},
+		{"thinking_budget wins", `"max_tokens":500,"reasoning_effort":"high","thinking_budget":2000`, 2500, 2000, 500, ThinkingFromRequest},
+		// 未限制回答时使用模型上限
+		{"no answer limit", ``, 64000, 32000, 0, ThinkingFromModel},
+		{"effort none", `"max_tokens":500,"reasoning_effort":"none"`, 500, -1, 500, ThinkingFromEffort},
+		{"thinking_budget zero", `"max_tokens":500,"thinking_budget":0`, 500, -1, 500, ThinkingFromRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, budget, result := convertBudget(t, budgetRequest(model, tt.extra))
+			if gen.MaxOutputTokens != tt.maxOutput || thinkingBudgetOf(gen) != tt.thinking {
+				t.Fatalf("maxOutputTokens = %d, thinking = %d, want %d, %d", gen.MaxOutputTokens, thinkingBudgetOf(gen), tt.maxOutput, tt.thinking)
+			}
+			if !budget.CountsThinking || budget.Answer != tt.answer || budget.MaxOutputTokens != gen.MaxOutputTokens || budget.ModelLimit != 64000 {
+				t.Errorf("budget = %+v", budget)
+			}
+			if tt.thinking >= 0 && (budget.Thinking != tt.thinking || budget.ThinkingSource != tt.source) {
+				t.Errorf("budget thinking = %d from %q", budget.Thinking, budget.ThinkingSource)
+			}
+			if tt.thinking < 0 && budget.Thinking != 0 {
+				t.Errorf("budget thinking = %d with thinking disabled", budget.Thinking)
+			}
+			if err := result.Err(); err != nil || budget.Adjusted != "" {
+				t.Errorf("err = %v, adjusted = %q", err, budget.Adjusted)
+			}
+		})
+	}
+}
+
+func TestTokenBudgetSqueezesThinkingAtModelLimit(t *testing.T) {
+	useStrictConversion(t, true) // 调整只是说明，严格模式下也不拒绝
+	const model = "claude-sonnet-4-5-thinking"
+
+	tests := []struct {
+		answer   int
+		thinking int
+	}{
+		{60000, 4000}, // 回答预算保留，思考预算压缩到剩余部分
+		{63500, 1024}, // 剩余部分不足下限时保留下限
+		{64000, 1024}, // 回答预算等于上限
+		{90000, 1024}, // 回答预算超出上限
+	}
+	for _, tt := range tests {
+		gen, budget, result := convertBudget(t, budgetRequest(model, fmt.Sprintf(`"max_tokens":%d`, tt.answer)))
+		if gen.MaxOutputTokens != 64000 || thinkingBudgetOf(gen) != tt.thinking {
+			t.Errorf("max_tokens %d: maxOutputTokens = %d, thinking = %d, want 64000, %d", tt.answer, gen.MaxOutputTokens, thinkingBudgetOf(gen), tt.thinking)
+		}
+		if budget.Answer != tt.answer || !strings.Contains(budget.Adjusted, "thinking budget reduced") {
+			t.Errorf("max_tokens %d: budget = %+v", tt.answer, budget)
+		}
+		if result.Err() != nil || len(result.Issues) != 1 || result.Issues[0].Code != IssueParamNormalized || result.Issues[0].Param != "max_tokens" {
+			t.Errorf("max_tokens %d: issues = %+v", tt.answer, result.Issues)
+		}
+	}
+}
+
+func TestTokenBudgetThinkingSeparateFromOutput(t *testing.T) {
+	useStrictConversion(t, false)
+	useSeparateAccounting(t)
+
+	tests := []struct {
+		name      string
+		extra     string
+		maxOutput int
+		thinking  int
+		adjusted  string
+	}{
+		// 思考不占用 maxOutputTokens，回答预算原样发送
+		{"max_tokens", `"max_tokens":500`, 500, 8192, ""},
+		{"max_completion_tokens", `"max_completion_tokens":500`, 500, 8192, ""},
+		{"thinking larger than answer", `"max_tokens":500,"reasoning_effort":"high"`, 500, 32768, ""},
+		{"no answer limit", ``, 65536, 8192, ""},
+		// 只有回答预算受上限约束，思考预算不变
+		{"answer over limit", `"max_tokens":70000,"thinking_budget":4000`, 65536, 4000, "answer budget capped at model limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, budget, _ := convertBudget(t, budgetRequest(separateModel, tt.extra))
+			if gen.MaxOutputTokens != tt.maxOutput || thinkingBudgetOf(gen) != tt.thinking {
+				t.Fatalf("maxOutputTokens = %d, thinking = %d, want %d, %d", gen.MaxOutputTokens, thinkingBudgetOf(gen), tt.maxOutput, tt.thinking)
+			}
+			if budget.CountsThinking || budget.Thinking != tt.thinking || budget.Adjusted != tt.adjusted {
+				t.Errorf("budget = %+v", budget)
+			}
+		})
+	}
+}
+
+func TestTokenBudgetAccountingFollowsRegistry(t *testing.T) {
+	useStrictConversion(t, false)
+	body := budgetRequest(separateModel, `"max_tokens":500`)
+
+	// 默认按包含思考计算
+	if gen, budget, _ := convertBudget(t, body); gen.MaxOutputTokens != 500+1024 || !budget.CountsThinking {
+		t.Fatalf("default accounting: maxOutputTokens = %d, budget = %+v", gen.MaxOutputTokens, budget)
+	}
+	useSeparateAccounting(t)
+	if gen, budget, _ := convertBudget(t, body); gen.MaxOutputTokens != 500 || budget.CountsThinking {
+		t.Fatalf("separate accounting: maxOutputTokens = %d, budget = %+v", gen.MaxOutputTokens, budget)
+	}
+}
+
+func TestTokenBudgetCapsRequestedThinking(t *testing.T) {
+	useStrictConversion(t, false)
+	maxThinking := 2048
+	useModelConfig(t, "claude-sonnet-4-5-thinking", ModelConfig{MaxThinkingBudget: &maxThinking})
+
+	for _, extra := range []string{`"reasoning_effort":"high"`, `"thinking_budget":50000`} {
+		gen, budget, result := convertBudget(t, budgetRequest("claude-sonnet-4-5-thinking", `"max_tokens":500,`+extra))
+		if thinkingBudgetOf(gen) != 2048 || gen.MaxOutputTokens != 2548 || budget.Thinking != 2048 {
+			t.Errorf("%s: thinking = %d, maxOutputTokens = %d", extra, thinkingBudgetOf(gen), gen.MaxOutputTokens)
+		}
+		if len(result.Issues) != 1 || result.Issues[0].Code != IssueParamNormalized {
+			t.Errorf("%s: issues = %+v", extra, result.Issues)
+		}
+	}
+}
+
+func TestTokenBudgetInvalidThinkingParams(t *testing.T) {
+	useStrictConversion(t, false)
+	tests := []struct {
+		extra string
+		param string
+	}{
+		{`"thinking_budget":-1`, "thinking_budget"},
+		{`"reasoning_effort":"extreme"`, "reasoning_effort"},
+	}
+	for _, tt := range tests {
+		gen, _, result := convertBudget(t, budgetRequest("claude-sonnet-4-5-thinking", `"max_tokens":500,`+tt.extra))
+		err := result.Err()
+		if err == nil || err.Code != IssueInvalidParam || err.Param != tt.param {
+			t.Errorf("%s: err = %+v", tt.extra, err)
+		}
+		if gen.ThinkingConfig != nil {
+			t.Errorf("%s: thinking enabled with an invalid budget", tt.extra)
+		}
+	}
+}
+
+func TestTokenBudgetIgnoredWithoutThinking(t *testing.T) {
+	useStrictConversion(t, false)
+	// gemini-2.5-flash 默认不开启思考，请求的思考预算只记录说明
+	gen, budget, result := convertBudget(t, budgetRequest("gemini-2.5-flash", `"max_tokens":500,"thinking_budget":4000`))
+	if gen.ThinkingConfig != nil || gen.MaxOutputTokens != 500 || budget.Thinking != 0 {
+		t.Fatalf("maxOutputTokens = %d, thinking = %+v, budget = %+v", gen.MaxOutputTokens, gen.ThinkingConfig, budget)
+	}
+	if len(result.Issues) != 1 || result.Issues[0].Param != "thinking_budget" || result.Issues[0].Fatal {
+		t.Fatalf("issues = %+v", result.Issues)
+	}
+}
@@ -0,0 +1,256 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/persist"
+)
+
+// 模型能力
+const (
+	CapabilityTools       = "tools"        // 接受函数声明
+	CapabilityVision      = "vision"       // 理解图片输入
+	CapabilityOutputLimit = "output_limit" // 拒绝超过声明的 max_output_tokens 的请求（声明的上限即真实上限）
+)
+
+// 能力来源
+const (
+	CapabilitySourceDeclared = "declared" // 内置值或 models.json
+	CapabilitySourceProbed   = "probed"   // 探测结果
+)
+
+// CapabilityObservation 一次探测的结论
+type CapabilityObservation struct {
+	Supported bool      `json:"supported"`
+	ProbedAt  time.Time `json:"probedAt"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// ModelCapability 模型列表中展示的能力：探测结果覆盖声明值，两者不一致时标记 mismatch
+type ModelCapability struct {
+	Supported bool       `json:"supported"`
+	Declared  bool       `json:"declared"`
+	Source    string     `json:"source"`
+	ProbedAt  *time.Time `json:"probed_at,omitempty"`
+	Stale     bool       `json:"stale,omitempty"` // 探测结果已过期（仍然使用，同时在后台重新探测）
+	Detail    string     `json:"detail,omitempty"`
+	Mismatch  bool       `json:"mismatch,omitempty"`
+}
+
+// ProbeBudget 探测请求的每日用量（按 UTC 日期重置）
+type ProbeBudget struct {
+	Day  string `json:"day"`
+	Used int    `json:"used"`
+}
+
+// capabilityState capabilities.json 的内容
+type capabilityState struct {
+	Budget ProbeBudget                                 `json:"budget"`
+	Models map[string]map[string]CapabilityObservation `json:"models"`
+}
+
+// capabilityStore 探测结果（持久化到 data/capabilities.json）
+type capabilityStore struct {
+	mu       sync.Mutex
+	filePath string
+	state    capabilityState
+}
+
+var (
+	capabilities     *capabilityStore
+	capabilitiesOnce sync.Once
+
+	revalidateMu   sync.RWMutex
+	revalidateHook func(model string)
+)
+
+func getCapabilityStore() *capabilityStore {
+	capabilitiesOnce.Do(func() {
+		capabilities = &capabilityStore{filePath: filepath.Join(config.Get().DataDir, "capabilities.json")}
+		capabilities.load()
+		persist.Register(persist.File{
+			Name: "capabilities.json",
+			Path: capabilities.filePath,
+			Reload: func() error {
+				capabilities.load()
+				return nil
+			},
+		})
+	})
+	return capabilities
+}
+
+// load 读取 capabilities.json（不存在或无法解析时从空状态开始）
+func (s *capabilityStore) load() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = capabilityState{Models: make(map[string]map[string]CapabilityObservation)}
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		return
+	}
+	var state capabilityState
+	if err := json.Unmarshal(data, &state); err != nil {
+		logger.Warn("Invalid capability file %s: %v", s.filePath, err)
+		return
+	}
+	if state.Models == nil {
+		state.Models = make(map[string]map[string]CapabilityObservation)
+	}
+	s.state = state
+}
+
+func (s *capabilityStore) saveUnlocked() {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := persist.WriteFile(s.filePath, data, 0644); err != nil {
+		logger.Warn("Failed to save %s: %v", s.filePath, err)
+	}
+}
+
+// SetCapabilityRevalidateHook 设置过期探测结果的重新探测回调（模型列表读取到过期结果时调用，不等待完成）
+func SetCapabilityRevalidateHook(fn func(model string)) {
+	revalidateMu.Lock()
+	revalidateHook = fn
+	revalidateMu.Unlock()
+}
+
+// RecordCapabilityProbe 记录一次探测结论
+func RecordCapabilityProbe(model, capability string, obs CapabilityObservation) {
+	s := getCapabilityStore()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state.Models[model] == nil {
+		s.state.Models[model] = make(map[string]CapabilityObservation)
+	}
+	s.state.Models[model][capability] = obs
+	s.saveUnlocked()
+}
+
+// ReserveProbe 占用一次当日的探测额度，已达上限 limit 时返回 false
+func ReserveProbe(limit int) bool {
+	s := getCapabilityStore()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	if s.state.Budget.Day != today {
+		s.state.Budget = ProbeBudget{Day: today}
+	}
+	if s.state.Budget.Used >= limit {
+		return false
+	}
+	s.state.Budget.Used++
+	s.saveUnlocked()
+	return true
+}
+
+// ProbeBudgetUsage 当日已使用的探测额度
+func ProbeBudgetUsage() ProbeBudget {
+	s := getCapabilityStore()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	if s.state.Budget.Day != today {
+		return ProbeBudget{Day: today}
+	}
+	return s.state.Budget
+}
+
+// DeclaredCapabilities 模型声明的能力（来自模型配置；没有声明输出上限的模型不包含 output_limit）
+func DeclaredCapabilities(modelName string) map[string]bool {
+	cfg := GetModelConfig(modelName)
+	declared := map[string]bool{
+		CapabilityTools:  cfg.EffectiveTools(),
+		CapabilityVision: cfg.EffectiveVision(),
+	}
+	if cfg.EffectiveMaxOutputTokens() > 0 {
+		declared[CapabilityOutputLimit] = true
+	}
+	return declared
+}
+
+// capabilityStaleAfter 探测结果的有效期（定期探测间隔的两倍），0 表示不过期
+func capabilityStaleAfter() time.Duration {
+	return 2 * time.Duration(config.Get().CapProbeInterval) * time.Hour
+}
+
+// ModelCapabilities 合并模型的声明能力和探测结果，返回能力表和不一致的说明。
+// 过期的探测结果仍然返回（标记 stale），同时触发后台重新探测
+func ModelCapabilities(modelName string) (map[string]ModelCapability, []string) {
+	declared := DeclaredCapabilities(modelName)
+	// 探测按真实模型进行，别名共用结果
+	actualModel := ResolveModelName(modelName)
+
+	s := getCapabilityStore()
+	s.mu.Lock()
+	observed := make(map[string]CapabilityObservation, len(s.state.Models[actualModel]))
+	for name, obs := range s.state.Models[actualModel] {
+		observed[name] = obs
+	}
+	s.mu.Unlock()
+
+	names := make([]string, 0, len(declared))
+	for name := range declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	staleAfter := capabilityStaleAfter()
+	result := make(map[string]ModelCapability, len(declared))
+	var mismatches []string
+	stale := false
+	for _, name := range names {
+		c := ModelCapability{Supported: declared[name], Declared: declared[name], Source: CapabilitySourceDeclared}
+		if obs, ok := observed[name]; ok {
+			probedAt := obs.ProbedAt
+			c.Supported = obs.Supported
+			c.Source = CapabilitySourceProbed
+			c.ProbedAt = &probedAt
+			c.Detail = obs.Detail
+			c.Stale = staleAfter > 0 && time.Since(probedAt) > staleAfter
+			c.Mismatch = obs.Supported != c.Declared
+			stale = stale || c.Stale
+		}
+		if c.Mismatch {
+			mismatches = append(mismatches, describeMismatch(name, c))
+		}
+		result[name] = c
+	}
+
+	if stale {
+		revalidateMu.RLock()
+		hook := revalidateHook
+		revalidateMu.RUnlock()
+		if hook != nil {
+			hook(actualModel)
+		}
+	}
+	return result, mismatches
+}
+
+// describeMismatch 不一致的说明（用于模型列表）
+func describeMismatch(name string, c ModelCapability) string {
+	declared, observed := "supported", "unsupported"
+	if !c.Declared {
+		declared, observed = observed, declared
+	}
+	msg := fmt.Sprintf("%s is declared %s but was probed %s at %s", name, declared, observed, c.ProbedAt.UTC().Format(time.RFC3339))
+	if c.Detail != "" {
+		msg += ": " + c.Detail
+	}
+	return msg
+}
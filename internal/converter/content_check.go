@@ -0,0 +1,76 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkMessageContent 拒绝没有可用内容的请求（客户端 UI 问题导致的空白消息），
+// 以及模型不支持预填充时最后一条是 assistant 的请求
+func checkMessageContent(messages []OpenAIMessage, cfg ModelConfig, issues *ConversionResult) {
+	if !hasUsableContent(messages) {
+		issues.fail(IssueEmptyMessages, "messages", "no usable content in messages: every message is empty or whitespace-only")
+		return
+	}
+	if cfg.EffectiveAssistantPrefill() {
+		return
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		switch messages[i].Role {
+		case "system":
+			continue
+		case "assistant":
+			issues.fail(IssueTrailingAssistant, fmt.Sprintf("messages[%d]", i),
+				"the last message must be a user or tool message: this model does not support assistant prefill")
+		}
+		return
+	}
+}
+
+// hasUsableContent 除 system 外的消息中是否有非空白文本、可解析的图片、工具调用或工具结果
+func hasUsableContent(messages []OpenAIMessage) bool {
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			continue
+		case "tool":
+			return true
+		case "assistant":
+			if len(msg.ToolCalls) > 0 {
+				return true
+			}
+		}
+		if contentUsable(msg.Content) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentUsable 消息内容（字符串或内容数组）是否包含非空白文本或可解析的图片
+func contentUsable(content interface{}) bool {
+	switch v := content.(type) {
+	case string:
+		return strings.TrimSpace(v) != ""
+	case []interface{}:
+		for _, item := range v {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch m["type"] {
+			case "text":
+				if text, _ := m["text"].(string); strings.TrimSpace(text) != "" {
+					return true
+				}
+			case "image_url":
+				if imgURL, ok := m["image_url"].(map[string]interface{}); ok {
+					if url, _ := imgURL["url"].(string); parseImageURL(url) != nil {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package converter
+
+import (
+	"testing"
+)
+
+const testImage = "data:image/png;base64,iVBORw0KGgo="
+
+// parts 内容数组（解码后的 JSON 形式）
+func parts(items ...map[string]interface{}) []interface{} {
+	list := make([]interface{}, len(items))
+	for i, item := range items {
+		list[i] = item
+	}
+	return list
+}
+
+func textPart(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "text", "text": text}
+}
+
+func imagePart(url string) map[string]interface{} {
+	return map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}}
+}
+
+// contentIssue 检查消息内容，返回第一个错误的 code 和 param（没有错误时为空）
+func contentIssue(t *testing.T, model string, messages []OpenAIMessage) (string, string) {
+	t.Helper()
+	result := CheckConversion(&OpenAIChatRequest{Model: model, Messages: messages})
+	if issue := result.Err(); issue != nil {
+		return issue.Code, issue.Param
+	}
+	return "", ""
+}
+
+func TestEmptyMessagesRejected(t *testing.T) {
+	useStrictConversion(t, false)
+	toolCall := []OpenAIToolCall{{ID: "call_1", Type: "function", Function: OpenAIFunctionCall{Name: "ls", Arguments: "{}"}}}
+
+	tests := []struct {
+		name     string
+		messages []OpenAIMessage
+		empty    bool
+	}{
+		{"empty string", []OpenAIMessage{{Role: "user", Content: ""}}, true},
+		{"whitespace", []OpenAIMessage{{Role: "user", Content: " \n\t "}}, true},
+		{"nil content", []OpenAIMessage{{Role: "user"}}, true},
+		{"several blank turns", []OpenAIMessage{{Role: "user", Content: ""}, {Role: "assistant", Content: "  "}, {Role: "user", Content: "\n"}}, true},
+		// system 消息不算用户内容
+		{"only system", []OpenAIMessage{{Role: "system", Content: "Be brief."}, {Role: "user", Content: " "}}, true},
+		{"blank text parts", []OpenAIMessage{{Role: "user", Content: parts(textPart(""), textPart("  \n"))}}, true},
+		{"empty parts", []OpenAIMessage{{Role: "user", Content: parts()}}, true},
+		{"unparseable image", []OpenAIMessage{{Role: "user", Content: parts(imagePart("https://example.com/cat.png"), textPart(" "))}}, true},
+		{"malformed part", []OpenAIMessage{{Role: "user", Content: []interface{}{"text", 42}}}, true},
+
+		{"text", []OpenAIMessage{{Role: "user", Content: "hi"}}, false},
+		{"text after blank turn", []OpenAIMessage{{Role: "user", Content: ""}, {Role: "assistant", Content: "?"}, {Role: "user", Content: "hi"}}, false},
+		{"text part", []OpenAIMessage{{Role: "user", Content: parts(textPart(" "), textPart("hi"))}}, false},
+		{"image only", []OpenAIMessage{{Role: "user", Content: parts(imagePart(testImage))}}, false},
+		{"image with blank text", []OpenAIMessage{{Role: "user", Content: parts(textPart(""), imagePart(testImage))}}, false},
+		// 工具结果本身就是可用内容（即使为空）
+		{"tool result", []OpenAIMessage{
+			{Role: "user", Content: ""},
+			{Role: "assistant", ToolCalls: toolCall},
+			{Role: "tool", ToolCallID: "call_1", Content: ""},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, param := contentIssue(t, "gemini-2.5-flash", tt.messages)
+			if tt.empty {
+				if code != IssueEmptyMessages || param != "messages" {
+					t.Fatalf("issue = %q %q, want %q", code, param, IssueEmptyMessages)
+				}
+			} else if code == IssueEmptyMessages {
+				t.Fatal("rejected as empty")
+			}
+		})
+	}
+}
+
+func TestEmptyMessagesMessage(t *testing.T) {
+	result := CheckConversion(&OpenAIChatRequest{Model: "gemini-2.5-flash", Messages: []OpenAIMessage{{Role: "user", Content: " "}}})
+	issue := result.Err()
+	if issue == nil || issue.Error() != "messages: no usable content in messages: every message is empty or whitespace-only" {
+		t.Fatalf("issue = %v", issue)
+	}
+	// 内容为空时不再检查最后一条消息
+	if len(result.Issues) != 1 {
+		t.Fatalf("issues = %+v", result.Issues)
+	}
+}
+
+func TestTrailingAssistantRejected(t *testing.T) {
+	useStrictConversion(t, false)
+	toolCall := []OpenAIToolCall{{ID: "call_1", Type: "function", Function: OpenAIFunctionCall{Name: "ls", Arguments: "{}"}}}
+
+	tests := []struct {
+		name     string
+		messages []OpenAIMessage
+		param    string // 期望的 trailing_assistant 位置，空为允许
+	}{
+		{"prefill", []OpenAIMessage{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "Sure,"}}, "messages[1]"},
+		{"prefill parts", []OpenAIMessage{{Role: "user", Content: "hi"}, {Role: "assistant", Content: parts(textPart("Sure,"))}}, "messages[1]"},
+		// 末尾的 system 消息不算一轮
+		{"trailing system", []OpenAIMessage{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "Sure,"}, {Role: "system", Content: "Be brief."}}, "messages[1]"},
+		{"assistant tool call last", []OpenAIMessage{{Role: "user", Content: "hi"}, {Role: "assistant", ToolCalls: toolCall}}, "messages[1]"},
+		{"user last", []OpenAIMessage{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "Hello"}, {Role: "user", Content: "more"}}, ""},
+		{"tool last", []OpenAIMessage{{Role: "user", Content: "hi"}, {Role: "assistant", ToolCalls: toolCall}, {Role: "tool", ToolCallID: "call_1", Content: "a.txt"}}, ""},
+		{"system then user", []OpenAIMessage{{Role: "assistant", Content: "Hello"}, {Role: "user", Content: "hi"}, {Role: "system", Content: "Be brief."}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, param := contentIssue(t, "gemini-2.5-flash", tt.messages)
+			if tt.param == "" {
+				if code != "" {
+					t.Fatalf("issue = %q %q", code, param)
+				}
+				return
+			}
+			if code != IssueTrailingAssistant || param != tt.param {
+				t.Fatalf("issue = %q %q, want %q %q", code, param, IssueTrailingAssistant, tt.param)
+			}
+		})
+	}
+}
+
+func TestAssistantPrefillAllowedWhenConfigured(t *testing.T) {
+	useStrictConversion(t, true)
+	prefill := []OpenAIMessage{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "Sure,"}}
+
+	// Claude 默认允许预填充
+	if code, _ := contentIssue(t, "claude-sonnet-4-5", prefill); code != "" {
+		t.Fatalf("claude prefill rejected: %s", code)
+	}
+
+	// 按模型开启
+	allow, deny := true, false
+	useModelConfig(t, "gemini-2.5-flash", ModelConfig{AssistantPrefill: &allow})
+	if code, _ := contentIssue(t, "gemini-2.5-flash", prefill); code != "" {
+		t.Fatalf("prefill rejected with assistant_prefill: %s", code)
+	}
+	// 预填充模式下空内容仍然拒绝
+	if code, _ := contentIssue(t, "gemini-2.5-flash", []OpenAIMessage{{Role: "user", Content: ""}, {Role: "assistant", Content: " "}}); code != IssueEmptyMessages {
+		t.Fatalf("empty prefill request issue = %q", code)
+	}
+
+	// 覆盖内置配置关闭
+	useModelConfig(t, "claude-sonnet-4-5", ModelConfig{AssistantPrefill: &deny})
+	if code, _ := contentIssue(t, "claude-sonnet-4-5", prefill); code != IssueTrailingAssistant {
+		t.Fatalf("claude prefill with assistant_prefill=false issue = %q", code)
+	}
+}
+
+func TestEffectiveAssistantPrefill(t *testing.T) {
+	allow, deny := true, false
+	if (ModelConfig{}).EffectiveAssistantPrefill() {
+		t.Error("prefill allowed by default")
+	}
+	if !(ModelConfig{AssistantPrefill: &allow}).EffectiveAssistantPrefill() || (ModelConfig{AssistantPrefill: &deny}).EffectiveAssistantPrefill() {
+		t.Error("explicit setting ignored")
+	}
+	if !GetModelConfig("claude-sonnet-4-5-thinking").EffectiveAssistantPrefill() || GetModelConfig("gemini-2.5-pro").EffectiveAssistantPrefill() {
+		t.Error("builtin defaults: claude should allow prefill, gemini should not")
+	}
+}
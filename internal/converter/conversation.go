@@ -0,0 +1,64 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// ConversationKey 会话标识：系统指令和首条消息的文本哈希（同一会话的后续轮次保持不变），无文本时返回空
+func ConversationKey(req *AntigravityRequest) string {
+	return contentsConversationKey(req.Request.SystemInstruction, req.Request.Contents)
+}
+
+// GeminiConversationKey Gemini 请求的会话标识（与 ConversationKey 规则相同）
+func GeminiConversationKey(req *GeminiRequest) string {
+	return contentsConversationKey(req.SystemInstruction, req.Contents)
+}
+
+func contentsConversationKey(si *SystemInstruction, contents []Content) string {
+	h := sha256.New()
+	empty := true
+	if si != nil {
+		for _, part := range si.Parts {
+			if part.Text != "" {
+				h.Write([]byte(part.Text))
+				empty = false
+			}
+		}
+	}
+	if len(contents) > 0 {
+		for _, part := range contents[0].Parts {
+			if part.Text != "" {
+				h.Write([]byte(part.Text))
+				empty = false
+			}
+		}
+	}
+	if empty {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// OpenAIConversationKey OpenAI 请求的会话标识（转换前可用）：系统消息和首条非系统消息的文本哈希，无文本时返回空
+func OpenAIConversationKey(req *OpenAIChatRequest) string {
+	h := sha256.New()
+	empty := true
+	first := true
+	for _, msg := range req.Messages {
+		if msg.Role != "system" {
+			if !first {
+				continue
+			}
+			first = false
+		}
+		if text := getTextContent(msg.Content); text != "" {
+			h.Write([]byte(text))
+			empty = false
+		}
+	}
+	if empty {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
@@ -0,0 +1,114 @@
+package converter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DecodeOpenAIChatRequest 增量解码 OpenAI 请求体
+// messages 数组逐条解码，避免一次性缓冲整个请求体（多图请求可达上百 MB）
+func DecodeOpenAIChatRequest(r io.Reader) (*OpenAIChatRequest, error) {
+	dec := json.NewDecoder(r)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	req := &OpenAIChatRequest{}
+	// 除 messages 外的字段体积很小，收集后按结构体标签统一解码
+	others := make(map[string]json.RawMessage)
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected token %v", tok)
+		}
+
+		if key != "messages" {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, err
+			}
+			if !IsSupportedParam(key) {
+				// null 等同于未设置
+				if string(raw) != "null" {
+					req.Unsupported = append(req.Unsupported, key)
+				}
+				continue
+			}
+			others[key] = raw
+			continue
+		}
+
+		messages, err := decodeMessages(dec)
+		if err != nil {
+			return nil, fmt.Errorf("messages: %w", err)
+		}
+		req.Messages = messages
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+
+	if len(others) > 0 {
+		data, err := json.Marshal(others)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, req); err != nil {
+			return nil, err
+		}
+	}
+	if raw, ok := others["tools"]; ok && len(req.Tools) > 0 {
+		req.toolsKey = toolsFingerprint(raw)
+	}
+
+	req.Unsupported = sortedParams(req.Unsupported)
+	return req, nil
+}
+
+// decodeMessages 逐条解码 messages 数组
+func decodeMessages(dec *json.Decoder) ([]OpenAIMessage, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("expected array")
+	}
+
+	var messages []OpenAIMessage
+	for dec.More() {
+		var msg OpenAIMessage
+		if err := dec.Decode(&msg); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := expectDelim(dec, ']'); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("expected %q, got %v", want, tok)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package converter
+
+import (
+	"encoding/json"
+	"unicode"
+)
+
+// imageTokenEstimate 单张图片的估算 Token 数（Gemini 按 258 计）
+const imageTokenEstimate = 258
+
+// TokenEstimate 请求 Token 估算（粗略值，仅用于调试）
+type TokenEstimate struct {
+	System   int `json:"system"`
+	Messages int `json:"messages"`
+	Tools    int `json:"tools"`
+	Images   int `json:"images"`
+	Total    int `json:"total"`
+}
+
+// EstimateTokens 估算请求的输入 Token：CJK 字符按 1 个计，其他字符按 4 个计 1 个
+func EstimateTokens(req *OpenAIChatRequest) TokenEstimate {
+	var est TokenEstimate
+
+	for _, msg := range req.Messages {
+		text := getTextContent(msg.Content)
+		if msg.Role == "system" {
+			est.System += estimateTextTokens(text)
+			continue
+		}
+		est.Messages += estimateTextTokens(text)
+		est.Messages += estimateTextTokens(msg.Reasoning + msg.ReasoningContent)
+		for _, tc := range msg.ToolCalls {
+			est.Messages += estimateTextTokens(tc.Function.Name + tc.Function.Arguments)
+		}
+		est.Images += countImages(msg.Content) * imageTokenEstimate
+	}
+
+	for _, tool := range req.Tools {
+		data, _ := json.Marshal(tool.Function)
+		est.Tools += estimateTextTokens(string(data))
+	}
+
+	est.Total = est.System + est.Messages + est.Tools + est.Images
+	return est
+}
+
+func estimateTextTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+func countImages(content interface{}) int {
+	items, ok := content.([]interface{})
+	if !ok {
+		return 0
+	}
+	count := 0
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok && m["type"] == "image_url" {
+			count++
+		}
+	}
+	return count
+}
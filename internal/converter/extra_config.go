@@ -0,0 +1,50 @@
+package converter
+
+import (
+	"encoding/json"
+	"sort"
+
+	"anti2api-golang/internal/config"
+)
+
+// extraConfigAllowed 请求扩展是否可以设置该 GenerationConfig 字段（禁止列表优先）
+func extraConfigAllowed(key string, allow, deny []string) bool {
+	for _, d := range deny {
+		if d == key || d == "*" {
+			return false
+		}
+	}
+	for _, a := range allow {
+		if a == key || a == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyExtraGenerationConfig 将 extra_generation_config 中允许的字段记入 RawExtra（序列化时覆盖计算出的值），
+// 不允许的字段记为错误
+func applyExtraGenerationConfig(req *OpenAIChatRequest, genConfig *GenerationConfig, issues *ConversionResult) {
+	if len(req.ExtraGenerationConfig) == 0 {
+		return
+	}
+	cfg := config.Get()
+
+	// 按键排序，多个字段不允许时报告的错误稳定
+	keys := make([]string, 0, len(req.ExtraGenerationConfig))
+	for key := range req.ExtraGenerationConfig {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !extraConfigAllowed(key, cfg.ExtraGenConfigAllow, cfg.ExtraGenConfigDeny) {
+			issues.fail(IssueInvalidParam, "extra_generation_config."+key, "generation config field %q is not allowed by the server configuration", key)
+			continue
+		}
+		if genConfig.RawExtra == nil {
+			genConfig.RawExtra = make(map[string]json.RawMessage, len(keys))
+		}
+		genConfig.RawExtra[key] = req.ExtraGenerationConfig[key]
+	}
+}
@@ -0,0 +1,161 @@
+package converter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"anti2api-golang/internal/config"
+)
+
+// useExtraConfigLists 在测试期间设置 EXTRA_GENERATION_CONFIG_ALLOW/DENY
+func useExtraConfigLists(t *testing.T, allow, deny []string) {
+	t.Helper()
+	cfg := config.Get()
+	prevAllow, prevDeny := cfg.ExtraGenConfigAllow, cfg.ExtraGenConfigDeny
+	cfg.ExtraGenConfigAllow, cfg.ExtraGenConfigDeny = allow, deny
+	t.Cleanup(func() { cfg.ExtraGenConfigAllow, cfg.ExtraGenConfigDeny = prevAllow, prevDeny })
+}
+
+// sentGenerationConfig 上游请求体中 generationConfig 的各字段（JSON 原文）
+func sentGenerationConfig(t *testing.T, converted *AntigravityRequest) map[string]string {
+	t.Helper()
+	data, err := json.Marshal(converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Request struct {
+			GenerationConfig map[string]json.RawMessage `json:"generationConfig"`
+		} `json:"request"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[string]string, len(body.Request.GenerationConfig))
+	for key, value := range body.Request.GenerationConfig {
+		fields[key] = string(value)
+	}
+	return fields
+}
+
+func TestExtraConfigAllowed(t *testing.T) {
+	for _, tc := range []struct {
+		key         string
+		allow, deny []string
+		want        bool
+	}{
+		{"seed", nil, nil, false},
+		{"seed", []string{"seed"}, nil, true},
+		{"seed", []string{"presencePenalty"}, nil, false},
+		{"seed", []string{"*"}, nil, true},
+		{"seed", []string{"*"}, []string{"seed"}, false},
+		{"seed", []string{"seed"}, []string{"*"}, false},
+		{"candidateCount", []string{"*"}, []string{"candidateCount"}, false},
+		{"Seed", []string{"seed"}, nil, false}, // 字段名区分大小写
+	} {
+		if got := extraConfigAllowed(tc.key, tc.allow, tc.deny); got != tc.want {
+			t.Errorf("extraConfigAllowed(%q, allow %v, deny %v) = %v, want %v", tc.key, tc.allow, tc.deny, got, tc.want)
+		}
+	}
+}
+
+func TestExtraGenerationConfigMerge(t *testing.T) {
+	useExtraConfigLists(t, []string{"*"}, []string{"candidateCount"})
+	body := budgetRequest("gemini-2.5-flash-thinking", `"temperature":0.2,"extra_generation_config":{
+		"temperature": 0.9,
+		"maxOutputTokens": 4096,
+		"thinkingConfig": null,
+		"seed": 12345678901234567890,
+		"responseLogprobs": true,
+		"mediaResolution": "MEDIA_RESOLUTION_LOW",
+		"experimentalKnob": {"level": 2, "tags": ["a", "b"]}
+	}`)
+	req, converted := convertChat(t, body)
+	if err := CheckConversion(req).Err(); err != nil {
+		t.Fatalf("conversion error: %v", err)
+	}
+
+	fields := sentGenerationConfig(t, converted)
+	for key, want := range map[string]string{
+		// 请求扩展的值覆盖计算出的值
+		"temperature":     `0.9`,
+		"maxOutputTokens": `4096`,
+		// 未建模的字段原样写入，保持类型（大整数不经过 float64）
+		"seed":             `12345678901234567890`,
+		"responseLogprobs": `true`,
+		"mediaResolution":  `"MEDIA_RESOLUTION_LOW"`,
+		"experimentalKnob": `{"level":2,"tags":["a","b"]}`,
+	} {
+		if got := fields[key]; got != want {
+			t.Errorf("generationConfig.%s = %s, want %s", key, got, want)
+		}
+	}
+	// null 删除计算出的字段
+	if _, ok := fields["thinkingConfig"]; ok {
+		t.Errorf("thinkingConfig = %s, want it removed", fields["thinkingConfig"])
+	}
+	// 没有被覆盖的计算值保留
+	if _, ok := fields["stopSequences"]; !ok {
+		t.Errorf("computed stopSequences missing: %v", fields)
+	}
+
+	// 计算出的字段本身不被修改，只在序列化时合并
+	gen := converted.Request.GenerationConfig
+	if gen.Temperature == nil || *gen.Temperature != 0.2 || gen.ThinkingConfig == nil {
+		t.Errorf("computed config changed: temperature %v, thinking %+v", gen.Temperature, gen.ThinkingConfig)
+	}
+}
+
+func TestExtraGenerationConfigWithoutExtra(t *testing.T) {
+	_, converted := convertChat(t, budgetRequest("gemini-2.5-flash", `"temperature":0.2`))
+	gen := converted.Request.GenerationConfig
+	if gen.RawExtra != nil {
+		t.Fatalf("RawExtra = %v without extra_generation_config", gen.RawExtra)
+	}
+	type plain GenerationConfig
+	want, _ := json.Marshal(plain(*gen))
+	got, err := json.Marshal(gen)
+	if err != nil || string(got) != string(want) {
+		t.Errorf("MarshalJSON = %s, %v, want %s", got, err, want)
+	}
+}
+
+func TestExtraGenerationConfigAllowlist(t *testing.T) {
+	const extra = `"extra_generation_config":{"temperature":0.9,"seed":7,"candidateCount":2}`
+	for _, tc := range []struct {
+		name        string
+		allow, deny []string
+		rejected    string // 第一个被拒绝的字段（按字段名排序），为空表示全部接受
+		sent        []string
+	}{
+		{"no allowlist", nil, []string{"candidateCount"}, "candidateCount", nil},
+		{"allow all with default deny", []string{"*"}, []string{"candidateCount"}, "candidateCount", []string{"seed", "temperature"}},
+		{"allow all without deny", []string{"*"}, nil, "", []string{"candidateCount", "seed", "temperature"}},
+		{"named fields", []string{"seed", "candidateCount"}, nil, "temperature", []string{"candidateCount", "seed"}},
+		{"deny wins over named allow", []string{"seed", "temperature", "candidateCount"}, []string{"seed"}, "seed", []string{"candidateCount", "temperature"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			useExtraConfigLists(t, tc.allow, tc.deny)
+			req, converted := convertChat(t, budgetRequest("gemini-2.5-flash", extra))
+
+			err := CheckConversion(req).Err()
+			switch {
+			case tc.rejected == "" && err != nil:
+				t.Fatalf("conversion error: %v", err)
+			case tc.rejected != "" && (err == nil || err.Code != IssueInvalidParam || err.Param != "extra_generation_config."+tc.rejected):
+				t.Fatalf("error = %+v, want invalid_param for %s", err, tc.rejected)
+			}
+
+			// 被拒绝的字段不会进入 RawExtra
+			gen := converted.Request.GenerationConfig
+			if len(gen.RawExtra) != len(tc.sent) {
+				t.Errorf("RawExtra = %v, want %v", gen.RawExtra, tc.sent)
+			}
+			for _, key := range tc.sent {
+				if _, ok := gen.RawExtra[key]; !ok {
+					t.Errorf("RawExtra missing %s: %v", key, gen.RawExtra)
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,8 @@
 package converter
 
 import (
-	"encoding/json"
+	"fmt"
+	"strconv"
 	"strings"
 
 	"anti2api-golang/internal/config"
@@ -13,6 +14,12 @@ import (
 func ConvertGeminiToAntigravity(model string, geminiReq *GeminiRequest, account *store.Account) *AntigravityRequest {
 	modelName := ResolveModelName(model)
 
+	// 没有工具时不发送 ToolConfig（后端会拒绝）
+	toolConfig := geminiReq.ToolConfig
+	if len(geminiReq.Tools) == 0 {
+		toolConfig = nil
+	}
+
 	return &AntigravityRequest{
 		Project:   getProjectID(account),
 		RequestID: utils.GenerateRequestID(),
@@ -21,7 +28,7 @@ func ConvertGeminiToAntigravity(model string, geminiReq *GeminiRequest, account
 			SystemInstruction: geminiReq.SystemInstruction,
 			GenerationConfig:  buildGeminiGenerationConfig(geminiReq.GenerationConfig, modelName),
 			Tools:             geminiReq.Tools,
-			ToolConfig:        geminiReq.ToolConfig,
+			ToolConfig:        toolConfig,
 			SessionID:         account.SessionID,
 		},
 		Model:     modelName,
@@ -32,7 +39,7 @@ func ConvertGeminiToAntigravity(model string, geminiReq *GeminiRequest, account
 func buildGeminiGenerationConfig(reqConfig *GenerationConfig, modelName string) *GenerationConfig {
 	config := &GenerationConfig{
 		CandidateCount: 1,
-		StopSequences:  DefaultStopSequences,
+		StopSequences:  GetModelConfig(modelName).EffectiveStopSequences(),
 	}
 
 	if reqConfig != nil {
@@ -86,93 +93,86 @@ func ExtractGeminiResponse(antigravityResp *AntigravityResponse) *GeminiResponse
 	return resp
 }
 
-// TransformGeminiStreamLine 流式行转换
-func TransformGeminiStreamLine(line string) string {
-	if !strings.HasPrefix(line, "data: ") {
-		return line
-	}
-
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(line[6:]), &data); err != nil {
-		return line
-	}
-
-	// 提取 response 字段
-	if resp, ok := data["response"].(map[string]interface{}); ok {
-		// 清理 candidates
-		sanitizeCandidates(resp)
-		transformed, err := json.Marshal(resp)
-		if err != nil {
-			return line
-		}
-		return "data: " + string(transformed)
-	}
-
-	return line
-}
-
-func sanitizeCandidates(resp map[string]interface{}) {
-	candidates, ok := resp["candidates"].([]interface{})
-	if !ok {
-		return
-	}
-
-	for i, c := range candidates {
-		candidate, ok := c.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		// 清理 parts 中的非标准字段
-		if content, ok := candidate["content"].(map[string]interface{}); ok {
-			if parts, ok := content["parts"].([]interface{}); ok {
-				for _, p := range parts {
-					if part, ok := p.(map[string]interface{}); ok {
-						// 删除 thoughtSignature 等非标准字段
-						delete(part, "thoughtSignature")
-					}
-				}
-			}
-		}
-
-		// 确保有 index
-		if _, ok := candidate["index"]; !ok {
-			candidate["index"] = i
-		}
-	}
-}
-
 // GeminiModelsResponse Gemini 模型列表响应
 type GeminiModelsResponse struct {
-	Models []GeminiModel `json:"models"`
+	Models        []GeminiModel `json:"models"`
+	NextPageToken string        `json:"nextPageToken,omitempty"`
 }
 
 // GeminiModel Gemini 模型
 type GeminiModel struct {
 	Name                       string   `json:"name"`
+	BaseModelID                string   `json:"baseModelId,omitempty"`
 	Version                    string   `json:"version,omitempty"`
 	DisplayName                string   `json:"displayName"`
 	Description                string   `json:"description,omitempty"`
 	InputTokenLimit            int      `json:"inputTokenLimit,omitempty"`
 	OutputTokenLimit           int      `json:"outputTokenLimit,omitempty"`
 	SupportedGenerationMethods []string `json:"supportedGenerationMethods,omitempty"`
+	Thinking                   bool     `json:"thinking,omitempty"`
+}
+
+// Gemini 模型列表分页
+const (
+	GeminiModelsDefaultPageSize = 50
+	GeminiModelsMaxPageSize     = 1000
+)
+
+// toGeminiModel 将注册表中的模型（含生效限制）转换为 Gemini 格式
+func toGeminiModel(m Model) GeminiModel {
+	return GeminiModel{
+		Name:             "models/" + m.ID,
+		BaseModelID:      m.ID,
+		DisplayName:      ModelDisplayName(m.ID),
+		Description:      "Model provided by " + m.OwnedBy,
+		OutputTokenLimit: m.MaxOutputTokens,
+		SupportedGenerationMethods: []string{
+			"generateContent",
+			"streamGenerateContent",
+		},
+		Thinking: m.ThinkingBudget != nil,
+	}
 }
 
-// GetGeminiModels 获取 Gemini 格式的模型列表
-func GetGeminiModels() *GeminiModelsResponse {
-	models := []GeminiModel{}
-
-	for _, m := range SupportedModels {
-		models = append(models, GeminiModel{
-			Name:        "models/" + m.ID,
-			DisplayName: m.ID,
-			Description: "Model provided by " + m.OwnedBy,
-			SupportedGenerationMethods: []string{
-				"generateContent",
-				"streamGenerateContent",
-			},
-		})
+// GetGeminiModels 获取 Gemini 格式的模型列表（pageToken 为上一页返回的 nextPageToken，pageSize <= 0 时使用默认值）
+func GetGeminiModels(pageSize int, pageToken string) (*GeminiModelsResponse, error) {
+	if pageSize <= 0 {
+		pageSize = GeminiModelsDefaultPageSize
+	}
+	if pageSize > GeminiModelsMaxPageSize {
+		pageSize = GeminiModelsMaxPageSize
 	}
 
-	return &GeminiModelsResponse{Models: models}
+	all := ModelsWithLimits()
+	offset := 0
+	if pageToken != "" {
+		n, err := strconv.Atoi(pageToken)
+		if err != nil || n < 0 || n > len(all) {
+			return nil, fmt.Errorf("invalid pageToken %q", pageToken)
+		}
+		offset = n
+	}
+	end := min(offset+pageSize, len(all))
+
+	models := make([]GeminiModel, 0, end-offset)
+	for _, m := range all[offset:end] {
+		models = append(models, toGeminiModel(m))
+	}
+
+	resp := &GeminiModelsResponse{Models: models}
+	if end < len(all) {
+		resp.NextPageToken = strconv.Itoa(end)
+	}
+	return resp, nil
+}
+
+// GetGeminiModel 按名称获取 Gemini 格式的模型（name 可带 models/ 前缀）
+func GetGeminiModel(name string) (GeminiModel, bool) {
+	id := strings.TrimPrefix(name, "models/")
+	for _, m := range ModelsWithLimits() {
+		if m.ID == id {
+			return toGeminiModel(m), true
+		}
+	}
+	return GeminiModel{}, false
 }
@@ -0,0 +1,123 @@
+package converter
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// GroundingMetadata 上游联网搜索（grounding）返回的引用信息
+type GroundingMetadata struct {
+	WebSearchQueries  []string           `json:"webSearchQueries,omitempty"`
+	GroundingChunks   []GroundingChunk   `json:"groundingChunks,omitempty"`
+	GroundingSupports []GroundingSupport `json:"groundingSupports,omitempty"`
+}
+
+// GroundingChunk 引用来源
+type GroundingChunk struct {
+	Web *GroundingWeb `json:"web,omitempty"`
+}
+
+// GroundingWeb 网页来源
+type GroundingWeb struct {
+	URI   string `json:"uri"`
+	Title string `json:"title,omitempty"`
+}
+
+// GroundingSupport 正文片段与引用来源的对应关系
+type GroundingSupport struct {
+	Segment               GroundingSegment `json:"segment"`
+	GroundingChunkIndices []int            `json:"groundingChunkIndices,omitempty"`
+}
+
+// GroundingSegment 被引用的正文片段（索引为上游原始文本中的字节偏移）
+type GroundingSegment struct {
+	PartIndex  int    `json:"partIndex,omitempty"`
+	StartIndex int    `json:"startIndex,omitempty"`
+	EndIndex   int    `json:"endIndex,omitempty"`
+	Text       string `json:"text,omitempty"`
+}
+
+// Annotation OpenAI 消息注释
+type Annotation struct {
+	Type        string      `json:"type"` // url_citation
+	URLCitation URLCitation `json:"url_citation"`
+}
+
+// URLCitation 网页引用，索引为返回给客户端的 content 中的字符偏移
+type URLCitation struct {
+	StartIndex int    `json:"start_index"`
+	EndIndex   int    `json:"end_index"`
+	URL        string `json:"url"`
+	Title      string `json:"title,omitempty"`
+}
+
+// MergeGrounding 合并流式响应中多次出现的 grounding 信息（后出现的来源追加在后，片段的来源索引相应偏移）
+func MergeGrounding(prev, next *GroundingMetadata) *GroundingMetadata {
+	if prev == nil {
+		return next
+	}
+	if next == nil {
+		return prev
+	}
+	merged := &GroundingMetadata{
+		WebSearchQueries:  append(append([]string{}, prev.WebSearchQueries...), next.WebSearchQueries...),
+		GroundingChunks:   append(append([]GroundingChunk{}, prev.GroundingChunks...), next.GroundingChunks...),
+		GroundingSupports: append([]GroundingSupport{}, prev.GroundingSupports...),
+	}
+	offset := len(prev.GroundingChunks)
+	for _, support := range next.GroundingSupports {
+		indices := make([]int, len(support.GroundingChunkIndices))
+		for i, idx := range support.GroundingChunkIndices {
+			indices[i] = idx + offset
+		}
+		support.GroundingChunkIndices = indices
+		merged.GroundingSupports = append(merged.GroundingSupports, support)
+	}
+	return merged
+}
+
+// BuildAnnotations 把 grounding 引用转换为 url_citation 注释。
+// 上游的偏移针对原始文本，而返回给客户端的 content 可能经过后处理或工具调用提取而改变，
+// 因此按片段文本在最终 content 中定位（优先在上一个片段之后查找），找不到的片段丢弃
+func BuildAnnotations(meta *GroundingMetadata, content string) []Annotation {
+	if meta == nil || content == "" {
+		return nil
+	}
+
+	var annotations []Annotation
+	seen := make(map[URLCitation]bool)
+	cursor := 0
+	for _, support := range meta.GroundingSupports {
+		text := support.Segment.Text
+		if text == "" {
+			continue
+		}
+		start := -1
+		if i := strings.Index(content[cursor:], text); i >= 0 {
+			start = cursor + i
+		} else if i := strings.Index(content, text); i >= 0 {
+			start = i
+		}
+		if start < 0 {
+			continue
+		}
+		end := start + len(text)
+		cursor = end
+
+		startChars := utf8.RuneCountInString(content[:start])
+		endChars := startChars + utf8.RuneCountInString(text)
+		for _, idx := range support.GroundingChunkIndices {
+			if idx < 0 || idx >= len(meta.GroundingChunks) || meta.GroundingChunks[idx].Web == nil {
+				continue
+			}
+			web := meta.GroundingChunks[idx].Web
+			citation := URLCitation{StartIndex: startChars, EndIndex: endChars, URL: web.URI, Title: web.Title}
+			if seen[citation] {
+				continue
+			}
+			seen[citation] = true
+			annotations = append(annotations, Annotation{Type: "url_citation", URLCitation: citation})
+		}
+	}
+	return annotations
+}
@@ -0,0 +1,142 @@
+package converter
+
+import (
+	"reflect"
+	"testing"
+)
+
+// webChunks 按 URL 生成引用来源
+func webChunks(urls ...string) []GroundingChunk {
+	chunks := make([]GroundingChunk, len(urls))
+	for i, url := range urls {
+		chunks[i] = GroundingChunk{Web: &GroundingWeb{URI: url, Title: url}}
+	}
+	return chunks
+}
+
+// support 引用片段（上游偏移不参与定位，按文本查找）
+func support(text string, indices ...int) GroundingSupport {
+	return GroundingSupport{Segment: GroundingSegment{Text: text}, GroundingChunkIndices: indices}
+}
+
+// citation 期望的 url_citation（title 与 URL 相同）
+func citation(start, end int, url string) Annotation {
+	return Annotation{Type: "url_citation", URLCitation: URLCitation{StartIndex: start, EndIndex: end, URL: url, Title: url}}
+}
+
+func TestBuildAnnotations(t *testing.T) {
+	tests := []struct {
+		name    string
+		meta    *GroundingMetadata
+		content string
+		want    []Annotation
+	}{
+		{
+			name:    "nil metadata",
+			content: "text",
+		},
+		{
+			name:    "empty content",
+			meta:    &GroundingMetadata{GroundingChunks: webChunks("a"), GroundingSupports: []GroundingSupport{support("x", 0)}},
+			content: "",
+		},
+		{
+			name:    "character offsets",
+			meta:    &GroundingMetadata{GroundingChunks: webChunks("a", "b"), GroundingSupports: []GroundingSupport{support("東京は首都です。", 0), support("Über 🏅.", 1)}},
+			content: "東京は首都です。 Über 🏅.",
+			want:    []Annotation{citation(0, 8, "a"), citation(9, 16, "b")},
+		},
+		{
+			// 后处理去掉了上游原文开头的 "Sure! "，偏移按最终 content 计算而不是上游的字节偏移
+			name: "prefix stripped by post-processing",
+			meta: &GroundingMetadata{GroundingChunks: webChunks("a"), GroundingSupports: []GroundingSupport{{
+				Segment:               GroundingSegment{StartIndex: 6, EndIndex: 27, Text: "Paris is the capital."},
+				GroundingChunkIndices: []int{0},
+			}}},
+			content: "Paris is the capital.",
+			want:    []Annotation{citation(0, 21, "a")},
+		},
+		{
+			// 被后处理改写或截断的片段找不到，丢弃
+			name:    "segment rewritten",
+			meta:    &GroundingMetadata{GroundingChunks: webChunks("a", "b"), GroundingSupports: []GroundingSupport{support("old wording", 0), support("kept", 1)}},
+			content: "new wording, kept",
+			want:    []Annotation{citation(13, 17, "b")},
+		},
+		{
+			// 重复的片段按出现顺序依次定位
+			name:    "repeated segment",
+			meta:    &GroundingMetadata{GroundingChunks: webChunks("a", "b"), GroundingSupports: []GroundingSupport{support("yes", 0), support("yes", 1)}},
+			content: "yes and yes",
+			want:    []Annotation{citation(0, 3, "a"), citation(8, 11, "b")},
+		},
+		{
+			// 之后的片段出现在前面时回到开头查找
+			name:    "out of order segments",
+			meta:    &GroundingMetadata{GroundingChunks: webChunks("a", "b"), GroundingSupports: []GroundingSupport{support("second", 0), support("first", 1)}},
+			content: "first second",
+			want:    []Annotation{citation(6, 12, "a"), citation(0, 5, "b")},
+		},
+		{
+			name: "invalid and non-web sources skipped",
+			meta: &GroundingMetadata{
+				GroundingChunks:   []GroundingChunk{{}, {Web: &GroundingWeb{URI: "a", Title: "a"}}},
+				GroundingSupports: []GroundingSupport{support("text", -1, 0, 1, 5), support("", 1)},
+			},
+			content: "text",
+			want:    []Annotation{citation(0, 4, "a")},
+		},
+		{
+			name:    "duplicates removed",
+			meta:    &GroundingMetadata{GroundingChunks: webChunks("a"), GroundingSupports: []GroundingSupport{support("text", 0, 0), support("text", 0)}},
+			content: "text",
+			want:    []Annotation{citation(0, 4, "a")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildAnnotations(tt.meta, tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("annotations = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeGrounding(t *testing.T) {
+	first := &GroundingMetadata{
+		WebSearchQueries:  []string{"q1"},
+		GroundingChunks:   webChunks("a", "b"),
+		GroundingSupports: []GroundingSupport{support("one", 0, 1)},
+	}
+	second := &GroundingMetadata{
+		WebSearchQueries:  []string{"q2"},
+		GroundingChunks:   webChunks("c"),
+		GroundingSupports: []GroundingSupport{support("two", 0)},
+	}
+
+	if MergeGrounding(nil, second) != second || MergeGrounding(first, nil) != first {
+		t.Fatal("merge with nil should return the other side")
+	}
+
+	merged := MergeGrounding(first, second)
+	if !reflect.DeepEqual(merged.WebSearchQueries, []string{"q1", "q2"}) {
+		t.Errorf("queries = %v", merged.WebSearchQueries)
+	}
+	if !reflect.DeepEqual(merged.GroundingChunks, webChunks("a", "b", "c")) {
+		t.Errorf("chunks = %+v", merged.GroundingChunks)
+	}
+	// 后出现的片段引用的来源索引按前面的来源数量偏移
+	want := []GroundingSupport{support("one", 0, 1), support("two", 2)}
+	if !reflect.DeepEqual(merged.GroundingSupports, want) {
+		t.Errorf("supports = %+v, want %+v", merged.GroundingSupports, want)
+	}
+	// 不修改输入
+	if !reflect.DeepEqual(second.GroundingSupports, []GroundingSupport{support("two", 0)}) || len(first.GroundingChunks) != 2 {
+		t.Error("inputs modified")
+	}
+
+	got := BuildAnnotations(merged, "one two")
+	if !reflect.DeepEqual(got, []Annotation{citation(0, 3, "a"), citation(0, 3, "b"), citation(4, 7, "c")}) {
+		t.Errorf("annotations = %+v", got)
+	}
+}
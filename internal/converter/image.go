@@ -0,0 +1,330 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // 注册 GIF 解码器
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+
+	"anti2api-golang/internal/config"
+)
+
+// 按文件头识别的图片格式
+const (
+	mimePNG  = "image/png"
+	mimeJPEG = "image/jpeg"
+	mimeGIF  = "image/gif"
+	mimeWEBP = "image/webp"
+	mimeHEIC = "image/heic"
+	mimeHEIF = "image/heif"
+	mimeAVIF = "image/avif"
+	mimeBMP  = "image/bmp"
+	mimeTIFF = "image/tiff"
+)
+
+// imageHeadSize 识别格式需要的文件头字节数
+const imageHeadSize = 16
+
+// jpegResizeQuality 缩小后重新编码 JPEG 的质量
+const jpegResizeQuality = 85
+
+// sniffImageType 按文件头识别图片格式，无法识别时返回空字符串
+func sniffImageType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return mimePNG
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return mimeJPEG
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return mimeGIF
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return mimeWEBP
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		switch string(head[8:12]) {
+		case "heic", "heix", "hevc", "hevx", "heim", "heis":
+			return mimeHEIC
+		case "mif1", "msf1", "heif":
+			return mimeHEIF
+		case "avif", "avis":
+			return mimeAVIF
+		}
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return mimeTIFF
+	case len(head) >= 10 && string(head[0:2]) == "BM" && binary.LittleEndian.Uint32(head[6:10]) == 0:
+		// BMP 文件头只有 2 字节魔数，额外检查保留字段为 0
+		return mimeBMP
+	}
+	return ""
+}
+
+// imageSupported 后端支持的图片格式（GIF 按原样转发）
+func imageSupported(mime string) bool {
+	switch mime {
+	case mimePNG, mimeJPEG, mimeWEBP, mimeHEIC, mimeHEIF, mimeGIF:
+		return true
+	}
+	return false
+}
+
+// imageDataReader 流式解码 base64 图片数据（允许缺少填充和换行）
+func imageDataReader(data string) io.Reader {
+	return base64.NewDecoder(base64.RawStdEncoding, strings.NewReader(strings.TrimRight(data, "=")))
+}
+
+// imageHead 解码 base64 数据的开头部分
+func imageHead(data string) []byte {
+	head := make([]byte, imageHeadSize)
+	n, _ := io.ReadFull(imageDataReader(data), head)
+	return head[:n]
+}
+
+// normalizeImage 按文件头修正图片的 MIME 类型，转换或缩小图片；changes 描述所做的调整，
+// 无法识别或不支持的格式返回错误
+func normalizeImage(img *InlineData) (*InlineData, []string, error) {
+	var changes []string
+	detected := sniffImageType(imageHead(img.Data))
+	switch {
+	case detected == "":
+		return nil, nil, fmt.Errorf("unrecognized image data (labeled %s); supported formats are PNG, JPEG, WEBP, HEIC, HEIF and GIF", img.MimeType)
+	case detected == mimeBMP && config.Get().ImageTranscode:
+		converted, err := transcodeBMP(img.Data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to convert %s to PNG: %v", detected, err)
+		}
+		changes = append(changes, fmt.Sprintf("converted %s to %s", detected, mimePNG))
+		img = converted
+	case detected == mimeBMP:
+		return nil, nil, fmt.Errorf("%s images are not supported; enable IMAGE_TRANSCODE to convert them to PNG", detected)
+	case !imageSupported(detected):
+		return nil, nil, fmt.Errorf("%s images are not supported; supported formats are PNG, JPEG, WEBP, HEIC, HEIF and GIF", detected)
+	case !strings.EqualFold(detected, normalizeImageMime(img.MimeType)):
+		changes = append(changes, fmt.Sprintf("labeled %s but the data is %s, MIME type corrected", img.MimeType, detected))
+		img = &InlineData{MimeType: detected, Data: img.Data}
+	case img.MimeType != detected:
+		// 标签等价（如 image/jpg），统一为标准写法
+		img = &InlineData{MimeType: detected, Data: img.Data}
+	}
+
+	resized, change, err := downscaleImage(img)
+	if err != nil {
+		return nil, nil, err
+	}
+	if change != "" {
+		changes = append(changes, change)
+	}
+	return resized, changes, nil
+}
+
+// normalizeImageMime 统一 MIME 类型的常见别名
+func normalizeImageMime(mime string) string {
+	switch strings.ToLower(mime) {
+	case "image/jpg", "image/pjpeg":
+		return mimeJPEG
+	case "image/x-png":
+		return mimePNG
+	}
+	return mime
+}
+
+// downscaleImage 超过像素数或大小上限时等比缩小（仅 PNG/JPEG/GIF，GIF 取第一帧转为 PNG），未超出时原样返回
+func downscaleImage(img *InlineData) (*InlineData, string, error) {
+	cfg := config.Get()
+	maxPixels, maxBytes := cfg.ImageMaxPixels, cfg.ImageMaxKB*1024
+	if maxPixels <= 0 && maxBytes <= 0 {
+		return img, "", nil
+	}
+	if img.MimeType != mimePNG && img.MimeType != mimeJPEG && img.MimeType != mimeGIF {
+		return img, "", nil
+	}
+
+	imgCfg, _, err := image.DecodeConfig(imageDataReader(img.Data))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid %s image: %v", img.MimeType, err)
+	}
+	pixels := imgCfg.Width * imgCfg.Height
+	size := base64.RawStdEncoding.DecodedLen(len(strings.TrimRight(img.Data, "=")))
+	scale := 1.0
+	if maxPixels > 0 && pixels > maxPixels {
+		scale = math.Sqrt(float64(maxPixels) / float64(pixels))
+	}
+	if maxBytes > 0 && size > maxBytes {
+		scale = math.Min(scale, math.Sqrt(float64(maxBytes)/float64(size)))
+	}
+	if scale >= 1 {
+		return img, "", nil
+	}
+
+	src, _, err := image.Decode(imageDataReader(img.Data))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid %s image: %v", img.MimeType, err)
+	}
+	outMime := img.MimeType
+	if outMime == mimeGIF {
+		outMime = mimePNG
+	}
+
+	// 重新编码后的大小不与像素数严格成比例，超出时继续缩小
+	var encoded []byte
+	var bounds image.Rectangle
+	for attempt := 0; attempt < 4; attempt++ {
+		w := max(int(float64(imgCfg.Width)*scale), 1)
+		h := max(int(float64(imgCfg.Height)*scale), 1)
+		resized := resizeImage(src, w, h)
+		var buf bytes.Buffer
+		if outMime == mimeJPEG {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: jpegResizeQuality})
+		} else {
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to re-encode image: %v", err)
+		}
+		encoded, bounds = buf.Bytes(), resized.Bounds()
+		if maxBytes <= 0 || len(encoded) <= maxBytes {
+			break
+		}
+		scale *= 0.75
+	}
+
+	change := fmt.Sprintf("downscaled from %dx%d (%d KB) to %dx%d (%d KB)",
+		imgCfg.Width, imgCfg.Height, size/1024, bounds.Dx(), bounds.Dy(), len(encoded)/1024)
+	return &InlineData{MimeType: outMime, Data: base64.StdEncoding.EncodeToString(encoded)}, change, nil
+}
+
+// resizeImage 按区域平均缩小图片
+func resizeImage(src image.Image, w, h int) *image.RGBA {
+	sb := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || sb.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, sb.Dx(), sb.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, sb.Min, draw.Src)
+	}
+	sw, sh := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride+x0*4 : sy*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			off := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[off+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// transcodeBMP 将 BMP 图片转换为 PNG
+func transcodeBMP(data string) (*InlineData, error) {
+	raw, err := io.ReadAll(imageDataReader(data))
+	if err != nil {
+		return nil, err
+	}
+	img, err := decodeBMP(raw)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &InlineData{MimeType: mimePNG, Data: base64.StdEncoding.EncodeToString(buf.Bytes())}, nil
+}
+
+// decodeBMP 解码未压缩的 8/24/32 位 BMP（BI_RGB）
+func decodeBMP(raw []byte) (image.Image, error) {
+	if len(raw) < 54 {
+		return nil, errors.New("truncated BMP header")
+	}
+	le := binary.LittleEndian
+	offset := int(le.Uint32(raw[10:14]))
+	headerSize := int(le.Uint32(raw[14:18]))
+	width := int(int32(le.Uint32(raw[18:22])))
+	height := int(int32(le.Uint32(raw[22:26])))
+	bpp := int(le.Uint16(raw[28:30]))
+	compression := le.Uint32(raw[30:34])
+	colorsUsed := int(le.Uint32(raw[46:50]))
+
+	if headerSize < 40 || compression != 0 {
+		return nil, errors.New("only uncompressed BMP images can be converted")
+	}
+	topDown := height < 0
+	if topDown {
+		height = -height
+	}
+	if width <= 0 || height <= 0 || width*height > 1<<26 {
+		return nil, fmt.Errorf("invalid BMP size %dx%d", width, height)
+	}
+
+	var palette []color.RGBA
+	if bpp == 8 {
+		if colorsUsed == 0 {
+			colorsUsed = 256
+		}
+		start := 14 + headerSize
+		if colorsUsed > 256 || start+colorsUsed*4 > len(raw) {
+			return nil, errors.New("invalid BMP palette")
+		}
+		palette = make([]color.RGBA, colorsUsed)
+		for i := range palette {
+			p := raw[start+i*4:]
+			palette[i] = color.RGBA{R: p[2], G: p[1], B: p[0], A: 0xFF}
+		}
+	} else if bpp != 24 && bpp != 32 {
+		return nil, fmt.Errorf("unsupported BMP bit depth %d", bpp)
+	}
+
+	stride := (width*bpp/8 + 3) &^ 3
+	if offset < 0 || offset+stride*height > len(raw) {
+		return nil, errors.New("truncated BMP pixel data")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		srcY := height - 1 - y
+		if topDown {
+			srcY = y
+		}
+		row := raw[offset+srcY*stride:]
+		for x := 0; x < width; x++ {
+			var c color.RGBA
+			switch bpp {
+			case 8:
+				idx := int(row[x])
+				if idx >= len(palette) {
+					return nil, errors.New("invalid BMP palette index")
+				}
+				c = palette[idx]
+			case 24:
+				c = color.RGBA{R: row[x*3+2], G: row[x*3+1], B: row[x*3], A: 0xFF}
+			case 32:
+				// BI_RGB 的第 4 字节通常未使用，按不透明处理
+				c = color.RGBA{R: row[x*4+2], G: row[x*4+1], B: row[x*4], A: 0xFF}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,322 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/testutil"
+)
+
+// fixtureImage testdata/images 中的图片（base64）
+func fixtureImage(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "images", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// useImageConfig 在测试期间设置图片转换和缩小参数
+func useImageConfig(t *testing.T, transcode bool, maxPixels, maxKB int) {
+	t.Helper()
+	cfg := config.Get()
+	saved := *cfg
+	cfg.ImageTranscode = transcode
+	cfg.ImageMaxPixels = maxPixels
+	cfg.ImageMaxKB = maxKB
+	t.Cleanup(func() { *cfg = saved })
+}
+
+// decodeInline 解码图片数据
+func decodeInline(t *testing.T, img *InlineData) image.Image {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(img.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("decode %s: %v", img.MimeType, err)
+	}
+	return decoded
+}
+
+func TestSniffImageType(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"small.png", mimePNG},
+		{"small.jpg", mimeJPEG},
+		{"small.gif", mimeGIF},
+		{"header.webp", mimeWEBP},
+		{"header.heic", mimeHEIC},
+		{"header.heif", mimeHEIF},
+		{"header.avif", mimeAVIF},
+		{"header.tiff", mimeTIFF},
+		{"small24.bmp", mimeBMP},
+		{"checker8.bmp", mimeBMP},
+	}
+	for _, tt := range tests {
+		if got := sniffImageType(imageHead(fixtureImage(t, tt.file))); got != tt.want {
+			t.Errorf("%s: sniffed %q, want %q", tt.file, got, tt.want)
+		}
+	}
+
+	for _, head := range []string{"", "\x89PN", "hello world, not an image", "BM\x00\x00\x00\x00\x01\x00\x00\x00", "\x00\x00\x00\x18ftypisom"} {
+		if got := sniffImageType([]byte(head)); got != "" {
+			t.Errorf("sniffImageType(%q) = %q", head, got)
+		}
+	}
+}
+
+func TestImageHeadWithoutPadding(t *testing.T) {
+	// 缺少 base64 填充的数据同样可以识别
+	data := strings.TrimRight(fixtureImage(t, "small.png"), "=")
+	if got := sniffImageType(imageHead(data)); got != mimePNG {
+		t.Fatalf("sniffed %q", got)
+	}
+}
+
+func TestNormalizeImageMislabeled(t *testing.T) {
+	useImageConfig(t, false, 0, 0)
+	tests := []struct {
+		name    string
+		file    string
+		label   string
+		want    string
+		changed bool
+	}{
+		{"png labeled jpeg", "small.png", "image/jpeg", mimePNG, true},
+		{"jpeg labeled png", "small.jpg", "image/png", mimeJPEG, true},
+		{"heic labeled png", "header.heic", "image/png", mimeHEIC, true},
+		{"webp labeled gif", "header.webp", "image/gif", mimeWEBP, true},
+		{"correct label", "small.png", "image/png", mimePNG, false},
+		// 等价的别名只统一写法，不记录调整
+		{"jpg alias", "small.jpg", "image/jpg", mimeJPEG, false},
+		{"upper case", "small.jpg", "image/JPEG", mimeJPEG, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := fixtureImage(t, tt.file)
+			out, changes, err := normalizeImage(&InlineData{MimeType: tt.label, Data: data})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.MimeType != tt.want || out.Data != data {
+				t.Fatalf("normalized to %s (data changed: %v)", out.MimeType, out.Data != data)
+			}
+			if tt.changed != (len(changes) == 1) || tt.changed && changes[0] != "labeled "+tt.label+" but the data is "+tt.want+", MIME type corrected" {
+				t.Fatalf("changes = %q", changes)
+			}
+		})
+	}
+}
+
+func TestNormalizeImageRejectsUnsupported(t *testing.T) {
+	useImageConfig(t, false, 0, 0)
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"tiff", fixtureImage(t, "header.tiff"), "image/tiff images are not supported"},
+		{"avif", fixtureImage(t, "header.avif"), "image/avif images are not supported"},
+		{"bmp without transcode", fixtureImage(t, "small24.bmp"), "enable IMAGE_TRANSCODE"},
+		{"text", base64.StdEncoding.EncodeToString([]byte("definitely not an image")), "unrecognized image data (labeled image/png)"},
+		{"empty after decode", "====", "unrecognized image data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, _, err := normalizeImage(&InlineData{MimeType: "image/png", Data: tt.data})
+			if err == nil || !strings.Contains(err.Error(), tt.err) || out != nil {
+				t.Fatalf("normalizeImage = %v, %v; want error containing %q", out, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNormalizeImageTranscodesBMP(t *testing.T) {
+	useImageConfig(t, true, 0, 0)
+
+	out, changes, err := normalizeImage(&InlineData{MimeType: "image/png", Data: fixtureImage(t, "small24.bmp")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.MimeType != mimePNG || len(changes) != 1 || changes[0] != "converted image/bmp to image/png" {
+		t.Fatalf("converted = %s, changes %q", out.MimeType, changes)
+	}
+	img := decodeInline(t, out)
+	if b := img.Bounds(); b.Dx() != 5 || b.Dy() != 3 {
+		t.Fatalf("size = %v", b)
+	}
+	// 行顺序（自下而上）和行填充按原图还原
+	for _, p := range []struct{ x, y int }{{0, 0}, {4, 0}, {2, 1}, {4, 2}} {
+		want := color.RGBA{uint8(p.x * 50), uint8(p.y * 100), 7, 255}
+		if got := color.RGBAModel.Convert(img.At(p.x, p.y)); got != want {
+			t.Errorf("pixel (%d,%d) = %v, want %v", p.x, p.y, got, want)
+		}
+	}
+
+	// 8 位调色板、自上而下
+	out, _, err = normalizeImage(&InlineData{MimeType: "image/bmp", Data: fixtureImage(t, "checker8.bmp")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = decodeInline(t, out)
+	red, black := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 0, 255}
+	if color.RGBAModel.Convert(img.At(0, 0)) != red || color.RGBAModel.Convert(img.At(1, 0)) != black || color.RGBAModel.Convert(img.At(1, 1)) != red {
+		t.Fatalf("checker pixels = %v %v %v", img.At(0, 0), img.At(1, 0), img.At(1, 1))
+	}
+
+	// 无法转换的 BMP
+	truncated := fixtureImage(t, "small24.bmp")[:40]
+	if _, _, err := normalizeImage(&InlineData{MimeType: "image/bmp", Data: truncated}); err == nil || !strings.Contains(err.Error(), "failed to convert image/bmp to PNG") {
+		t.Fatalf("truncated BMP error = %v", err)
+	}
+}
+
+func TestDownscaleImagePixelBudget(t *testing.T) {
+	useImageConfig(t, false, 300_000, 0)
+
+	out, changes, err := normalizeImage(&InlineData{MimeType: "image/png", Data: fixtureImage(t, "large.png")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := decodeInline(t, out).Bounds()
+	if b.Dx()*b.Dy() > 300_000 || b.Dx() < 600 || out.MimeType != mimePNG {
+		t.Fatalf("downscaled to %dx%d %s", b.Dx(), b.Dy(), out.MimeType)
+	}
+	// 保持宽高比（2000x1500）
+	if ratio := float64(b.Dx()) / float64(b.Dy()); ratio < 1.32 || ratio > 1.35 {
+		t.Fatalf("aspect ratio = %.3f", ratio)
+	}
+	if len(changes) != 1 || !strings.HasPrefix(changes[0], "downscaled from 2000x1500 ") {
+		t.Fatalf("changes = %q", changes)
+	}
+
+	// 未超出上限的图片原样返回
+	small := fixtureImage(t, "small.png")
+	if out, changes, _ := normalizeImage(&InlineData{MimeType: "image/png", Data: small}); out.Data != small || len(changes) != 0 {
+		t.Fatalf("small image changed: %q", changes)
+	}
+}
+
+func TestDownscaleImageByteBudget(t *testing.T) {
+	useImageConfig(t, false, 0, 20)
+
+	for _, tt := range []struct{ file, mime string }{{"noise.png", mimePNG}, {"noise.jpg", mimeJPEG}} {
+		t.Run(tt.file, func(t *testing.T) {
+			out, changes, err := normalizeImage(&InlineData{MimeType: tt.mime, Data: fixtureImage(t, tt.file)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw, _ := base64.StdEncoding.DecodeString(out.Data)
+			if len(raw) > 20*1024 || out.MimeType != tt.mime || len(changes) != 1 {
+				t.Fatalf("%d bytes %s, changes %q", len(raw), out.MimeType, changes)
+			}
+			if b := decodeInline(t, out).Bounds(); b.Dx() >= 160 || b.Dx() != b.Dy() {
+				t.Fatalf("size = %v", b)
+			}
+		})
+	}
+}
+
+func TestDownscaleImageFormats(t *testing.T) {
+	useImageConfig(t, false, 20, 0)
+
+	// GIF 取第一帧转为 PNG
+	out, _, err := normalizeImage(&InlineData{MimeType: "image/gif", Data: fixtureImage(t, "small.gif")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.MimeType != mimePNG || decodeInline(t, out).Bounds().Dx()*decodeInline(t, out).Bounds().Dy() > 20 {
+		t.Fatalf("gif downscaled to %s", out.MimeType)
+	}
+
+	// 无法解码的格式不缩小
+	webp := fixtureImage(t, "header.webp")
+	if out, changes, err := normalizeImage(&InlineData{MimeType: "image/webp", Data: webp}); err != nil || out.Data != webp || len(changes) != 0 {
+		t.Fatalf("webp = %v %q %v", out.MimeType, changes, err)
+	}
+
+	// 文件头正确但内容损坏
+	corrupt := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\ngarbage garbage garbage"))
+	if _, _, err := normalizeImage(&InlineData{MimeType: "image/png", Data: corrupt}); err == nil || !strings.Contains(err.Error(), "invalid image/png image") {
+		t.Fatalf("corrupt PNG error = %v", err)
+	}
+}
+
+func TestResizeImageAverages(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.Set(0, 0, color.RGBA{200, 0, 0, 255})
+	src.Set(1, 0, color.RGBA{0, 100, 0, 255})
+	src.Set(0, 1, color.RGBA{0, 0, 40, 255})
+	src.Set(1, 1, color.RGBA{0, 0, 0, 255})
+	dst := resizeImage(src, 1, 1)
+	if got := dst.RGBAAt(0, 0); got != (color.RGBA{50, 25, 10, 255}) {
+		t.Fatalf("average = %v", got)
+	}
+
+	// 原点不为 0 的子图
+	sub := src.SubImage(image.Rect(1, 1, 2, 2))
+	if got := resizeImage(sub, 1, 1).RGBAAt(0, 0); got != (color.RGBA{0, 0, 0, 255}) {
+		t.Fatalf("sub image = %v", got)
+	}
+}
+
+// imageRequest 包含一张图片的请求
+func imageRequest(mime, data string) *OpenAIChatRequest {
+	return &OpenAIChatRequest{
+		Model: "gemini-2.5-flash",
+		Messages: []OpenAIMessage{{Role: "user", Content: []interface{}{
+			map[string]interface{}{"type": "text", "text": "What is this?"},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:" + mime + ";base64," + data}},
+		}}},
+	}
+}
+
+func TestConversionImageIssues(t *testing.T) {
+	useStrictConversion(t, true)
+	useImageConfig(t, false, 300_000, 0)
+	const param = "messages[0].content[1].image_url.url"
+
+	// 修正类型不受严格模式影响
+	result := CheckConversion(imageRequest("image/jpeg", fixtureImage(t, "small.png")))
+	if result.Err() != nil || len(result.Issues) != 1 || result.Issues[0].Code != IssueImageNormalized || result.Issues[0].Param != param {
+		t.Fatalf("mislabeled issues = %+v", result.Issues)
+	}
+
+	result = CheckConversion(imageRequest("image/png", fixtureImage(t, "header.tiff")))
+	if issue := result.Err(); issue == nil || issue.Code != IssueUnsupportedImage || issue.Param != param {
+		t.Fatalf("tiff issue = %+v", issue)
+	}
+
+	// 转换后的请求使用修正后的类型；缩小后的图片写回请求，再次转换不重复缩小
+	req := imageRequest("image/jpeg", fixtureImage(t, "large.png"))
+	account := testutil.Account("images")
+	converted := ConvertOpenAIToAntigravity(req, &account)
+	inline := converted.Request.Contents[0].Parts[1].InlineData
+	if inline == nil || inline.MimeType != mimePNG {
+		t.Fatalf("converted part = %+v", converted.Request.Contents[0].Parts[1])
+	}
+	url := req.Messages[0].Content.([]interface{})[1].(map[string]interface{})["image_url"].(map[string]interface{})["url"].(string)
+	if url != "data:image/png;base64,"+inline.Data {
+		t.Fatal("downscaled image not written back to the request")
+	}
+	if result := CheckConversion(req); len(result.Issues) != 0 {
+		t.Fatalf("second conversion issues = %+v", result.Issues)
+	}
+	if _, err := png.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(inline.Data))); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,104 @@
+package converter
+
+import (
+	"fmt"
+
+	"anti2api-golang/internal/config"
+)
+
+// 转换问题代码
+const (
+	IssueInvalidToolArguments = "invalid_tool_arguments" // assistant 历史中的工具参数不是合法 JSON
+	IssueInvalidImage         = "invalid_image"          // 图片无法解析（仅支持 data:image/...;base64）
+	IssueUnresolvedToolCall   = "unresolved_tool_call"   // tool 消息的 tool_call_id 找不到对应调用
+	IssueUnknownContentPart   = "unknown_content_part"   // 不支持的内容类型
+	IssueUnknownRole          = "unknown_role"           // 不支持的消息角色
+	IssueMissingToolName      = "missing_tool_name"      // 工具定义缺少函数名
+	IssueToolLimitExceeded    = "tool_limit_exceeded"    // 工具声明超过数量、描述长度或 schema 限制，已截断
+	IssueParamNormalized      = "param_normalized"       // 采样参数按模型支持范围调整（不受严格模式影响）
+	IssueToolResultTruncated  = "tool_result_truncated"  // tool 结果超过大小上限，已截断（不受严格模式影响）
+	IssueToolResultTooLarge   = "tool_result_too_large"  // tool 结果超过大小上限（reject 模式）
+	IssueInvalidParam         = "invalid_param"          // 参数值无效
+	IssueEmptyMessages        = "empty_messages"         // 消息中没有非空白文本、图片、工具调用或工具结果
+	IssueTrailingAssistant    = "trailing_assistant"     // 最后一条消息是 assistant，模型不支持预填充
+	IssueUnsupportedImage     = "unsupported_image"      // 图片数据无法识别或格式不受支持
+	IssueImageNormalized      = "image_normalized"       // 图片的 MIME 类型已按实际格式修正，或已转换、缩小（不受严格模式影响）
+)
+
+// ConversionIssue 转换中发现的问题（Param 指向请求中的具体位置）
+type ConversionIssue struct {
+	Code    string `json:"code"`
+	Param   string `json:"param"`
+	Message string `json:"message"`
+	Fatal   bool   `json:"fatal"`
+}
+
+func (i ConversionIssue) Error() string {
+	return fmt.Sprintf("%s: %s", i.Param, i.Message)
+}
+
+// ConversionResult 收集转换中的警告和错误（nil 时忽略所有问题）
+type ConversionResult struct {
+	Issues []ConversionIssue
+	strict bool
+}
+
+func (r *ConversionResult) add(fatal bool, code, param, format string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+	r.Issues = append(r.Issues, ConversionIssue{
+		Code:    code,
+		Param:   param,
+		Message: fmt.Sprintf(format, args...),
+		Fatal:   fatal,
+	})
+}
+
+// warn 记录警告（严格模式下视为错误）
+func (r *ConversionResult) warn(code, param, format string, args ...interface{}) {
+	r.add(r != nil && r.strict, code, param, format, args...)
+}
+
+// note 记录说明（参数已调整但请求仍按预期处理，严格模式下也不是错误）
+func (r *ConversionResult) note(code, param, format string, args ...interface{}) {
+	r.add(false, code, param, format, args...)
+}
+
+// fail 记录错误
+func (r *ConversionResult) fail(code, param, format string, args ...interface{}) {
+	r.add(true, code, param, format, args...)
+}
+
+// Err 返回第一个错误（*ConversionIssue），没有错误时返回 nil
+func (r *ConversionResult) Err() *ConversionIssue {
+	for i := range r.Issues {
+		if r.Issues[i].Fatal {
+			return &r.Issues[i]
+		}
+	}
+	return nil
+}
+
+// Warnings 返回非致命问题的描述
+func (r *ConversionResult) Warnings() []string {
+	var warnings []string
+	for _, issue := range r.Issues {
+		if !issue.Fatal {
+			warnings = append(warnings, issue.Error())
+		}
+	}
+	return warnings
+}
+
+// CheckConversion 检查请求转换中会被丢弃或降级的内容（STRICT_CONVERSION 开启时所有问题都是错误）
+func CheckConversion(req *OpenAIChatRequest) *ConversionResult {
+	result := &ConversionResult{strict: config.Get().StrictConversion}
+	modelName := ResolveModelName(req.Model)
+	hasHistoryFunctionCalls := hasToolCallsInHistory(req.Messages) && !GetModelConfig(modelName).EffectiveReplayThoughts()
+	checkMessageContent(req.Messages, GetModelConfig(modelName), result)
+	convertMessages(req.Messages, false, req.ToolResults, result)
+	req.sanitizedTools(result)
+	buildGenerationConfig(req, modelName, hasHistoryFunctionCalls, result)
+	return result
+}
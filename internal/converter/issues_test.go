@@ -0,0 +1,171 @@
+package converter
+
+import (
+	"testing"
+
+	"anti2api-golang/internal/config"
+)
+
+// useStrictConversion 在测试期间设置 STRICT_CONVERSION
+func useStrictConversion(t *testing.T, strict bool) {
+	t.Helper()
+	cfg := config.Get()
+	previous := cfg.StrictConversion
+	cfg.StrictConversion = strict
+	t.Cleanup(func() { cfg.StrictConversion = previous })
+}
+
+// degradedRequests 每个请求触发一个转换降级（code 与 param 为期望的问题）
+var degradedRequests = []struct {
+	name     string
+	code     string
+	param    string
+	messages []OpenAIMessage
+}{
+	{
+		name:  "bad tool arguments",
+		code:  IssueInvalidToolArguments,
+		param: "messages[1].tool_calls[0].function.arguments",
+		messages: []OpenAIMessage{
+			{Role: "user", Content: "weather?"},
+			{Role: "assistant", ToolCalls: []OpenAIToolCall{{ID: "call-1", Type: "function", Function: OpenAIFunctionCall{Name: "weather", Arguments: `{"city":`}}}},
+			{Role: "tool", ToolCallID: "call-1", Content: "sunny"},
+			{Role: "user", Content: "thanks"},
+		},
+	},
+	{
+		name:  "unparseable image",
+		code:  IssueInvalidImage,
+		param: "messages[0].content[1].image_url.url",
+		messages: []OpenAIMessage{{Role: "user", Content: []interface{}{
+			map[string]interface{}{"type": "text", "text": "what is this?"},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/cat.png"}},
+		}}},
+	},
+	{
+		name:  "unresolved tool call id",
+		code:  IssueUnresolvedToolCall,
+		param: "messages[1].tool_call_id",
+		messages: []OpenAIMessage{
+			{Role: "user", Content: "weather?"},
+			{Role: "tool", ToolCallID: "call-missing", Content: "sunny"},
+			{Role: "user", Content: "thanks"},
+		},
+	},
+	{
+		name:  "unknown content type",
+		code:  IssueUnknownContentPart,
+		param: "messages[0].content[0].type",
+		messages: []OpenAIMessage{{Role: "user", Content: []interface{}{
+			map[string]interface{}{"type": "input_audio", "input_audio": map[string]interface{}{"data": "AAAA"}},
+			map[string]interface{}{"type": "text", "text": "transcribe"},
+		}}},
+	},
+	{
+		name:  "content part not an object",
+		code:  IssueUnknownContentPart,
+		param: "messages[0].content[1]",
+		messages: []OpenAIMessage{{Role: "user", Content: []interface{}{
+			map[string]interface{}{"type": "text", "text": "hi"},
+			"loose string",
+		}}},
+	},
+	{
+		name:  "unknown role",
+		code:  IssueUnknownRole,
+		param: "messages[0].role",
+		messages: []OpenAIMessage{
+			{Role: "developer-notes", Content: "ignored"},
+			{Role: "user", Content: "hi"},
+		},
+	},
+}
+
+// onlyIssue 检查结果中只有一个问题，返回该问题
+func onlyIssue(t *testing.T, result *ConversionResult) ConversionIssue {
+	t.Helper()
+	if len(result.Issues) != 1 {
+		t.Fatalf("issues = %+v, want exactly one", result.Issues)
+	}
+	return result.Issues[0]
+}
+
+func TestConversionWarnings(t *testing.T) {
+	useStrictConversion(t, false)
+	for _, tc := range degradedRequests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := CheckConversion(&OpenAIChatRequest{Model: "gemini-2.5-flash", Messages: tc.messages})
+			issue := onlyIssue(t, result)
+			if issue.Code != tc.code || issue.Param != tc.param || issue.Fatal {
+				t.Errorf("issue = %+v, want warning %s at %s", issue, tc.code, tc.param)
+			}
+			if result.Err() != nil {
+				t.Errorf("Err = %v, want no error", result.Err())
+			}
+			if warnings := result.Warnings(); len(warnings) != 1 || warnings[0] != issue.Error() {
+				t.Errorf("warnings = %q", warnings)
+			}
+		})
+	}
+}
+
+func TestStrictConversionTurnsWarningsIntoErrors(t *testing.T) {
+	useStrictConversion(t, true)
+	for _, tc := range degradedRequests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := CheckConversion(&OpenAIChatRequest{Model: "gemini-2.5-flash", Messages: tc.messages})
+			err := result.Err()
+			if err == nil || err.Code != tc.code || err.Param != tc.param {
+				t.Fatalf("Err = %+v, want %s at %s", err, tc.code, tc.param)
+			}
+			if len(result.Warnings()) != 0 {
+				t.Errorf("warnings = %q, want none in strict mode", result.Warnings())
+			}
+		})
+	}
+
+	// 参数调整只是说明，严格模式下也不是错误
+	temperature := 1.5
+	result := CheckConversion(&OpenAIChatRequest{
+		Model:       "claude-sonnet-4-5",
+		Messages:    []OpenAIMessage{{Role: "user", Content: "hi"}},
+		Temperature: &temperature,
+	})
+	if result.Err() != nil {
+		t.Errorf("parameter normalization failed in strict mode: %v", result.Err())
+	}
+}
+
+func TestMissingToolNameIsError(t *testing.T) {
+	useStrictConversion(t, false)
+	result := CheckConversion(&OpenAIChatRequest{
+		Model:    "gemini-2.5-flash",
+		Messages: []OpenAIMessage{{Role: "user", Content: "hi"}},
+		Tools: []OpenAITool{
+			{Type: "function", Function: OpenAIFunction{Name: "weather"}},
+			{Type: "function", Function: OpenAIFunction{Description: "no name"}},
+		},
+	})
+	err := result.Err()
+	if err == nil || err.Code != IssueMissingToolName || err.Param != "tools[1].function.name" {
+		t.Errorf("Err = %+v, want missing_tool_name at tools[1].function.name", err)
+	}
+}
+
+func TestDegradedConversionOutput(t *testing.T) {
+	// 降级的内容按原有方式转换：参数替换为 {}，无法解析的图片和未知内容被丢弃
+	contents := convertMessages(degradedRequests[0].messages, false, ToolResultPolicy{}, nil)
+	if args := string(contents[1].Parts[0].FunctionCall.Args); args != "{}" {
+		t.Errorf("bad arguments sent as %s, want {}", args)
+	}
+
+	contents = convertMessages(degradedRequests[1].messages, false, ToolResultPolicy{}, nil)
+	if len(contents[0].Parts) != 1 || contents[0].Parts[0].Text != "what is this?" {
+		t.Errorf("parts = %+v, want only the text", contents[0].Parts)
+	}
+
+	contents = convertMessages(degradedRequests[5].messages, false, ToolResultPolicy{}, nil)
+	if len(contents) != 1 || contents[0].Role != "user" {
+		t.Errorf("contents = %+v, want the unknown role dropped", contents)
+	}
+}
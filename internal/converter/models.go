@@ -1,12 +1,22 @@
 package converter
 
-import "strings"
+import (
+	"strings"
+)
 
 // Model 模型定义
 type Model struct {
 	ID      string `json:"id"`
 	OwnedBy string `json:"owned_by"`
 	Object  string `json:"object"`
+
+	// 生效的限制（来自模型配置注册表）
+	MaxOutputTokens int  `json:"max_output_tokens,omitempty"`
+	ThinkingBudget  *int `json:"thinking_budget,omitempty"`
+
+	// 能力（声明值，有探测结果时以探测结果为准）及声明与探测结果不一致的说明
+	Capabilities         map[string]ModelCapability `json:"capabilities,omitempty"`
+	CapabilityMismatches []string                   `json:"capability_mismatches,omitempty"`
 }
 
 // SupportedModels 支持的模型列表
@@ -26,6 +36,36 @@ var SupportedModels = []Model{
 	{ID: "claude-sonnet-4-5-thinking", OwnedBy: "anthropic", Object: "model"},
 }
 
+// ModelDisplayName 由模型 ID 生成展示名（如 claude-sonnet-4-5-thinking → Claude Sonnet 4.5 Thinking）
+func ModelDisplayName(id string) string {
+	var words []string
+	for _, token := range strings.Split(id, "-") {
+		if token == "" {
+			continue
+		}
+		// 连续的数字段合并为版本号
+		if isDigits(token) && len(words) > 0 && isVersion(words[len(words)-1]) {
+			words[len(words)-1] += "." + token
+			continue
+		}
+		words = append(words, strings.ToUpper(token[:1])+token[1:])
+	}
+	return strings.Join(words, " ")
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isVersion(s string) bool {
+	return isDigits(strings.ReplaceAll(s, ".", ""))
+}
+
 // ModelAliasMap 模型别名映射（bypass 模式）
 var ModelAliasMap = map[string]string{
 	"gemini-3-pro-high-bypass": "gemini-3-pro-high",
@@ -33,7 +73,7 @@ var ModelAliasMap = map[string]string{
 	"gemini-3-flash-bypass":    "gemini-3-flash",
 }
 
-// DefaultStopSequences 默认停止序列
+// DefaultStopSequences 默认停止序列（可在 models.json 中覆盖）
 var DefaultStopSequences = []string{
 	"<|user|>",
 	"<|bot|>",
@@ -90,32 +130,15 @@ func ShouldEnableThinking(modelName string, thinkingConfig *ThinkingConfig) bool
 	return false
 }
 
-// BuildThinkingConfig 构建思考配置
+// BuildThinkingConfig 构建思考配置（thinkingBudget 来自模型配置注册表，0 表示由后端决定）
 func BuildThinkingConfig(modelName string) *ThinkingConfig {
-	actualModel := ResolveModelName(modelName)
-
-	if strings.HasPrefix(actualModel, "gemini-3-pro-") {
-		// Gemini 3 Pro：不传 thinkingBudget，让后端决定
-		return &ThinkingConfig{IncludeThoughts: true}
-	}
-
-	if IsClaudeModel(actualModel) {
-		// Claude：thinkingBudget 默认 32000
-		return &ThinkingConfig{
-			IncludeThoughts: true,
-			ThinkingBudget:  32000,
-		}
-	}
-
-	// 其他模型默认
 	return &ThinkingConfig{
 		IncludeThoughts: true,
-		ThinkingBudget:  1024,
+		ThinkingBudget:  GetModelConfig(modelName).EffectiveThinkingBudget(),
 	}
 }
 
 // GetClaudeMaxOutputTokens 获取 Claude 模型最大输出 Token
 func GetClaudeMaxOutputTokens(modelName string) int {
-	// 统一返回 64000
-	return 64000
+	return GetModelConfig(modelName).EffectiveMaxOutputTokens()
 }
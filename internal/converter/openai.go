@@ -3,11 +3,11 @@ package converter
 import (
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
 
 	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/postprocess"
 	"anti2api-golang/internal/store"
 	"anti2api-golang/internal/utils"
 )
@@ -23,11 +23,14 @@ func ConvertOpenAIToAntigravity(req *OpenAIChatRequest, account *store.Account)
 		UserAgent: config.Get().UserAgent,
 	}
 
+	modelConfig := GetModelConfig(modelName)
+
 	// 检查是否有历史函数调用（需要禁用 thinking 模式以避免 thought_signature 问题）
-	hasHistoryFunctionCalls := hasToolCallsInHistory(req.Messages)
+	// 启用 replay_thoughts 的模型会重建 thought Part，无需禁用
+	hasHistoryFunctionCalls := hasToolCallsInHistory(req.Messages) && !modelConfig.EffectiveReplayThoughts()
 
 	// 转换消息
-	contents := convertMessages(req.Messages)
+	contents := convertMessages(req.Messages, modelConfig.EffectiveReplayThoughts(), req.ToolResults, nil)
 
 	// 构建内部请求
 	innerReq := AntigravityInnerReq{
@@ -35,26 +38,25 @@ func ConvertOpenAIToAntigravity(req *OpenAIChatRequest, account *store.Account)
 		SessionID: account.SessionID,
 	}
 
-	// 提取系统消息
-	systemText := extractSystemInstruction(req.Messages)
+	// 提取系统消息（开启压缩时去除多余空白或替换为引用说明）
+	systemText, compression := compressSystemPrompt(extractSystemInstruction(req.Messages), account, modelConfig)
+	req.Compression = compression
 	if systemText != "" {
-		innerReq.SystemInstruction = &SystemInstruction{
-			Parts: []Part{{Text: systemText}},
+		if modelConfig.EffectiveSystemInContents() {
+			// 部分模型不接受 systemInstruction，改为注入首个 user 消息
+			innerReq.Contents = injectSystemIntoContents(innerReq.Contents, systemText)
+		} else {
+			innerReq.SystemInstruction = &SystemInstruction{
+				Parts: []Part{{Text: systemText}},
+			}
 		}
 	}
 
-	// 转换工具
-	if len(req.Tools) > 0 {
-		innerReq.Tools = convertTools(req.Tools)
-		innerReq.ToolConfig = &ToolConfig{
-			FunctionCallingConfig: &FunctionCallingConfig{
-				Mode: "AUTO",
-			},
-		}
-	}
+	// 转换工具（空工具列表不发送 ToolConfig，后端会拒绝）
+	innerReq.Tools, innerReq.ToolConfig = normalizeTools(req)
 
 	// 构建生成配置（如果有历史函数调用，禁用 thinking 模式）
-	innerReq.GenerationConfig = buildGenerationConfig(req, modelName, hasHistoryFunctionCalls)
+	innerReq.GenerationConfig = buildGenerationConfig(req, modelName, hasHistoryFunctionCalls, nil)
 
 	antigravityReq.Request = innerReq
 	return antigravityReq
@@ -77,34 +79,51 @@ func getProjectID(account *store.Account) string {
 	return utils.GenerateProjectID()
 }
 
-func convertMessages(messages []OpenAIMessage) []Content {
-	var result []Content
+// convertMessages 转换消息，无法转换的内容记录到 issues（可为 nil）
+// 超过 toolResults 上限的 tool 结果按策略截断或记录错误
+func convertMessages(messages []OpenAIMessage, replayThoughts bool, toolResults ToolResultPolicy, issues *ConversionResult) []Content {
+	result := make([]Content, 0, len(messages))
 
-	for _, msg := range messages {
+	for i, msg := range messages {
+		// 问题定位只在收集问题时需要，避免为长对话的每条消息格式化字符串
+		var param string
+		if issues != nil {
+			param = fmt.Sprintf("messages[%d]", i)
+		}
 		switch msg.Role {
 		case "system":
 			// 跳过，单独处理到 systemInstruction
 			continue
 
 		case "user":
-			parts := extractParts(msg.Content)
+			parts := extractParts(msg.Content, param, issues)
 			result = append(result, Content{Role: "user", Parts: parts})
 
 		case "assistant":
-			parts := []Part{}
+			parts := make([]Part, 0, len(msg.ToolCalls)+2)
+			// 思考内容必须位于 functionCall 之前
+			if replayThoughts {
+				if thought := buildThoughtPart(msg); thought != nil {
+					parts = append(parts, *thought)
+				}
+			}
 			if text := getTextContent(msg.Content); text != "" {
 				parts = append(parts, Part{Text: text})
 			}
 			// 转换工具调用
-			for _, tc := range msg.ToolCalls {
-				args := parseArgs(tc.Function.Arguments)
+			for j, tc := range msg.ToolCalls {
+				args, err := parseArgs(tc.Function.Arguments)
+				if err != nil && issues != nil {
+					issues.warn(IssueInvalidToolArguments, fmt.Sprintf("%s.tool_calls[%d].function.arguments", param, j),
+						"arguments are not a valid JSON object, sending {} instead: %v", err)
+				}
 				parts = append(parts, Part{
 					FunctionCall: &FunctionCall{
 						ID:   tc.ID,
 						Name: tc.Function.Name,
 						Args: args,
 					},
-					ThoughtSignature: tc.ThoughtSignature, // 回传签名（API必需）
+					ThoughtSignature: signatureFor(tc.ThoughtSignature, tc.ID), // 回传签名（API必需，可能来自其他协议的载体）
 				})
 			}
 			if len(parts) > 0 {
@@ -114,56 +133,150 @@ func convertMessages(messages []OpenAIMessage) []Content {
 		case "tool":
 			// 查找对应的 function name
 			funcName := findFunctionName(result, msg.ToolCallID)
+			if funcName == "" {
+				issues.warn(IssueUnresolvedToolCall, param+".tool_call_id",
+					"no preceding assistant tool call with id %q", msg.ToolCallID)
+			}
 			part := Part{
 				FunctionResponse: &FunctionResponse{
 					ID:   msg.ToolCallID,
 					Name: funcName,
 					Response: map[string]interface{}{
-						"output": getTextContent(msg.Content),
+						"output": limitToolResult(getTextContent(msg.Content), toolResults, param+".content", issues),
 					},
 				},
 			}
 			// 合并到上一个 user 消息或新建
 			appendFunctionResponse(&result, part)
+
+		default:
+			issues.warn(IssueUnknownRole, param+".role", "unsupported role %q, message dropped", msg.Role)
 		}
 	}
 
 	return result
 }
 
-func extractSystemInstruction(messages []OpenAIMessage) string {
+// UserMessageTexts 提取所有 user 消息的文本内容
+func UserMessageTexts(messages []OpenAIMessage) []string {
 	var texts []string
+	for _, msg := range messages {
+		if msg.Role == "user" {
+			if text := getTextContent(msg.Content); text != "" {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return texts
+}
+
+// buildThoughtPart 根据历史 assistant 消息中的 reasoning 重建 thought Part
+// 签名取自该消息的首个工具调用（如果有）
+func buildThoughtPart(msg OpenAIMessage) *Part {
+	reasoning := msg.Reasoning
+	if reasoning == "" {
+		reasoning = msg.ReasoningContent
+	}
+	if reasoning == "" {
+		return nil
+	}
+
+	part := &Part{Text: reasoning, Thought: true}
+	for _, tc := range msg.ToolCalls {
+		if sig := signatureFor(tc.ThoughtSignature, tc.ID); sig != "" {
+			part.ThoughtSignature = sig
+			break
+		}
+	}
+	return part
+}
+
+func extractSystemInstruction(messages []OpenAIMessage) string {
+	var sb strings.Builder
+	first := true
 	for _, msg := range messages {
 		if msg.Role == "system" {
-			texts = append(texts, getTextContent(msg.Content))
+			if !first {
+				sb.WriteString("\n\n")
+			}
+			sb.WriteString(getTextContent(msg.Content))
+			first = false
 		}
 	}
-	return strings.Join(texts, "\n\n")
+	return sb.String()
 }
 
-func extractParts(content interface{}) []Part {
+// systemContentSeparator 注入到 user 消息中的系统提示与正文之间的分隔
+const systemContentSeparator = "\n\n"
+
+// injectSystemIntoContents 将系统提示作为首个 user 消息的第一个 Part
+// 如果对话中没有 user 消息，则在开头插入一条只包含系统提示的 user 消息
+func injectSystemIntoContents(contents []Content, systemText string) []Content {
+	for i := range contents {
+		if contents[i].Role != "user" {
+			continue
+		}
+		parts := make([]Part, 0, len(contents[i].Parts)+1)
+		parts = append(parts, Part{Text: systemText + systemContentSeparator})
+		parts = append(parts, contents[i].Parts...)
+		contents[i].Parts = parts
+		return contents
+	}
+
+	return append([]Content{{Role: "user", Parts: []Part{{Text: systemText}}}}, contents...)
+}
+
+// extractParts 转换消息内容，param 为消息在请求中的位置（用于问题定位）
+func extractParts(content interface{}, param string, issues *ConversionResult) []Part {
 	var parts []Part
 
 	switch v := content.(type) {
 	case string:
 		parts = append(parts, Part{Text: v})
 	case []interface{}:
-		for _, item := range v {
-			if m, ok := item.(map[string]interface{}); ok {
-				switch m["type"] {
-				case "text":
-					if text, ok := m["text"].(string); ok {
-						parts = append(parts, Part{Text: text})
-					}
-				case "image_url":
-					if imgURL, ok := m["image_url"].(map[string]interface{}); ok {
-						if url, ok := imgURL["url"].(string); ok {
-							if inlineData := parseImageURL(url); inlineData != nil {
-								parts = append(parts, Part{InlineData: inlineData})
-							}
-						}
-					}
+		parts = make([]Part, 0, len(v))
+		for i, item := range v {
+			var partParam string
+			if issues != nil {
+				partParam = fmt.Sprintf("%s.content[%d]", param, i)
+			}
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				issues.warn(IssueUnknownContentPart, partParam, "content part is not an object, dropped")
+				continue
+			}
+			switch m["type"] {
+			case "text":
+				if text, ok := m["text"].(string); ok {
+					parts = append(parts, Part{Text: text})
+				}
+			case "image_url":
+				url := ""
+				imgURL, _ := m["image_url"].(map[string]interface{})
+				if imgURL != nil {
+					url, _ = imgURL["url"].(string)
+				}
+				inlineData := parseImageURL(url)
+				if inlineData == nil {
+					issues.warn(IssueInvalidImage, partParam+".image_url.url",
+						"only data:image/<format>;base64 URLs are supported, image dropped")
+					continue
 				}
+				normalized, changes, err := normalizeImage(inlineData)
+				if err != nil {
+					issues.fail(IssueUnsupportedImage, partParam+".image_url.url", "%v", err)
+					continue
+				}
+				if len(changes) > 0 {
+					issues.note(IssueImageNormalized, partParam+".image_url.url", "%s", strings.Join(changes, "; "))
+				}
+				if normalized.Data != inlineData.Data {
+					// 写回请求，后续转换不再重复转换或缩小
+					imgURL["url"] = "data:" + normalized.MimeType + ";base64," + normalized.Data
+				}
+				parts = append(parts, Part{InlineData: normalized})
+			default:
+				issues.warn(IssueUnknownContentPart, partParam+".type", "unsupported content type %v, dropped", m["type"])
 			}
 		}
 	}
@@ -172,15 +285,29 @@ func extractParts(content interface{}) []Part {
 }
 
 func parseImageURL(url string) *InlineData {
-	// 解析 data:image/{format};base64,{data}
-	re := regexp.MustCompile(`^data:image/(\w+);base64,(.+)$`)
-	if matches := re.FindStringSubmatch(url); len(matches) == 3 {
-		return &InlineData{
-			MimeType: "image/" + matches[1],
-			Data:     matches[2],
+	// 解析 data:image/{format};base64,{data}（使用切片而非正则，避免大图复制与回溯）
+	rest, ok := strings.CutPrefix(url, "data:image/")
+	if !ok {
+		return nil
+	}
+	format, data, ok := strings.Cut(rest, ";base64,")
+	if !ok || format == "" || data == "" || !isWordString(format) {
+		return nil
+	}
+	return &InlineData{
+		MimeType: "image/" + format,
+		Data:     data,
+	}
+}
+
+func isWordString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
 		}
 	}
-	return nil
+	return true
 }
 
 func getTextContent(content interface{}) string {
@@ -188,27 +315,56 @@ func getTextContent(content interface{}) string {
 	case string:
 		return v
 	case []interface{}:
-		var texts []string
+		// 只有一段文本时直接返回，多段时按换行拼接
+		var first string
+		var sb strings.Builder
+		count := 0
 		for _, item := range v {
-			if m, ok := item.(map[string]interface{}); ok {
-				if m["type"] == "text" {
-					if text, ok := m["text"].(string); ok {
-						texts = append(texts, text)
-					}
-				}
+			m, ok := item.(map[string]interface{})
+			if !ok || m["type"] != "text" {
+				continue
 			}
+			text, ok := m["text"].(string)
+			if !ok {
+				continue
+			}
+			switch count {
+			case 0:
+				first = text
+			case 1:
+				sb.WriteString(first)
+				fallthrough
+			default:
+				sb.WriteByte('\n')
+				sb.WriteString(text)
+			}
+			count++
+		}
+		if count <= 1 {
+			return first
 		}
-		return strings.Join(texts, "\n")
+		return sb.String()
 	}
 	return ""
 }
 
-func parseArgs(argsStr string) map[string]interface{} {
+// parseArgs 校验工具参数并原样保留（不解码再编码），空字符串或 null 视为无参数；不是 JSON 对象时返回空对象和错误
+func parseArgs(argsStr string) (json.RawMessage, error) {
+	trimmed := strings.TrimSpace(argsStr)
+	if trimmed == "" || trimmed == "null" {
+		return json.RawMessage("{}"), nil
+	}
+	raw := []byte(trimmed)
+	if raw[0] == '{' && json.Valid(raw) {
+		return raw, nil
+	}
+	// 按原有方式解码以得到具体的错误信息
 	var args map[string]interface{}
-	if err := json.Unmarshal([]byte(argsStr), &args); err != nil {
-		return map[string]interface{}{}
+	err := json.Unmarshal(raw, &args)
+	if err == nil {
+		err = fmt.Errorf("arguments must be a JSON object")
 	}
-	return args
+	return json.RawMessage("{}"), err
 }
 
 func findFunctionName(contents []Content, toolCallID string) string {
@@ -245,19 +401,28 @@ func appendFunctionResponse(contents *[]Content, part Part) {
 	})
 }
 
-func convertTools(tools []OpenAITool) []Tool {
+// convertTools 转换工具定义，缺少函数名的工具记录为错误
+func convertTools(tools []OpenAITool, limits toolLimits, issues *ConversionResult) []Tool {
 	var result []Tool
 
-	for _, tool := range tools {
-		params := tool.Function.Parameters
-		// 移除 $schema 字段
-		delete(params, "$schema")
+	for i, tool := range tools {
+		param := fmt.Sprintf("tools[%d]", i)
+		// 超出数量上限时丢弃末尾的工具（保持原有顺序）
+		if limits.maxDeclarations > 0 && i >= limits.maxDeclarations {
+			issues.warn(IssueToolLimitExceeded, param, "%d tools exceed the limit of %d declarations, tools[%d:] dropped",
+				len(tools), limits.maxDeclarations, limits.maxDeclarations)
+			break
+		}
+		if tool.Function.Name == "" {
+			issues.fail(IssueMissingToolName, param+".function.name", "function name is required")
+		}
+		params := normalizeToolParameters(tool.Function.Parameters)
 
 		result = append(result, Tool{
 			FunctionDeclarations: []FunctionDeclaration{{
 				Name:        tool.Function.Name,
-				Description: tool.Function.Description,
-				Parameters:  params,
+				Description: limits.limitDescription(tool.Function.Description, param+".function.description", issues),
+				Parameters:  limits.limitSchema(params, 1, param+".function.parameters", issues),
 			}},
 		})
 	}
@@ -265,10 +430,27 @@ func convertTools(tools []OpenAITool) []Tool {
 	return result
 }
 
-func buildGenerationConfig(req *OpenAIChatRequest, modelName string, hasHistoryFunctionCalls bool) *GenerationConfig {
+// normalizeToolParameters 返回可发送给上游的参数 Schema（不修改客户端请求）：
+// 未提供、null 或空对象为无参数的对象 Schema，移除 $schema 字段，声明了的空 properties 保留
+func normalizeToolParameters(params ToolParameters) map[string]interface{} {
+	if len(params) == 0 {
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	result := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		if k != "$schema" {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// buildGenerationConfig 构建生成配置，采样参数按模型支持范围调整，调整记录到 issues（可为 nil）
+func buildGenerationConfig(req *OpenAIChatRequest, modelName string, hasHistoryFunctionCalls bool, issues *ConversionResult) *GenerationConfig {
+	modelConfig := GetModelConfig(modelName)
 	config := &GenerationConfig{
 		CandidateCount: 1,
-		StopSequences:  DefaultStopSequences,
+		StopSequences:  modelConfig.EffectiveStopSequences(),
 	}
 
 	// 添加自定义停止序列
@@ -276,49 +458,52 @@ func buildGenerationConfig(req *OpenAIChatRequest, modelName string, hasHistoryF
 		config.StopSequences = append(config.StopSequences, req.Stop...)
 	}
 
+	// 思考模式（如果有历史函数调用，禁用以避免 thought_signature 问题），请求可以调整预算或关闭思考
+	thinking := !hasHistoryFunctionCalls && ShouldEnableThinking(modelName, nil)
+	budget, thinking := planTokenBudget(req, modelConfig, thinking, issues)
+	req.TokenBudget = budget
+	config.MaxOutputTokens = budget.MaxOutputTokens
+	if thinking {
+		config.ThinkingConfig = &ThinkingConfig{IncludeThoughts: true, ThinkingBudget: budget.Thinking}
+	}
+	applyResponseFormat(req, config, issues)
+	applyExtraGenerationConfig(req, config, issues)
+
 	// Claude 模型特殊处理
 	if IsClaudeModel(modelName) {
-		config.MaxOutputTokens = GetClaudeMaxOutputTokens(modelName)
-		// Claude thinking 模式不支持 topP
-		// 如果有历史函数调用，禁用 thinking 模式以避免 thought_signature 问题
-		if !hasHistoryFunctionCalls && ShouldEnableThinking(modelName, nil) {
-			config.ThinkingConfig = BuildThinkingConfig(modelName)
+		if thinking {
+			// Claude thinking 模式只接受默认 temperature，且不支持 topP
+			dropSampling(req, issues, "not supported by %s in thinking mode", modelName)
+			return config
 		}
+		config.Temperature = normalizeTemperature(req.Temperature, modelConfig, issues)
+		if req.TopP != nil {
+			issues.note(IssueParamNormalized, "top_p", "top_p dropped: not supported by %s", modelName)
+		}
+		config.TopK = normalizeTopK(req.TopK, modelConfig, modelName, issues)
 		return config
 	}
 
 	// 其他模型
-	if req.Temperature != nil {
-		config.Temperature = req.Temperature
-	}
-	if req.TopP != nil {
-		config.TopP = req.TopP
-	}
-	if req.MaxTokens > 0 {
-		config.MaxOutputTokens = req.MaxTokens
-	}
-
-	// 思考模式（如果有历史函数调用，禁用以避免 thought_signature 问题）
-	if !hasHistoryFunctionCalls && ShouldEnableThinking(modelName, nil) {
-		config.ThinkingConfig = BuildThinkingConfig(modelName)
-	}
-
+	config.Temperature = normalizeTemperature(req.Temperature, modelConfig, issues)
+	config.TopP = normalizeTopP(req.TopP, modelConfig, issues)
+	config.TopK = normalizeTopK(req.TopK, modelConfig, modelName, issues)
 	return config
 }
 
-// ConvertToOpenAIResponse 将 Antigravity 响应转换为 OpenAI 格式
-func ConvertToOpenAIResponse(antigravityResp *AntigravityResponse, model string) *OpenAIChatCompletion {
+// ConvertToOpenAIResponse 将 Antigravity 响应转换为 OpenAI 格式（tools 为请求中声明的工具，用于提取文本形式的工具调用）
+func ConvertToOpenAIResponse(antigravityResp *AntigravityResponse, model string, tools []Tool) *OpenAIChatCompletion {
 	parts := antigravityResp.Response.Candidates[0].Content.Parts
 
-	var content, thinkingContent string
+	var contentBuf, thinkingBuf strings.Builder
 	var toolCalls []OpenAIToolCall
 	var imageURLs []string
 
 	for _, part := range parts {
 		if part.Thought {
-			thinkingContent += part.Text
+			thinkingBuf.WriteString(part.Text)
 		} else if part.Text != "" {
-			content += part.Text
+			contentBuf.WriteString(part.Text)
 		} else if part.FunctionCall != nil {
 			argsJSON, _ := json.Marshal(part.FunctionCall.Args)
 			id := part.FunctionCall.ID
@@ -339,6 +524,20 @@ func ConvertToOpenAIResponse(antigravityResp *AntigravityResponse, model string)
 			imageURLs = append(imageURLs, dataURL)
 		}
 	}
+	content, thinkingContent := contentBuf.String(), thinkingBuf.String()
+
+	// 提取正文中以文本形式输出的工具调用（在后处理之前，避免规则改写调用内容）
+	if len(toolCalls) == 0 && GetModelConfig(model).EffectiveToolCallRecovery() {
+		content, toolCalls = RecoverToolCalls(content, tools)
+	}
+
+	// 内容后处理（思考内容仅在规则显式启用时处理）
+	content, postProcessed := postprocess.Apply(model, content, false)
+	if thinkingContent != "" {
+		var applied int
+		thinkingContent, applied = postprocess.Apply(model, thinkingContent, true)
+		postProcessed += applied
+	}
 
 	// 处理图片输出
 	if len(imageURLs) > 0 {
@@ -352,11 +551,14 @@ func ConvertToOpenAIResponse(antigravityResp *AntigravityResponse, model string)
 		content = md.String()
 	}
 
-	finishReason := "stop"
-	if len(toolCalls) > 0 {
+	finishReason := MapFinishReason(antigravityResp.Response.Candidates[0].FinishReason)
+	if finishReason == "stop" && len(toolCalls) > 0 {
 		finishReason = "tool_calls"
 	}
 
+	// 引用按最终 content 定位（后处理、工具调用提取可能改变了文本）
+	annotations := BuildAnnotations(antigravityResp.Response.Candidates[0].GroundingMetadata, content)
+
 	return &OpenAIChatCompletion{
 		ID:      utils.GenerateChatCompletionID(),
 		Object:  "chat.completion",
@@ -365,15 +567,29 @@ func ConvertToOpenAIResponse(antigravityResp *AntigravityResponse, model string)
 		Choices: []Choice{{
 			Index: 0,
 			Message: Message{
-				Role:      "assistant",
-				Content:   content,
-				ToolCalls: toolCalls,
-				Reasoning: thinkingContent,
+				Role:        "assistant",
+				Content:     content,
+				ToolCalls:   toolCalls,
+				Reasoning:   thinkingContent,
+				Annotations: annotations,
 			},
 			FinishReason: &finishReason,
 		}},
-		Usage: ConvertUsage(antigravityResp.Response.UsageMetadata),
+		Usage:         ConvertUsage(antigravityResp.Response.UsageMetadata),
+		PostProcessed: postProcessed,
+	}
+}
+
+// MapFinishReason 将上游 finishReason 映射为 OpenAI 的 finish_reason：
+// MAX_TOKENS 为 length，安全过滤类为 content_filter，其余（包括为空）为 stop
+func MapFinishReason(reason string) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
 	}
+	return "stop"
 }
 
 // ConvertUsage 转换使用统计
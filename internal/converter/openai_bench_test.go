@@ -0,0 +1,145 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/store"
+)
+
+// longHistoryBody 长对话：系统提示 + turns 轮纯文本问答
+func longHistoryBody(turns int) []byte {
+	messages := []interface{}{
+		map[string]interface{}{"role": "system", "content": strings.Repeat("You are a careful assistant. ", 40)},
+	}
+	for i := 0; i < turns; i++ {
+		messages = append(messages,
+			map[string]interface{}{"role": "user", "content": fmt.Sprintf("question %d: %s", i, strings.Repeat("lorem ipsum dolor ", 30))},
+			map[string]interface{}{"role": "assistant", "content": fmt.Sprintf("answer %d: %s", i, strings.Repeat("sit amet consectetur ", 30))},
+		)
+	}
+	return benchRequestBody(messages, nil)
+}
+
+// toolHeavyBody 工具密集的 Agent 对话：tools 个带嵌套 Schema 的工具，turns 轮工具调用与结果
+func toolHeavyBody(tools, turns int) []byte {
+	defs := make([]interface{}, 0, tools)
+	for i := 0; i < tools; i++ {
+		defs = append(defs, map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        fmt.Sprintf("tool_%d", i),
+				"description": strings.Repeat("Performs an operation on the workspace. ", 5),
+				"parameters": map[string]interface{}{
+					"type":                 "object",
+					"additionalProperties": false,
+					"$schema":              "http://json-schema.org/draft-07/schema#",
+					"properties": map[string]interface{}{
+						"path":    map[string]interface{}{"type": "string", "description": "file path"},
+						"content": map[string]interface{}{"type": "string", "minLength": 1},
+						"options": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"recursive": map[string]interface{}{"type": "boolean", "default": false},
+								"mode":      map[string]interface{}{"type": "string", "enum": []string{"read", "write", "append"}},
+								"limit":     map[string]interface{}{"type": "integer", "minimum": 0, "exclusiveMaximum": 1000},
+							},
+						},
+						"tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					},
+					"required": []string{"path"},
+				},
+			},
+		})
+	}
+
+	messages := []interface{}{
+		map[string]interface{}{"role": "system", "content": "You are a coding agent."},
+		map[string]interface{}{"role": "user", "content": "refactor the project"},
+	}
+	for i := 0; i < turns; i++ {
+		id := fmt.Sprintf("call_%d", i)
+		args, _ := json.Marshal(map[string]interface{}{
+			"path":    fmt.Sprintf("src/file_%d.go", i),
+			"content": strings.Repeat("x := 1\n", 20),
+			"options": map[string]interface{}{"recursive": true, "mode": "write"},
+		})
+		messages = append(messages,
+			map[string]interface{}{"role": "assistant", "content": nil, "tool_calls": []interface{}{
+				map[string]interface{}{"id": id, "type": "function", "function": map[string]interface{}{
+					"name": fmt.Sprintf("tool_%d", i%tools), "arguments": string(args),
+				}},
+			}},
+			map[string]interface{}{"role": "tool", "tool_call_id": id, "content": strings.Repeat("ok ", 100)},
+		)
+	}
+	return benchRequestBody(messages, defs)
+}
+
+// pngData 边长 size 的噪点 PNG（base64，噪点使压缩后的大小接近真实截图）
+func pngData(size int) string {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	rng := rand.New(rand.NewSource(1))
+	rng.Read(img.Pix)
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// multimodalBody 多模态对话：turns 轮各带 images 张 PNG 截图的用户消息
+func multimodalBody(turns, images, imageSize int) []byte {
+	url := "data:image/png;base64," + pngData(imageSize)
+	var messages []interface{}
+	for i := 0; i < turns; i++ {
+		parts := []interface{}{map[string]interface{}{"type": "text", "text": fmt.Sprintf("compare screenshot set %d", i)}}
+		for j := 0; j < images; j++ {
+			parts = append(parts, map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}})
+		}
+		messages = append(messages,
+			map[string]interface{}{"role": "user", "content": parts},
+			map[string]interface{}{"role": "assistant", "content": "the second one has a misaligned header"},
+		)
+	}
+	return benchRequestBody(messages, nil)
+}
+
+func benchRequestBody(messages, tools []interface{}) []byte {
+	req := map[string]interface{}{"model": "gemini-2.5-flash", "messages": messages}
+	if tools != nil {
+		req["tools"] = tools
+	}
+	body, _ := json.Marshal(req)
+	return body
+}
+
+// BenchmarkConvertOpenAIToAntigravity 只测量转换（请求在计时前解码）
+func BenchmarkConvertOpenAIToAntigravity(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		body []byte
+	}{
+		{"LongHistory", longHistoryBody(120)},
+		{"ToolHeavy", toolHeavyBody(40, 60)},
+		{"Multimodal", multimodalBody(10, 2, 128)},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			req, err := DecodeOpenAIChatRequest(bytes.NewReader(tc.body))
+			if err != nil {
+				b.Fatal(err)
+			}
+			account := &store.Account{ProjectID: "project"}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ConvertOpenAIToAntigravity(req, account)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package converter
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 不支持参数的处理方式
+const (
+	UnsupportedParamsDrop  = "drop"  // 静默丢弃
+	UnsupportedParamsError = "error" // 返回 400
+	UnsupportedParamsWarn  = "warn"  // 丢弃并在响应中返回警告
+)
+
+// ignoredParams 不影响输出、可以安全忽略的参数（不视为不支持）
+var ignoredParams = map[string]bool{
+	"user":           true,
+	"stream_options": true, // 流式响应总是在结束 chunk 中返回 usage
+}
+
+var (
+	supportedParams     map[string]bool
+	supportedParamsOnce sync.Once
+)
+
+// IsSupportedParam 请求参数是否受支持。支持列表由 OpenAIChatRequest 的 JSON 标签生成，
+// 新增字段后对应参数自动不再视为不支持
+func IsSupportedParam(name string) bool {
+	supportedParamsOnce.Do(func() {
+		supportedParams = make(map[string]bool)
+		t := reflect.TypeOf(OpenAIChatRequest{})
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if tag != "" && tag != "-" {
+				supportedParams[tag] = true
+			}
+		}
+	})
+	return supportedParams[name] || ignoredParams[name]
+}
+
+// ParseUnsupportedParamsMode 解析处理方式，无法识别时返回 false
+func ParseUnsupportedParamsMode(value string) (string, bool) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case UnsupportedParamsDrop, UnsupportedParamsError, UnsupportedParamsWarn:
+		return mode, true
+	}
+	return "", false
+}
+
+// sortedParams 排序后的参数名（保证错误信息和响应头稳定）
+func sortedParams(params []string) []string {
+	sort.Strings(params)
+	return params
+}
@@ -0,0 +1,61 @@
+package converter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCollectsUnsupportedParams(t *testing.T) {
+	req, err := DecodeOpenAIChatRequest(strings.NewReader(`{
+		"model": "gemini-2.5-flash",
+		"web_search_options": {"search_context_size": "low"},
+		"messages": [{"role": "user", "content": "hi"}],
+		"logit_bias": {"50256": -100},
+		"temperature": 0.2,
+		"audio": {"voice": "alloy", "format": "mp3"},
+		"user": "user-1",
+		"stream_options": {"include_usage": true},
+		"modalities": null
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// null 视为未设置，user、stream_options 可以安全忽略
+	want := []string{"audio", "logit_bias", "web_search_options"}
+	if !reflect.DeepEqual(req.Unsupported, want) {
+		t.Errorf("unsupported = %v, want %v", req.Unsupported, want)
+	}
+	if req.Temperature == nil || *req.Temperature != 0.2 {
+		t.Errorf("supported parameter lost: temperature = %v", req.Temperature)
+	}
+}
+
+func TestIsSupportedParamFollowsRequestFields(t *testing.T) {
+	// 支持列表来自 OpenAIChatRequest 的 JSON 标签
+	for _, name := range []string{"model", "messages", "tools", "tool_choice", "temperature", "stream", "user"} {
+		if !IsSupportedParam(name) {
+			t.Errorf("%s should be supported", name)
+		}
+	}
+	for _, name := range []string{"logit_bias", "audio", "web_search_options", "-", ""} {
+		if IsSupportedParam(name) {
+			t.Errorf("%q should not be supported", name)
+		}
+	}
+}
+
+func TestParseUnsupportedParamsMode(t *testing.T) {
+	for value, want := range map[string]string{
+		"drop": UnsupportedParamsDrop, " Error ": UnsupportedParamsError, "WARN": UnsupportedParamsWarn,
+	} {
+		if mode, ok := ParseUnsupportedParamsMode(value); !ok || mode != want {
+			t.Errorf("%q: mode %q (%v), want %q", value, mode, ok, want)
+		}
+	}
+	for _, value := range []string{"", "ignore", "strict"} {
+		if _, ok := ParseUnsupportedParamsMode(value); ok {
+			t.Errorf("%q should be rejected", value)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/store"
+)
+
+// 系统提示压缩方式
+const (
+	CompressionReference = "reference" // 替换为引用说明（后端在会话内缓存了之前的系统提示）
+	CompressionMinify    = "minify"    // 只去除多余空白
+)
+
+// sentPromptsMax 记录的已发送系统提示数上限（超出时清理过期记录）
+const sentPromptsMax = 4096
+
+// PromptCompression 系统提示压缩结果（记录到日志）
+type PromptCompression struct {
+	Mode        string `json:"mode"`
+	SavedTokens int    `json:"savedTokens"` // 估算节省的 Token 数
+
+	sentKey string // 请求成功后记录为已发送的键（账号 + 会话 + 原始系统提示哈希）
+}
+
+var (
+	sentPromptsMu sync.Mutex
+	sentPrompts   = make(map[string]time.Time)
+)
+
+// compressSystemPrompt 压缩系统提示（PROMPT_COMPRESSION 开启时）：
+// 模型支持会话内隐式缓存且同一账号会话最近成功发送过相同的系统提示时替换为引用说明，否则按配置去除多余空白
+func compressSystemPrompt(systemText string, account *store.Account, cfg ModelConfig) (string, *PromptCompression) {
+	appCfg := config.Get()
+	if !appCfg.PromptCompression || systemText == "" {
+		return systemText, nil
+	}
+
+	result := &PromptCompression{}
+	if cfg.EffectiveImplicitCache() && account != nil && account.SessionID != "" {
+		sum := sha256.Sum256([]byte(systemText))
+		hash := hex.EncodeToString(sum[:])
+		result.sentKey = account.ID + "\x00" + account.SessionID + "\x00" + hash
+		if promptSentRecently(result.sentKey, time.Duration(appCfg.PromptReferenceTTL)*time.Second) {
+			note := referenceNote(appCfg.PromptReferenceTemplate, hash, estimateTextTokens(systemText))
+			result.Mode = CompressionReference
+			result.SavedTokens = estimateTextTokens(systemText) - estimateTextTokens(note)
+			return note, result
+		}
+	}
+
+	if !appCfg.PromptMinify {
+		return systemText, result
+	}
+	minified := MinifyPrompt(systemText)
+	if saved := estimateTextTokens(systemText) - estimateTextTokens(minified); saved > 0 {
+		result.Mode = CompressionMinify
+		result.SavedTokens = saved
+	}
+	return minified, result
+}
+
+// referenceNote 按模板生成引用说明（{hash} 为哈希前 12 位，{tokens} 为原系统提示的估算 Token 数）
+func referenceNote(template, hash string, tokens int) string {
+	return strings.NewReplacer("{hash}", hash[:12], "{tokens}", strconv.Itoa(tokens)).Replace(template)
+}
+
+// promptSentRecently 同一账号会话是否在 ttl 内成功发送过相同的系统提示
+func promptSentRecently(key string, ttl time.Duration) bool {
+	sentPromptsMu.Lock()
+	defer sentPromptsMu.Unlock()
+	sentAt, ok := sentPrompts[key]
+	return ok && time.Since(sentAt) < ttl
+}
+
+// RememberSystemPrompt 请求成功后记录完整发送的系统提示（引用说明本身不刷新记录，超过 TTL 后重新发送完整提示）
+func RememberSystemPrompt(c *PromptCompression) {
+	if c == nil || c.sentKey == "" || c.Mode == CompressionReference {
+		return
+	}
+	ttl := time.Duration(config.Get().PromptReferenceTTL) * time.Second
+
+	sentPromptsMu.Lock()
+	defer sentPromptsMu.Unlock()
+	now := time.Now()
+	if len(sentPrompts) >= sentPromptsMax {
+		for key, sentAt := range sentPrompts {
+			if now.Sub(sentAt) >= ttl {
+				delete(sentPrompts, key)
+			}
+		}
+		if len(sentPrompts) >= sentPromptsMax {
+			sentPrompts = make(map[string]time.Time)
+		}
+	}
+	sentPrompts[c.sentKey] = now
+}
+
+// lineBreaks 统一换行符（CRLF 和单独的 CR 都转为 LF）
+var lineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// MinifyPrompt 只调整空白的压缩：统一换行符、去除行尾空白、连续空行合并为一行、去除首尾空行，
+// 代码块（``` 或 ~~~ 围栏内）保持原样。结果再次压缩不变
+func MinifyPrompt(text string) string {
+	lines := strings.Split(lineBreaks.Replace(text), "\n")
+
+	var sb strings.Builder
+	sb.Grow(len(text))
+	inFence := false
+	fence := ""
+	blank := false
+	written := false
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		if inFence {
+			writeLine(&sb, line, &written)
+			if closesFence(trimmed, fence) {
+				inFence = false
+			}
+			continue
+		}
+
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			blank = written
+			continue
+		}
+		if blank {
+			writeLine(&sb, "", &written)
+			blank = false
+		}
+		writeLine(&sb, line, &written)
+		if marker := fenceMarker(trimmed); marker != "" {
+			inFence = true
+			fence = marker
+		}
+	}
+	return sb.String()
+}
+
+// fenceMarker 代码块围栏的开始标记（``` 或 ~~~ 及更长），不是围栏时返回空
+func fenceMarker(line string) string {
+	for _, ch := range []byte{'`', '~'} {
+		n := 0
+		for n < len(line) && line[n] == ch {
+			n++
+		}
+		if n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// closesFence 是否为结束围栏：只包含开始标记的字符，且不短于开始标记
+func closesFence(line, fence string) bool {
+	line = strings.TrimRight(line, " \t")
+	return len(line) >= len(fence) && strings.Trim(line, fence[:1]) == ""
+}
+
+func writeLine(sb *strings.Builder, line string, written *bool) {
+	if *written {
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(line)
+	*written = true
+}
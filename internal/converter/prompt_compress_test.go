@@ -0,0 +1,260 @@
+package converter
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// usePromptCompression 在测试期间开启系统提示压缩，并清空已发送记录
+func usePromptCompression(t *testing.T, minify bool) {
+	t.Helper()
+	cfg := config.Get()
+	saved := *cfg
+	cfg.PromptCompression = true
+	cfg.PromptMinify = minify
+	cfg.PromptReferenceTemplate = "[ref {hash}, ~{tokens} tokens]"
+	cfg.PromptReferenceTTL = 300
+	resetSentPrompts()
+	t.Cleanup(func() {
+		*cfg = saved
+		resetSentPrompts()
+	})
+}
+
+func resetSentPrompts() {
+	sentPromptsMu.Lock()
+	sentPrompts = make(map[string]time.Time)
+	sentPromptsMu.Unlock()
+}
+
+// sessionAccount 带会话 ID 的账号
+func sessionAccount(id, session string) *store.Account {
+	account := testutil.Account(id)
+	account.SessionID = session
+	return &account
+}
+
+// stripWhitespace 去除全部空白字符（比较语义内容）
+func stripWhitespace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// contentLines 非空行（去除行尾空白）
+func contentLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(lineBreaks.Replace(s), "\n") {
+		if line = strings.TrimRight(line, " \t"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// checkMinify 压缩结果幂等，只调整空白：非空行内容和顺序不变，代码块原样保留
+func checkMinify(t *testing.T, input string) string {
+	t.Helper()
+	out := MinifyPrompt(input)
+	if again := MinifyPrompt(out); again != out {
+		t.Fatalf("not idempotent for %q:\n%q\n%q", input, out, again)
+	}
+	if stripWhitespace(out) != stripWhitespace(input) {
+		t.Fatalf("non-whitespace content changed for %q: %q", input, out)
+	}
+	want, got := contentLines(input), contentLines(out)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("content lines changed for %q:\n%q\nwant\n%q", input, got, want)
+	}
+	if len(out) > len(input) {
+		t.Fatalf("minified %q is longer than the input", out)
+	}
+	return out
+}
+
+func TestMinifyPrompt(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"unchanged", "You are a helpful assistant.\n\nBe brief.", "You are a helpful assistant.\n\nBe brief."},
+		{"trailing spaces", "Rules:   \n- one\t\n- two  ", "Rules:\n- one\n- two"},
+		{"blank runs", "Intro\n\n\n\n\nBody\n \n\t\nEnd", "Intro\n\nBody\n\nEnd"},
+		{"leading and trailing blank lines", "\n\n  \nHello\n\n\n", "Hello"},
+		{"crlf", "Line one\r\n\r\n\r\nLine two\r\n", "Line one\n\nLine two"},
+		{"cr", "Line one\rLine two\r\r\nLine three", "Line one\nLine two\n\nLine three"},
+		{"cr in code block", "```\nx\r\r\ny\n```", "```\nx\n\ny\n```"},
+		// 缩进是 markdown 结构（列表嵌套、缩进代码），保持原样
+		{"indentation kept", "- item\n    - nested  \n        code", "- item\n    - nested\n        code"},
+		{"code block kept", "Example:\n```python\ndef f():  \n\n\n    return 1\t\n```\n\n\nDone", "Example:\n```python\ndef f():  \n\n\n    return 1\t\n```\n\nDone"},
+		{"tilde fence", "~~~\na  \n\n\nb\n~~~  \nafter  ", "~~~\na  \n\n\nb\n~~~  \nafter"},
+		// 较短的围栏不会结束较长围栏开始的代码块
+		{"longer fence", "````\n```\nx  \n\n\n```\n````\ny  ", "````\n```\nx  \n\n\n```\n````\ny"},
+		{"indented fence", "  ```\n  a  \n  ```\nb  ", "  ```\n  a  \n  ```\nb"},
+		{"unclosed fence", "text\n```\ncode  \n\n\n", "text\n```\ncode  \n\n\n"},
+		{"inline backticks", "Use `x`  \n\n\nand ``y``", "Use `x`\n\nand ``y``"},
+		{"unicode", "你好　\n\n\n世界", "你好　\n\n世界"}, // 全角空格不是 ASCII 空白，保留
+		{"empty", "", ""},
+		{"only whitespace", " \n\t\n\r\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkMinify(t, tt.input); got != tt.want {
+				t.Fatalf("MinifyPrompt(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinifyPromptRandomInputs(t *testing.T) {
+	pieces := []string{
+		"word", "Ünïcode", "中文", "-", "#", "*", "`", "```", "~~~", "````", "```go",
+		" ", "  ", "\t", "\n", "\n", "\n\n", "\r\n", "\r", "    ", "{", "}",
+	}
+	rng := rand.New(rand.NewSource(42))
+	for i := 0; i < 2000; i++ {
+		var sb strings.Builder
+		for n := rng.Intn(40); n > 0; n-- {
+			sb.WriteString(pieces[rng.Intn(len(pieces))])
+		}
+		checkMinify(t, sb.String())
+	}
+}
+
+func TestMinifyPromptSavesTokens(t *testing.T) {
+	// 典型 agent 框架的系统提示：模板拼接留下的行尾空白和多余空行
+	var sb strings.Builder
+	for i := 0; i < 40; i++ {
+		sb.WriteString("## Section   \n\n\n- Always follow the repository conventions when editing files.  \n- Prefer small, focused changes.\t\n\n\n\n")
+	}
+	prompt := sb.String()
+	minified := checkMinify(t, prompt)
+	before, after := estimateTextTokens(prompt), estimateTextTokens(minified)
+	if saved := float64(before-after) / float64(before); saved < 0.03 {
+		t.Fatalf("saved %.1f%% (%d → %d tokens)", saved*100, before, after)
+	}
+}
+
+func TestCompressSystemPromptDisabled(t *testing.T) {
+	cfg := config.Get()
+	previous := cfg.PromptCompression
+	cfg.PromptCompression = false
+	t.Cleanup(func() { cfg.PromptCompression = previous })
+
+	prompt := "Be brief.   \n\n\n\nAnswer in English."
+	out, result := compressSystemPrompt(prompt, sessionAccount("compress-off", "s1"), ModelConfig{ImplicitCache: boolean(true)})
+	if out != prompt || result != nil {
+		t.Fatalf("compression applied while disabled: %q %+v", out, result)
+	}
+}
+
+func TestCompressSystemPromptMinify(t *testing.T) {
+	usePromptCompression(t, true)
+	account := sessionAccount("compress-minify", "s1")
+
+	out, result := compressSystemPrompt("Be brief.   \n\n\n\nAnswer in English.   ", account, ModelConfig{})
+	if out != "Be brief.\n\nAnswer in English." || result.Mode != CompressionMinify || result.SavedTokens <= 0 {
+		t.Fatalf("minify = %q %+v", out, result)
+	}
+	// 已经紧凑的提示不记录压缩方式
+	out, result = compressSystemPrompt("Be brief.", account, ModelConfig{})
+	if out != "Be brief." || result == nil || result.Mode != "" || result.SavedTokens != 0 {
+		t.Fatalf("compact prompt = %q %+v", out, result)
+	}
+
+	usePromptCompression(t, false)
+	prompt := "Be brief.   \n\n\n\nok"
+	if out, result := compressSystemPrompt(prompt, account, ModelConfig{}); out != prompt || result.Mode != "" {
+		t.Fatalf("minify disabled: %q %+v", out, result)
+	}
+}
+
+func TestCompressSystemPromptReference(t *testing.T) {
+	usePromptCompression(t, true)
+	cached := ModelConfig{ImplicitCache: boolean(true)}
+	prompt := strings.Repeat("You are an autonomous coding agent. Follow the rules below.\n", 50)
+	account := sessionAccount("compress-ref", "session-1")
+
+	// 首次发送完整提示，请求成功后才记录
+	out, first := compressSystemPrompt(prompt, account, cached)
+	if first.Mode == CompressionReference || out != MinifyPrompt(prompt) {
+		t.Fatalf("first request compressed to a reference: %+v", first)
+	}
+	if _, again := compressSystemPrompt(prompt, account, cached); again.Mode == CompressionReference {
+		t.Fatal("reference used before the full prompt was sent successfully")
+	}
+	RememberSystemPrompt(first)
+
+	out, second := compressSystemPrompt(prompt, account, cached)
+	if second.Mode != CompressionReference {
+		t.Fatalf("second request mode = %q", second.Mode)
+	}
+	if !strings.HasPrefix(out, "[ref ") || !strings.Contains(out, "tokens]") || strings.Contains(out, "{") {
+		t.Fatalf("reference note = %q", out)
+	}
+	if second.SavedTokens != estimateTextTokens(prompt)-estimateTextTokens(out) || second.SavedTokens < 500 {
+		t.Fatalf("saved tokens = %d", second.SavedTokens)
+	}
+
+	// 其他会话、其他账号、修改过的提示、不支持隐式缓存的模型都发送完整提示
+	others := []struct {
+		name    string
+		prompt  string
+		account *store.Account
+		cfg     ModelConfig
+	}{
+		{"other session", prompt, sessionAccount("compress-ref", "session-2"), cached},
+		{"other account", prompt, sessionAccount("compress-other", "session-1"), cached},
+		{"changed prompt", prompt + "One more rule.", account, cached},
+		{"no implicit cache", prompt, account, ModelConfig{}},
+		{"no session", prompt, sessionAccount("compress-ref", ""), cached},
+	}
+	for _, o := range others {
+		if _, result := compressSystemPrompt(o.prompt, o.account, o.cfg); result.Mode == CompressionReference {
+			t.Errorf("%s: reference used", o.name)
+		}
+	}
+
+	// 引用说明不刷新记录：超过有效期后重新发送完整提示
+	RememberSystemPrompt(second)
+	sentPromptsMu.Lock()
+	sentPrompts[first.sentKey] = time.Now().Add(-301 * time.Second)
+	sentPromptsMu.Unlock()
+	if _, expired := compressSystemPrompt(prompt, account, cached); expired.Mode == CompressionReference {
+		t.Fatal("reference used after the TTL")
+	}
+}
+
+func TestReferenceNoteTemplate(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	if got := referenceNote("ref={hash} tokens={tokens} {hash}", hash, 1234); got != "ref=abababababab tokens=1234 abababababab" {
+		t.Fatalf("referenceNote = %q", got)
+	}
+}
+
+func TestRememberSystemPromptBounded(t *testing.T) {
+	usePromptCompression(t, true)
+	sentPromptsMu.Lock()
+	for i := 0; i < sentPromptsMax; i++ {
+		sentPrompts[strings.Repeat("k", i+1)] = time.Now().Add(-time.Hour)
+	}
+	sentPromptsMu.Unlock()
+
+	RememberSystemPrompt(&PromptCompression{sentKey: "fresh"})
+	sentPromptsMu.Lock()
+	defer sentPromptsMu.Unlock()
+	// 过期记录被清理
+	if len(sentPrompts) != 1 || sentPrompts["fresh"].IsZero() {
+		t.Fatalf("%d prompts remembered after cleanup", len(sentPrompts))
+	}
+}
@@ -0,0 +1,458 @@
+package converter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/persist"
+)
+
+// DefaultModelConfigKey models.json 中作用于所有模型的配置项
+const DefaultModelConfigKey = "*"
+
+// MaxStopSequences 停止序列数量上限
+const MaxStopSequences = 64
+
+// registryReloadInterval 检查 models.json 变更的最小间隔
+const registryReloadInterval = 5 * time.Second
+
+// ModelConfig 模型级配置（从 data/models.json 加载，未设置的字段使用内置默认值）
+type ModelConfig struct {
+	// SystemInContents 不使用 systemInstruction，而是把系统提示拼接到首个 user 消息
+	SystemInContents *bool `json:"system_in_contents,omitempty"`
+	// ReplayThoughts 将历史 assistant 消息中的 reasoning 重建为 thought Part（位于 functionCall 之前）
+	ReplayThoughts *bool `json:"replay_thoughts,omitempty"`
+	// ToolCallRecovery 从正文中提取模型以文本形式输出的工具调用（JSON、tool_code 代码块、<tool_call> 等）
+	ToolCallRecovery *bool `json:"tool_call_recovery,omitempty"`
+	// StopSequences 默认停止序列（请求中的 stop 会追加在后面）
+	StopSequences []string `json:"stop_sequences,omitempty"`
+	// MaxOutputTokens 最大输出 Token（Claude 固定使用该值，其他模型作为上限）
+	MaxOutputTokens *int `json:"max_output_tokens,omitempty"`
+	// ThinkingBudget 思考预算，0 表示由后端决定
+	ThinkingBudget *int `json:"thinking_budget,omitempty"`
+	// MaxThinkingBudget 模型支持的最大思考预算，请求中的 thinking_budget、reasoning_effort 超出时截断
+	MaxThinkingBudget *int `json:"max_thinking_budget,omitempty"`
+	// ThinkingInOutput 后端的 maxOutputTokens 是否包含思考 Token（默认包含，此时回答预算会加上思考预算）
+	ThinkingInOutput *bool `json:"thinking_in_output,omitempty"`
+	// AssistantPrefill 允许最后一条消息是 assistant（预填充回答的开头），默认只有 Claude 允许
+	AssistantPrefill *bool `json:"assistant_prefill,omitempty"`
+	// ImplicitCache 后端在会话内缓存上下文，同一会话重复的系统提示可以替换为引用说明（PROMPT_COMPRESSION 开启时）
+	ImplicitCache *bool `json:"implicit_cache,omitempty"`
+	// UsageMerge 流式响应中多个 usageMetadata 的合并方式：replace（默认）、sum、max
+	UsageMerge string `json:"usage_merge,omitempty"`
+	// TemperatureMax 模型支持的最大 temperature，超出时截断
+	TemperatureMax *float64 `json:"temperature_max,omitempty"`
+	// TemperatureScale 将 OpenAI 的 0–2 按比例缩放到 0–TemperatureMax，而不是截断
+	TemperatureScale *bool `json:"temperature_scale,omitempty"`
+	// TopPMax 模型支持的最大 top_p（部分模型拒绝 1.0）
+	TopPMax *float64 `json:"top_p_max,omitempty"`
+	// TopK 是否支持 top_k，不支持时丢弃
+	TopK *bool `json:"top_k,omitempty"`
+	// Tools 声明支持函数调用（默认 true，仅用于模型列表，可被能力探测结果覆盖）
+	Tools *bool `json:"tools,omitempty"`
+	// Vision 声明支持图片输入（默认 true，仅用于模型列表，可被能力探测结果覆盖）
+	Vision *bool `json:"vision,omitempty"`
+}
+
+// EffectiveSystemInContents 是否把系统提示拼接到首个 user 消息，默认 false
+func (c ModelConfig) EffectiveSystemInContents() bool {
+	return c.SystemInContents != nil && *c.SystemInContents
+}
+
+// EffectiveReplayThoughts 是否重建历史中的 thought Part，默认 false
+func (c ModelConfig) EffectiveReplayThoughts() bool {
+	return c.ReplayThoughts != nil && *c.ReplayThoughts
+}
+
+// EffectiveToolCallRecovery 是否从正文中提取文本形式的工具调用，默认 false
+func (c ModelConfig) EffectiveToolCallRecovery() bool {
+	return c.ToolCallRecovery != nil && *c.ToolCallRecovery
+}
+
+// EffectiveImplicitCache 后端是否在会话内缓存上下文，默认 false
+func (c ModelConfig) EffectiveImplicitCache() bool {
+	return c.ImplicitCache != nil && *c.ImplicitCache
+}
+
+// EffectiveStopSequences 返回停止序列副本（调用方可以安全追加）
+func (c ModelConfig) EffectiveStopSequences() []string {
+	return append([]string(nil), c.StopSequences...)
+}
+
+// EffectiveMaxOutputTokens 最大输出 Token，0 表示不限制
+func (c ModelConfig) EffectiveMaxOutputTokens() int {
+	if c.MaxOutputTokens == nil {
+		return 0
+	}
+	return *c.MaxOutputTokens
+}
+
+// EffectiveThinkingBudget 思考预算，0 表示由后端决定
+func (c ModelConfig) EffectiveThinkingBudget() int {
+	if c.ThinkingBudget == nil {
+		return 0
+	}
+	return *c.ThinkingBudget
+}
+
+// EffectiveMaxThinkingBudget 最大思考预算，0 表示不限制
+func (c ModelConfig) EffectiveMaxThinkingBudget() int {
+	if c.MaxThinkingBudget == nil {
+		return 0
+	}
+	return *c.MaxThinkingBudget
+}
+
+// EffectiveAssistantPrefill 是否允许最后一条消息是 assistant，默认 false
+func (c ModelConfig) EffectiveAssistantPrefill() bool {
+	return c.AssistantPrefill != nil && *c.AssistantPrefill
+}
+
+// EffectiveThinkingInOutput maxOutputTokens 是否包含思考 Token，默认 true
+func (c ModelConfig) EffectiveThinkingInOutput() bool {
+	return c.ThinkingInOutput == nil || *c.ThinkingInOutput
+}
+
+// EffectiveUsageMerge usageMetadata 合并方式，默认 replace
+func (c ModelConfig) EffectiveUsageMerge() string {
+	if c.UsageMerge == "" {
+		return UsageMergeReplace
+	}
+	return c.UsageMerge
+}
+
+// EffectiveTemperatureMax 最大 temperature，默认 2（OpenAI 范围）
+func (c ModelConfig) EffectiveTemperatureMax() float64 {
+	if c.TemperatureMax == nil {
+		return 2
+	}
+	return *c.TemperatureMax
+}
+
+// EffectiveTopPMax 最大 top_p，默认 1
+func (c ModelConfig) EffectiveTopPMax() float64 {
+	if c.TopPMax == nil {
+		return 1
+	}
+	return *c.TopPMax
+}
+
+// EffectiveTools 是否声明支持函数调用，默认 true
+func (c ModelConfig) EffectiveTools() bool {
+	return c.Tools == nil || *c.Tools
+}
+
+// EffectiveVision 是否声明支持图片输入，默认 true
+func (c ModelConfig) EffectiveVision() bool {
+	return c.Vision == nil || *c.Vision
+}
+
+// Validate 校验配置，拒绝明显错误的值
+func (c ModelConfig) Validate() error {
+	if c.MaxOutputTokens != nil && *c.MaxOutputTokens <= 0 {
+		return errors.New("max_output_tokens must be positive")
+	}
+	if c.ThinkingBudget != nil && *c.ThinkingBudget < 0 {
+		return errors.New("thinking_budget must not be negative")
+	}
+	if c.MaxThinkingBudget != nil && *c.MaxThinkingBudget <= 0 {
+		return errors.New("max_thinking_budget must be positive")
+	}
+	if len(c.StopSequences) > MaxStopSequences {
+		return fmt.Errorf("at most %d stop_sequences are allowed", MaxStopSequences)
+	}
+	for _, seq := range c.StopSequences {
+		if seq == "" {
+			return errors.New("stop_sequences must not contain empty strings")
+		}
+	}
+	if c.TemperatureMax != nil && (*c.TemperatureMax <= 0 || *c.TemperatureMax > 2) {
+		return errors.New("temperature_max must be in (0, 2]")
+	}
+	if c.TopPMax != nil && (*c.TopPMax <= 0 || *c.TopPMax > 1) {
+		return errors.New("top_p_max must be in (0, 1]")
+	}
+	switch c.UsageMerge {
+	case "", UsageMergeReplace, UsageMergeSum, UsageMergeMax:
+	default:
+		return fmt.Errorf("usage_merge must be one of %s, %s, %s", UsageMergeReplace, UsageMergeSum, UsageMergeMax)
+	}
+	return nil
+}
+
+// overlay 用 o 中设置的字段覆盖 c
+func (c ModelConfig) overlay(o ModelConfig) ModelConfig {
+	if o.SystemInContents != nil {
+		c.SystemInContents = o.SystemInContents
+	}
+	if o.ReplayThoughts != nil {
+		c.ReplayThoughts = o.ReplayThoughts
+	}
+	if o.ToolCallRecovery != nil {
+		c.ToolCallRecovery = o.ToolCallRecovery
+	}
+	if o.ImplicitCache != nil {
+		c.ImplicitCache = o.ImplicitCache
+	}
+	if o.StopSequences != nil {
+		c.StopSequences = o.StopSequences
+	}
+	if o.MaxOutputTokens != nil {
+		c.MaxOutputTokens = o.MaxOutputTokens
+	}
+	if o.ThinkingBudget != nil {
+		c.ThinkingBudget = o.ThinkingBudget
+	}
+	if o.MaxThinkingBudget != nil {
+		c.MaxThinkingBudget = o.MaxThinkingBudget
+	}
+	if o.ThinkingInOutput != nil {
+		c.ThinkingInOutput = o.ThinkingInOutput
+	}
+	if o.AssistantPrefill != nil {
+		c.AssistantPrefill = o.AssistantPrefill
+	}
+	if o.UsageMerge != "" {
+		c.UsageMerge = o.UsageMerge
+	}
+	if o.TemperatureMax != nil {
+		c.TemperatureMax = o.TemperatureMax
+	}
+	if o.TemperatureScale != nil {
+		c.TemperatureScale = o.TemperatureScale
+	}
+	if o.TopPMax != nil {
+		c.TopPMax = o.TopPMax
+	}
+	if o.TopK != nil {
+		c.TopK = o.TopK
+	}
+	if o.Tools != nil {
+		c.Tools = o.Tools
+	}
+	if o.Vision != nil {
+		c.Vision = o.Vision
+	}
+	return c
+}
+
+// builtinModelConfig 内置默认值
+func builtinModelConfig(actualModel string) ModelConfig {
+	intPtr := func(v int) *int { return &v }
+	floatPtr := func(v float64) *float64 { return &v }
+	boolPtr := func(v bool) *bool { return &v }
+
+	cfg := ModelConfig{StopSequences: DefaultStopSequences, TopK: boolPtr(true)}
+	switch {
+	case strings.HasPrefix(actualModel, "gemini-3-pro-"):
+		// Gemini 3 Pro：不传 thinkingBudget，让后端决定
+		cfg.ThinkingBudget = intPtr(0)
+	case IsClaudeModel(actualModel):
+		cfg.MaxOutputTokens = intPtr(64000)
+		cfg.ThinkingBudget = intPtr(32000)
+		// Claude 的 max_tokens 包含 budget_tokens
+		cfg.ThinkingInOutput = boolPtr(true)
+		// Claude 支持预填充 assistant 回答
+		cfg.AssistantPrefill = boolPtr(true)
+		// Claude 只接受 0–1，OpenAI 客户端的 0–2 按比例缩放
+		cfg.TemperatureMax = floatPtr(1)
+		cfg.TemperatureScale = boolPtr(true)
+		cfg.TopK = boolPtr(false)
+	default:
+		cfg.ThinkingBudget = intPtr(1024)
+	}
+	return cfg
+}
+
+// modelRegistry 模型配置注册表（models.json 修改后自动重新加载）
+type modelRegistry struct {
+	mu        sync.RWMutex
+	filePath  string
+	modTime   time.Time
+	lastCheck time.Time
+	entries   map[string]ModelConfig
+}
+
+var (
+	registry     *modelRegistry
+	registryOnce sync.Once
+)
+
+func getRegistry() *modelRegistry {
+	registryOnce.Do(func() {
+		registry = &modelRegistry{
+			filePath: filepath.Join(config.Get().DataDir, "models.json"),
+			entries:  make(map[string]ModelConfig),
+		}
+		registry.reloadIfChanged()
+		persist.Register(persist.File{
+			Name:   "models.json",
+			Path:   registry.filePath,
+			Reload: registry.forceReload,
+		})
+	})
+	return registry
+}
+
+// forceReload 忽略检查间隔和修改时间立即重新加载（恢复备份后调用）
+func (r *modelRegistry) forceReload() error {
+	r.mu.Lock()
+	r.lastCheck = time.Time{}
+	r.modTime = time.Time{}
+	r.mu.Unlock()
+	r.reloadIfChanged()
+	return nil
+}
+
+// reloadIfChanged 文件修改时间变化时重新加载
+func (r *modelRegistry) reloadIfChanged() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.lastCheck.IsZero() && time.Since(r.lastCheck) < registryReloadInterval {
+		return
+	}
+	r.lastCheck = time.Now()
+
+	info, err := os.Stat(r.filePath)
+	if err != nil {
+		if !r.modTime.IsZero() {
+			r.modTime = time.Time{}
+			r.entries = make(map[string]ModelConfig)
+		}
+		return
+	}
+	if info.ModTime().Equal(r.modTime) {
+		return
+	}
+
+	data, err := os.ReadFile(r.filePath)
+	if err != nil {
+		return
+	}
+
+	var entries map[string]ModelConfig
+	if err := json.Unmarshal(data, &entries); err != nil {
+		logger.Warn("Invalid model config %s: %v", r.filePath, err)
+		return
+	}
+	for name, entry := range entries {
+		if err := entry.Validate(); err != nil {
+			logger.Warn("Ignoring invalid model config %s: %v", name, err)
+			delete(entries, name)
+		}
+	}
+
+	r.entries = entries
+	r.modTime = info.ModTime()
+	logger.Info("Loaded %d model configs", len(entries))
+}
+
+// saveUnlocked 写回 models.json
+func (r *modelRegistry) saveUnlocked() error {
+	data, err := json.MarshalIndent(r.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := persist.WriteFile(r.filePath, data, 0644); err != nil {
+		return err
+	}
+	if info, err := os.Stat(r.filePath); err == nil {
+		r.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// GetModelConfig 获取模型生效配置：内置默认值 < "*" < 真实模型名 < 请求模型名
+func GetModelConfig(modelName string) ModelConfig {
+	r := getRegistry()
+	r.reloadIfChanged()
+
+	actualModel := ResolveModelName(modelName)
+	cfg := builtinModelConfig(actualModel)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if entry, ok := r.entries[DefaultModelConfigKey]; ok {
+		cfg = cfg.overlay(entry)
+	}
+	if entry, ok := r.entries[actualModel]; ok {
+		cfg = cfg.overlay(entry)
+	}
+	if modelName != actualModel {
+		if entry, ok := r.entries[modelName]; ok {
+			cfg = cfg.overlay(entry)
+		}
+	}
+	return cfg
+}
+
+// ModelConfigEntries 获取 models.json 中的配置项
+func ModelConfigEntries() map[string]ModelConfig {
+	r := getRegistry()
+	r.reloadIfChanged()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[string]ModelConfig, len(r.entries))
+	for name, entry := range r.entries {
+		result[name] = entry
+	}
+	return result
+}
+
+// SetModelConfig 设置单个模型（或 "*"）的配置并写回 models.json
+func SetModelConfig(name string, entry ModelConfig) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("model name is required")
+	}
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	r := getRegistry()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[name] = entry
+	return r.saveUnlocked()
+}
+
+// DeleteModelConfig 删除模型配置（恢复为默认值）
+func DeleteModelConfig(name string) (bool, error) {
+	r := getRegistry()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.entries[name]; !ok {
+		return false, nil
+	}
+	delete(r.entries, name)
+	return true, r.saveUnlocked()
+}
+
+// ModelsWithLimits 返回附带生效限制和能力的模型列表
+func ModelsWithLimits() []Model {
+	models := make([]Model, len(SupportedModels))
+	for i, m := range SupportedModels {
+		cfg := GetModelConfig(m.ID)
+		m.MaxOutputTokens = cfg.EffectiveMaxOutputTokens()
+		if ShouldEnableThinking(m.ID, nil) {
+			budget := cfg.EffectiveThinkingBudget()
+			m.ThinkingBudget = &budget
+		}
+		m.Capabilities, m.CapabilityMismatches = ModelCapabilities(m.ID)
+		models[i] = m
+	}
+	return models
+}
@@ -0,0 +1,61 @@
+package converter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// modelFlags 四个开关的生效值
+func modelFlags(cfg ModelConfig) [4]bool {
+	return [4]bool{
+		cfg.EffectiveSystemInContents(),
+		cfg.EffectiveReplayThoughts(),
+		cfg.EffectiveToolCallRecovery(),
+		cfg.EffectiveImplicitCache(),
+	}
+}
+
+func TestModelConfigFlagPrecedence(t *testing.T) {
+	on, off := boolean(true), boolean(false)
+	all := func(v *bool) ModelConfig {
+		return ModelConfig{SystemInContents: v, ReplayThoughts: v, ToolCallRecovery: v, ImplicitCache: v}
+	}
+
+	// 内置默认值全部关闭
+	if got := modelFlags(GetModelConfig("gemini-3-flash-bypass")); got != [4]bool{} {
+		t.Fatalf("builtin flags = %v, want all off", got)
+	}
+
+	// "*" 开启，真实模型关闭，请求模型名（bypass 别名）再开启其中两个
+	useModelConfig(t, DefaultModelConfigKey, all(on))
+	useModelConfig(t, "gemini-3-flash", all(off))
+	useModelConfig(t, "gemini-3-flash-bypass", ModelConfig{ReplayThoughts: on, ImplicitCache: on})
+
+	for _, tc := range []struct {
+		model string
+		want  [4]bool
+	}{
+		{"gemini-2.5-flash", [4]bool{true, true, true, true}},
+		{"gemini-3-flash", [4]bool{}},
+		{"gemini-3-flash-bypass", [4]bool{false, true, false, true}},
+	} {
+		if got := modelFlags(GetModelConfig(tc.model)); got != tc.want {
+			t.Errorf("%s flags = %v, want %v", tc.model, got, tc.want)
+		}
+	}
+}
+
+func TestModelConfigExplicitFalseRoundTrip(t *testing.T) {
+	// 显式关闭与未设置不同，写回 models.json 时保留
+	data, err := json.Marshal(ModelConfig{ReplayThoughts: boolean(false)})
+	if err != nil || string(data) != `{"replay_thoughts":false}` {
+		t.Fatalf("Marshal = %s, %v", data, err)
+	}
+	var cfg ModelConfig
+	if err := json.Unmarshal(data, &cfg); err != nil || cfg.ReplayThoughts == nil || *cfg.ReplayThoughts {
+		t.Errorf("Unmarshal = %+v, %v", cfg, err)
+	}
+	if data, _ := json.Marshal(ModelConfig{}); string(data) != `{}` {
+		t.Errorf("empty config = %s", data)
+	}
+}
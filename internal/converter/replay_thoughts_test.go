@@ -0,0 +1,95 @@
+package converter
+
+import (
+	"testing"
+
+	"anti2api-golang/internal/testutil"
+)
+
+const replayModel = "gemini-2.5-flash-thinking"
+
+// replayHistory 上一轮 assistant 带 reasoning 和签名的工具调用，之后是工具结果
+func replayHistory() []OpenAIMessage {
+	return []OpenAIMessage{
+		{Role: "user", Content: "weather in Paris?"},
+		{
+			Role:      "assistant",
+			Content:   "Checking.",
+			Reasoning: "need the weather tool",
+			ToolCalls: []OpenAIToolCall{{
+				ID:               "call_1",
+				Type:             "function",
+				Function:         OpenAIFunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`},
+				ThoughtSignature: "sig-1",
+			}},
+		},
+		{Role: "tool", ToolCallID: "call_1", Content: "sunny"},
+	}
+}
+
+// convertReplay 转换 replayHistory，返回 model 轮次的 parts 和生成配置
+func convertReplay(t *testing.T) ([]Part, *GenerationConfig) {
+	t.Helper()
+	account := testutil.Account("replay")
+	converted := ConvertOpenAIToAntigravity(&OpenAIChatRequest{Model: replayModel, Messages: replayHistory()}, &account)
+	for _, content := range converted.Request.Contents {
+		if content.Role == "model" {
+			return content.Parts, converted.Request.GenerationConfig
+		}
+	}
+	t.Fatalf("no model turn in %+v", converted.Request.Contents)
+	return nil, nil
+}
+
+func TestReplayThoughtsEnabled(t *testing.T) {
+	useModelConfig(t, replayModel, ModelConfig{ReplayThoughts: boolean(true)})
+
+	parts, gen := convertReplay(t)
+	if len(parts) != 3 {
+		t.Fatalf("parts = %+v, want thought, text, functionCall", parts)
+	}
+	// thought 位于 functionCall 之前，并带上工具调用的签名
+	thought := parts[0]
+	if !thought.Thought || thought.Text != "need the weather tool" || thought.ThoughtSignature != "sig-1" {
+		t.Errorf("thought part = %+v", thought)
+	}
+	if parts[1].Text != "Checking." || parts[1].Thought {
+		t.Errorf("text part = %+v", parts[1])
+	}
+	if call := parts[2]; call.FunctionCall == nil || call.FunctionCall.ID != "call_1" || call.ThoughtSignature != "sig-1" {
+		t.Errorf("functionCall part = %+v", call)
+	}
+	// 思考内容可以回放时，历史中的函数调用不再禁用思考
+	if gen.ThinkingConfig == nil {
+		t.Error("thinking disabled with replay_thoughts on")
+	}
+}
+
+func TestReplayThoughtsReasoningContentAlias(t *testing.T) {
+	msg := replayHistory()[1]
+	msg.Reasoning, msg.ReasoningContent = "", "from reasoning_content"
+	if part := buildThoughtPart(msg); part == nil || part.Text != "from reasoning_content" || part.ThoughtSignature != "sig-1" {
+		t.Errorf("thought part = %+v", part)
+	}
+	// 没有思考内容时不生成 thought Part
+	msg.ReasoningContent = ""
+	if part := buildThoughtPart(msg); part != nil {
+		t.Errorf("thought part = %+v without reasoning", part)
+	}
+}
+
+func TestReplayThoughtsDisabled(t *testing.T) {
+	parts, gen := convertReplay(t)
+	for _, part := range parts {
+		if part.Thought {
+			t.Errorf("thought part sent with replay_thoughts off: %+v", part)
+		}
+	}
+	if len(parts) != 2 || parts[1].FunctionCall == nil || parts[1].ThoughtSignature != "sig-1" {
+		t.Errorf("parts = %+v, want text and the signed functionCall", parts)
+	}
+	// 历史中有函数调用时照常禁用思考
+	if gen.ThinkingConfig != nil {
+		t.Errorf("thinkingConfig = %+v, want thinking disabled for history function calls", gen.ThinkingConfig)
+	}
+}
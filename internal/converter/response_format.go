@@ -0,0 +1,179 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+)
+
+// droppedSchemaKeywords 后端不接受、但不影响输出结构的 JSON Schema 关键字，转换时移除
+var droppedSchemaKeywords = map[string]bool{
+	"$schema":              true,
+	"$id":                  true,
+	"$comment":             true,
+	"additionalProperties": true,
+	"examples":             true,
+	"default":              true,
+	"strict":               true,
+}
+
+// unconvertibleSchemaKeywords 无法转换为后端 schema 的关键字（忽略会改变输出结构，直接拒绝请求）
+var unconvertibleSchemaKeywords = map[string]bool{
+	"$ref":              true,
+	"$defs":             true,
+	"definitions":       true,
+	"allOf":             true,
+	"oneOf":             true,
+	"not":               true,
+	"if":                true,
+	"then":              true,
+	"else":              true,
+	"patternProperties": true,
+	"dependentSchemas":  true,
+}
+
+// applyResponseFormat 将 response_format 转换为生成配置：json_object 只限定输出 JSON，json_schema 同时设置 responseSchema
+func applyResponseFormat(req *OpenAIChatRequest, config *GenerationConfig, issues *ConversionResult) {
+	format := req.ResponseFormat
+	if format == nil {
+		return
+	}
+
+	switch format.Type {
+	case "", "text":
+		return
+	case "json_object":
+		config.ResponseMimeType = "application/json"
+	case "json_schema":
+		if format.JSONSchema == nil || format.JSONSchema.Schema == nil {
+			issues.fail(IssueInvalidParam, "response_format.json_schema", "json_schema.schema is required when type is json_schema")
+			return
+		}
+		schema, err := convertResponseSchema(format.JSONSchema.Schema, "response_format.json_schema.schema")
+		if err != nil {
+			issues.fail(IssueInvalidParam, err.Param, "%s", err.Message)
+			return
+		}
+		if format.JSONSchema.Description != "" {
+			if _, ok := schema["description"]; !ok {
+				schema["description"] = format.JSONSchema.Description
+			}
+		}
+		config.ResponseMimeType = "application/json"
+		config.ResponseSchema = schema
+	default:
+		issues.fail(IssueInvalidParam, "response_format.type", "unsupported response_format type %q (expected text, json_object or json_schema)", format.Type)
+	}
+}
+
+// convertResponseSchema 复制 schema 并转换为后端支持的形式：移除 droppedSchemaKeywords，
+// 类型数组 ["T", "null"] 转为 type T + nullable，const 转为单值 enum。遇到无法转换的结构时返回错误
+func convertResponseSchema(schema map[string]interface{}, param string) (map[string]interface{}, *ConversionIssue) {
+	// 按键排序遍历，多个无法转换的关键字时报告的错误稳定
+	keys := make([]string, 0, len(schema))
+	for k := range schema {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make(map[string]interface{}, len(schema))
+	for _, key := range keys {
+		value := schema[key]
+		switch {
+		case droppedSchemaKeywords[key]:
+			continue
+		case unconvertibleSchemaKeywords[key]:
+			return nil, schemaIssue(param+"."+key, "JSON Schema keyword %q is not supported in response_format", key)
+		}
+
+		switch key {
+		case "type":
+			typ, nullable, err := convertSchemaType(value, param+".type")
+			if err != nil {
+				return nil, err
+			}
+			result["type"] = typ
+			if nullable {
+				result["nullable"] = true
+			}
+		case "const":
+			result["enum"] = []interface{}{value}
+		case "properties":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, schemaIssue(param+".properties", "properties must be an object")
+			}
+			converted := make(map[string]interface{}, len(props))
+			for name, child := range props {
+				c, err := convertChildSchema(child, param+".properties."+name)
+				if err != nil {
+					return nil, err
+				}
+				converted[name] = c
+			}
+			result["properties"] = converted
+		case "items":
+			c, err := convertChildSchema(value, param+".items")
+			if err != nil {
+				return nil, err
+			}
+			result["items"] = c
+		case "anyOf":
+			list, ok := value.([]interface{})
+			if !ok {
+				return nil, schemaIssue(param+".anyOf", "anyOf must be an array")
+			}
+			converted := make([]interface{}, len(list))
+			for i, child := range list {
+				c, err := convertChildSchema(child, fmt.Sprintf("%s.anyOf[%d]", param, i))
+				if err != nil {
+					return nil, err
+				}
+				converted[i] = c
+			}
+			result["anyOf"] = converted
+		default:
+			result[key] = value
+		}
+	}
+	return result, nil
+}
+
+// convertChildSchema 转换子 schema（布尔 schema 无法表示）
+func convertChildSchema(v interface{}, param string) (map[string]interface{}, *ConversionIssue) {
+	child, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, schemaIssue(param, "schema must be an object")
+	}
+	return convertResponseSchema(child, param)
+}
+
+// convertSchemaType 转换 type 字段：字符串原样保留，包含 null 的二元数组转为可空类型，其他组合无法转换
+func convertSchemaType(v interface{}, param string) (string, bool, *ConversionIssue) {
+	switch typ := v.(type) {
+	case string:
+		return typ, false, nil
+	case []interface{}:
+		var types []string
+		nullable := false
+		for _, item := range typ {
+			name, ok := item.(string)
+			if !ok {
+				return "", false, schemaIssue(param, "type must be a string or an array of strings")
+			}
+			if name == "null" {
+				nullable = true
+				continue
+			}
+			types = append(types, name)
+		}
+		if len(types) != 1 {
+			return "", false, schemaIssue(param, "type arrays are only supported as [\"<type>\", \"null\"]")
+		}
+		return types[0], nullable, nil
+	}
+	return "", false, schemaIssue(param, "type must be a string or an array of strings")
+}
+
+func schemaIssue(param, format string, args ...interface{}) *ConversionIssue {
+	return &ConversionIssue{Code: IssueInvalidParam, Param: param, Message: fmt.Sprintf(format, args...), Fatal: true}
+}
@@ -0,0 +1,74 @@
+package converter
+
+import "math"
+
+// openAITemperatureMax OpenAI temperature 上限（缩放时作为源范围）
+const openAITemperatureMax = 2.0
+
+// normalizeTemperature 将 temperature 调整到模型支持的范围：
+// 配置了 temperature_scale 时按比例从 0–2 缩放，否则截断到 [0, temperature_max]
+func normalizeTemperature(value *float64, cfg ModelConfig, issues *ConversionResult) *float64 {
+	if value == nil {
+		return nil
+	}
+	v := *value
+	limit := cfg.EffectiveTemperatureMax()
+
+	result := v
+	switch {
+	case v < 0:
+		result = 0
+	case cfg.TemperatureScale != nil && *cfg.TemperatureScale && limit < openAITemperatureMax:
+		result = math.Min(v, openAITemperatureMax) * limit / openAITemperatureMax
+	case v > limit:
+		result = limit
+	}
+	if result != v {
+		issues.note(IssueParamNormalized, "temperature", "temperature %g adjusted to %g (model supports 0–%g)", v, result, limit)
+	}
+	return &result
+}
+
+// normalizeTopP 将 top_p 截断到 [0, top_p_max]
+func normalizeTopP(value *float64, cfg ModelConfig, issues *ConversionResult) *float64 {
+	if value == nil {
+		return nil
+	}
+	v := *value
+	limit := cfg.EffectiveTopPMax()
+
+	result := math.Max(0, math.Min(v, limit))
+	if result != v {
+		issues.note(IssueParamNormalized, "top_p", "top_p %g adjusted to %g (model supports 0–%g)", v, result, limit)
+	}
+	return &result
+}
+
+// normalizeTopK 模型不支持 top_k 时丢弃，非正数视为未设置
+func normalizeTopK(value *int, cfg ModelConfig, modelName string, issues *ConversionResult) int {
+	if value == nil {
+		return 0
+	}
+	if cfg.TopK != nil && !*cfg.TopK {
+		issues.note(IssueParamNormalized, "top_k", "top_k dropped: not supported by %s", modelName)
+		return 0
+	}
+	if *value <= 0 {
+		issues.note(IssueParamNormalized, "top_k", "top_k %d ignored: must be positive", *value)
+		return 0
+	}
+	return *value
+}
+
+// dropSampling 模型不接受采样参数时全部丢弃
+func dropSampling(req *OpenAIChatRequest, issues *ConversionResult, format string, args ...interface{}) {
+	if req.Temperature != nil {
+		issues.note(IssueParamNormalized, "temperature", "temperature dropped: "+format, args...)
+	}
+	if req.TopP != nil {
+		issues.note(IssueParamNormalized, "top_p", "top_p dropped: "+format, args...)
+	}
+	if req.TopK != nil {
+		issues.note(IssueParamNormalized, "top_k", "top_k dropped: "+format, args...)
+	}
+}
@@ -0,0 +1,148 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+// sampling 请求中的采样参数（nil 为未设置）
+type sampling struct {
+	temperature *float64
+	topP        *float64
+	topK        *int
+}
+
+func float(v float64) *float64 { return &v }
+func integer(v int) *int       { return &v }
+func boolean(v bool) *bool     { return &v }
+
+// normalizedSampling 转换请求并返回生成配置和参数调整说明
+func normalizedSampling(model string, in sampling) (*GenerationConfig, []ConversionIssue) {
+	req := &OpenAIChatRequest{
+		Model:       model,
+		Messages:    []OpenAIMessage{{Role: "user", Content: "hi"}},
+		Temperature: in.temperature,
+		TopP:        in.topP,
+		TopK:        in.topK,
+	}
+	result := &ConversionResult{}
+	config := buildGenerationConfig(req, ResolveModelName(model), false, result)
+	var notes []ConversionIssue
+	for _, issue := range result.Issues {
+		if issue.Code == IssueParamNormalized {
+			notes = append(notes, issue)
+		}
+	}
+	return config, notes
+}
+
+// notedParams 调整说明涉及的参数
+func notedParams(notes []ConversionIssue) string {
+	var params []string
+	for _, n := range notes {
+		params = append(params, n.Param)
+	}
+	return strings.Join(params, ",")
+}
+
+func equalFloat(got, want *float64) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	return *got == *want
+}
+
+func TestSamplingNormalizationPerModelFamily(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		model       string
+		in          sampling
+		temperature *float64
+		topP        *float64
+		topK        int
+		noted       string
+	}{
+		// Gemini：OpenAI 范围内的值原样发送
+		{"gemini in range", "gemini-2.5-flash", sampling{float(1.3), float(1.0), integer(40)}, float(1.3), float(1.0), 40, ""},
+		{"gemini clamps above 2", "gemini-2.5-flash", sampling{float(2.5), float(1.5), nil}, float(2), float(1), 0, "temperature,top_p"},
+		{"gemini negative", "gemini-2.5-flash", sampling{float(-1), float(-0.5), integer(-3)}, float(0), float(0), 0, "temperature,top_p,top_k"},
+		{"gemini unset", "gemini-2.5-flash", sampling{}, nil, nil, 0, ""},
+		// Claude：0–2 按比例缩放到 0–1，不支持 top_p 和 top_k
+		{"claude rescales", "claude-sonnet-4-5", sampling{float(1.3), nil, nil}, float(0.65), nil, 0, "temperature"},
+		{"claude zero", "claude-sonnet-4-5", sampling{float(0), nil, nil}, float(0), nil, 0, ""},
+		{"claude above openai range", "claude-sonnet-4-5", sampling{float(3), nil, nil}, float(1), nil, 0, "temperature"},
+		{"claude drops top_p and top_k", "claude-sonnet-4-5", sampling{nil, float(0.9), integer(40)}, nil, nil, 0, "top_p,top_k"},
+		// Claude 思考模式只接受默认采样参数
+		{"claude thinking drops all", "claude-sonnet-4-5-thinking", sampling{float(0.5), float(0.9), integer(40)}, nil, nil, 0, "temperature,top_p,top_k"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config, notes := normalizedSampling(tc.model, tc.in)
+			if !equalFloat(config.Temperature, tc.temperature) {
+				t.Errorf("temperature = %v, want %v", deref(config.Temperature), deref(tc.temperature))
+			}
+			if !equalFloat(config.TopP, tc.topP) {
+				t.Errorf("top_p = %v, want %v", deref(config.TopP), deref(tc.topP))
+			}
+			if config.TopK != tc.topK {
+				t.Errorf("top_k = %d, want %d", config.TopK, tc.topK)
+			}
+			if got := notedParams(notes); got != tc.noted {
+				t.Errorf("normalized params = %q, want %q (%+v)", got, tc.noted, notes)
+			}
+		})
+	}
+}
+
+func TestSamplingNormalizationFromModelConfig(t *testing.T) {
+	const model = "gemini-2.5-pro"
+
+	t.Run("clamp", func(t *testing.T) {
+		useModelConfig(t, model, ModelConfig{TemperatureMax: float(1), TopPMax: float(0.95)})
+		config, notes := normalizedSampling(model, sampling{float(1.3), float(1.0), nil})
+		if *config.Temperature != 1 || *config.TopP != 0.95 {
+			t.Errorf("temperature=%v top_p=%v, want 1 and 0.95", *config.Temperature, *config.TopP)
+		}
+		if notedParams(notes) != "temperature,top_p" || !strings.Contains(notes[0].Message, "1.3 adjusted to 1") {
+			t.Errorf("notes = %+v", notes)
+		}
+	})
+
+	t.Run("rescale", func(t *testing.T) {
+		useModelConfig(t, model, ModelConfig{TemperatureMax: float(1), TemperatureScale: boolean(true)})
+		config, _ := normalizedSampling(model, sampling{float(1.5), nil, nil})
+		if *config.Temperature != 0.75 {
+			t.Errorf("temperature = %v, want 0.75", *config.Temperature)
+		}
+	})
+
+	t.Run("top_k unsupported", func(t *testing.T) {
+		useModelConfig(t, model, ModelConfig{TopK: boolean(false)})
+		config, notes := normalizedSampling(model, sampling{nil, nil, integer(40)})
+		if config.TopK != 0 || notedParams(notes) != "top_k" {
+			t.Errorf("top_k = %d, notes = %+v, want dropped", config.TopK, notes)
+		}
+	})
+}
+
+func TestSamplingNormalizationIsReported(t *testing.T) {
+	// 调整说明作为警告返回，严格模式下也不拒绝请求
+	useStrictConversion(t, true)
+	result := CheckConversion(&OpenAIChatRequest{
+		Model:       "claude-sonnet-4-5",
+		Messages:    []OpenAIMessage{{Role: "user", Content: "hi"}},
+		Temperature: float(1.3),
+	})
+	if result.Err() != nil {
+		t.Fatalf("Err = %v", result.Err())
+	}
+	if warnings := result.Warnings(); len(warnings) != 1 || !strings.HasPrefix(warnings[0], "temperature: temperature 1.3 adjusted to 0.65") {
+		t.Errorf("warnings = %q", warnings)
+	}
+}
+
+func deref(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
@@ -0,0 +1,147 @@
+package converter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// 后端要求多轮工具调用时回传 thoughtSignature。各协议携带签名的字段不同：
+//   - OpenAI：tool_calls[].thought_signature（扩展字段，逐个调用原样携带）
+//   - Anthropic：thinking 内容块的 signature
+//   - Responses：reasoning 输出项的 encrypted_content
+//
+// Anthropic 和 Responses 的载体字段每轮只有一个，用 EncodeSignatures 把该轮所有签名编码为一个不透明字符串；
+// 入站历史中的载体字段统一用 DecodeSignatures 解码（未编码的原始签名也接受，便于会话在不同协议的端点间延续），
+// 再用 RestoreSignatures 写回 Part.ThoughtSignature
+
+// signatureBundlePrefix 编码后签名的前缀（后端签名是 base64，不含冒号）
+const signatureBundlePrefix = "a2sig1:"
+
+// PartSignature 后端响应中一个部分的签名
+type PartSignature struct {
+	CallID    string `json:"id,omitempty"` // 所属函数调用的 ID，为空表示属于文本或思考部分
+	Signature string `json:"sig"`
+}
+
+// CollectSignatures 按顺序提取后端响应 parts 中的签名
+func CollectSignatures(parts []Part) []PartSignature {
+	var sigs []PartSignature
+	for _, part := range parts {
+		if part.ThoughtSignature == "" {
+			continue
+		}
+		sig := PartSignature{Signature: part.ThoughtSignature}
+		if part.FunctionCall != nil {
+			sig.CallID = part.FunctionCall.ID
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs
+}
+
+// ToolCallSignatures 提取流式输出的工具调用中的签名（流式响应没有完整的 parts）
+func ToolCallSignatures(calls []OpenAIToolCall) []PartSignature {
+	var sigs []PartSignature
+	for _, tc := range calls {
+		if tc.ThoughtSignature != "" {
+			sigs = append(sigs, PartSignature{CallID: tc.ID, Signature: tc.ThoughtSignature})
+		}
+	}
+	return sigs
+}
+
+// EncodeSignatures 将一轮的签名编码为载体字段的值（没有签名时返回空字符串）
+func EncodeSignatures(sigs []PartSignature) string {
+	if len(sigs) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(sigs)
+	if err != nil {
+		return ""
+	}
+	return signatureBundlePrefix + base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeSignatures 解码载体字段的值。不是 EncodeSignatures 编码的值视为一个原始签名
+func DecodeSignatures(carrier string) []PartSignature {
+	if carrier == "" {
+		return nil
+	}
+	encoded, ok := strings.CutPrefix(carrier, signatureBundlePrefix)
+	if !ok {
+		return []PartSignature{{Signature: carrier}}
+	}
+
+	var sigs []PartSignature
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(data, &sigs) != nil {
+		return nil
+	}
+	return sigs
+}
+
+// signatureFor 从载体字段中取出指定函数调用的签名（没有对应 ID 时取第一个不属于其他调用的签名）
+func signatureFor(carrier, callID string) string {
+	sigs := DecodeSignatures(carrier)
+	for _, sig := range sigs {
+		if sig.CallID != "" && sig.CallID == callID {
+			return sig.Signature
+		}
+	}
+	for _, sig := range sigs {
+		if sig.CallID == "" {
+			return sig.Signature
+		}
+	}
+	return ""
+}
+
+// RestoreSignatures 将入站历史中恢复的签名写回 model 轮次的 parts：
+// 带 ID 的签名写入同 ID 的 functionCall，其余签名依次写入尚无签名的 functionCall，
+// 该轮没有函数调用时写入第一个文本部分。已有签名的部分保持不变
+func RestoreSignatures(content *Content, sigs []PartSignature) {
+	var pending []string
+	for _, sig := range sigs {
+		if sig.CallID == "" || !restoreCallSignature(content.Parts, sig) {
+			pending = append(pending, sig.Signature)
+		}
+	}
+
+	for i := range content.Parts {
+		if len(pending) == 0 {
+			return
+		}
+		part := &content.Parts[i]
+		if part.FunctionCall != nil && part.ThoughtSignature == "" {
+			part.ThoughtSignature = pending[0]
+			pending = pending[1:]
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	for i := range content.Parts {
+		part := &content.Parts[i]
+		if part.FunctionCall != nil {
+			return
+		}
+		if part.Text != "" && !part.Thought && part.ThoughtSignature == "" {
+			part.ThoughtSignature = pending[0]
+			return
+		}
+	}
+}
+
+// restoreCallSignature 将签名写入同 ID 的 functionCall，找不到时返回 false
+func restoreCallSignature(parts []Part, sig PartSignature) bool {
+	for i := range parts {
+		if call := parts[i].FunctionCall; call != nil && call.ID == sig.CallID {
+			if parts[i].ThoughtSignature == "" {
+				parts[i].ThoughtSignature = sig.Signature
+			}
+			return true
+		}
+	}
+	return false
+}
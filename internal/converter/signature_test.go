@@ -0,0 +1,184 @@
+package converter
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// signedTurn 后端一轮响应：带签名的思考、文本和两个带签名的函数调用
+func signedTurn() []Part {
+	return []Part{
+		{Text: "planning", Thought: true, ThoughtSignature: "sig-thought"},
+		{Text: "checking both cities"},
+		{FunctionCall: &FunctionCall{ID: "call_a", Name: "weather", Args: json.RawMessage(`{"city":"Paris"}`)}, ThoughtSignature: "sig-a"},
+		{FunctionCall: &FunctionCall{ID: "call_b", Name: "weather", Args: json.RawMessage(`{"city":"Rome"}`)}, ThoughtSignature: "sig-b"},
+	}
+}
+
+// unsignedHistory 从其他协议入站的历史转换出的 model 轮次（还没有签名）
+func unsignedHistory() *Content {
+	return &Content{Role: "model", Parts: []Part{
+		{Text: "checking both cities"},
+		{FunctionCall: &FunctionCall{ID: "call_a", Name: "weather", Args: json.RawMessage(`{"city":"Paris"}`)}},
+		{FunctionCall: &FunctionCall{ID: "call_b", Name: "weather", Args: json.RawMessage(`{"city":"Rome"}`)}},
+	}}
+}
+
+// partSignatures 各部分的签名
+func partSignatures(parts []Part) []string {
+	sigs := make([]string, len(parts))
+	for i, part := range parts {
+		sigs[i] = part.ThoughtSignature
+	}
+	return sigs
+}
+
+func TestCollectSignatures(t *testing.T) {
+	want := []PartSignature{{Signature: "sig-thought"}, {CallID: "call_a", Signature: "sig-a"}, {CallID: "call_b", Signature: "sig-b"}}
+	if got := CollectSignatures(signedTurn()); !reflect.DeepEqual(got, want) {
+		t.Errorf("CollectSignatures = %+v, want %+v", got, want)
+	}
+	if got := CollectSignatures([]Part{{Text: "plain"}}); got != nil {
+		t.Errorf("CollectSignatures(unsigned) = %+v, want nil", got)
+	}
+
+	calls := []OpenAIToolCall{{ID: "call_a", ThoughtSignature: "sig-a"}, {ID: "call_x"}, {ID: "call_b", ThoughtSignature: "sig-b"}}
+	want = []PartSignature{{CallID: "call_a", Signature: "sig-a"}, {CallID: "call_b", Signature: "sig-b"}}
+	if got := ToolCallSignatures(calls); !reflect.DeepEqual(got, want) {
+		t.Errorf("ToolCallSignatures = %+v, want %+v", got, want)
+	}
+}
+
+func TestEncodeDecodeSignatures(t *testing.T) {
+	sigs := CollectSignatures(signedTurn())
+	carrier := EncodeSignatures(sigs)
+	if !strings.HasPrefix(carrier, signatureBundlePrefix) {
+		t.Fatalf("carrier = %q, want the bundle prefix", carrier)
+	}
+	if got := DecodeSignatures(carrier); !reflect.DeepEqual(got, sigs) {
+		t.Errorf("DecodeSignatures(EncodeSignatures) = %+v, want %+v", got, sigs)
+	}
+
+	if got := EncodeSignatures(nil); got != "" {
+		t.Errorf("EncodeSignatures(nil) = %q, want empty", got)
+	}
+	for carrier, want := range map[string][]PartSignature{
+		"":                                    nil,
+		"CiQBjz1rX2raw+/=":                    {{Signature: "CiQBjz1rX2raw+/="}}, // 未编码的后端签名原样接受
+		signatureBundlePrefix + "!!":          nil,
+		signatureBundlePrefix + "bm90IGpzb24": nil, // "not json"
+	} {
+		if got := DecodeSignatures(carrier); !reflect.DeepEqual(got, want) {
+			t.Errorf("DecodeSignatures(%q) = %+v, want %+v", carrier, got, want)
+		}
+	}
+}
+
+func TestRestoreSignatures(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content *Content
+		sigs    []PartSignature
+		want    []string
+	}{
+		{
+			name:    "by call id",
+			content: unsignedHistory(),
+			sigs:    []PartSignature{{CallID: "call_b", Signature: "sig-b"}, {CallID: "call_a", Signature: "sig-a"}},
+			want:    []string{"", "sig-a", "sig-b"},
+		},
+		{
+			name:    "unknown ids fill calls in order",
+			content: unsignedHistory(),
+			sigs:    []PartSignature{{CallID: "other_1", Signature: "sig-1"}, {Signature: "sig-2"}},
+			want:    []string{"", "sig-1", "sig-2"},
+		},
+		{
+			name:    "raw signature goes to the first call",
+			content: unsignedHistory(),
+			sigs:    DecodeSignatures("raw-backend-sig"),
+			want:    []string{"", "raw-backend-sig", ""},
+		},
+		{
+			name:    "text turn",
+			content: &Content{Role: "model", Parts: []Part{{Text: "hmm", Thought: true}, {Text: "answer"}}},
+			sigs:    []PartSignature{{Signature: "sig-text"}},
+			want:    []string{"", "sig-text"},
+		},
+		{
+			name: "existing signatures kept",
+			content: &Content{Role: "model", Parts: []Part{
+				{FunctionCall: &FunctionCall{ID: "call_a", Name: "weather"}, ThoughtSignature: "kept"},
+				{FunctionCall: &FunctionCall{ID: "call_b", Name: "weather"}},
+			}},
+			sigs: []PartSignature{{CallID: "call_a", Signature: "sig-a"}, {Signature: "sig-free"}},
+			want: []string{"kept", "sig-free"},
+		},
+		{
+			name:    "extra signatures dropped",
+			content: &Content{Role: "model", Parts: []Part{{FunctionCall: &FunctionCall{ID: "call_a", Name: "weather"}}}},
+			sigs:    []PartSignature{{Signature: "sig-1"}, {Signature: "sig-2"}},
+			want:    []string{"sig-1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			RestoreSignatures(tc.content, tc.sigs)
+			if got := partSignatures(tc.content.Parts); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("signatures = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestSignaturesOpenAIToAnthropic 会话从 OpenAI 端点开始，在使用单个载体字段的协议（Anthropic thinking.signature）上继续
+func TestSignaturesOpenAIToAnthropic(t *testing.T) {
+	var resp AntigravityResponse
+	resp.Response.Candidates = []Candidate{{Content: Content{Role: "model", Parts: signedTurn()}, FinishReason: "STOP"}}
+	completion := ConvertToOpenAIResponse(&resp, "gemini-2.5-flash", nil)
+	toolCalls := completion.Choices[0].Message.ToolCalls
+	if len(toolCalls) != 2 {
+		t.Fatalf("tool calls = %+v", toolCalls)
+	}
+
+	// OpenAI 客户端逐个调用携带签名，转到 Anthropic 时编码为一个载体
+	carrier := EncodeSignatures(ToolCallSignatures(toolCalls))
+
+	content := unsignedHistory()
+	RestoreSignatures(content, DecodeSignatures(carrier))
+	if got, want := partSignatures(content.Parts), []string{"", "sig-a", "sig-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("restored signatures = %q, want %q", got, want)
+	}
+}
+
+// TestSignaturesAnthropicToOpenAI 会话从单载体协议开始，客户端把载体值作为 thought_signature 在 OpenAI 端点继续
+func TestSignaturesAnthropicToOpenAI(t *testing.T) {
+	carrier := EncodeSignatures(CollectSignatures(signedTurn()))
+
+	messages := []OpenAIMessage{
+		{Role: "user", Content: "weather in Paris and Rome?"},
+		{Role: "assistant", Content: "", Reasoning: "planning", ToolCalls: []OpenAIToolCall{
+			{ID: "call_a", Type: "function", Function: OpenAIFunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}, ThoughtSignature: carrier},
+			{ID: "call_b", Type: "function", Function: OpenAIFunctionCall{Name: "weather", Arguments: `{"city":"Rome"}`}, ThoughtSignature: carrier},
+		}},
+		{Role: "tool", ToolCallID: "call_a", Content: "sunny"},
+		{Role: "tool", ToolCallID: "call_b", Content: "rain"},
+	}
+	contents := convertMessages(messages, true, ToolResultPolicy{}, nil)
+	if len(contents) != 3 || contents[1].Role != "model" {
+		t.Fatalf("contents = %+v", contents)
+	}
+	// 思考部分沿用首个调用的签名，每个调用按 ID 取回自己的签名
+	if got, want := partSignatures(contents[1].Parts), []string{"sig-a", "sig-a", "sig-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("upstream signatures = %q, want %q", got, want)
+	}
+
+	// 原始签名（未编码）仍然原样回传
+	messages[1].ToolCalls[0].ThoughtSignature = "raw-sig"
+	messages[1].ToolCalls[1].ThoughtSignature = ""
+	contents = convertMessages(messages, false, ToolResultPolicy{}, nil)
+	if got, want := partSignatures(contents[1].Parts), []string{"raw-sig", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("raw signatures = %q, want %q", got, want)
+	}
+}
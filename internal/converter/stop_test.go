@@ -0,0 +1,79 @@
+package converter
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStringOrSliceUnmarshal(t *testing.T) {
+	tests := []struct {
+		json string
+		want StringOrSlice
+		err  bool
+	}{
+		{`"###"`, StringOrSlice{"###"}, false},
+		{`"\n\nUser:"`, StringOrSlice{"\n\nUser:"}, false},
+		{`""`, nil, false},
+		{`["a","b"]`, StringOrSlice{"a", "b"}, false},
+		{`[]`, StringOrSlice{}, false},
+		{`null`, nil, false},
+		{`42`, nil, true},
+		{`["a",1]`, nil, true},
+		{`{"stop":"a"}`, nil, true},
+	}
+	for _, tt := range tests {
+		var got StringOrSlice
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: decoded as %q, want error", tt.json, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, %v; want %#v", tt.json, got, err, tt.want)
+		}
+	}
+
+	// 已有值时 null 清空
+	s := StringOrSlice{"old"}
+	if err := json.Unmarshal([]byte(`null`), &s); err != nil || s != nil {
+		t.Errorf("null over existing value = %#v, %v", s, err)
+	}
+}
+
+func TestStopAppendedToStopSequences(t *testing.T) {
+	defaults := GetModelConfig("gemini-2.5-flash").EffectiveStopSequences()
+	tests := []struct {
+		stop string
+		want []string
+	}{
+		{`"###"`, []string{"###"}},
+		{`["###","END"]`, []string{"###", "END"}},
+		{`null`, nil},
+		{`""`, nil},
+	}
+	for _, tt := range tests {
+		_, converted := convertChat(t, `{"model":"gemini-2.5-flash","stop":`+tt.stop+`,"messages":[{"role":"user","content":"hi"}]}`)
+		got := converted.Request.GenerationConfig.StopSequences
+		// 请求中的 stop 追加在模型默认停止序列之后
+		want := append(append([]string(nil), defaults...), tt.want...)
+		if !reflect.DeepEqual(got, want) && !(len(got) == 0 && len(want) == 0) {
+			t.Errorf("stop %s: stopSequences = %q, want %q", tt.stop, got, want)
+		}
+	}
+
+	// 默认停止序列不受请求影响
+	if again := GetModelConfig("gemini-2.5-flash").EffectiveStopSequences(); !reflect.DeepEqual(again, defaults) {
+		t.Errorf("default stop sequences changed: %q", again)
+	}
+}
+
+func TestStopDecodeError(t *testing.T) {
+	_, err := DecodeOpenAIChatRequest(strings.NewReader(`{"model":"gemini-2.5-flash","stop":42,"messages":[{"role":"user","content":"hi"}]}`))
+	if err == nil {
+		t.Fatal("numeric stop accepted")
+	}
+}
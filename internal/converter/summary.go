@@ -0,0 +1,64 @@
+package converter
+
+import (
+	"encoding/json"
+
+	"anti2api-golang/internal/store"
+)
+
+// SummarizeRequest 识别客户端请求的协议并提取通用摘要（用于日志），不认识的请求类型按 OpenAI 协议记录且摘要为空
+func SummarizeRequest(body interface{}) (string, store.RequestSummary) {
+	switch req := body.(type) {
+	case *OpenAIChatRequest:
+		return store.ProtocolOpenAI, summarizeOpenAI(req)
+	case *GeminiRequest:
+		return store.ProtocolGemini, summarizeGemini(req)
+	case GeminiRequest:
+		return store.ProtocolGemini, summarizeGemini(&req)
+	}
+	return store.ProtocolOpenAI, store.RequestSummary{}
+}
+
+func summarizeOpenAI(req *OpenAIChatRequest) store.RequestSummary {
+	summary := store.RequestSummary{
+		Model:        req.Model,
+		Messages:     len(req.Messages),
+		PromptTokens: EstimateTokens(req).Total,
+		Tools:        len(req.Tools),
+	}
+	for _, msg := range req.Messages {
+		summary.Images += countImages(msg.Content)
+	}
+	return summary
+}
+
+func summarizeGemini(req *GeminiRequest) store.RequestSummary {
+	summary := store.RequestSummary{Messages: len(req.Contents)}
+	if req.SystemInstruction != nil {
+		for _, part := range req.SystemInstruction.Parts {
+			summary.PromptTokens += estimateTextTokens(part.Text)
+		}
+	}
+	for _, content := range req.Contents {
+		for _, part := range content.Parts {
+			summary.PromptTokens += estimateTextTokens(part.Text)
+			if part.InlineData != nil {
+				summary.Images++
+				summary.PromptTokens += imageTokenEstimate
+			}
+			if part.FunctionCall != nil {
+				summary.PromptTokens += estimateTextTokens(part.FunctionCall.Name + string(part.FunctionCall.Args))
+			}
+			if part.FunctionResponse != nil {
+				resp, _ := json.Marshal(part.FunctionResponse.Response)
+				summary.PromptTokens += estimateTextTokens(string(resp))
+			}
+		}
+	}
+	for _, tool := range req.Tools {
+		summary.Tools += len(tool.FunctionDeclarations)
+		data, _ := json.Marshal(tool)
+		summary.PromptTokens += estimateTextTokens(string(data))
+	}
+	return summary
+}
@@ -0,0 +1,62 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/store"
+)
+
+func TestSummarizeOpenAIRequest(t *testing.T) {
+	req := &OpenAIChatRequest{
+		Model: "gemini-2.5-flash",
+		Messages: []OpenAIMessage{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: parts(textPart("look"), imagePart(testImage), imagePart(testImage))},
+		},
+		Tools: []OpenAITool{{Type: "function", Function: OpenAIFunction{Name: "ls"}}},
+	}
+	protocol, summary := SummarizeRequest(req)
+	if protocol != store.ProtocolOpenAI {
+		t.Fatalf("protocol = %q", protocol)
+	}
+	if summary.Model != "gemini-2.5-flash" || summary.Messages != 2 || summary.Images != 2 || summary.Tools != 1 ||
+		summary.PromptTokens != EstimateTokens(req).Total {
+		t.Fatalf("summary = %+v", summary)
+	}
+}
+
+func TestSummarizeGeminiRequest(t *testing.T) {
+	req := GeminiRequest{
+		SystemInstruction: &SystemInstruction{Parts: []Part{{Text: "Be brief."}}},
+		Contents: []Content{
+			{Role: "user", Parts: []Part{{Text: strings.Repeat("word ", 40)}, {InlineData: &InlineData{MimeType: "image/png", Data: "iVBORw0KGgo="}}}},
+			{Role: "model", Parts: []Part{{FunctionCall: &FunctionCall{Name: "ls", Args: []byte(`{"path":"."}`)}}}},
+			{Role: "user", Parts: []Part{{FunctionResponse: &FunctionResponse{Name: "ls", Response: map[string]interface{}{"files": "a.txt"}}}}},
+		},
+		Tools: []Tool{{FunctionDeclarations: []FunctionDeclaration{{Name: "ls"}, {Name: "cat"}}}},
+	}
+
+	// 指针和值都按 Gemini 协议识别
+	for _, body := range []interface{}{&req, req} {
+		protocol, summary := SummarizeRequest(body)
+		if protocol != store.ProtocolGemini {
+			t.Fatalf("protocol = %q", protocol)
+		}
+		// Gemini 请求体中没有模型名，由调用方补充
+		if summary.Model != "" || summary.Messages != 3 || summary.Images != 1 || summary.Tools != 2 {
+			t.Fatalf("summary = %+v", summary)
+		}
+		// 文本、图片、函数调用和结果、工具声明都计入提示估算
+		if min := estimateTextTokens(strings.Repeat("word ", 40)) + imageTokenEstimate; summary.PromptTokens <= min {
+			t.Fatalf("prompt tokens = %d, want > %d", summary.PromptTokens, min)
+		}
+	}
+}
+
+func TestSummarizeUnknownRequest(t *testing.T) {
+	protocol, summary := SummarizeRequest(map[string]interface{}{"model": "x"})
+	if protocol != store.ProtocolOpenAI || summary != (store.RequestSummary{}) {
+		t.Fatalf("SummarizeRequest = %q %+v", protocol, summary)
+	}
+}
@@ -0,0 +1,79 @@
+package converter
+
+import (
+	"reflect"
+	"testing"
+
+	"anti2api-golang/internal/testutil"
+)
+
+// useModelConfig 在测试期间为 model 设置配置
+func useModelConfig(t *testing.T, model string, cfg ModelConfig) {
+	t.Helper()
+	if err := SetModelConfig(model, cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteModelConfig(model) })
+}
+
+func TestSystemInstructionPlacement(t *testing.T) {
+	const model = "claude-sonnet-4-5"
+	account := testutil.Account("system")
+	messages := []OpenAIMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello"},
+		{Role: "user", Content: "Again"},
+	}
+
+	t.Run("systemInstruction", func(t *testing.T) {
+		req := ConvertOpenAIToAntigravity(&OpenAIChatRequest{Model: model, Messages: messages}, &account)
+		inner := req.Request
+		if inner.SystemInstruction == nil || !reflect.DeepEqual(inner.SystemInstruction.Parts, []Part{{Text: "Be brief."}}) {
+			t.Fatalf("systemInstruction = %+v", inner.SystemInstruction)
+		}
+		if !reflect.DeepEqual(inner.Contents[0].Parts, []Part{{Text: "Hi"}}) {
+			t.Errorf("first user message changed: %+v", inner.Contents[0].Parts)
+		}
+	})
+
+	t.Run("system_in_contents", func(t *testing.T) {
+		useModelConfig(t, model, ModelConfig{SystemInContents: boolean(true)})
+		req := ConvertOpenAIToAntigravity(&OpenAIChatRequest{Model: model, Messages: messages}, &account)
+		inner := req.Request
+		if inner.SystemInstruction != nil {
+			t.Fatalf("systemInstruction sent: %+v", inner.SystemInstruction)
+		}
+		if len(inner.Contents) != 3 {
+			t.Fatalf("contents = %+v, want the original 3 messages", inner.Contents)
+		}
+		want := []Part{{Text: "Be brief." + systemContentSeparator}, {Text: "Hi"}}
+		if !reflect.DeepEqual(inner.Contents[0].Parts, want) {
+			t.Errorf("first user parts = %+v, want %+v", inner.Contents[0].Parts, want)
+		}
+		// 只注入第一个 user 消息
+		if !reflect.DeepEqual(inner.Contents[2].Parts, []Part{{Text: "Again"}}) {
+			t.Errorf("later user message changed: %+v", inner.Contents[2].Parts)
+		}
+	})
+
+	t.Run("no user message", func(t *testing.T) {
+		useModelConfig(t, model, ModelConfig{SystemInContents: boolean(true)})
+		req := ConvertOpenAIToAntigravity(&OpenAIChatRequest{Model: model, Messages: []OpenAIMessage{
+			{Role: "system", Content: "Be brief."},
+			{Role: "assistant", Content: "Hello"},
+		}}, &account)
+		inner := req.Request
+		if inner.SystemInstruction != nil {
+			t.Fatalf("systemInstruction sent: %+v", inner.SystemInstruction)
+		}
+		// 没有 user 消息时系统提示成为开头的 user 消息
+		if len(inner.Contents) != 2 || inner.Contents[0].Role != "user" ||
+			!reflect.DeepEqual(inner.Contents[0].Parts, []Part{{Text: "Be brief."}}) {
+			t.Fatalf("contents = %+v, want a leading user message with the system text", inner.Contents)
+		}
+		if inner.Contents[1].Role != "model" {
+			t.Errorf("assistant message role = %q", inner.Contents[1].Role)
+		}
+	})
+}
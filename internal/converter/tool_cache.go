@@ -0,0 +1,75 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// toolCacheSize 缓存的工具定义组数（多轮对话每轮请求的 tools 通常完全相同）
+const toolCacheSize = 64
+
+// toolCacheKey tools 原文指纹 + 生效的限制（限制变化后重新转换）
+type toolCacheKey struct {
+	fingerprint string
+	limits      toolLimits
+}
+
+// cachedTools 转换后的工具定义及转换中记录的问题
+type cachedTools struct {
+	tools  []Tool
+	issues []ConversionIssue
+}
+
+var (
+	toolCacheMu sync.Mutex
+	toolCache   = make(map[toolCacheKey]*cachedTools)
+)
+
+// toolsFingerprint 计算 tools 原文的指纹
+func toolsFingerprint(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// sanitizedTools 转换并裁剪请求中的工具定义。解码时记录了 tools 指纹的请求复用缓存结果
+// （同一请求的检查与转换、多轮对话的后续请求），缓存的定义只读共享，问题按原样回放到 issues
+func (req *OpenAIChatRequest) sanitizedTools(issues *ConversionResult) []Tool {
+	limits := currentToolLimits()
+	if req.toolsKey == "" || len(req.Tools) == 0 {
+		return convertTools(req.Tools, limits, issues)
+	}
+
+	key := toolCacheKey{fingerprint: req.toolsKey, limits: limits}
+	toolCacheMu.Lock()
+	cached := toolCache[key]
+	toolCacheMu.Unlock()
+
+	if cached == nil {
+		// 以非严格模式记录问题：convertTools 只产生 warn 和 fail，回放时按 Fatal 区分
+		recorded := &ConversionResult{}
+		tools := convertTools(req.Tools, limits, recorded)
+		cached = &cachedTools{tools: tools[:len(tools):len(tools)], issues: recorded.Issues}
+
+		toolCacheMu.Lock()
+		if len(toolCache) >= toolCacheSize {
+			for k := range toolCache {
+				delete(toolCache, k)
+				break
+			}
+		}
+		toolCache[key] = cached
+		toolCacheMu.Unlock()
+	}
+
+	if issues != nil {
+		for _, issue := range cached.issues {
+			if issue.Fatal {
+				issues.fail(issue.Code, issue.Param, "%s", issue.Message)
+			} else {
+				issues.warn(issue.Code, issue.Param, "%s", issue.Message)
+			}
+		}
+	}
+	return cached.tools
+}
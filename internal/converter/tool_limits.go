@@ -0,0 +1,202 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"anti2api-golang/internal/config"
+)
+
+// toolLimits 工具声明限制（0 为不限）
+type toolLimits struct {
+	maxDeclarations     int
+	maxDescriptionChars int
+	maxProperties       int
+	maxDepth            int
+}
+
+func currentToolLimits() toolLimits {
+	cfg := config.Get()
+	return toolLimits{
+		maxDeclarations:     cfg.ToolMaxDeclarations,
+		maxDescriptionChars: cfg.ToolDescriptionMaxChars,
+		maxProperties:       cfg.ToolSchemaMaxProperties,
+		maxDepth:            cfg.ToolSchemaMaxDepth,
+	}
+}
+
+// limitDescription 截断超长的函数描述（按字符）
+func (l toolLimits) limitDescription(description, param string, issues *ConversionResult) string {
+	if l.maxDescriptionChars <= 0 || utf8.RuneCountInString(description) <= l.maxDescriptionChars {
+		return description
+	}
+	chars := utf8.RuneCountInString(description)
+	issues.warn(IssueToolLimitExceeded, param, "description has %d characters, truncated to %d", chars, l.maxDescriptionChars)
+	return string([]rune(description)[:l.maxDescriptionChars])
+}
+
+// limitSchema 按属性数量和嵌套深度裁剪参数 schema（depth 从 1 开始），需要裁剪时返回副本，不修改请求中的原始定义；
+// 未超出限制时原样返回（大多数请求），避免复制整个 schema
+func (l toolLimits) limitSchema(schema map[string]interface{}, depth int, param string, issues *ConversionResult) map[string]interface{} {
+	if schema == nil {
+		return nil
+	}
+	if l.schemaWithin(schema, depth) {
+		return schema
+	}
+	if l.maxDepth > 0 && depth > l.maxDepth {
+		issues.warn(IssueToolLimitExceeded, param, "schema is nested deeper than %d levels, nested definition removed", l.maxDepth)
+		flat := map[string]interface{}{}
+		for _, key := range []string{"type", "description"} {
+			if v, ok := schema[key]; ok {
+				flat[key] = v
+			}
+		}
+		return flat
+	}
+
+	result := make(map[string]interface{}, len(schema))
+	for k, v := range schema {
+		result[k] = v
+	}
+
+	if props, ok := schema["properties"].(map[string]interface{}); ok {
+		keys := l.keptProperties(props, schema["required"], param, issues)
+		limited := make(map[string]interface{}, len(keys))
+		for _, key := range keys {
+			limited[key] = l.limitChild(props[key], depth+1, param+".properties."+key, issues)
+		}
+		result["properties"] = limited
+		if len(keys) < len(props) {
+			result["required"] = filterRequired(schema["required"], limited)
+		}
+	}
+	if _, ok := schema["items"]; ok {
+		result["items"] = l.limitChild(schema["items"], depth+1, param+".items", issues)
+	}
+	if _, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+		result["additionalProperties"] = l.limitChild(schema["additionalProperties"], depth+1, param+".additionalProperties", issues)
+	}
+	for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+		if list, ok := schema[key].([]interface{}); ok {
+			limited := make([]interface{}, len(list))
+			for i, item := range list {
+				limited[i] = l.limitChild(item, depth+1, fmt.Sprintf("%s.%s[%d]", param, key, i), issues)
+			}
+			result[key] = limited
+		}
+	}
+	return result
+}
+
+// schemaWithin schema 是否未超出属性数量和嵌套深度限制（与 limitSchema 遍历相同的子节点）
+func (l toolLimits) schemaWithin(schema map[string]interface{}, depth int) bool {
+	if l.maxDepth > 0 && depth > l.maxDepth {
+		return false
+	}
+	if props, ok := schema["properties"].(map[string]interface{}); ok {
+		if l.maxProperties > 0 && len(props) > l.maxProperties {
+			return false
+		}
+		for _, child := range props {
+			if !l.childWithin(child, depth+1) {
+				return false
+			}
+		}
+	}
+	if items, ok := schema["items"]; ok && !l.childWithin(items, depth+1) {
+		return false
+	}
+	if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok && !l.schemaWithin(additional, depth+1) {
+		return false
+	}
+	for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+		if list, ok := schema[key].([]interface{}); ok {
+			for _, item := range list {
+				if !l.childWithin(item, depth+1) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// childWithin 子 schema（对象或对象数组）是否未超出限制
+func (l toolLimits) childWithin(v interface{}, depth int) bool {
+	switch child := v.(type) {
+	case map[string]interface{}:
+		return l.schemaWithin(child, depth)
+	case []interface{}:
+		for _, item := range child {
+			if !l.childWithin(item, depth) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// limitChild 裁剪子 schema（对象或对象数组），其他值原样返回
+func (l toolLimits) limitChild(v interface{}, depth int, param string, issues *ConversionResult) interface{} {
+	switch child := v.(type) {
+	case map[string]interface{}:
+		return l.limitSchema(child, depth, param, issues)
+	case []interface{}:
+		limited := make([]interface{}, len(child))
+		for i, item := range child {
+			limited[i] = l.limitChild(item, depth, fmt.Sprintf("%s[%d]", param, i), issues)
+		}
+		return limited
+	}
+	return v
+}
+
+// keptProperties 返回保留的属性名：超出上限时优先保留 required 中的属性，其余按名称排序，保证结果确定
+func (l toolLimits) keptProperties(props map[string]interface{}, required interface{}, param string, issues *ConversionResult) []string {
+	requiredSet := make(map[string]bool)
+	if list, ok := required.([]interface{}); ok {
+		for _, item := range list {
+			if name, ok := item.(string); ok {
+				requiredSet[name] = true
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if requiredSet[keys[i]] != requiredSet[keys[j]] {
+			return requiredSet[keys[i]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	if l.maxProperties <= 0 || len(keys) <= l.maxProperties {
+		return keys
+	}
+	issues.warn(IssueToolLimitExceeded, param+".properties", "%d properties exceed the limit of %d, dropped: %v",
+		len(keys), l.maxProperties, keys[l.maxProperties:])
+	return keys[:l.maxProperties]
+}
+
+// filterRequired 从 required 中移除已丢弃的属性
+func filterRequired(required interface{}, props map[string]interface{}) interface{} {
+	list, ok := required.([]interface{})
+	if !ok {
+		return required
+	}
+	kept := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		if name, ok := item.(string); ok {
+			if _, exists := props[name]; !exists {
+				continue
+			}
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
@@ -0,0 +1,258 @@
+package converter
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/config"
+)
+
+// useToolLimits 在测试期间设置工具声明限制
+func useToolLimits(t *testing.T, declarations, descriptionChars, properties, depth int) {
+	t.Helper()
+	cfg := config.Get()
+	previous := [4]int{cfg.ToolMaxDeclarations, cfg.ToolDescriptionMaxChars, cfg.ToolSchemaMaxProperties, cfg.ToolSchemaMaxDepth}
+	cfg.ToolMaxDeclarations, cfg.ToolDescriptionMaxChars, cfg.ToolSchemaMaxProperties, cfg.ToolSchemaMaxDepth = declarations, descriptionChars, properties, depth
+	t.Cleanup(func() {
+		cfg.ToolMaxDeclarations, cfg.ToolDescriptionMaxChars, cfg.ToolSchemaMaxProperties, cfg.ToolSchemaMaxDepth = previous[0], previous[1], previous[2], previous[3]
+	})
+}
+
+// manyTools n 个按序编号的工具定义（JSON）
+func manyTools(n int) string {
+	tools := make([]string, n)
+	for i := range tools {
+		tools[i] = fmt.Sprintf(`{"type":"function","function":{"name":"tool%03d","description":"tool number %d","parameters":{"type":"object","properties":{"n":{"type":"integer"}}}}}`, i, i)
+	}
+	return "[" + strings.Join(tools, ",") + "]"
+}
+
+// declaredNames 转换结果中的函数名（按发送顺序）
+func declaredNames(tools []Tool) []string {
+	var names []string
+	for _, tool := range tools {
+		for _, decl := range tool.FunctionDeclarations {
+			names = append(names, decl.Name)
+		}
+	}
+	return names
+}
+
+// limitIssues 转换结果中的 tool_limit_exceeded 问题
+func limitIssues(result *ConversionResult) []ConversionIssue {
+	var issues []ConversionIssue
+	for _, issue := range result.Issues {
+		if issue.Code == IssueToolLimitExceeded {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// checkTools 解码请求，返回发送给上游的工具和转换问题
+func checkTools(t *testing.T, tools string) ([]Tool, *ConversionResult) {
+	t.Helper()
+	req, converted := convertChat(t, chatBody(tools, ""))
+	return converted.Request.Tools, CheckConversion(req)
+}
+
+func TestToolDeclarationLimitDropsTail(t *testing.T) {
+	useStrictConversion(t, false)
+	useToolLimits(t, 128, 0, 0, 0)
+
+	body := manyTools(200)
+	var first []string
+	for run := 0; run < 3; run++ {
+		tools, result := checkTools(t, body)
+		names := declaredNames(tools)
+		if len(names) != 128 {
+			t.Fatalf("run %d: %d declarations sent, want 128", run, len(names))
+		}
+		// 保留前 128 个，顺序不变
+		for i, name := range names {
+			if want := fmt.Sprintf("tool%03d", i); name != want {
+				t.Fatalf("run %d: declaration %d = %s, want %s", run, i, name, want)
+			}
+		}
+		if run == 0 {
+			first = names
+		} else if !reflect.DeepEqual(names, first) {
+			t.Fatalf("run %d: truncation not deterministic", run)
+		}
+
+		issues := limitIssues(result)
+		if len(issues) != 1 || issues[0].Fatal || issues[0].Param != "tools[128]" || !strings.Contains(issues[0].Message, "tools[128:] dropped") {
+			t.Fatalf("run %d: issues = %+v, want one warning for tools[128:]", run, issues)
+		}
+		if result.Err() != nil {
+			t.Fatalf("run %d: error %v in non-strict mode", run, result.Err())
+		}
+	}
+}
+
+func TestToolDeclarationLimitAtBoundary(t *testing.T) {
+	useStrictConversion(t, false)
+	useToolLimits(t, 128, 0, 0, 0)
+
+	tools, result := checkTools(t, manyTools(128))
+	if len(tools) != 128 || len(limitIssues(result)) != 0 {
+		t.Fatalf("%d tools, issues %+v; want all 128 without warnings", len(tools), result.Issues)
+	}
+}
+
+func TestToolDescriptionTruncatedByCharacters(t *testing.T) {
+	useStrictConversion(t, false)
+	useToolLimits(t, 0, 5, 0, 0)
+
+	tools, result := checkTools(t, `[
+		{"type":"function","function":{"name":"short","description":"fits"}},
+		{"type":"function","function":{"name":"long","description":"天气预报查询工具"}}
+	]`)
+	if got := tools[0].FunctionDeclarations[0].Description; got != "fits" {
+		t.Errorf("short description = %q", got)
+	}
+	// 按字符截断，不切开多字节字符
+	if got := tools[1].FunctionDeclarations[0].Description; got != "天气预报查" {
+		t.Errorf("long description = %q, want 天气预报查", got)
+	}
+	issues := limitIssues(result)
+	if len(issues) != 1 || issues[0].Param != "tools[1].function.description" || !strings.Contains(issues[0].Message, "8 characters, truncated to 5") {
+		t.Fatalf("issues = %+v", issues)
+	}
+}
+
+func TestToolSchemaPropertyLimit(t *testing.T) {
+	useStrictConversion(t, false)
+	useToolLimits(t, 0, 0, 2, 0)
+
+	tools, result := checkTools(t, `[{"type":"function","function":{"name":"search","parameters":{
+		"type":"object",
+		"properties":{"b":{"type":"string"},"a":{"type":"string"},"z":{"type":"string"},"c":{"type":"string"}},
+		"required":["z","c"]
+	}}}]`)
+	params := tools[0].FunctionDeclarations[0].Parameters
+	props := params["properties"].(map[string]interface{})
+	// required 中的属性优先保留
+	if len(props) != 2 || props["z"] == nil || props["c"] == nil {
+		t.Fatalf("kept properties = %v, want c and z", props)
+	}
+	if !reflect.DeepEqual(params["required"], []interface{}{"z", "c"}) {
+		t.Errorf("required = %v", params["required"])
+	}
+	issues := limitIssues(result)
+	if len(issues) != 1 || issues[0].Param != "tools[0].function.parameters.properties" || !strings.Contains(issues[0].Message, "dropped: [a b]") {
+		t.Fatalf("issues = %+v", issues)
+	}
+
+	// 没有 required 时按名称保留，required 中被丢弃的属性同时移除
+	tools, _ = checkTools(t, `[{"type":"function","function":{"name":"search","parameters":{
+		"type":"object",
+		"properties":{"d":{"type":"string"},"b":{"type":"string"},"a":{"type":"string"}},
+		"required":["d"]
+	}}}]`)
+	params = tools[0].FunctionDeclarations[0].Parameters
+	props = params["properties"].(map[string]interface{})
+	if len(props) != 2 || props["d"] == nil || props["a"] == nil {
+		t.Fatalf("kept properties = %v, want a and d", props)
+	}
+}
+
+func TestToolSchemaDepthLimit(t *testing.T) {
+	useStrictConversion(t, false)
+	useToolLimits(t, 0, 0, 0, 2)
+
+	tools, result := checkTools(t, `[{"type":"function","function":{"name":"deep","parameters":{
+		"type":"object",
+		"properties":{
+			"flat":{"type":"string"},
+			"outer":{"type":"object","description":"nested","properties":{"inner":{"type":"string"}}}
+		}
+	}}}]`)
+	props := tools[0].FunctionDeclarations[0].Parameters["properties"].(map[string]interface{})
+	if !reflect.DeepEqual(props["flat"], map[string]interface{}{"type": "string"}) {
+		t.Errorf("flat = %v", props["flat"])
+	}
+	// 第 2 层仍保留，第 3 层起只保留 type 和 description
+	outer := props["outer"].(map[string]interface{})
+	inner := outer["properties"].(map[string]interface{})["inner"]
+	if !reflect.DeepEqual(inner, map[string]interface{}{"type": "string"}) {
+		t.Errorf("inner = %v", inner)
+	}
+	if len(limitIssues(result)) == 0 {
+		t.Fatalf("issues = %+v, want a depth warning", result.Issues)
+	}
+
+	tooDeep := `[{"type":"function","function":{"name":"deep","parameters":{"type":"object","properties":{"a":{"type":"object","description":"a","properties":{"b":{"type":"object","properties":{"c":{"type":"string"}}}}}}}}}]`
+	tools, result = checkTools(t, tooDeep)
+	a := tools[0].FunctionDeclarations[0].Parameters["properties"].(map[string]interface{})["a"].(map[string]interface{})
+	b := a["properties"].(map[string]interface{})["b"]
+	if !reflect.DeepEqual(b, map[string]interface{}{"type": "object"}) {
+		t.Fatalf("level 3 schema = %v, want flattened", b)
+	}
+	issues := limitIssues(result)
+	if len(issues) != 1 || issues[0].Param != "tools[0].function.parameters.properties.a.properties.b" {
+		t.Fatalf("issues = %+v", issues)
+	}
+}
+
+func TestToolLimitsDoNotModifyRequest(t *testing.T) {
+	useStrictConversion(t, false)
+	useToolLimits(t, 1, 3, 1, 1)
+
+	req, converted := convertChat(t, chatBody(`[
+		{"type":"function","function":{"name":"first","description":"long description","parameters":{"type":"object","properties":{"a":{"type":"object","properties":{"x":{"type":"string"}}},"b":{"type":"string"}}}}},
+		{"type":"function","function":{"name":"second"}}
+	]`, ""))
+	if len(converted.Request.Tools) != 1 {
+		t.Fatalf("tools = %+v", converted.Request.Tools)
+	}
+	if len(req.Tools) != 2 || req.Tools[0].Function.Description != "long description" {
+		t.Fatalf("request tools modified: %+v", req.Tools)
+	}
+	if props := req.Tools[0].Function.Parameters["properties"].(map[string]interface{}); len(props) != 2 {
+		t.Fatalf("request schema modified: %v", props)
+	}
+}
+
+func TestToolLimitsZeroIsUnlimited(t *testing.T) {
+	useStrictConversion(t, false)
+	useToolLimits(t, 0, 0, 0, 0)
+
+	tools, result := checkTools(t, manyTools(300))
+	if len(tools) != 300 || len(limitIssues(result)) != 0 {
+		t.Fatalf("%d tools, issues %+v; want all 300 without warnings", len(tools), result.Issues)
+	}
+}
+
+func TestToolLimitsStrictModeRejects(t *testing.T) {
+	useStrictConversion(t, true)
+	useToolLimits(t, 128, 0, 0, 0)
+
+	_, result := checkTools(t, manyTools(200))
+	err := result.Err()
+	if err == nil || err.Code != IssueToolLimitExceeded || err.Param != "tools[128]" {
+		t.Fatalf("err = %v, want tool_limit_exceeded for tools[128]", err)
+	}
+	if warnings := result.Warnings(); len(warnings) != 0 {
+		t.Errorf("warnings = %q, want none in strict mode", warnings)
+	}
+}
+
+func TestToolLimitsChangeInvalidatesCache(t *testing.T) {
+	useStrictConversion(t, false)
+	body := manyTools(10)
+
+	useToolLimits(t, 5, 0, 0, 0)
+	tools, _ := checkTools(t, body)
+	if len(tools) != 5 {
+		t.Fatalf("%d tools with limit 5", len(tools))
+	}
+	// 相同的 tools 在限制变化后重新转换
+	useToolLimits(t, 8, 0, 0, 0)
+	tools, result := checkTools(t, body)
+	if len(tools) != 8 || len(limitIssues(result)) != 1 {
+		t.Fatalf("%d tools, issues %+v with limit 8", len(tools), result.Issues)
+	}
+}
@@ -0,0 +1,97 @@
+package converter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// toolWithParameters 声明一个 noop 函数，parameters 字段原样写入 JSON（为空时省略）
+func toolWithParameters(parameters string) string {
+	function := `"name":"noop","description":"does nothing"`
+	if parameters != "" {
+		function += `,"parameters":` + parameters
+	}
+	return `[{"type":"function","function":{` + function + `}}]`
+}
+
+// declaredParameters 上游请求体中 noop 函数声明的 parameters（按 JSON 序列化结果）
+func declaredParameters(t *testing.T, converted *AntigravityRequest) string {
+	t.Helper()
+	data, err := json.Marshal(converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Request struct {
+			Tools []struct {
+				FunctionDeclarations []map[string]json.RawMessage `json:"functionDeclarations"`
+			} `json:"tools"`
+		} `json:"request"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Request.Tools) != 1 || len(body.Request.Tools[0].FunctionDeclarations) != 1 {
+		t.Fatalf("upstream tools = %s", data)
+	}
+	declaration := body.Request.Tools[0].FunctionDeclarations[0]
+	if string(declaration["name"]) != `"noop"` {
+		t.Errorf("declaration name = %s", declaration["name"])
+	}
+	return string(declaration["parameters"])
+}
+
+func TestToolParametersShapes(t *testing.T) {
+	const empty = `{"properties":{},"type":"object"}`
+	for _, tc := range []struct {
+		name       string
+		parameters string
+		want       string
+	}{
+		{"missing", "", empty},
+		{"null", `null`, empty},
+		{"empty object", `{}`, empty},
+		{"empty properties", `{"type":"object","properties":{}}`, empty},
+		{"empty properties with required", `{"type":"object","properties":{},"required":[]}`, `{"properties":{},"required":[],"type":"object"}`},
+		{"schema stripped", `{"$schema":"http://json-schema.org/draft-07/schema#","type":"object","properties":{"a":{"type":"string"}}}`, `{"properties":{"a":{"type":"string"}},"type":"object"}`},
+		{"string", `"{\"type\":\"object\",\"properties\":{\"a\":{\"type\":\"integer\"}}}"`, `{"properties":{"a":{"type":"integer"}},"type":"object"}`},
+		{"empty string", `""`, empty},
+		{"blank string", `"  "`, empty},
+		{"string null", `"null"`, empty},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, converted := convertChat(t, chatBody(toolWithParameters(tc.parameters), ""))
+			if got := declaredParameters(t, converted); got != tc.want {
+				t.Errorf("parameters = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestToolParametersInvalid(t *testing.T) {
+	for name, parameters := range map[string]string{
+		"number":           `42`,
+		"array":            `[{"type":"object"}]`,
+		"string not json":  `"type: object"`,
+		"string array":     `"[1,2]"`,
+		"string truncated": `"{\"type\":"`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeOpenAIChatRequest(strings.NewReader(chatBody(toolWithParameters(parameters), "")))
+			if err == nil {
+				t.Fatal("decode succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), "parameters") {
+				t.Errorf("error = %v, want it to mention parameters", err)
+			}
+		})
+	}
+}
+
+func TestToolParametersNotMutated(t *testing.T) {
+	req, _ := convertChat(t, chatBody(toolWithParameters(`{"$schema":"x","type":"object","properties":{}}`), ""))
+	if _, ok := req.Tools[0].Function.Parameters["$schema"]; !ok {
+		t.Errorf("client parameters = %v, $schema was removed from the request", req.Tools[0].Function.Parameters)
+	}
+}
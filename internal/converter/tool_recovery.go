@@ -0,0 +1,568 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+
+	"anti2api-golang/internal/utils"
+)
+
+// 文本形式工具调用的起始标记（模型未使用 FunctionCall Part，而是把调用写进正文）
+const (
+	deepseekCallsBegin = "<｜tool▁calls▁begin｜>"
+	deepseekCallsEnd   = "<｜tool▁calls▁end｜>"
+	deepseekCallBegin  = "<｜tool▁call▁begin｜>"
+	deepseekCallEnd    = "<｜tool▁call▁end｜>"
+	deepseekSep        = "<｜tool▁sep｜>"
+	hermesCallBegin    = "<tool_call>"
+	hermesCallEnd      = "</tool_call>"
+)
+
+// toolCallMarkers 需要检查的起始标记（JSON 对象/数组另外按行首的 { 或 [ 识别）
+var toolCallMarkers = []string{
+	"```tool_code", "```tool_call", "```json",
+	hermesCallBegin, deepseekCallsBegin, deepseekCallBegin,
+}
+
+// maxRecoveryHold 流式输出中暂存的候选内容上限，超过后按普通文本输出
+const maxRecoveryHold = 256 << 10
+
+// RecoverToolCalls 从正文中提取文本形式的工具调用（只提取名称与声明的工具匹配的调用），返回剩余正文
+func RecoverToolCalls(text string, tools []Tool) (string, []OpenAIToolCall) {
+	rest, calls := recoverToolCalls(text, declaredToolNames(tools))
+	if calls == nil {
+		return text, nil
+	}
+	return strings.TrimSpace(rest), calls
+}
+
+// recoverToolCalls 提取工具调用，返回未去除首尾空白的剩余正文（没有调用时 calls 为 nil）
+func recoverToolCalls(text string, declared map[string]bool) (string, []OpenAIToolCall) {
+	if len(declared) == 0 || text == "" {
+		return text, nil
+	}
+
+	var rest strings.Builder
+	var calls []OpenAIToolCall
+	lineStart := true
+	for pos := 0; pos < len(text); {
+		p := findToolCallStart(text[pos:], lineStart)
+		if p < 0 {
+			rest.WriteString(text[pos:])
+			break
+		}
+		start := pos + p
+		rest.WriteString(text[pos:start])
+		end, found, complete := matchToolCall(text[start:], declared)
+		if !complete || found == nil {
+			// 不是工具调用：原样保留候选内容
+			if !complete {
+				end = 1
+			}
+			rest.WriteString(text[start : start+end])
+		} else {
+			calls = append(calls, found...)
+		}
+		lineStart = atLineStart(text[pos:start+end], lineStart)
+		pos = start + end
+	}
+
+	if len(calls) == 0 {
+		return text, nil
+	}
+	return rest.String(), calls
+}
+
+// ToolCallRecovery 流式正文中的工具调用提取：可能是工具调用的内容暂存到结束时再处理，其他内容直接输出
+type ToolCallRecovery struct {
+	declared  map[string]bool
+	pending   string // 尚未输出的内容（从候选起始位置开始）
+	lineStart bool   // pending 的开头是否位于行首
+	waiting   bool   // pending 开头的候选内容尚未完整
+	confirmed bool   // 已确认包含工具调用，之后的内容全部暂存
+	emitted   bool   // 已输出过内容
+}
+
+// NewToolCallRecovery 创建流式提取器，没有声明工具时返回 nil
+func NewToolCallRecovery(tools []Tool) *ToolCallRecovery {
+	declared := declaredToolNames(tools)
+	if len(declared) == 0 {
+		return nil
+	}
+	return &ToolCallRecovery{declared: declared, lineStart: true}
+}
+
+// Write 写入一段正文，返回可以立即输出的内容
+func (r *ToolCallRecovery) Write(chunk string) string {
+	r.pending += chunk
+	if r.confirmed {
+		return ""
+	}
+	// 候选内容未完整时，只有出现可能的结束字符才重新检查
+	if r.waiting && !strings.ContainsAny(chunk, "}]`>｜") && len(r.pending) <= maxRecoveryHold {
+		return ""
+	}
+	r.waiting = false
+
+	var out strings.Builder
+	for {
+		p := findToolCallStart(r.pending, r.lineStart)
+		if p < 0 {
+			// 保留可能是起始标记前缀的结尾
+			keep := markerPrefixLen(r.pending)
+			r.emit(&out, len(r.pending)-keep)
+			return out.String()
+		}
+		r.emit(&out, p)
+
+		end, found, complete := matchToolCall(r.pending, r.declared)
+		switch {
+		case !complete && len(r.pending) <= maxRecoveryHold:
+			r.waiting = true
+			return out.String()
+		case !complete:
+			r.emit(&out, 1)
+		case found != nil:
+			r.confirmed = true
+			return out.String()
+		default:
+			r.emit(&out, end)
+		}
+	}
+}
+
+// emit 输出 pending 的前 n 个字节
+func (r *ToolCallRecovery) emit(out *strings.Builder, n int) {
+	if n <= 0 {
+		return
+	}
+	out.WriteString(r.pending[:n])
+	r.emitted = true
+	r.lineStart = atLineStart(r.pending[:n], r.lineStart)
+	r.pending = r.pending[n:]
+}
+
+// Finish 结束时处理暂存的内容，返回剩余正文和提取的工具调用
+func (r *ToolCallRecovery) Finish() (string, []OpenAIToolCall) {
+	rest := r.pending
+	r.pending = ""
+	if !r.confirmed {
+		return rest, nil
+	}
+	rest, calls := recoverToolCalls(rest, r.declared)
+	// 与整体提取一致：只去除整段正文的首尾空白，已输出内容之后的空白保留
+	if r.emitted {
+		return strings.TrimRightFunc(rest, unicode.IsSpace), calls
+	}
+	return strings.TrimSpace(rest), calls
+}
+
+// Flush 不提取工具调用，返回暂存的原始内容
+func (r *ToolCallRecovery) Flush() string {
+	rest := r.pending
+	r.pending = ""
+	return rest
+}
+
+func declaredToolNames(tools []Tool) map[string]bool {
+	declared := make(map[string]bool)
+	for _, tool := range tools {
+		for _, fn := range tool.FunctionDeclarations {
+			if fn.Name != "" {
+				declared[fn.Name] = true
+			}
+		}
+	}
+	return declared
+}
+
+// findToolCallStart 查找下一个候选起始位置：起始标记，或行首（lineStart 表示 s 开头是否位于行首）的 { / [
+func findToolCallStart(s string, lineStart bool) int {
+	best := -1
+	for _, marker := range toolCallMarkers {
+		if i := strings.Index(s, marker); i >= 0 && (best < 0 || i < best) {
+			best = i
+		}
+	}
+	for i := 0; i < len(s) && (best < 0 || i < best); i++ {
+		switch c := s[i]; c {
+		case '\n':
+			lineStart = true
+		case ' ', '\t', '\r':
+		case '{', '[':
+			if lineStart {
+				return i
+			}
+			lineStart = false
+		default:
+			lineStart = false
+		}
+	}
+	return best
+}
+
+// atLineStart s 之后的位置是否位于行首（只有空白字符）
+func atLineStart(s string, lineStart bool) bool {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+		lineStart = true
+	}
+	return lineStart && strings.TrimLeft(s, " \t\r") == ""
+}
+
+// markerPrefixLen s 结尾可能是起始标记前缀的长度
+func markerPrefixLen(s string) int {
+	keep := 0
+	for _, marker := range toolCallMarkers {
+		for n := len(marker) - 1; n > keep; n-- {
+			if strings.HasSuffix(s, marker[:n]) {
+				keep = n
+				break
+			}
+		}
+	}
+	return keep
+}
+
+// matchToolCall 解析 s 开头的候选内容：end 为候选结束位置，calls 为 nil 表示不是工具调用，
+// complete 为 false 表示内容尚不完整
+func matchToolCall(s string, declared map[string]bool) (end int, calls []OpenAIToolCall, complete bool) {
+	switch {
+	case strings.HasPrefix(s, "```"):
+		nl := strings.IndexByte(s, '\n')
+		if nl < 0 {
+			return 0, nil, false
+		}
+		closing := strings.Index(s[nl:], "```")
+		if closing < 0 {
+			return 0, nil, false
+		}
+		inner := s[nl+1 : nl+closing]
+		return nl + closing + 3, parseToolCallText(inner, declared), true
+
+	case strings.HasPrefix(s, hermesCallBegin):
+		closing := strings.Index(s, hermesCallEnd)
+		if closing < 0 {
+			return 0, nil, false
+		}
+		inner := s[len(hermesCallBegin):closing]
+		return closing + len(hermesCallEnd), parseJSONToolCalls(inner, declared), true
+
+	case strings.HasPrefix(s, deepseekCallsBegin):
+		closing := strings.Index(s, deepseekCallsEnd)
+		if closing < 0 {
+			return 0, nil, false
+		}
+		inner := s[len(deepseekCallsBegin):closing]
+		return closing + len(deepseekCallsEnd), parseDeepseekToolCalls(inner, declared), true
+
+	case strings.HasPrefix(s, deepseekCallBegin):
+		closing := strings.Index(s, deepseekCallEnd)
+		if closing < 0 {
+			return 0, nil, false
+		}
+		end = closing + len(deepseekCallEnd)
+		return end, parseDeepseekToolCalls(s[:end], declared), true
+
+	case s != "" && (s[0] == '{' || s[0] == '['):
+		decoder := json.NewDecoder(strings.NewReader(s))
+		decoder.UseNumber()
+		var v interface{}
+		if err := decoder.Decode(&v); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+				return 0, nil, false
+			}
+			return 1, nil, true
+		}
+		end = int(decoder.InputOffset())
+		return end, toolCallsFromJSON(v, declared), true
+	}
+	return 1, nil, true
+}
+
+// parseToolCallText 解析代码块中的工具调用：JSON，或 Python 调用形式 name(key=value, ...)
+func parseToolCallText(inner string, declared map[string]bool) []OpenAIToolCall {
+	inner = strings.TrimSpace(inner)
+	if inner == "" {
+		return nil
+	}
+	if inner[0] == '{' || inner[0] == '[' {
+		return parseJSONToolCalls(inner, declared)
+	}
+
+	var calls []OpenAIToolCall
+	for _, line := range strings.Split(inner, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		call, ok := parsePythonToolCall(line, declared)
+		if !ok {
+			return nil
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+func parseJSONToolCalls(inner string, declared map[string]bool) []OpenAIToolCall {
+	decoder := json.NewDecoder(strings.NewReader(strings.TrimSpace(inner)))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil || decoder.More() {
+		return nil
+	}
+	return toolCallsFromJSON(v, declared)
+}
+
+// toolCallsFromJSON 识别常见的 JSON 工具调用形式，任一调用的名称未声明时整体视为普通文本：
+//   - {"name": ..., "arguments"|"parameters"|"args"|"input": ...}
+//   - {"type": "function", "function": {"name": ..., "arguments": ...}}
+//   - {"tool_calls": [...]} 或以上形式的数组
+func toolCallsFromJSON(v interface{}, declared map[string]bool) []OpenAIToolCall {
+	switch node := v.(type) {
+	case []interface{}:
+		if len(node) == 0 {
+			return nil
+		}
+		var calls []OpenAIToolCall
+		for _, item := range node {
+			found := toolCallsFromJSON(item, declared)
+			if len(found) != 1 {
+				return nil
+			}
+			calls = append(calls, found...)
+		}
+		return calls
+
+	case map[string]interface{}:
+		if list, ok := node["tool_calls"].([]interface{}); ok && len(node) == 1 {
+			return toolCallsFromJSON(list, declared)
+		}
+		if fn, ok := node["function"].(map[string]interface{}); ok {
+			node = fn
+		}
+		name, _ := node["name"].(string)
+		if !declared[name] {
+			return nil
+		}
+		var args interface{} = map[string]interface{}{}
+		for _, key := range []string{"arguments", "parameters", "args", "input"} {
+			if value, ok := node[key]; ok {
+				args = value
+				break
+			}
+		}
+		arguments, ok := normalizeRecoveredArgs(args)
+		if !ok {
+			return nil
+		}
+		return []OpenAIToolCall{newRecoveredToolCall(name, arguments)}
+	}
+	return nil
+}
+
+// normalizeRecoveredArgs 参数必须是 JSON 对象（或内容为 JSON 对象的字符串）
+func normalizeRecoveredArgs(args interface{}) (string, bool) {
+	if s, ok := args.(string); ok {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &obj); err != nil {
+			return "", false
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(s)); err != nil {
+			return "", false
+		}
+		return buf.String(), true
+	}
+	if _, ok := args.(map[string]interface{}); !ok {
+		return "", false
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// parseDeepseekToolCalls 解析 DeepSeek 格式：
+// <｜tool▁call▁begin｜>function<｜tool▁sep｜>name\n```json\n{...}\n```<｜tool▁call▁end｜>，
+// 或 <｜tool▁call▁begin｜>name<｜tool▁sep｜>{...}<｜tool▁call▁end｜>
+func parseDeepseekToolCalls(inner string, declared map[string]bool) []OpenAIToolCall {
+	var calls []OpenAIToolCall
+	for {
+		begin := strings.Index(inner, deepseekCallBegin)
+		if begin < 0 {
+			break
+		}
+		inner = inner[begin+len(deepseekCallBegin):]
+		end := strings.Index(inner, deepseekCallEnd)
+		if end < 0 {
+			return nil
+		}
+		body := inner[:end]
+		inner = inner[end+len(deepseekCallEnd):]
+
+		head, args, ok := strings.Cut(body, deepseekSep)
+		if !ok {
+			return nil
+		}
+		name := strings.TrimSpace(head)
+		if name == "function" {
+			name, args, _ = strings.Cut(strings.TrimLeft(args, " \t"), "\n")
+			name = strings.TrimSpace(name)
+		}
+		args = strings.TrimSpace(args)
+		args = strings.TrimPrefix(args, "```json")
+		args = strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(args, "```")), "```")
+		if !declared[name] {
+			return nil
+		}
+		arguments, ok := normalizeRecoveredArgs(strings.TrimSpace(args))
+		if !ok {
+			return nil
+		}
+		calls = append(calls, newRecoveredToolCall(name, arguments))
+	}
+	return calls
+}
+
+// parsePythonToolCall 解析 tool_code 中的 Python 调用：[print(][default_api.]name(key=value, ...)[)]，
+// 参数值只支持字面量（字符串、数字、True/False/None、列表和字典）
+func parsePythonToolCall(line string, declared map[string]bool) (OpenAIToolCall, bool) {
+	if strings.HasPrefix(line, "print(") && strings.HasSuffix(line, ")") {
+		line = strings.TrimSpace(line[len("print(") : len(line)-1])
+	}
+	line = strings.TrimPrefix(line, "default_api.")
+
+	open := strings.IndexByte(line, '(')
+	if open <= 0 || !strings.HasSuffix(line, ")") {
+		return OpenAIToolCall{}, false
+	}
+	name := line[:open]
+	if !declared[name] {
+		return OpenAIToolCall{}, false
+	}
+
+	args := make(map[string]interface{})
+	for _, arg := range splitTopLevel(line[open+1:len(line)-1], ',') {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(arg, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !isIdentifier(key) {
+			return OpenAIToolCall{}, false
+		}
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(pythonLiteralToJSON(strings.TrimSpace(value))), &parsed); err != nil {
+			return OpenAIToolCall{}, false
+		}
+		args[key] = parsed
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return OpenAIToolCall{}, false
+	}
+	return newRecoveredToolCall(name, string(data)), true
+}
+
+// splitTopLevel 按不在字符串和括号内的分隔符切分
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// pythonLiteralToJSON 将 Python 字面量转换为 JSON（单引号字符串、True/False/None）
+func pythonLiteralToJSON(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '"':
+			// 读取完整字符串后按 JSON 重新编码
+			var str strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+					switch s[j] {
+					case 'n':
+						str.WriteByte('\n')
+					case 't':
+						str.WriteByte('\t')
+					default:
+						str.WriteByte(s[j])
+					}
+					continue
+				}
+				str.WriteByte(s[j])
+			}
+			encoded, _ := json.Marshal(str.String())
+			out.Write(encoded)
+			i = j
+		case strings.HasPrefix(s[i:], "True"):
+			out.WriteString("true")
+			i += 3
+		case strings.HasPrefix(s[i:], "False"):
+			out.WriteString("false")
+			i += 4
+		case strings.HasPrefix(s[i:], "None"):
+			out.WriteString("null")
+			i += 3
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && (i == 0 || !(c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRecoveredToolCall(name, arguments string) OpenAIToolCall {
+	return OpenAIToolCall{
+		ID:   utils.GenerateToolCallID(),
+		Type: "function",
+		Function: OpenAIFunctionCall{
+			Name:      name,
+			Arguments: arguments,
+		},
+	}
+}
@@ -0,0 +1,180 @@
+package converter
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+// recoveryCase testdata/tool_recovery.json 中的一条模型输出
+type recoveryCase struct {
+	Name    string `json:"name"`
+	Text    string `json:"text"`
+	Content string `json:"content"`
+	Calls   []struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"calls"`
+}
+
+// recoveryTools 测试用的已声明工具
+var recoveryTools = []Tool{{FunctionDeclarations: []FunctionDeclaration{{Name: "get_weather"}, {Name: "search"}}}}
+
+func loadRecoveryCases(t *testing.T) []recoveryCase {
+	t.Helper()
+	data, err := os.ReadFile("testdata/tool_recovery.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []recoveryCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+	return cases
+}
+
+// checkRecoveredCalls 比较提取的调用名称和参数，每个调用都有 ID
+func checkRecoveredCalls(t *testing.T, tc recoveryCase, calls []OpenAIToolCall) {
+	t.Helper()
+	if len(calls) != len(tc.Calls) {
+		t.Fatalf("recovered %d calls, want %d: %+v", len(calls), len(tc.Calls), calls)
+	}
+	for i, call := range calls {
+		if call.Function.Name != tc.Calls[i].Name || call.Function.Arguments != tc.Calls[i].Arguments {
+			t.Errorf("call %d = %s(%s), want %s(%s)", i, call.Function.Name, call.Function.Arguments, tc.Calls[i].Name, tc.Calls[i].Arguments)
+		}
+		if call.ID == "" || call.Type != "function" {
+			t.Errorf("call %d id=%q type=%q", i, call.ID, call.Type)
+		}
+	}
+}
+
+func TestRecoverToolCallsFixtures(t *testing.T) {
+	for _, tc := range loadRecoveryCases(t) {
+		t.Run(tc.Name, func(t *testing.T) {
+			content, calls := RecoverToolCalls(tc.Text, recoveryTools)
+			if content != tc.Content {
+				t.Errorf("content = %q, want %q", content, tc.Content)
+			}
+			checkRecoveredCalls(t, tc, calls)
+		})
+	}
+}
+
+func TestRecoverToolCallsWithoutDeclaredTools(t *testing.T) {
+	for _, tc := range loadRecoveryCases(t) {
+		if content, calls := RecoverToolCalls(tc.Text, nil); content != tc.Text || calls != nil {
+			t.Errorf("%s: recovered %+v without declared tools", tc.Name, calls)
+		}
+	}
+	if NewToolCallRecovery(nil) != nil {
+		t.Error("NewToolCallRecovery should return nil without declared tools")
+	}
+}
+
+func TestToolCallRecoveryStreamMatchesFixtures(t *testing.T) {
+	r := rand.New(rand.NewSource(725))
+	for _, tc := range loadRecoveryCases(t) {
+		t.Run(tc.Name, func(t *testing.T) {
+			// 随机切分为流式片段，结果与整体提取一致
+			for round := 0; round < 20; round++ {
+				recovery := NewToolCallRecovery(recoveryTools)
+				var out strings.Builder
+				for rest := tc.Text; rest != ""; {
+					n := 1 + r.Intn(12)
+					if n > len(rest) {
+						n = len(rest)
+					}
+					out.WriteString(recovery.Write(rest[:n]))
+					rest = rest[n:]
+				}
+				tail, calls := recovery.Finish()
+				out.WriteString(tail)
+
+				if len(tc.Calls) == 0 {
+					if out.String() != tc.Text {
+						t.Fatalf("streamed %q, want the text unchanged", out.String())
+					}
+				} else if got := strings.TrimSpace(out.String()); got != tc.Content {
+					t.Fatalf("streamed content %q, want %q", got, tc.Content)
+				}
+				checkRecoveredCalls(t, tc, calls)
+			}
+		})
+	}
+}
+
+func TestToolCallRecoveryEmitsPlainTextImmediately(t *testing.T) {
+	recovery := NewToolCallRecovery(recoveryTools)
+	if out := recovery.Write("Hello, "); out != "Hello, " {
+		t.Errorf("Write = %q, want plain text passed through", out)
+	}
+	// 可能是起始标记前缀的结尾暂存
+	if out := recovery.Write("see <tool_"); out != "see " {
+		t.Errorf("Write = %q, want the marker prefix held back", out)
+	}
+	if out := recovery.Write("tips> for details"); out != "<tool_tips> for details" {
+		t.Errorf("Write = %q, want the held text released", out)
+	}
+	// 候选内容完整之前暂存，不是工具调用时原样输出
+	if out := recovery.Write("\n{\"city\": "); out != "\n" {
+		t.Errorf("Write = %q, want the JSON candidate held", out)
+	}
+	if out := recovery.Write("\"Paris\"}\nbye"); out != "{\"city\": \"Paris\"}\nbye" {
+		t.Errorf("Write = %q, want the non-call JSON released", out)
+	}
+	if rest, calls := recovery.Finish(); rest != "" || calls != nil {
+		t.Errorf("Finish = %q, %+v", rest, calls)
+	}
+}
+
+func TestToolCallRecoveryFlushKeepsRawText(t *testing.T) {
+	recovery := NewToolCallRecovery(recoveryTools)
+	text := "<tool_call>{\"name\": \"search\", \"arguments\": {\"query\": \"x\"}}</tool_call>"
+	if out := recovery.Write(text); out != "" {
+		t.Errorf("Write = %q, want the call held", out)
+	}
+	// 上游已返回 FunctionCall 或流被截断时，按原文输出
+	if rest := recovery.Flush(); rest != text {
+		t.Errorf("Flush = %q", rest)
+	}
+}
+
+// textResponse 只包含一段正文的上游响应
+func textResponse(text string) *AntigravityResponse {
+	var resp AntigravityResponse
+	resp.Response.Candidates = []Candidate{{
+		Content:      Content{Role: "model", Parts: []Part{{Text: text}}},
+		FinishReason: "STOP",
+	}}
+	return &resp
+}
+
+func TestConvertToOpenAIResponseRecoversToolCalls(t *testing.T) {
+	const model = "recovery-test-model"
+	text := "Let me check.\n<tool_call>{\"name\": \"get_weather\", \"arguments\": {\"city\": \"Paris\"}}</tool_call>"
+
+	// 未开启时原样返回
+	resp := ConvertToOpenAIResponse(textResponse(text), model, recoveryTools)
+	if msg := resp.Choices[0].Message; msg.Content != text || len(msg.ToolCalls) != 0 || *resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("without recovery: %+v finish=%s", msg, *resp.Choices[0].FinishReason)
+	}
+
+	useModelConfig(t, model, ModelConfig{ToolCallRecovery: boolean(true)})
+	resp = ConvertToOpenAIResponse(textResponse(text), model, recoveryTools)
+	msg := resp.Choices[0].Message
+	if msg.Content != "Let me check." || len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Name != "get_weather" {
+		t.Errorf("with recovery: %+v", msg)
+	}
+	if *resp.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("finish_reason = %s, want tool_calls", *resp.Choices[0].FinishReason)
+	}
+
+	// 名称未声明时不提取
+	resp = ConvertToOpenAIResponse(textResponse(text), model, []Tool{{FunctionDeclarations: []FunctionDeclaration{{Name: "search"}}}})
+	if msg := resp.Choices[0].Message; msg.Content != text || len(msg.ToolCalls) != 0 {
+		t.Errorf("undeclared tool recovered: %+v", msg)
+	}
+}
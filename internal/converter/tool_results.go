@@ -0,0 +1,166 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// tool 结果超过大小上限时的处理方式
+const (
+	ToolResultTruncate = "truncate" // 截断中间部分（JSON 按结构截断）
+	ToolResultReject   = "reject"   // 返回 400
+)
+
+// ToolResultPolicy tool 消息内容的大小限制
+type ToolResultPolicy struct {
+	MaxBytes  int     // 单个 tool 结果的大小上限，0 为不限
+	Mode      string  // ToolResultTruncate 或 ToolResultReject
+	HeadRatio float64 // 截断文本时开头保留的比例（其余保留结尾）
+}
+
+// ParseToolResultMode 解析处理方式，无法识别时返回 false
+func ParseToolResultMode(value string) (string, bool) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case ToolResultTruncate, ToolResultReject:
+		return mode, true
+	}
+	return "", false
+}
+
+// limitToolResult 按策略处理 tool 结果：超出上限时截断并记录说明，或按 reject 记录错误（原样返回）
+func limitToolResult(text string, policy ToolResultPolicy, param string, issues *ConversionResult) string {
+	if policy.MaxBytes <= 0 || len(text) <= policy.MaxBytes {
+		return text
+	}
+	if policy.Mode == ToolResultReject {
+		issues.fail(IssueToolResultTooLarge, param, "tool result is %d bytes, exceeding the %d byte limit", len(text), policy.MaxBytes)
+		return text
+	}
+
+	truncated, structural := truncateJSONResult(text, policy.MaxBytes)
+	if !structural {
+		truncated = truncateMiddle(text, policy.MaxBytes, policy.HeadRatio)
+	}
+	how := "middle"
+	if structural {
+		how = "trailing array items"
+	}
+	issues.note(IssueToolResultTruncated, param, "tool result truncated from %d to %d bytes (%s removed)", len(text), len(truncated), how)
+	return truncated
+}
+
+// truncateMiddle 保留开头和结尾，中间替换为注明删除字节数的标记（不切断多字节字符）
+func truncateMiddle(text string, maxBytes int, headRatio float64) string {
+	if headRatio <= 0 || headRatio >= 1 {
+		headRatio = 0.5
+	}
+	// 标记长度按删除字节数的最大位数预留
+	marker := func(removed int) string {
+		return fmt.Sprintf("\n\n[... %d bytes truncated ...]\n\n", removed)
+	}
+	budget := maxBytes - len(marker(len(text)))
+	if budget < 0 {
+		budget = 0
+	}
+
+	head := int(float64(budget) * headRatio)
+	tail := budget - head
+	for head > 0 && !utf8.RuneStart(text[head]) {
+		head--
+	}
+	tailStart := len(text) - tail
+	for tailStart < len(text) && !utf8.RuneStart(text[tailStart]) {
+		tailStart++
+	}
+	return text[:head] + marker(tailStart-head) + text[tailStart:]
+}
+
+// jsonArrayRef 指向 JSON 结构中的一个数组
+type jsonArrayRef struct {
+	depth int
+	items []interface{}
+	set   func([]interface{})
+	kept  int // 当前保留的元素数
+}
+
+// truncateJSONResult 对 JSON 结果按结构截断：从最深层的数组开始丢弃末尾元素（以说明字符串占位），
+// 结果仍是合法 JSON。不是 JSON 或删除所有数组元素后仍超出上限时返回 false
+func truncateJSONResult(text string, maxBytes int) (string, bool) {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return "", false
+	}
+	// 保留数字原文，避免大整数丢失精度
+	var root interface{}
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.UseNumber()
+	if err := decoder.Decode(&root); err != nil || decoder.More() {
+		return "", false
+	}
+
+	var arrays []*jsonArrayRef
+	collectJSONArrays(root, 0, func(v []interface{}) { root = v }, &arrays)
+	if len(arrays) == 0 {
+		return "", false
+	}
+	// 最深的在前（同层按原顺序）
+	sort.SliceStable(arrays, func(i, j int) bool { return arrays[i].depth > arrays[j].depth })
+
+	// 逐层处理：同一层的数组一起减半，直到大小满足或该层清空后进入上一层
+	for start := 0; start < len(arrays); {
+		end := start
+		for end < len(arrays) && arrays[end].depth == arrays[start].depth {
+			end++
+		}
+		for {
+			data, err := json.Marshal(root)
+			if err != nil {
+				return "", false
+			}
+			if len(data) <= maxBytes {
+				return string(data), true
+			}
+			shrunk := false
+			for _, ref := range arrays[start:end] {
+				if ref.kept > 0 {
+					ref.kept /= 2
+					ref.apply()
+					shrunk = true
+				}
+			}
+			if !shrunk {
+				break
+			}
+		}
+		start = end
+	}
+	return "", false
+}
+
+// apply 保留前 kept 个元素，并以说明字符串代替被删除的元素
+func (r *jsonArrayRef) apply() {
+	items := append([]interface{}{}, r.items[:r.kept]...)
+	if removed := len(r.items) - r.kept; removed > 0 {
+		items = append(items, fmt.Sprintf("[... %d more items truncated]", removed))
+	}
+	r.set(items)
+}
+
+func collectJSONArrays(v interface{}, depth int, set func([]interface{}), arrays *[]*jsonArrayRef) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			key := key
+			collectJSONArrays(child, depth+1, func(items []interface{}) { node[key] = items }, arrays)
+		}
+	case []interface{}:
+		*arrays = append(*arrays, &jsonArrayRef{depth: depth, items: node, set: set, kept: len(node)})
+		for i, child := range node {
+			i := i
+			collectJSONArrays(child, depth+1, func(items []interface{}) { node[i] = items }, arrays)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+)
+
+// tool_choice 为 "none" 时的处理方式
+const (
+	ToolChoiceNoneOmit = "omit" // 不发送工具定义
+	ToolChoiceNoneMode = "mode" // 发送工具定义并设置 Mode NONE
+)
+
+// normalizeTools 根据 tools 和 tool_choice 生成 Tools 与 ToolConfig
+//   - tools 为空或 null：不发送 Tools 和 ToolConfig，忽略 tool_choice
+//   - tool_choice 为 "none"：按 TOOL_CHOICE_NONE 省略工具或设置 Mode NONE
+//   - "required" 映射为 ANY，指定函数时映射为 ANY + allowedFunctionNames
+func normalizeTools(req *OpenAIChatRequest) ([]Tool, *ToolConfig) {
+	if warning := toolChoiceWarning(req.Tools, req.ToolChoice); warning != "" {
+		logger.Warn("%s", warning)
+	}
+
+	converted := req.sanitizedTools(nil)
+	if len(converted) == 0 {
+		return nil, nil
+	}
+
+	mode, names, _ := parseToolChoice(req.ToolChoice)
+	if mode == "NONE" && config.Get().ToolChoiceNone != ToolChoiceNoneMode {
+		return nil, nil
+	}
+
+	return converted, &ToolConfig{
+		FunctionCallingConfig: &FunctionCallingConfig{
+			Mode:                 mode,
+			AllowedFunctionNames: names,
+		},
+	}
+}
+
+// toolChoiceWarning 检查 tool_choice 是否会被忽略，返回警告信息
+func toolChoiceWarning(tools []OpenAITool, toolChoice interface{}) string {
+	if toolChoice == nil {
+		return ""
+	}
+	if len(tools) == 0 {
+		return fmt.Sprintf("Ignoring tool_choice %v: request has no tools", toolChoice)
+	}
+	if _, _, ok := parseToolChoice(toolChoice); !ok {
+		return fmt.Sprintf("Unsupported tool_choice %v, using auto", toolChoice)
+	}
+	return ""
+}
+
+// RequestWarnings 返回转换请求时会被忽略或调整的参数
+func RequestWarnings(req *OpenAIChatRequest) []string {
+	var warnings []string
+	if warning := toolChoiceWarning(req.Tools, req.ToolChoice); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	for _, param := range req.Unsupported {
+		warnings = append(warnings, "unsupported parameter dropped: "+param)
+	}
+	return warnings
+}
+
+// parseToolChoice 解析 OpenAI tool_choice，返回 Gemini 函数调用模式，无法识别时使用 AUTO
+func parseToolChoice(toolChoice interface{}) (string, []string, bool) {
+	switch v := toolChoice.(type) {
+	case nil:
+		return "AUTO", nil, true
+	case string:
+		switch strings.ToLower(v) {
+		case "none":
+			return "NONE", nil, true
+		case "required", "any":
+			return "ANY", nil, true
+		case "auto", "":
+			return "AUTO", nil, true
+		}
+	case map[string]interface{}:
+		// {"type": "function", "function": {"name": "xxx"}}
+		if fn, ok := v["function"].(map[string]interface{}); ok {
+			if name, ok := fn["name"].(string); ok && name != "" {
+				return "ANY", []string{name}, true
+			}
+		}
+	}
+	return "AUTO", nil, false
+}
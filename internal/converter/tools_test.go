@@ -0,0 +1,146 @@
+package converter
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/testutil"
+)
+
+const weatherTool = `[{"type":"function","function":{"name":"weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}]`
+
+// convertChat 解码 OpenAI 请求 JSON 并转换
+func convertChat(t *testing.T, body string) (*OpenAIChatRequest, *AntigravityRequest) {
+	t.Helper()
+	req, err := DecodeOpenAIChatRequest(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := testutil.Account("tools")
+	return req, ConvertOpenAIToAntigravity(req, &account)
+}
+
+// chatBody 带 tools 和 tool_choice 字段（原样写入 JSON）的请求
+func chatBody(tools, toolChoice string) string {
+	body := `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]`
+	if tools != "" {
+		body += `,"tools":` + tools
+	}
+	if toolChoice != "" {
+		body += `,"tool_choice":` + toolChoice
+	}
+	return body + "}"
+}
+
+// useToolChoiceNone 在测试期间设置 TOOL_CHOICE_NONE
+func useToolChoiceNone(t *testing.T, mode string) {
+	t.Helper()
+	cfg := config.Get()
+	previous := cfg.ToolChoiceNone
+	cfg.ToolChoiceNone = mode
+	t.Cleanup(func() { cfg.ToolChoiceNone = previous })
+}
+
+func TestNoToolsSendsNoToolConfig(t *testing.T) {
+	for name, body := range map[string]string{
+		"empty":            chatBody(`[]`, ""),
+		"null":             chatBody(`null`, ""),
+		"empty with auto":  chatBody(`[]`, `"auto"`),
+		"null with auto":   chatBody(`null`, `"auto"`),
+		"null with named":  chatBody(`null`, `{"type":"function","function":{"name":"weather"}}`),
+		"missing required": chatBody("", `"required"`),
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, converted := convertChat(t, body)
+			if converted.Request.Tools != nil || converted.Request.ToolConfig != nil {
+				t.Fatalf("tools=%+v toolConfig=%+v, want neither", converted.Request.Tools, converted.Request.ToolConfig)
+			}
+			data, err := json.Marshal(converted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), "toolConfig") || strings.Contains(string(data), `"tools"`) {
+				t.Errorf("upstream body mentions tools: %s", data)
+			}
+
+			// tool_choice 被忽略时给出警告
+			warnings := RequestWarnings(req)
+			if ignored := req.ToolChoice != nil; ignored != (len(warnings) == 1 && strings.Contains(warnings[0], "no tools")) {
+				t.Errorf("warnings = %q", warnings)
+			}
+		})
+	}
+}
+
+func TestToolChoiceNone(t *testing.T) {
+	t.Run(ToolChoiceNoneOmit, func(t *testing.T) {
+		useToolChoiceNone(t, ToolChoiceNoneOmit)
+		_, converted := convertChat(t, chatBody(weatherTool, `"none"`))
+		if converted.Request.Tools != nil || converted.Request.ToolConfig != nil {
+			t.Errorf("tools=%+v toolConfig=%+v, want tools omitted", converted.Request.Tools, converted.Request.ToolConfig)
+		}
+	})
+
+	t.Run(ToolChoiceNoneMode, func(t *testing.T) {
+		useToolChoiceNone(t, ToolChoiceNoneMode)
+		_, converted := convertChat(t, chatBody(weatherTool, `"none"`))
+		if len(converted.Request.Tools) != 1 {
+			t.Fatalf("tools = %+v, want the weather tool", converted.Request.Tools)
+		}
+		if tc := converted.Request.ToolConfig; tc == nil || tc.FunctionCallingConfig.Mode != "NONE" {
+			t.Errorf("toolConfig = %+v, want mode NONE", tc)
+		}
+	})
+}
+
+func TestToolChoiceWithTools(t *testing.T) {
+	for _, tc := range []struct {
+		choice  string
+		mode    string
+		allowed []string
+	}{
+		{"", "AUTO", nil},
+		{`"auto"`, "AUTO", nil},
+		{`"required"`, "ANY", nil},
+		{`{"type":"function","function":{"name":"weather"}}`, "ANY", []string{"weather"}},
+		{`"sometimes"`, "AUTO", nil},
+	} {
+		t.Run(tc.choice, func(t *testing.T) {
+			_, converted := convertChat(t, chatBody(weatherTool, tc.choice))
+			if len(converted.Request.Tools) != 1 {
+				t.Fatalf("tools = %+v, want the weather tool", converted.Request.Tools)
+			}
+			cfg := converted.Request.ToolConfig
+			if cfg == nil || cfg.FunctionCallingConfig.Mode != tc.mode || !reflect.DeepEqual(cfg.FunctionCallingConfig.AllowedFunctionNames, tc.allowed) {
+				t.Errorf("toolConfig = %+v, want mode %s allowing %v", cfg, tc.mode, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestGeminiToolConfigWithoutTools(t *testing.T) {
+	account := testutil.Account("gemini-tools")
+	toolConfig := &ToolConfig{FunctionCallingConfig: &FunctionCallingConfig{Mode: "ANY"}}
+
+	req := ConvertGeminiToAntigravity("gemini-2.5-flash", &GeminiRequest{
+		Contents:   []Content{{Role: "user", Parts: []Part{{Text: "hi"}}}},
+		Tools:      []Tool{},
+		ToolConfig: toolConfig,
+	}, &account)
+	if req.Request.ToolConfig != nil {
+		t.Errorf("toolConfig = %+v sent without tools", req.Request.ToolConfig)
+	}
+
+	tools := []Tool{{FunctionDeclarations: []FunctionDeclaration{{Name: "weather"}}}}
+	req = ConvertGeminiToAntigravity("gemini-2.5-flash", &GeminiRequest{
+		Contents:   []Content{{Role: "user", Parts: []Part{{Text: "hi"}}}},
+		Tools:      tools,
+		ToolConfig: toolConfig,
+	}, &account)
+	if req.Request.ToolConfig != toolConfig {
+		t.Errorf("toolConfig = %+v, want the client's config kept", req.Request.ToolConfig)
+	}
+}
@@ -1,5 +1,13 @@
 package converter
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"anti2api-golang/internal/store"
+)
+
 // ==================== Antigravity 内部格式 ====================
 
 // AntigravityRequest Antigravity 内部请求格式
@@ -40,9 +48,9 @@ type Part struct {
 
 // FunctionCall 函数调用
 type FunctionCall struct {
-	ID   string                 `json:"id,omitempty"`
-	Name string                 `json:"name"`
-	Args map[string]interface{} `json:"args"`
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args"` // JSON 对象原文（不解码，避免重复编码）
 }
 
 // FunctionResponse 函数响应
@@ -95,6 +103,33 @@ type GenerationConfig struct {
 	TopP            *float64        `json:"topP,omitempty"`
 	TopK            int             `json:"topK,omitempty"`
 	ThinkingConfig  *ThinkingConfig `json:"thinkingConfig,omitempty"`
+
+	ResponseMimeType string                 `json:"responseMimeType,omitempty"` // application/json 时模型只输出 JSON
+	ResponseSchema   map[string]interface{} `json:"responseSchema,omitempty"`   // 输出需符合的 schema（OpenAPI 子集）
+
+	RawExtra map[string]json.RawMessage `json:"-"` // 请求扩展的字段，序列化时合并到顶层（覆盖同名字段，null 为删除）
+}
+
+// MarshalJSON 序列化后合并 RawExtra（值原样写入，不改变类型）
+func (c GenerationConfig) MarshalJSON() ([]byte, error) {
+	type plain GenerationConfig
+	data, err := json.Marshal(plain(c))
+	if err != nil || len(c.RawExtra) == 0 {
+		return data, err
+	}
+
+	merged := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range c.RawExtra {
+		if string(value) == "null" {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = value
+	}
+	return json.Marshal(merged)
 }
 
 // ThinkingConfig 思考配置
@@ -115,9 +150,10 @@ type AntigravityResponse struct {
 
 // Candidate 候选响应
 type Candidate struct {
-	Content      Content `json:"content"`
-	FinishReason string  `json:"finishReason,omitempty"`
-	Index        int     `json:"index"`
+	Content           Content            `json:"content"`
+	FinishReason      string             `json:"finishReason,omitempty"`
+	Index             int                `json:"index"`
+	GroundingMetadata *GroundingMetadata `json:"groundingMetadata,omitempty"`
 }
 
 // UsageMetadata 使用统计
@@ -137,10 +173,73 @@ type OpenAIChatRequest struct {
 	Stream      bool            `json:"stream"`
 	Temperature *float64        `json:"temperature,omitempty"`
 	TopP        *float64        `json:"top_p,omitempty"`
+	TopK        *int            `json:"top_k,omitempty"`
 	MaxTokens   int             `json:"max_tokens,omitempty"`
-	Stop        []string        `json:"stop,omitempty"`
+	Stop        StringOrSlice   `json:"stop,omitempty"`
 	Tools       []OpenAITool    `json:"tools,omitempty"`
 	ToolChoice  interface{}     `json:"tool_choice,omitempty"`
+	Store       bool            `json:"store,omitempty"` // 保存完成结果以便后续按 ID 获取
+
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"` // 结构化输出（json_object、json_schema）
+
+	ExtraGenerationConfig map[string]json.RawMessage `json:"extra_generation_config,omitempty"` // 合并到 generationConfig 的字段（受 EXTRA_GENERATION_CONFIG_ALLOW/DENY 限制）
+
+	MaxCompletionTokens int    `json:"max_completion_tokens,omitempty"` // 回答预算（优先于 max_tokens，不含思考）
+	ReasoningEffort     string `json:"reasoning_effort,omitempty"`      // none、minimal、low、medium、high
+	ThinkingBudget      *int   `json:"thinking_budget,omitempty"`       // 思考预算（优先于 reasoning_effort，0 关闭思考）
+
+	Unsupported []string `json:"-"` // 请求中无法处理、已丢弃的参数
+	Warnings    []string `json:"-"` // 需要在响应中返回的警告
+	Moderation  []string `json:"-"` // 内联审核命中的分类（标记模式下放行的请求，写入日志）
+
+	ToolResults ToolResultPolicy   `json:"-"` // tool 结果大小限制（由 API Key 对应的配置决定）
+	TokenBudget *TokenBudget       `json:"-"` // 回答与思考预算的计算过程（转换时填充）
+	Compression *PromptCompression `json:"-"` // 系统提示压缩结果（转换时填充）
+
+	toolsKey string // tools 原文的指纹（用于复用转换后的工具定义，为空时不缓存）
+}
+
+// OpenAIResponseFormat 结构化输出格式
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"` // text、json_object、json_schema
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+// OpenAIJSONSchema json_schema 格式的定义
+type OpenAIJSONSchema struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Schema      map[string]interface{} `json:"schema"`
+	Strict      *bool                  `json:"strict,omitempty"`
+}
+
+// StringOrSlice 接受单个字符串、字符串数组或 null 的字段（如 stop）
+type StringOrSlice []string
+
+// UnmarshalJSON 单个字符串解码为一个元素（空字符串为空），null 为 nil
+func (s *StringOrSlice) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = nil
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var single string
+		if err := json.Unmarshal(data, &single); err != nil {
+			return err
+		}
+		if single == "" {
+			*s = nil
+		} else {
+			*s = StringOrSlice{single}
+		}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
 }
 
 // OpenAIMessage OpenAI 消息格式
@@ -150,6 +249,9 @@ type OpenAIMessage struct {
 	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string           `json:"tool_call_id,omitempty"`
 	Name       string           `json:"name,omitempty"`
+	Reasoning  string           `json:"reasoning,omitempty"` // 历史中的思考内容（部分客户端会回传）
+
+	ReasoningContent string `json:"reasoning_content,omitempty"` // reasoning 的别名（deepseek 风格）
 }
 
 // OpenAIContentPart OpenAI 内容部分
@@ -173,23 +275,49 @@ type OpenAITool struct {
 
 // OpenAIFunction OpenAI 函数定义
 type OpenAIFunction struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  ToolParameters `json:"parameters,omitempty"`
+}
+
+// ToolParameters 函数参数的 JSON Schema。null 为 nil，以字符串形式传入的 Schema（部分客户端会这样发送）解析为对象
+type ToolParameters map[string]interface{}
+
+// UnmarshalJSON 接受对象、null 或内容为 JSON 对象的字符串
+func (p *ToolParameters) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		if strings.TrimSpace(text) == "" {
+			*p = nil
+			return nil
+		}
+		data = []byte(text)
+	}
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return fmt.Errorf("parameters must be a JSON Schema object: %w", err)
+	}
+	*p = schema
+	return nil
 }
 
 // OpenAIToolCall OpenAI 工具调用
 type OpenAIToolCall struct {
-	ID               string             `json:"id"`
-	Type             string             `json:"type"` // function
+	Index            *int               `json:"index,omitempty"` // 流式增量输出时的工具调用序号
+	ID               string             `json:"id,omitempty"`
+	Type             string             `json:"type,omitempty"` // function（增量片段中省略）
 	Function         OpenAIFunctionCall `json:"function"`
 	ThoughtSignature string             `json:"thought_signature,omitempty"` // 扩展字段：用于存储API需要的签名
 }
 
 // OpenAIFunctionCall OpenAI 函数调用
 type OpenAIFunctionCall struct {
-	Name      string `json:"name"`
-	Arguments string `json:"arguments"` // JSON 字符串
+	Name      string `json:"name,omitempty"` // 增量片段中省略
+	Arguments string `json:"arguments"`      // JSON 字符串
 }
 
 // OpenAIChatCompletion OpenAI 聊天完成响应
@@ -200,6 +328,17 @@ type OpenAIChatCompletion struct {
 	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
 	Usage   *Usage   `json:"usage,omitempty"`
+
+	// ValidationFailed 重试后仍未通过的响应校验器（扩展字段）
+	ValidationFailed []string `json:"validation_failed,omitempty"`
+	// Warnings 请求处理中的警告（扩展字段，如被丢弃的参数）
+	Warnings []string `json:"warnings,omitempty"`
+	// Quarantine 命中的工具调用隔离规则（扩展字段，rule:action）
+	Quarantine []string `json:"quarantine,omitempty"`
+	// Route 账号和端点的选择过程（扩展字段，X-Debug-Route: explain 时出现）
+	Route *store.RouteExplanation `json:"route,omitempty"`
+
+	PostProcessed int `json:"-"` // 生效的后处理规则数（仅用于日志）
 }
 
 // Choice 选择
@@ -212,18 +351,20 @@ type Choice struct {
 
 // Message 消息
 type Message struct {
-	Role      string           `json:"role"`
-	Content   string           `json:"content"`
-	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
-	Reasoning string           `json:"reasoning,omitempty"` // 思考内容
+	Role        string           `json:"role"`
+	Content     string           `json:"content"`
+	ToolCalls   []OpenAIToolCall `json:"tool_calls,omitempty"`
+	Reasoning   string           `json:"reasoning,omitempty"`   // 思考内容
+	Annotations []Annotation     `json:"annotations,omitempty"` // 联网搜索的引用
 }
 
 // Delta 流式增量
 type Delta struct {
-	Role      string           `json:"role,omitempty"`
-	Content   string           `json:"content,omitempty"`
-	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
-	Reasoning string           `json:"reasoning,omitempty"` // 思考内容
+	Role        string           `json:"role,omitempty"`
+	Content     string           `json:"content,omitempty"`
+	ToolCalls   []OpenAIToolCall `json:"tool_calls,omitempty"`
+	Reasoning   string           `json:"reasoning,omitempty"`   // 思考内容
+	Annotations []Annotation     `json:"annotations,omitempty"` // 联网搜索的引用（在正文输出完后单独发送）
 }
 
 // Usage 使用统计
@@ -241,6 +382,29 @@ type OpenAIStreamChunk struct {
 	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
 	Usage   *Usage   `json:"usage,omitempty"`
+
+	// ValidationFailed 未通过的响应校验器（仅出现在结束 chunk）
+	ValidationFailed []string `json:"validation_failed,omitempty"`
+	// Truncated 上游流在结束前中断，输出不完整（扩展字段，仅出现在结束 chunk）
+	Truncated bool `json:"truncated,omitempty"`
+	// ToolCallsIncomplete 流中断前已输出了工具调用，调用列表可能不完整（扩展字段，仅出现在结束 chunk）
+	ToolCallsIncomplete bool `json:"tool_calls_incomplete,omitempty"`
+	// Warnings 请求处理中的警告（仅出现在结束 chunk）
+	Warnings []string `json:"warnings,omitempty"`
+	// Annotations 联网搜索的引用（扩展字段，STREAM_ANNOTATIONS=final 时出现在结束 chunk）
+	Annotations []Annotation `json:"annotations,omitempty"`
+	// Quarantine 命中的工具调用隔离规则（仅出现在结束 chunk）
+	Quarantine []string `json:"quarantine,omitempty"`
+	// ContentDigest 已输出正文和思考内容的 SHA-256（扩展字段，仅出现在结束 chunk）
+	ContentDigest *ContentDigest `json:"content_digest,omitempty"`
+	// Route 账号和端点的选择过程（扩展字段，X-Debug-Route: explain 时出现在结束 chunk）
+	Route *store.RouteExplanation `json:"route,omitempty"`
+}
+
+// ContentDigest 输出内容摘要（格式为 sha256=十六进制），客户端可与拼接后的 delta 内容比对
+type ContentDigest struct {
+	Content   string `json:"content"`
+	Reasoning string `json:"reasoning,omitempty"` // 没有思考内容时省略
 }
 
 // ModelsResponse 模型列表响应
@@ -0,0 +1,60 @@
+package converter
+
+import "fmt"
+
+// usageMetadata 合并方式
+const (
+	UsageMergeReplace = "replace" // 使用最后一次（累计快照）
+	UsageMergeSum     = "sum"     // 各次相加（分阶段/分候选的部分计数）
+	UsageMergeMax     = "max"     // 各字段取最大值
+)
+
+// MergeUsage 按合并方式把 next 合并到 total
+func MergeUsage(mode string, total, next *UsageMetadata) *UsageMetadata {
+	if next == nil {
+		return total
+	}
+	if total == nil || mode == UsageMergeReplace || mode == "" {
+		merged := *next
+		return &merged
+	}
+
+	merged := *total
+	switch mode {
+	case UsageMergeSum:
+		merged.PromptTokenCount += next.PromptTokenCount
+		merged.CandidatesTokenCount += next.CandidatesTokenCount
+		merged.ThoughtsTokenCount += next.ThoughtsTokenCount
+		merged.TotalTokenCount += next.TotalTokenCount
+	case UsageMergeMax:
+		merged.PromptTokenCount = max(merged.PromptTokenCount, next.PromptTokenCount)
+		merged.CandidatesTokenCount = max(merged.CandidatesTokenCount, next.CandidatesTokenCount)
+		merged.ThoughtsTokenCount = max(merged.ThoughtsTokenCount, next.ThoughtsTokenCount)
+		merged.TotalTokenCount = max(merged.TotalTokenCount, next.TotalTokenCount)
+	}
+	return &merged
+}
+
+// 用量与估算的偏差阈值（估算较粗，只标记数量级上的不一致）
+const (
+	usageInconsistencyRatio = 5
+	usageInconsistencySlack = 1000
+)
+
+// CheckUsage 检查上游报告的输入 Token 是否与估算值严重不符，返回警告信息
+func CheckUsage(estimate int, usage *UsageMetadata) string {
+	if usage == nil || estimate <= 0 {
+		return ""
+	}
+
+	prompt := usage.PromptTokenCount
+	switch {
+	case prompt > estimate*usageInconsistencyRatio+usageInconsistencySlack:
+		return fmt.Sprintf("reported prompt tokens %d far exceed estimate %d", prompt, estimate)
+	case prompt*usageInconsistencyRatio+usageInconsistencySlack < estimate:
+		return fmt.Sprintf("reported prompt tokens %d far below estimate %d", prompt, estimate)
+	case usage.TotalTokenCount > 0 && usage.TotalTokenCount < prompt:
+		return fmt.Sprintf("reported total tokens %d below prompt tokens %d", usage.TotalTokenCount, prompt)
+	}
+	return ""
+}
@@ -0,0 +1,241 @@
+package corpus
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+)
+
+// queueSize 待写入样本队列长度，队列满时丢弃新样本
+const queueSize = 1024
+
+// manifestFile 样本清单文件名
+const manifestFile = "manifest.jsonl"
+
+// Sample 一条请求/响应样本（OpenAI 格式，已脱敏）
+type Sample struct {
+	ID        string      `json:"id"`
+	Timestamp time.Time   `json:"timestamp"`
+	Model     string      `json:"model"`
+	Request   interface{} `json:"request"`
+	Response  interface{} `json:"response"`
+
+	PromptTokens     int   `json:"-"`
+	CompletionTokens int   `json:"-"`
+	LatencyMs        int64 `json:"-"`
+}
+
+// manifestEntry 清单记录
+type manifestEntry struct {
+	ID               string    `json:"id"`
+	File             string    `json:"file"`
+	Model            string    `json:"model"`
+	Timestamp        time.Time `json:"timestamp"`
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	LatencyMs        int64     `json:"latencyMs"`
+}
+
+// Stats 录制状态
+type Stats struct {
+	Enabled     bool   `json:"enabled"`   // 已配置 CORPUS_DIR
+	Recording   bool   `json:"recording"` // 正在录制
+	Dir         string `json:"dir,omitempty"`
+	SamplePct   int    `json:"samplePercent"`
+	Samples     int64  `json:"samples"` // 本次启动后写入的样本数
+	Dropped     int64  `json:"dropped"` // 队列满丢弃的样本数
+	CurrentFile string `json:"currentFile,omitempty"`
+	FileBytes   int64  `json:"fileBytes"` // 当前文件大小
+}
+
+// Recorder 语料录制器：请求路径只做非阻塞入队，写文件在后台协程完成
+type Recorder struct {
+	dir       string
+	samplePct int
+	maxBytes  int64
+	queue     chan *Sample
+	recording atomic.Bool
+	samples   atomic.Int64
+	dropped   atomic.Int64
+
+	mu        sync.Mutex // 保护当前文件
+	file      *os.File
+	fileName  string
+	fileBytes int64
+}
+
+var (
+	recorder     *Recorder
+	recorderOnce sync.Once
+)
+
+// Get 获取录制器单例（配置了 CORPUS_DIR 时启动即开始录制）
+func Get() *Recorder {
+	recorderOnce.Do(func() {
+		cfg := config.Get()
+		recorder = &Recorder{
+			dir:       cfg.CorpusDir,
+			samplePct: cfg.CorpusSamplePercent,
+			maxBytes:  int64(cfg.CorpusMaxFileMB) * 1024 * 1024,
+			queue:     make(chan *Sample, queueSize),
+		}
+		if recorder.dir != "" {
+			recorder.recording.Store(true)
+			monitor.Go("corpus", recorder.writeLoop)
+		}
+	})
+	return recorder
+}
+
+// Enabled 是否配置了语料目录
+func (r *Recorder) Enabled() bool {
+	return r.dir != ""
+}
+
+// Start 开始录制
+func (r *Recorder) Start() error {
+	if !r.Enabled() {
+		return fmt.Errorf("corpus recording is not configured (set CORPUS_DIR)")
+	}
+	r.recording.Store(true)
+	return nil
+}
+
+// Stop 停止录制（已入队的样本仍会写入）
+func (r *Recorder) Stop() {
+	r.recording.Store(false)
+}
+
+// ShouldSample 是否录制本次请求（按采样比例）
+func (r *Recorder) ShouldSample() bool {
+	if !r.Enabled() || !r.recording.Load() || r.samplePct <= 0 {
+		return false
+	}
+	return r.samplePct >= 100 || rand.Intn(100) < r.samplePct
+}
+
+// Record 非阻塞入队，队列满时丢弃并计数
+func (r *Recorder) Record(sample *Sample) {
+	select {
+	case r.queue <- sample:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Stats 获取录制状态
+func (r *Recorder) Stats() Stats {
+	r.mu.Lock()
+	fileName, fileBytes := r.fileName, r.fileBytes
+	r.mu.Unlock()
+
+	return Stats{
+		Enabled:     r.Enabled(),
+		Recording:   r.recording.Load(),
+		Dir:         r.dir,
+		SamplePct:   r.samplePct,
+		Samples:     r.samples.Load(),
+		Dropped:     r.dropped.Load(),
+		CurrentFile: fileName,
+		FileBytes:   fileBytes,
+	}
+}
+
+func (r *Recorder) writeLoop() {
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		logger.Error("Failed to create corpus dir %s: %v", r.dir, err)
+		return
+	}
+	for sample := range r.queue {
+		if err := r.write(sample); err != nil {
+			logger.Warn("Failed to write corpus sample: %v", err)
+		}
+	}
+}
+
+// write 写入样本并追加清单，当前文件超过大小上限时轮转
+func (r *Recorder) write(sample *Sample) error {
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil || (r.maxBytes > 0 && r.fileBytes+int64(len(line)) > r.maxBytes && r.fileBytes > 0) {
+		if err := r.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	n, err := r.file.Write(line)
+	r.fileBytes += int64(n)
+	if err != nil {
+		return err
+	}
+	r.samples.Add(1)
+
+	entry, _ := json.Marshal(manifestEntry{
+		ID:               sample.ID,
+		File:             r.fileName,
+		Model:            sample.Model,
+		Timestamp:        sample.Timestamp,
+		PromptTokens:     sample.PromptTokens,
+		CompletionTokens: sample.CompletionTokens,
+		LatencyMs:        sample.LatencyMs,
+	})
+	manifest, err := os.OpenFile(filepath.Join(r.dir, manifestFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+	_, err = manifest.Write(append(entry, '\n'))
+	return err
+}
+
+func (r *Recorder) rotateLocked() error {
+	if r.file != nil {
+		r.file.Close()
+	}
+	name := "corpus-" + time.Now().Format("20060102-150405.000") + ".jsonl"
+	file, err := os.OpenFile(filepath.Join(r.dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		r.file = nil
+		return err
+	}
+	r.file = file
+	r.fileName = name
+	r.fileBytes = 0
+	return nil
+}
+
+// redactPatterns 录制前替换的敏感内容（API Key、Bearer Token、邮箱）
+var redactPatterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{16,}`), "[REDACTED_KEY]"},
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`), "[REDACTED_KEY]"},
+	{regexp.MustCompile(`\bya29\.[0-9A-Za-z_\-]+`), "[REDACTED_TOKEN]"},
+	{regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._\-]{16,}`), "Bearer [REDACTED_TOKEN]"},
+	{regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[REDACTED_EMAIL]"},
+}
+
+// Redact 替换文本中的敏感内容
+func Redact(text string) string {
+	for _, p := range redactPatterns {
+		text = p.re.ReplaceAllString(text, p.replacement)
+	}
+	return text
+}
@@ -0,0 +1,91 @@
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"anti2api-golang/internal/config"
+)
+
+// 支持的语言
+const (
+	LocaleEn = "en"
+	LocaleZh = "zh"
+)
+
+// catalogs 各语言的消息目录（英文目录包含全部消息，其他语言缺少的消息回退到默认语言）
+var catalogs = map[string]map[string]string{
+	LocaleEn: messagesEn,
+	LocaleZh: messagesZh,
+}
+
+// Supported 是否为支持的语言
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// normalize 取语言标签的主语言部分（zh-CN、zh_Hans 均为 zh）
+func normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+// Default 默认语言（DEFAULT_LOCALE，不支持时为英文）
+func Default() string {
+	if locale := normalize(config.Get().DefaultLocale); Supported(locale) {
+		return locale
+	}
+	return LocaleEn
+}
+
+// Negotiate 按 Accept-Language 选择权重最高的支持语言（权重相同时按出现顺序），没有支持的语言时使用默认语言
+func Negotiate(acceptLanguage string) string {
+	type candidate struct {
+		locale string
+		q      float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		locale := normalize(tag)
+		if !Supported(locale) {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{locale, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return Default()
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].locale
+}
+
+// T 按语言格式化消息：当前语言缺少的消息回退到默认语言，再回退到英文，都没有时返回 key
+func T(locale, key string, args ...interface{}) string {
+	format, ok := catalogs[locale][key]
+	if !ok {
+		if format, ok = catalogs[Default()][key]; !ok {
+			if format, ok = messagesEn[key]; !ok {
+				format = key
+			}
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
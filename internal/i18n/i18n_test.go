@@ -0,0 +1,125 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+
+	"anti2api-golang/internal/config"
+)
+
+// useDefaultLocale 在测试期间设置 DEFAULT_LOCALE
+func useDefaultLocale(t *testing.T, locale string) {
+	t.Helper()
+	cfg := config.Get()
+	previous := cfg.DefaultLocale
+	cfg.DefaultLocale = locale
+	t.Cleanup(func() { cfg.DefaultLocale = previous })
+}
+
+// useMessage 在测试期间向消息目录添加一条消息
+func useMessage(t *testing.T, locale, key, format string) {
+	t.Helper()
+	catalogs[locale][key] = format
+	t.Cleanup(func() { delete(catalogs[locale], key) })
+}
+
+func TestNegotiate(t *testing.T) {
+	useDefaultLocale(t, "en")
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", LocaleEn},
+		{"zh", LocaleZh},
+		{"zh-CN,zh;q=0.9,en;q=0.8", LocaleZh},
+		{"ZH_hans", LocaleZh},
+		{"en-US,en;q=0.9", LocaleEn},
+		{"fr-FR, zh;q=0.5", LocaleZh},
+		{"en;q=0.3, zh;q=0.7", LocaleZh},
+		// 权重相同时按出现顺序
+		{"zh;q=0.5, en;q=0.5", LocaleZh},
+		{"de, fr", LocaleEn},
+		{"zh;q=0", LocaleEn},
+		{"zh;q=abc", LocaleZh},
+		{"*", LocaleEn},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.header); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+
+	// 没有支持的语言时使用 DEFAULT_LOCALE
+	useDefaultLocale(t, "zh-CN")
+	if got := Negotiate("de"); got != LocaleZh {
+		t.Errorf("Negotiate(de) with DEFAULT_LOCALE=zh-CN = %q", got)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	for locale, want := range map[string]string{"zh": LocaleZh, " zh_TW ": LocaleZh, "en-GB": LocaleEn, "ja": LocaleEn, "": LocaleEn} {
+		useDefaultLocale(t, locale)
+		if got := Default(); got != want {
+			t.Errorf("Default() with DEFAULT_LOCALE=%q = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestTFallback(t *testing.T) {
+	useDefaultLocale(t, "en")
+	if got := T(LocaleZh, "request.not_found"); got != "未找到" {
+		t.Errorf("zh = %q", got)
+	}
+	if got := T(LocaleEn, "auth.role_required", "admin", "viewer"); got != "This action requires the admin role (current role: viewer)" {
+		t.Errorf("formatted = %q", got)
+	}
+
+	// 未翻译的消息回退到默认语言，再回退到英文，都没有时返回 key
+	useMessage(t, LocaleEn, "test.only_en", "English only %d")
+	if got := T(LocaleZh, "test.only_en", 3); got != "English only 3" {
+		t.Errorf("fallback to en = %q", got)
+	}
+	useMessage(t, LocaleZh, "test.only_zh", "仅中文")
+	if got := T(LocaleEn, "test.only_zh"); got != "test.only_zh" {
+		t.Errorf("missing in en with default en = %q", got)
+	}
+	useDefaultLocale(t, "zh")
+	if got := T(LocaleEn, "test.only_zh"); got != "仅中文" {
+		t.Errorf("fallback to default zh = %q", got)
+	}
+	if got := T("fr", "request.not_found"); got != "未找到" {
+		t.Errorf("unsupported locale = %q", got)
+	}
+	if got := T(LocaleEn, "test.missing"); got != "test.missing" {
+		t.Errorf("missing key = %q", got)
+	}
+}
+
+// formatVerbs 消息中的格式化占位符（按顺序）
+var formatVerbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestCatalogsComplete(t *testing.T) {
+	for key, en := range messagesEn {
+		zh, ok := messagesZh[key]
+		if !ok {
+			t.Errorf("%s: missing zh translation", key)
+			continue
+		}
+		// 占位符数量和顺序一致，否则按语言格式化时参数错位
+		if a, b := formatVerbs.FindAllString(en, -1), formatVerbs.FindAllString(zh, -1); len(a) != len(b) {
+			t.Errorf("%s: placeholders differ: en %q, zh %q", key, a, b)
+		} else {
+			for i := range a {
+				if a[i] != b[i] {
+					t.Errorf("%s: placeholder %d differs: en %q, zh %q", key, i, a[i], b[i])
+				}
+			}
+		}
+	}
+	// 英文目录包含全部消息
+	for key := range messagesZh {
+		if _, ok := messagesEn[key]; !ok {
+			t.Errorf("%s: missing en message", key)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package i18n
+
+// messagesEn 英文消息目录（完整目录，其他语言缺少的消息最终回退到这里）
+var messagesEn = map[string]string{
+	// 通用请求错误
+	"request.invalid":            "Invalid request",
+	"request.invalid_body":       "Invalid request: %v",
+	"request.invalid_date":       "date must be YYYY-MM-DD",
+	"request.invalid_date_range": "from/to must be YYYY-MM-DD",
+	"request.date_range_order":   "from must not be after to",
+	"request.invalid_limit":      "Invalid limit",
+	"request.invalid_offset":     "Invalid offset",
+	"request.invalid_page_size":  "Invalid pageSize",
+	"request.invalid_path":       "Invalid path format",
+	"request.unknown_action":     "Unknown action: %s",
+	"request.not_found":          "Not found",
+	"request.rate_limited":       "Too many requests",
+	"server.internal_error":      "Internal server error",
+
+	// 认证
+	"auth.invalid_api_key":      "Invalid API Key",
+	"auth.invalid_credentials":  "Invalid credentials",
+	"auth.invalid_status_token": "Invalid status token",
+	"auth.role_required":        "This action requires the %s role (current role: %s)",
+	"auth.unauthorized":         "Unauthorized",
+	"auth.super_admin_required": "Forbidden: this action requires a super administrator",
+
+	// 账号与透传
+	"accounts.unavailable":        "No account is available to serve this request",
+	"accounts.off_schedule":       "No account is available: all accounts are outside their schedules",
+	"accounts.off_schedule_until": "No account is available: all accounts are outside their schedules, the earliest becomes available at %s",
+	"accounts.invalid_index":      "Invalid index",
+	"accounts.import_empty":       "Invalid TOML: no [[accounts]] entries",
+	"accounts.token_required":     "refresh_token or access_token is required",
+	"accounts.invalid_credential": "Credential validation failed: %v",
+	"accounts.exists":             "An account with this email or refresh token already exists (set overwrite to replace it)",
+	"passthrough.empty_token":     "Empty %s header",
+	"passthrough.disabled":        "Passthrough mode is disabled",
+	"credentials.not_found":       "Credential not found: %s",
+
+	// 端点
+	"endpoints.unknown":             "Unknown endpoint: %s",
+	"endpoints.switched":            "Endpoint switched to %s",
+	"endpoints.mode_switched":       "Mode switched to %s",
+	"endpoints.mode.round_robin":    "Round robin (all)",
+	"endpoints.mode.round_robin_dp": "Round robin (D+P)",
+	"endpoints.mode.weighted":       "Weighted",
+	"endpoints.round_robin_host":    "Round robin across endpoints",
+	"endpoints.weighted_host":       "Weighted across endpoints",
+	"endpoints.auto_resumed":        "Automatic endpoint failover resumed",
+	"endpoints.auto_suspended":      "Automatic endpoint failover suspended",
+
+	// 参数检查
+	"params.invalid_mode_header": "Invalid %s header: expected drop, error or warn",
+	"params.unsupported":         "Unsupported parameters: %s",
+	"params.content_flagged":     "Request flagged by content policy: %s",
+
+	// 模型
+	"models.not_found":        "Model not found: %s",
+	"models.config_not_found": "Model config not found",
+	"models.probe_disabled":   "Capability probing is disabled (set CAPABILITY_PROBE_ACCOUNT)",
+	"models.probe_running":    "A capability probe is already running",
+
+	// 批处理与文件
+	"batch.invalid_form":            "Invalid multipart form: %v",
+	"batch.read_failed":             "Failed to read file: %v",
+	"batch.purpose_unsupported":     "only purpose 'batch' is supported",
+	"batch.missing_file":            "missing file",
+	"batch.file_not_found":          "No such File object: %s",
+	"batch.endpoint_unsupported":    "only %s is supported",
+	"batch.input_file_not_found":    "no such file: %s",
+	"batch.input_file_purpose":      "file purpose must be 'batch'",
+	"batch.not_found":               "No such Batch object: %s",
+	"completions.not_found":         "No chat completion found with id '%s'",
+	"moderation.invalid_input":      "input must be a string or an array",
+	"quarantine.approval_not_found": "Pending approval not found",
+	"runtime.request_not_found":     "Active request not found",
+
+	// 延迟请求
+	"deferred.invalid_header":     "%s must be a positive number of seconds",
+	"deferred.stream_unsupported": "%s is only supported for non-streaming requests",
+	"deferred.invalid_callback":   "%s must be an http(s) URL",
+	"deferred.encode_failed":      "Failed to encode request: %v",
+	"deferred.not_found":          "No such deferred request: %s",
+
+	// API Key 阈值
+	"key_limits.exceeded":    "API key %s budget exceeded: %d > %d",
+	"key_limits.not_found":   "Key limits not found",
+	"key_limits.save_failed": "Failed to save key limits: %v",
+
+	// 管理接口
+	"logs.missing_id":             "Missing log ID",
+	"logs.not_found":              "Log not found",
+	"logs.invalid_status":         "status must be an HTTP status code",
+	"logs.invalid_success":        "success must be true or false",
+	"logs.invalid_time":           "%s must be an RFC 3339 time",
+	"logs.search_too_long":        "search must be at most %d bytes",
+	"logs.invalid_regex_flag":     "regex must be true or false",
+	"logs.invalid_search_pattern": "Invalid search pattern: %v",
+	"errors.invalid_window":       "window must be between 1 and %d minutes",
+	"jobs.not_found":              "Job not found",
+	"notify.no_webhooks":          "WEBHOOK_URLS is not configured",
+	"logger.invalid_level":        "Invalid log level: %s",
+	"logger.unknown_component":    "Unknown component: %s (available: %s)",
+	"chaos.disabled":              "Fault injection is disabled (set CHAOS_ENABLED=true)",
+	"chaos.rule_not_found":        "Rule not found",
+	"affinity.key_too_short":      "key must be at least %d characters",
+	"affinity.binding_not_found":  "Binding not found",
+	"backup.failed":               "Backup failed: %v",
+	"backup.restore_failed":       "Restore failed: %v",
+	"status.encode_failed":        "Failed to encode status",
+	"selftest.unknown_stage":      "Unknown self-test stage: %s",
+	"selftest.invalid_timeout":    "timeoutSeconds must be between 0 and %d",
+
+	// 设置修改（PUT /admin/settings）
+	"settings.invalid":       "Settings were not applied: validation failed",
+	"settings.invalid_value": "Invalid value: %v",
+	"settings.not_runtime":   "This setting cannot be changed at runtime; set it in .env and restart",
+	"settings.apply_failed":  "Failed to apply settings: %v",
+
+	// 设置页标签
+	"settings.group.panel":                "Panel",
+	"settings.group.network":              "Network",
+	"settings.group.api":                  "API",
+	"settings.group.tracing":              "Tracing",
+	"settings.group.affinity":             "Conversation affinity",
+	"settings.unset":                      "Not set",
+	"settings.unset_disabled":             "Not set (disabled)",
+	"settings.PANEL_USER":                 "Panel username",
+	"settings.PANEL_PASSWORD":             "Panel password",
+	"settings.PORT":                       "Port",
+	"settings.HOST":                       "Listen address",
+	"settings.PROXY":                      "Proxy",
+	"settings.TIMEOUT":                    "Request timeout (ms)",
+	"settings.SERVER_READ_HEADER_TIMEOUT": "Header read timeout (s)",
+	"settings.SERVER_READ_TIMEOUT":        "Request read timeout (s)",
+	"settings.SERVER_WRITE_TIMEOUT":       "Response write timeout (s)",
+	"settings.SERVER_IDLE_TIMEOUT":        "Idle connection timeout (s)",
+	"settings.STREAM_WRITE_TIMEOUT":       "Stream write timeout (s)",
+	"settings.API_KEY":                    "API key",
+	"settings.ENDPOINT_MODE":              "Endpoint mode",
+	"settings.ENDPOINT_FALLBACK":          "Fallback endpoint (error budget)",
+	"settings.DEBUG":                      "Debug level",
+	"settings.OTLP_ENDPOINT":              "OTLP endpoint",
+	"settings.TRACE_SAMPLE_PERCENT":       "Sample rate (%)",
+	"settings.TRACE_PROPAGATE":            "Propagate traceparent upstream",
+	"settings.CONVERSATION_AFFINITY":      "Keep conversations on one account",
+	"settings.AFFINITY_MAX_ENTRIES":       "Max bindings",
+	"settings.AFFINITY_TTL_MINUTES":       "Binding TTL (minutes)",
+	"settings.AFFINITY_PERSIST":           "Restore bindings after restart",
+}
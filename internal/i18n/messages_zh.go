@@ -0,0 +1,151 @@
+package i18n
+
+// messagesZh 中文消息目录
+var messagesZh = map[string]string{
+	// 通用请求错误
+	"request.invalid":            "无效的请求",
+	"request.invalid_body":       "无效的请求: %v",
+	"request.invalid_date":       "date 格式应为 YYYY-MM-DD",
+	"request.invalid_date_range": "from/to 格式应为 YYYY-MM-DD",
+	"request.date_range_order":   "from 不能晚于 to",
+	"request.invalid_limit":      "无效的 limit",
+	"request.invalid_offset":     "无效的 offset",
+	"request.invalid_page_size":  "无效的 pageSize",
+	"request.invalid_path":       "无效的路径格式",
+	"request.unknown_action":     "未知的操作: %s",
+	"request.not_found":          "未找到",
+	"request.rate_limited":       "请求过于频繁",
+	"server.internal_error":      "服务器内部错误",
+
+	// 认证
+	"auth.invalid_api_key":      "无效的 API Key",
+	"auth.invalid_credentials":  "用户名或密码错误",
+	"auth.invalid_status_token": "无效的状态页令牌",
+	"auth.role_required":        "此操作需要 %s 角色（当前角色: %s）",
+	"auth.unauthorized":         "未登录或登录已过期",
+	"auth.super_admin_required": "禁止访问：此操作需要超级管理员",
+
+	// 账号与透传
+	"accounts.unavailable":        "没有可用的账号处理此请求",
+	"accounts.off_schedule":       "没有可用的账号：所有账号都不在可用时间段内",
+	"accounts.off_schedule_until": "没有可用的账号：所有账号都不在可用时间段内，最早 %s 可用",
+	"accounts.invalid_index":      "无效的账号序号",
+	"accounts.import_empty":       "无效的 TOML：没有 [[accounts]] 条目",
+	"accounts.token_required":     "需要 refresh_token 或 access_token",
+	"accounts.invalid_credential": "凭证校验失败: %v",
+	"accounts.exists":             "已存在相同邮箱或 refresh_token 的账号（设置 overwrite 覆盖）",
+	"passthrough.empty_token":     "%s 请求头为空",
+	"passthrough.disabled":        "透传模式未启用",
+	"credentials.not_found":       "未找到凭证: %s",
+
+	// 端点
+	"endpoints.unknown":             "未知的端点: %s",
+	"endpoints.switched":            "端点已切换至 %s",
+	"endpoints.mode_switched":       "模式已切换至 %s",
+	"endpoints.mode.round_robin":    "轮询(全部)",
+	"endpoints.mode.round_robin_dp": "轮询(D+P)",
+	"endpoints.mode.weighted":       "按权重分流",
+	"endpoints.round_robin_host":    "多端点轮询",
+	"endpoints.weighted_host":       "多端点按权重分流",
+	"endpoints.auto_resumed":        "已恢复端点自动切换",
+	"endpoints.auto_suspended":      "已暂停端点自动切换",
+
+	// 参数检查
+	"params.invalid_mode_header": "无效的 %s 请求头：应为 drop、error 或 warn",
+	"params.unsupported":         "不支持的参数: %s",
+	"params.content_flagged":     "请求被内容策略拦截: %s",
+
+	// 模型
+	"models.not_found":        "未找到模型: %s",
+	"models.config_not_found": "未找到模型配置",
+	"models.probe_disabled":   "未启用能力探测（需设置 CAPABILITY_PROBE_ACCOUNT）",
+	"models.probe_running":    "能力探测正在进行",
+
+	// 批处理与文件
+	"batch.invalid_form":            "无效的 multipart 表单: %v",
+	"batch.read_failed":             "读取文件失败: %v",
+	"batch.purpose_unsupported":     "只支持 purpose 为 'batch'",
+	"batch.missing_file":            "缺少 file",
+	"batch.file_not_found":          "未找到文件: %s",
+	"batch.endpoint_unsupported":    "只支持 %s",
+	"batch.input_file_not_found":    "未找到文件: %s",
+	"batch.input_file_purpose":      "文件的 purpose 必须为 'batch'",
+	"batch.not_found":               "未找到批处理: %s",
+	"completions.not_found":         "未找到 id 为 '%s' 的对话补全",
+	"moderation.invalid_input":      "input 必须是字符串或数组",
+	"quarantine.approval_not_found": "未找到待审批的工具调用",
+	"runtime.request_not_found":     "未找到进行中的请求",
+
+	// 延迟请求
+	"deferred.invalid_header":     "%s 必须是正整数秒",
+	"deferred.stream_unsupported": "%s 只支持非流式请求",
+	"deferred.invalid_callback":   "%s 必须是 http(s) 地址",
+	"deferred.encode_failed":      "请求编码失败: %v",
+	"deferred.not_found":          "未找到延迟请求: %s",
+
+	// API Key 阈值
+	"key_limits.exceeded":    "API Key 超出 %s 预算: %d > %d",
+	"key_limits.not_found":   "未找到阈值配置",
+	"key_limits.save_failed": "保存阈值配置失败: %v",
+
+	// 管理接口
+	"logs.missing_id":             "缺少日志 ID",
+	"logs.not_found":              "未找到日志",
+	"logs.invalid_status":         "status 必须是 HTTP 状态码",
+	"logs.invalid_success":        "success 必须为 true 或 false",
+	"logs.invalid_time":           "%s 必须是 RFC 3339 时间",
+	"logs.search_too_long":        "search 不能超过 %d 字节",
+	"logs.invalid_regex_flag":     "regex 必须为 true 或 false",
+	"logs.invalid_search_pattern": "搜索正则无效：%v",
+	"errors.invalid_window":       "window 必须在 1 到 %d 分钟之间",
+	"jobs.not_found":              "未找到任务",
+	"notify.no_webhooks":          "未配置 WEBHOOK_URLS",
+	"logger.invalid_level":        "无效的日志级别: %s",
+	"logger.unknown_component":    "未知的组件: %s（可选: %s）",
+	"chaos.disabled":              "故障注入未启用（CHAOS_ENABLED=true）",
+	"chaos.rule_not_found":        "未找到规则",
+	"affinity.key_too_short":      "key 至少需要 %d 个字符",
+	"affinity.binding_not_found":  "未找到会话绑定",
+	"backup.failed":               "备份失败: %v",
+	"backup.restore_failed":       "恢复失败: %v",
+	"status.encode_failed":        "状态编码失败",
+	"selftest.unknown_stage":      "未知的自检阶段: %s",
+	"selftest.invalid_timeout":    "timeoutSeconds 必须在 0 到 %d 之间",
+
+	// 设置修改（PUT /admin/settings）
+	"settings.invalid":       "设置未应用：校验失败",
+	"settings.invalid_value": "无效的值: %v",
+	"settings.not_runtime":   "该设置不能在运行时修改，请在 .env 中设置后重启",
+	"settings.apply_failed":  "应用设置失败: %v",
+
+	// 设置页标签
+	"settings.group.panel":                "面板配置",
+	"settings.group.network":              "网络配置",
+	"settings.group.api":                  "API 配置",
+	"settings.group.tracing":              "链路追踪",
+	"settings.group.affinity":             "会话绑定",
+	"settings.unset":                      "未设置",
+	"settings.unset_disabled":             "未设置（关闭）",
+	"settings.PANEL_USER":                 "面板用户名",
+	"settings.PANEL_PASSWORD":             "面板密码",
+	"settings.PORT":                       "服务端口",
+	"settings.HOST":                       "监听地址",
+	"settings.PROXY":                      "代理地址",
+	"settings.TIMEOUT":                    "请求超时(ms)",
+	"settings.SERVER_READ_HEADER_TIMEOUT": "请求头读取超时(秒)",
+	"settings.SERVER_READ_TIMEOUT":        "请求读取超时(秒)",
+	"settings.SERVER_WRITE_TIMEOUT":       "响应写入超时(秒)",
+	"settings.SERVER_IDLE_TIMEOUT":        "空闲连接超时(秒)",
+	"settings.STREAM_WRITE_TIMEOUT":       "流式单次写入超时(秒)",
+	"settings.API_KEY":                    "API密钥",
+	"settings.ENDPOINT_MODE":              "端点模式",
+	"settings.ENDPOINT_FALLBACK":          "备用端点（错误预算）",
+	"settings.DEBUG":                      "调试级别",
+	"settings.OTLP_ENDPOINT":              "OTLP 地址",
+	"settings.TRACE_SAMPLE_PERCENT":       "采样比例(%)",
+	"settings.TRACE_PROPAGATE":            "向上游传播 traceparent",
+	"settings.CONVERSATION_AFFINITY":      "会话保持账号",
+	"settings.AFFINITY_MAX_ENTRIES":       "最大绑定数",
+	"settings.AFFINITY_TTL_MINUTES":       "绑定有效期(分钟)",
+	"settings.AFFINITY_PERSIST":           "重启后恢复绑定",
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"anti2api-golang/internal/config"
@@ -31,28 +33,106 @@ const (
 	ColorPurple = "\x1b[35m"
 )
 
-var currentLogLevel LogLevel
+// 日志组件（可单独设置级别）
+const (
+	ComponentAPI       = "api"       // 后端 API 请求/响应
+	ComponentConverter = "converter" // 格式转换
+	ComponentStore     = "store"     // 账号与日志存储
+	ComponentHandlers  = "handlers"  // 客户端请求/响应
+)
+
+// Components 所有可单独设置级别的组件
+var Components = []string{ComponentAPI, ComponentConverter, ComponentStore, ComponentHandlers}
+
+var (
+	// currentLogLevel 全局日志级别（运行时可修改）
+	currentLogLevel atomic.Int32
+	// componentLevels 组件级别覆盖 map[string]LogLevel（整体替换）
+	componentLevels atomic.Value
+)
 
 // Init 初始化日志系统
 func Init() {
 	cfg := config.Get()
-	currentLogLevel = parseLogLevel(cfg.Debug)
+	currentLogLevel.Store(int32(ParseLevel(cfg.Debug)))
+	componentLevels.Store(map[string]LogLevel{})
 }
 
-func parseLogLevel(debug string) LogLevel {
+// ParseLevel 解析日志级别（兼容 off/low/high 与 off/basic/verbose）
+func ParseLevel(debug string) LogLevel {
 	switch strings.ToLower(debug) {
-	case "low":
+	case "low", "basic":
 		return LogLow
-	case "high":
+	case "high", "verbose":
 		return LogHigh
 	default:
 		return LogOff
 	}
 }
 
+// ValidLevel 检查级别名称是否有效
+func ValidLevel(debug string) bool {
+	switch strings.ToLower(debug) {
+	case "off", "low", "basic", "high", "verbose":
+		return true
+	}
+	return false
+}
+
+// String 级别名称
+func (l LogLevel) String() string {
+	switch l {
+	case LogLow:
+		return "basic"
+	case LogHigh:
+		return "verbose"
+	default:
+		return "off"
+	}
+}
+
 // GetLevel 获取当前日志级别
 func GetLevel() LogLevel {
-	return currentLogLevel
+	return LogLevel(currentLogLevel.Load())
+}
+
+// SetLevel 设置全局日志级别
+func SetLevel(level LogLevel) {
+	currentLogLevel.Store(int32(level))
+}
+
+// GetComponentLevels 获取组件级别覆盖
+func GetComponentLevels() map[string]LogLevel {
+	levels, _ := componentLevels.Load().(map[string]LogLevel)
+	result := make(map[string]LogLevel, len(levels))
+	for k, v := range levels {
+		result[k] = v
+	}
+	return result
+}
+
+// SetComponentLevels 替换组件级别覆盖
+func SetComponentLevels(levels map[string]LogLevel) {
+	copied := make(map[string]LogLevel, len(levels))
+	for k, v := range levels {
+		copied[k] = v
+	}
+	componentLevels.Store(copied)
+}
+
+// levelFor 获取组件的生效级别（组件覆盖优先于全局级别）
+func levelFor(component string) LogLevel {
+	if levels, ok := componentLevels.Load().(map[string]LogLevel); ok {
+		if level, ok := levels[component]; ok {
+			return level
+		}
+	}
+	return GetLevel()
+}
+
+// Enabled 检查组件在指定级别是否输出日志
+func Enabled(component string, level LogLevel) bool {
+	return levelFor(component) >= level
 }
 
 // Info 信息日志
@@ -78,7 +158,7 @@ func Error(format string, args ...interface{}) {
 
 // Debug 调试日志
 func Debug(format string, args ...interface{}) {
-	if currentLogLevel < LogLow {
+	if GetLevel() < LogLow {
 		return
 	}
 	timestamp := time.Now().Format("15:04:05")
@@ -86,6 +166,16 @@ func Debug(format string, args ...interface{}) {
 	fmt.Printf("%s%s%s %s[debug]%s %s\n", ColorGray, timestamp, ColorReset, ColorBlue, ColorReset, msg)
 }
 
+// DebugIn 组件调试日志（受组件级别控制）
+func DebugIn(component, format string, args ...interface{}) {
+	if !Enabled(component, LogLow) {
+		return
+	}
+	timestamp := time.Now().Format("15:04:05")
+	msg := fmt.Sprintf(format, args...)
+	fmt.Printf("%s%s%s %s[debug:%s]%s %s\n", ColorGray, timestamp, ColorReset, ColorBlue, component, ColorReset, msg)
+}
+
 // Request 请求日志
 func Request(method, path string, status int, duration time.Duration) {
 	statusColor := ColorGreen
@@ -104,7 +194,7 @@ func Request(method, path string, status int, duration time.Duration) {
 
 // ClientRequest 客户端请求日志
 func ClientRequest(method, path string, body interface{}) {
-	if currentLogLevel < LogLow {
+	if !Enabled(ComponentHandlers, LogLow) {
 		return
 	}
 
@@ -118,7 +208,7 @@ func ClientRequest(method, path string, body interface{}) {
 
 // ClientResponse 客户端响应日志
 func ClientResponse(status int, duration time.Duration, body interface{}) {
-	if currentLogLevel < LogLow {
+	if !Enabled(ComponentHandlers, LogLow) {
 		return
 	}
 
@@ -137,7 +227,7 @@ func ClientResponse(status int, duration time.Duration, body interface{}) {
 
 // BackendRequest 后端请求日志
 func BackendRequest(method, url string, body interface{}) {
-	if currentLogLevel < LogHigh {
+	if !Enabled(ComponentAPI, LogHigh) {
 		return
 	}
 
@@ -151,7 +241,7 @@ func BackendRequest(method, url string, body interface{}) {
 
 // BackendResponse 后端响应日志
 func BackendResponse(status int, duration time.Duration, body interface{}) {
-	if currentLogLevel < LogHigh {
+	if !Enabled(ComponentAPI, LogHigh) {
 		return
 	}
 
@@ -193,7 +283,7 @@ func Banner(port int, endpointMode string) {
 
 	Info("Server starting on port %d", port)
 	Info("Endpoint mode: %s", endpointMode)
-	Info("Debug level: %s", config.Get().Debug)
+	Info("Debug level: %s", GetLevel())
 
 	if os.Getenv("API_KEY") == "" {
 		Warn("API_KEY not set - API authentication disabled")
@@ -201,3 +291,81 @@ func Banner(port int, endpointMode string) {
 
 	fmt.Println()
 }
+
+var (
+	revertMu    sync.Mutex
+	revertTimer *time.Timer
+	revertAt    time.Time
+)
+
+// ApplyDebug 运行时修改日志级别：components 为空时修改全局级别，否则只修改指定组件
+// 设置为 verbose 时在 ttl 后自动恢复（全局恢复为启动级别，组件覆盖被移除）
+func ApplyDebug(level LogLevel, components []string, ttl time.Duration) {
+	if len(components) == 0 {
+		SetLevel(level)
+	} else {
+		levels := GetComponentLevels()
+		for _, c := range components {
+			levels[c] = level
+		}
+		SetComponentLevels(levels)
+	}
+
+	revertMu.Lock()
+	defer revertMu.Unlock()
+
+	if level < LogHigh || ttl <= 0 {
+		return
+	}
+	if revertTimer != nil {
+		revertTimer.Stop()
+	}
+	revertAt = time.Now().Add(ttl)
+	revertTimer = time.AfterFunc(ttl, revertVerbose)
+}
+
+// revertVerbose 撤销 verbose 级别
+func revertVerbose() {
+	startLevel := ParseLevel(config.Get().Debug)
+	if startLevel >= LogHigh {
+		startLevel = LogLow
+	}
+	if GetLevel() >= LogHigh {
+		SetLevel(startLevel)
+	}
+
+	levels := GetComponentLevels()
+	for c, l := range levels {
+		if l >= LogHigh {
+			delete(levels, c)
+		}
+	}
+	SetComponentLevels(levels)
+
+	revertMu.Lock()
+	revertAt = time.Time{}
+	revertMu.Unlock()
+
+	Info("Verbose logging reverted automatically (level: %s)", GetLevel())
+}
+
+// DebugState 当前日志级别状态（用于面板展示）
+func DebugState() map[string]interface{} {
+	components := make(map[string]string)
+	for c, l := range GetComponentLevels() {
+		components[c] = l.String()
+	}
+
+	state := map[string]interface{}{
+		"level":      GetLevel().String(),
+		"components": components,
+	}
+
+	revertMu.Lock()
+	if !revertAt.IsZero() {
+		state["revertAt"] = revertAt.Format(time.RFC3339)
+	}
+	revertMu.Unlock()
+
+	return state
+}
@@ -0,0 +1,258 @@
+package moderation
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+)
+
+// 内联审核模式
+const (
+	InlineOff    = "off"    // 不审核对话请求
+	InlineReject = "reject" // 拒绝命中的请求
+	InlineTag    = "tag"    // 放行但标记
+)
+
+// reloadInterval 检查规则文件变更的最小间隔
+const reloadInterval = 5 * time.Second
+
+// RuleFile 规则文件格式（data/moderation.json）
+type RuleFile struct {
+	Inline     string                  `json:"inline"`
+	Categories map[string]CategoryRule `json:"categories"`
+}
+
+// CategoryRule 单个分类的规则
+type CategoryRule struct {
+	Keywords []string `json:"keywords,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// compiledCategory 编译后的分类规则
+type compiledCategory struct {
+	name     string
+	keywords []string
+	patterns []*regexp.Regexp
+}
+
+// Result 单条输入的审核结果（OpenAI moderations 格式）
+type Result struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// FlaggedCategories 返回命中的分类名（已排序）
+func (r *Result) FlaggedCategories() []string {
+	var cats []string
+	for name, hit := range r.Categories {
+		if hit {
+			cats = append(cats, name)
+		}
+	}
+	sort.Strings(cats)
+	return cats
+}
+
+// Engine 本地规则审核引擎（规则文件变更后自动重新加载）
+type Engine struct {
+	mu         sync.RWMutex
+	filePath   string
+	modTime    time.Time
+	lastCheck  time.Time
+	inline     string
+	categories []compiledCategory
+
+	statsMu sync.Mutex
+	checks  int
+	flagged int
+	byCat   map[string]int
+}
+
+var (
+	engine     *Engine
+	engineOnce sync.Once
+)
+
+// Get 获取审核引擎单例
+func Get() *Engine {
+	engineOnce.Do(func() {
+		engine = &Engine{
+			filePath: filepath.Join(config.Get().DataDir, "moderation.json"),
+			inline:   InlineOff,
+			byCat:    make(map[string]int),
+		}
+		engine.reloadIfChanged()
+	})
+	return engine
+}
+
+// reloadIfChanged 规则文件修改时间变化时重新加载
+func (e *Engine) reloadIfChanged() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.lastCheck.IsZero() && time.Since(e.lastCheck) < reloadInterval {
+		return
+	}
+	e.lastCheck = time.Now()
+
+	info, err := os.Stat(e.filePath)
+	if err != nil {
+		if !e.modTime.IsZero() {
+			// 规则文件被删除，清空规则
+			e.modTime = time.Time{}
+			e.inline = InlineOff
+			e.categories = nil
+		}
+		return
+	}
+	if info.ModTime().Equal(e.modTime) {
+		return
+	}
+
+	data, err := os.ReadFile(e.filePath)
+	if err != nil {
+		return
+	}
+
+	var file RuleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		logger.Warn("Invalid moderation rules %s: %v", e.filePath, err)
+		return
+	}
+
+	categories := make([]compiledCategory, 0, len(file.Categories))
+	for name, rule := range file.Categories {
+		cat := compiledCategory{name: name}
+		for _, kw := range rule.Keywords {
+			if kw = strings.TrimSpace(kw); kw != "" {
+				cat.keywords = append(cat.keywords, strings.ToLower(kw))
+			}
+		}
+		for _, p := range rule.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				logger.Warn("Invalid moderation pattern in %s: %v", name, err)
+				continue
+			}
+			cat.patterns = append(cat.patterns, re)
+		}
+		categories = append(categories, cat)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].name < categories[j].name })
+
+	switch file.Inline {
+	case InlineReject, InlineTag:
+		e.inline = file.Inline
+	default:
+		e.inline = InlineOff
+	}
+	e.categories = categories
+	e.modTime = info.ModTime()
+
+	logger.Info("Loaded %d moderation categories (inline: %s)", len(categories), e.inline)
+}
+
+// InlineMode 获取当前内联审核模式
+func (e *Engine) InlineMode() string {
+	e.reloadIfChanged()
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.inline
+}
+
+// Check 审核单条文本
+func (e *Engine) Check(text string) Result {
+	e.reloadIfChanged()
+
+	e.mu.RLock()
+	categories := e.categories
+	e.mu.RUnlock()
+
+	result := Result{
+		Categories:     make(map[string]bool, len(categories)),
+		CategoryScores: make(map[string]float64, len(categories)),
+	}
+
+	lower := strings.ToLower(text)
+	for _, cat := range categories {
+		hit := false
+		for _, kw := range cat.keywords {
+			if strings.Contains(lower, kw) {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			for _, re := range cat.patterns {
+				if re.MatchString(text) {
+					hit = true
+					break
+				}
+			}
+		}
+
+		result.Categories[cat.name] = hit
+		if hit {
+			result.CategoryScores[cat.name] = 1
+			result.Flagged = true
+		} else {
+			result.CategoryScores[cat.name] = 0
+		}
+	}
+
+	e.record(&result)
+	return result
+}
+
+// record 更新审核统计
+func (e *Engine) record(result *Result) {
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+
+	e.checks++
+	if !result.Flagged {
+		return
+	}
+	e.flagged++
+	for _, name := range result.FlaggedCategories() {
+		e.byCat[name]++
+	}
+}
+
+// Stats 获取审核统计
+func (e *Engine) Stats() map[string]interface{} {
+	e.statsMu.Lock()
+	byCat := make(map[string]int, len(e.byCat))
+	for k, v := range e.byCat {
+		byCat[k] = v
+	}
+	checks, flagged := e.checks, e.flagged
+	e.statsMu.Unlock()
+
+	e.mu.RLock()
+	categories := make([]string, 0, len(e.categories))
+	for _, c := range e.categories {
+		categories = append(categories, c.name)
+	}
+	inline := e.inline
+	e.mu.RUnlock()
+
+	return map[string]interface{}{
+		"inline":     inline,
+		"categories": categories,
+		"checks":     checks,
+		"flagged":    flagged,
+		"byCategory": byCat,
+	}
+}
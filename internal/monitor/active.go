@@ -0,0 +1,161 @@
+package monitor
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"anti2api-golang/internal/config"
+)
+
+// 进行中请求的类型
+const (
+	KindRequest = "request" // 非流式上游请求
+	KindStream  = "stream"  // 流式输出（含 bypass）
+)
+
+// activeEntry 进行中的请求
+type activeEntry struct {
+	id        string
+	kind      string
+	model     string
+	account   string
+	startedAt time.Time
+	cancel    context.CancelFunc
+	cancelled bool // 已被看门狗或管理员取消
+}
+
+// ActiveRequest 进行中请求的视图
+type ActiveRequest struct {
+	ID             string    `json:"id"`
+	Kind           string    `json:"kind"`
+	Model          string    `json:"model"`
+	Account        string    `json:"account"`
+	StartedAt      time.Time `json:"startedAt"`
+	ElapsedSeconds int64     `json:"elapsedSeconds"`
+	Overdue        bool      `json:"overdue"`   // 流式输出超过 STREAM_MAX_DURATION
+	Cancelled      bool      `json:"cancelled"` // 已取消，等待处理函数退出
+}
+
+var (
+	activeMu  sync.Mutex
+	active    = make(map[string]*activeEntry)
+	activeSeq atomic.Int64
+)
+
+// activeContextKey 已登记请求的 context key（避免 bypass 等嵌套调用重复登记）
+type activeContextKey struct{}
+
+// Track 登记进行中的请求，返回可被强制取消的 context 和结束时调用的 done；ctx 已登记时不重复登记
+func Track(ctx context.Context, kind, model, account string) (context.Context, func()) {
+	if ctx.Value(activeContextKey{}) != nil {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	entry := &activeEntry{
+		id:        kind + "-" + strconv.FormatInt(activeSeq.Add(1), 10),
+		kind:      kind,
+		model:     model,
+		account:   account,
+		startedAt: time.Now(),
+		cancel:    cancel,
+	}
+
+	ctx = context.WithValue(ctx, activeContextKey{}, entry.id)
+
+	activeMu.Lock()
+	active[entry.id] = entry
+	activeMu.Unlock()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			activeMu.Lock()
+			delete(active, entry.id)
+			activeMu.Unlock()
+			cancel()
+		})
+	}
+}
+
+// maxStreamDuration 流式输出的最长时间（0 为不限制）
+func maxStreamDuration() time.Duration {
+	return time.Duration(config.Get().StreamMaxDuration) * time.Minute
+}
+
+func (e *activeEntry) overdue(now time.Time, limit time.Duration) bool {
+	return e.kind == KindStream && limit > 0 && now.Sub(e.startedAt) > limit
+}
+
+// Active 进行中的请求（最早开始的在前）
+func Active() []ActiveRequest {
+	now := time.Now()
+	limit := maxStreamDuration()
+
+	activeMu.Lock()
+	list := make([]ActiveRequest, 0, len(active))
+	for _, e := range active {
+		list = append(list, ActiveRequest{
+			ID:             e.id,
+			Kind:           e.kind,
+			Model:          e.model,
+			Account:        e.account,
+			StartedAt:      e.startedAt,
+			ElapsedSeconds: int64(now.Sub(e.startedAt).Seconds()),
+			Overdue:        e.overdue(now, limit),
+			Cancelled:      e.cancelled,
+		})
+	}
+	activeMu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.Before(list[j].StartedAt) })
+	return list
+}
+
+// Cancel 强制取消进行中的请求
+func Cancel(id string) bool {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	e, ok := active[id]
+	if !ok {
+		return false
+	}
+	e.cancelled = true
+	e.cancel()
+	return true
+}
+
+// activeCounts 进行中的请求数、流式输出数、按账号统计的占用数
+func activeCounts() (requests, streams int, byAccount map[string]int) {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	byAccount = make(map[string]int)
+	for _, e := range active {
+		requests++
+		if e.kind == KindStream {
+			streams++
+		}
+		if e.account != "" {
+			byAccount[e.account]++
+		}
+	}
+	return requests, streams, byAccount
+}
+
+// cancelOverdue 取消超时的流式输出，返回本次取消的数量
+func cancelOverdue(now time.Time, limit time.Duration) int {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	n := 0
+	for _, e := range active {
+		if !e.cancelled && e.overdue(now, limit) {
+			e.cancelled = true
+			e.cancel()
+			n++
+		}
+	}
+	return n
+}
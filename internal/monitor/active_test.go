@@ -0,0 +1,194 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/config"
+)
+
+// useStreamLimit 在测试期间设置流式输出最长时间（分钟）和看门狗是否取消
+func useStreamLimit(t *testing.T, minutes int, cancel bool) {
+	t.Helper()
+	cfg := config.Get()
+	saved := *cfg
+	cfg.StreamMaxDuration = minutes
+	cfg.StreamWatchdogCancel = cancel
+	t.Cleanup(func() { *cfg = saved })
+}
+
+// activeByID 按 ID 查找进行中的请求
+func activeByID(id string) (ActiveRequest, bool) {
+	for _, a := range Active() {
+		if a.ID == id {
+			return a, true
+		}
+	}
+	return ActiveRequest{}, false
+}
+
+// trackedID Track 返回的 context 中登记的 ID
+func trackedID(ctx context.Context) string {
+	id, _ := ctx.Value(activeContextKey{}).(string)
+	return id
+}
+
+// backdate 把请求的开始时间提前 d（模拟长时间运行）
+func backdate(id string, d time.Duration) {
+	activeMu.Lock()
+	active[id].startedAt = active[id].startedAt.Add(-d)
+	activeMu.Unlock()
+}
+
+func TestTrackRegistersUntilDone(t *testing.T) {
+	ctx, done := Track(context.Background(), KindStream, "gemini-2.5-flash", "acc-1")
+	id := trackedID(ctx)
+	a, ok := activeByID(id)
+	if !ok {
+		t.Fatal("tracked request not listed")
+	}
+	if a.Kind != KindStream || a.Model != "gemini-2.5-flash" || a.Account != "acc-1" || a.Overdue || a.Cancelled {
+		t.Fatalf("active = %+v", a)
+	}
+
+	// 嵌套调用（bypass）不重复登记
+	nested, nestedDone := Track(ctx, KindRequest, "gemini-2.5-flash", "acc-1")
+	nestedDone()
+	if trackedID(nested) != id {
+		t.Fatal("nested Track registered a second request")
+	}
+	if _, ok := activeByID(id); !ok {
+		t.Fatal("nested done removed the outer request")
+	}
+
+	done()
+	done() // 重复调用无副作用
+	if _, ok := activeByID(id); ok {
+		t.Fatal("request still listed after done")
+	}
+	if ctx.Err() == nil {
+		t.Fatal("context not cancelled after done")
+	}
+}
+
+func TestCancelActive(t *testing.T) {
+	ctx, done := Track(context.Background(), KindRequest, "m", "acc-cancel")
+	defer done()
+	id := trackedID(ctx)
+
+	if Cancel("request-unknown") {
+		t.Fatal("Cancel of an unknown id reported success")
+	}
+	if !Cancel(id) {
+		t.Fatal("Cancel failed")
+	}
+	if ctx.Err() == nil {
+		t.Fatal("context not cancelled")
+	}
+	// 处理函数退出前仍然列出，标记为已取消
+	if a, ok := activeByID(id); !ok || !a.Cancelled {
+		t.Fatalf("active after cancel = %+v %v", a, ok)
+	}
+}
+
+func TestOverdueOnlyForStreams(t *testing.T) {
+	useStreamLimit(t, 1, false)
+	streamCtx, streamDone := Track(context.Background(), KindStream, "m", "acc-overdue")
+	defer streamDone()
+	requestCtx, requestDone := Track(context.Background(), KindRequest, "m", "acc-overdue")
+	defer requestDone()
+	stream, request := trackedID(streamCtx), trackedID(requestCtx)
+
+	if a, _ := activeByID(stream); a.Overdue {
+		t.Fatal("fresh stream marked overdue")
+	}
+	backdate(stream, 2*time.Minute)
+	backdate(request, 2*time.Minute)
+	if a, _ := activeByID(stream); !a.Overdue || a.ElapsedSeconds < 120 {
+		t.Fatalf("stream = %+v", a)
+	}
+	if a, _ := activeByID(request); a.Overdue {
+		t.Fatal("non-stream request marked overdue")
+	}
+
+	// 0 为不限制
+	useStreamLimit(t, 0, false)
+	if a, _ := activeByID(stream); a.Overdue {
+		t.Fatal("stream overdue without a limit")
+	}
+}
+
+func TestCancelOverdue(t *testing.T) {
+	ctx, done := Track(context.Background(), KindStream, "m", "acc-watchdog")
+	defer done()
+	fresh, freshDone := Track(context.Background(), KindStream, "m", "acc-watchdog")
+	defer freshDone()
+	backdate(trackedID(ctx), 2*time.Minute)
+
+	if n := cancelOverdue(time.Now(), time.Minute); n != 1 {
+		t.Fatalf("cancelled %d streams, want 1", n)
+	}
+	if ctx.Err() == nil || fresh.Err() != nil {
+		t.Fatalf("overdue err = %v, fresh err = %v", ctx.Err(), fresh.Err())
+	}
+	// 已取消的不重复计数
+	if n := cancelOverdue(time.Now(), time.Minute); n != 0 {
+		t.Fatalf("cancelled %d streams again", n)
+	}
+}
+
+func TestCountConn(t *testing.T) {
+	before := UpstreamConns()
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := CountConn(client)
+	if n := UpstreamConns(); n != before+1 {
+		t.Fatalf("UpstreamConns = %d, want %d", n, before+1)
+	}
+	conn.Close()
+	conn.Close() // 重复关闭只计一次
+	if n := UpstreamConns(); n != before {
+		t.Fatalf("UpstreamConns after close = %d, want %d", n, before)
+	}
+}
+
+func TestGoroutinesByStage(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	for i := 0; i < 3; i++ {
+		Go("stage-test", func() {
+			started <- struct{}{}
+			<-release
+		})
+	}
+	for i := 0; i < 3; i++ {
+		<-started
+	}
+
+	stages := GoroutinesByStage()
+	if stages["stage-test"] != 3 {
+		t.Fatalf("stages = %v", stages)
+	}
+	if stages[unlabeledStage] == 0 {
+		t.Fatalf("unlabeled goroutines not counted: %v", stages)
+	}
+
+	// Do 中启动的协程继承阶段标签
+	Do(context.Background(), "stage-inherit", func(context.Context) {
+		go func() {
+			started <- struct{}{}
+			<-release
+		}()
+	})
+	<-started
+	if n := GoroutinesByStage()["stage-inherit"]; n != 1 {
+		t.Fatalf("inherited stage count = %d", n)
+	}
+
+	close(release)
+	waitStageGone(t, "stage-test")
+	waitStageGone(t, "stage-inherit")
+}
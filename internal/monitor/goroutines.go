@@ -0,0 +1,100 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"regexp"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// StageLabel 标记协程所属处理阶段的 pprof 标签
+const StageLabel = "stage"
+
+// unlabeledStage 没有阶段标签的协程（运行时、标准库内部协程等）
+const unlabeledStage = "unlabeled"
+
+// Go 启动带阶段标签的协程（用于按阶段统计协程数，定位泄漏）
+func Go(stage string, fn func()) {
+	go pprof.Do(context.Background(), pprof.Labels(StageLabel, stage), func(context.Context) {
+		fn()
+	})
+}
+
+// Do 以阶段标签执行 fn（fn 中启动的协程继承标签），返回后恢复原标签
+func Do(ctx context.Context, stage string, fn func(ctx context.Context)) {
+	pprof.Do(ctx, pprof.Labels(StageLabel, stage), fn)
+}
+
+var stageLabelPattern = regexp.MustCompile(`"` + StageLabel + `":"([^"]*)"`)
+
+// GoroutinesByStage 按阶段标签统计协程数
+func GoroutinesByStage() map[string]int {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return nil
+	}
+
+	// debug=1 格式：每组相同调用栈以 "<数量> @ <地址>..." 开始，带标签时紧跟 "# labels: {...}"
+	counts := make(map[string]int)
+	pending, pendingStage := 0, ""
+	flush := func() {
+		if pending > 0 {
+			if pendingStage == "" {
+				pendingStage = unlabeledStage
+			}
+			counts[pendingStage] += pending
+		}
+		pending, pendingStage = 0, ""
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if n, _, ok := strings.Cut(line, " @ "); ok {
+			if count, err := strconv.Atoi(n); err == nil {
+				flush()
+				pending = count
+				continue
+			}
+		}
+		if strings.HasPrefix(line, "# labels:") {
+			if m := stageLabelPattern.FindStringSubmatch(line); m != nil {
+				pendingStage = m[1]
+			}
+		}
+	}
+	flush()
+	return counts
+}
+
+// upstreamConns 当前打开的上游连接数
+var upstreamConns atomic.Int64
+
+// UpstreamConns 当前打开的上游连接数
+func UpstreamConns() int64 {
+	return upstreamConns.Load()
+}
+
+// countedConn 关闭时减少上游连接计数
+type countedConn struct {
+	net.Conn
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { upstreamConns.Add(-1) })
+	return c.Conn.Close()
+}
+
+// CountConn 包装上游连接，计入打开的连接数
+func CountConn(conn net.Conn) net.Conn {
+	upstreamConns.Add(1)
+	return &countedConn{Conn: conn}
+}
@@ -0,0 +1,49 @@
+package monitor
+
+import (
+	"context"
+	"sync"
+)
+
+// Loop 可停止的后台任务：Start 以阶段标签启动（已在运行时忽略），Stop 取消 ctx 并等待任务返回
+type Loop struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Start 启动 fn，fn 应在 ctx 取消后尽快返回；已在运行时返回 false
+func (l *Loop) Start(stage string, fn func(ctx context.Context)) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cancel != nil {
+		return false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	l.cancel, l.done = cancel, done
+	Go(stage, func() {
+		defer close(done)
+		fn(ctx)
+	})
+	return true
+}
+
+// Stop 取消任务并等待其返回，ctx 结束时不再等待并返回 ctx.Err()；未启动时直接返回。停止后可以再次 Start
+func (l *Loop) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	cancel, done := l.cancel, l.done
+	l.cancel, l.done = nil, nil
+	l.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
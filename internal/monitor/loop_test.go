@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitStageGone 等待阶段标签下的协程全部退出（fn 返回后协程还需要片刻才结束）
+func waitStageGone(t *testing.T, stage string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for GoroutinesByStage()[stage] > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines still labelled %q", GoroutinesByStage()[stage], stage)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLoopStopWaitsForTask(t *testing.T) {
+	var l Loop
+	started, release := make(chan struct{}), make(chan struct{})
+	var finished atomic.Bool
+	l.Start("loop-wait", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		<-release // 模拟取消后仍在收尾的工作
+		finished.Store(true)
+	})
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- l.Stop(context.Background()) }()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop returned %v before the task finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	if !finished.Load() {
+		t.Error("Stop returned before the task returned")
+	}
+	waitStageGone(t, "loop-wait")
+}
+
+func TestLoopStopTimeout(t *testing.T) {
+	var l Loop
+	release := make(chan struct{})
+	defer close(release)
+	l.Start("loop-stuck", func(ctx context.Context) {
+		<-release // 忽略取消
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := l.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Stop waited %v past its deadline", elapsed)
+	}
+}
+
+func TestLoopStartIsIdempotentAndRestartable(t *testing.T) {
+	var l Loop
+	var runs atomic.Int32
+	task := func(ctx context.Context) {
+		runs.Add(1)
+		<-ctx.Done()
+	}
+
+	if !l.Start("loop-restart", task) {
+		t.Fatal("first Start should start the task")
+	}
+	if l.Start("loop-restart", task) {
+		t.Error("Start while running should be ignored")
+	}
+	if err := l.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !l.Start("loop-restart", task) {
+		t.Fatal("Start after Stop should start the task again")
+	}
+	if err := l.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := runs.Load(); n != 2 {
+		t.Errorf("task ran %d times, want 2", n)
+	}
+	waitStageGone(t, "loop-restart")
+}
+
+func TestLoopStopWithoutStart(t *testing.T) {
+	var l Loop
+	if err := l.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 已经停止的任务再次停止也直接返回
+	l.Start("loop-twice", func(ctx context.Context) { <-ctx.Done() })
+	for i := 0; i < 2; i++ {
+		if err := l.Stop(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package monitor
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+)
+
+// sampleHistoryMax 保留的采样数（默认间隔 30 秒时约 2 小时）
+const sampleHistoryMax = 240
+
+// Sample 一次运行时采样
+type Sample struct {
+	Time           time.Time      `json:"time"`
+	Goroutines     int            `json:"goroutines"`
+	UpstreamConns  int64          `json:"upstreamConns"`
+	ActiveRequests int            `json:"activeRequests"`
+	ActiveStreams  int            `json:"activeStreams"`
+	AccountHolds   map[string]int `json:"accountHolds,omitempty"` // 账号 ID → 进行中的请求数
+	OverdueStreams int            `json:"overdueStreams"`
+	Suspect        bool           `json:"suspect,omitempty"` // 空闲时协程数明显高于基线，疑似泄漏
+}
+
+var sampler struct {
+	mu       sync.Mutex
+	history  []Sample
+	baseline int // 没有进行中请求时的最低协程数
+}
+
+var samplerLoop Loop
+
+// Start 启动定期采样和流式输出看门狗（MONITOR_SAMPLE_INTERVAL 为 0 时不启动）
+func Start() {
+	interval := time.Duration(config.Get().MonitorSampleInterval) * time.Second
+	if interval <= 0 {
+		return
+	}
+	samplerLoop.Start("monitor", func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				record(Collect())
+			}
+		}
+	})
+}
+
+// Stop 停止定期采样并等待进行中的采样结束
+func Stop(ctx context.Context) error {
+	return samplerLoop.Stop(ctx)
+}
+
+// Collect 采集当前的运行时指标，并按配置取消超时的流式输出
+func Collect() Sample {
+	cfg := config.Get()
+	now := time.Now()
+	limit := maxStreamDuration()
+
+	if cfg.StreamWatchdogCancel && limit > 0 {
+		if n := cancelOverdue(now, limit); n > 0 {
+			logger.Warn("Stream watchdog cancelled %d stream(s) running longer than %s", n, limit)
+		}
+	}
+
+	requests, streams, holds := activeCounts()
+	s := Sample{
+		Time:           now,
+		Goroutines:     runtime.NumGoroutine(),
+		UpstreamConns:  UpstreamConns(),
+		ActiveRequests: requests,
+		ActiveStreams:  streams,
+		AccountHolds:   holds,
+	}
+	for _, a := range Active() {
+		if a.Overdue {
+			s.OverdueStreams++
+		}
+	}
+	return s
+}
+
+// record 保存采样，并在空闲时比较协程数与基线判断是否疑似泄漏
+func record(s Sample) {
+	threshold := config.Get().MonitorLeakThreshold
+
+	sampler.mu.Lock()
+	if s.ActiveRequests == 0 {
+		if sampler.baseline == 0 || s.Goroutines < sampler.baseline {
+			sampler.baseline = s.Goroutines
+		}
+		s.Suspect = threshold > 0 && s.Goroutines-sampler.baseline > threshold
+	}
+	sampler.history = append(sampler.history, s)
+	if len(sampler.history) > sampleHistoryMax {
+		sampler.history = sampler.history[len(sampler.history)-sampleHistoryMax:]
+	}
+	baseline := sampler.baseline
+	sampler.mu.Unlock()
+
+	if s.Suspect {
+		logger.Warn("Possible goroutine leak: %d goroutines while idle (baseline %d, threshold %d)",
+			s.Goroutines, baseline, threshold)
+	}
+	if s.OverdueStreams > 0 && !config.Get().StreamWatchdogCancel {
+		logger.Warn("%d stream(s) running longer than %s", s.OverdueStreams, maxStreamDuration())
+	}
+}
+
+// History 采样历史（最早的在前）
+func History() []Sample {
+	sampler.mu.Lock()
+	defer sampler.mu.Unlock()
+	return append([]Sample(nil), sampler.history...)
+}
+
+// Baseline 空闲时的最低协程数（尚未采样到空闲状态时为 0）
+func Baseline() int {
+	sampler.mu.Lock()
+	defer sampler.mu.Unlock()
+	return sampler.baseline
+}
@@ -0,0 +1,139 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/config"
+)
+
+// resetSampler 清空采样历史和基线
+func resetSampler(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		sampler.mu.Lock()
+		sampler.history, sampler.baseline = nil, 0
+		sampler.mu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestRecordBaselineAndSuspect(t *testing.T) {
+	resetSampler(t)
+	cfg := config.Get()
+	previous := cfg.MonitorLeakThreshold
+	cfg.MonitorLeakThreshold = 100
+	t.Cleanup(func() { cfg.MonitorLeakThreshold = previous })
+
+	samples := []struct {
+		sample   Sample
+		baseline int
+		suspect  bool
+	}{
+		{Sample{Goroutines: 50}, 50, false},
+		{Sample{Goroutines: 40}, 40, false},
+		{Sample{Goroutines: 140}, 40, false}, // 等于阈值不算
+		{Sample{Goroutines: 141}, 40, true},
+		// 有进行中的请求时不更新基线，也不判断泄漏
+		{Sample{Goroutines: 500, ActiveRequests: 2}, 40, false},
+		{Sample{Goroutines: 10, ActiveRequests: 1}, 40, false},
+	}
+	for i, s := range samples {
+		record(s.sample)
+		history := History()
+		if got := history[len(history)-1]; got.Suspect != s.suspect {
+			t.Errorf("sample %d suspect = %v, want %v", i, got.Suspect, s.suspect)
+		}
+		if b := Baseline(); b != s.baseline {
+			t.Errorf("sample %d baseline = %d, want %d", i, b, s.baseline)
+		}
+	}
+
+	// 阈值为 0 时不判断
+	cfg.MonitorLeakThreshold = 0
+	record(Sample{Goroutines: 10000})
+	if history := History(); history[len(history)-1].Suspect {
+		t.Error("suspect with threshold 0")
+	}
+}
+
+func TestRecordHistoryBounded(t *testing.T) {
+	resetSampler(t)
+	for i := 0; i < sampleHistoryMax+10; i++ {
+		record(Sample{Goroutines: i + 1, ActiveRequests: 1})
+	}
+	history := History()
+	if len(history) != sampleHistoryMax {
+		t.Fatalf("history length = %d", len(history))
+	}
+	// 保留最新的采样
+	if history[0].Goroutines != 11 || history[len(history)-1].Goroutines != sampleHistoryMax+10 {
+		t.Fatalf("history range = %d..%d", history[0].Goroutines, history[len(history)-1].Goroutines)
+	}
+}
+
+func TestCollectCountsActive(t *testing.T) {
+	useStreamLimit(t, 1, false)
+	ctx, done := Track(context.Background(), KindStream, "m", "acc-collect")
+	defer done()
+	_, requestDone := Track(context.Background(), KindRequest, "m", "acc-collect")
+	defer requestDone()
+	backdate(trackedID(ctx), 2*time.Minute)
+
+	s := Collect()
+	if s.ActiveRequests < 2 || s.ActiveStreams < 1 || s.AccountHolds["acc-collect"] != 2 || s.OverdueStreams < 1 {
+		t.Fatalf("sample = %+v", s)
+	}
+	if s.Goroutines == 0 {
+		t.Fatal("goroutines not sampled")
+	}
+	// 未开启看门狗取消时只报告
+	if ctx.Err() != nil {
+		t.Fatal("overdue stream cancelled with the watchdog off")
+	}
+}
+
+func TestCollectWatchdogCancels(t *testing.T) {
+	useStreamLimit(t, 1, true)
+	ctx, done := Track(context.Background(), KindStream, "m", "acc-watchdog-collect")
+	defer done()
+	backdate(trackedID(ctx), 2*time.Minute)
+
+	Collect()
+	if ctx.Err() == nil {
+		t.Fatal("overdue stream not cancelled by the watchdog")
+	}
+	if a, ok := activeByID(trackedID(ctx)); !ok || !a.Cancelled {
+		t.Fatalf("active = %+v %v", a, ok)
+	}
+}
+
+func TestSamplerStartStop(t *testing.T) {
+	resetSampler(t)
+	cfg := config.Get()
+	previous := cfg.MonitorSampleInterval
+	t.Cleanup(func() { cfg.MonitorSampleInterval = previous })
+
+	// 间隔为 0 时不启动
+	cfg.MonitorSampleInterval = 0
+	Start()
+	if GoroutinesByStage()["monitor"] != 0 {
+		t.Fatal("sampler started with interval 0")
+	}
+
+	cfg.MonitorSampleInterval = 1
+	Start()
+	deadline := time.Now().Add(3 * time.Second)
+	for len(History()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no sample recorded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitStageGone(t, "monitor")
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/monitor"
+)
+
+var reportDir string
+
+// notify 不能导入 testutil（testutil 依赖 store，store 依赖 notify），在这里准备配置
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "anti2api-notify-test")
+	if err != nil {
+		panic(err)
+	}
+	// 报表推送在客户端断开前一直挂起
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	reportDir = filepath.Join(dir, "reports")
+	os.Setenv("DATA_DIR", dir)
+	os.Setenv("USAGE_REPORT_DIR", reportDir)
+	os.Setenv("USAGE_REPORT_WEBHOOK", webhook.URL)
+
+	code := m.Run()
+	webhook.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// waitStageGone 等待阶段标签下的协程全部退出
+func waitStageGone(t *testing.T, stage string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for monitor.GoroutinesByStage()[stage] > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines still labelled %q", monitor.GoroutinesByStage()[stage], stage)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// stopAfterRelease 在 fn 阻塞时调用 stop，确认 stop 在 release 之前不返回
+func stopAfterRelease(t *testing.T, stop func(context.Context) error, release chan struct{}) {
+	t.Helper()
+	stopped := make(chan error, 1)
+	go func() { stopped <- stop(context.Background()) }()
+	select {
+	case err := <-stopped:
+		t.Fatalf("stop returned %v while a run was in progress", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop did not return after the run finished")
+	}
+}
+
+func TestErrorRateMonitorStopWaitsForCheck(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var checks atomic.Int32
+	startErrorRateMonitor(func(windowMinutes int) (int, int) {
+		if checks.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		return 0, 0
+	}, 5*time.Millisecond)
+	<-started
+
+	stopAfterRelease(t, StopErrorRateMonitor, release)
+	waitStageGone(t, "error-alerts")
+	after := checks.Load()
+	time.Sleep(30 * time.Millisecond)
+	if n := checks.Load(); n != after {
+		t.Errorf("%d checks ran after stop", n-after)
+	}
+}
+
+func TestErrorRateMonitorStopTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	var once atomic.Bool
+	startErrorRateMonitor(func(windowMinutes int) (int, int) {
+		if once.CompareAndSwap(false, true) {
+			close(started)
+			<-release
+		}
+		return 0, 0
+	}, 5*time.Millisecond)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := StopErrorRateMonitor(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("StopErrorRateMonitor = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestUsageReportStopWaitsForRender(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var renders atomic.Int32
+	startUsageReport(func(from, to time.Time) ([]byte, error) {
+		if renders.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		return []byte("date,model\n"), nil
+	}, 5*time.Millisecond)
+	<-started
+
+	// 正在生成的报表写完后才返回，挂起的推送随停止取消，不会拖住停止
+	stopAfterRelease(t, StopUsageReport, release)
+	waitStageGone(t, "usage-report")
+
+	files, err := os.ReadDir(reportDir)
+	if err != nil || len(files) == 0 {
+		t.Fatalf("report in progress was not written before stop returned: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/monitor"
+)
+
+// StatsFunc 返回统计窗口内的请求总数与失败数
+type StatsFunc func(windowMinutes int) (total, failed int)
+
+var errorRateLoop monitor.Loop
+
+// StartErrorRateMonitor 定时检查错误率，超过阈值时触发告警
+func StartErrorRateMonitor(stats StatsFunc) {
+	cfg := config.Get()
+	if !Get().Enabled() || cfg.ErrorRateThreshold <= 0 || cfg.ErrorRateWindow <= 0 {
+		return
+	}
+	startErrorRateMonitor(stats, time.Minute)
+}
+
+func startErrorRateMonitor(stats StatsFunc, every time.Duration) {
+	cfg := config.Get()
+	errorRateLoop.Start("error-alerts", func(ctx context.Context) {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			total, failed := stats(cfg.ErrorRateWindow)
+			if total < cfg.ErrorRateMinSamples || total == 0 {
+				continue
+			}
+
+			rate := failed * 100 / total
+			if rate >= cfg.ErrorRateThreshold {
+				Fire(EventErrorRateSpike, "Error rate exceeded threshold", map[string]interface{}{
+					"windowMinutes": cfg.ErrorRateWindow,
+					"total":         total,
+					"failed":        failed,
+					"ratePercent":   rate,
+					"threshold":     cfg.ErrorRateThreshold,
+				})
+			}
+		}
+	})
+}
+
+// StopErrorRateMonitor 停止错误率检查，等待进行中的检查结束
+func StopErrorRateMonitor(ctx context.Context) error {
+	return errorRateLoop.Stop(ctx)
+}
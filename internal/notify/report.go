@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+)
+
+// ReportFunc 生成 [from, to] 日期范围内的用量报表 CSV
+type ReportFunc func(from, to time.Time) ([]byte, error)
+
+var usageReportLoop monitor.Loop
+
+// StartUsageReport 按配置的间隔生成用量报表，写入目录和/或推送到 Webhook
+func StartUsageReport(render ReportFunc) {
+	cfg := config.Get()
+	if cfg.UsageReportInterval <= 0 || (cfg.UsageReportDir == "" && cfg.UsageReportWebhook == "") {
+		return
+	}
+	startUsageReport(render, time.Duration(cfg.UsageReportInterval)*time.Hour)
+}
+
+func startUsageReport(render ReportFunc, interval time.Duration) {
+	cfg := config.Get()
+	usageReportLoop.Start("usage-report", func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			var now time.Time
+			select {
+			case <-ctx.Done():
+				return
+			case now = <-ticker.C:
+			}
+			data, err := render(now.Add(-interval), now)
+			if err != nil {
+				logger.Warn("Failed to render usage report: %v", err)
+				continue
+			}
+			name := "usage-" + now.Format("20060102-1504") + ".csv"
+			if cfg.UsageReportDir != "" {
+				if err := writeReport(cfg.UsageReportDir, name, data); err != nil {
+					logger.Warn("Failed to write usage report: %v", err)
+				}
+			}
+			if cfg.UsageReportWebhook != "" {
+				if err := postReport(ctx, cfg.UsageReportWebhook, name, data); err != nil {
+					logger.Warn("Failed to deliver usage report to %s: %v", cfg.UsageReportWebhook, err)
+				}
+			}
+		}
+	})
+}
+
+// StopUsageReport 停止定时报表，等待正在生成的报表写完（推送随之取消）
+func StopUsageReport(ctx context.Context) error {
+	return usageReportLoop.Stop(ctx)
+}
+
+func writeReport(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name), data, 0644)
+}
+
+func postReport(ctx context.Context, url, name string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	resp, err := Get().httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+)
+
+// 事件类型
+const (
+	EventAccountsExhausted = "accounts_exhausted"   // 所有账号不可用
+	EventAccountRevoked    = "account_revoked"      // 账号授权被撤销
+	EventCircuitOpen       = "circuit_breaker_open" // 账号被上游拒绝，进入暂停选用
+	EventCooldownStorm     = "cooldown_storm"       // 同时暂停选用的账号占比超过阈值
+	EventReadinessFailure  = "readiness_failure"    // 就绪检查发现降级
+	EventErrorRateSpike    = "error_rate_spike"     // 错误率超过阈值
+	EventKeyLimitExceeded  = "key_limit_exceeded"   // API Key 超过用量阈值
+	EventEndpointDowngrade = "endpoint_downgraded"  // 当前端点超出错误预算，已自动切换到备用端点
+	EventEndpointRestore   = "endpoint_restored"    // 原端点通过观察期探测，已自动切回
+	EventTest              = "test"                 // 面板测试
+)
+
+// AllEvents 所有可配置的事件类型
+var AllEvents = []string{
+	EventAccountsExhausted,
+	EventAccountRevoked,
+	EventCircuitOpen,
+	EventCooldownStorm,
+	EventReadinessFailure,
+	EventErrorRateSpike,
+	EventKeyLimitExceeded,
+	EventEndpointDowngrade,
+	EventEndpointRestore,
+}
+
+// Payload Webhook 请求体
+type Payload struct {
+	Event      string                 `json:"event"`
+	Timestamp  time.Time              `json:"timestamp"`
+	Message    string                 `json:"message"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	Suppressed int                    `json:"suppressed,omitempty"` // 冷却期内被合并的同类事件数
+}
+
+// Notifier Webhook 通知器
+type Notifier struct {
+	mu         sync.Mutex
+	urls       []string
+	events     map[string]bool
+	cooldown   time.Duration
+	lastSent   map[string]time.Time
+	suppressed map[string]int
+	httpClient *http.Client
+}
+
+var (
+	notifier     *Notifier
+	notifierOnce sync.Once
+
+	// 重试退避间隔
+	retryBackoff = []time.Duration{time.Second, 5 * time.Second, 15 * time.Second}
+)
+
+// Get 获取通知器单例
+func Get() *Notifier {
+	notifierOnce.Do(func() {
+		cfg := config.Get()
+		notifier = &Notifier{
+			urls:       cfg.WebhookURLs,
+			events:     make(map[string]bool),
+			cooldown:   time.Duration(cfg.WebhookCooldown) * time.Second,
+			lastSent:   make(map[string]time.Time),
+			suppressed: make(map[string]int),
+			httpClient: &http.Client{Timeout: 10 * time.Second},
+		}
+
+		// 未配置事件列表时启用全部事件
+		enabled := cfg.WebhookEvents
+		if len(enabled) == 0 {
+			enabled = AllEvents
+		}
+		for _, e := range enabled {
+			notifier.events[e] = true
+		}
+	})
+	return notifier
+}
+
+// Enabled 是否配置了 Webhook
+func (n *Notifier) Enabled() bool {
+	return len(n.urls) > 0
+}
+
+// Fire 触发事件（异步发送，同类事件受冷却限制）
+func Fire(event, message string, details map[string]interface{}) {
+	n := Get()
+	if !n.Enabled() || !n.events[event] {
+		return
+	}
+
+	n.mu.Lock()
+	if last, ok := n.lastSent[event]; ok && time.Since(last) < n.cooldown {
+		n.suppressed[event]++
+		n.mu.Unlock()
+		return
+	}
+	n.lastSent[event] = time.Now()
+	suppressed := n.suppressed[event]
+	n.suppressed[event] = 0
+	n.mu.Unlock()
+
+	payload := Payload{
+		Event:      event,
+		Timestamp:  time.Now(),
+		Message:    message,
+		Details:    details,
+		Suppressed: suppressed,
+	}
+
+	for _, url := range n.urls {
+		monitor.Go("webhook", func() { n.deliver(url, payload) })
+	}
+}
+
+// SendTest 同步发送测试事件，返回每个 URL 的发送结果
+func (n *Notifier) SendTest() map[string]string {
+	payload := Payload{
+		Event:     EventTest,
+		Timestamp: time.Now(),
+		Message:   "Webhook test from anti2api",
+	}
+
+	results := make(map[string]string)
+	for _, url := range n.urls {
+		if err := n.post(url, payload); err != nil {
+			results[url] = err.Error()
+		} else {
+			results[url] = "ok"
+		}
+	}
+	return results
+}
+
+// deliver 发送并按退避策略重试
+func (n *Notifier) deliver(url string, payload Payload) {
+	var err error
+	for attempt := 0; attempt <= len(retryBackoff); attempt++ {
+		if err = n.post(url, payload); err == nil {
+			return
+		}
+		if attempt < len(retryBackoff) {
+			time.Sleep(retryBackoff[attempt])
+		}
+	}
+	logger.Warn("Webhook delivery failed for %s (%s): %v", url, payload.Event, err)
+}
+
+func (n *Notifier) post(url string, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Status 获取通知器状态（用于面板展示）
+func (n *Notifier) Status() map[string]interface{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	events := make([]string, 0, len(n.events))
+	for _, e := range AllEvents {
+		if n.events[e] {
+			events = append(events, e)
+		}
+	}
+
+	lastSent := make(map[string]time.Time, len(n.lastSent))
+	for k, v := range n.lastSent {
+		lastSent[k] = v
+	}
+
+	return map[string]interface{}{
+		"enabled":         n.Enabled(),
+		"urls":            len(n.urls),
+		"events":          events,
+		"cooldownSeconds": int(n.cooldown.Seconds()),
+		"lastSent":        lastSent,
+	}
+}
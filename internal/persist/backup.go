@@ -0,0 +1,129 @@
+package persist
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"anti2api-golang/internal/logger"
+)
+
+// maxRestoreFileSize 恢复时单个文件的大小上限
+const maxRestoreFileSize = 256 << 20
+
+// WriteBackup 将所有已注册的数据文件打包为 tar.gz（先刷新内存状态，不存在的文件跳过）
+func WriteBackup(w io.Writer) ([]string, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	var included []string
+	for _, f := range registered() {
+		if f.Flush != nil {
+			if err := f.Flush(); err != nil {
+				logger.Warn("Failed to flush %s before backup: %v", f.Name, err)
+			}
+		}
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return included, err
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    f.Name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: time.Now(),
+		}); err != nil {
+			return included, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return included, err
+		}
+		included = append(included, f.Name)
+	}
+
+	if err := tw.Close(); err != nil {
+		return included, err
+	}
+	return included, gz.Close()
+}
+
+// RestoreResult 恢复结果
+type RestoreResult struct {
+	Restored        []string `json:"restored"`
+	Reloaded        []string `json:"reloaded"`
+	RestartRequired []string `json:"restartRequired,omitempty"` // 没有重新加载逻辑的文件，重启后生效
+}
+
+// Restore 从 WriteBackup 生成的归档恢复。先完整读取并校验所有条目（只接受已注册的 JSON 文件），
+// 全部通过后才写入磁盘，避免恢复到一半
+func Restore(r io.Reader) (*RestoreResult, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	type entry struct {
+		file File
+		data []byte
+	}
+	var entries []entry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		f, ok := lookup(hdr.Name)
+		if !ok {
+			return nil, fmt.Errorf("unknown file in archive: %s", hdr.Name)
+		}
+		if hdr.Size > maxRestoreFileSize {
+			return nil, fmt.Errorf("%s is too large (%d bytes)", hdr.Name, hdr.Size)
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, maxRestoreFileSize))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("%s is not valid JSON", hdr.Name)
+		}
+		entries = append(entries, entry{file: f, data: data})
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("archive contains no data files")
+	}
+
+	result := &RestoreResult{}
+	for _, e := range entries {
+		if err := WriteFile(e.file.Path, e.data, 0644); err != nil {
+			return result, fmt.Errorf("write %s: %w", e.file.Name, err)
+		}
+		result.Restored = append(result.Restored, e.file.Name)
+	}
+	for _, e := range entries {
+		if e.file.Reload == nil {
+			result.RestartRequired = append(result.RestartRequired, e.file.Name)
+			continue
+		}
+		if err := e.file.Reload(); err != nil {
+			return result, fmt.Errorf("reload %s: %w", e.file.Name, err)
+		}
+		result.Reloaded = append(result.Reloaded, e.file.Name)
+	}
+	logger.Info("Restored %d data files from backup", len(result.Restored))
+	return result, nil
+}
@@ -0,0 +1,168 @@
+package persist
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useFiles 只注册给定的数据文件（测试结束时恢复原注册表）
+func useFiles(t *testing.T, list ...File) {
+	t.Helper()
+	filesMu.Lock()
+	previous := files
+	files = make(map[string]File)
+	filesMu.Unlock()
+	for _, f := range list {
+		Register(f)
+	}
+	t.Cleanup(func() {
+		filesMu.Lock()
+		files = previous
+		filesMu.Unlock()
+	})
+}
+
+// archive 以 name/content 对构造 tar.gz
+func archive(t *testing.T, entries ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for i := 0; i+1 < len(entries); i += 2 {
+		tw.WriteHeader(&tar.Header{Name: entries[i], Mode: 0644, Size: int64(len(entries[i+1]))})
+		io.WriteString(tw, entries[i+1])
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// readArchive 解出归档中的文件内容
+func readArchive(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	result := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return result
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		result[hdr.Name] = string(content)
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	accounts := filepath.Join(dir, "accounts.json")
+	settings := filepath.Join(dir, "settings.json")
+	os.WriteFile(accounts, []byte(`{"version":1,"accounts":[]}`), 0644)
+
+	var flushed, reloaded []string
+	useFiles(t,
+		File{Name: "accounts.json", Path: accounts, Reload: func() error {
+			reloaded = append(reloaded, "accounts.json")
+			return nil
+		}},
+		// 内存中的状态在备份前写入磁盘
+		File{Name: "settings.json", Path: settings, Flush: func() error {
+			flushed = append(flushed, "settings.json")
+			return os.WriteFile(settings, []byte(`{"a":1}`), 0644)
+		}},
+		File{Name: "missing.json", Path: filepath.Join(dir, "missing.json")},
+	)
+
+	var buf bytes.Buffer
+	included, err := WriteBackup(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(included, []string{"accounts.json", "settings.json"}) || len(flushed) != 1 {
+		t.Errorf("included %v, flushed %v", included, flushed)
+	}
+	want := map[string]string{"accounts.json": `{"version":1,"accounts":[]}`, "settings.json": `{"a":1}`}
+	if got := readArchive(t, buf.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("archive = %v", got)
+	}
+
+	// 修改后恢复，文件回到备份时的内容
+	os.WriteFile(accounts, []byte(`{"version":1,"accounts":[{"email":"new@example.com"}]}`), 0644)
+	os.Remove(settings)
+	result, err := Restore(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range want {
+		if got := readString(t, filepath.Join(dir, name)); got != content {
+			t.Errorf("%s = %s, want %s", name, got, content)
+		}
+	}
+	if !reflect.DeepEqual(result.Restored, []string{"accounts.json", "settings.json"}) ||
+		!reflect.DeepEqual(result.Reloaded, []string{"accounts.json"}) ||
+		!reflect.DeepEqual(result.RestartRequired, []string{"settings.json"}) ||
+		!reflect.DeepEqual(reloaded, []string{"accounts.json"}) {
+		t.Errorf("result = %+v, reloaded %v", result, reloaded)
+	}
+	// 恢复前的内容保留为 .bak
+	if got := readString(t, accounts+BackupSuffix); !strings.Contains(got, "new@example.com") {
+		t.Errorf("backup of the replaced file = %s", got)
+	}
+}
+
+func TestRestoreRejectsBadArchives(t *testing.T) {
+	dir := t.TempDir()
+	accounts := filepath.Join(dir, "accounts.json")
+	keys := filepath.Join(dir, "keys.json")
+	os.WriteFile(accounts, []byte(`{"v":"current"}`), 0644)
+	os.WriteFile(keys, []byte(`{"v":"current"}`), 0644)
+	useFiles(t, File{Name: "accounts.json", Path: accounts}, File{Name: "keys.json", Path: keys})
+
+	for name, data := range map[string][]byte{
+		"not gzip":  []byte("accounts.json"),
+		"empty":     archive(t),
+		"unknown":   archive(t, "keys.json", `{}`, "../../etc/passwd", `{}`),
+		"invalid":   archive(t, "keys.json", `{"v":"restored"}`, "accounts.json", `{"v":`),
+		"truncated": archive(t, "keys.json", `{"v":"restored"}`)[:40],
+	} {
+		t.Run(name, func(t *testing.T) {
+			result, err := Restore(bytes.NewReader(data))
+			if err == nil || result != nil {
+				t.Fatalf("Restore = %+v, %v, want rejected before writing", result, err)
+			}
+			// 校验失败时不写入任何文件（即使前面的条目有效）
+			for _, path := range []string{accounts, keys} {
+				if got := readString(t, path); got != `{"v":"current"}` {
+					t.Errorf("%s changed to %s", filepath.Base(path), got)
+				}
+			}
+		})
+	}
+}
+
+func TestRestoreReloadFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	useFiles(t, File{Name: "accounts.json", Path: path, Reload: func() error { return errors.New("boom") }})
+
+	result, err := Restore(bytes.NewReader(archive(t, "accounts.json", `{}`)))
+	if err == nil || result == nil {
+		t.Fatalf("Restore = %+v, %v, want a partial result with the reload error", result, err)
+	}
+	if !reflect.DeepEqual(result.Restored, []string{"accounts.json"}) {
+		t.Errorf("restored = %v", result.Restored)
+	}
+}
@@ -0,0 +1,240 @@
+package persist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+)
+
+func init() {
+	// 设置文件由 config 包读写（config 无法导入本包），注册崩溃安全的读写实现
+	config.SetSettingsFileIO(func(path string) ([]byte, error) {
+		return ReadFile(path, ValidJSON)
+	}, WriteFile)
+}
+
+// BackupSuffix 上一代文件的后缀
+const BackupSuffix = ".bak"
+
+// WriteFile 崩溃安全写入：先写临时文件并 fsync，把当前文件保留为 .bak，再原子重命名。
+// 任意时刻中断，path 要么是旧内容要么是新内容，不会出现写了一半的文件
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := keepPrevious(path); err != nil {
+		logger.Warn("Failed to keep previous generation of %s: %v", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// keepPrevious 将当前文件保留为 .bak（硬链接，不支持时复制），当前文件不存在时跳过
+func keepPrevious(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	backup := path + BackupSuffix
+	os.Remove(backup)
+	if err := os.Link(path, backup); err == nil {
+		return nil
+	}
+	return copyFile(path, backup)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir 刷新目录项，保证重命名在断电后仍然生效（部分平台不支持，忽略错误）
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// ReadFile 读取文件并用 validate 校验（nil 时只检查非空）。文件损坏（校验失败、被截断）或缺失但存在 .bak 时，
+// 回退到 .bak 并记录恢复告警；两者都不可用时返回错误，文件与备份都不存在时返回 os.ErrNotExist
+func ReadFile(path string, validate func(data []byte) error) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err = check(data, validate); err == nil {
+			return data, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	primaryErr := err
+
+	backup, backupErr := os.ReadFile(path + BackupSuffix)
+	if backupErr == nil {
+		backupErr = check(backup, validate)
+	}
+	if backupErr != nil {
+		if os.IsNotExist(primaryErr) {
+			return nil, primaryErr
+		}
+		return nil, fmt.Errorf("%s is corrupted (%v) and no usable backup is available (%v)", path, primaryErr, backupErr)
+	}
+
+	// 保留损坏的文件便于排查，再用备份覆盖
+	if !os.IsNotExist(primaryErr) {
+		os.Rename(path, fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405")))
+	}
+	if err := os.WriteFile(path, backup, 0644); err != nil {
+		logger.Warn("Failed to restore %s from backup: %v", path, err)
+	}
+	recordRecovery(path, primaryErr)
+	return backup, nil
+}
+
+func check(data []byte, validate func([]byte) error) error {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return errors.New("file is empty")
+	}
+	if validate == nil {
+		return nil
+	}
+	return validate(data)
+}
+
+// Recovery 启动时从备份恢复的记录（在管理面板中提示）
+type Recovery struct {
+	Path   string    `json:"path"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+var (
+	recoveriesMu sync.Mutex
+	recoveries   []Recovery
+)
+
+func recordRecovery(path string, reason error) {
+	logger.Error("==================================================================")
+	logger.Error("DATA FILE %s WAS CORRUPTED: %v", path, reason)
+	logger.Error("Recovered from %s (changes since the previous save are lost)", path+BackupSuffix)
+	logger.Error("==================================================================")
+
+	recoveriesMu.Lock()
+	defer recoveriesMu.Unlock()
+	recoveries = append(recoveries, Recovery{Path: path, Reason: reason.Error(), Time: time.Now()})
+}
+
+// Recoveries 返回本次启动以来的恢复记录
+func Recoveries() []Recovery {
+	recoveriesMu.Lock()
+	defer recoveriesMu.Unlock()
+	return append([]Recovery{}, recoveries...)
+}
+
+// File 参与备份/恢复的数据文件
+type File struct {
+	Name   string       // 归档中的文件名（如 accounts.json）
+	Path   string       // 磁盘路径
+	Flush  func() error // 备份前将内存状态写入磁盘（可选）
+	Reload func() error // 恢复后重新加载（可选，为空时需要重启生效）
+}
+
+var (
+	filesMu sync.Mutex
+	files   = make(map[string]File)
+)
+
+// Register 注册参与备份的数据文件（各存储在初始化时调用）
+func Register(f File) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	files[f.Name] = f
+}
+
+// registered 按名称排序返回已注册的文件
+func registered() []File {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	list := make([]File, 0, len(files))
+	for _, f := range files {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func lookup(name string) (File, bool) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	f, ok := files[name]
+	return f, ok
+}
+
+// ValidJSON 校验数据是完整的 JSON（被截断的文件无法通过）
+func ValidJSON(data []byte) error {
+	if !json.Valid(data) {
+		return errors.New("invalid or truncated JSON")
+	}
+	return nil
+}
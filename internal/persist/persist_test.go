@@ -0,0 +1,151 @@
+package persist
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeGenerations 依次以 WriteFile 写入各代内容，返回文件路径
+func writeGenerations(t *testing.T, generations ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.json")
+	for _, data := range generations {
+		if err := WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func readString(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriteFileKeepsPreviousGeneration(t *testing.T) {
+	path := writeGenerations(t, `{"v":1}`)
+	if _, err := os.Stat(path + BackupSuffix); !os.IsNotExist(err) {
+		t.Errorf("first write created a backup: %v", err)
+	}
+
+	if err := WriteFile(path, []byte(`{"v":2}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, path); got != `{"v":2}` {
+		t.Errorf("file = %s", got)
+	}
+	if got := readString(t, path+BackupSuffix); got != `{"v":1}` {
+		t.Errorf("backup = %s, want the previous generation", got)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, %v", info.Mode(), err)
+	}
+
+	// 只保留一代，临时文件不残留
+	if err := WriteFile(path, []byte(`{"v":3}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, path+BackupSuffix); got != `{"v":2}` {
+		t.Errorf("backup = %s, want generation 2", got)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 2 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("directory holds %v, want only the file and its backup", names)
+	}
+}
+
+func TestReadFileRecoversFromBackup(t *testing.T) {
+	for name, corrupt := range map[string]func(path string) error{
+		"truncated": func(path string) error { return os.WriteFile(path, []byte(`{"accounts":[{"email":"a@exa`), 0644) },
+		"empty":     func(path string) error { return os.WriteFile(path, nil, 0644) },
+		"blank":     func(path string) error { return os.WriteFile(path, []byte(" \n"), 0644) },
+		"missing":   os.Remove,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := writeGenerations(t, `{"v":1}`, `{"v":2}`)
+			if err := corrupt(path); err != nil {
+				t.Fatal(err)
+			}
+			before := len(Recoveries())
+
+			data, err := ReadFile(path, ValidJSON)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != `{"v":1}` {
+				t.Errorf("read %s, want the backup", data)
+			}
+			// 备份写回原路径，下次启动直接读取
+			if got := readString(t, path); got != `{"v":1}` {
+				t.Errorf("file after recovery = %s", got)
+			}
+			recoveries := Recoveries()
+			if len(recoveries) != before+1 || recoveries[len(recoveries)-1].Path != path {
+				t.Errorf("recoveries = %+v, want one for %s", recoveries[before:], path)
+			}
+
+			// 损坏的文件保留下来便于排查
+			matches, _ := filepath.Glob(path + ".corrupt-*")
+			if wantKept := name != "missing"; (len(matches) == 1) != wantKept {
+				t.Errorf("corrupt copies = %v, want kept=%v", matches, wantKept)
+			}
+		})
+	}
+}
+
+func TestReadFileWithoutUsableBackup(t *testing.T) {
+	t.Run("both corrupted", func(t *testing.T) {
+		path := writeGenerations(t, `{"v":1}`, `{"v":2}`)
+		os.WriteFile(path, []byte(`{"v":`), 0644)
+		os.WriteFile(path+BackupSuffix, []byte(`[1,`), 0644)
+
+		_, err := ReadFile(path, ValidJSON)
+		if err == nil || os.IsNotExist(err) || !strings.Contains(err.Error(), "no usable backup") {
+			t.Fatalf("err = %v, want a corruption error", err)
+		}
+		// 不覆盖任何文件，留给人工处理
+		if got := readString(t, path); got != `{"v":` {
+			t.Errorf("file rewritten to %s", got)
+		}
+	})
+
+	t.Run("corrupted without backup", func(t *testing.T) {
+		path := writeGenerations(t, `{"v":1}`)
+		os.WriteFile(path, []byte(`{"v":`), 0644)
+		if _, err := ReadFile(path, ValidJSON); err == nil || os.IsNotExist(err) {
+			t.Fatalf("err = %v, want a corruption error", err)
+		}
+	})
+
+	t.Run("neither exists", func(t *testing.T) {
+		_, err := ReadFile(filepath.Join(t.TempDir(), "none.json"), ValidJSON)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("err = %v, want ErrNotExist", err)
+		}
+	})
+}
+
+func TestReadFileCustomValidation(t *testing.T) {
+	path := writeGenerations(t, "version=1", "version=2")
+	valid := func(data []byte) error {
+		if !strings.HasPrefix(string(data), "version=1") {
+			return errors.New("unsupported version")
+		}
+		return nil
+	}
+	data, err := ReadFile(path, valid)
+	if err != nil || string(data) != "version=1" {
+		t.Errorf("ReadFile = %q, %v, want the backup accepted by the validator", data, err)
+	}
+}
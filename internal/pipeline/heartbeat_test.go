@@ -0,0 +1,185 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/testutil"
+)
+
+// heartbeatRenderer 按顺序记录心跳和内容（心跳来自另一个协程）
+type heartbeatRenderer struct {
+	mu      sync.Mutex
+	events  []string
+	failing bool // Heartbeat 返回错误（客户端写入失败）
+}
+
+func (r *heartbeatRenderer) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *heartbeatRenderer) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func (r *heartbeatRenderer) heartbeats() int {
+	n := 0
+	for _, e := range r.get() {
+		if e == "heartbeat" {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *heartbeatRenderer) Start()                  {}
+func (r *heartbeatRenderer) Reasoning(text string)   { r.record("reasoning " + text) }
+func (r *heartbeatRenderer) Content(text string)     { r.record("content " + text) }
+func (r *heartbeatRenderer) Error(err error, _ bool) { r.record("error") }
+func (r *heartbeatRenderer) Finish(result *Result)   { r.record("finish") }
+func (r *heartbeatRenderer) ToolCalls(calls []converter.OpenAIToolCall) {
+	r.record("tool_calls")
+}
+
+func (r *heartbeatRenderer) Heartbeat() error {
+	r.record("heartbeat")
+	if r.failing {
+		return errors.New("broken pipe")
+	}
+	return nil
+}
+
+// delayedUpstream 立即返回响应头，等待 delay（客户端断开时提前返回）后交给 next 输出数据块
+func delayedUpstream(delay time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(delay):
+			next(w, r)
+		case <-r.Context().Done():
+		}
+	}
+}
+
+// slowChunks 逐个发送数据块，每个之间间隔 gap
+func slowChunks(gap time.Duration, chunks ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range chunks {
+			w.Write([]byte("data: " + c + "\n\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(gap)
+		}
+	}
+}
+
+// heartbeatOrchestrator 以 20ms 心跳间隔运行的流式 Orchestrator
+func heartbeatOrchestrator(renderer ChunkRenderer) *Orchestrator {
+	o := newTestOrchestrator(renderer)
+	o.Heartbeat = 20 * time.Millisecond
+	return o
+}
+
+// assertNoLaterHeartbeats Run 返回后心跳协程已经退出
+func assertNoLaterHeartbeats(t *testing.T, r *heartbeatRenderer) {
+	t.Helper()
+	before := r.heartbeats()
+	time.Sleep(80 * time.Millisecond)
+	if after := r.heartbeats(); after != before {
+		t.Errorf("%d heartbeats sent after Run returned", after-before)
+	}
+}
+
+func TestHeartbeatsUntilFirstChunk(t *testing.T) {
+	// 上游思考较长时间后才输出（按比例缩短的 10 秒延迟），之后的数据块之间也有停顿
+	testutil.StartUpstream(t, delayedUpstream(200*time.Millisecond, slowChunks(100*time.Millisecond,
+		testutil.Chunk("", testutil.Text("Hel")),
+		testutil.Chunk("", testutil.Text("lo")),
+		testutil.Chunk("STOP"),
+	)))
+	renderer := &heartbeatRenderer{}
+
+	result := heartbeatOrchestrator(renderer).Run(context.Background())
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	events := renderer.get()
+	first := -1
+	for i, e := range events {
+		if e == "content Hel" {
+			first = i
+			break
+		}
+	}
+	if first < 3 {
+		t.Fatalf("events = %v, want several heartbeats before the first chunk", events)
+	}
+	for _, e := range events[first:] {
+		if e == "heartbeat" {
+			t.Fatalf("heartbeat after the first chunk: %v", events)
+		}
+	}
+	assertNoLaterHeartbeats(t, renderer)
+}
+
+func TestHeartbeatStopsOnUpstreamError(t *testing.T) {
+	testutil.StartUpstream(t, delayedUpstream(100*time.Millisecond, slowChunks(0)))
+	renderer := &heartbeatRenderer{}
+
+	// 上游在发送任何数据块前结束
+	result := heartbeatOrchestrator(renderer).Run(context.Background())
+	if result.Err == nil && !result.Truncated {
+		t.Fatalf("empty upstream stream succeeded: %+v", result)
+	}
+	if renderer.heartbeats() == 0 {
+		t.Error("no heartbeats while waiting for the upstream")
+	}
+	assertNoLaterHeartbeats(t, renderer)
+}
+
+func TestHeartbeatStopsOnClientDisconnect(t *testing.T) {
+	testutil.StartUpstream(t, delayedUpstream(10*time.Second, slowChunks(0, testutil.Chunk("STOP", testutil.Text("late")))))
+	renderer := &heartbeatRenderer{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	heartbeatOrchestrator(renderer).Run(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Run took %v after the client disconnected", elapsed)
+	}
+	if renderer.heartbeats() == 0 {
+		t.Error("no heartbeats before the client disconnected")
+	}
+	assertNoLaterHeartbeats(t, renderer)
+}
+
+func TestHeartbeatStopsOnWriteFailure(t *testing.T) {
+	testutil.StartUpstream(t, delayedUpstream(200*time.Millisecond, slowChunks(0, testutil.Chunk("STOP", testutil.Text("ok")))))
+	renderer := &heartbeatRenderer{failing: true}
+
+	heartbeatOrchestrator(renderer).Run(context.Background())
+	if n := renderer.heartbeats(); n != 1 {
+		t.Errorf("%d heartbeats sent, want the ticker stopped after the first failed write", n)
+	}
+}
+
+func TestNoHeartbeatWhenDisabled(t *testing.T) {
+	testutil.StartUpstream(t, delayedUpstream(100*time.Millisecond, slowChunks(0, testutil.Chunk("STOP", testutil.Text("ok")))))
+	renderer := &heartbeatRenderer{}
+
+	newTestOrchestrator(renderer).Run(context.Background())
+	if n := renderer.heartbeats(); n != 0 {
+		t.Errorf("%d heartbeats sent with Heartbeat = 0", n)
+	}
+}
@@ -0,0 +1,456 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/quarantine"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/tracing"
+)
+
+// ChunkRenderer 协议相关的流式输出（OpenAI、Gemini 等）
+type ChunkRenderer interface {
+	// Start 上游请求成功、开始输出前调用
+	Start()
+	Reasoning(text string)
+	Content(text string)
+	ToolCalls(calls []converter.OpenAIToolCall)
+	// Heartbeat 等待上游时的保活数据，返回错误表示客户端已断开
+	Heartbeat() error
+	// Error 上游请求失败，started 表示此前已经输出过数据（心跳）
+	Error(err error, started bool)
+	// Finish 输出结束（在 OnComplete 之后调用）
+	Finish(result *Result)
+}
+
+// TextFilter 流式文本过滤（后处理规则等）
+type TextFilter interface {
+	Write(chunk string) string
+	Finish() string
+	Applied() int
+}
+
+// Result 流式请求结果
+type Result struct {
+	Status               int
+	Err                  error
+	Content              string
+	Reasoning            string
+	ToolCalls            []converter.OpenAIToolCall
+	FinishReason         string
+	UpstreamFinishReason string // 上游原始 finishReason（为空表示未收到）
+	Usage                *converter.Usage
+	UsageMetadata        *converter.UsageMetadata
+	UsageEvents          []converter.UsageMetadata // 上游发送的原始 usageMetadata 序列
+	Grounding            *converter.GroundingMetadata
+	Annotations          []converter.Annotation // 引用，偏移对应 Content
+	PostProcessed        int
+	Duration             time.Duration
+	Started              bool           // 上游请求成功并开始输出
+	Truncated            bool           // 上游流在结束前中断（等待隔离规则检查的工具调用已丢弃）
+	ToolCallsIncomplete  bool           // 流中断前已输出了工具调用，调用列表可能不完整
+	Quarantine           []string       // 命中的工具调用隔离规则（rule:action）
+	Blocked              bool           // 工具调用被隔离规则阻止（已替换为拒绝消息）
+	Account              *store.Account // 最终处理请求的账号（切换账号后与 Orchestrator 初始账号不同）
+}
+
+// Success 请求是否成功
+func (r *Result) Success() bool {
+	return r.Err == nil
+}
+
+// Empty 上游没有返回内容、思考和工具调用
+func (r *Result) Empty() bool {
+	return r.Content == "" && r.Reasoning == "" && len(r.ToolCalls) == 0
+}
+
+// Orchestrator 流式请求编排：调用上游（含重试）、转发数据块、心跳、累计用量，结束时回调记录日志
+type Orchestrator struct {
+	Request  *converter.AntigravityRequest
+	Account  *store.Account
+	Model    string // 返回给客户端的模型名
+	Renderer ChunkRenderer
+	Filter   TextFilter
+
+	// Bypass 上游使用非流式请求，等待期间按 Heartbeat 间隔发送心跳
+	Bypass bool
+	// Pacing Bypass 模式下逐段回放响应，零值为整体输出
+	Pacing Pacing
+	// Heartbeat 心跳间隔；流式模式下在首个数据块到达前发送，0 为不发送
+	Heartbeat time.Duration
+
+	// Failover 上游请求失败、尚未向客户端输出时调用，返回换用的账号及对应的请求，nil 为不切换（仅流式模式）
+	Failover func(account *store.Account, err error) (*converter.AntigravityRequest, *store.Account)
+
+	// ToolCallGuard 工具调用输出前的检查（隔离规则，可能等待审批），nil 为不检查
+	ToolCallGuard func(ctx context.Context, calls []converter.OpenAIToolCall) quarantine.Decision
+
+	// OnComplete 输出结束前调用（记录日志、校验等）
+	OnComplete func(result *Result)
+}
+
+// Run 执行请求并输出到 Renderer
+func (o *Orchestrator) Run(ctx context.Context) (result *Result) {
+	// 登记为进行中的流式输出（看门狗可强制取消），心跳等协程继承 stage 标签
+	ctx, done := monitor.Track(ctx, monitor.KindStream, o.Model, o.Account.ID)
+	defer done()
+
+	monitor.Do(ctx, "stream", func(ctx context.Context) {
+		if o.Bypass {
+			result = o.runBypass(ctx)
+			return
+		}
+		result = o.runStream(ctx)
+	})
+	return result
+}
+
+func (o *Orchestrator) runStream(ctx context.Context) *Result {
+	startTime := time.Now()
+	result := &Result{Status: http.StatusOK}
+
+	resp, err := api.GenerateContentStream(ctx, o.Request, o.Account)
+	for err != nil && o.Failover != nil {
+		request, account := o.Failover(o.Account, err)
+		if account == nil {
+			break
+		}
+		o.Request, o.Account = request, account
+		resp, err = api.GenerateContentStream(ctx, o.Request, o.Account)
+	}
+	if err != nil {
+		result.Err = err
+		result.Status = api.ErrorStatus(err)
+		result.Duration = time.Since(startTime)
+		o.Renderer.Error(err, false)
+		o.complete(result)
+		return result
+	}
+
+	o.Renderer.Start()
+	result.Started = true
+
+	// 流处理 span：事件数、首个数据块耗时
+	_, span := tracing.Start(ctx, "stream.process")
+	defer span.End()
+	var events int
+
+	// 首个数据块之前发送心跳（上游思考时间较长时避免客户端超时）
+	stopHeartbeat := o.startFirstChunkHeartbeat(ctx)
+	defer stopHeartbeat()
+
+	var content, reasoning strings.Builder
+	var usage *converter.UsageMetadata
+	var guarded []converter.OpenAIToolCall // 等待隔离规则检查的工具调用
+	modelConfig := converter.GetModelConfig(o.Request.Model)
+	usageMerge := modelConfig.EffectiveUsageMerge()
+
+	// 文本形式的工具调用：可能是调用的内容暂存到结束时提取
+	var recovery *converter.ToolCallRecovery
+	if modelConfig.EffectiveToolCallRecovery() {
+		recovery = converter.NewToolCallRecovery(o.Request.Request.Tools)
+	}
+	writeContent := func(text string) {
+		if o.Filter != nil {
+			text = o.Filter.Write(text)
+		}
+		if text != "" {
+			o.Renderer.Content(text)
+			content.WriteString(text)
+		}
+	}
+
+	_, err = api.ProcessStreamResponse(ctx, resp, func(chunk api.StreamChunk) {
+		if chunk.Type != "usage" && chunk.Type != "grounding" && chunk.Type != "finish" {
+			stopHeartbeat()
+		}
+		if events++; events == 1 {
+			span.AddEvent("first_chunk")
+			span.SetAttr("stream.first_chunk_ms", time.Since(startTime).Milliseconds())
+		}
+		switch chunk.Type {
+		case "usage":
+			result.UsageEvents = append(result.UsageEvents, *chunk.Usage)
+			usage = converter.MergeUsage(usageMerge, usage, chunk.Usage)
+		case "grounding":
+			result.Grounding = converter.MergeGrounding(result.Grounding, chunk.Grounding)
+		case "finish":
+			result.UpstreamFinishReason = chunk.FinishReason
+		case "thinking":
+			o.Renderer.Reasoning(chunk.Content)
+			reasoning.WriteString(chunk.Content)
+		case "text":
+			text := chunk.Content
+			if recovery != nil {
+				text = recovery.Write(text)
+			}
+			writeContent(text)
+		case "tool_calls":
+			if o.ToolCallGuard != nil {
+				// 隔离规则检查整个响应的工具调用，结束后一起输出
+				guarded = append(guarded, chunk.ToolCalls...)
+			} else {
+				// 每个工具调用到达时立即输出
+				result.ToolCalls = append(result.ToolCalls, chunk.ToolCalls...)
+				o.Renderer.ToolCalls(chunk.ToolCalls)
+			}
+		}
+	})
+
+	stopHeartbeat()
+
+	// 流被截断时不输出暂存的工具调用，避免客户端执行可能不完整的调用
+	if errors.Is(err, api.ErrStreamTruncated) {
+		if len(guarded) > 0 {
+			logger.Warn("Dropped %d tool call(s) from truncated stream", len(guarded))
+		}
+	} else if calls := o.guardToolCalls(ctx, result, guarded); len(calls) > 0 {
+		result.ToolCalls = calls
+		o.Renderer.ToolCalls(calls)
+	}
+
+	// 上游已返回 FunctionCall 或流被截断时，暂存的内容按正文输出
+	if recovery != nil {
+		if len(result.ToolCalls) > 0 || err != nil {
+			writeContent(recovery.Flush())
+		} else {
+			rest, recovered := recovery.Finish()
+			writeContent(rest)
+			if recovered = o.guardToolCalls(ctx, result, recovered); len(recovered) > 0 {
+				result.ToolCalls = recovered
+				o.Renderer.ToolCalls(recovered)
+			}
+		}
+	}
+
+	// 输出过滤器保留区中的剩余内容
+	if o.Filter != nil {
+		if rest := o.Filter.Finish(); rest != "" {
+			o.Renderer.Content(rest)
+			content.WriteString(rest)
+		}
+		result.PostProcessed = o.Filter.Applied()
+	}
+	if result.Blocked {
+		refusal := refusalContent(content.Len() > 0)
+		o.Renderer.Content(refusal)
+		content.WriteString(refusal)
+	}
+
+	if err != nil {
+		if errors.Is(err, api.ErrStreamCanceled) {
+			logger.Warn("Upstream stream closed early: %v", err)
+		} else {
+			logger.Error("Stream processing error: %v", err)
+		}
+		result.Err = err
+		result.Status = http.StatusInternalServerError
+		if errors.Is(err, api.ErrStreamTruncated) {
+			result.Truncated = true
+			result.ToolCallsIncomplete = len(result.ToolCalls) > 0
+			result.Status = http.StatusBadGateway
+		}
+	}
+
+	result.Content = content.String()
+	result.Reasoning = reasoning.String()
+	// 引用按已输出的正文定位（后处理、工具调用提取可能改变了文本）
+	result.Annotations = converter.BuildAnnotations(result.Grounding, result.Content)
+	switch {
+	case result.Truncated:
+		// 不报告 tool_calls，避免客户端执行可能不完整的调用
+		result.FinishReason = "error"
+	case errors.Is(err, api.ErrStreamCanceled):
+		// 被看门狗或管理员取消时客户端仍在连接，不报告为正常结束
+		result.FinishReason = "error"
+	case result.Blocked:
+		result.FinishReason = "content_filter"
+	default:
+		// 上游因长度或安全过滤结束时如实报告，客户端据此判断输出是否被截断
+		result.FinishReason = converter.MapFinishReason(result.UpstreamFinishReason)
+		if result.FinishReason == "stop" && len(result.ToolCalls) > 0 {
+			result.FinishReason = "tool_calls"
+		}
+	}
+	result.UsageMetadata = usage
+	if usage != nil {
+		result.Usage = converter.ConvertUsage(usage)
+	}
+	result.Duration = time.Since(startTime)
+
+	span.SetAttr("stream.events", events)
+	span.SetAttr("stream.finish_reason", result.FinishReason)
+	span.SetAttr("stream.truncated", result.Truncated)
+	span.SetError(err)
+
+	o.complete(result)
+	o.Renderer.Finish(result)
+	return result
+}
+
+func (o *Orchestrator) runBypass(ctx context.Context) *Result {
+	startTime := time.Now()
+	result := &Result{Status: http.StatusOK, FinishReason: "stop"}
+
+	// 立即发送第一个心跳，确保客户端计时器启动
+	if err := o.Renderer.Heartbeat(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go o.heartbeat(ctx, done)
+
+	resp, err := api.GenerateContent(ctx, o.Request, o.Account)
+	close(done)
+
+	if err != nil {
+		result.Err = err
+		result.Status = api.ErrorStatus(err)
+		result.Duration = time.Since(startTime)
+		o.Renderer.Error(err, true)
+		o.complete(result)
+		return result
+	}
+
+	openAIResp := converter.ConvertToOpenAIResponse(resp, o.Model, o.Request.Request.Tools)
+	result.Started = true
+	result.PostProcessed = openAIResp.PostProcessed
+	result.UsageMetadata = resp.Response.UsageMetadata
+
+	if len(openAIResp.Choices) > 0 {
+		choice := openAIResp.Choices[0]
+		msg := choice.Message
+
+		msg.ToolCalls = o.guardToolCalls(ctx, result, msg.ToolCalls)
+		if result.Blocked {
+			msg.Content += refusalContent(msg.Content != "")
+			reason := "content_filter"
+			choice.FinishReason = &reason
+		}
+
+		result.Content = msg.Content
+		result.Reasoning = msg.Reasoning
+		result.ToolCalls = msg.ToolCalls
+		result.Annotations = msg.Annotations
+		result.Grounding = resp.Response.Candidates[0].GroundingMetadata
+		result.UpstreamFinishReason = resp.Response.Candidates[0].FinishReason
+		if choice.FinishReason != nil {
+			result.FinishReason = *choice.FinishReason
+		}
+
+		// 与流式模式相同的顺序：思考、正文，最后是工具调用
+		if !o.replay(ctx, msg.Reasoning, msg.Content) {
+			logger.Warn("Client disconnected during paced bypass replay")
+			result.Err = ctx.Err()
+			result.Status = http.StatusInternalServerError
+			result.Duration = time.Since(startTime)
+			o.complete(result)
+			return result
+		}
+		if len(msg.ToolCalls) > 0 {
+			o.Renderer.ToolCalls(msg.ToolCalls)
+		}
+	}
+	if usage := resp.Response.UsageMetadata; usage != nil {
+		result.UsageEvents = []converter.UsageMetadata{*usage}
+		result.Usage = converter.ConvertUsage(usage)
+	}
+	result.Duration = time.Since(startTime)
+
+	o.complete(result)
+	o.Renderer.Finish(result)
+	return result
+}
+
+// guardToolCalls 按隔离规则检查工具调用，返回可以输出的调用（被阻止时为 nil）。
+// 等待审批期间发送心跳
+func (o *Orchestrator) guardToolCalls(ctx context.Context, result *Result, calls []converter.OpenAIToolCall) []converter.OpenAIToolCall {
+	if o.ToolCallGuard == nil || len(calls) == 0 {
+		return calls
+	}
+
+	stopHeartbeat := o.startFirstChunkHeartbeat(ctx)
+	decision := o.ToolCallGuard(ctx, calls)
+	stopHeartbeat()
+
+	result.Quarantine = append(result.Quarantine, decision.Labels()...)
+	if decision.Blocked {
+		result.Blocked = true
+		return nil
+	}
+	return calls
+}
+
+// refusalContent 工具调用被阻止时追加到正文的拒绝消息
+func refusalContent(afterContent bool) string {
+	if afterContent {
+		return "\n\n" + quarantine.RefusalMessage
+	}
+	return quarantine.RefusalMessage
+}
+
+// startFirstChunkHeartbeat 启动首个数据块前的心跳，返回的 stop 可重复调用，返回时心跳协程已退出。
+// 客户端断开（ctx 取消）或写入失败时协程自行退出
+func (o *Orchestrator) startFirstChunkHeartbeat(ctx context.Context) (stop func()) {
+	if o.Heartbeat <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		o.heartbeat(ctx, done)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+		})
+	}
+}
+
+// heartbeat 等待上游期间定时发送心跳
+func (o *Orchestrator) heartbeat(ctx context.Context, done <-chan struct{}) {
+	interval := o.Heartbeat
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := o.Renderer.Heartbeat(); err != nil {
+				return
+			}
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (o *Orchestrator) complete(result *Result) {
+	result.Account = o.Account
+	if o.OnComplete != nil {
+		o.OnComplete(result)
+	}
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/quarantine"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// recordingRenderer 记录 Orchestrator 的输出
+type recordingRenderer struct {
+	content   string
+	reasoning string
+	toolCalls []converter.OpenAIToolCall
+	finished  *Result
+	err       error
+}
+
+func (r *recordingRenderer) Start()                  {}
+func (r *recordingRenderer) Reasoning(text string)   { r.reasoning += text }
+func (r *recordingRenderer) Content(text string)     { r.content += text }
+func (r *recordingRenderer) Heartbeat() error        { return nil }
+func (r *recordingRenderer) Error(err error, _ bool) { r.err = err }
+func (r *recordingRenderer) Finish(result *Result)   { r.finished = result }
+func (r *recordingRenderer) ToolCalls(calls []converter.OpenAIToolCall) {
+	r.toolCalls = append(r.toolCalls, calls...)
+}
+
+func testAccount() *store.Account {
+	return &store.Account{
+		ID:          "acc-1",
+		AccessToken: "access",
+		ExpiresIn:   3600,
+		Timestamp:   time.Now().UnixMilli(),
+		Enable:      true,
+		Endpoint:    testutil.EndpointKey,
+		ProjectID:   "project",
+	}
+}
+
+func newTestOrchestrator(renderer ChunkRenderer) *Orchestrator {
+	return &Orchestrator{
+		Request:  &converter.AntigravityRequest{Model: "gemini-2.5-flash"},
+		Account:  testAccount(),
+		Model:    "gemini-2.5-flash",
+		Renderer: renderer,
+	}
+}
+
+// truncatedToolCallStream 输出一个工具调用后在 finishReason 之前断开
+var truncatedToolCallStream = testutil.StreamHandler(
+	testutil.Chunk("", testutil.Text("checking")),
+	testutil.Chunk("", testutil.FunctionCall("call-1", "delete_files", map[string]interface{}{"path": "/tmp"})),
+)
+
+func TestTruncatedStreamDropsGuardedToolCalls(t *testing.T) {
+	testutil.StartUpstream(t, truncatedToolCallStream)
+
+	renderer := &recordingRenderer{}
+	o := newTestOrchestrator(renderer)
+	guardCalled := false
+	o.ToolCallGuard = func(ctx context.Context, calls []converter.OpenAIToolCall) quarantine.Decision {
+		guardCalled = true
+		return quarantine.Decision{}
+	}
+
+	result := o.Run(context.Background())
+	if !result.Truncated {
+		t.Fatalf("expected truncated result, got err=%v", result.Err)
+	}
+	if guardCalled {
+		t.Error("guard should not run for tool calls from a truncated stream")
+	}
+	if len(renderer.toolCalls) != 0 || len(result.ToolCalls) != 0 {
+		t.Errorf("guarded tool calls were emitted: %+v", renderer.toolCalls)
+	}
+	if result.ToolCallsIncomplete {
+		t.Error("no tool calls were sent, ToolCallsIncomplete should be false")
+	}
+	if result.FinishReason != "error" {
+		t.Errorf("finish reason = %q, want error", result.FinishReason)
+	}
+	if renderer.content != "checking" {
+		t.Errorf("content = %q", renderer.content)
+	}
+}
+
+func TestTruncatedStreamMarksSentToolCallsIncomplete(t *testing.T) {
+	testutil.StartUpstream(t, truncatedToolCallStream)
+
+	renderer := &recordingRenderer{}
+	result := newTestOrchestrator(renderer).Run(context.Background())
+	if !result.Truncated {
+		t.Fatalf("expected truncated result, got err=%v", result.Err)
+	}
+	// 未启用隔离规则时工具调用到达即输出，结束时只能标记为可能不完整
+	if len(renderer.toolCalls) != 1 {
+		t.Fatalf("tool calls sent = %d, want 1", len(renderer.toolCalls))
+	}
+	if !result.ToolCallsIncomplete {
+		t.Error("ToolCallsIncomplete should be set when tool calls were sent before truncation")
+	}
+	if result.FinishReason != "error" {
+		t.Errorf("finish reason = %q, want error", result.FinishReason)
+	}
+}
+
+func TestCompletedStreamFlushesGuardedToolCalls(t *testing.T) {
+	testutil.StartUpstream(t, testutil.StreamHandler(
+		testutil.Chunk("", testutil.FunctionCall("call-1", "read_file", map[string]interface{}{"path": "a"})),
+		testutil.Chunk("STOP"),
+	))
+
+	renderer := &recordingRenderer{}
+	o := newTestOrchestrator(renderer)
+	o.ToolCallGuard = func(ctx context.Context, calls []converter.OpenAIToolCall) quarantine.Decision {
+		return quarantine.Decision{}
+	}
+
+	result := o.Run(context.Background())
+	if result.Err != nil {
+		t.Fatalf("unexpected error: %v", result.Err)
+	}
+	if len(renderer.toolCalls) != 1 || renderer.toolCalls[0].Function.Name != "read_file" {
+		t.Fatalf("tool calls = %+v", renderer.toolCalls)
+	}
+	if result.FinishReason != "tool_calls" {
+		t.Errorf("finish reason = %q, want tool_calls", result.FinishReason)
+	}
+}
@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 分段方式
+const (
+	PaceByWord     = "word"
+	PaceBySentence = "sentence"
+)
+
+// Pacing bypass 模式下逐段回放完整响应，使客户端逐步渲染
+type Pacing struct {
+	Interval time.Duration // 相邻片段的间隔，0 为整体输出
+	Unit     string        // PaceByWord 或 PaceBySentence
+	MaxExtra time.Duration // 回放最多增加的总时间，片段过多时合并以保持间隔
+}
+
+// Enabled 是否分段回放
+func (p Pacing) Enabled() bool {
+	return p.Interval > 0 && p.MaxExtra >= p.Interval
+}
+
+// paceSegment 回放的一个片段
+type paceSegment struct {
+	reasoning bool
+	text      string
+}
+
+// replay 按流式输出的顺序回放思考和正文（思考在前），返回 false 表示客户端已断开、回放中止
+func (o *Orchestrator) replay(ctx context.Context, reasoning, content string) bool {
+	if !o.Pacing.Enabled() {
+		if reasoning != "" {
+			o.Renderer.Reasoning(reasoning)
+		}
+		if content != "" {
+			o.Renderer.Content(content)
+		}
+		return ctx.Err() == nil
+	}
+
+	segments := o.Pacing.plan(reasoning, content)
+	deadline := time.Now().Add(o.Pacing.MaxExtra)
+	timer := time.NewTimer(o.Pacing.Interval)
+	timer.Stop()
+	defer timer.Stop()
+
+	for i, seg := range segments {
+		if i > 0 {
+			// 剩余时间不足一个间隔时不再等待，保证总时间不超过上限
+			if time.Until(deadline) >= o.Pacing.Interval {
+				timer.Reset(o.Pacing.Interval)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					return false
+				}
+			} else if ctx.Err() != nil {
+				return false
+			}
+		}
+		if seg.reasoning {
+			o.Renderer.Reasoning(seg.text)
+		} else {
+			o.Renderer.Content(seg.text)
+		}
+	}
+	return ctx.Err() == nil
+}
+
+// plan 切分思考和正文，片段数超过时间上限允许的间隔数时把相邻片段合并
+func (p Pacing) plan(reasoning, content string) []paceSegment {
+	reasoningParts := splitPace(reasoning, p.Unit)
+	contentParts := splitPace(content, p.Unit)
+
+	// 合并后的片段数不超过 pauses+1（思考和正文分别合并，之间也有一个间隔）
+	pauses := int(p.MaxExtra / p.Interval)
+	size := 1
+	for (len(reasoningParts)+size-1)/size+(len(contentParts)+size-1)/size > pauses+1 {
+		size++
+	}
+
+	var segments []paceSegment
+	for _, part := range mergeParts(reasoningParts, size) {
+		segments = append(segments, paceSegment{reasoning: true, text: part})
+	}
+	for _, part := range mergeParts(contentParts, size) {
+		segments = append(segments, paceSegment{text: part})
+	}
+	return segments
+}
+
+// mergeParts 每 size 个片段合并为一个
+func mergeParts(parts []string, size int) []string {
+	if size <= 1 {
+		return parts
+	}
+	merged := make([]string, 0, (len(parts)+size-1)/size)
+	for i := 0; i < len(parts); i += size {
+		end := min(i+size, len(parts))
+		merged = append(merged, strings.Join(parts[i:end], ""))
+	}
+	return merged
+}
+
+// splitPace 按词或句切分文本，片段拼接后与原文相同。空白归入前一个片段；
+// 中日韩文字没有空格分词，按词切分时每个字为一个片段
+func splitPace(text, unit string) []string {
+	if text == "" {
+		return nil
+	}
+
+	var parts []string
+	start := 0
+	ended := false    // 当前片段已结束，遇到下一个非空白字符时切分
+	terminal := false // 按句切分时刚出现 . ! ?，后跟空白才视为句末（避免切开 3.14）
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if !space && i > start && (ended || (unit != PaceBySentence && isCJK(r))) {
+			parts = append(parts, text[start:i])
+			start = i
+			ended = false
+		}
+
+		if unit == PaceBySentence {
+			switch {
+			case r == '\n' || strings.ContainsRune("。！？", r):
+				ended = true
+			case r == '.' || r == '!' || r == '?':
+				terminal = true
+				continue
+			case space && terminal:
+				ended = true
+			}
+			terminal = false
+			continue
+		}
+		if space || isCJK(r) {
+			ended = true
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// isCJK 中日韩文字（不以空格分词）
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
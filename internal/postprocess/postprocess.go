@@ -0,0 +1,176 @@
+package postprocess
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+)
+
+// 规则类型
+const (
+	RuleRegexReplace       = "regex-replace"
+	RulePrefixStrip        = "prefix-strip"
+	RuleSuffixStrip        = "suffix-strip"
+	RuleCollapseBlankLines = "collapse-blank-lines"
+)
+
+// Rule 后处理规则（data/postprocess.json 中按顺序执行）
+type Rule struct {
+	Type             string   `json:"type"`
+	Pattern          string   `json:"pattern,omitempty"`     // regex-replace
+	Replacement      string   `json:"replacement,omitempty"` // regex-replace
+	Value            string   `json:"value,omitempty"`       // prefix-strip / suffix-strip
+	Models           []string `json:"models,omitempty"`      // 为空时作用于所有模型
+	IncludeReasoning bool     `json:"includeReasoning,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// ruleFile 规则文件格式
+type ruleFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+var (
+	rules     []Rule
+	rulesOnce sync.Once
+
+	blankLinesRe = regexp.MustCompile(`\n[ \t]*(\n[ \t]*)+\n`)
+)
+
+// loadRules 加载后处理规则
+func loadRules() {
+	path := filepath.Join(config.Get().DataDir, "postprocess.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	var file ruleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		logger.Warn("Invalid post-process rules %s: %v", path, err)
+		return
+	}
+
+	for _, rule := range file.Rules {
+		switch rule.Type {
+		case RuleRegexReplace:
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				logger.Warn("Invalid post-process pattern %q: %v", rule.Pattern, err)
+				continue
+			}
+			rule.re = re
+		case RulePrefixStrip, RuleSuffixStrip:
+			if rule.Value == "" {
+				continue
+			}
+		case RuleCollapseBlankLines:
+		default:
+			logger.Warn("Unknown post-process rule type: %s", rule.Type)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	logger.Info("Loaded %d post-process rules", len(rules))
+}
+
+// Rules 获取已加载的规则
+func Rules() []Rule {
+	rulesOnce.Do(loadRules)
+	return rules
+}
+
+// appliesTo 检查规则是否作用于指定模型
+func (r *Rule) appliesTo(model string, reasoning bool) bool {
+	if reasoning && !r.IncludeReasoning {
+		return false
+	}
+	if len(r.Models) == 0 {
+		return true
+	}
+	for _, m := range r.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// apply 执行单条规则，返回结果及是否有改动。
+// 完全落在 text[:from] 内的匹配不处理（流式处理时这部分已经执行过规则），
+// next 为结果中仍然不需要再处理的前缀长度（供下一条规则使用）
+func (r *Rule) apply(text string, from int) (out string, changed bool, next int) {
+	switch r.Type {
+	case RuleRegexReplace:
+		return replaceFrom(r.re, text, r.Replacement, from)
+	case RulePrefixStrip:
+		if len(r.Value) <= from || !strings.HasPrefix(text, r.Value) {
+			return text, false, from
+		}
+		return text[len(r.Value):], true, 0
+	case RuleSuffixStrip:
+		// 只在结束时执行一次，不受 from 限制
+		out = strings.TrimSuffix(text, r.Value)
+		return out, out != text, min(from, len(out))
+	case RuleCollapseBlankLines:
+		return replaceFrom(blankLinesRe, text, "\n\n", from)
+	}
+	return text, false, from
+}
+
+// replaceFrom 与 ReplaceAllString 相同，但跳过结束位置不超过 from 的匹配
+func replaceFrom(re *regexp.Regexp, text, replacement string, from int) (string, bool, int) {
+	var out []byte
+	last, first := 0, -1
+	for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+		if m[1] <= from {
+			continue
+		}
+		if first < 0 {
+			first = m[0]
+		}
+		out = append(out, text[last:m[0]]...)
+		out = re.ExpandString(out, replacement, text, m)
+		last = m[1]
+	}
+	if first < 0 {
+		return text, false, from
+	}
+	out = append(out, text[last:]...)
+	result := string(out)
+	return result, result != text, min(from, first)
+}
+
+// Apply 对完整内容执行所有规则，返回处理结果和生效的规则数
+func Apply(model, text string, reasoning bool) (string, int) {
+	applied := 0
+	for i := range Rules() {
+		rule := &rules[i]
+		if !rule.appliesTo(model, reasoning) {
+			continue
+		}
+		var changed bool
+		if text, changed, _ = rule.apply(text, 0); changed {
+			applied++
+		}
+	}
+	return text, applied
+}
+
+// Enabled 检查指定模型是否有生效的规则
+func Enabled(model string, reasoning bool) bool {
+	for i := range Rules() {
+		if rules[i].appliesTo(model, reasoning) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package postprocess
+
+import "unicode/utf8"
+
+// defaultHoldback 流式处理时保留的尾部字节数，用于捕获跨 chunk 的匹配
+const defaultHoldback = 256
+
+// StreamProcessor 流式后处理器
+// 规则在 "尾部保留区 + 新内容" 上执行，保留区在下一个 chunk 到达时重新参与匹配以捕获跨 chunk 的内容；
+// 保留区已经执行过规则，完全落在其中的匹配不再处理，非幂等的规则也不会重复生效
+type StreamProcessor struct {
+	model    string
+	buf      string
+	done     int // buf[:done] 已经执行过规则
+	holdback int
+	started  bool
+	applied  map[int]bool
+}
+
+// NewStreamProcessor 创建流式后处理器，模型无生效规则时返回 nil
+func NewStreamProcessor(model string) *StreamProcessor {
+	if !Enabled(model, false) {
+		return nil
+	}
+
+	holdback := defaultHoldback
+	for _, rule := range Rules() {
+		if (rule.Type == RulePrefixStrip || rule.Type == RuleSuffixStrip) && len(rule.Value) > holdback {
+			holdback = len(rule.Value)
+		}
+	}
+
+	return &StreamProcessor{
+		model:    model,
+		holdback: holdback,
+		applied:  make(map[int]bool),
+	}
+}
+
+// Write 写入新的 chunk，返回可以安全输出的内容
+func (p *StreamProcessor) Write(chunk string) string {
+	p.buf += chunk
+	if len(p.buf) <= p.holdback {
+		return ""
+	}
+
+	p.buf = p.run(p.buf, false)
+	p.done = len(p.buf)
+
+	cut := len(p.buf) - p.holdback
+	if cut <= 0 {
+		return ""
+	}
+	// 避免截断多字节字符
+	for cut > 0 && !utf8.RuneStart(p.buf[cut]) {
+		cut--
+	}
+
+	out := p.buf[:cut]
+	p.buf = p.buf[cut:]
+	p.done = len(p.buf)
+	p.started = true
+	return out
+}
+
+// Finish 结束流，返回剩余内容（含 suffix-strip 处理）
+func (p *StreamProcessor) Finish() string {
+	out := p.run(p.buf, true)
+	p.buf = ""
+	p.done = 0
+	p.started = true
+	return out
+}
+
+// Applied 返回生效过的规则数
+func (p *StreamProcessor) Applied() int {
+	return len(p.applied)
+}
+
+// run 执行规则：prefix-strip 只在首次输出前生效，suffix-strip 只在结束时生效
+func (p *StreamProcessor) run(text string, final bool) string {
+	from := p.done
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.appliesTo(p.model, false) {
+			continue
+		}
+		if rule.Type == RulePrefixStrip && p.started {
+			continue
+		}
+		if rule.Type == RuleSuffixStrip && !final {
+			continue
+		}
+		var changed bool
+		if text, changed, from = rule.apply(text, from); changed {
+			p.applied[i] = true
+		}
+	}
+	return text
+}
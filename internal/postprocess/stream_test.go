@@ -0,0 +1,97 @@
+package postprocess
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// setRules 替换已加载的规则（测试结束时清空）
+func setRules(t *testing.T, list ...Rule) {
+	t.Helper()
+	rulesOnce.Do(func() {})
+	for i := range list {
+		if list[i].Type == RuleRegexReplace {
+			list[i].re = regexp.MustCompile(list[i].Pattern)
+		}
+	}
+	rules = list
+	t.Cleanup(func() { rules = nil })
+}
+
+// streamInChunks 以固定大小的 chunk 流式处理 text
+func streamInChunks(p *StreamProcessor, text string, size int) string {
+	var out strings.Builder
+	for len(text) > 0 {
+		n := min(size, len(text))
+		out.WriteString(p.Write(text[:n]))
+		text = text[n:]
+	}
+	out.WriteString(p.Finish())
+	return out.String()
+}
+
+func TestStreamMatchesFullTextForNonIdempotentRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		text  string
+	}{
+		{
+			// 替换结果仍然匹配规则：保留区重复执行时会不断增长
+			name:  "growing replacement",
+			rules: []Rule{{Type: RuleRegexReplace, Pattern: `cat`, Replacement: "cat cat"}},
+			text:  strings.Repeat("the cat sat on the mat. ", 60),
+		},
+		{
+			name:  "counter-like append",
+			rules: []Rule{{Type: RuleRegexReplace, Pattern: `(\d+)\.`, Replacement: "$1.0."}},
+			text:  strings.Repeat("version 1. and 22. ", 50),
+		},
+		{
+			name: "chained rules",
+			rules: []Rule{
+				{Type: RuleRegexReplace, Pattern: `foo`, Replacement: "foo bar"},
+				{Type: RuleRegexReplace, Pattern: `bar`, Replacement: "[bar]"},
+				{Type: RuleCollapseBlankLines},
+			},
+			text: strings.Repeat("foo\n\n\n\nbar ", 80),
+		},
+		{
+			name:  "prefix strip once",
+			rules: []Rule{{Type: RulePrefixStrip, Value: "ab"}, {Type: RuleSuffixStrip, Value: "END"}},
+			text:  strings.Repeat("ab", 200) + "ENDEND",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRules(t, tt.rules...)
+			want, _ := Apply("m", tt.text, false)
+			for _, size := range []int{1, 3, 7, 64, 255, 256, 300, len(tt.text)} {
+				got := streamInChunks(NewStreamProcessor("m"), tt.text, size)
+				if got != want {
+					t.Fatalf("chunk size %d: stream output differs from full-text processing\n got: %.120q...\nwant: %.120q...", size, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamCatchesMatchAcrossChunks(t *testing.T) {
+	setRules(t, Rule{Type: RuleRegexReplace, Pattern: `WATERMARK-\d+`, Replacement: ""})
+	text := strings.Repeat("x", 400) + "WATERMARK-12345" + strings.Repeat("y", 400)
+	p := NewStreamProcessor("m")
+	got := streamInChunks(p, text, 5)
+	if strings.Contains(got, "WATERMARK") {
+		t.Errorf("watermark spanning chunks was not removed")
+	}
+	if p.Applied() != 1 {
+		t.Errorf("applied = %d, want 1", p.Applied())
+	}
+}
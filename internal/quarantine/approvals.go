@@ -0,0 +1,139 @@
+package quarantine
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/utils"
+)
+
+// 审批结果
+const (
+	OutcomeApproved = "approved"
+	OutcomeRejected = "rejected"
+	OutcomeTimeout  = "timeout"
+)
+
+// ErrNotPending 审批不存在或已结束
+var ErrNotPending = errors.New("approval not found or already decided")
+
+// Pending 等待审批的工具调用（响应在审批结束前挂起）
+type Pending struct {
+	ID        string                     `json:"id"`
+	CreatedAt time.Time                  `json:"createdAt"`
+	ExpiresAt time.Time                  `json:"expiresAt"`
+	Model     string                     `json:"model"`
+	Tenant    string                     `json:"tenant,omitempty"`
+	ToolCalls []converter.OpenAIToolCall `json:"toolCalls"`
+	Hits      []Hit                      `json:"hits"`
+
+	decided chan bool
+}
+
+// approvalQueue 待审批队列
+type approvalQueue struct {
+	mu      sync.Mutex
+	pending map[string]*Pending
+}
+
+func newApprovalQueue() *approvalQueue {
+	return &approvalQueue{pending: make(map[string]*Pending)}
+}
+
+func (q *approvalQueue) add(p *Pending) {
+	q.mu.Lock()
+	q.pending[p.ID] = p
+	q.mu.Unlock()
+}
+
+func (q *approvalQueue) remove(id string) {
+	q.mu.Lock()
+	delete(q.pending, id)
+	q.mu.Unlock()
+}
+
+// list 待审批列表（按创建时间排序）
+func (q *approvalQueue) list() []*Pending {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	list := make([]*Pending, 0, len(q.pending))
+	for _, p := range q.pending {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// resolve 结束审批（只有第一次生效）
+func (q *approvalQueue) resolve(id string, approve bool) error {
+	q.mu.Lock()
+	p, ok := q.pending[id]
+	if ok {
+		delete(q.pending, id)
+	}
+	q.mu.Unlock()
+
+	if !ok {
+		return ErrNotPending
+	}
+	p.decided <- approve
+	return nil
+}
+
+// Review 检查工具调用；命中 approve 规则时挂起直到管理员审批、超时或客户端断开（超时和断开视为拒绝）
+func (e *Engine) Review(ctx context.Context, model, tenant string, calls []converter.OpenAIToolCall) Decision {
+	decision := e.Check(calls)
+	if decision.Action != ActionApprove {
+		return decision
+	}
+
+	e.mu.RLock()
+	timeout := e.approvalTimeout
+	e.mu.RUnlock()
+
+	now := time.Now()
+	p := &Pending{
+		ID:        utils.GenerateSecureToken(12),
+		CreatedAt: now,
+		ExpiresAt: now.Add(timeout),
+		Model:     model,
+		Tenant:    tenant,
+		ToolCalls: calls,
+		Hits:      decision.Hits,
+		decided:   make(chan bool, 1),
+	}
+	e.approvals.add(p)
+	logger.Warn("Tool call held for approval %s (model %s): %v", p.ID, model, decision.Labels())
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case approved := <-p.decided:
+		if approved {
+			decision.Outcome = OutcomeApproved
+		} else {
+			decision.Outcome = OutcomeRejected
+		}
+	case <-timer.C:
+		decision.Outcome = OutcomeTimeout
+	case <-ctx.Done():
+		decision.Outcome = OutcomeRejected
+	}
+	e.approvals.remove(p.ID)
+
+	decision.Blocked = decision.Outcome != OutcomeApproved
+	logger.Info("Tool call approval %s: %s", p.ID, decision.Outcome)
+	return decision
+}
+
+// Resolve 管理员审批
+func (e *Engine) Resolve(id string, approve bool) error {
+	return e.approvals.resolve(id, approve)
+}
@@ -0,0 +1,428 @@
+// Package quarantine 工具调用隔离：按规则检查模型返回的工具调用（外发 URL、长 base64、密钥格式等），
+// 命中后阻止、标记或等待人工审批
+package quarantine
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/logger"
+)
+
+// 规则动作（按严重程度从低到高）
+const (
+	ActionFlag    = "flag"    // 放行，在响应扩展字段和日志中标记
+	ActionApprove = "approve" // 挂起响应，等待管理员审批
+	ActionBlock   = "block"   // 替换为拒绝消息，finish_reason 为 content_filter
+)
+
+// RefusalMessage 工具调用被阻止时返回的内容
+const RefusalMessage = "The requested tool call was blocked by the server's tool call policy."
+
+// reloadInterval 检查规则文件变更的最小间隔
+const reloadInterval = 5 * time.Second
+
+// defaultApprovalTimeout 审批等待时间（超时视为拒绝）
+const defaultApprovalTimeout = 5 * time.Minute
+
+// RuleFile 规则文件格式（data/quarantine.json）
+type RuleFile struct {
+	ApprovalTimeoutSeconds int    `json:"approvalTimeoutSeconds,omitempty"`
+	Rules                  []Rule `json:"rules"`
+}
+
+// Rule 单条规则：工具名匹配且任一检测条件命中时生效
+type Rule struct {
+	Name   string   `json:"name"`
+	Action string   `json:"action"`          // flag、approve、block
+	Tools  []string `json:"tools,omitempty"` // 工具名通配符（path.Match），为空匹配所有工具
+
+	URLAllowlist    []string `json:"urlAllowlist,omitempty"`    // 参数中出现不在列表内的 URL 时命中（域名同时匹配子域名）
+	Base64MinLength int      `json:"base64MinLength,omitempty"` // 参数中出现不短于该长度的 base64 串时命中
+	Secrets         bool     `json:"secrets,omitempty"`         // 参数中出现常见密钥格式时命中
+	Patterns        []string `json:"patterns,omitempty"`        // 参数匹配任一正则时命中
+}
+
+// compiledRule 编译后的规则
+type compiledRule struct {
+	Rule
+	patterns []*regexp.Regexp
+}
+
+// Hit 一次规则命中
+type Hit struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	Tool   string `json:"tool"`
+	Reason string `json:"reason"`
+}
+
+// Decision 对一组工具调用的处理结果
+type Decision struct {
+	Action  string // 命中规则中最严重的动作，未命中时为空
+	Hits    []Hit
+	Blocked bool   // 工具调用不得输出（block 规则，或审批被拒绝、超时）
+	Outcome string // 审批结果：approved、rejected、timeout
+}
+
+// Labels 日志和响应扩展字段中的标记（rule:action）
+func (d Decision) Labels() []string {
+	labels := make([]string, 0, len(d.Hits))
+	seen := make(map[string]bool)
+	for _, h := range d.Hits {
+		label := h.Rule + ":" + h.Action
+		if h.Action == ActionApprove && d.Outcome != "" {
+			label += ":" + d.Outcome
+		}
+		if !seen[label] {
+			seen[label] = true
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+var (
+	urlPattern     = regexp.MustCompile(`https?://[^\s"'<>\\` + "`" + `]+`)
+	secretPatterns = map[string]*regexp.Regexp{
+		"aws_access_key": regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		"github_token":   regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+		"api_key":        regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{20,}`),
+		"slack_token":    regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9\-]{10,}`),
+		"google_api_key": regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`),
+		"private_key":    regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+		"jwt":            regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`),
+	}
+)
+
+// Engine 隔离规则引擎（规则文件变更后自动重新加载）
+type Engine struct {
+	mu              sync.RWMutex
+	filePath        string
+	modTime         time.Time
+	lastCheck       time.Time
+	rules           []compiledRule
+	approvalTimeout time.Duration
+
+	statsMu  sync.Mutex
+	checks   int
+	hits     map[string]int // 按规则统计命中次数
+	byAction map[string]int
+
+	approvals *approvalQueue
+}
+
+var (
+	engine     *Engine
+	engineOnce sync.Once
+)
+
+// Get 获取隔离引擎单例
+func Get() *Engine {
+	engineOnce.Do(func() {
+		engine = &Engine{
+			filePath:        filepath.Join(config.Get().DataDir, "quarantine.json"),
+			approvalTimeout: defaultApprovalTimeout,
+			hits:            make(map[string]int),
+			byAction:        make(map[string]int),
+			approvals:       newApprovalQueue(),
+		}
+		engine.reloadIfChanged()
+	})
+	return engine
+}
+
+// reloadIfChanged 规则文件修改时间变化时重新加载
+func (e *Engine) reloadIfChanged() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.lastCheck.IsZero() && time.Since(e.lastCheck) < reloadInterval {
+		return
+	}
+	e.lastCheck = time.Now()
+
+	info, err := os.Stat(e.filePath)
+	if err != nil {
+		if !e.modTime.IsZero() {
+			// 规则文件被删除，清空规则
+			e.modTime = time.Time{}
+			e.rules = nil
+			e.approvalTimeout = defaultApprovalTimeout
+		}
+		return
+	}
+	if info.ModTime().Equal(e.modTime) {
+		return
+	}
+
+	data, err := os.ReadFile(e.filePath)
+	if err != nil {
+		return
+	}
+
+	var file RuleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		logger.Warn("Invalid quarantine rules %s: %v", e.filePath, err)
+		return
+	}
+
+	rules := make([]compiledRule, 0, len(file.Rules))
+	for i, rule := range file.Rules {
+		if rule.Name == "" {
+			rule.Name = "rule" + strconv.Itoa(i+1)
+		}
+		switch rule.Action {
+		case ActionFlag, ActionApprove, ActionBlock:
+		default:
+			logger.Warn("Invalid quarantine action %q in rule %s, using flag", rule.Action, rule.Name)
+			rule.Action = ActionFlag
+		}
+		compiled := compiledRule{Rule: rule}
+		for _, p := range rule.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				logger.Warn("Invalid quarantine pattern in %s: %v", rule.Name, err)
+				continue
+			}
+			compiled.patterns = append(compiled.patterns, re)
+		}
+		rules = append(rules, compiled)
+	}
+
+	e.rules = rules
+	e.approvalTimeout = defaultApprovalTimeout
+	if file.ApprovalTimeoutSeconds > 0 {
+		e.approvalTimeout = time.Duration(file.ApprovalTimeoutSeconds) * time.Second
+	}
+	e.modTime = info.ModTime()
+
+	logger.Info("Loaded %d quarantine rules", len(rules))
+}
+
+// Enabled 是否配置了规则
+func (e *Engine) Enabled() bool {
+	e.reloadIfChanged()
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.rules) > 0
+}
+
+// Check 检查工具调用，返回命中的规则（不等待审批）
+func (e *Engine) Check(calls []converter.OpenAIToolCall) Decision {
+	e.reloadIfChanged()
+
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	var decision Decision
+	if len(rules) == 0 || len(calls) == 0 {
+		return decision
+	}
+
+	for _, call := range calls {
+		text := argumentText(call.Function.Arguments)
+		for _, rule := range rules {
+			if !matchTool(rule.Tools, call.Function.Name) {
+				continue
+			}
+			if reason := rule.match(text); reason != "" {
+				decision.Hits = append(decision.Hits, Hit{
+					Rule:   rule.Name,
+					Action: rule.Action,
+					Tool:   call.Function.Name,
+					Reason: reason,
+				})
+				if severity(rule.Action) > severity(decision.Action) {
+					decision.Action = rule.Action
+				}
+			}
+		}
+	}
+
+	decision.Blocked = decision.Action == ActionBlock
+	e.record(decision)
+	return decision
+}
+
+// match 返回命中原因，未命中时为空
+func (r *compiledRule) match(text string) string {
+	if len(r.URLAllowlist) > 0 {
+		for _, raw := range urlPattern.FindAllString(text, -1) {
+			u, err := url.Parse(raw)
+			if err != nil || !hostAllowed(u.Hostname(), r.URLAllowlist) {
+				return "url not on allowlist: " + truncate(raw, 100)
+			}
+		}
+	}
+	if r.Base64MinLength > 0 {
+		if n := longestBase64Run(text); n >= r.Base64MinLength {
+			return "base64 blob of " + strconv.Itoa(n) + " chars"
+		}
+	}
+	if r.Secrets {
+		names := make([]string, 0, len(secretPatterns))
+		for name := range secretPatterns {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if secretPatterns[name].MatchString(text) {
+				return "secret format: " + name
+			}
+		}
+	}
+	for _, re := range r.patterns {
+		if re.MatchString(text) {
+			return "pattern: " + re.String()
+		}
+	}
+	return ""
+}
+
+// record 更新命中统计
+func (e *Engine) record(decision Decision) {
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+
+	e.checks++
+	for _, h := range decision.Hits {
+		e.hits[h.Rule]++
+	}
+	if decision.Action != "" {
+		e.byAction[decision.Action]++
+	}
+}
+
+// Stats 获取规则命中统计和待审批列表
+func (e *Engine) Stats() map[string]interface{} {
+	e.statsMu.Lock()
+	hits := make(map[string]int, len(e.hits))
+	for k, v := range e.hits {
+		hits[k] = v
+	}
+	byAction := make(map[string]int, len(e.byAction))
+	for k, v := range e.byAction {
+		byAction[k] = v
+	}
+	checks := e.checks
+	e.statsMu.Unlock()
+
+	e.mu.RLock()
+	rules := make([]Rule, 0, len(e.rules))
+	for _, r := range e.rules {
+		rules = append(rules, r.Rule)
+	}
+	timeout := e.approvalTimeout
+	e.mu.RUnlock()
+
+	return map[string]interface{}{
+		"rules":                  rules,
+		"checks":                 checks,
+		"hits":                   hits,
+		"byAction":               byAction,
+		"approvalTimeoutSeconds": int(timeout.Seconds()),
+		"pending":                e.approvals.list(),
+	}
+}
+
+// argumentText 提取参数 JSON 中的所有字符串值（还原转义，便于匹配 URL 等），无法解析时使用原文
+func argumentText(arguments string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(arguments), &v); err != nil {
+		return arguments
+	}
+	var b strings.Builder
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch val := v.(type) {
+		case string:
+			b.WriteString(val)
+			b.WriteByte('\n')
+		case []interface{}:
+			for _, item := range val {
+				walk(item)
+			}
+		case map[string]interface{}:
+			for _, item := range val {
+				walk(item)
+			}
+		}
+	}
+	walk(v)
+	return b.String()
+}
+
+// matchTool 工具名匹配任一通配符（列表为空时匹配所有工具）
+func matchTool(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hostAllowed 主机名等于列表中的域名或为其子域名
+func hostAllowed(host string, allowlist []string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range allowlist {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "*."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// longestBase64Run 最长的连续 base64（含 URL 安全字符）长度
+func longestBase64Run(text string) int {
+	longest, run := 0, 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/' || c == '=' || c == '-' || c == '_' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
+
+func severity(action string) int {
+	switch action {
+	case ActionFlag:
+		return 1
+	case ActionApprove:
+		return 2
+	case ActionBlock:
+		return 3
+	}
+	return 0
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,453 @@
+// Package selftest 安装自检：依次检查配置、数据文件、账号 Token、端点连通性和一次完整的生成请求，
+// 供 selftest 子命令和 POST /admin/selftest 使用
+package selftest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/api"
+	_ "anti2api-golang/internal/auth" // 注册 OAuth、服务账号凭证实现（Token 刷新）
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/store"
+)
+
+// 检查阶段（按执行顺序）
+const (
+	StageConfig    = "config"
+	StageStore     = "store"
+	StageToken     = "token"
+	StageEndpoints = "endpoints"
+	StageGenerate  = "generate"
+	StageStream    = "stream"
+)
+
+// Stages 所有阶段（按执行顺序）
+var Stages = []string{StageConfig, StageStore, StageToken, StageEndpoints, StageGenerate, StageStream}
+
+// 阶段结果状态
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+// 默认值
+const (
+	DefaultStageTimeout = 30 * time.Second
+	DefaultModel        = "gemini-3-flash"
+)
+
+// Options 自检选项
+type Options struct {
+	Skip         map[string]bool // 跳过的阶段
+	StageTimeout time.Duration   // 单个阶段的时间上限，0 为 DefaultStageTimeout
+	Model        string          // 生成测试使用的模型，为空时使用 DefaultModel
+}
+
+// StageResult 单个阶段的结果
+type StageResult struct {
+	Stage      string `json:"stage"`
+	Status     string `json:"status"`
+	Message    string `json:"message"`
+	Hint       string `json:"hint,omitempty"` // 失败时的处理建议
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Report 自检报告
+type Report struct {
+	Passed bool          `json:"passed"` // 没有失败的阶段
+	Stages []StageResult `json:"stages"`
+}
+
+// ExitCode 报告对应的进程退出码
+func (r *Report) ExitCode() int {
+	if r.Passed {
+		return 0
+	}
+	return 1
+}
+
+// ValidStage 是否为有效的阶段名
+func ValidStage(name string) bool {
+	for _, stage := range Stages {
+		if stage == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runner 自检过程中各阶段共享的状态
+type runner struct {
+	opts Options
+
+	mu         sync.Mutex
+	account    *store.Account // token 阶段选定的账号，供生成测试使用
+	accountErr string         // token 阶段失败的原因（生成测试据此跳过）
+	tokenDone  bool           // token 阶段已结束（超时后仍在运行的检查不再修改结果）
+}
+
+// setAccount 记录 token 阶段的结果
+func (r *runner) setAccount(account *store.Account, errMsg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.tokenDone {
+		r.account, r.accountErr = account, errMsg
+	}
+}
+
+// Run 按顺序执行各阶段，每个阶段完成后调用 progress（可为 nil）
+func Run(ctx context.Context, opts Options, progress func(StageResult)) *Report {
+	if opts.StageTimeout <= 0 {
+		opts.StageTimeout = DefaultStageTimeout
+	}
+	if opts.Model == "" {
+		opts.Model = DefaultModel
+	}
+
+	r := &runner{opts: opts}
+	checks := map[string]func(ctx context.Context) StageResult{
+		StageConfig:    r.checkConfig,
+		StageStore:     r.checkStore,
+		StageToken:     r.checkToken,
+		StageEndpoints: r.checkEndpoints,
+		StageGenerate:  r.checkGenerate,
+		StageStream:    r.checkStream,
+	}
+
+	report := &Report{Passed: true}
+	for _, stage := range Stages {
+		var result StageResult
+		if opts.Skip[stage] {
+			result = StageResult{Status: StatusSkip, Message: "skipped by request"}
+		} else {
+			result = r.runStage(ctx, checks[stage])
+		}
+		result.Stage = stage
+		if stage == StageToken {
+			r.mu.Lock()
+			r.tokenDone = true
+			if result.Status == StatusFail && r.accountErr == "" {
+				r.accountErr = result.Message
+			}
+			r.mu.Unlock()
+		}
+		if result.Status == StatusFail {
+			report.Passed = false
+		}
+		report.Stages = append(report.Stages, result)
+		if progress != nil {
+			progress(result)
+		}
+	}
+	return report
+}
+
+// runStage 在时间上限内执行一个阶段（超时后不再等待该阶段结束）
+func (r *runner) runStage(ctx context.Context, check func(ctx context.Context) StageResult) StageResult {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.StageTimeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan StageResult, 1)
+	go func() { done <- check(ctx) }()
+
+	var result StageResult
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result = fail(fmt.Sprintf("timed out after %s", r.opts.StageTimeout),
+			"Check network access and PROXY, or raise the stage timeout")
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result
+}
+
+func pass(format string, args ...interface{}) StageResult {
+	return StageResult{Status: StatusPass, Message: fmt.Sprintf(format, args...)}
+}
+
+func fail(message, hint string) StageResult {
+	return StageResult{Status: StatusFail, Message: message, Hint: hint}
+}
+
+func skip(message string) StageResult {
+	return StageResult{Status: StatusSkip, Message: message}
+}
+
+// checkConfig 检查必要配置和数据目录是否可写
+func (r *runner) checkConfig(ctx context.Context) StageResult {
+	cfg := config.Get()
+	var problems, warnings []string
+	if cfg.PanelPassword == "" {
+		problems = append(problems, "PANEL_PASSWORD is not set")
+	}
+	if cfg.APIKey == "" && len(store.GetTenantStore().List()) == 0 {
+		warnings = append(warnings, "API_KEY is not set, the API accepts requests without a key")
+	}
+	if cfg.Timeout <= 0 {
+		problems = append(problems, "TIMEOUT must be positive")
+	}
+	if cfg.RetryMaxAttempts < 1 {
+		problems = append(problems, "RETRY_MAX_ATTEMPTS must be at least 1")
+	}
+	if len(configuredEndpoints()) == 0 {
+		problems = append(problems, fmt.Sprintf("ENDPOINT_MODE %q does not select any endpoint", config.GetEndpointManager().GetMode()))
+	}
+	if err := checkWritable(cfg.DataDir); err != nil {
+		problems = append(problems, fmt.Sprintf("DATA_DIR %s is not writable: %v", cfg.DataDir, err))
+	}
+
+	if len(problems) > 0 {
+		return fail(strings.Join(problems, "; "), "Fix the listed settings in .env or the environment and restart")
+	}
+	result := pass("data dir %s, endpoint mode %s", cfg.DataDir, config.GetEndpointManager().GetMode())
+	if len(warnings) > 0 {
+		result.Message += " (warning: " + strings.Join(warnings, "; ") + ")"
+	}
+	return result
+}
+
+// checkWritable 在目录中创建并删除临时文件
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// checkStore 检查账号文件能否读取以及是否有启用的账号
+func (r *runner) checkStore(ctx context.Context) StageResult {
+	accountStore := store.GetAccountStore()
+	if err := accountStore.LoadError(); err != nil {
+		return fail(fmt.Sprintf("accounts.json could not be read: %v", err),
+			"Restore accounts.json from its .bak copy or a backup (POST /admin/restore)")
+	}
+
+	total := accountStore.Count(context.Background())
+	enabled := accountStore.EnabledCount()
+	if total == 0 {
+		return fail("no accounts configured", "Authorize an account in the panel or import a TOML file")
+	}
+	if enabled == 0 {
+		return fail(fmt.Sprintf("all %d accounts are disabled", total),
+			"Enable an account in the panel; check its note for the reason it was disabled")
+	}
+	return pass("%d accounts, %d enabled", total, enabled)
+}
+
+// checkToken 刷新一个启用账号的 Token
+func (r *runner) checkToken(ctx context.Context) StageResult {
+	accountStore := store.GetAccountStore()
+	for _, acc := range accountStore.GetAll(context.Background()) {
+		if !acc.Enable {
+			continue
+		}
+		if acc.CredentialType() == store.CredentialStatic {
+			// 静态 Token 无法刷新，只检查是否过期
+			if acc.IsExpired() {
+				r.setAccount(nil, "the selected account's static token has expired")
+				return fail(fmt.Sprintf("static access token of %s has expired", accountName(&acc.Account)),
+					"Replace the account's access token")
+			}
+		} else if err := accountStore.RefreshAccount(context.Background(), acc.Index); err != nil {
+			r.setAccount(nil, "token refresh failed")
+			return fail(fmt.Sprintf("token refresh for %s failed: %v", accountName(&acc.Account), err),
+				"Re-authorize the account in the panel; if every account fails, check PROXY and access to oauth2.googleapis.com")
+		}
+
+		account, err := r.lookupAccount(&acc.Account)
+		if err != nil {
+			r.setAccount(nil, err.Error())
+			return fail(err.Error(), "Re-authorize the account in the panel")
+		}
+		r.setAccount(account, "")
+		return pass("token for %s is valid until %s", accountName(account),
+			time.UnixMilli(account.Timestamp).Add(time.Duration(account.ExpiresIn)*time.Second).Format(time.RFC3339))
+	}
+
+	r.setAccount(nil, "no enabled account")
+	return fail("no enabled account to test", "Enable or add an account")
+}
+
+// lookupAccount 按 email 或 projectId 获取账号（含刷新后的 Token）
+func (r *runner) lookupAccount(acc *store.Account) (*store.Account, error) {
+	accountStore := store.GetAccountStore()
+	if acc.Email != "" {
+		return accountStore.GetTokenByEmail(context.Background(), acc.Email)
+	}
+	return accountStore.GetTokenByProjectID(context.Background(), acc.ProjectID)
+}
+
+func accountName(acc *store.Account) string {
+	if acc.Email != "" {
+		return acc.Email
+	}
+	return acc.ProjectID
+}
+
+// testAccount 生成测试使用的账号：token 阶段选定的账号，跳过 token 阶段时按正常轮询选择
+func (r *runner) testAccount(ctx context.Context) (*store.Account, string) {
+	r.mu.Lock()
+	account, errMsg := r.account, r.accountErr
+	r.mu.Unlock()
+	if account != nil {
+		return account, ""
+	}
+	if errMsg != "" {
+		return nil, "requires a working account (" + errMsg + ")"
+	}
+	account, err := store.GetAccountStore().GetToken(ctx)
+	if err != nil {
+		return nil, "requires a working account (" + err.Error() + ")"
+	}
+	return account, ""
+}
+
+// configuredEndpoints 当前端点模式会使用的端点
+func configuredEndpoints() []string {
+	manager := config.GetEndpointManager()
+	mode := manager.GetMode()
+	switch mode {
+	case "round-robin":
+		return config.RoundRobinEndpoints
+	case "round-robin-dp":
+		return config.RoundRobinDpEndpoints
+	case config.EndpointModeWeighted:
+		var keys []string
+		for key, weight := range manager.GetWeights() {
+			if weight > 0 {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	if _, ok := config.APIEndpoints[mode]; ok {
+		return []string{mode}
+	}
+	return nil
+}
+
+// checkEndpoints 检查当前端点模式使用的每个端点是否可达
+func (r *runner) checkEndpoints(ctx context.Context) StageResult {
+	keys := configuredEndpoints()
+	if len(keys) == 0 {
+		return fail("no endpoint is configured", "Set ENDPOINT_MODE to daily, autopush, production, round-robin or round-robin-dp")
+	}
+
+	var reachable, unreachable []string
+	for _, key := range keys {
+		latency, status, err := api.ProbeEndpoint(ctx, config.APIEndpoints[key])
+		if err != nil {
+			unreachable = append(unreachable, fmt.Sprintf("%s (%v)", key, err))
+			continue
+		}
+		reachable = append(reachable, fmt.Sprintf("%s %dms (HTTP %d)", key, latency.Milliseconds(), status))
+	}
+
+	if len(unreachable) > 0 {
+		return fail("unreachable: "+strings.Join(unreachable, ", "),
+			"Check DNS, firewall and PROXY settings, or switch ENDPOINT_MODE to a reachable endpoint")
+	}
+	return pass("%s", strings.Join(reachable, ", "))
+}
+
+// testRequest 生成测试的请求（经过完整的请求转换）
+func (r *runner) testRequest(account *store.Account, stream bool) *converter.AntigravityRequest {
+	req := &converter.OpenAIChatRequest{
+		Model:     r.opts.Model,
+		Stream:    stream,
+		MaxTokens: 16,
+		Messages: []converter.OpenAIMessage{
+			{Role: "user", Content: "Reply with the single word OK."},
+		},
+	}
+	return converter.ConvertOpenAIToAntigravity(req, account)
+}
+
+// checkGenerate 发送一次非流式生成请求
+func (r *runner) checkGenerate(ctx context.Context) StageResult {
+	account, reason := r.testAccount(ctx)
+	if account == nil {
+		return skip(reason)
+	}
+
+	antigravityReq := r.testRequest(account, false)
+	resp, err := api.GenerateContent(ctx, antigravityReq, account)
+	if err != nil {
+		return fail(fmt.Sprintf("generation with %s failed: %v", r.opts.Model, err), generationHint(err))
+	}
+	openAIResp := converter.ConvertToOpenAIResponse(resp, r.opts.Model, antigravityReq.Request.Tools)
+	if len(openAIResp.Choices) == 0 || openAIResp.Choices[0].Message.Content == "" {
+		return fail(fmt.Sprintf("%s returned an empty response", r.opts.Model),
+			"Try another model; if every model is empty the account may be restricted")
+	}
+	return pass("%s replied %q via %s", r.opts.Model, truncate(openAIResp.Choices[0].Message.Content), accountName(account))
+}
+
+// checkStream 发送一次流式生成请求
+func (r *runner) checkStream(ctx context.Context) StageResult {
+	account, reason := r.testAccount(ctx)
+	if account == nil {
+		return skip(reason)
+	}
+
+	resp, err := api.GenerateContentStream(ctx, r.testRequest(account, true), account)
+	if err != nil {
+		return fail(fmt.Sprintf("streaming generation with %s failed: %v", r.opts.Model, err), generationHint(err))
+	}
+
+	var content strings.Builder
+	chunks := 0
+	_, err = api.ProcessStreamResponse(ctx, resp, func(chunk api.StreamChunk) {
+		if chunk.Type == "text" {
+			chunks++
+			content.WriteString(chunk.Content)
+		}
+	})
+	if err != nil {
+		return fail(fmt.Sprintf("stream ended with an error: %v", err),
+			"A proxy or load balancer may be buffering or cutting server-sent events; check STREAM_WRITE_TIMEOUT and proxy settings")
+	}
+	if content.Len() == 0 {
+		return fail("stream completed without content", "Try another model; check that the proxy does not strip text/event-stream bodies")
+	}
+	return pass("received %d chunks: %q", chunks, truncate(content.String()))
+}
+
+// generationHint 按上游错误给出处理建议
+func generationHint(err error) string {
+	switch api.ErrorStatus(err) {
+	case 401:
+		return "The upstream rejected the credentials; re-authorize the account"
+	case 403:
+		return "The account is not allowed to use this API or project; check the account's projectId"
+	case 404:
+		return "The model was not found; pass a model from GET /v1/models"
+	case 429:
+		return "The account is out of quota; wait for the quota to reset or add accounts"
+	}
+	return "Check the endpoint stage and the server log for details"
+}
+
+func truncate(s string) string {
+	s = strings.TrimSpace(s)
+	if r := []rune(s); len(r) > 40 {
+		return string(r[:40]) + "…"
+	}
+	return s
+}
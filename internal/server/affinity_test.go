@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// affinityResponse GET /admin/affinity 的响应
+type affinityResponse struct {
+	Stats    store.AffinityStats `json:"stats"`
+	Bindings []struct {
+		Key       string `json:"key"`
+		AccountID string `json:"accountId"`
+		Email     string `json:"email"`
+		Hits      int    `json:"hits"`
+	} `json:"bindings"`
+}
+
+func getAffinity(t *testing.T, url string) affinityResponse {
+	t.Helper()
+	status, body := adminRequest(t, url, http.MethodGet, "/admin/affinity", "")
+	if status != http.StatusOK {
+		t.Fatalf("GET /admin/affinity: %d %s", status, body)
+	}
+	var resp affinityResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestAdminAffinityListsMaskedBindings(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("affinity-one"), testutil.Account("affinity-two"))
+	srv := newTestServer(t)
+	m := store.GetConversationMap()
+	m.Bind("0123456789abcdef-secret", "affinity-one")
+	m.Bind("0123456789abcdef-secret", "affinity-one")
+	m.Bind("fedcba9876543210-secret", "affinity-two")
+	m.Bind("orphan-conversation-key", "deleted-account")
+	t.Cleanup(func() {
+		m.InvalidateAccount("affinity-one", store.UnbindManual)
+		m.InvalidateAccount("affinity-two", store.UnbindManual)
+		m.InvalidateAccount("deleted-account", store.UnbindManual)
+	})
+
+	resp := getAffinity(t, srv.URL)
+	if len(resp.Bindings) != 2 {
+		t.Fatalf("bindings = %+v, want the two bindings of visible accounts", resp.Bindings)
+	}
+	// 最近使用的在前，会话标识只展示前缀，邮箱脱敏
+	first := resp.Bindings[0]
+	if first.Key != "fedcba98" || first.AccountID != "affinity-two" {
+		t.Errorf("first binding = %+v", first)
+	}
+	for _, b := range resp.Bindings {
+		if len(b.Key) != 8 || strings.Contains(b.Key, "secret") {
+			t.Errorf("key %q not masked", b.Key)
+		}
+		if b.Email == "" || strings.Contains(b.Email, "affinity-") {
+			t.Errorf("email %q not masked", b.Email)
+		}
+	}
+	if resp.Bindings[1].Hits != 1 {
+		t.Errorf("hits = %d, want 1", resp.Bindings[1].Hits)
+	}
+	if resp.Stats.Entries < 3 || resp.Stats.MaxEntries == 0 {
+		t.Errorf("stats = %+v", resp.Stats)
+	}
+}
+
+func TestAdminAffinityDelete(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("affinity-del"))
+	srv := newTestServer(t)
+	m := store.GetConversationMap()
+	m.Bind("deadbeef-conversation", "affinity-del")
+	m.Bind("cafebabe-conversation", "affinity-del")
+	t.Cleanup(func() { m.InvalidateAccount("affinity-del", store.UnbindManual) })
+
+	tests := []struct {
+		key    string
+		status int
+	}{
+		{"dead", http.StatusBadRequest},   // 短于展示的前缀
+		{"00000000", http.StatusNotFound}, // 没有匹配的绑定
+		{"deadbeef", http.StatusOK},       // 按展示的前缀解除
+		{"deadbeef", http.StatusNotFound}, // 已解除
+		{"cafebabe-conv", http.StatusOK},  // 更长的前缀
+	}
+	for _, tt := range tests {
+		status, body := adminRequest(t, srv.URL, http.MethodDelete, "/admin/affinity/"+tt.key, "")
+		if status != tt.status {
+			t.Fatalf("DELETE %s: %d %s, want %d", tt.key, status, body, tt.status)
+		}
+		if status == http.StatusOK && !strings.Contains(string(body), `"removed":1`) {
+			t.Errorf("DELETE %s body = %s", tt.key, body)
+		}
+	}
+	if m.Get("deadbeef-conversation") != "" || m.Get("cafebabe-conversation") != "" {
+		t.Fatal("bindings still present after delete")
+	}
+	if len(getAffinity(t, srv.URL).Bindings) != 0 {
+		t.Fatal("deleted bindings listed")
+	}
+}
+
+func TestAdminAffinityRequiresSession(t *testing.T) {
+	srv := newTestServer(t)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		path := "/admin/affinity"
+		if method == http.MethodDelete {
+			path += "/deadbeef"
+		}
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound {
+			t.Errorf("%s %s without session = %d, want redirect to login", method, path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/persist"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// archiveNames 归档中的文件名
+func archiveNames(t *testing.T, data []byte) []string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("backup is not gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+func TestBackupRestoreEndpoints(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("backup-kept"))
+	srv := newTestServer(t)
+
+	status, archive := adminRequest(t, srv.URL, http.MethodPost, "/admin/backup", "")
+	if status != http.StatusOK {
+		t.Fatalf("backup: status %d: %s", status, archive)
+	}
+	if names := archiveNames(t, archive); !strings.Contains(strings.Join(names, ","), "accounts.json") {
+		t.Errorf("backup holds %v, want accounts.json", names)
+	}
+
+	// 备份之后添加的账号在恢复后消失，备份时的账号重新加载
+	if err := store.GetAccountStore().Add(testutil.Account("backup-added")); err != nil {
+		t.Fatal(err)
+	}
+	status, body := adminRequest(t, srv.URL, http.MethodPost, "/admin/restore", string(archive))
+	if status != http.StatusOK {
+		t.Fatalf("restore: status %d: %s", status, body)
+	}
+	var resp struct {
+		Success bool                  `json:"success"`
+		Result  persist.RestoreResult `json:"result"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || !strings.Contains(strings.Join(resp.Result.Reloaded, ","), "accounts.json") {
+		t.Errorf("restore = %s", body)
+	}
+	var emails []string
+	for _, a := range store.GetAccountStore().GetAll(context.Background()) {
+		emails = append(emails, a.Email)
+	}
+	if strings.Join(emails, ",") != "backup-kept@example.com" {
+		t.Errorf("accounts after restore = %v", emails)
+	}
+}
+
+func TestRestoreRejectsInvalidArchive(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("restore-untouched"))
+	srv := newTestServer(t)
+
+	status, body := adminRequest(t, srv.URL, http.MethodPost, "/admin/restore", "not an archive")
+	if status != http.StatusBadRequest {
+		t.Fatalf("status %d: %s", status, body)
+	}
+	if accounts := store.GetAccountStore().GetAll(context.Background()); len(accounts) != 1 {
+		t.Errorf("accounts changed by a rejected restore: %d", len(accounts))
+	}
+}
+
+func TestBackupRequiresAdminSession(t *testing.T) {
+	srv := newTestServer(t)
+	// 未登录时跳转到登录页，不返回归档
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for _, path := range []string{"/admin/backup", "/admin/restore"} {
+		resp, err := client.Post(srv.URL+path, "application/gzip", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound || resp.Header.Get("Content-Type") == "application/gzip" {
+			t.Errorf("%s without a session: status %d", path, resp.StatusCode)
+		}
+	}
+}
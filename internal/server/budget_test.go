@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// useAPIDebugLevel 在测试期间设置 api 组件的日志级别
+func useAPIDebugLevel(t *testing.T, level logger.LogLevel) {
+	t.Helper()
+	previous := logger.GetComponentLevels()
+	levels := logger.GetComponentLevels()
+	levels[logger.ComponentAPI] = level
+	logger.SetComponentLevels(levels)
+	t.Cleanup(func() { logger.SetComponentLevels(previous) })
+}
+
+// upstreamGenerationConfig 上游收到的最后一个请求中的 generationConfig
+func upstreamGenerationConfig(t *testing.T, upstream *testutil.Upstream) map[string]interface{} {
+	t.Helper()
+	requests := upstream.Requests()
+	if len(requests) == 0 {
+		t.Fatal("upstream received no request")
+	}
+	var body struct {
+		Request struct {
+			GenerationConfig map[string]interface{} `json:"generationConfig"`
+		} `json:"request"`
+	}
+	if err := json.Unmarshal(requests[len(requests)-1].Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Request.GenerationConfig
+}
+
+func TestTokenBudgetSentAndCaptured(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("budget-debug"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("Hello")))
+	useAPIDebugLevel(t, logger.LogHigh)
+	srv := newTestServer(t)
+
+	resp, body := postChatJSON(t, srv.URL, `{"model":"claude-sonnet-4-5-thinking","max_completion_tokens":500,"reasoning_effort":"low","messages":[{"role":"user","content":"hi"}]}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, body)
+	}
+	// Claude 把思考计入 max_tokens：500 + 4096
+	gen := upstreamGenerationConfig(t, upstream)
+	thinking, _ := gen["thinkingConfig"].(map[string]interface{})
+	if gen["maxOutputTokens"] != float64(4596) || thinking["thinkingBudget"] != float64(4096) {
+		t.Fatalf("generationConfig = %v", gen)
+	}
+
+	entry := logEntryFor(t, "budget-debug@example.com")
+	status, raw := adminRequest(t, srv.URL, http.MethodGet, "/admin/logs/"+entry.ID, "")
+	if status != http.StatusOK {
+		t.Fatalf("log detail: %d %s", status, raw)
+	}
+	var detail struct {
+		Log struct {
+			Detail struct {
+				TokenBudget map[string]interface{} `json:"tokenBudget"`
+			} `json:"detail"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(raw, &detail); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"answer": float64(500), "thinking": float64(4096), "thinkingSource": "reasoning_effort",
+		"countsThinking": true, "modelLimit": float64(64000), "maxOutputTokens": float64(4596),
+	}
+	got := detail.Log.Detail.TokenBudget
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("tokenBudget.%s = %v, want %v (%v)", k, got[k], v, got)
+		}
+	}
+}
+
+func TestTokenBudgetNotCapturedByDefault(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("budget-quiet"))
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("Hello")))
+	useAPIDebugLevel(t, logger.LogOff)
+	srv := newTestServer(t)
+
+	resp, body := postChatJSON(t, srv.URL, `{"model":"claude-sonnet-4-5-thinking","max_tokens":500,"messages":[{"role":"user","content":"hi"}]}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, body)
+	}
+	entry := store.GetLogStore().GetByID(context.Background(), logEntryFor(t, "budget-quiet@example.com").ID)
+	if entry == nil || entry.Detail == nil {
+		t.Fatal("log detail missing")
+	}
+	if entry.Detail.TokenBudget != nil {
+		t.Fatalf("token budget captured below the high debug level: %v", entry.Detail.TokenBudget)
+	}
+}
+
+func TestInvalidThinkingBudgetRejected(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("budget-invalid"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("Hello")))
+	srv := newTestServer(t)
+
+	resp, body := postChatJSON(t, srv.URL, `{"model":"claude-sonnet-4-5-thinking","thinking_budget":-1,"messages":[{"role":"user","content":"hi"}]}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d %s, want 400", resp.StatusCode, body)
+	}
+	var errResp struct {
+		Error struct {
+			Code  string `json:"code"`
+			Param string `json:"param"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &errResp)
+	if errResp.Error.Param != "thinking_budget" {
+		t.Errorf("error = %s", body)
+	}
+	if len(upstream.Requests()) != 0 {
+		t.Error("invalid request forwarded upstream")
+	}
+}
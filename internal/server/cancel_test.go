@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/testutil"
+)
+
+// slowUpstream 先输出第一段正文，之后每 20ms 输出一段，直到连接被关闭（最多 10 秒）。
+// closed 收到上游看到连接关闭时已经输出的段数
+func slowUpstream(closed chan<- int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: "+testutil.Chunk("", testutil.Text("first"))+"\n\n")
+		w.(http.Flusher).Flush()
+		sent := 1
+		tick := time.NewTicker(20 * time.Millisecond)
+		defer tick.Stop()
+		deadline := time.After(10 * time.Second)
+		for {
+			select {
+			case <-r.Context().Done():
+				closed <- sent
+				return
+			case <-deadline:
+				closed <- -1
+				return
+			case <-tick.C:
+				io.WriteString(w, "data: "+testutil.Chunk("", testutil.Text(" more"))+"\n\n")
+				w.(http.Flusher).Flush()
+				sent++
+			}
+		}
+	}
+}
+
+func TestClientDisconnectClosesUpstream(t *testing.T) {
+	for _, tc := range []struct {
+		name, path, body string
+	}{
+		{"openai", "/v1/chat/completions", streamRequestBody},
+		{"gemini", "/v1beta/models/gemini-2.5-flash:streamGenerateContent?alt=sse", geminiContents},
+		{"raw gemini", "/gemini/v1beta/models/gemini-2.5-flash:streamGenerateContent?alt=sse", geminiContents},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.UseAccounts(t, testutil.Account("cancel-"+strings.ReplaceAll(tc.name, " ", "-")))
+			closed := make(chan int, 1)
+			testutil.StartUpstream(t, slowUpstream(closed))
+			srv := newTestServer(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer "+testAPIKey)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader := bufio.NewReader(resp.Body)
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					t.Fatalf("stream ended before the first chunk: %v", err)
+				}
+				if strings.Contains(line, "first") {
+					break
+				}
+			}
+
+			// 客户端收到第一段后断开，上游连接随即被关闭，而不是读到结束
+			disconnected := time.Now()
+			cancel()
+			resp.Body.Close()
+
+			select {
+			case sent := <-closed:
+				if sent < 0 {
+					t.Fatal("upstream ran until its deadline after the client disconnected")
+				}
+				if elapsed := time.Since(disconnected); elapsed > 2*time.Second {
+					t.Errorf("upstream closed %v after the client disconnected", elapsed)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("upstream body not closed after the client disconnected")
+			}
+		})
+	}
+}
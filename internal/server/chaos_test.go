@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/auth"
+	"anti2api-golang/internal/chaos"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// adminRequest 以超级管理员会话调用管理接口，返回状态码和响应体
+func adminRequest(t *testing.T, url, method, path, body string) (int, []byte) {
+	t.Helper()
+	token := auth.CreateSession("", "root", store.RoleAdmin)
+	defer auth.DeleteSession(token)
+
+	req, _ := http.NewRequest(method, url+path, strings.NewReader(body))
+	req.Header.Set("X-Session-Token", token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+// addChaosRule 通过管理接口添加故障规则，测试结束时清空规则
+func addChaosRule(t *testing.T, url string, rule string) chaos.Rule {
+	t.Helper()
+	t.Cleanup(chaos.Get().Clear)
+	status, body := adminRequest(t, url, http.MethodPost, "/admin/chaos", rule)
+	if status != http.StatusOK {
+		t.Fatalf("add chaos rule: status %d: %s", status, body)
+	}
+	var resp struct {
+		Rule chaos.Rule `json:"rule"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Rule
+}
+
+// upstreamTokens 上游收到的请求使用的 Authorization
+func upstreamTokens(u *testutil.Upstream) []string {
+	var tokens []string
+	for _, r := range u.Requests() {
+		tokens = append(tokens, r.Header.Get("Authorization"))
+	}
+	return tokens
+}
+
+// accountByID 账号存储中的账号
+func accountByID(t *testing.T, id string) store.Account {
+	t.Helper()
+	for _, a := range store.GetAccountStore().GetAll(context.Background()) {
+		if a.ID == id {
+			return a.Account
+		}
+	}
+	t.Fatalf("account %s not found", id)
+	return store.Account{}
+}
+
+func TestChaosRateLimitFailsOverAndCoolsDown(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("chaos-limited"), testutil.Account("chaos-healthy"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+	rule := addChaosRule(t, srv.URL, `{"fault":"status","status":429,"account":"chaos-limited@example.com"}`)
+
+	for i := 0; i < 3; i++ {
+		resp, body := postChat(t, srv.URL, testAPIKey, "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d: %s", i, resp.StatusCode, body)
+		}
+	}
+
+	// 注入的 429 没有到达上游，请求切换到另一个账号；限流的账号暂停选用，之后的请求不再尝试它
+	for _, token := range upstreamTokens(upstream) {
+		if token != "Bearer access-chaos-healthy" {
+			t.Errorf("upstream request with %s", token)
+		}
+	}
+	limited := accountByID(t, "chaos-limited")
+	if !limited.InCooldown(time.Now()) || limited.CooldownReason != store.CooldownRateLimited {
+		t.Errorf("limited account cooldown = %v (%q), want rate limited", limited.CooldownUntil, limited.CooldownReason)
+	}
+
+	status, body := adminRequest(t, srv.URL, http.MethodGet, "/admin/chaos", "")
+	var list struct {
+		Rules []chaos.Rule `json:"rules"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil || status != http.StatusOK {
+		t.Fatalf("list chaos rules: status %d: %s", status, body)
+	}
+	if len(list.Rules) != 1 || list.Rules[0].ID != rule.ID || list.Rules[0].Hits != 1 {
+		t.Errorf("rules = %+v, want %s hit once", list.Rules, rule.ID)
+	}
+}
+
+func TestChaosForbiddenFailsOverOnce(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("chaos-denied"), testutil.Account("chaos-backup"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+	// 只注入一次，之后恢复正常
+	addChaosRule(t, srv.URL, `{"fault":"status","status":403,"account":"chaos-denied@example.com","remaining":1}`)
+
+	resp, body := postChat(t, srv.URL, testAPIKey, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	if tokens := upstreamTokens(upstream); len(tokens) != 1 || tokens[0] != "Bearer access-chaos-backup" {
+		t.Errorf("upstream requests = %v, want one with the backup account", tokens)
+	}
+	denied := accountByID(t, "chaos-denied")
+	if !denied.InCooldown(time.Now()) || denied.CooldownReason != store.CooldownFailover {
+		t.Errorf("denied account cooldown = %v (%q), want failover", denied.CooldownUntil, denied.CooldownReason)
+	}
+	if rules := chaos.Get().List(); len(rules) != 0 {
+		t.Errorf("rule with remaining=1 still listed: %+v", rules)
+	}
+}
+
+func TestChaosServerErrorIsMarked(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("chaos-unavailable"), testutil.Account("chaos-other"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+	addChaosRule(t, srv.URL, `{"fault":"status","status":503}`)
+
+	// 5xx 不是账号的问题，不切换账号也不暂停选用
+	resp, body := postChat(t, srv.URL, testAPIKey, "")
+	if resp.StatusCode != http.StatusServiceUnavailable || !chaos.IsInjected(string(body)) {
+		t.Fatalf("status %d: %s, want a marked 503", resp.StatusCode, body)
+	}
+	if tokens := upstreamTokens(upstream); len(tokens) != 0 {
+		t.Errorf("injected fault reached the upstream: %v", tokens)
+	}
+	for _, id := range []string{"chaos-unavailable", "chaos-other"} {
+		if a := accountByID(t, id); a.InCooldown(time.Now()) {
+			t.Errorf("%s paused after a server error: %q", id, a.CooldownReason)
+		}
+	}
+}
+
+func TestChaosMalformedResponseIsMarked(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("chaos-malformed"))
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+	addChaosRule(t, srv.URL, `{"fault":"malformed"}`)
+
+	resp, body := postChat(t, srv.URL, testAPIKey, "")
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("malformed upstream response succeeded: %s", body)
+	}
+	// 注入的故障带有标记，与真实故障区分
+	if !chaos.IsInjected(string(body)) {
+		t.Errorf("error does not carry the chaos marker: %s", body)
+	}
+}
+
+func TestChaosRuleDelete(t *testing.T) {
+	srv := newTestServer(t)
+	rule := addChaosRule(t, srv.URL, `{"fault":"slow","delayMs":10}`)
+
+	if status, body := adminRequest(t, srv.URL, http.MethodDelete, "/admin/chaos/"+rule.ID, ""); status != http.StatusOK {
+		t.Fatalf("delete: status %d: %s", status, body)
+	}
+	if status, _ := adminRequest(t, srv.URL, http.MethodDelete, "/admin/chaos/"+rule.ID, ""); status != http.StatusNotFound {
+		t.Errorf("deleting a removed rule: status %d, want 404", status)
+	}
+	if status, _ := adminRequest(t, srv.URL, http.MethodPost, "/admin/chaos", `{"fault":"explode"}`); status != http.StatusBadRequest {
+		t.Errorf("unknown fault: status %d, want 400", status)
+	}
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/server/handlers"
+)
+
+// defaultComponentTimeout 组件启动或停止的默认超时
+const defaultComponentTimeout = 10 * time.Second
+
+// 组件状态
+const (
+	ComponentPending  = "pending"
+	ComponentRunning  = "running"
+	ComponentFailed   = "failed"
+	ComponentStopped  = "stopped"
+	ComponentTimedOut = "timeout" // 启动或停止超时（后台可能仍在执行）
+)
+
+// Component 有生命周期的后台组件（Start、Stop 可为 nil）
+type Component struct {
+	Name      string
+	DependsOn []string // 先于本组件启动、后于本组件停止的组件
+	Start     func(ctx context.Context) error
+	Stop      func(ctx context.Context) error
+	Timeout   time.Duration // 启动和停止各自的超时，0 为默认 10 秒
+}
+
+// ComponentStatus 组件状态（面板展示）
+type ComponentStatus struct {
+	Name      string     `json:"name"`
+	DependsOn []string   `json:"dependsOn,omitempty"`
+	State     string     `json:"state"`
+	Error     string     `json:"error,omitempty"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+	StartMs   int64      `json:"startMs"`
+	StoppedAt *time.Time `json:"stoppedAt,omitempty"`
+	StopMs    int64      `json:"stopMs,omitempty"`
+}
+
+type componentEntry struct {
+	Component
+	status ComponentStatus
+}
+
+// Registry 组件注册表：按依赖顺序启动，关闭时逆序停止
+type Registry struct {
+	mu      sync.Mutex
+	entries []*componentEntry
+	started []*componentEntry // 已启动的组件（启动顺序）
+}
+
+// NewRegistry 创建组件注册表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register 注册组件（须在 StartAll 之前）
+func (reg *Registry) Register(c Component) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.entries = append(reg.entries, &componentEntry{
+		Component: c,
+		status:    ComponentStatus{Name: c.Name, DependsOn: c.DependsOn, State: ComponentPending},
+	})
+}
+
+// order 按依赖排序（没有依赖关系的组件保持注册顺序），依赖不存在或循环依赖时返回错误
+func (reg *Registry) order() ([]*componentEntry, error) {
+	byName := make(map[string]*componentEntry, len(reg.entries))
+	for _, e := range reg.entries {
+		if _, dup := byName[e.Name]; dup {
+			return nil, fmt.Errorf("component %q registered twice", e.Name)
+		}
+		byName[e.Name] = e
+	}
+	for _, e := range reg.entries {
+		for _, dep := range e.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("component %q depends on unknown component %q", e.Name, dep)
+			}
+		}
+	}
+
+	ordered := make([]*componentEntry, 0, len(reg.entries))
+	placed := make(map[string]bool, len(reg.entries))
+	for len(ordered) < len(reg.entries) {
+		progressed := false
+		for _, e := range reg.entries {
+			if placed[e.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range e.DependsOn {
+				if !placed[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, e)
+				placed[e.Name] = true
+				progressed = true
+			}
+		}
+		if !progressed {
+			var pending []string
+			for _, e := range reg.entries {
+				if !placed[e.Name] {
+					pending = append(pending, e.Name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle among components %v", pending)
+		}
+	}
+	return ordered, nil
+}
+
+// runWithTimeout 在超时内执行 fn，超时后不再等待（fn 收到的 ctx 已取消）
+func runWithTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if fn == nil {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = defaultComponentTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartAll 按依赖顺序启动所有组件；某个组件启动失败时逆序停止已启动的组件并返回错误
+func (reg *Registry) StartAll(ctx context.Context) error {
+	reg.mu.Lock()
+	ordered, err := reg.order()
+	reg.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range ordered {
+		start := time.Now()
+		err := runWithTimeout(ctx, e.Timeout, e.Start)
+
+		reg.mu.Lock()
+		e.status.StartMs = time.Since(start).Milliseconds()
+		if err != nil {
+			e.status.State, e.status.Error = failureState(err), err.Error()
+			reg.mu.Unlock()
+			logger.Error("Component %s failed to start: %v", e.Name, err)
+			reg.StopAll(context.Background())
+			return fmt.Errorf("start component %s: %w", e.Name, err)
+		}
+		e.status.State = ComponentRunning
+		e.status.StartedAt = &start
+		reg.started = append(reg.started, e)
+		reg.mu.Unlock()
+	}
+	return nil
+}
+
+// StopAll 逆序停止已启动的组件（每个组件单独计时，ctx 为整体期限），返回所有停止错误
+func (reg *Registry) StopAll(ctx context.Context) error {
+	reg.mu.Lock()
+	started := reg.started
+	reg.started = nil
+	reg.mu.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		e := started[i]
+		start := time.Now()
+		err := runWithTimeout(ctx, e.Timeout, e.Stop)
+
+		reg.mu.Lock()
+		e.status.StopMs = time.Since(start).Milliseconds()
+		e.status.StoppedAt = &start
+		if err != nil {
+			e.status.State, e.status.Error = failureState(err), err.Error()
+			errs = append(errs, fmt.Errorf("stop component %s: %w", e.Name, err))
+			logger.Warn("Component %s failed to stop: %v", e.Name, err)
+		} else {
+			e.status.State = ComponentStopped
+		}
+		reg.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+func failureState(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ComponentTimedOut
+	}
+	return ComponentFailed
+}
+
+// Status 所有组件的状态（注册顺序）
+func (reg *Registry) Status() []ComponentStatus {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	result := make([]ComponentStatus, 0, len(reg.entries))
+	for _, e := range reg.entries {
+		result = append(result, e.status)
+	}
+	return result
+}
+
+// handleGetComponents 获取后台组件状态
+func handleGetComponents(reg *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handlers.WriteJSON(w, http.StatusOK, map[string]interface{}{"components": reg.Status()})
+	}
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/monitor"
+)
+
+// lifecycle 记录组件启动和停止的顺序
+type lifecycle struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *lifecycle) record(event string) {
+	l.mu.Lock()
+	l.events = append(l.events, event)
+	l.mu.Unlock()
+}
+
+func (l *lifecycle) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+// component 记录生命周期的测试组件，startErr 非空时启动失败
+func (l *lifecycle) component(name string, startErr error, deps ...string) Component {
+	return Component{
+		Name:      name,
+		DependsOn: deps,
+		Start: func(ctx context.Context) error {
+			l.record("start " + name)
+			return startErr
+		},
+		Stop: func(ctx context.Context) error {
+			l.record("stop " + name)
+			return nil
+		},
+	}
+}
+
+// states 按名称索引的组件状态
+func states(reg *Registry) map[string]string {
+	result := make(map[string]string)
+	for _, s := range reg.Status() {
+		result[s.Name] = s.State
+	}
+	return result
+}
+
+func TestRegistryStartsInDependencyOrderAndStopsInReverse(t *testing.T) {
+	var l lifecycle
+	reg := NewRegistry()
+	// 注册顺序与依赖顺序相反
+	reg.Register(l.component("c", nil, "b"))
+	reg.Register(l.component("b", nil, "a"))
+	reg.Register(l.component("a", nil))
+	reg.Register(l.component("d", nil))
+
+	if err := reg.StartAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.StopAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start a", "start d", "start b", "start c", "stop c", "stop b", "stop d", "stop a"}
+	if got := l.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("lifecycle = %v, want %v", got, want)
+	}
+	for name, state := range states(reg) {
+		if state != ComponentStopped {
+			t.Errorf("%s: state %s, want %s", name, state, ComponentStopped)
+		}
+	}
+}
+
+func TestRegistryStartFailureStopsStartedComponents(t *testing.T) {
+	var l lifecycle
+	reg := NewRegistry()
+	reg.Register(l.component("a", nil))
+	reg.Register(l.component("b", nil, "a"))
+	reg.Register(l.component("broken", errors.New("boom"), "b"))
+	reg.Register(l.component("after", nil, "broken"))
+
+	err := reg.StartAll(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("StartAll = %v, want an error naming the broken component", err)
+	}
+	want := []string{"start a", "start b", "start broken", "stop b", "stop a"}
+	if got := l.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("lifecycle = %v, want %v", got, want)
+	}
+	wantStates := map[string]string{
+		"a": ComponentStopped, "b": ComponentStopped, "broken": ComponentFailed, "after": ComponentPending,
+	}
+	if got := states(reg); !reflect.DeepEqual(got, wantStates) {
+		t.Errorf("states = %v, want %v", got, wantStates)
+	}
+}
+
+func TestRegistryStopTimeout(t *testing.T) {
+	var l lifecycle
+	release := make(chan struct{})
+	defer close(release)
+
+	reg := NewRegistry()
+	reg.Register(l.component("first", nil))
+	stuck := l.component("stuck", nil, "first")
+	stuck.Stop = func(ctx context.Context) error {
+		l.record("stop stuck")
+		<-release // 忽略取消
+		return nil
+	}
+	stuck.Timeout = 20 * time.Millisecond
+	reg.Register(stuck)
+	reg.Register(l.component("last", nil, "stuck"))
+
+	if err := reg.StartAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err := reg.StopAll(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("StopAll = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("StopAll took %v, the stuck component should time out after 20ms", elapsed)
+	}
+	// 超时的组件不影响排在它后面的组件停止
+	want := []string{"start first", "start stuck", "start last", "stop last", "stop stuck", "stop first"}
+	if got := l.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("lifecycle = %v, want %v", got, want)
+	}
+	wantStates := map[string]string{"first": ComponentStopped, "stuck": ComponentTimedOut, "last": ComponentStopped}
+	if got := states(reg); !reflect.DeepEqual(got, wantStates) {
+		t.Errorf("states = %v, want %v", got, wantStates)
+	}
+}
+
+func TestRegistryStartTimeout(t *testing.T) {
+	var l lifecycle
+	reg := NewRegistry()
+	reg.Register(l.component("first", nil))
+	slow := l.component("slow", nil, "first")
+	slow.Start = func(ctx context.Context) error {
+		l.record("start slow")
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	slow.Timeout = 20 * time.Millisecond
+	reg.Register(slow)
+
+	if err := reg.StartAll(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("StartAll = %v, want DeadlineExceeded", err)
+	}
+	want := []string{"start first", "start slow", "stop first"}
+	if got := l.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("lifecycle = %v, want %v", got, want)
+	}
+	if got := states(reg)["slow"]; got != ComponentTimedOut {
+		t.Errorf("slow: state %s, want %s", got, ComponentTimedOut)
+	}
+}
+
+func TestRegistryRejectsBadDependencies(t *testing.T) {
+	for name, components := range map[string][]Component{
+		"unknown":   {{Name: "a", DependsOn: []string{"missing"}}},
+		"cycle":     {{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"a"}}},
+		"duplicate": {{Name: "a"}, {Name: "a"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			started := false
+			reg := NewRegistry()
+			for _, c := range components {
+				c.Start = func(ctx context.Context) error {
+					started = true
+					return nil
+				}
+				reg.Register(c)
+			}
+			if err := reg.StartAll(context.Background()); err == nil {
+				t.Fatal("StartAll should fail")
+			}
+			if started {
+				t.Error("no component should start when the dependency graph is invalid")
+			}
+		})
+	}
+}
+
+// waitStageGone 等待阶段标签下的协程全部退出（任务返回后协程还需要片刻才结束）
+func waitStageGone(t *testing.T, stage string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for monitor.GoroutinesByStage()[stage] > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines still labelled %q after stop", monitor.GoroutinesByStage()[stage], stage)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBackgroundWorkersStopOnShutdown(t *testing.T) {
+	reg := NewRegistry()
+	registerComponents(reg)
+	if err := reg.StartAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 测试环境下默认启动的后台任务（协程设置标签需要片刻）
+	for _, stage := range []string{"deferred", "monitor"} {
+		deadline := time.Now().Add(time.Second)
+		for monitor.GoroutinesByStage()[stage] == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("stage %q is not running after start", stage)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := reg.StopAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, stage := range []string{"deferred", "endpoint-probation", "monitor", "error-alerts", "usage-report", "token-refresh"} {
+		waitStageGone(t, stage)
+	}
+	for name, state := range states(reg) {
+		if state != ComponentStopped {
+			t.Errorf("%s: state %s, want %s", name, state, ComponentStopped)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/testutil"
+)
+
+// chatError 错误响应中的 error 对象
+type chatError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Param   string `json:"param"`
+	Code    string `json:"code"`
+}
+
+func decodeChatError(t *testing.T, body []byte) chatError {
+	t.Helper()
+	var resp struct {
+		Error chatError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return resp.Error
+}
+
+func TestEmptyMessagesRejectedBeforeUpstream(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("content-check"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+
+	bodies := []string{
+		`{"model":"gemini-2.5-flash","messages":[{"role":"user","content":""}]}`,
+		`{"model":"gemini-2.5-flash","stream":true,"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"  \n"}]}`,
+		`{"model":"gemini-2.5-flash","messages":[{"role":"user","content":[{"type":"text","text":" "}]}]}`,
+	}
+	for _, body := range bodies {
+		resp, raw := postChatJSON(t, srv.URL, body, nil)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: status %d %s", body, resp.StatusCode, raw)
+		}
+		e := decodeChatError(t, raw)
+		if e.Type != "invalid_request_error" || e.Code != converter.IssueEmptyMessages || e.Param != "messages" ||
+			!strings.Contains(e.Message, "no usable content in messages") {
+			t.Fatalf("%s: error = %+v", body, e)
+		}
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Fatalf("upstream received %d requests", n)
+	}
+}
+
+func TestTrailingAssistantRejectedUnlessPrefill(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("prefill-check"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text(" here you go")))
+	srv := newTestServer(t)
+	body := `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"Sure,"}]}`
+
+	resp, raw := postChatJSON(t, srv.URL, body, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status %d %s", resp.StatusCode, raw)
+	}
+	if e := decodeChatError(t, raw); e.Type != "invalid_request_error" || e.Code != converter.IssueTrailingAssistant || e.Param != "messages[1]" {
+		t.Fatalf("error = %+v", e)
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Fatalf("upstream received %d requests", n)
+	}
+
+	// 模型配置开启预填充后转发
+	allow := true
+	if err := converter.SetModelConfig("gemini-2.5-flash", converter.ModelConfig{AssistantPrefill: &allow}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { converter.DeleteModelConfig("gemini-2.5-flash") })
+	if resp, raw := postChatJSON(t, srv.URL, body, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("prefill allowed: status %d %s", resp.StatusCode, raw)
+	}
+	if n := len(upstream.Requests()); n != 1 {
+		t.Fatalf("upstream received %d requests", n)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// logEntryFor 等待账号 email 的请求日志写入（日志异步写入）
+func logEntryFor(t *testing.T, email string) store.LogEntry {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		logs, _ := store.GetLogStore().List(context.Background(), 0, 1, store.LogFilter{Email: email})
+		if len(logs) > 0 {
+			return logs[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no log entry for %s", email)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConversionWarningsInResponseAndLog(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("conversion-warn"))
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+
+	resp, body := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","messages":[`+
+		`{"role":"user","content":[{"type":"text","text":"look"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}]}]}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	warnings := completionWarnings(t, body)
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "messages[0].content[1].image_url.url: ") {
+		t.Errorf("warnings = %q, want the dropped image", warnings)
+	}
+	if entry := logEntryFor(t, "conversion-warn@example.com"); len(entry.Warnings) != 1 || entry.Warnings[0] != warnings[0] {
+		t.Errorf("log warnings = %q, want %q", entry.Warnings, warnings)
+	}
+}
+
+func TestConversionErrorIsParamPrecise(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("conversion-error"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+
+	resp, body := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}],`+
+		`"tools":[{"type":"function","function":{"name":"weather"}},{"type":"function","function":{"description":"no name"}}]}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	var e struct {
+		Error struct {
+			Param string `json:"param"`
+			Code  string `json:"code"`
+			Type  string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Error.Param != "tools[1].function.name" || e.Error.Code != "missing_tool_name" || e.Error.Type != "invalid_request_error" {
+		t.Errorf("error = %+v", e.Error)
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Errorf("%d upstream requests for a rejected request", n)
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/testutil"
+)
+
+// sseText 拼接 SSE 响应中的正文和思考增量，返回结束 chunk 中的摘要
+func sseText(t *testing.T, body []byte) (content, reasoning string, digest map[string]string) {
+	t.Helper()
+	var c, r strings.Builder
+	for _, line := range strings.Split(string(body), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || !strings.HasPrefix(data, "{") {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content   string `json:"content"`
+					Reasoning string `json:"reasoning"`
+				} `json:"delta"`
+			} `json:"choices"`
+			ContentDigest map[string]string `json:"content_digest"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("decode %q: %v", data, err)
+		}
+		for _, choice := range chunk.Choices {
+			c.WriteString(choice.Delta.Content)
+			r.WriteString(choice.Delta.Reasoning)
+		}
+		if chunk.ContentDigest != nil {
+			digest = chunk.ContentDigest
+		}
+	}
+	return c.String(), r.String(), digest
+}
+
+func TestStreamContentDigestTrailer(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("digest-stream"))
+	testutil.StartUpstream(t, testutil.Reply("STOP",
+		testutil.Thought("Considering "), testutil.Thought("the question"),
+		testutil.Text("Héllo, "), testutil.Text("wörld 🙂"), testutil.Text("!")))
+	srv := newTestServer(t)
+
+	resp, body := postChatJSON(t, srv.URL, streamRequestBody, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, body)
+	}
+	content, reasoning, digest := sseText(t, body)
+	if content != "Héllo, wörld 🙂!" || reasoning != "Considering the question" {
+		t.Fatalf("content %q, reasoning %q", content, reasoning)
+	}
+	if digest["content"] != api.ContentDigest(content) || digest["reasoning"] != api.ContentDigest(reasoning) {
+		t.Fatalf("finish chunk digest = %v", digest)
+	}
+	// HTTP/1.1 分块传输支持 trailer
+	if got := resp.Trailer.Get(api.ContentDigestHeader); got != api.ContentDigest(content) {
+		t.Fatalf("trailer %s = %q (trailers %v)", api.ContentDigestHeader, got, resp.Trailer)
+	}
+	if got := resp.Trailer.Get(api.ReasoningDigestHeader); got != api.ContentDigest(reasoning) {
+		t.Fatalf("trailer %s = %q", api.ReasoningDigestHeader, got)
+	}
+}
+
+func TestNonStreamContentDigestHeaders(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("digest-json"))
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Thought("Thinking"), testutil.Text("Hello"), testutil.Text(" world")))
+	srv := newTestServer(t)
+
+	resp, body := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, body)
+	}
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content   string `json:"content"`
+				Reasoning string `json:"reasoning"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil || len(completion.Choices) != 1 {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	message := completion.Choices[0].Message
+	if message.Content != "Hello world" || resp.Header.Get(api.ContentDigestHeader) != api.ContentDigest(message.Content) {
+		t.Fatalf("content %q, %s = %q", message.Content, api.ContentDigestHeader, resp.Header.Get(api.ContentDigestHeader))
+	}
+	if message.Reasoning == "" || resp.Header.Get(api.ReasoningDigestHeader) != api.ContentDigest(message.Reasoning) {
+		t.Fatalf("reasoning %q, %s = %q", message.Reasoning, api.ReasoningDigestHeader, resp.Header.Get(api.ReasoningDigestHeader))
+	}
+
+	// 没有思考内容时不返回思考摘要
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("plain")))
+	resp, _ = postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`, nil)
+	if resp.Header.Get(api.ContentDigestHeader) != api.ContentDigest("plain") || resp.Header.Get(api.ReasoningDigestHeader) != "" {
+		t.Fatalf("headers = %v", resp.Header)
+	}
+}
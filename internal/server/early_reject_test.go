@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingListener 统计服务端从连接读取的字节数
+type countingListener struct {
+	net.Listener
+	read atomic.Int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: c, read: &l.read}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// newCountingServer 统计读取字节数的测试服务器
+func newCountingServer(t *testing.T) (*httptest.Server, *countingListener) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(New().httpServer.Handler)
+	counter := &countingListener{Listener: srv.Listener}
+	srv.Listener = counter
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, counter
+}
+
+// writeRequestHead 只写出请求行和请求头，请求体由调用者决定是否发送
+func writeRequestHead(t *testing.T, conn net.Conn, key string, size int, header string) {
+	t.Helper()
+	_, err := fmt.Fprintf(conn, "POST /v1/chat/completions HTTP/1.1\r\nHost: test\r\nAuthorization: Bearer %s\r\n"+
+		"Content-Type: application/json\r\nContent-Length: %d\r\n%s\r\n", key, size, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidKeyRejectedBeforeBodyIsRead(t *testing.T) {
+	srv, counter := newCountingServer(t)
+
+	// net/http 在处理函数返回后仍会读完 256KB 以内的请求体（与 Connection: close 无关），
+	// 更大的请求体直接放弃，因此只对大请求体检查读取的字节数；两种情况都必须关闭连接
+	for _, tc := range []struct {
+		size    int
+		maxRead int64
+	}{
+		{size: 30 << 20, maxRead: 64 << 10},
+		{size: 128 << 10},
+	} {
+		size := tc.size
+		t.Run(fmt.Sprintf("%dKB", size>>10), func(t *testing.T) {
+			conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			before := counter.read.Load()
+
+			writeRequestHead(t, conn, "sk-wrong", size, "")
+			// 客户端在等待响应的同时继续上传
+			go func() {
+				chunk := bytes.Repeat([]byte("a"), 16<<10)
+				for sent := 0; sent < size; sent += len(chunk) {
+					if _, err := conn.Write(chunk); err != nil {
+						return
+					}
+				}
+			}()
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Fatalf("status = %d: %s", resp.StatusCode, body)
+			}
+			if !resp.Close {
+				t.Error("401 for a request with a body should close the connection")
+			}
+			conn.Close()
+
+			// 服务端最多读取一个缓冲区（请求头和紧随其后的少量请求体）
+			if n := counter.read.Load() - before; tc.maxRead > 0 && n > tc.maxRead {
+				t.Errorf("server read %d bytes of a %d byte request it rejected", n, size)
+			}
+		})
+	}
+}
+
+// readStatusLine 读取服务端的第一行响应（不解析 1xx，以便区分 100 Continue）
+func readStatusLine(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(line)
+}
+
+func TestExpectContinue(t *testing.T) {
+	srv, counter := newCountingServer(t)
+
+	t.Run("rejected key", func(t *testing.T) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		before := counter.read.Load()
+
+		writeRequestHead(t, conn, "sk-wrong", 1<<20, "Expect: 100-continue\r\n")
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if line := readStatusLine(t, bufio.NewReader(conn)); line != "HTTP/1.1 401 Unauthorized" {
+			t.Fatalf("first response line = %q, want 401 without 100 Continue", line)
+		}
+		if n := counter.read.Load() - before; n > 4<<10 {
+			t.Errorf("server read %d bytes, expected only the request head", n)
+		}
+	})
+
+	// 对照：有效的 Key 在读取请求体时才收到 100 Continue
+	t.Run("accepted key", func(t *testing.T) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		writeRequestHead(t, conn, testAPIKey, 1<<20, "Expect: 100-continue\r\n")
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if line := readStatusLine(t, bufio.NewReader(conn)); line != "HTTP/1.1 100 Continue" {
+			t.Fatalf("first response line = %q, want 100 Continue", line)
+		}
+	})
+}
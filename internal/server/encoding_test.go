@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/testutil"
+)
+
+// compressed 把上游 handler 的完整响应按 encoding 压缩后返回
+func compressed(encoding string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		w.Header().Set("Content-Type", rec.Header().Get("Content-Type"))
+		w.Header().Set("Content-Encoding", encoding)
+		w.WriteHeader(rec.Code)
+		w.Write(testutil.Compress(encoding, rec.Body.Bytes()))
+	}
+}
+
+func TestCompressedUpstreamResponses(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("encoding"))
+	srv := newTestServer(t)
+
+	for _, encoding := range testutil.Encodings {
+		t.Run(encoding, func(t *testing.T) {
+			upstream := testutil.StartUpstream(t, compressed(encoding,
+				testutil.Reply("STOP", testutil.Text("Hello "), testutil.Text("world"))))
+
+			resp, body := postChat(t, srv.URL, testAPIKey, "")
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("non-stream: status %d: %s", resp.StatusCode, body)
+			}
+			var completion converter.OpenAIChatCompletion
+			if err := json.Unmarshal(body, &completion); err != nil {
+				t.Fatal(err)
+			}
+			if got := completion.Choices[0].Message.Content; got != "Hello world" {
+				t.Errorf("non-stream content = %q", got)
+			}
+
+			req := streamRequest(t, srv.URL)
+			stream, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(stream.Body)
+			stream.Body.Close()
+			if !strings.Contains(string(data), `"content":"Hello "`) || !strings.Contains(string(data), "[DONE]") {
+				t.Errorf("stream body = %s", data)
+			}
+
+			// 非流式请求声明支持的压缩格式，流式请求要求不压缩
+			requests := upstream.Requests()
+			if len(requests) != 2 {
+				t.Fatalf("upstream received %d requests", len(requests))
+			}
+			if got := requests[0].Header.Get("Accept-Encoding"); got != "gzip, br, zstd" {
+				t.Errorf("non-stream Accept-Encoding = %q", got)
+			}
+			if got := requests[1].Header.Get("Accept-Encoding"); got != "identity" {
+				t.Errorf("stream Accept-Encoding = %q", got)
+			}
+		})
+	}
+}
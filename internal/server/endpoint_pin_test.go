@@ -0,0 +1,68 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/testutil"
+)
+
+// postWithEndpoint 以 X-Antigravity-Endpoint 发送非流式聊天请求
+func postWithEndpoint(t *testing.T, url, endpoint string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/v1/chat/completions", strings.NewReader(
+		`{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Antigravity-Endpoint", endpoint)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestEndpointOverrideSelectsCompatibleAccounts(t *testing.T) {
+	pinnedElsewhere := testutil.Account("pin-daily")
+	pinnedElsewhere.Endpoint = "daily"
+	unpinned := testutil.Account("pin-none")
+	unpinned.Endpoint = ""
+	testutil.UseAccounts(t, pinnedElsewhere, testutil.Account("pin-fake"), unpinned)
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+
+	// 覆盖的端点优先于账号未固定时的全局端点；固定到其他端点的账号不参与轮询
+	for i := 0; i < 4; i++ {
+		if resp, body := postWithEndpoint(t, srv.URL, testutil.EndpointKey); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d: %s", i, resp.StatusCode, body)
+		}
+	}
+	counts := make(map[string]int)
+	for _, r := range upstream.Requests() {
+		counts[r.Header.Get("Authorization")]++
+	}
+	if counts["Bearer access-pin-daily"] != 0 {
+		t.Errorf("account pinned to daily served an override request: %v", counts)
+	}
+	if counts["Bearer access-pin-fake"] != 2 || counts["Bearer access-pin-none"] != 2 {
+		t.Errorf("upstream tokens = %v, want the two compatible accounts in turn", counts)
+	}
+}
+
+func TestEndpointOverrideRejectsUnknownEndpoint(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("pin-unknown"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+
+	resp, body := postWithEndpoint(t, srv.URL, "no-such-endpoint")
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "no-such-endpoint") {
+		t.Errorf("status %d: %s, want 400 naming the endpoint", resp.StatusCode, body)
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Errorf("upstream received %d requests", n)
+	}
+}
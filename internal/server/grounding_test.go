@@ -0,0 +1,206 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/testutil"
+)
+
+// groundedContent 录制的联网搜索响应的正文
+const groundedContent = "The 2024 Summer Olympics were held in Paris, France. Über 10,000 athletes competed — a record 🏅. The next Games are in Los Angeles."
+
+// groundedAnnotations 录制响应对应的引用（偏移为 content 中的字符位置，第二次出现的 grounding 来源索引已合并偏移）
+var groundedAnnotations = []converter.Annotation{
+	{Type: "url_citation", URLCitation: converter.URLCitation{StartIndex: 0, EndIndex: 52, URL: "https://vertexaisearch.cloud.google.com/grounding-api-redirect/olympics", Title: "olympics.com"}},
+	{Type: "url_citation", URLCitation: converter.URLCitation{StartIndex: 0, EndIndex: 52, URL: "https://vertexaisearch.cloud.google.com/grounding-api-redirect/wiki", Title: "wikipedia.org"}},
+	{Type: "url_citation", URLCitation: converter.URLCitation{StartIndex: 53, EndIndex: 96, URL: "https://vertexaisearch.cloud.google.com/grounding-api-redirect/wiki", Title: "wikipedia.org"}},
+	{Type: "url_citation", URLCitation: converter.URLCitation{StartIndex: 97, EndIndex: 131, URL: "https://vertexaisearch.cloud.google.com/grounding-api-redirect/la28", Title: "la28.org"}},
+}
+
+// groundedUpstream 回放 testdata/grounding 中录制的联网搜索响应：
+// 流式响应的 grounding 分两次出现（正文中途和结束 chunk），非流式响应为合并后的结果
+func groundedUpstream(t *testing.T) http.HandlerFunc {
+	t.Helper()
+	stream, err := os.ReadFile(filepath.Join("testdata", "grounding", "stream.sse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := os.ReadFile(filepath.Join("testdata", "grounding", "response.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "streamGenerateContent") {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write(stream)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	}
+}
+
+// useStreamAnnotations 在测试期间设置 STREAM_ANNOTATIONS
+func useStreamAnnotations(t *testing.T, mode string) {
+	t.Helper()
+	cfg := config.Get()
+	previous := cfg.StreamAnnotations
+	cfg.StreamAnnotations = mode
+	t.Cleanup(func() { cfg.StreamAnnotations = previous })
+}
+
+// groundedStream 请求录制的流式响应并解码全部 chunk
+func groundedStream(t *testing.T) []converter.OpenAIStreamChunk {
+	t.Helper()
+	testutil.UseAccounts(t, testutil.Account("grounding"))
+	testutil.StartUpstream(t, groundedUpstream(t))
+	srv := newTestServer(t)
+
+	resp, body := postChatJSON(t, srv.URL, streamRequestBody, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", resp.StatusCode, body)
+	}
+	var chunks []converter.OpenAIStreamChunk
+	for _, line := range strings.Split(string(body), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk converter.OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("bad chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// checkCitedText 引用的偏移按字符对应到 content 中的片段
+func checkCitedText(t *testing.T, content string, annotations []converter.Annotation) {
+	t.Helper()
+	runes := []rune(content)
+	want := map[int]string{
+		0:  "The 2024 Summer Olympics were held in Paris, France.",
+		53: "Über 10,000 athletes competed — a record 🏅.",
+		97: "The next Games are in Los Angeles.",
+	}
+	for _, a := range annotations {
+		c := a.URLCitation
+		if got := string(runes[c.StartIndex:c.EndIndex]); got != want[c.StartIndex] {
+			t.Errorf("citation %d-%d covers %q, want %q", c.StartIndex, c.EndIndex, got, want[c.StartIndex])
+		}
+	}
+}
+
+func TestGroundingStreamAnnotationsDelta(t *testing.T) {
+	useStreamAnnotations(t, api.AnnotationsDelta)
+	chunks := groundedStream(t)
+
+	var content strings.Builder
+	annotationChunk := -1
+	for i, chunk := range chunks {
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+		if len(delta.Annotations) > 0 {
+			if annotationChunk >= 0 {
+				t.Fatalf("annotations sent twice (chunks %d and %d)", annotationChunk, i)
+			}
+			annotationChunk = i
+			if delta.Content != "" || chunk.Choices[0].FinishReason != nil {
+				t.Errorf("annotation delta carries content %q / finish reason", delta.Content)
+			}
+			if !reflect.DeepEqual(delta.Annotations, groundedAnnotations) {
+				t.Errorf("annotations = %+v\nwant %+v", delta.Annotations, groundedAnnotations)
+			}
+			continue
+		}
+		// 引用在全部正文之后、结束 chunk 之前发送
+		if annotationChunk >= 0 && delta.Content != "" {
+			t.Errorf("content %q sent after the annotations", delta.Content)
+		}
+		content.WriteString(delta.Content)
+	}
+	if annotationChunk < 0 {
+		t.Fatal("no annotation delta in stream")
+	}
+	last := chunks[len(chunks)-1]
+	if last.Choices[0].FinishReason == nil || *last.Choices[0].FinishReason != "stop" || len(last.Annotations) != 0 {
+		t.Errorf("finish chunk = %+v", last)
+	}
+	if content.String() != groundedContent {
+		t.Fatalf("content = %q", content.String())
+	}
+	checkCitedText(t, content.String(), groundedAnnotations)
+}
+
+func TestGroundingStreamAnnotationsFinal(t *testing.T) {
+	useStreamAnnotations(t, api.AnnotationsFinal)
+	chunks := groundedStream(t)
+
+	var content strings.Builder
+	for _, chunk := range chunks {
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if len(chunk.Choices[0].Delta.Annotations) > 0 {
+			t.Fatalf("delta annotations in final mode: %+v", chunk)
+		}
+		content.WriteString(chunk.Choices[0].Delta.Content)
+	}
+	// 只放在结束 chunk 的扩展字段中
+	last := chunks[len(chunks)-1]
+	if last.Choices[0].FinishReason == nil || !reflect.DeepEqual(last.Annotations, groundedAnnotations) {
+		t.Fatalf("finish chunk annotations = %+v\nwant %+v", last.Annotations, groundedAnnotations)
+	}
+	for _, chunk := range chunks[:len(chunks)-1] {
+		if len(chunk.Annotations) != 0 {
+			t.Errorf("annotations before the finish chunk: %+v", chunk)
+		}
+	}
+	checkCitedText(t, content.String(), last.Annotations)
+}
+
+func TestGroundingNonStreamAnnotations(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("grounding"))
+	testutil.StartUpstream(t, groundedUpstream(t))
+	srv := newTestServer(t)
+
+	resp, body := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", resp.StatusCode, body)
+	}
+	var completion converter.OpenAIChatCompletion
+	if err := json.Unmarshal(body, &completion); err != nil {
+		t.Fatal(err)
+	}
+	msg := completion.Choices[0].Message
+	if msg.Content != groundedContent {
+		t.Fatalf("content = %q", msg.Content)
+	}
+	if !reflect.DeepEqual(msg.Annotations, groundedAnnotations) {
+		t.Fatalf("annotations = %+v\nwant %+v", msg.Annotations, groundedAnnotations)
+	}
+	checkCitedText(t, msg.Content, msg.Annotations)
+}
+
+func TestGroundingWithoutMetadataHasNoAnnotations(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("grounding"))
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("Hello")))
+	srv := newTestServer(t)
+
+	_, body := postChatJSON(t, srv.URL, streamRequestBody, nil)
+	if strings.Contains(string(body), "annotations") {
+		t.Fatalf("stream without grounding mentions annotations:\n%s", body)
+	}
+}
@@ -1,16 +1,33 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/auth"
+	"anti2api-golang/internal/capability"
+	"anti2api-golang/internal/chaos"
 	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/notify"
+	"anti2api-golang/internal/persist"
+	"anti2api-golang/internal/postprocess"
 	"anti2api-golang/internal/store"
 	"anti2api-golang/internal/utils"
+	"anti2api-golang/internal/validate"
+	"anti2api-golang/internal/version"
 )
 
 // HandleGetSettings 获取设置
@@ -21,37 +38,188 @@ func HandleGetSettings(w http.ResponseWriter, r *http.Request) {
 	// 构建分组配置显示
 	groups := []map[string]interface{}{
 		{
-			"name": "面板配置",
+			"name": Message(w, "settings.group.panel"),
 			"items": []map[string]interface{}{
-				{"key": "PANEL_USER", "label": "面板用户名", "value": cfg.PanelUser, "isDefault": cfg.PanelUser == "admin", "defaultValue": "admin"},
-				{"key": "PANEL_PASSWORD", "label": "面板密码", "value": "******", "sensitive": true, "isDefault": false},
+				{"key": "PANEL_USER", "label": Message(w, "settings.PANEL_USER"), "value": cfg.PanelUser, "isDefault": cfg.PanelUser == "admin", "defaultValue": "admin"},
+				{"key": "PANEL_PASSWORD", "label": Message(w, "settings.PANEL_PASSWORD"), "value": "******", "sensitive": true, "isDefault": false},
 			},
 		},
 		{
-			"name": "网络配置",
+			"name": Message(w, "settings.group.network"),
 			"items": []map[string]interface{}{
-				{"key": "PORT", "label": "服务端口", "value": cfg.Port, "isDefault": cfg.Port == 8045, "defaultValue": 8045},
-				{"key": "HOST", "label": "监听地址", "value": cfg.Host, "isDefault": cfg.Host == "0.0.0.0", "defaultValue": "0.0.0.0"},
-				{"key": "PROXY", "label": "代理地址", "value": valueOrDefault(cfg.Proxy, "未设置"), "isDefault": cfg.Proxy == ""},
-				{"key": "TIMEOUT", "label": "请求超时(ms)", "value": cfg.Timeout, "isDefault": cfg.Timeout == 600000, "defaultValue": 600000},
+				{"key": "PORT", "label": Message(w, "settings.PORT"), "value": cfg.Port, "isDefault": cfg.Port == 8045, "defaultValue": 8045},
+				{"key": "HOST", "label": Message(w, "settings.HOST"), "value": cfg.Host, "isDefault": cfg.Host == "0.0.0.0", "defaultValue": "0.0.0.0"},
+				{"key": "PROXY", "label": Message(w, "settings.PROXY"), "value": valueOrDefault(cfg.Proxy, Message(w, "settings.unset")), "isDefault": cfg.Proxy == ""},
+				{"key": "TIMEOUT", "label": Message(w, "settings.TIMEOUT"), "value": cfg.Timeout, "isDefault": cfg.Timeout == 600000, "defaultValue": 600000},
+				{"key": "SERVER_READ_HEADER_TIMEOUT", "label": Message(w, "settings.SERVER_READ_HEADER_TIMEOUT"), "value": cfg.ReadHeaderTimeout, "isDefault": cfg.ReadHeaderTimeout == 10, "defaultValue": 10},
+				{"key": "SERVER_READ_TIMEOUT", "label": Message(w, "settings.SERVER_READ_TIMEOUT"), "value": cfg.ReadTimeout, "isDefault": cfg.ReadTimeout == 60, "defaultValue": 60},
+				{"key": "SERVER_WRITE_TIMEOUT", "label": Message(w, "settings.SERVER_WRITE_TIMEOUT"), "value": int(cfg.EffectiveWriteTimeout().Seconds()), "isDefault": cfg.WriteTimeout == 0},
+				{"key": "SERVER_IDLE_TIMEOUT", "label": Message(w, "settings.SERVER_IDLE_TIMEOUT"), "value": cfg.IdleTimeout, "isDefault": cfg.IdleTimeout == 120, "defaultValue": 120},
+				{"key": "STREAM_WRITE_TIMEOUT", "label": Message(w, "settings.STREAM_WRITE_TIMEOUT"), "value": cfg.StreamWriteTimeout, "isDefault": cfg.StreamWriteTimeout == 60, "defaultValue": 60},
 			},
 		},
 		{
-			"name": "API 配置",
+			"name": Message(w, "settings.group.api"),
 			"items": []map[string]interface{}{
-				{"key": "API_KEY", "label": "API密钥", "value": maskString(cfg.APIKey), "sensitive": true, "isDefault": cfg.APIKey == ""},
-				{"key": "ENDPOINT_MODE", "label": "端点模式", "value": epMgr.GetMode(), "isDefault": os.Getenv("ENDPOINT_MODE") == "", "defaultValue": "daily"},
-				{"key": "DEBUG", "label": "调试级别", "value": cfg.Debug, "isDefault": cfg.Debug == "off", "defaultValue": "off"},
+				{"key": "API_KEY", "label": Message(w, "settings.API_KEY"), "value": valueOrDefault(maskString(cfg.APIKey), Message(w, "settings.unset")), "sensitive": true, "isDefault": cfg.APIKey == ""},
+				{"key": "ENDPOINT_MODE", "label": Message(w, "settings.ENDPOINT_MODE"), "value": epMgr.GetMode(), "isDefault": os.Getenv("ENDPOINT_MODE") == "", "defaultValue": "daily"},
+				{"key": "ENDPOINT_FALLBACK", "label": Message(w, "settings.ENDPOINT_FALLBACK"), "value": valueOrDefault(cfg.EndpointFallback, Message(w, "settings.unset_disabled")), "isDefault": cfg.EndpointFallback == ""},
+				{"key": "DEBUG", "label": Message(w, "settings.DEBUG"), "value": logger.GetLevel().String(), "isDefault": logger.GetLevel() == logger.LogOff, "defaultValue": "off"},
+			},
+		},
+		{
+			"name": Message(w, "settings.group.tracing"),
+			"items": []map[string]interface{}{
+				{"key": "OTLP_ENDPOINT", "label": Message(w, "settings.OTLP_ENDPOINT"), "value": valueOrDefault(cfg.TraceEndpoint, Message(w, "settings.unset_disabled")), "isDefault": cfg.TraceEndpoint == ""},
+				{"key": "TRACE_SAMPLE_PERCENT", "label": Message(w, "settings.TRACE_SAMPLE_PERCENT"), "value": cfg.TraceSamplePercent, "isDefault": cfg.TraceSamplePercent == 100, "defaultValue": 100},
+				{"key": "TRACE_PROPAGATE", "label": Message(w, "settings.TRACE_PROPAGATE"), "value": cfg.TracePropagate, "isDefault": !cfg.TracePropagate, "defaultValue": false},
+			},
+		},
+		{
+			"name": Message(w, "settings.group.affinity"),
+			"items": []map[string]interface{}{
+				{"key": "CONVERSATION_AFFINITY", "label": Message(w, "settings.CONVERSATION_AFFINITY"), "value": cfg.ConversationAffinity, "isDefault": !cfg.ConversationAffinity, "defaultValue": false},
+				{"key": "AFFINITY_MAX_ENTRIES", "label": Message(w, "settings.AFFINITY_MAX_ENTRIES"), "value": cfg.AffinityMaxEntries, "isDefault": cfg.AffinityMaxEntries == 10000, "defaultValue": 10000},
+				{"key": "AFFINITY_TTL_MINUTES", "label": Message(w, "settings.AFFINITY_TTL_MINUTES"), "value": cfg.AffinityTTLMinutes, "isDefault": cfg.AffinityTTLMinutes == 30, "defaultValue": 30},
+				{"key": "AFFINITY_PERSIST", "label": Message(w, "settings.AFFINITY_PERSIST"), "value": cfg.AffinityPersist, "isDefault": !cfg.AffinityPersist, "defaultValue": false},
 			},
 		},
 	}
 
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"groups":    groups,
+		"version":   version.Get(),
 		"updatedAt": time.Now().Format(time.RFC3339),
 	})
 }
 
+// settingDebug 日志级别（不持久化，与 PUT /admin/debug 不带 scope 时相同）
+const settingDebug = "DEBUG"
+
+// HandleUpdateSettings 整体修改多项运行时设置（端点模式、权重、自动切换、上游请求头、日志级别）：
+// 先校验所有键和键之间的约束，任何一项失败时不修改任何设置；dry_run 为 true 时只返回校验结果和变化
+func HandleUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Settings map[string]json.RawMessage `json:"settings"`
+		DryRun   bool                       `json:"dry_run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
+		return
+	}
+
+	var change config.SettingsChange
+	var errs config.SettingErrors
+	var debugLevel *logger.LogLevel
+	decode := func(key string, raw json.RawMessage, v interface{}) bool {
+		if err := json.Unmarshal(raw, v); err != nil {
+			errs = append(errs, config.SettingError{Key: key, Message: Message(w, "settings.invalid_value", err)})
+			return false
+		}
+		return true
+	}
+	for key, raw := range req.Settings {
+		switch key {
+		case config.SettingEndpointMode:
+			var mode string
+			if decode(key, raw, &mode) {
+				change.Mode = &mode
+			}
+		case config.SettingEndpointWeights:
+			var weights map[string]int
+			if decode(key, raw, &weights) {
+				change.Weights = nonNilWeights(weights)
+			}
+		case config.SettingAutoFailover:
+			var enabled bool
+			if decode(key, raw, &enabled) {
+				change.AutoFailover = &enabled
+			}
+		case config.SettingUpstreamHeaders:
+			var headers map[string]string
+			if decode(key, raw, &headers) {
+				change.Headers = &headers
+			}
+		case config.SettingEndpointHeaders:
+			var headers map[string]map[string]string
+			if decode(key, raw, &headers) {
+				change.EndpointHeaders = &headers
+			}
+		case settingDebug:
+			var level string
+			if !decode(key, raw, &level) {
+				continue
+			}
+			if !logger.ValidLevel(level) {
+				errs = append(errs, config.SettingError{Key: key, Message: Message(w, "logger.invalid_level", level)})
+				continue
+			}
+			parsed := logger.ParseLevel(level)
+			debugLevel = &parsed
+		default:
+			errs = append(errs, config.SettingError{Key: key, Message: Message(w, "settings.not_runtime")})
+		}
+	}
+
+	// 解析失败时仍校验其余设置，一次返回所有错误
+	epMgr := config.GetEndpointManager()
+	diff, err := epMgr.ApplySettings(change, req.DryRun || len(errs) > 0)
+	var validation config.SettingErrors
+	if errors.As(err, &validation) {
+		errs = append(errs, validation...)
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, Message(w, "settings.apply_failed", err))
+		return
+	}
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Key < errs[j].Key })
+		status := http.StatusBadRequest
+		if req.DryRun {
+			status = http.StatusOK
+		}
+		WriteJSON(w, status, map[string]interface{}{
+			"success": false,
+			"dryRun":  req.DryRun,
+			"message": Message(w, "settings.invalid"),
+			"errors":  errs,
+		})
+		return
+	}
+
+	if debugLevel != nil && *debugLevel != logger.GetLevel() {
+		diff = append(diff, config.SettingDiff{Key: settingDebug, Old: logger.GetLevel().String(), New: debugLevel.String()})
+		sort.SliceStable(diff, func(i, j int) bool { return diff[i].Key < diff[j].Key })
+	}
+	if !req.DryRun && debugLevel != nil {
+		// 日志级别不会失败，在端点设置写入成功后应用
+		logger.ApplyDebug(*debugLevel, nil, time.Duration(config.Get().DebugVerboseTTL)*time.Minute)
+	}
+	if !req.DryRun && len(diff) > 0 {
+		keys := make([]string, len(diff))
+		for i, d := range diff {
+			keys[i] = d.Key
+		}
+		logger.Info("Settings updated: %s", strings.Join(keys, ", "))
+	}
+
+	if diff == nil {
+		diff = []config.SettingDiff{}
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"dryRun":  req.DryRun,
+		"diff":    diff,
+	})
+}
+
+// nonNilWeights JSON 中的 null 或空对象都视为设置了空权重（由校验报告错误）
+func nonNilWeights(weights map[string]int) map[string]int {
+	if weights == nil {
+		return map[string]int{}
+	}
+	return weights
+}
+
 func valueOrDefault(val, def string) string {
 	if val == "" {
 		return def
@@ -59,9 +227,10 @@ func valueOrDefault(val, def string) string {
 	return val
 }
 
+// maskString 脱敏显示密钥（为空时返回空字符串）
 func maskString(s string) string {
 	if s == "" {
-		return "未设置"
+		return ""
 	}
 	if len(s) <= 8 {
 		return "****"
@@ -101,6 +270,9 @@ func HandleGetEndpoints(w http.ResponseWriter, r *http.Request) {
 	allEndpoints := epMgr.GetAllEndpoints()
 	mode := epMgr.GetMode()
 
+	weights := epMgr.GetWeights()
+	stats := epMgr.Stats()
+
 	// 转换为前端期望的格式
 	endpoints := make([]map[string]interface{}, 0)
 	var current map[string]interface{}
@@ -110,6 +282,10 @@ func HandleGetEndpoints(w http.ResponseWriter, r *http.Request) {
 			"key":   key,
 			"label": ep.Label,
 			"host":  ep.Host,
+			"stats": stats[key],
+		}
+		if mode == config.EndpointModeWeighted {
+			item["weight"] = weights[key]
 		}
 		endpoints = append(endpoints, item)
 
@@ -123,8 +299,15 @@ func HandleGetEndpoints(w http.ResponseWriter, r *http.Request) {
 	if mode == "round-robin" || mode == "round-robin-dp" {
 		current = map[string]interface{}{
 			"key":   mode,
-			"label": getModeLabel(mode),
-			"host":  "多端点轮询",
+			"label": getModeLabel(w, mode),
+			"host":  Message(w, "endpoints.round_robin_host"),
+		}
+	}
+	if mode == config.EndpointModeWeighted {
+		current = map[string]interface{}{
+			"key":   mode,
+			"label": getModeLabel(w, mode),
+			"host":  Message(w, "endpoints.weighted_host"),
 		}
 	}
 
@@ -132,15 +315,19 @@ func HandleGetEndpoints(w http.ResponseWriter, r *http.Request) {
 		"endpoints": endpoints,
 		"current":   current,
 		"mode":      mode,
+		"weights":   weights,
+		"auto":      epMgr.AutoFailoverStatus(),
 	})
 }
 
-func getModeLabel(mode string) string {
+func getModeLabel(w http.ResponseWriter, mode string) string {
 	switch mode {
 	case "round-robin":
-		return "轮询(全部)"
+		return Message(w, "endpoints.mode.round_robin")
 	case "round-robin-dp":
-		return "轮询(D+P)"
+		return Message(w, "endpoints.mode.round_robin_dp")
+	case config.EndpointModeWeighted:
+		return Message(w, "endpoints.mode.weighted")
 	case "daily":
 		return "Daily"
 	case "autopush":
@@ -159,7 +346,7 @@ func HandleSetEndpoint(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request")
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
 		return
 	}
 
@@ -171,10 +358,10 @@ func HandleSetEndpoint(w http.ResponseWriter, r *http.Request) {
 
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"message": "端点已切换至 " + getModeLabel(req.Endpoint),
+		"message": Message(w, "endpoints.switched", getModeLabel(w, req.Endpoint)),
 		"current": map[string]string{
 			"key":   req.Endpoint,
-			"label": getModeLabel(req.Endpoint),
+			"label": getModeLabel(w, req.Endpoint),
 		},
 	})
 }
@@ -186,7 +373,7 @@ func HandleSetEndpointMode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request")
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
 		return
 	}
 
@@ -198,25 +385,223 @@ func HandleSetEndpointMode(w http.ResponseWriter, r *http.Request) {
 
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"message": "模式已切换至 " + getModeLabel(req.Mode),
+		"message": Message(w, "endpoints.mode_switched", getModeLabel(w, req.Mode)),
 		"mode":    req.Mode,
 	})
 }
 
-// HandleGetLogs 获取请求日志
+// HandleSetAutoFailover 恢复或暂停错误预算触发的端点自动切换（手动切换模式后自动切换处于暂停状态）
+func HandleSetAutoFailover(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
+		return
+	}
+
+	epMgr := config.GetEndpointManager()
+	if err := epMgr.SetAutoFailover(req.Enabled); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key := "endpoints.auto_suspended"
+	if req.Enabled {
+		key = "endpoints.auto_resumed"
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": Message(w, key),
+		"auto":    epMgr.AutoFailoverStatus(),
+	})
+}
+
+// HandleSetEndpointWeights 设置端点权重（切换到按权重分流模式，如 {"weights":{"daily":90,"production":10}}）
+func HandleSetEndpointWeights(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Weights map[string]int `json:"weights"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
+		return
+	}
+
+	epMgr := config.GetEndpointManager()
+	if err := epMgr.SetWeights(req.Weights); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": Message(w, "endpoints.mode_switched", getModeLabel(w, config.EndpointModeWeighted)),
+		"mode":    config.EndpointModeWeighted,
+		"weights": epMgr.GetWeights(),
+	})
+}
+
+// HandleGetUpstreamHeaders 获取上游请求头配置
+func HandleGetUpstreamHeaders(w http.ResponseWriter, r *http.Request) {
+	headers, endpoints := config.GetEndpointManager().GetHeaders()
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"headers":   headers,
+		"endpoints": endpoints,
+	})
+}
+
+// HandleSetUpstreamHeaders 设置上游请求头（空值移除默认头，endpoints 按端点覆盖）
+func HandleSetUpstreamHeaders(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Headers   map[string]string            `json:"headers"`
+		Endpoints map[string]map[string]string `json:"endpoints"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
+		return
+	}
+
+	if err := config.GetEndpointManager().SetHeaders(req.Headers, req.Endpoints); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"headers":   req.Headers,
+		"endpoints": req.Endpoints,
+	})
+}
+
+// HandleGetLogs 分页获取请求日志
+// （GET /admin/logs?offset=0&limit=200&model=&email=&status=&success=true|false&from=&to=，from/to 为 RFC 3339 时间）
 func HandleGetLogs(w http.ResponseWriter, r *http.Request) {
-	limitStr := r.URL.Query().Get("limit")
-	limit := 200
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
+	query := r.URL.Query()
+	offset, limit := 0, 200
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_offset"))
+			return
+		}
+		offset = n
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_limit"))
+			return
+		}
+		limit = n
+	}
+
+	filter := store.LogFilter{
+		Model: query.Get("model"),
+		Email: query.Get("email"),
+	}
+	if v := query.Get("status"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 100 || n > 599 {
+			WriteError(w, http.StatusBadRequest, Message(w, "logs.invalid_status"))
+			return
+		}
+		filter.Status = n
+	}
+	if v := query.Get("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, Message(w, "logs.invalid_success"))
+			return
 		}
+		filter.Success = &success
+	}
+	for _, p := range []struct {
+		name   string
+		target *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		v := query.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, Message(w, "logs.invalid_time", p.name))
+			return
+		}
+		*p.target = t
 	}
 
-	logs := store.GetLogStore().GetAll(limit)
+	logStore := store.GetLogStore()
+	resp := map[string]interface{}{
+		"offset":       offset,
+		"limit":        limit,
+		"detailMemory": logStore.DetailMemory(),
+		"health":       logStore.Health(),
+	}
 
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"logs": logs,
+	if q := query.Get("search"); q != "" {
+		search, ok := parseLogSearch(w, q, query.Get("regex"))
+		if !ok {
+			return
+		}
+		started := time.Now()
+		logs, total, stats := logStore.Search(r.Context(), offset, limit, filter, search)
+		recordLogSearch(r, q, time.Since(started))
+		resp["logs"], resp["total"], resp["search"] = logs, total, stats
+		WriteJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	resp["logs"], resp["total"] = logStore.List(r.Context(), offset, limit, filter)
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// maxLogSearchLength 搜索内容的长度上限
+const maxLogSearchLength = 512
+
+// parseLogSearch 解析全文搜索参数（regex=true 时按正则匹配），参数无效时写入 400 并返回 false
+func parseLogSearch(w http.ResponseWriter, q, regex string) (store.LogSearch, bool) {
+	search := store.LogSearch{Query: q, MaxScan: config.Get().LogSearchMaxScan}
+	if len(q) > maxLogSearchLength {
+		WriteError(w, http.StatusBadRequest, Message(w, "logs.search_too_long", maxLogSearchLength))
+		return search, false
+	}
+	if regex == "" {
+		return search, true
+	}
+	useRegex, err := strconv.ParseBool(regex)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "logs.invalid_regex_flag"))
+		return search, false
+	}
+	if useRegex {
+		pattern, err := regexp.Compile(q)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, Message(w, "logs.invalid_search_pattern", err))
+			return search, false
+		}
+		search.Pattern = pattern
+	}
+	return search, true
+}
+
+// recordLogSearch 全文搜索涉及请求和输出内容，记录搜索内容和执行时间到审计日志
+func recordLogSearch(r *http.Request, q string, elapsed time.Duration) {
+	principal, _ := store.PrincipalFromContext(r.Context())
+	tenant, _ := store.TenantFromContext(r.Context())
+	store.GetAuditLog().Record(store.AuditEntry{
+		Event:      store.AuditLogSearch,
+		Principal:  principal.Name,
+		Role:       principal.Role,
+		Tenant:     tenant,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		ClientIP:   utils.ClientIP(r),
+		Query:      q,
+		DurationMs: elapsed.Milliseconds(),
 	})
 }
 
@@ -224,25 +609,29 @@ func HandleGetLogs(w http.ResponseWriter, r *http.Request) {
 func HandleGetLogDetail(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
-		WriteError(w, http.StatusBadRequest, "Missing log ID")
+		WriteError(w, http.StatusBadRequest, Message(w, "logs.missing_id"))
 		return
 	}
 
-	log := store.GetLogStore().GetByID(id)
+	log := store.GetLogStore().GetByID(r.Context(), id)
 	if log == nil {
-		WriteError(w, http.StatusNotFound, "Log not found")
+		WriteError(w, http.StatusNotFound, Message(w, "logs.not_found"))
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
+	resp := map[string]interface{}{
 		"log": log,
-	})
+	}
+	if tmpl := config.Get().TraceURLTemplate; tmpl != "" && log.TraceID != "" {
+		resp["traceUrl"] = strings.ReplaceAll(tmpl, "{traceId}", log.TraceID)
+	}
+	WriteJSON(w, http.StatusOK, resp)
 }
 
 // HandleGetLogsUsage 获取用量统计
 func HandleGetLogsUsage(w http.ResponseWriter, r *http.Request) {
 	windowMinutes := 60
-	usage := store.GetLogStore().GetUsageStats(windowMinutes)
+	usage := store.GetLogStore().GetUsageStats(r.Context(), windowMinutes)
 
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"usage":         usage,
@@ -250,10 +639,32 @@ func HandleGetLogsUsage(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// maxErrorWindowMinutes 错误看板窗口上限（7 天）
+const maxErrorWindowMinutes = 7 * 24 * 60
+
+// HandleGetLogsErrors 失败请求按分类 × 模型 × 端点统计（window 为窗口分钟数，默认 60），并与上一个窗口对比
+func HandleGetLogsErrors(w http.ResponseWriter, r *http.Request) {
+	windowMinutes := 60
+	if v := r.URL.Query().Get("window"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxErrorWindowMinutes {
+			WriteError(w, http.StatusBadRequest, Message(w, "errors.invalid_window", maxErrorWindowMinutes))
+			return
+		}
+		windowMinutes = n
+	}
+
+	matrix := store.GetLogStore().GetErrorMatrix(r.Context(), time.Duration(windowMinutes)*time.Minute)
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"classes": api.ErrorClasses,
+		"matrix":  matrix,
+	})
+}
+
 // HandleGetUsage 获取使用统计
 func HandleGetUsage(w http.ResponseWriter, r *http.Request) {
 	// 获取全部时间的统计
-	allUsage := store.GetLogStore().GetAllAccountsUsage()
+	allUsage := store.GetLogStore().GetAllAccountsUsage(r.Context())
 
 	totalRequests := 0
 	for _, usage := range allUsage {
@@ -266,14 +677,19 @@ func HandleGetUsage(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// HandleGetAccounts 获取账号列表
+// HandleGetAccounts 获取账号列表（q 参数按 email、projectId、备注、标签搜索）
 func HandleGetAccounts(w http.ResponseWriter, r *http.Request) {
-	accounts := store.GetAccountStore().GetAll()
-	allUsage := store.GetLogStore().GetAllAccountsUsage()
+	accounts := store.GetAccountStore().GetAll(r.Context())
+	allUsage := store.GetLogStore().GetAllAccountsUsage(r.Context())
+	q := r.URL.Query().Get("q")
 
 	// 构建前端期望的格式
-	result := make([]map[string]interface{}, len(accounts))
-	for i, acc := range accounts {
+	result := make([]map[string]interface{}, 0, len(accounts))
+	for _, acc := range accounts {
+		if !acc.Matches(q) {
+			continue
+		}
+
 		// 获取该账号的用量统计（优先用 email 匹配，其次用 projectId）
 		usageData := map[string]interface{}{
 			"total":      0,
@@ -302,64 +718,161 @@ func HandleGetAccounts(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		result[i] = map[string]interface{}{
-			"index":     i,
-			"email":     maskEmail(acc.Email),
-			"projectId": acc.ProjectID,
-			"enable":    acc.Enable,
-			"expired":   acc.IsExpired(),
-			"createdAt": acc.CreatedAt.Format(time.RFC3339),
-			"usage":     usageData,
+		item := map[string]interface{}{
+			"id":             acc.ID,
+			"index":          acc.Index,
+			"email":          maskEmail(acc.Email),
+			"projectId":      acc.ProjectID,
+			"credentialType": acc.CredentialType(),
+			"enable":         acc.Enable,
+			"endpoint":       acc.Endpoint,
+			"note":           acc.Note,
+			"labels":         acc.Labels,
+			"tenant":         acc.Tenant,
+			"expired":        acc.IsExpired(),
+			"draining":       acc.IsDraining(),
+			"createdAt":      acc.CreatedAt.Format(time.RFC3339),
+			"usage":          usageData,
+			"health":         store.GetHealthTracker().Get(acc.Email, acc.ProjectID),
+		}
+		session := map[string]interface{}{
+			"requests":  acc.SessionRequests,
+			"rotations": acc.SessionRotations,
+		}
+		if !acc.SessionStartedAt.IsZero() {
+			session["startedAt"] = acc.SessionStartedAt.Format(time.RFC3339)
+		}
+		if acc.SessionRotateReason != "" {
+			session["lastRotateReason"] = acc.SessionRotateReason
+		}
+		item["session"] = session
+		if limit, ok := store.AccountRateLimit(acc.ID); ok {
+			item["rateLimit"] = limit
+		}
+		if acc.Schedule != nil {
+			now := time.Now()
+			item["schedule"] = acc.Schedule
+			item["inSchedule"] = acc.InSchedule(now)
+			if next := acc.Schedule.NextActive(now); !next.IsZero() && next.After(now) {
+				item["nextAvailableAt"] = next.Format(time.RFC3339)
+			}
+		}
+		if !acc.LastRefreshAt.IsZero() {
+			item["lastRefreshAt"] = acc.LastRefreshAt.Format(time.RFC3339)
+			item["lastRefreshError"] = acc.LastRefreshError
+		}
+		if acc.InCooldown(time.Now()) {
+			item["cooldownUntil"] = acc.CooldownUntil.Format(time.RFC3339)
+			item["cooldownReason"] = acc.CooldownReason
+		}
+		if acc.IsDraining() {
+			item["drainingSince"] = acc.DrainingSince.Format(time.RFC3339)
+			item["drainEndsAt"] = acc.DrainEndsAt().Format(time.RFC3339)
+			item["pinnedConversations"] = store.PinnedConversations(acc.ID)
 		}
+		result = append(result, item)
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"accounts": result,
-	})
+	resp := map[string]interface{}{
+		"accounts":            result,
+		"refresh":             store.GetRefreshStats(),
+		"conversationsAtRisk": store.ConversationsAtRisk(r.Context()),
+	}
+	// 数据文件损坏恢复记录只对超级管理员展示
+	if _, scoped := store.TenantFromContext(r.Context()); !scoped {
+		resp["recoveries"] = persist.Recoveries()
+	}
+	WriteJSON(w, http.StatusOK, resp)
 }
 
-// HandleImportTOML 导入 TOML 格式账号
+// HandleGetRefreshStats 获取 Token 刷新统计（含全局暂停状态）
+func HandleGetRefreshStats(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, store.GetRefreshStats())
+}
+
+// HandleImportTOML 导入 TOML 格式账号（单条错误不影响其他条目，async 为 true 时后台执行并返回任务 ID）
 func HandleImportTOML(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		TOML           string `json:"toml"`
 		ReplaceExist   bool   `json:"replaceExisting"`
 		FilterDisabled bool   `json:"filterDisabled"`
+		Async          bool   `json:"async"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request")
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
 		return
 	}
 
-	tomlData, err := utils.ParseTOML(req.TOML)
-	if err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid TOML: "+err.Error())
+	total := store.CountTOMLAccounts(req.TOML)
+	if total == 0 {
+		WriteError(w, http.StatusBadRequest, Message(w, "accounts.import_empty"))
 		return
 	}
 
+	accountStore := store.GetAccountStore()
+
 	// 如果需要覆盖现有账号，先清空
 	if req.ReplaceExist {
-		store.GetAccountStore().Clear()
+		accountStore.Clear(r.Context())
 	}
 
-	imported, err := store.GetAccountStore().ImportFromTOML(tomlData)
+	if req.Async {
+		// 请求结束后 r.Context() 会被取消，只保留租户信息
+		ctx := context.Background()
+		if tenant, ok := store.TenantFromContext(r.Context()); ok {
+			ctx = store.WithTenant(ctx, tenant)
+		}
+		job := store.GetJobStore().Start(ctx, "import-toml", func(update func(progress interface{})) (interface{}, error) {
+			report, err := accountStore.ImportTOML(ctx, strings.NewReader(req.TOML), total, store.ImportOptions{
+				FilterDisabled: req.FilterDisabled,
+				Progress:       func(report store.ImportReport) { update(report) },
+			})
+			if report != nil {
+				return *report, err
+			}
+			return nil, err
+		})
+		WriteJSON(w, http.StatusAccepted, map[string]interface{}{
+			"success": true,
+			"jobId":   job.ID,
+			"total":   total,
+		})
+		return
+	}
+
+	report, err := accountStore.ImportTOML(r.Context(), strings.NewReader(req.TOML), total, store.ImportOptions{
+		FilterDisabled: req.FilterDisabled,
+	})
 	if err != nil {
 		WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	total := store.GetAccountStore().Count()
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"success":  true,
-		"imported": imported,
-		"skipped":  0,
-		"total":    total,
+		"imported": report.Imported,
+		"updated":  report.Updated,
+		"skipped":  len(report.Skipped),
+		"errored":  len(report.Errored),
+		"report":   report,
+		"total":    accountStore.Count(r.Context()),
 	})
 }
 
+// HandleGetJob 查询后台任务进度
+func HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := store.GetJobStore().Get(r.Context(), r.PathValue("id"))
+	if !ok {
+		WriteError(w, http.StatusNotFound, Message(w, "jobs.not_found"))
+		return
+	}
+	WriteJSON(w, http.StatusOK, job)
+}
+
 // HandleRefreshAllAccounts 刷新所有账号
 func HandleRefreshAllAccounts(w http.ResponseWriter, r *http.Request) {
-	refreshed, failed := store.GetAccountStore().RefreshAll()
+	refreshed, failed := store.GetAccountStore().RefreshAll(r.Context())
 
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"refreshed": refreshed,
@@ -372,11 +885,11 @@ func HandleRefreshAccount(w http.ResponseWriter, r *http.Request) {
 	indexStr := r.PathValue("index")
 	index, err := strconv.Atoi(indexStr)
 	if err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid index")
+		WriteError(w, http.StatusBadRequest, Message(w, "accounts.invalid_index"))
 		return
 	}
 
-	if err := store.GetAccountStore().RefreshAccount(index); err != nil {
+	if err := store.GetAccountStore().RefreshAccount(r.Context(), index); err != nil {
 		WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -389,7 +902,7 @@ func HandleToggleAccount(w http.ResponseWriter, r *http.Request) {
 	indexStr := r.PathValue("index")
 	index, err := strconv.Atoi(indexStr)
 	if err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid index")
+		WriteError(w, http.StatusBadRequest, Message(w, "accounts.invalid_index"))
 		return
 	}
 
@@ -398,11 +911,37 @@ func HandleToggleAccount(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request")
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
+		return
+	}
+
+	if err := store.GetAccountStore().SetEnable(r.Context(), index, req.Enable); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// HandleDrainAccount 设置账号排空状态：不再接收新会话，已有会话在宽限期内继续使用
+func HandleDrainAccount(w http.ResponseWriter, r *http.Request) {
+	indexStr := r.PathValue("index")
+	index, err := strconv.Atoi(indexStr)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "accounts.invalid_index"))
+		return
+	}
+
+	var req struct {
+		Draining bool `json:"draining"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
 		return
 	}
 
-	if err := store.GetAccountStore().SetEnable(index, req.Enable); err != nil {
+	if err := store.GetAccountStore().SetDraining(r.Context(), index, req.Draining); err != nil {
 		WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -410,19 +949,634 @@ func HandleToggleAccount(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, map[string]bool{"success": true})
 }
 
-// HandleDeleteAccount 删除账号
+// HandleRotateSession 立即为账号生成新的 SessionID
+func HandleRotateSession(w http.ResponseWriter, r *http.Request) {
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "accounts.invalid_index"))
+		return
+	}
+
+	if err := store.GetAccountStore().RotateSession(r.Context(), index); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// HandleRotateAllSessions 为所有可见账号生成新的 SessionID
+func HandleRotateAllSessions(w http.ResponseWriter, r *http.Request) {
+	rotated := store.GetAccountStore().RotateAllSessions(r.Context())
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"rotated": rotated,
+	})
+}
+
+// HandleAddAccount 添加单个账号：先刷新 Token（只有 access_token 时请求用户信息）校验凭证，
+// 已存在相同邮箱的账号时返回 409（overwrite 为 true 时覆盖）
+func HandleAddAccount(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+		AccessToken  string `json:"access_token"`
+		Email        string `json:"email"`
+		ProjectID    string `json:"projectId"`
+		Endpoint     string `json:"endpoint"`
+		Note         string `json:"note"`
+		Overwrite    bool   `json:"overwrite"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
+		return
+	}
+	req.RefreshToken = strings.TrimSpace(req.RefreshToken)
+	req.AccessToken = strings.TrimSpace(req.AccessToken)
+	if req.RefreshToken == "" && req.AccessToken == "" {
+		WriteError(w, http.StatusBadRequest, Message(w, "accounts.token_required"))
+		return
+	}
+	if err := store.ValidateNote(req.Note); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, ok := config.APIEndpoints[req.Endpoint]; req.Endpoint != "" && !ok {
+		WriteError(w, http.StatusBadRequest, Message(w, "endpoints.unknown", req.Endpoint))
+		return
+	}
+
+	account := store.Account{
+		AccessToken:  req.AccessToken,
+		RefreshToken: req.RefreshToken,
+		ProjectID:    strings.TrimSpace(req.ProjectID),
+		Email:        strings.TrimSpace(req.Email),
+		Endpoint:     req.Endpoint,
+		Note:         req.Note,
+		Enable:       true,
+	}
+	if account.RefreshToken != "" {
+		if err := store.ValidateCredentials(r.Context(), &account); err != nil {
+			WriteError(w, http.StatusBadRequest, Message(w, "accounts.invalid_credential", err))
+			return
+		}
+	} else {
+		account.Type = store.CredentialStatic
+	}
+
+	// 只有 access_token 时用户信息请求即为校验；刷新成功后仅用于补全邮箱
+	userInfo, err := auth.GetUserInfo(account.AccessToken)
+	if err != nil && account.Type == store.CredentialStatic {
+		WriteError(w, http.StatusBadRequest, Message(w, "accounts.invalid_credential", err))
+		return
+	}
+	if account.Email == "" && userInfo != nil {
+		account.Email = userInfo.Email
+	}
+
+	stored, err := store.GetAccountStore().Create(r.Context(), account, req.Overwrite)
+	if err != nil {
+		if errors.Is(err, store.ErrAccountExists) {
+			WriteError(w, http.StatusConflict, Message(w, "accounts.exists"))
+			return
+		}
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"account": map[string]interface{}{
+			"id":             stored.ID,
+			"index":          stored.Index,
+			"email":          maskEmail(stored.Email),
+			"projectId":      stored.ProjectID,
+			"credentialType": stored.CredentialType(),
+			"accessToken":    maskString(stored.AccessToken),
+			"refreshToken":   maskString(stored.RefreshToken),
+			"enable":         stored.Enable,
+			"endpoint":       stored.Endpoint,
+			"note":           stored.Note,
+			"tenant":         stored.Tenant,
+			"createdAt":      stored.CreatedAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// HandleUpdateAccount 更新账号属性（仅更新请求中提供的字段）
+func HandleUpdateAccount(w http.ResponseWriter, r *http.Request) {
+	indexStr := r.PathValue("index")
+	index, err := strconv.Atoi(indexStr)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "accounts.invalid_index"))
+		return
+	}
+
+	var req struct {
+		Endpoint  *string                `json:"endpoint"`
+		ProjectID *string                `json:"projectId"`
+		Note      *string                `json:"note"`
+		Labels    map[string]string      `json:"labels"`   // 提供时整体替换，传 {} 清空
+		Tenant    *string                `json:"tenant"`   // 仅超级管理员可修改
+		Schedule  *store.AccountSchedule `json:"schedule"` // 提供时整体替换，windows 为空时清除
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
+		return
+	}
+
+	// 先校验全部字段，避免部分更新
+	if req.Note != nil {
+		if err := store.ValidateNote(*req.Note); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Labels != nil {
+		if err := store.ValidateLabels(req.Labels); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Schedule != nil && len(req.Schedule.Windows) > 0 {
+		if err := req.Schedule.Validate(); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	accountStore := store.GetAccountStore()
+	if req.Tenant != nil {
+		if err := accountStore.SetTenant(r.Context(), index, *req.Tenant); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Endpoint != nil {
+		if err := accountStore.SetEndpoint(r.Context(), index, *req.Endpoint); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.ProjectID != nil {
+		if err := accountStore.SetProjectID(r.Context(), index, *req.ProjectID); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Note != nil {
+		if err := accountStore.SetNote(r.Context(), index, *req.Note); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Labels != nil {
+		if err := accountStore.SetLabels(r.Context(), index, req.Labels); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Schedule != nil {
+		if err := accountStore.SetSchedule(r.Context(), index, req.Schedule); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// HandleDeleteAccount 删除账号（排空宽限期内需要 ?force=true）
 func HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
 	indexStr := r.PathValue("index")
 	index, err := strconv.Atoi(indexStr)
 	if err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid index")
+		WriteError(w, http.StatusBadRequest, Message(w, "accounts.invalid_index"))
 		return
 	}
 
-	if err := store.GetAccountStore().Delete(index); err != nil {
+	force := r.URL.Query().Get("force") == "true"
+	if err := store.GetAccountStore().Delete(r.Context(), index, force); err != nil {
+		if errors.Is(err, store.ErrAccountDraining) {
+			WriteError(w, http.StatusConflict, err.Error())
+			return
+		}
 		WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	WriteJSON(w, http.StatusOK, map[string]bool{"success": true})
 }
+
+// HandleGetWebhooks 获取 Webhook 告警配置
+func HandleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, notify.Get().Status())
+}
+
+// HandleTestWebhooks 发送测试告警
+func HandleTestWebhooks(w http.ResponseWriter, r *http.Request) {
+	n := notify.Get()
+	if !n.Enabled() {
+		WriteError(w, http.StatusBadRequest, Message(w, "notify.no_webhooks"))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"results": n.SendTest(),
+	})
+}
+
+// HandlePostProcessDryRun 使用已存储的响应预览后处理效果
+func HandlePostProcessDryRun(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		LogID   string `json:"logId"`
+		Model   string `json:"model"`
+		Content string `json:"content"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
+		return
+	}
+
+	before := req.Content
+	model := req.Model
+	if req.LogID != "" {
+		log := store.GetLogStore().GetByID(r.Context(), req.LogID)
+		if log == nil || log.Detail == nil || log.Detail.Response == nil {
+			WriteError(w, http.StatusNotFound, Message(w, "logs.not_found"))
+			return
+		}
+		before = log.Detail.Response.ModelOutput
+		if model == "" {
+			model = log.Model
+		}
+	}
+
+	after, applied := postprocess.Apply(model, before, false)
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"model":   model,
+		"before":  before,
+		"after":   after,
+		"applied": applied,
+		"rules":   len(postprocess.Rules()),
+	})
+}
+
+// HandleGetValidators 获取响应校验器及统计
+func HandleGetValidators(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, validate.Stats())
+}
+
+// HandleGetSpillStats 获取大响应落盘统计
+func HandleGetSpillStats(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, store.GetSpillStore().Stats())
+}
+
+// HandleGetDebug 获取当前日志级别
+func HandleGetDebug(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, logger.DebugState())
+}
+
+// HandleSetDebug 运行时修改日志级别（无需重启）
+func HandleSetDebug(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Level string   `json:"level"`
+		Scope []string `json:"scope"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
+		return
+	}
+
+	if !logger.ValidLevel(req.Level) {
+		WriteError(w, http.StatusBadRequest, Message(w, "logger.invalid_level", req.Level))
+		return
+	}
+	for _, c := range req.Scope {
+		if !isLogComponent(c) {
+			WriteError(w, http.StatusBadRequest, Message(w, "logger.unknown_component", c, strings.Join(logger.Components, ", ")))
+			return
+		}
+	}
+
+	ttl := time.Duration(config.Get().DebugVerboseTTL) * time.Minute
+	logger.ApplyDebug(logger.ParseLevel(req.Level), req.Scope, ttl)
+
+	state := logger.DebugState()
+	state["success"] = true
+	WriteJSON(w, http.StatusOK, state)
+}
+
+func isLogComponent(name string) bool {
+	for _, c := range logger.Components {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleGetChaos 列出故障注入规则
+func HandleGetChaos(w http.ResponseWriter, r *http.Request) {
+	engine := chaos.Get()
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":  engine.Enabled(),
+		"rules":    engine.List(),
+		"injected": chaos.Injected(),
+	})
+}
+
+// HandleAddChaos 添加故障注入规则
+func HandleAddChaos(w http.ResponseWriter, r *http.Request) {
+	engine := chaos.Get()
+	if !engine.Enabled() {
+		WriteError(w, http.StatusForbidden, Message(w, "chaos.disabled"))
+		return
+	}
+
+	var req chaos.Rule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
+		return
+	}
+
+	rule, err := engine.Add(req)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"rule":    rule,
+	})
+}
+
+// HandleDeleteChaos 删除故障注入规则（id 为 all 时清空）
+func HandleDeleteChaos(w http.ResponseWriter, r *http.Request) {
+	engine := chaos.Get()
+	id := r.PathValue("id")
+	if id == "all" {
+		engine.Clear()
+	} else if !engine.Remove(id) {
+		WriteError(w, http.StatusNotFound, Message(w, "chaos.rule_not_found"))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// HandleGetModelConfigs 获取模型配置（models.json 中的配置项及各模型生效值）
+func HandleGetModelConfigs(w http.ResponseWriter, r *http.Request) {
+	effective := make(map[string]converter.ModelConfig, len(converter.SupportedModels))
+	for _, m := range converter.SupportedModels {
+		effective[m.ID] = converter.GetModelConfig(m.ID)
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"entries":   converter.ModelConfigEntries(),
+		"effective": effective,
+	})
+}
+
+// HandleSetModelConfig 设置模型配置（name 为 * 时作用于所有模型）
+func HandleSetModelConfig(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	var req converter.ModelConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
+		return
+	}
+
+	if err := converter.SetModelConfig(name, req); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"effective": converter.GetModelConfig(name),
+	})
+}
+
+// HandleDeleteModelConfig 删除模型配置（恢复默认值）
+func HandleDeleteModelConfig(w http.ResponseWriter, r *http.Request) {
+	deleted, err := converter.DeleteModelConfig(r.PathValue("name"))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !deleted {
+		WriteError(w, http.StatusNotFound, Message(w, "models.config_not_found"))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// HandleGetCapabilityProbe 获取能力探测状态：是否进行中、最近一次报告、当日额度
+func HandleGetCapabilityProbe(w http.ResponseWriter, r *http.Request) {
+	cfg := config.Get()
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":       capability.Enabled(),
+		"account":       cfg.CapProbeAccount,
+		"running":       capability.Running(),
+		"budget":        converter.ProbeBudgetUsage(),
+		"dailyLimit":    cfg.CapProbeDailyLimit,
+		"intervalHours": cfg.CapProbeInterval,
+		"last":          capability.LastReport(),
+	})
+}
+
+// HandleRunCapabilityProbe 在后台开始能力探测（models 为空时探测所有模型）
+func HandleRunCapabilityProbe(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Models []string `json:"models"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_body", err))
+		return
+	}
+	for _, model := range req.Models {
+		if !isSupportedModel(model) {
+			WriteError(w, http.StatusBadRequest, Message(w, "models.not_found", model))
+			return
+		}
+	}
+
+	switch err := capability.Trigger(req.Models); {
+	case errors.Is(err, capability.ErrDisabled):
+		WriteError(w, http.StatusConflict, Message(w, "models.probe_disabled"))
+		return
+	case errors.Is(err, capability.ErrRunning):
+		WriteError(w, http.StatusConflict, Message(w, "models.probe_running"))
+		return
+	}
+
+	WriteJSON(w, http.StatusAccepted, map[string]interface{}{
+		"success": true,
+		"budget":  converter.ProbeBudgetUsage(),
+	})
+}
+
+func isSupportedModel(id string) bool {
+	for _, m := range converter.SupportedModels {
+		if m.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleGetTenants 列出租户（API Key 脱敏）
+func HandleGetTenants(w http.ResponseWriter, r *http.Request) {
+	accounts := store.GetAccountStore().GetAll(r.Context())
+
+	tenants := store.GetTenantStore().List()
+	result := make([]map[string]interface{}, 0, len(tenants))
+	for _, t := range tenants {
+		keys := make([]string, len(t.APIKeys))
+		for i, k := range t.APIKeys {
+			keys[i] = maskString(k)
+		}
+		count := 0
+		for _, a := range accounts {
+			if a.Tenant == t.Name {
+				count++
+			}
+		}
+		result = append(result, map[string]interface{}{
+			"name":      t.Name,
+			"apiKeys":   keys,
+			"panelUser": t.PanelUser,
+			"panelRole": t.PanelRoleOrDefault(),
+			"accounts":  count,
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"tenants": result,
+	})
+}
+
+// HandleGetAudit 获取最近的审计记录（GET /admin/audit?limit=100）
+func HandleGetAudit(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_limit"))
+			return
+		}
+		limit = n
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": store.GetAuditLog().Recent(limit),
+	})
+}
+
+// HandleExportUsage 导出用量 CSV（GET /admin/usage/export?from=YYYY-MM-DD&to=YYYY-MM-DD&group_by=model,account,key）
+func HandleExportUsage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to := query.Get("from"), query.Get("to")
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_date_range"))
+			return
+		}
+	}
+	if from != "" && to != "" && from > to {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.date_range_order"))
+		return
+	}
+	groupBy, err := store.ParseUsageGroupBy(query.Get("group_by"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := "usage"
+	if from != "" {
+		name += "-" + from
+	}
+	if to != "" {
+		name += "-" + to
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+	w.WriteHeader(http.StatusOK)
+
+	if err := store.WriteUsageCSV(w, store.GetUsageLedger().Range(from, to), groupBy); err != nil {
+		logger.Warn("Usage export aborted: %v", err)
+	}
+}
+
+// affinityKeyPrefix 管理接口展示的会话标识前缀（解除绑定时按前缀匹配）
+const affinityKeyPrefix = 8
+
+// HandleGetAffinity 查看会话绑定和命中率（会话标识、账号邮箱脱敏）
+func HandleGetAffinity(w http.ResponseWriter, r *http.Request) {
+	emails := make(map[string]string)
+	for _, a := range store.GetAccountStore().GetAll(r.Context()) {
+		emails[a.ID] = a.Email
+	}
+
+	affinity := store.GetConversationMap()
+	bindings := affinity.Bindings()
+	result := make([]map[string]interface{}, 0, len(bindings))
+	for _, b := range bindings {
+		email, ok := emails[b.AccountID]
+		if !ok {
+			// 不可见（其他租户）的账号不展示
+			continue
+		}
+		key := b.Key
+		if len(key) > affinityKeyPrefix {
+			key = key[:affinityKeyPrefix]
+		}
+		item := map[string]interface{}{
+			"key":       key,
+			"accountId": b.AccountID,
+			"email":     maskEmail(email),
+			"boundAt":   b.BoundAt,
+			"lastSeen":  b.LastSeen,
+			"hits":      b.Hits,
+		}
+		if from, ok := emails[b.ReboundFrom]; ok {
+			item["reboundFrom"] = maskEmail(from)
+		}
+		result = append(result, item)
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":  config.Get().ConversationAffinity,
+		"stats":    affinity.Stats(),
+		"atRisk":   store.ConversationsAtRisk(r.Context()),
+		"bindings": result,
+	})
+}
+
+// HandleDeleteAffinity 强制解除会话绑定（key 为列表中展示的前缀）
+func HandleDeleteAffinity(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if len(key) < affinityKeyPrefix {
+		WriteError(w, http.StatusBadRequest, Message(w, "affinity.key_too_short", affinityKeyPrefix))
+		return
+	}
+	removed := store.GetConversationMap().InvalidatePrefix(key, store.UnbindManual)
+	if removed == 0 {
+		WriteError(w, http.StatusNotFound, Message(w, "affinity.binding_not_found"))
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true, "removed": removed})
+}
@@ -24,22 +24,33 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request")
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
 		return
 	}
 
 	cfg := config.Get()
-	if req.Username != cfg.PanelUser || req.Password != cfg.PanelPassword {
-		WriteError(w, http.StatusUnauthorized, "Invalid credentials")
+	var token, role string
+	if req.Username == cfg.PanelUser && req.Password == cfg.PanelPassword {
+		role = store.RoleAdmin
+		token = auth.CreateSession("", req.Username, role)
+	} else if user := store.GetPanelAccessStore().ByCredentials(req.Username, req.Password); user != nil {
+		role = user.Role
+		token = auth.CreateSession("", user.User, role)
+	} else if tenant := store.GetTenantStore().ByPanelCredentials(req.Username, req.Password); tenant != nil {
+		// 租户管理员只能看到本租户的数据
+		role = tenant.PanelRoleOrDefault()
+		token = auth.CreateSession(tenant.Name, req.Username, role)
+	} else {
+		WriteError(w, http.StatusUnauthorized, Message(w, "auth.invalid_credentials"))
 		return
 	}
 
-	token := auth.CreateSession()
-	auth.SetSessionCookie(w, token)
+	auth.SetSessionCookie(w, token, role)
 
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"token":   token,
+		"role":    role,
 	})
 }
 
@@ -146,7 +157,7 @@ func HandleParseOAuthURL(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request")
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid"))
 		return
 	}
 
@@ -181,6 +192,9 @@ func HandleParseOAuthURL(w http.ResponseWriter, r *http.Request) {
 		Email:        email,
 		Enable:       true,
 	}
+	if tenant, ok := store.TenantFromContext(r.Context()); ok {
+		account.Tenant = tenant
+	}
 
 	if err := store.GetAccountStore().Add(account); err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/persist"
+)
+
+// maxRestoreArchiveSize 恢复上传的归档大小上限
+const maxRestoreArchiveSize = 512 << 20
+
+// HandleBackup 将所有数据文件打包为 tar.gz 下载（POST /admin/backup）
+func HandleBackup(w http.ResponseWriter, r *http.Request) {
+	// 先写入缓冲区，打包失败时仍可返回错误状态码
+	var buf bytes.Buffer
+	included, err := persist.WriteBackup(&buf)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, Message(w, "backup.failed", err))
+		return
+	}
+
+	name := fmt.Sprintf("anti2api-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Content-Length", fmt.Sprint(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, &buf); err != nil {
+		logger.Warn("Backup download aborted: %v", err)
+		return
+	}
+	logger.Info("Backup created with %d data files", len(included))
+}
+
+// HandleRestore 从 HandleBackup 生成的 tar.gz 恢复数据文件（POST /admin/restore，请求体为归档内容）
+func HandleRestore(w http.ResponseWriter, r *http.Request) {
+	result, err := persist.Restore(http.MaxBytesReader(w, r.Body, maxRestoreArchiveSize))
+	if err != nil {
+		status := http.StatusBadRequest
+		// 已经开始写入时的失败属于服务端错误
+		if result != nil {
+			status = http.StatusInternalServerError
+		}
+		WriteError(w, status, Message(w, "backup.restore_failed", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"result":  result,
+	})
+}
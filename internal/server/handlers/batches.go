@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/utils"
+)
+
+// batchEndpoint 批处理支持的接口
+const batchEndpoint = "/v1/chat/completions"
+
+// HandleUploadFile 上传批处理文件（multipart：file、purpose=batch）
+func HandleUploadFile(w http.ResponseWriter, r *http.Request) {
+	files := store.GetFileStore()
+	if max := files.MaxFileSize(); max > 0 {
+		// 预留 multipart 表单开销
+		r.Body = http.MaxBytesReader(w, r.Body, int64(max)+1<<20)
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteError(w, http.StatusRequestEntityTooLarge, store.ErrFileTooLarge.Error())
+			return
+		}
+		WriteError(w, http.StatusBadRequest, Message(w, "batch.invalid_form", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	purpose := r.FormValue("purpose")
+	if purpose != store.FilePurposeBatch {
+		WriteParamError(w, http.StatusBadRequest, Message(w, "batch.purpose_unsupported"), "purpose", "invalid_value")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		WriteParamError(w, http.StatusBadRequest, Message(w, "batch.missing_file"), "file", "missing_required_parameter")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "batch.read_failed", err))
+		return
+	}
+
+	stored, err := files.Add(apiKeyHash(r), header.Filename, purpose, data)
+	if err != nil {
+		WriteError(w, fileErrorStatus(err), err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, stored)
+}
+
+// HandleListFiles 列出文件（?purpose= 过滤）
+func HandleListFiles(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"object": "list",
+		"data":   store.GetFileStore().List(apiKeyHash(r), r.URL.Query().Get("purpose")),
+	})
+}
+
+// HandleGetFile 获取文件对象
+func HandleGetFile(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	file := store.GetFileStore().Get(id, apiKeyHash(r))
+	if file == nil {
+		WriteError(w, http.StatusNotFound, Message(w, "batch.file_not_found", id))
+		return
+	}
+	WriteJSON(w, http.StatusOK, file)
+}
+
+// HandleGetFileContent 下载文件内容
+func HandleGetFileContent(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	data, err := store.GetFileStore().Content(id, apiKeyHash(r))
+	if err != nil {
+		WriteError(w, http.StatusNotFound, Message(w, "batch.file_not_found", id))
+		return
+	}
+	w.Header().Set("Content-Type", "application/jsonl")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// HandleDeleteFile 删除文件
+func HandleDeleteFile(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !store.GetFileStore().Delete(id, apiKeyHash(r)) {
+		WriteError(w, http.StatusNotFound, Message(w, "batch.file_not_found", id))
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"object":  "file",
+		"id":      id,
+		"deleted": true,
+	})
+}
+
+func fileErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrFileTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, store.ErrFileQuota), errors.Is(err, store.ErrFileStorageFull):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// HandleCreateBatch 创建批处理：校验输入文件后在后台执行
+func HandleCreateBatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		InputFileID      string            `json:"input_file_id"`
+		Endpoint         string            `json:"endpoint"`
+		CompletionWindow string            `json:"completion_window"`
+		Metadata         map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_body", err))
+		return
+	}
+	if req.Endpoint != batchEndpoint {
+		WriteParamError(w, http.StatusBadRequest, Message(w, "batch.endpoint_unsupported", batchEndpoint), "endpoint", "invalid_value")
+		return
+	}
+	if req.CompletionWindow == "" {
+		req.CompletionWindow = "24h"
+	}
+
+	keyHash := apiKeyHash(r)
+	input := store.GetFileStore().Get(req.InputFileID, keyHash)
+	if input == nil {
+		WriteParamError(w, http.StatusBadRequest, Message(w, "batch.input_file_not_found", req.InputFileID), "input_file_id", "invalid_value")
+		return
+	}
+	if input.Purpose != store.FilePurposeBatch {
+		WriteParamError(w, http.StatusBadRequest, Message(w, "batch.input_file_purpose"), "input_file_id", "invalid_value")
+		return
+	}
+
+	batch, err := store.GetBatchStore().Create(keyHash, req.Endpoint, req.InputFileID, req.CompletionWindow, req.Metadata, config.Get().BatchMaxActive)
+	if err != nil {
+		WriteError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+
+	// 批处理中的请求以创建者的身份执行（同一 API Key、租户），不随创建请求结束而取消
+	ctx := context.Background()
+	if tenant, ok := store.TenantFromContext(r.Context()); ok {
+		ctx = store.WithTenant(ctx, tenant)
+	}
+	runner := &batchRunner{
+		id:            batch.ID,
+		keyHash:       keyHash,
+		inputFileID:   req.InputFileID,
+		authorization: r.Header.Get("Authorization"),
+		apiKey:        ExtractAPIKey(r),
+	}
+	go monitor.Do(ctx, "batch", runner.run)
+
+	WriteJSON(w, http.StatusOK, batch)
+}
+
+// HandleGetBatch 获取批处理状态
+func HandleGetBatch(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	batch := store.GetBatchStore().Get(id, apiKeyHash(r))
+	if batch == nil {
+		WriteError(w, http.StatusNotFound, Message(w, "batch.not_found", id))
+		return
+	}
+	WriteJSON(w, http.StatusOK, batch)
+}
+
+// HandleListBatches 列出批处理
+func HandleListBatches(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"object": "list",
+		"data":   store.GetBatchStore().List(apiKeyHash(r)),
+	})
+}
+
+// batchRequest 输入文件中的一行
+type batchRequest struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// batchResult 输出文件中的一行
+type batchResult struct {
+	ID       string               `json:"id"`
+	CustomID string               `json:"custom_id"`
+	Response *batchResultResponse `json:"response"`
+	Error    interface{}          `json:"error"`
+}
+
+type batchResultResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// batchRunner 执行一个批处理
+type batchRunner struct {
+	id            string
+	keyHash       string
+	inputFileID   string
+	authorization string
+	apiKey        string
+}
+
+func (b *batchRunner) run(ctx context.Context) {
+	files := store.GetFileStore()
+	batches := store.GetBatchStore()
+
+	data, err := files.Content(b.inputFileID, b.keyHash)
+	if err != nil {
+		b.fail("invalid_file", "input file is no longer available", nil)
+		return
+	}
+	requests, line, err := parseBatchInput(data)
+	if err != nil {
+		b.fail("invalid_request", err.Error(), line)
+		return
+	}
+
+	now := time.Now().Unix()
+	batches.Update(b.id, func(batch *store.Batch) {
+		batch.Status = store.BatchInProgress
+		batch.InProgressAt = &now
+		batch.RequestCounts.Total = len(requests)
+	})
+	logger.Info("Batch %s started: %d requests", b.id, len(requests))
+
+	// 固定数量的 worker 并发执行，结果按输入顺序写出
+	results := make([]batchResult, len(requests))
+	succeeded := make([]bool, len(requests))
+	workers := config.Get().BatchConcurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				results[idx], succeeded[idx] = b.execute(ctx, requests[idx])
+				ok := succeeded[idx]
+				batches.Update(b.id, func(batch *store.Batch) {
+					if ok {
+						batch.RequestCounts.Completed++
+					} else {
+						batch.RequestCounts.Failed++
+					}
+				})
+			}
+		}()
+	}
+	for i := range requests {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var output, errorOutput bytes.Buffer
+	for i, result := range results {
+		line, _ := json.Marshal(result)
+		target := &output
+		if !succeeded[i] {
+			target = &errorOutput
+		}
+		target.Write(line)
+		target.WriteByte('\n')
+	}
+
+	outputID, err := b.saveOutput(output.Bytes(), "output")
+	if err != nil {
+		b.fail("output_storage", "failed to store output file: "+err.Error(), nil)
+		return
+	}
+	errorID, err := b.saveOutput(errorOutput.Bytes(), "errors")
+	if err != nil {
+		b.fail("output_storage", "failed to store error file: "+err.Error(), nil)
+		return
+	}
+
+	completedAt := time.Now().Unix()
+	var counts store.BatchCounts
+	batches.Update(b.id, func(batch *store.Batch) {
+		batch.Status = store.BatchCompleted
+		batch.CompletedAt = &completedAt
+		batch.OutputFileID = outputID
+		batch.ErrorFileID = errorID
+		counts = batch.RequestCounts
+	})
+	logger.Info("Batch %s completed: %d succeeded, %d failed", b.id, counts.Completed, counts.Failed)
+}
+
+// saveOutput 保存结果文件，没有内容时返回 nil
+func (b *batchRunner) saveOutput(data []byte, kind string) (*string, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	file, err := store.GetFileStore().Add(b.keyHash, b.id+"_"+kind+".jsonl", store.FilePurposeBatchOutput, data)
+	if err != nil {
+		return nil, err
+	}
+	return &file.ID, nil
+}
+
+// fail 批处理失败（line 为出错的输入行号，从 1 开始）
+func (b *batchRunner) fail(code, message string, line *int) {
+	failedAt := time.Now().Unix()
+	store.GetBatchStore().Update(b.id, func(batch *store.Batch) {
+		batch.Status = store.BatchFailed
+		batch.FailedAt = &failedAt
+		batch.Errors = &store.BatchErrors{
+			Object: "list",
+			Data:   []store.BatchError{{Code: code, Message: message, Line: line}},
+		}
+	})
+	logger.Warn("Batch %s failed: %s", b.id, message)
+}
+
+// execute 在进程内执行一条请求（强制非流式）
+func (b *batchRunner) execute(ctx context.Context, item batchRequest) (batchResult, bool) {
+	result := batchResult{ID: "batch_req_" + utils.GenerateSecureToken(12), CustomID: item.CustomID}
+
+	var body map[string]interface{}
+	json.Unmarshal(item.Body, &body)
+	body["stream"] = false
+	payload, _ := json.Marshal(body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, item.URL, bytes.NewReader(payload))
+	if err != nil {
+		result.Error = map[string]string{"code": "invalid_request", "message": err.Error()}
+		return result, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.authorization != "" {
+		req.Header.Set("Authorization", b.authorization)
+	} else if b.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.apiKey)
+	}
+
+	rec := &batchRecorder{header: make(http.Header)}
+	Recover(http.HandlerFunc(HandleChatCompletions)).ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	var meta struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(rec.body.Bytes(), &meta)
+	result.Response = &batchResultResponse{
+		StatusCode: rec.status,
+		RequestID:  meta.ID,
+		Body:       json.RawMessage(rec.body.Bytes()),
+	}
+	if !json.Valid(result.Response.Body) {
+		result.Response.Body, _ = json.Marshal(rec.body.String())
+	}
+	return result, rec.status < 300
+}
+
+// parseBatchInput 校验并解析 JSONL 输入，出错时返回行号
+func parseBatchInput(data []byte) ([]batchRequest, *int, error) {
+	maxRequests := config.Get().BatchMaxRequests
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+
+	var requests []batchRequest
+	seen := make(map[string]bool)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		line := lineNo
+		var item batchRequest
+		if err := json.Unmarshal([]byte(text), &item); err != nil {
+			return nil, &line, fmt.Errorf("line %d is not valid JSON: %v", line, err)
+		}
+		switch {
+		case item.CustomID == "":
+			return nil, &line, fmt.Errorf("line %d: custom_id is required", line)
+		case seen[item.CustomID]:
+			return nil, &line, fmt.Errorf("line %d: duplicate custom_id %q", line, item.CustomID)
+		case !strings.EqualFold(item.Method, http.MethodPost):
+			return nil, &line, fmt.Errorf("line %d: method must be POST", line)
+		case item.URL != batchEndpoint:
+			return nil, &line, fmt.Errorf("line %d: url must be %s", line, batchEndpoint)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(item.Body, &body); err != nil || body == nil {
+			return nil, &line, fmt.Errorf("line %d: body must be a JSON object", line)
+		}
+		seen[item.CustomID] = true
+		requests = append(requests, item)
+		if maxRequests > 0 && len(requests) > maxRequests {
+			return nil, &line, fmt.Errorf("batch exceeds the maximum of %d requests", maxRequests)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(requests) == 0 {
+		return nil, nil, errors.New("input file contains no requests")
+	}
+	return requests, nil, nil
+}
+
+// batchRecorder 记录进程内请求的响应
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *batchRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *batchRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *batchRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
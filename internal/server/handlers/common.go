@@ -1,13 +1,42 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/notify"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/tracing"
+	"anti2api-golang/internal/utils"
+	"anti2api-golang/internal/version"
 )
 
-// WriteJSON 写入 JSON 响应
+// WriteJSON 写入 JSON 响应（协商了 NDJSON 或 MessagePack 时按协商的格式编码）
 func WriteJSON(w http.ResponseWriter, status int, data interface{}) {
+	switch responseFormat(w) {
+	case formatMsgpack:
+		if body, err := utils.MarshalMsgpack(data); err == nil {
+			w.Header().Set("Content-Type", formatMsgpack)
+			w.WriteHeader(status)
+			w.Write(body)
+			return
+		}
+	case formatNDJSON:
+		// 一行一个 JSON 对象（Encode 以换行结尾）
+		w.Header().Set("Content-Type", formatNDJSON)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(data)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(data)
@@ -23,21 +52,214 @@ func WriteError(w http.ResponseWriter, status int, message string) {
 	})
 }
 
-func getErrorType(status int) string {
-	switch {
-	case status == 400:
-		return "invalid_request_error"
-	case status == 401:
-		return "authentication_error"
-	case status == 403:
-		return "permission_error"
-	case status == 404:
-		return "not_found_error"
-	case status == 429:
-		return "rate_limit_error"
-	default:
-		return "server_error"
+// WriteParamError 写入指向具体请求参数的错误响应
+func WriteParamError(w http.ResponseWriter, status int, message, param, code string) {
+	WriteJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    getErrorType(status),
+			"param":   param,
+			"code":    code,
+		},
+	})
+}
+
+// ExtractAPIKey 从请求中提取客户端提供的 API Key
+func ExtractAPIKey(r *http.Request) string {
+	// 1. Authorization header: Bearer sk-xxx 或直接 sk-xxx
+	if key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); key != "" {
+		return key
+	}
+	// 2. x-goog-api-key header (Gemini 标准)
+	if key := r.Header.Get("x-goog-api-key"); key != "" {
+		return key
+	}
+	// 3. x-api-key header (Anthropic 标准)
+	if key := r.Header.Get("x-api-key"); key != "" {
+		return key
 	}
+	// 4. Query 参数 ?key=
+	return r.URL.Query().Get("key")
+}
+
+// CloseUnreadBody 读取请求体之前拒绝请求时调用：响应后关闭连接，客户端不必上传剩余的请求体。
+// 带 Expect: 100-continue 的请求在第一次读取请求体时才发送 100 Continue，提前拒绝时客户端不会开始上传
+func CloseUnreadBody(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength != 0 {
+		w.Header().Set("Connection", "close")
+	}
+}
+
+// EndpointOverrideHeader 请求级端点覆盖请求头
+const EndpointOverrideHeader = "X-Antigravity-Endpoint"
+
+// acquireToken 为请求选择账号；请求指定端点时只选择兼容该端点的账号，
+// 并返回携带端点覆盖的请求。失败时已写入错误响应
+func acquireToken(w http.ResponseWriter, r *http.Request) (*http.Request, *store.Account, bool) {
+	r = withRouteTrace(withFreshSession(r))
+
+	// 账号选择的 span 只传给账号存储（记录跳过的账号），不作为后续上游调用的父 span
+	selectCtx, span := tracing.Start(r.Context(), "account.select")
+	defer span.End()
+
+	// 透传凭证优先，不经过账号存储
+	if token, ok, handled := passthroughToken(w, r); handled {
+		span.SetAttr("account.passthrough", true)
+		if !ok {
+			return r, nil, false
+		}
+		return withEndpointOverride(w, r, token)
+	}
+
+	accountStore := store.GetAccountStore()
+
+	endpoint := r.Header.Get(EndpointOverrideHeader)
+	if endpoint == "" {
+		token, err := accountStore.GetToken(selectCtx)
+		if err != nil {
+			span.SetError(err)
+			writeNoAccountError(w, r, err)
+			return r, nil, false
+		}
+		span.SetAttr("account.id", token.ID)
+		return r, token, true
+	}
+
+	span.SetAttr("account.endpoint_override", endpoint)
+	if _, ok := config.APIEndpoints[endpoint]; !ok {
+		WriteError(w, http.StatusBadRequest, Message(w, "endpoints.unknown", endpoint))
+		return r, nil, false
+	}
+
+	token, err := accountStore.GetTokenForEndpoint(selectCtx, endpoint)
+	if err != nil {
+		span.SetError(err)
+		writeNoAccountError(w, r, err)
+		return r, nil, false
+	}
+	span.SetAttr("account.id", token.ID)
+	return r.WithContext(api.WithEndpoint(r.Context(), endpoint)), token, true
+}
+
+// writeNoAccountError 没有可用账号时返回 503，所有账号都不在可用时间段内时附带 Retry-After
+func writeNoAccountError(w http.ResponseWriter, r *http.Request, err error) {
+	var scheduleErr *store.ScheduleError
+	if !errors.As(err, &scheduleErr) {
+		writeRouteError(w, r, http.StatusServiceUnavailable, Message(w, "accounts.unavailable"))
+		return
+	}
+	if scheduleErr.Next.IsZero() {
+		writeRouteError(w, r, http.StatusServiceUnavailable, Message(w, "accounts.off_schedule"))
+		return
+	}
+	if seconds := scheduleErr.RetryAfter(time.Now()); seconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+	writeRouteError(w, r, http.StatusServiceUnavailable, Message(w, "accounts.off_schedule_until", scheduleErr.Next.Format(time.RFC3339)))
+}
+
+// FreshSessionHeader 要求本次请求使用的账号先生成新的 SessionID
+const FreshSessionHeader = "X-Fresh-Session"
+
+// withFreshSession 请求头要求新会话时写入 context
+func withFreshSession(r *http.Request) *http.Request {
+	if fresh, _ := strconv.ParseBool(r.Header.Get(FreshSessionHeader)); fresh {
+		return r.WithContext(store.WithFreshSession(r.Context()))
+	}
+	return r
+}
+
+// 透传模式请求头
+const (
+	UpstreamTokenHeader   = "X-Upstream-Token"
+	UpstreamProjectHeader = "X-Upstream-Project"
+)
+
+// passthroughToken 使用请求头中的上游凭证构造临时账号；handled 为 false 表示请求未使用透传
+func passthroughToken(w http.ResponseWriter, r *http.Request) (token *store.Account, ok bool, handled bool) {
+	accessToken := strings.TrimSpace(strings.TrimPrefix(r.Header.Get(UpstreamTokenHeader), "Bearer "))
+	if accessToken == "" {
+		if r.Header.Get(UpstreamTokenHeader) != "" {
+			WriteError(w, http.StatusUnauthorized, Message(w, "passthrough.empty_token", UpstreamTokenHeader))
+			return nil, false, true
+		}
+		return nil, false, false
+	}
+	if !config.Get().PassthroughEnabled {
+		WriteError(w, http.StatusForbidden, Message(w, "passthrough.disabled"))
+		return nil, false, true
+	}
+	project := strings.TrimSpace(r.Header.Get(UpstreamProjectHeader))
+	return store.NewPassthroughAccount(r.Context(), accessToken, project), true, true
+}
+
+// withEndpointOverride 透传账号按请求头指定端点（不校验账号兼容性）
+func withEndpointOverride(w http.ResponseWriter, r *http.Request, token *store.Account) (*http.Request, *store.Account, bool) {
+	endpoint := r.Header.Get(EndpointOverrideHeader)
+	if endpoint == "" {
+		return r, token, true
+	}
+	if _, ok := config.APIEndpoints[endpoint]; !ok {
+		WriteError(w, http.StatusBadRequest, Message(w, "endpoints.unknown", endpoint))
+		return r, nil, false
+	}
+	return r.WithContext(api.WithEndpoint(r.Context(), endpoint)), token, true
+}
+
+// StreamCoalesceHeader 请求级流式增量合并间隔（毫秒）
+const StreamCoalesceHeader = "X-Stream-Coalesce-Ms"
+
+// maxStreamCoalesce 请求可指定的最大合并间隔
+const maxStreamCoalesce = 2 * time.Second
+
+// newStreamWriter 创建流式写入器并按配置/请求头启用增量合并
+func newStreamWriter(w http.ResponseWriter, r *http.Request, id string, created int64, model string) *api.StreamWriter {
+	cfg := config.Get()
+	sw := api.NewStreamWriter(w, id, created, model)
+
+	interval := time.Duration(cfg.StreamCoalesceMs) * time.Millisecond
+	if v := r.Header.Get(StreamCoalesceHeader); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms >= 0 {
+			interval = time.Duration(ms) * time.Millisecond
+		}
+	}
+	if interval > maxStreamCoalesce {
+		interval = maxStreamCoalesce
+	}
+	if interval > 0 {
+		sw.SetCoalesce(interval, cfg.StreamCoalesceMaxBytes)
+	}
+	sw.SetHeartbeatStyle(cfg.StreamHeartbeatStyle)
+	sw.SetToolArgsFragment(cfg.ToolArgsFragmentSize)
+	if routeExplainAllowed(r) {
+		sw.SetRouteTrace(store.RouteTraceFromContext(r.Context()))
+	}
+	return sw
+}
+
+// cancelOnWriteError 向客户端写入失败时取消返回的 ctx，使上游流随之关闭
+// （客户端断开后服务端不一定能立即感知，写入失败是更早的信号）
+func cancelOnWriteError(ctx context.Context, sw *api.StreamWriter) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	sw.OnWriteError(func(err error) {
+		cancel(fmt.Errorf("client write failed: %w", err))
+	})
+	return ctx, func() { cancel(nil) }
+}
+
+// checkStreamSupport 流式请求开始前检查连接能否逐块输出，不能时直接返回非流式错误
+// （部分反向代理降级到 HTTP/1.0 或整体缓冲响应，继续流式输出会在首次刷新后卡住）
+func checkStreamSupport(w http.ResponseWriter, r *http.Request) bool {
+	if err := api.PrepareStream(w, r); err != nil {
+		logger.Warn("Streaming unavailable for %s %s (%s): %v", r.Method, r.URL.Path, r.Proto, err)
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func getErrorType(status int) string {
+	return api.ErrorType(status)
 }
 
 // HandleHealthz 健康检查
@@ -47,6 +269,36 @@ func HandleHealthz(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// HandleReadyz 就绪检查。日志子系统异常只作为警告返回（日志写入失败不影响请求处理）
+func HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	logHealth := store.GetLogStore().Health()
+	var warnings []string
+	if logHealth.Status != "ok" {
+		warnings = append(warnings, "logging degraded: log writes are being dropped or failing")
+	}
+	if len(warnings) > 0 {
+		notify.Fire(notify.EventReadinessFailure, "Readiness check reported degraded components", map[string]interface{}{
+			"warnings": warnings,
+			"logging":  logHealth.Status,
+		})
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "ok",
+		"warnings": warnings,
+		"checks": map[string]interface{}{
+			"logging": logHealth,
+		},
+	})
+}
+
+// HandleVersion 构建信息和运行时状态
+func HandleVersion(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"build":   version.Get(),
+		"runtime": version.Runtime(),
+	})
+}
+
 // HandleRoot 根路径处理
 func HandleRoot(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
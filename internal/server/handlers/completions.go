@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/store"
+)
+
+// apiKeyHash 计算请求 API Key 的哈希，用于隔离保存的完成结果
+func apiKeyHash(r *http.Request) string {
+	sum := sha256.Sum256([]byte(ExtractAPIKey(r)))
+	return hex.EncodeToString(sum[:])
+}
+
+// saveCompletion 保存聊天完成（仅当请求设置了 store: true）
+func saveCompletion(r *http.Request, req *converter.OpenAIChatRequest, completion *converter.OpenAIChatCompletion) {
+	if !req.Store || completion == nil {
+		return
+	}
+
+	completionJSON, err := json.Marshal(completion)
+	if err != nil {
+		logger.Warn("Failed to store completion %s: %v", completion.ID, err)
+		return
+	}
+	requestJSON, _ := json.Marshal(req)
+
+	store.GetCompletionStore().Add(&store.StoredCompletion{
+		ID:         completion.ID,
+		KeyHash:    apiKeyHash(r),
+		Completion: completionJSON,
+		Request:    requestJSON,
+	})
+}
+
+// HandleGetStoredCompletion 获取保存的聊天完成
+func HandleGetStoredCompletion(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	item := store.GetCompletionStore().Get(id, apiKeyHash(r))
+	if item == nil {
+		WriteError(w, http.StatusNotFound, Message(w, "completions.not_found", id))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(item.Completion)
+}
+
+// HandleDeleteStoredCompletion 删除保存的聊天完成
+func HandleDeleteStoredCompletion(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if !store.GetCompletionStore().Delete(id, apiKeyHash(r)) {
+		WriteError(w, http.StatusNotFound, Message(w, "completions.not_found", id))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"object":  "chat.completion.deleted",
+		"id":      id,
+		"deleted": true,
+	})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/store"
+)
+
+// 预览中使用的占位符（不包含任何真实账号数据）
+const (
+	previewProjectID = "<project-id>"
+	previewSessionID = "<session-id>"
+	previewRequestID = "<request-id>"
+)
+
+// HandleDebugConvert 预览请求转换后发往上游的内容（不调用上游）
+func HandleDebugConvert(w http.ResponseWriter, r *http.Request) {
+	if !config.Get().DebugConvertEnabled {
+		WriteError(w, http.StatusNotFound, Message(w, "request.not_found"))
+		return
+	}
+
+	req, err := converter.DecodeOpenAIChatRequest(r.Body)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_body", err))
+		return
+	}
+
+	// 估算和警告基于原始请求，转换过程会修改工具参数
+	estimate := converter.EstimateTokens(req)
+	warnings := converter.RequestWarnings(req)
+	req.ToolResults = toolResultPolicy(r)
+	issues := converter.CheckConversion(req).Issues
+
+	placeholder := &store.Account{
+		ProjectID: previewProjectID,
+		SessionID: previewSessionID,
+	}
+	antigravityReq := converter.ConvertOpenAIToAntigravity(req, placeholder)
+	antigravityReq.RequestID = previewRequestID
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"model":            req.Model,
+		"resolvedModel":    antigravityReq.Model,
+		"bypass":           converter.IsBypassModel(req.Model),
+		"modelConfig":      converter.GetModelConfig(req.Model),
+		"generationConfig": antigravityReq.Request.GenerationConfig,
+		"request":          antigravityReq,
+		"tokenEstimate":    estimate,
+		"warnings":         warnings,
+		"issues":           issues,
+	})
+}
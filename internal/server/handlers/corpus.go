@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/corpus"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/utils"
+)
+
+// corpusOptedIn 请求的 API Key 是否允许录制（租户按 corpus 字段，其他 Key 按 CORPUS_DEFAULT_OPT_IN）
+func corpusOptedIn(r *http.Request) bool {
+	if tenant := store.GetTenantStore().ByAPIKey(ExtractAPIKey(r)); tenant != nil {
+		return tenant.Corpus
+	}
+	return config.Get().CorpusDefaultOptIn
+}
+
+// mirrorToCorpus 将成功的请求/响应脱敏后异步写入评测语料（不阻塞请求）
+func mirrorToCorpus(r *http.Request, req *converter.OpenAIChatRequest, message converter.Message, finishReason string, usage *converter.Usage, duration time.Duration) {
+	recorder := corpus.Get()
+	if !recorder.ShouldSample() || !corpusOptedIn(r) {
+		return
+	}
+
+	includeImages := config.Get().CorpusIncludeImages
+	messages := make([]converter.OpenAIMessage, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = sanitizeCorpusMessage(msg, includeImages)
+	}
+
+	sample := &corpus.Sample{
+		ID:        utils.GenerateRequestID(),
+		Timestamp: time.Now(),
+		Model:     req.Model,
+		Request: map[string]interface{}{
+			"model":       req.Model,
+			"messages":    messages,
+			"tools":       req.Tools,
+			"tool_choice": req.ToolChoice,
+			"temperature": req.Temperature,
+			"top_p":       req.TopP,
+			"max_tokens":  req.MaxTokens,
+			"stop":        req.Stop,
+		},
+		Response: map[string]interface{}{
+			"message": sanitizeCorpusMessage(converter.OpenAIMessage{
+				Role:      "assistant",
+				Content:   message.Content,
+				ToolCalls: message.ToolCalls,
+				Reasoning: message.Reasoning,
+			}, includeImages),
+			"finish_reason": finishReason,
+		},
+		LatencyMs: duration.Milliseconds(),
+	}
+	if usage != nil {
+		sample.PromptTokens = usage.PromptTokens
+		sample.CompletionTokens = usage.CompletionTokens
+	}
+	recorder.Record(sample)
+}
+
+// sanitizeCorpusMessage 脱敏消息文本，默认把图片替换为占位文本
+func sanitizeCorpusMessage(msg converter.OpenAIMessage, includeImages bool) converter.OpenAIMessage {
+	switch v := msg.Content.(type) {
+	case string:
+		msg.Content = corpus.Redact(v)
+	case []interface{}:
+		parts := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch m["type"] {
+			case "text":
+				text, _ := m["text"].(string)
+				parts = append(parts, map[string]interface{}{"type": "text", "text": corpus.Redact(text)})
+			case "image_url":
+				if includeImages {
+					parts = append(parts, m)
+				} else {
+					parts = append(parts, map[string]interface{}{"type": "text", "text": "[image omitted]"})
+				}
+			}
+		}
+		msg.Content = parts
+	}
+
+	msg.Reasoning = corpus.Redact(msg.Reasoning)
+	msg.ReasoningContent = corpus.Redact(msg.ReasoningContent)
+	if len(msg.ToolCalls) > 0 {
+		calls := make([]converter.OpenAIToolCall, len(msg.ToolCalls))
+		for i, tc := range msg.ToolCalls {
+			tc.Function.Arguments = corpus.Redact(tc.Function.Arguments)
+			tc.ThoughtSignature = ""
+			calls[i] = tc
+		}
+		msg.ToolCalls = calls
+	}
+	return msg
+}
+
+// HandleGetCorpus 获取语料录制状态
+func HandleGetCorpus(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, corpus.Get().Stats())
+}
+
+// HandleStartCorpus 开始录制
+func HandleStartCorpus(w http.ResponseWriter, r *http.Request) {
+	recorder := corpus.Get()
+	if err := recorder.Start(); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, recorder.Stats())
+}
+
+// HandleStopCorpus 停止录制
+func HandleStopCorpus(w http.ResponseWriter, r *http.Request) {
+	recorder := corpus.Get()
+	recorder.Stop()
+	WriteJSON(w, http.StatusOK, recorder.Stats())
+}
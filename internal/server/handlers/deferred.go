@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/store"
+)
+
+const (
+	// DeferHeader 账号全部不可用时延迟重试，值为最长等待秒数（仅非流式请求）
+	DeferHeader = "X-Defer-On-Exhaustion"
+	// DeferCallbackHeader 延迟请求结束后推送结果的地址（可选）
+	DeferCallbackHeader = "X-Defer-Callback-URL"
+)
+
+// deferCallbackTimeout 推送结果的超时时间
+const deferCallbackTimeout = 10 * time.Second
+
+// parseDeferOptions 解析延迟重试请求头，返回最长等待时间（0 表示未开启），参数无效时写入 400 并返回 false
+func parseDeferOptions(w http.ResponseWriter, r *http.Request, req *converter.OpenAIChatRequest) (time.Duration, bool) {
+	value := strings.TrimSpace(r.Header.Get(DeferHeader))
+	if value == "" {
+		return 0, true
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		WriteError(w, http.StatusBadRequest, Message(w, "deferred.invalid_header", DeferHeader))
+		return 0, false
+	}
+	if req.Stream {
+		WriteError(w, http.StatusBadRequest, Message(w, "deferred.stream_unsupported", DeferHeader))
+		return 0, false
+	}
+	if max := config.Get().DeferredMaxWait; max > 0 && seconds > max {
+		seconds = max
+	}
+	if callback := r.Header.Get(DeferCallbackHeader); callback != "" {
+		if u, err := url.Parse(callback); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			WriteError(w, http.StatusBadRequest, Message(w, "deferred.invalid_callback", DeferCallbackHeader))
+			return 0, false
+		}
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// deferrableStatus 账号全部不可用（无可用账号或上游限流），可以延迟重试
+func deferrableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// serveDeferrable 先按正常请求处理，账号全部不可用时加入延迟队列并返回 202
+func serveDeferrable(w http.ResponseWriter, r *http.Request, req *converter.OpenAIChatRequest, maxWait time.Duration) {
+	// 处理前编码请求，避免转换过程对请求的修改影响重试
+	body, err := json.Marshal(req)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, Message(w, "deferred.encode_failed", err))
+		return
+	}
+
+	rec := &batchRecorder{header: make(http.Header)}
+	serveChatRequest(rec, r, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if !deferrableStatus(rec.status) {
+		writeRecorded(w, rec)
+		return
+	}
+
+	tenant, _ := store.TenantFromContext(r.Context())
+	item := &store.DeferredRequest{
+		KeyHash:     apiKeyHash(r),
+		Tenant:      tenant,
+		Model:       req.Model,
+		Body:        body,
+		CallbackURL: r.Header.Get(DeferCallbackHeader),
+		Deadline:    time.Now().Add(maxWait),
+		LastError:   recordedError(rec),
+		Attempts:    1,
+	}
+	if key := ExtractAPIKey(r); key != "" {
+		item.Authorization = "Bearer " + key
+	}
+	queued, err := store.GetDeferredStore().Enqueue(item)
+	if err != nil {
+		// 无法排队时返回原始错误
+		logger.Warn("Deferred request rejected: %v", err)
+		writeRecorded(w, rec)
+		return
+	}
+
+	StartDeferredWorker()
+	logger.Info("Request deferred as %s (max wait %s)", queued.ID, maxWait)
+	w.Header().Set("Location", "/v1/deferred/"+queued.ID)
+	w.Header().Set("Retry-After", strconv.Itoa(config.Get().DeferredRetryInterval))
+	WriteJSON(w, http.StatusAccepted, deferredView(queued))
+}
+
+// writeRecorded 写出进程内处理得到的响应
+func writeRecorded(w http.ResponseWriter, rec *batchRecorder) {
+	for key, values := range rec.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(rec.status)
+	w.Write(rec.body.Bytes())
+}
+
+// recordedError 提取错误响应中的消息
+func recordedError(rec *batchRecorder) string {
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(rec.body.Bytes(), &resp) == nil && resp.Error.Message != "" {
+		return resp.Error.Message
+	}
+	return http.StatusText(rec.status)
+}
+
+// deferredView 返回给客户端的延迟请求对象
+func deferredView(d *store.DeferredRequest) map[string]interface{} {
+	view := map[string]interface{}{
+		"id":         d.ID,
+		"object":     "deferred_request",
+		"status":     d.Status,
+		"model":      d.Model,
+		"created_at": d.CreatedAt.Unix(),
+		"expires_at": d.Deadline.Unix(),
+		"attempts":   d.Attempts,
+		"response":   d.Response,
+	}
+	if d.LastError != "" {
+		view["last_error"] = d.LastError
+	}
+	if d.FinishedAt != nil {
+		view["finished_at"] = d.FinishedAt.Unix()
+	}
+	return view
+}
+
+// HandleGetDeferred 获取延迟请求的状态和结果
+func HandleGetDeferred(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	item := store.GetDeferredStore().Get(id, apiKeyHash(r))
+	if item == nil {
+		WriteError(w, http.StatusNotFound, Message(w, "deferred.not_found", id))
+		return
+	}
+	WriteJSON(w, http.StatusOK, deferredView(item))
+}
+
+// HandleGetDeferredQueue 查看延迟队列（管理接口，不返回请求内容）
+func HandleGetDeferredQueue(w http.ResponseWriter, r *http.Request) {
+	deferred := store.GetDeferredStore()
+	items := deferred.List()
+	result := make([]map[string]interface{}, 0, len(items))
+	for _, d := range items {
+		item := map[string]interface{}{
+			"id":          d.ID,
+			"status":      d.Status,
+			"model":       d.Model,
+			"keyId":       d.KeyHash[:12],
+			"tenant":      d.Tenant,
+			"createdAt":   d.CreatedAt.Format(time.RFC3339),
+			"deadline":    d.Deadline.Format(time.RFC3339),
+			"nextAttempt": d.NextAttempt.Format(time.RFC3339),
+			"attempts":    d.Attempts,
+			"lastError":   d.LastError,
+			"callback":    d.CallbackURL != "",
+		}
+		if d.Response != nil {
+			item["responseStatus"] = d.Response.StatusCode
+		}
+		result = append(result, item)
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"stats": deferred.Stats(),
+		"items": result,
+	})
+}
+
+// HandleCancelDeferred 取消等待中的延迟请求（已结束的请求直接删除）
+func HandleCancelDeferred(w http.ResponseWriter, r *http.Request) {
+	if !store.GetDeferredStore().Cancel(r.PathValue("id")) {
+		WriteError(w, http.StatusNotFound, Message(w, "deferred.not_found", r.PathValue("id")))
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+var deferredWorker monitor.Loop
+
+// StartDeferredWorker 启动延迟队列的后台重试（启动时恢复持久化的队列，首次排队时也会调用）
+func StartDeferredWorker() {
+	deferredWorker.Start("deferred", runDeferredWorker)
+}
+
+// StopDeferredWorker 停止后台重试，等待进行中的重试完成（未重试的请求留在队列中，下次启动时恢复）
+func StopDeferredWorker(ctx context.Context) error {
+	return deferredWorker.Stop(ctx)
+}
+
+// runDeferredWorker 按重试间隔依次重试到期的请求；仍然没有可用账号时结束本轮，等待下次间隔
+func runDeferredWorker(ctx context.Context) {
+	interval := time.Duration(config.Get().DeferredRetryInterval) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	deferred := store.GetDeferredStore()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		due, expired := deferred.Due(time.Now())
+		for i := range expired {
+			logger.Warn("Deferred request %s expired after %d attempts", expired[i].ID, expired[i].Attempts)
+			go deliverDeferred(&expired[i])
+		}
+		for i := range due {
+			if ctx.Err() != nil || !retryDeferred(&due[i], interval) {
+				break
+			}
+		}
+	}
+}
+
+// retryDeferred 重试一个请求，账号仍全部不可用时重新排队并返回 false
+func retryDeferred(d *store.DeferredRequest, interval time.Duration) bool {
+	deferred := store.GetDeferredStore()
+	started := false
+	deferred.Update(d.ID, func(item *store.DeferredRequest) {
+		if item.Status == store.DeferredQueued {
+			item.Status = store.DeferredInProgress
+			item.Attempts++
+			started = true
+		}
+	})
+	if !started {
+		// 已被取消或删除
+		return true
+	}
+
+	rec := executeDeferred(d)
+	now := time.Now()
+	updated := deferred.Update(d.ID, func(item *store.DeferredRequest) {
+		if item.Status != store.DeferredInProgress {
+			// 执行期间被取消
+			return
+		}
+		if deferrableStatus(rec.status) {
+			item.Status = store.DeferredQueued
+			item.LastError = recordedError(rec)
+			item.NextAttempt = now.Add(interval)
+			return
+		}
+		item.Status = store.DeferredCompleted
+		if rec.status >= 300 {
+			item.Status = store.DeferredFailed
+			item.LastError = recordedError(rec)
+		}
+		item.FinishedAt = &now
+		body := json.RawMessage(rec.body.Bytes())
+		if !json.Valid(body) {
+			body, _ = json.Marshal(rec.body.String())
+		}
+		item.Response = &store.DeferredResponse{StatusCode: rec.status, Body: body}
+	})
+	if updated == nil {
+		return true
+	}
+	if updated.Pending() {
+		return false
+	}
+
+	logger.Info("Deferred request %s %s after %d attempts (status %d)", updated.ID, updated.Status, updated.Attempts, rec.status)
+	go deliverDeferred(updated)
+	return true
+}
+
+// executeDeferred 在进程内重新执行请求（不带延迟请求头，按原请求的租户和 API Key）
+func executeDeferred(d *store.DeferredRequest) *batchRecorder {
+	rec := &batchRecorder{header: make(http.Header)}
+	ctx := context.Background()
+	if d.Tenant != "" {
+		ctx = store.WithTenant(ctx, d.Tenant)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/chat/completions", bytes.NewReader(d.Body))
+	if err != nil {
+		rec.status = http.StatusInternalServerError
+		rec.body.WriteString(err.Error())
+		return rec
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.Authorization != "" {
+		req.Header.Set("Authorization", d.Authorization)
+	}
+
+	Recover(http.HandlerFunc(HandleChatCompletions)).ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec
+}
+
+// deliverDeferred 推送结束的延迟请求到回调地址（尽力而为，失败只记录日志）
+func deliverDeferred(d *store.DeferredRequest) {
+	if d.CallbackURL == "" {
+		return
+	}
+	data, err := json.Marshal(deferredView(d))
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deferCallbackTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.CallbackURL, bytes.NewReader(data))
+	if err != nil {
+		logger.Warn("Deferred callback for %s failed: %v", d.ID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = errors.New(resp.Status)
+		}
+	}
+	if err != nil {
+		logger.Warn("Deferred callback for %s failed: %v", d.ID, err)
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/store"
+)
+
+// accountFailover 单个请求的账号切换状态
+type accountFailover struct {
+	fallbacks int
+}
+
+type failoverContextKey struct{}
+
+// withAccountFailover 允许请求在上游拒绝账号时切换账号（只用于从账号池选择的请求）
+func withAccountFailover(r *http.Request) *http.Request {
+	if config.Get().AccountFailoverAttempts <= 0 {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), failoverContextKey{}, &accountFailover{}))
+}
+
+// failoverCount 请求已切换账号的次数
+func failoverCount(ctx context.Context) int {
+	if f, ok := ctx.Value(failoverContextKey{}).(*accountFailover); ok {
+		return f.fallbacks
+	}
+	return 0
+}
+
+// isFailoverError 上游因配额或凭证拒绝了账号（换用其他账号可能成功）
+func isFailoverError(err error) bool {
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Status {
+	case http.StatusTooManyRequests, http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	}
+	return false
+}
+
+// nextFailoverAccount 暂停选用失败的账号并选择下一个账号；不允许切换或没有其他账号时返回 nil
+func nextFailoverAccount(r *http.Request, token *store.Account, err error) *store.Account {
+	f, ok := r.Context().Value(failoverContextKey{}).(*accountFailover)
+	cfg := config.Get()
+	if !ok || token == nil || token.Passthrough || f.fallbacks >= cfg.AccountFailoverAttempts || !isFailoverError(err) {
+		return nil
+	}
+
+	accountStore := store.GetAccountStore()
+	accountStore.MarkUnavailable(token.ID, time.Duration(cfg.AccountFailoverCooldown)*time.Second, err.Error())
+	store.RouteTraceFromContext(r.Context()).Failover(token.ID, err)
+
+	var next *store.Account
+	var selectErr error
+	if endpoint := r.Header.Get(EndpointOverrideHeader); endpoint != "" {
+		next, selectErr = accountStore.GetTokenForEndpoint(r.Context(), endpoint)
+	} else {
+		next, selectErr = accountStore.GetToken(r.Context())
+	}
+	if selectErr != nil || next.ID == token.ID {
+		return nil
+	}
+
+	f.fallbacks++
+	logger.Warn("Failing over from %s to %s (%d/%d): %v", token.Email, next.Email, f.fallbacks, cfg.AccountFailoverAttempts, err)
+	return next
+}
+
+// chatFailover 流式请求切换账号时重新转换请求（请求中包含账号的项目和会话）
+func chatFailover(r *http.Request, req *converter.OpenAIChatRequest) func(account *store.Account, err error) (*converter.AntigravityRequest, *store.Account) {
+	return func(account *store.Account, err error) (*converter.AntigravityRequest, *store.Account) {
+		next := nextFailoverAccount(r, account, err)
+		if next == nil {
+			return nil, nil
+		}
+		return convertChatRequest(r, req, next), next
+	}
+}
@@ -2,26 +2,52 @@ package handlers
 
 import (
 	"bufio"
-	"compress/gzip"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"anti2api-golang/internal/api"
 	"anti2api-golang/internal/converter"
 	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/pipeline"
 	"anti2api-golang/internal/store"
 )
 
 // HandleGeminiModels 获取 Gemini 格式模型列表
 func HandleGeminiModels(w http.ResponseWriter, r *http.Request) {
-	models := converter.GetGeminiModels()
+	query := r.URL.Query()
+	pageSize := 0
+	if v := query.Get("pageSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_page_size"))
+			return
+		}
+		pageSize = n
+	}
+
+	models, err := converter.GetGeminiModels(pageSize, query.Get("pageToken"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	WriteJSON(w, http.StatusOK, models)
 }
 
+// HandleGetGeminiModel 获取单个模型（Gemini 格式）
+func HandleGetGeminiModel(w http.ResponseWriter, r *http.Request) {
+	model, ok := converter.GetGeminiModel(r.PathValue("model"))
+	if !ok {
+		WriteError(w, http.StatusNotFound, Message(w, "models.not_found", r.PathValue("model")))
+		return
+	}
+	WriteJSON(w, http.StatusOK, model)
+}
+
 // parseGeminiPath 解析 Gemini API 路径，提取 model 和 action
 // 路径格式: /v1beta/models/{model}:{action} 或 /gemini/v1beta/models/{model}:{action}
 func parseGeminiPath(path string) (model, action string, ok bool) {
@@ -44,7 +70,7 @@ func parseGeminiPath(path string) (model, action string, ok bool) {
 func HandleGeminiAPI(w http.ResponseWriter, r *http.Request) {
 	model, action, ok := parseGeminiPath(r.URL.Path)
 	if !ok || model == "" {
-		WriteError(w, http.StatusBadRequest, "Invalid path format")
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_path"))
 		return
 	}
 
@@ -54,7 +80,7 @@ func HandleGeminiAPI(w http.ResponseWriter, r *http.Request) {
 	case "streamGenerateContent":
 		handleGeminiStreamGenerateContent(w, r, model)
 	default:
-		WriteError(w, http.StatusBadRequest, "Unknown action: "+action)
+		WriteError(w, http.StatusBadRequest, Message(w, "request.unknown_action", action))
 	}
 }
 
@@ -62,7 +88,7 @@ func HandleGeminiAPI(w http.ResponseWriter, r *http.Request) {
 func HandleRawGeminiAPI(w http.ResponseWriter, r *http.Request) {
 	model, action, ok := parseGeminiPath(r.URL.Path)
 	if !ok || model == "" {
-		WriteError(w, http.StatusBadRequest, "Invalid path format")
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_path"))
 		return
 	}
 
@@ -72,7 +98,7 @@ func HandleRawGeminiAPI(w http.ResponseWriter, r *http.Request) {
 	case "streamGenerateContent":
 		handleRawGeminiStreamGenerateContent(w, r, model)
 	default:
-		WriteError(w, http.StatusBadRequest, "Unknown action: "+action)
+		WriteError(w, http.StatusBadRequest, Message(w, "request.unknown_action", action))
 	}
 }
 
@@ -80,20 +106,21 @@ func HandleRawGeminiAPI(w http.ResponseWriter, r *http.Request) {
 func handleGeminiGenerateContent(w http.ResponseWriter, r *http.Request, model string) {
 	var req converter.GeminiRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_body", err))
 		return
 	}
 
 	logger.ClientRequest(r.Method, r.URL.Path, req)
 
-	// 获取 token
-	token, err := store.GetAccountStore().GetToken()
-	if err != nil {
-		WriteError(w, http.StatusServiceUnavailable, err.Error())
+	// 获取 token（会话标识用于排空账号的会话保持）
+	r = r.WithContext(store.WithConversation(r.Context(), converter.GeminiConversationKey(&req)))
+	r, token, ok := acquireToken(w, r)
+	if !ok {
 		return
 	}
 
 	startTime := time.Now()
+	r = r.WithContext(api.WithHeaderCapture(r.Context()))
 
 	// 转换请求
 	antigravityReq := converter.ConvertGeminiToAntigravity(model, &req, token)
@@ -104,7 +131,8 @@ func handleGeminiGenerateContent(w http.ResponseWriter, r *http.Request, model s
 	if err != nil {
 		duration := time.Since(startTime)
 		logger.ClientResponse(getErrorStatus(err), duration, err.Error())
-		WriteError(w, getErrorStatus(err), err.Error())
+		store.GetLogStore().Add(newLogEntry(r, model, &req, token, getErrorStatus(err), false, duration, err.Error(), ""))
+		writeRouteError(w, r, getErrorStatus(err), err.Error())
 		return
 	}
 
@@ -113,94 +141,99 @@ func handleGeminiGenerateContent(w http.ResponseWriter, r *http.Request, model s
 
 	duration := time.Since(startTime)
 	logger.ClientResponse(http.StatusOK, duration, geminiResp)
+	recordGeminiLog(r, model, &req, token, duration, geminiResp.Candidates, geminiResp.UsageMetadata)
 	WriteJSON(w, http.StatusOK, geminiResp)
 }
 
+// recordGeminiLog 记录成功的 Gemini 非流式请求
+func recordGeminiLog(r *http.Request, model string, req *converter.GeminiRequest, token *store.Account, duration time.Duration, candidates []converter.Candidate, usage *converter.UsageMetadata) {
+	content, empty := geminiOutput(candidates)
+	entry := newLogEntry(r, model, req, token, http.StatusOK, true, duration, "", content)
+	entry.Empty = empty
+	attachUsageDiagnostics(&entry, 0, usage, nil)
+	store.GetLogStore().Add(entry)
+}
+
+// geminiOutput 提取候选中的回答文本（不含思考）；没有文本和函数调用时 empty 为 true
+func geminiOutput(candidates []converter.Candidate) (content string, empty bool) {
+	var sb strings.Builder
+	empty = true
+	for _, candidate := range candidates {
+		for _, part := range candidate.Content.Parts {
+			if part.FunctionCall != nil {
+				empty = false
+			}
+			if part.Thought || part.Text == "" {
+				continue
+			}
+			sb.WriteString(part.Text)
+			empty = false
+		}
+	}
+	return sb.String(), empty
+}
+
 // handleGeminiStreamGenerateContent 处理 Gemini 流式请求
 func handleGeminiStreamGenerateContent(w http.ResponseWriter, r *http.Request, model string) {
+	if !checkStreamSupport(w, r) {
+		return
+	}
 
 	var req converter.GeminiRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_body", err))
 		return
 	}
 
 	logger.ClientRequest(r.Method, r.URL.Path, req)
 
-	// 获取 token
-	token, err := store.GetAccountStore().GetToken()
-	if err != nil {
-		WriteError(w, http.StatusServiceUnavailable, err.Error())
+	// 获取 token（会话标识用于排空账号的会话保持）
+	r = r.WithContext(store.WithConversation(r.Context(), converter.GeminiConversationKey(&req)))
+	r, token, ok := acquireToken(w, r)
+	if !ok {
 		return
 	}
 
-	// 转换请求
-	antigravityReq := converter.ConvertGeminiToAntigravity(model, &req, token)
-
-	// 发送流式请求
-	ctx := r.Context()
-	resp, err := api.GenerateContentStream(ctx, antigravityReq, token)
-	if err != nil {
-		WriteError(w, getErrorStatus(err), err.Error())
-		return
-	}
-	defer resp.Body.Close()
-
-	// 设置流式响应头
-	api.SetStreamHeaders(w)
-
-	// 处理 gzip
-	var reader io.Reader = resp.Body
-	if resp.Header.Get("Content-Encoding") == "gzip" {
-		gzReader, err := gzip.NewReader(resp.Body)
-		if err != nil {
-			api.WriteStreamError(w, err.Error())
-			return
-		}
-		defer gzReader.Close()
-		reader = gzReader
-	}
-
-	// 转发流式数据（16MB缓冲区）
-	scanner := bufio.NewScanner(reader)
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 16*1024*1024)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "data: ") {
-			// 转换行格式
-			transformed := converter.TransformGeminiStreamLine(line)
-			fmt.Fprintf(w, "%s\n\n", transformed)
-			if f, ok := w.(http.Flusher); ok {
-				f.Flush()
+	r = r.WithContext(api.WithHeaderCapture(r.Context()))
+
+	orchestrator := &pipeline.Orchestrator{
+		Request:  converter.ConvertGeminiToAntigravity(model, &req, token),
+		Account:  token,
+		Model:    model,
+		Renderer: &geminiRenderer{w: w},
+		OnComplete: func(result *pipeline.Result) {
+			errMsg := ""
+			if result.Err != nil {
+				errMsg = result.Err.Error()
 			}
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		logger.Error("Stream scan error: %v", err)
+			entry := newLogEntry(r, model, &req, token, result.Status, result.Success(), result.Duration, errMsg, result.Content)
+			entry.Empty = result.Success() && result.Empty()
+			attachUsageDiagnostics(&entry, 0, result.UsageMetadata, result.UsageEvents)
+			store.GetLogStore().Add(entry)
+		},
 	}
+	orchestrator.Run(r.Context())
 }
 
 // handleRawGeminiGenerateContent 原始 Gemini 透传（非流式）
 func handleRawGeminiGenerateContent(w http.ResponseWriter, r *http.Request, model string) {
 	var req converter.GeminiRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_body", err))
 		return
 	}
 
 	logger.ClientRequest(r.Method, r.URL.Path, req)
 
-	// 获取 token
-	token, err := store.GetAccountStore().GetToken()
-	if err != nil {
-		WriteError(w, http.StatusServiceUnavailable, err.Error())
+	// 获取 token（会话标识用于排空账号的会话保持）
+	r = r.WithContext(store.WithConversation(r.Context(), converter.GeminiConversationKey(&req)))
+	r, token, ok := acquireToken(w, r)
+	if !ok {
 		return
 	}
 
 	startTime := time.Now()
+	r = r.WithContext(api.WithHeaderCapture(r.Context()))
 
 	// 转换请求
 	antigravityReq := converter.ConvertGeminiToAntigravity(model, &req, token)
@@ -211,41 +244,65 @@ func handleRawGeminiGenerateContent(w http.ResponseWriter, r *http.Request, mode
 	if err != nil {
 		duration := time.Since(startTime)
 		logger.ClientResponse(getErrorStatus(err), duration, err.Error())
-		WriteError(w, getErrorStatus(err), err.Error())
+		store.GetLogStore().Add(newLogEntry(r, model, &req, token, getErrorStatus(err), false, duration, err.Error(), ""))
+		writeRouteError(w, r, getErrorStatus(err), err.Error())
 		return
 	}
 
 	// 直接返回原始响应（包含 response 字段）
 	duration := time.Since(startTime)
 	logger.ClientResponse(http.StatusOK, duration, resp)
+	recordGeminiLog(r, model, &req, token, duration, resp.Response.Candidates, resp.Response.UsageMetadata)
 	WriteJSON(w, http.StatusOK, resp)
 }
 
 // handleRawGeminiStreamGenerateContent 原始 Gemini 透传（流式）
 func handleRawGeminiStreamGenerateContent(w http.ResponseWriter, r *http.Request, model string) {
+	if !checkStreamSupport(w, r) {
+		return
+	}
+
 	var req converter.GeminiRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_body", err))
 		return
 	}
 
 	logger.ClientRequest(r.Method, r.URL.Path, req)
 
-	// 获取 token
-	token, err := store.GetAccountStore().GetToken()
-	if err != nil {
-		WriteError(w, http.StatusServiceUnavailable, err.Error())
+	// 获取 token（会话标识用于排空账号的会话保持）
+	r = r.WithContext(store.WithConversation(r.Context(), converter.GeminiConversationKey(&req)))
+	r, token, ok := acquireToken(w, r)
+	if !ok {
 		return
 	}
 
+	startTime := time.Now()
+	r = r.WithContext(api.WithHeaderCapture(r.Context()))
+
 	// 转换请求
 	antigravityReq := converter.ConvertGeminiToAntigravity(model, &req, token)
 
-	// 发送流式请求
-	ctx := r.Context()
+	// 流式输出结束时记录日志（从转发的数据中提取回答文本和最后的用量）
+	status, errMsg := http.StatusOK, ""
+	var output []converter.Candidate
+	var usage *converter.UsageMetadata
+	defer func() {
+		success := errMsg == ""
+		content, empty := geminiOutput(output)
+		entry := newLogEntry(r, model, &req, token, status, success, time.Since(startTime), errMsg, content)
+		entry.Empty = success && empty
+		attachUsageDiagnostics(&entry, 0, usage, nil)
+		store.GetLogStore().Add(entry)
+	}()
+
+	// 发送流式请求（登记为进行中的流式输出）
+	ctx, done := monitor.Track(r.Context(), monitor.KindStream, model, token.ID)
+	defer done()
 	resp, err := api.GenerateContentStream(ctx, antigravityReq, token)
 	if err != nil {
-		WriteError(w, getErrorStatus(err), err.Error())
+		status, errMsg = getErrorStatus(err), err.Error()
+		WriteError(w, status, errMsg)
 		return
 	}
 	defer resp.Body.Close()
@@ -253,17 +310,14 @@ func handleRawGeminiStreamGenerateContent(w http.ResponseWriter, r *http.Request
 	// 设置流式响应头
 	api.SetStreamHeaders(w)
 
-	// 处理 gzip
-	var reader io.Reader = resp.Body
-	if resp.Header.Get("Content-Encoding") == "gzip" {
-		gzReader, err := gzip.NewReader(resp.Body)
-		if err != nil {
-			api.WriteStreamError(w, err.Error())
-			return
-		}
-		defer gzReader.Close()
-		reader = gzReader
+	// 处理压缩（gzip/br/zstd）
+	reader, err := api.DecodeBody(resp)
+	if err != nil {
+		status, errMsg = http.StatusBadGateway, err.Error()
+		api.WriteStreamError(w, status, errMsg)
+		return
 	}
+	defer reader.Close()
 
 	// 直接转发原始流式数据（不转换，16MB缓冲区）
 	scanner := bufio.NewScanner(reader)
@@ -272,13 +326,27 @@ func handleRawGeminiStreamGenerateContent(w http.ResponseWriter, r *http.Request
 
 	for scanner.Scan() {
 		line := scanner.Text()
-		fmt.Fprintf(w, "%s\n", line)
+		if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
+			// 客户端已断开，停止转发
+			logger.Warn("Stream write to client failed, output stopped: %v", err)
+			return
+		}
 		if f, ok := w.(http.Flusher); ok {
 			f.Flush()
 		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var chunk converter.AntigravityResponse
+			if json.Unmarshal([]byte(data), &chunk) == nil {
+				output = append(output, chunk.Response.Candidates...)
+				if chunk.Response.UsageMetadata != nil {
+					usage = chunk.Response.UsageMetadata
+				}
+			}
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
 		logger.Error("Stream scan error: %v", err)
+		status, errMsg = http.StatusBadGateway, err.Error()
 	}
 }
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/notify"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/utils"
+)
+
+// KeyLimitStanding API Key 相对于单项阈值的情况
+type KeyLimitStanding struct {
+	Name      string `json:"name"`
+	Limit     int    `json:"limit"`
+	Value     int    `json:"value"`
+	Action    string `json:"action"`
+	Exceeded  bool   `json:"exceeded"`
+	Remaining int    `json:"remaining"`
+}
+
+func newStanding(name string, t *store.KeyThreshold, value int) KeyLimitStanding {
+	return KeyLimitStanding{
+		Name:      name,
+		Limit:     t.Limit,
+		Value:     value,
+		Action:    t.Action,
+		Exceeded:  value > t.Limit,
+		Remaining: max(t.Limit-value, 0),
+	}
+}
+
+// checkKeyLimits 按 API Key 的阈值检查请求：提示 Token 使用本地估算，每日用量取自用量台账（加上本次请求的估算提示 Token）。
+// warn 阈值超出时发送告警，block 阈值超出时返回 429 budget_exceeded（返回 false 时已写入错误响应）
+func checkKeyLimits(w http.ResponseWriter, r *http.Request, req *converter.OpenAIChatRequest) bool {
+	keyID := usageKeyID(r)
+	if keyID == "" {
+		return true
+	}
+	limits := store.GetKeyLimitStore().Get(keyID)
+	if limits == nil {
+		return true
+	}
+
+	now := time.Now()
+	prompt := converter.EstimateTokens(req).Total
+	output := 0
+	if req.TokenBudget != nil {
+		output = req.TokenBudget.MaxOutputTokens
+	}
+
+	var standings []KeyLimitStanding
+	if t := limits.MaxPromptTokens; t != nil {
+		standings = append(standings, newStanding("maxPromptTokens", t, prompt))
+	}
+	if t := limits.MaxRequestTokens; t != nil {
+		standings = append(standings, newStanding("maxRequestTokens", t, prompt+output))
+	}
+	if t := limits.DailyTokens; t != nil {
+		used := store.GetUsageLedger().KeyTokens(keyID, now.Format("2006-01-02"))
+		standings = append(standings, newStanding("dailyTokens", t, used+prompt))
+	}
+
+	for _, s := range standings {
+		if !s.Exceeded {
+			continue
+		}
+		logger.Warn("API key %s exceeded %s: %d > %d (%s)", keyID, s.Name, s.Value, s.Limit, s.Action)
+		notify.Fire(notify.EventKeyLimitExceeded, "API key exceeded a usage threshold", map[string]interface{}{
+			"key":       keyID,
+			"note":      limits.Note,
+			"threshold": s.Name,
+			"limit":     s.Limit,
+			"value":     s.Value,
+			"action":    s.Action,
+			"model":     req.Model,
+		})
+		store.GetAuditLog().Record(store.AuditEntry{
+			Event:     store.AuditKeyLimitExceeded,
+			Principal: "key:" + keyID,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			ClientIP:  utils.ClientIP(r),
+			Detail:    fmt.Sprintf("%s %d > %d (%s)", s.Name, s.Value, s.Limit, s.Action),
+		})
+		if s.Action != store.KeyLimitBlock {
+			continue
+		}
+		if s.Name == "dailyTokens" {
+			// 每日预算在本地时区零点重置
+			midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+			w.Header().Set("Retry-After", strconv.Itoa(int(midnight.Sub(now).Seconds())+1))
+		}
+		WriteParamError(w, http.StatusTooManyRequests,
+			Message(w, "key_limits.exceeded", s.Name, s.Value, s.Limit), s.Name, "budget_exceeded")
+		return false
+	}
+	return true
+}
+
+// KeyUsage API Key 的当日用量与阈值情况
+type KeyUsage struct {
+	Key              string             `json:"key"`
+	Tenant           string             `json:"tenant,omitempty"`
+	Requests         int                `json:"requests"`
+	Failures         int                `json:"failures"`
+	PromptTokens     int                `json:"promptTokens"`
+	CompletionTokens int                `json:"completionTokens"`
+	Limits           *store.KeyLimits   `json:"limits,omitempty"`
+	Standing         []KeyLimitStanding `json:"standing,omitempty"` // 每日预算的使用情况
+}
+
+// HandleGetKeyUsage 按 API Key 汇总指定日期（?date=YYYY-MM-DD，默认今天）的用量，附带阈值配置和每日预算使用情况
+func HandleGetKeyUsage(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	} else if _, err := time.Parse("2006-01-02", date); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_date"))
+		return
+	}
+
+	byKey := make(map[string]*KeyUsage)
+	for _, row := range store.GetUsageLedger().Range(date, date) {
+		if row.Key == "" {
+			continue
+		}
+		u, ok := byKey[row.Key]
+		if !ok {
+			u = &KeyUsage{Key: row.Key, Tenant: row.Tenant}
+			byKey[row.Key] = u
+		}
+		u.Requests += row.Requests
+		u.Failures += row.Failures
+		u.PromptTokens += row.PromptTokens
+		u.CompletionTokens += row.CompletionTokens
+	}
+	// 配置了阈值但当天没有请求的 Key 也列出
+	for _, limits := range store.GetKeyLimitStore().List() {
+		if _, ok := byKey[limits.Key]; !ok {
+			byKey[limits.Key] = &KeyUsage{Key: limits.Key}
+		}
+	}
+
+	result := make([]KeyUsage, 0, len(byKey))
+	for key, u := range byKey {
+		if limits := store.GetKeyLimitStore().Get(key); limits != nil {
+			u.Limits = limits
+			if limits.DailyTokens != nil {
+				u.Standing = append(u.Standing, newStanding("dailyTokens", limits.DailyTokens, u.PromptTokens+u.CompletionTokens))
+			}
+		}
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"date": date,
+		"keys": result,
+	})
+}
+
+// HandleGetKeyLimits 获取所有 API Key 的阈值配置
+func HandleGetKeyLimits(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"limits": store.GetKeyLimitStore().List()})
+}
+
+// HandleSetKeyLimits 设置 API Key 的阈值配置（路径中的 key 为日志和用量中的 Key 哈希前缀）
+func HandleSetKeyLimits(w http.ResponseWriter, r *http.Request) {
+	var limits store.KeyLimits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_body", err))
+		return
+	}
+	limits.Key = r.PathValue("key")
+	if err := store.GetKeyLimitStore().Set(limits); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true, "limits": store.GetKeyLimitStore().Get(limits.Key)})
+}
+
+// HandleDeleteKeyLimits 删除 API Key 的阈值配置
+func HandleDeleteKeyLimits(w http.ResponseWriter, r *http.Request) {
+	deleted, err := store.GetKeyLimitStore().Delete(r.PathValue("key"))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, Message(w, "key_limits.save_failed", err))
+		return
+	}
+	if !deleted {
+		WriteError(w, http.StatusNotFound, Message(w, "key_limits.not_found"))
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"anti2api-golang/internal/i18n"
+)
+
+// localeWriter 记录按 Accept-Language 协商的语言，错误消息和管理接口标签按此输出
+type localeWriter struct {
+	http.ResponseWriter
+	locale string
+}
+
+// Unwrap 返回底层 ResponseWriter
+func (lw *localeWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// Flush 实现 http.Flusher 接口，支持流式响应
+func (lw *localeWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Localize 按 Accept-Language 协商响应语言（未指定或不支持时使用 DEFAULT_LOCALE）
+func Localize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(&localeWriter{ResponseWriter: w, locale: i18n.Negotiate(r.Header.Get("Accept-Language"))}, r)
+	})
+}
+
+// requestLocale 沿 Unwrap 链查找协商的语言
+func requestLocale(w http.ResponseWriter) string {
+	for {
+		if lw, ok := w.(*localeWriter); ok {
+			return lw.locale
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return i18n.Default()
+		}
+		w = u.Unwrap()
+	}
+}
+
+// Message 按请求语言格式化消息目录中的消息
+func Message(w http.ResponseWriter, key string, args ...interface{}) string {
+	return i18n.T(requestLocale(w), key, args...)
+}
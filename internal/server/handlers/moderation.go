@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/moderation"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/utils"
+)
+
+// moderationModel 本地规则引擎的模型名
+const moderationModel = "local-rules"
+
+// HandleModerations 处理 OpenAI 兼容的内容审核请求（本地规则，不调用上游）
+func HandleModerations(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input interface{} `json:"input"`
+		Model string      `json:"model"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_body", err))
+		return
+	}
+
+	var inputs []string
+	switch v := req.Input.(type) {
+	case string:
+		inputs = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			switch it := item.(type) {
+			case string:
+				inputs = append(inputs, it)
+			case map[string]interface{}:
+				// 多模态格式 {"type":"text","text":"..."}，非文本输入按空串处理
+				text, _ := it["text"].(string)
+				inputs = append(inputs, text)
+			}
+		}
+	default:
+		WriteError(w, http.StatusBadRequest, Message(w, "moderation.invalid_input"))
+		return
+	}
+
+	engine := moderation.Get()
+	results := make([]moderation.Result, len(inputs))
+	for i, input := range inputs {
+		results[i] = engine.Check(input)
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"id":      "modr-" + utils.GenerateSecureToken(12),
+		"model":   moderationModel,
+		"results": results,
+	})
+}
+
+// HandleGetModerationStats 获取内容审核统计
+func HandleGetModerationStats(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, moderation.Get().Stats())
+}
+
+// screenChatRequest 内联审核对话请求，返回 false 表示请求已被拒绝
+func screenChatRequest(w http.ResponseWriter, r *http.Request, req *converter.OpenAIChatRequest) bool {
+	engine := moderation.Get()
+	mode := engine.InlineMode()
+	if mode == moderation.InlineOff {
+		return true
+	}
+
+	result := engine.Check(strings.Join(converter.UserMessageTexts(req.Messages), "\n"))
+	if !result.Flagged {
+		return true
+	}
+
+	categories := result.FlaggedCategories()
+	if mode == moderation.InlineTag {
+		// 放行的请求由 recordLog 记录，命中的分类写入同一条日志
+		req.Moderation = categories
+		w.Header().Set("X-Moderation-Flagged", strings.Join(categories, ","))
+		return true
+	}
+
+	// 被拒绝的请求不会到达 recordLog，单独记录一条日志
+	tenant, _ := store.TenantFromContext(r.Context())
+	store.GetLogStore().Add(store.LogEntry{
+		ID:         utils.GenerateRequestID(),
+		Timestamp:  time.Now(),
+		Status:     http.StatusBadRequest,
+		Model:      req.Model,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Message:    "content flagged (" + mode + "): " + strings.Join(categories, ", "),
+		Moderation: categories,
+		Tenant:     tenant,
+		ClientIP:   utils.ClientIP(r),
+	})
+
+	WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": Message(w, "params.content_flagged", strings.Join(categories, ", ")),
+			"type":    "invalid_request_error",
+			"code":    "content_policy_violation",
+		},
+	})
+	return false
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// 非流式响应的编码格式（按 Accept 协商，未指定或不支持时为 JSON）
+const (
+	formatJSON    = ""
+	formatNDJSON  = "application/x-ndjson"
+	formatMsgpack = "application/msgpack"
+)
+
+// negotiatedWriter 记录协商的响应格式，WriteJSON 按此编码（包括错误响应）
+type negotiatedWriter struct {
+	http.ResponseWriter
+	format string
+}
+
+// Unwrap 返回底层 ResponseWriter
+func (nw *negotiatedWriter) Unwrap() http.ResponseWriter {
+	return nw.ResponseWriter
+}
+
+// negotiateFormat 按 Accept 中出现的顺序选择第一个支持的格式（application/json 或 */* 在前时使用 JSON）
+func negotiateFormat(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/x-ndjson", "application/ndjson":
+			return formatNDJSON
+		case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+			return formatMsgpack
+		case "application/json", "*/*", "application/*":
+			return formatJSON
+		}
+	}
+	return formatJSON
+}
+
+// withNegotiatedFormat 按 Accept 包装 ResponseWriter；流式请求解析请求体后改用底层 ResponseWriter（SSE 不受影响）
+func withNegotiatedFormat(w http.ResponseWriter, r *http.Request) *negotiatedWriter {
+	w.Header().Add("Vary", "Accept")
+	return &negotiatedWriter{ResponseWriter: w, format: negotiateFormat(r.Header.Get("Accept"))}
+}
+
+// NegotiatedWriter 在读取请求体之前返回错误时按 Accept 包装 ResponseWriter（中间件的拒绝响应与处理函数的错误使用相同的格式）
+func NegotiatedWriter(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	return withNegotiatedFormat(w, r)
+}
+
+// responseFormat 沿 Unwrap 链查找协商的响应格式
+func responseFormat(w http.ResponseWriter) string {
+	for {
+		if nw, ok := w.(*negotiatedWriter); ok {
+			return nw.format
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return formatJSON
+		}
+		w = u.Unwrap()
+	}
+}
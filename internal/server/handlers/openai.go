@@ -1,36 +1,76 @@
 package handlers
 
 import (
-	"context"
-	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/chaos"
+	"anti2api-golang/internal/config"
 	"anti2api-golang/internal/converter"
 	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/pipeline"
+	"anti2api-golang/internal/postprocess"
 	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/tracing"
 	"anti2api-golang/internal/utils"
 )
 
 // recordLog 记录 API 调用日志
-func recordLog(method, path string, req *converter.OpenAIChatRequest, token *store.Account, status int, success bool, duration time.Duration, errMsg string, responseContent string) {
+func recordLog(r *http.Request, req *converter.OpenAIChatRequest, token *store.Account, status int, success bool, duration time.Duration, errMsg string, responseContent string) {
+	store.GetLogStore().Add(buildLogEntry(r, req, token, status, success, duration, errMsg, responseContent))
+}
+
+// buildLogEntry 构建日志条目（需要附加字段时先构建再写入）
+func buildLogEntry(r *http.Request, req *converter.OpenAIChatRequest, token *store.Account, status int, success bool, duration time.Duration, errMsg string, responseContent string) store.LogEntry {
+	entry := newLogEntry(r, req.Model, req, token, status, success, duration, errMsg, responseContent)
+	entry.Warnings = req.Warnings
+	entry.Moderation = req.Moderation
+	entry.Fallbacks = failoverCount(r.Context())
+	if req.TokenBudget != nil && entry.Detail != nil && logger.Enabled(logger.ComponentAPI, logger.LogHigh) {
+		entry.Detail.TokenBudget = req.TokenBudget
+	}
+	if c := req.Compression; c != nil {
+		entry.Compression, entry.CompressionSaved = c.Mode, c.SavedTokens
+		if success {
+			// 成功的请求记录完整发送的系统提示，之后同一会话可以引用
+			converter.RememberSystemPrompt(c)
+		}
+	}
+	return entry
+}
+
+// newLogEntry 构建日志条目（body 为任意协议的客户端请求，按类型识别协议并提取摘要）
+func newLogEntry(r *http.Request, model string, body interface{}, token *store.Account, status int, success bool, duration time.Duration, errMsg string, responseContent string) store.LogEntry {
+	protocol, summary := converter.SummarizeRequest(body)
+	if summary.Model == "" {
+		summary.Model = model
+	}
 	entry := store.LogEntry{
 		ID:         utils.GenerateRequestID(),
 		Timestamp:  time.Now(),
 		Status:     status,
 		Success:    success,
-		Model:      req.Model,
-		Method:     method,
-		Path:       path,
+		Model:      model,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Protocol:   protocol,
+		Summary:    &summary,
+		ClientIP:   utils.ClientIP(r),
+		KeyID:      usageKeyID(r),
+		TraceID:    tracing.TraceID(r.Context()),
 		DurationMs: duration.Milliseconds(),
 		Message:    errMsg,
+		Chaos:      chaos.IsInjected(errMsg),
 		HasDetail:  true,
 		Detail: &store.LogDetail{
 			Request: &store.RequestSnapshot{
-				Body: req,
+				Protocol: protocol,
+				Body:     body,
 			},
+			UpstreamHeaders: api.CapturedHeaders(r.Context()),
 			Response: &store.ResponseSnapshot{
 				StatusCode:  status,
 				ModelOutput: responseContent,
@@ -38,105 +78,250 @@ func recordLog(method, path string, req *converter.OpenAIChatRequest, token *sto
 		},
 	}
 
-	if token != nil {
+	var errorClass string
+	entry.Endpoint, errorClass = api.CapturedOutcome(r.Context())
+	entry.Route = store.RouteTraceFromContext(r.Context()).Explain()
+	if !success {
+		if errorClass == "" {
+			// 未到达上游或流式响应中途失败，按状态码和错误消息分类
+			errorClass = api.ClassifyError(status, "", errMsg)
+		}
+		entry.ErrorClass = errorClass
+	}
+
+	if token != nil && token.Passthrough {
+		// 透传凭证不记录项目和凭证本身，用量归入 passthrough
+		entry.Email = store.PassthroughBucket
+		entry.Passthrough = store.PassthroughHash(token.AccessToken)
+		entry.Tenant = token.Tenant
+	} else if token != nil {
 		entry.ProjectID = token.ProjectID
 		entry.Email = token.Email
+		entry.Tenant = token.Tenant
 	}
 
-	store.GetLogStore().Add(entry)
+	return entry
+}
+
+// usageKeyID 用量统计中标识 API Key 的哈希前缀（不记录 Key 本身）
+func usageKeyID(r *http.Request) string {
+	if ExtractAPIKey(r) == "" {
+		return ""
+	}
+	return apiKeyHash(r)[:12]
+}
+
+// attachUsageDiagnostics 记录上游用量，检查是否与估算严重不符，调试级别为 high 时记录原始用量序列
+func attachUsageDiagnostics(entry *store.LogEntry, estimate int, usage *converter.UsageMetadata, events []converter.UsageMetadata) {
+	if usage != nil {
+		entry.PromptTokens = usage.PromptTokenCount
+		entry.CompletionTokens = usage.CandidatesTokenCount + usage.ThoughtsTokenCount
+	}
+	if warning := converter.CheckUsage(estimate, usage); warning != "" {
+		logger.Warn("Inconsistent usage for %s: %s", entry.Model, warning)
+		entry.UsageWarning = warning
+	}
+	if len(events) > 0 && entry.Detail != nil && logger.Enabled(logger.ComponentAPI, logger.LogHigh) {
+		entry.Detail.UsageEvents = events
+	}
 }
 
-// HandleGetModels 获取模型列表
+// HandleGetModels 获取模型列表（带 anthropic-version 请求头时返回 Anthropic 格式）
 func HandleGetModels(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("anthropic-version") != "" {
+		handleAnthropicModels(w, r)
+		return
+	}
+
 	models := converter.ModelsResponse{
 		Object: "list",
-		Data:   converter.SupportedModels,
+		Data:   converter.ModelsWithLimits(),
+	}
+	WriteJSON(w, http.StatusOK, models)
+}
+
+// handleAnthropicModels Anthropic 格式的模型列表（limit、before_id、after_id 分页）
+func handleAnthropicModels(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_limit"))
+			return
+		}
+		limit = n
+	}
+
+	models, err := converter.GetAnthropicModels(limit, query.Get("before_id"), query.Get("after_id"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 	WriteJSON(w, http.StatusOK, models)
 }
 
 // HandleChatCompletions 处理聊天完成请求
 func HandleChatCompletions(w http.ResponseWriter, r *http.Request) {
-	var req converter.OpenAIChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+	// 非流式响应按 Accept 编码（NDJSON、MessagePack）
+	nw := withNegotiatedFormat(w, r)
+	w = nw
+
+	req, err := converter.DecodeOpenAIChatRequest(r.Body)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_body", err))
 		return
 	}
+	if req.Stream {
+		w = nw.ResponseWriter
+	}
 
 	// 记录客户端请求
 	logger.ClientRequest(r.Method, r.URL.Path, req)
 
-	// 获取 token
-	token, err := store.GetAccountStore().GetToken()
-	if err != nil {
-		WriteError(w, http.StatusServiceUnavailable, err.Error())
+	if !validateChatRequest(w, r, req) {
+		return
+	}
+
+	// 内联内容审核
+	if !screenChatRequest(w, r, req) {
+		return
+	}
+
+	// 账号全部不可用时延迟重试（X-Defer-On-Exhaustion）
+	maxWait, ok := parseDeferOptions(w, r, req)
+	if !ok {
+		return
+	}
+	if maxWait > 0 {
+		serveDeferrable(w, r, req, maxWait)
+		return
+	}
+
+	serveChatRequest(w, r, req)
+}
+
+// serveChatRequest 获取 token 并处理已校验的请求
+func serveChatRequest(w http.ResponseWriter, r *http.Request, req *converter.OpenAIChatRequest) {
+	// 获取 token（会话标识用于排空账号的会话保持）
+	r = r.WithContext(store.WithConversation(r.Context(), converter.OpenAIConversationKey(req)))
+	r, token, ok := acquireToken(w, r)
+	if !ok {
 		return
 	}
+	// 上游拒绝账号时换用账号池中的其他账号
+	r = withAccountFailover(r)
 
 	// 处理请求
 	if req.Stream {
-		handleStreamRequest(w, r, &req, token)
+		handleStreamRequest(w, r, req, token)
 	} else {
-		handleNonStreamRequest(w, r, &req, token)
+		handleNonStreamRequest(w, r, req, token)
 	}
 }
 
 // HandleChatCompletionsWithCredential 使用指定凭证处理聊天完成请求
 func HandleChatCompletionsWithCredential(w http.ResponseWriter, r *http.Request) {
 	credential := r.PathValue("credential")
+	nw := withNegotiatedFormat(w, r)
+	w = nw
 
-	var req converter.OpenAIChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
-		return
-	}
-
-	logger.ClientRequest(r.Method, r.URL.Path, req)
-
-	// 按凭证获取 token
+	// 按凭证获取 token（在读取请求体之前，凭证无效时不接收请求体）
 	var token *store.Account
 	var err error
+	r = withFreshSession(r)
 
 	accountStore := store.GetAccountStore()
 	if strings.Contains(credential, "@") {
-		token, err = accountStore.GetTokenByEmail(credential)
+		token, err = accountStore.GetTokenByEmail(r.Context(), credential)
 	} else {
-		token, err = accountStore.GetTokenByProjectID(credential)
+		token, err = accountStore.GetTokenByProjectID(r.Context(), credential)
+	}
+
+	if err != nil {
+		CloseUnreadBody(w, r)
+		WriteError(w, http.StatusNotFound, Message(w, "credentials.not_found", credential))
+		return
 	}
 
+	req, err := converter.DecodeOpenAIChatRequest(r.Body)
 	if err != nil {
-		WriteError(w, http.StatusNotFound, "Credential not found: "+credential)
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_body", err))
+		return
+	}
+	if req.Stream {
+		w = nw.ResponseWriter
+	}
+
+	logger.ClientRequest(r.Method, r.URL.Path, req)
+
+	if !validateChatRequest(w, r, req) {
+		return
+	}
+
+	// 内联内容审核
+	if !screenChatRequest(w, r, req) {
 		return
 	}
 
 	// 处理请求
 	if req.Stream {
-		handleStreamRequest(w, r, &req, token)
+		handleStreamRequest(w, r, req, token)
 	} else {
-		handleNonStreamRequest(w, r, &req, token)
+		handleNonStreamRequest(w, r, req, token)
 	}
 }
 
+// convertChatRequest 转换为上游请求
+func convertChatRequest(r *http.Request, req *converter.OpenAIChatRequest, token *store.Account) *converter.AntigravityRequest {
+	_, span := tracing.Start(r.Context(), "request.convert")
+	defer span.End()
+	antigravityReq := converter.ConvertOpenAIToAntigravity(req, token)
+	span.SetAttr("gen_ai.request.model", antigravityReq.Model)
+	span.SetAttr("request.contents", len(antigravityReq.Request.Contents))
+	return antigravityReq
+}
+
 func handleNonStreamRequest(w http.ResponseWriter, r *http.Request, req *converter.OpenAIChatRequest, token *store.Account) {
 	startTime := time.Now()
+	r = r.WithContext(api.WithHeaderCapture(r.Context()))
 
 	// 转换请求
-	antigravityReq := converter.ConvertOpenAIToAntigravity(req, token)
+	antigravityReq := convertChatRequest(r, req, token)
 
 	// 发送请求
 	ctx := r.Context()
 	resp, err := api.GenerateContent(ctx, antigravityReq, token)
+	for err != nil {
+		next := nextFailoverAccount(r, token, err)
+		if next == nil {
+			break
+		}
+		token = next
+		antigravityReq = convertChatRequest(r, req, token)
+		resp, err = api.GenerateContent(ctx, antigravityReq, token)
+	}
 	if err != nil {
 		duration := time.Since(startTime)
 		logger.ClientResponse(getErrorStatus(err), duration, err.Error())
 		// 记录失败日志
-		recordLog(r.Method, r.URL.Path, req, token, getErrorStatus(err), false, duration, err.Error(), "")
-		WriteError(w, getErrorStatus(err), err.Error())
+		recordLog(r, req, token, getErrorStatus(err), false, duration, err.Error(), "")
+		writeRouteError(w, r, getErrorStatus(err), err.Error())
 		return
 	}
 
 	// 转换响应
-	openAIResp := converter.ConvertToOpenAIResponse(resp, req.Model)
+	_, renderSpan := tracing.Start(ctx, "response.render")
+	defer renderSpan.End()
+	openAIResp := converter.ConvertToOpenAIResponse(resp, req.Model, antigravityReq.Request.Tools)
+
+	// 响应校验（未通过时重试一次）
+	openAIResp, validation := validateResponse(ctx, req, token, openAIResp)
+	openAIResp.Warnings = req.Warnings
+	openAIResp.Route = routeExplanation(r)
+
+	// 工具调用隔离（可能等待审批）
+	quarantined := screenToolCalls(ctx, openAIResp, req.Model, token)
 
 	duration := time.Since(startTime)
 	logger.ClientResponse(http.StatusOK, duration, openAIResp)
@@ -146,13 +331,44 @@ func handleNonStreamRequest(w http.ResponseWriter, r *http.Request, req *convert
 	if len(openAIResp.Choices) > 0 {
 		responseContent = openAIResp.Choices[0].Message.Content
 	}
-	recordLog(r.Method, r.URL.Path, req, token, http.StatusOK, true, duration, "", responseContent)
+	entry := buildLogEntry(r, req, token, http.StatusOK, true, duration, "", responseContent)
+	if len(openAIResp.Choices) > 0 {
+		message := openAIResp.Choices[0].Message
+		entry.Empty = message.Content == "" && message.Reasoning == "" && len(message.ToolCalls) == 0
+	}
+	entry.PostProcessed = openAIResp.PostProcessed
+	entry.Validation = validation
+	entry.Quarantine = quarantined
+	attachUsageDiagnostics(&entry, converter.EstimateTokens(req).Total, resp.Response.UsageMetadata, nil)
+	store.GetLogStore().Add(entry)
 
+	if len(openAIResp.Choices) > 0 {
+		choice := openAIResp.Choices[0]
+		finishReason := ""
+		if choice.FinishReason != nil {
+			finishReason = *choice.FinishReason
+		}
+		mirrorToCorpus(r, req, choice.Message, finishReason, openAIResp.Usage, duration)
+	}
+	saveCompletion(r, req, openAIResp)
+	setContentDigestHeaders(w, openAIResp)
 	WriteJSON(w, http.StatusOK, openAIResp)
 }
 
+// setContentDigestHeaders 非流式响应的内容摘要头（与流式响应的 trailer 相同）
+func setContentDigestHeaders(w http.ResponseWriter, resp *converter.OpenAIChatCompletion) {
+	if len(resp.Choices) == 0 {
+		return
+	}
+	message := resp.Choices[0].Message
+	w.Header().Set(api.ContentDigestHeader, api.ContentDigest(message.Content))
+	if message.Reasoning != "" {
+		w.Header().Set(api.ReasoningDigestHeader, api.ContentDigest(message.Reasoning))
+	}
+}
+
 func handleStreamRequest(w http.ResponseWriter, r *http.Request, req *converter.OpenAIChatRequest, token *store.Account) {
-	startTime := time.Now()
+	r = r.WithContext(api.WithHeaderCapture(r.Context()))
 
 	// 检查是否为 bypass 模式
 	if converter.IsBypassModel(req.Model) {
@@ -160,171 +376,157 @@ func handleStreamRequest(w http.ResponseWriter, r *http.Request, req *converter.
 		return
 	}
 
-	// 转换请求
-	antigravityReq := converter.ConvertOpenAIToAntigravity(req, token)
-
-	// 发送流式请求
-	ctx := r.Context()
-	resp, err := api.GenerateContentStream(ctx, antigravityReq, token)
-	if err != nil {
-		duration := time.Since(startTime)
-		api.SetStreamHeaders(w)
-		api.WriteStreamError(w, err.Error())
-		// 记录失败日志
-		recordLog(r.Method, r.URL.Path, req, token, getErrorStatus(err), false, duration, err.Error(), "")
-		return
-	}
-
-	// 设置流式响应头
-	api.SetStreamHeaders(w)
-
 	id := utils.GenerateChatCompletionID()
 	created := time.Now().Unix()
 	model := req.Model
 
-	streamWriter := api.NewStreamWriter(w, id, created, model)
-
-	var usage *converter.UsageMetadata
-	var toolCalls []converter.OpenAIToolCall
-	var contentBuilder strings.Builder
-
-	// 处理流式响应
-	usage, err = api.ProcessStreamResponse(resp, func(chunk api.StreamChunk) {
-		switch chunk.Type {
-		case "thinking":
-			streamWriter.WriteReasoning(chunk.Content)
-		case "text":
-			streamWriter.WriteContent(chunk.Content)
-			contentBuilder.WriteString(chunk.Content)
-		case "tool_calls":
-			toolCalls = chunk.ToolCalls
-			streamWriter.WriteToolCalls(chunk.ToolCalls)
-		case "done":
-			// 处理完成
-		}
-	})
-
-	duration := time.Since(startTime)
-
-	if err != nil {
-		logger.Error("Stream processing error: %v", err)
-		// 记录失败日志
-		recordLog(r.Method, r.URL.Path, req, token, http.StatusInternalServerError, false, duration, err.Error(), contentBuilder.String())
-	} else {
-		// 记录成功日志
-		recordLog(r.Method, r.URL.Path, req, token, http.StatusOK, true, duration, "", contentBuilder.String())
-	}
-
-	// 发送结束
-	finishReason := "stop"
-	if len(toolCalls) > 0 {
-		finishReason = "tool_calls"
+	streamWriter := newStreamWriter(w, r, id, created, model)
+	streamWriter.SetWarnings(req.Warnings)
+
+	orchestrator := &pipeline.Orchestrator{
+		Request:   convertChatRequest(r, req, token),
+		Account:   token,
+		Model:     model,
+		Renderer:  newOpenAIRenderer(w, streamWriter),
+		Heartbeat: time.Duration(config.Get().StreamHeartbeatInterval) * time.Second,
+		Failover:  chatFailover(r, req),
+		OnComplete: func(result *pipeline.Result) {
+			recordStreamLog(r, req, result.Account, streamWriter, true, result)
+		},
+		ToolCallGuard: quarantineGuard(model, token),
 	}
-
-	var usageData *converter.Usage
-	if usage != nil {
-		usageData = converter.ConvertUsage(usage)
+	if processor := postprocess.NewStreamProcessor(model); processor != nil {
+		orchestrator.Filter = processor
 	}
 
-	streamWriter.WriteFinish(finishReason, usageData)
+	ctx, cancel := cancelOnWriteError(r.Context(), streamWriter)
+	defer cancel()
+	result := orchestrator.Run(ctx)
+	saveStreamCompletion(r, req, id, created, result)
 }
 
 func handleBypassStream(w http.ResponseWriter, r *http.Request, req *converter.OpenAIChatRequest, token *store.Account) {
-	startTime := time.Now()
 	id := utils.GenerateChatCompletionID()
 	created := time.Now().Unix()
 	model := req.Model
 
-	// NewStreamWriter 内部会设置响应头
-	streamWriter := api.NewStreamWriter(w, id, created, model)
-
-	// 立即发送第一个心跳，确保客户端计时器启动
-	if err := streamWriter.WriteHeartbeat(); err != nil {
-		return
-	}
-
-	// 启动心跳 goroutine
-	ctx, cancel := context.WithCancel(r.Context())
-	defer cancel()
-
-	done := make(chan struct{})
-
-	go func() {
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				if err := streamWriter.WriteHeartbeat(); err != nil {
-					return
-				}
-			case <-done:
-				return
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
+	streamWriter := newStreamWriter(w, r, id, created, model)
+	streamWriter.SetWarnings(req.Warnings)
 
 	// 转换请求（使用真实模型名）
-	actualModel := converter.ResolveModelName(req.Model)
 	modifiedReq := *req
-	modifiedReq.Model = actualModel
-
-	antigravityReq := converter.ConvertOpenAIToAntigravity(&modifiedReq, token)
-
-	// 执行非流式请求
-	resp, err := api.GenerateContent(ctx, antigravityReq, token)
-	close(done)
-
-	if err != nil {
-		duration := time.Since(startTime)
-		streamWriter.WriteContent("Error: " + err.Error())
-		streamWriter.WriteFinish("stop", nil)
-		// 记录失败日志
-		recordLog(r.Method, r.URL.Path, req, token, getErrorStatus(err), false, duration, err.Error(), "")
-		return
+	modifiedReq.Model = converter.ResolveModelName(req.Model)
+
+	orchestrator := &pipeline.Orchestrator{
+		Request:   convertChatRequest(r, &modifiedReq, token),
+		Account:   token,
+		Model:     model,
+		Renderer:  newOpenAIRenderer(w, streamWriter),
+		Bypass:    true,
+		Pacing:    bypassPacing(r),
+		Heartbeat: time.Second,
+		OnComplete: func(result *pipeline.Result) {
+			recordStreamLog(r, req, token, streamWriter, true, result)
+		},
+		ToolCallGuard: quarantineGuard(model, token),
 	}
 
-	// 转换响应
-	openAIResp := converter.ConvertToOpenAIResponse(resp, model)
+	ctx, cancel := cancelOnWriteError(r.Context(), streamWriter)
+	defer cancel()
+	result := orchestrator.Run(ctx)
+	if result.Usage != nil || result.Content != "" || len(result.ToolCalls) > 0 {
+		saveStreamCompletion(r, req, id, created, result)
+	}
+}
 
-	duration := time.Since(startTime)
+// BypassPaceHeader 请求级 bypass 分段回放间隔（毫秒，0 为整体输出）
+const BypassPaceHeader = "X-Bypass-Pace-Ms"
 
-	// 发送完整内容
-	if len(openAIResp.Choices) > 0 {
-		msg := openAIResp.Choices[0].Message
+// maxBypassPace 请求可指定的最大回放间隔
+const maxBypassPace = time.Second
 
-		if msg.Reasoning != "" {
-			streamWriter.WriteReasoning(msg.Reasoning)
-		}
-		if len(msg.ToolCalls) > 0 {
-			streamWriter.WriteToolCalls(msg.ToolCalls)
-		}
-		if msg.Content != "" {
-			streamWriter.WriteContent(msg.Content)
+// bypassPacing bypass 模式的分段回放设置（配置和请求头）
+func bypassPacing(r *http.Request) pipeline.Pacing {
+	cfg := config.Get()
+	interval := time.Duration(cfg.BypassPaceMs) * time.Millisecond
+	if v := r.Header.Get(BypassPaceHeader); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms >= 0 {
+			interval = time.Duration(ms) * time.Millisecond
 		}
+	}
+	if interval > maxBypassPace {
+		interval = maxBypassPace
+	}
+	unit := pipeline.PaceByWord
+	if cfg.BypassPaceUnit == pipeline.PaceBySentence {
+		unit = pipeline.PaceBySentence
+	}
+	return pipeline.Pacing{
+		Interval: interval,
+		Unit:     unit,
+		MaxExtra: time.Duration(cfg.BypassPaceMaxExtraMs) * time.Millisecond,
+	}
+}
 
-		finishReason := "stop"
-		if openAIResp.Choices[0].FinishReason != nil {
-			finishReason = *openAIResp.Choices[0].FinishReason
-		}
+// recordStreamLog 记录流式请求日志（成功时先校验，结果标记在结束 chunk 中）
+func recordStreamLog(r *http.Request, req *converter.OpenAIChatRequest, token *store.Account, streamWriter *api.StreamWriter, withStats bool, result *pipeline.Result) {
+	errMsg := ""
+	if result.Err != nil {
+		errMsg = result.Err.Error()
+	}
+	entry := buildLogEntry(r, req, token, result.Status, result.Success(), result.Duration, errMsg, result.Content)
+	entry.Empty = result.Success() && result.Empty()
+	entry.PostProcessed = result.PostProcessed
+	entry.Quarantine = result.Quarantine
+	if withStats && result.Started {
+		entry.Stream = streamWriter.Stats()
+	}
+	attachUsageDiagnostics(&entry, converter.EstimateTokens(req).Total, result.UsageMetadata, result.UsageEvents)
+	if result.Success() {
+		entry.Validation = validateStreamContent(streamWriter, req.Model, result.Content)
+	}
+	if err := streamWriter.Err(); err != nil {
+		logger.Warn("Stream write to client failed, output stopped: %v", err)
+	}
+	store.GetLogStore().Add(entry)
 
-		streamWriter.WriteFinish(finishReason, openAIResp.Usage)
+	if result.Success() {
+		mirrorToCorpus(r, req, converter.Message{
+			Role:      "assistant",
+			Content:   result.Content,
+			ToolCalls: result.ToolCalls,
+			Reasoning: result.Reasoning,
+		}, result.FinishReason, result.Usage, result.Duration)
+	}
+}
 
-		// 记录成功日志
-		recordLog(r.Method, r.URL.Path, req, token, http.StatusOK, true, duration, "", msg.Content)
-	} else {
-		streamWriter.WriteFinish("stop", nil)
-		// 记录成功但无内容的日志
-		recordLog(r.Method, r.URL.Path, req, token, http.StatusOK, true, duration, "", "")
+// saveStreamCompletion 保存组装后的完整消息（store: true）
+func saveStreamCompletion(r *http.Request, req *converter.OpenAIChatRequest, id string, created int64, result *pipeline.Result) {
+	if !req.Store || !result.Success() {
+		return
 	}
+
+	finishReason := result.FinishReason
+	saveCompletion(r, req, &converter.OpenAIChatCompletion{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   req.Model,
+		Choices: []converter.Choice{{
+			Index: 0,
+			Message: converter.Message{
+				Role:        "assistant",
+				Content:     result.Content,
+				ToolCalls:   result.ToolCalls,
+				Reasoning:   result.Reasoning,
+				Annotations: result.Annotations,
+			},
+			FinishReason: &finishReason,
+		}},
+		Usage: result.Usage,
+	})
 }
 
 func getErrorStatus(err error) int {
-	if apiErr, ok := err.(*api.APIError); ok {
-		return apiErr.Status
-	}
-	return http.StatusInternalServerError
+	return api.ErrorStatus(err)
 }
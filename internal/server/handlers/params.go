@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/tracing"
+)
+
+// 请求级不支持参数处理方式
+const (
+	UnsupportedParamsHeader = "X-Unsupported-Params"
+	DroppedParamsHeader     = "X-Dropped-Params"
+)
+
+// validateChatRequest 校验聊天请求（不支持的参数、无法转换的内容、流式支持），返回 false 时已写入错误响应
+func validateChatRequest(w http.ResponseWriter, r *http.Request, req *converter.OpenAIChatRequest) bool {
+	_, span := tracing.Start(r.Context(), "request.validate")
+	defer span.End()
+	ok := checkUnsupportedParams(w, r, req) && checkConversion(w, r, req) && (!req.Stream || checkStreamSupport(w, r)) &&
+		checkKeyLimits(w, r, req)
+	span.SetAttr("request.valid", ok)
+	span.SetAttr("request.warnings", len(req.Warnings))
+	return ok
+}
+
+// checkUnsupportedParams 按配置或请求头处理不支持的参数，返回 false 时已写入错误响应
+func checkUnsupportedParams(w http.ResponseWriter, r *http.Request, req *converter.OpenAIChatRequest) bool {
+	mode, ok := converter.ParseUnsupportedParamsMode(config.Get().UnsupportedParams)
+	if !ok {
+		mode = converter.UnsupportedParamsDrop
+	}
+	if v := r.Header.Get(UnsupportedParamsHeader); v != "" {
+		if mode, ok = converter.ParseUnsupportedParamsMode(v); !ok {
+			WriteError(w, http.StatusBadRequest, Message(w, "params.invalid_mode_header", UnsupportedParamsHeader))
+			return false
+		}
+	}
+
+	if len(req.Unsupported) == 0 {
+		return true
+	}
+
+	switch mode {
+	case converter.UnsupportedParamsError:
+		WriteError(w, http.StatusBadRequest, Message(w, "params.unsupported", strings.Join(req.Unsupported, ", ")))
+		return false
+	case converter.UnsupportedParamsWarn:
+		w.Header().Set(DroppedParamsHeader, strings.Join(req.Unsupported, ","))
+		for _, param := range req.Unsupported {
+			req.Warnings = append(req.Warnings, "unsupported parameter dropped: "+param)
+		}
+	}
+	return true
+}
+
+// checkConversion 检查请求中无法转换的内容：错误返回 400，警告加入响应 warnings，返回 false 时已写入错误响应
+func checkConversion(w http.ResponseWriter, r *http.Request, req *converter.OpenAIChatRequest) bool {
+	req.ToolResults = toolResultPolicy(r)
+	result := converter.CheckConversion(req)
+	if issue := result.Err(); issue != nil {
+		WriteParamError(w, http.StatusBadRequest, issue.Error(), issue.Param, issue.Code)
+		return false
+	}
+	req.Warnings = append(req.Warnings, result.Warnings()...)
+	return true
+}
+
+// toolResultPolicy 按 API Key 对应的租户配置或全局配置确定 tool 结果大小限制
+func toolResultPolicy(r *http.Request) converter.ToolResultPolicy {
+	cfg := config.Get()
+	maxKB, modeValue := cfg.ToolResultMaxKB, cfg.ToolResultMode
+	if tenant := store.GetTenantStore().ByAPIKey(ExtractAPIKey(r)); tenant != nil {
+		if tenant.ToolResultMaxKB != nil {
+			maxKB = *tenant.ToolResultMaxKB
+		}
+		if tenant.ToolResultMode != "" {
+			modeValue = tenant.ToolResultMode
+		}
+	}
+	mode, ok := converter.ParseToolResultMode(modeValue)
+	if !ok {
+		mode = converter.ToolResultTruncate
+	}
+	return converter.ToolResultPolicy{
+		MaxBytes:  maxKB * 1024,
+		Mode:      mode,
+		HeadRatio: float64(cfg.ToolResultHeadPercent) / 100,
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/quarantine"
+	"anti2api-golang/internal/store"
+)
+
+// quarantineGuard 流式请求的工具调用检查，未配置隔离规则时返回 nil
+func quarantineGuard(model string, token *store.Account) func(ctx context.Context, calls []converter.OpenAIToolCall) quarantine.Decision {
+	engine := quarantine.Get()
+	if !engine.Enabled() {
+		return nil
+	}
+	tenant := ""
+	if token != nil {
+		tenant = token.Tenant
+	}
+	return func(ctx context.Context, calls []converter.OpenAIToolCall) quarantine.Decision {
+		return engine.Review(ctx, model, tenant, calls)
+	}
+}
+
+// screenToolCalls 按隔离规则检查非流式响应中的工具调用；被阻止时替换为拒绝消息，返回命中标记
+func screenToolCalls(ctx context.Context, resp *converter.OpenAIChatCompletion, model string, token *store.Account) []string {
+	if len(resp.Choices) == 0 || len(resp.Choices[0].Message.ToolCalls) == 0 {
+		return nil
+	}
+	guard := quarantineGuard(model, token)
+	if guard == nil {
+		return nil
+	}
+
+	choice := &resp.Choices[0]
+	decision := guard(ctx, choice.Message.ToolCalls)
+	if decision.Blocked {
+		if choice.Message.Content != "" {
+			choice.Message.Content += "\n\n"
+		}
+		choice.Message.Content += quarantine.RefusalMessage
+		choice.Message.ToolCalls = nil
+		reason := "content_filter"
+		choice.FinishReason = &reason
+	}
+	resp.Quarantine = decision.Labels()
+	return resp.Quarantine
+}
+
+// HandleGetQuarantine 获取隔离规则命中统计和待审批的工具调用
+func HandleGetQuarantine(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, quarantine.Get().Stats())
+}
+
+// HandleApproveQuarantine 批准挂起的工具调用
+func HandleApproveQuarantine(w http.ResponseWriter, r *http.Request) {
+	resolveQuarantine(w, r, true)
+}
+
+// HandleRejectQuarantine 拒绝挂起的工具调用
+func HandleRejectQuarantine(w http.ResponseWriter, r *http.Request) {
+	resolveQuarantine(w, r, false)
+}
+
+func resolveQuarantine(w http.ResponseWriter, r *http.Request, approve bool) {
+	if err := quarantine.Get().Resolve(r.PathValue("id"), approve); err != nil {
+		WriteError(w, http.StatusNotFound, Message(w, "quarantine.approval_not_found"))
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/utils"
+)
+
+// recoverWriter 记录响应头是否已发送
+type recoverWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoverWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recoverWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush 实现 http.Flusher 接口，支持流式响应
+func (w *recoverWriter) Flush() {
+	w.wroteHeader = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 返回底层 ResponseWriter
+func (w *recoverWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Recover 捕获处理函数中的 panic：记录堆栈和失败日志，解除请求建立的会话绑定，
+// 响应头未发送时返回 500，流式响应已开始时尽量写入错误块和 [DONE]，让客户端收到结构化的失败
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, reservations := store.WithReservations(r.Context())
+		rw := &recoverWriter{ResponseWriter: w}
+
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			released := reservations.Release(store.UnbindAborted)
+			logger.Error("Panic serving %s %s: %v (released %d conversation bindings)\n%s",
+				r.Method, r.URL.Path, p, released, debug.Stack())
+
+			tenant, _ := store.TenantFromContext(ctx)
+			store.GetLogStore().Add(store.LogEntry{
+				ID:         utils.GenerateRequestID(),
+				Timestamp:  time.Now(),
+				Status:     http.StatusInternalServerError,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				DurationMs: time.Since(start).Milliseconds(),
+				Message:    fmt.Sprintf("internal error: panic: %v", p),
+				ErrorClass: api.ErrorClassUnknown,
+				Tenant:     tenant,
+				ClientIP:   utils.ClientIP(r),
+				KeyID:      usageKeyID(r),
+			})
+
+			message := Message(w, "server.internal_error")
+			switch {
+			case !rw.wroteHeader:
+				WriteError(w, http.StatusInternalServerError, message)
+			case strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream"):
+				api.WriteStreamError(w, http.StatusInternalServerError, message)
+			}
+			// 非流式响应已部分写出时无法再返回错误，客户端会收到不完整的响应体
+		}()
+
+		// 请求处理协程标记为 http 阶段（流式输出在编排器中另行标记）
+		monitor.Do(ctx, "http", func(ctx context.Context) {
+			next.ServeHTTP(rw, r.WithContext(ctx))
+		})
+	})
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/pipeline"
+)
+
+// openAIRenderer OpenAI chat.completion.chunk 格式输出
+type openAIRenderer struct {
+	w      http.ResponseWriter
+	writer *api.StreamWriter
+}
+
+func newOpenAIRenderer(w http.ResponseWriter, writer *api.StreamWriter) *openAIRenderer {
+	return &openAIRenderer{w: w, writer: writer}
+}
+
+func (o *openAIRenderer) Start() {
+	api.SetStreamHeaders(o.w)
+}
+
+func (o *openAIRenderer) Reasoning(text string) {
+	o.writer.WriteReasoning(text)
+}
+
+func (o *openAIRenderer) Content(text string) {
+	o.writer.WriteContent(text)
+}
+
+func (o *openAIRenderer) ToolCalls(calls []converter.OpenAIToolCall) {
+	o.writer.WriteToolCalls(calls)
+}
+
+func (o *openAIRenderer) Heartbeat() error {
+	return o.writer.WriteHeartbeat()
+}
+
+func (o *openAIRenderer) Error(err error, started bool) {
+	if started {
+		// 已经输出过心跳，只能以内容形式返回错误
+		o.writer.WriteContent("Error: " + err.Error())
+		o.writer.WriteFinish("stop", nil)
+		return
+	}
+	api.SetStreamHeaders(o.w)
+	api.WriteStreamError(o.w, getErrorStatus(err), err.Error())
+}
+
+func (o *openAIRenderer) Finish(result *pipeline.Result) {
+	if result.Truncated {
+		o.writer.SetTruncated(result.ToolCallsIncomplete)
+	}
+	o.writer.SetQuarantine(result.Quarantine)
+	o.writer.WriteAnnotations(result.Annotations, config.Get().StreamAnnotations)
+	o.writer.WriteFinish(result.FinishReason, result.Usage)
+}
+
+// geminiRenderer 标准 Gemini streamGenerateContent（SSE）格式输出
+type geminiRenderer struct {
+	w http.ResponseWriter
+}
+
+func (g *geminiRenderer) Start() {
+	api.SetStreamHeaders(g.w)
+}
+
+func (g *geminiRenderer) writeParts(parts []converter.Part, finishReason string, usage *converter.UsageMetadata) {
+	g.writeCandidate(converter.Candidate{
+		Content:      converter.Content{Role: "model", Parts: parts},
+		FinishReason: finishReason,
+	}, usage)
+}
+
+func (g *geminiRenderer) writeCandidate(candidate converter.Candidate, usage *converter.UsageMetadata) {
+	api.WriteStreamData(g.w, converter.GeminiResponse{
+		Candidates:    []converter.Candidate{candidate},
+		UsageMetadata: usage,
+	})
+}
+
+func (g *geminiRenderer) Reasoning(text string) {
+	g.writeParts([]converter.Part{{Text: text, Thought: true}}, "", nil)
+}
+
+func (g *geminiRenderer) Content(text string) {
+	g.writeParts([]converter.Part{{Text: text}}, "", nil)
+}
+
+func (g *geminiRenderer) ToolCalls(calls []converter.OpenAIToolCall) {
+	parts := make([]converter.Part, 0, len(calls))
+	for _, tc := range calls {
+		var args json.RawMessage
+		if json.Valid([]byte(tc.Function.Arguments)) {
+			args = json.RawMessage(tc.Function.Arguments)
+		}
+		parts = append(parts, converter.Part{
+			FunctionCall: &converter.FunctionCall{Name: tc.Function.Name, Args: args},
+		})
+	}
+	g.writeParts(parts, "", nil)
+}
+
+func (g *geminiRenderer) Heartbeat() error {
+	return nil
+}
+
+func (g *geminiRenderer) Error(err error, started bool) {
+	if started {
+		api.WriteStreamData(g.w, map[string]interface{}{
+			"error": map[string]interface{}{"message": err.Error()},
+		})
+		return
+	}
+	WriteError(g.w, getErrorStatus(err), err.Error())
+}
+
+func (g *geminiRenderer) Finish(result *pipeline.Result) {
+	finishReason := "STOP"
+	if result.Truncated {
+		finishReason = "OTHER"
+	} else if result.UpstreamFinishReason != "" {
+		finishReason = result.UpstreamFinishReason
+	}
+	// 引用信息原样透传（Gemini 格式的偏移针对上游原文）
+	g.writeCandidate(converter.Candidate{
+		Content:           converter.Content{Role: "model", Parts: []converter.Part{}},
+		FinishReason:      finishReason,
+		GroundingMetadata: result.Grounding,
+	}, result.UsageMetadata)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"anti2api-golang/internal/auth"
+	"anti2api-golang/internal/store"
+)
+
+// DebugRouteHeader 请求在响应中附带路由说明（值为 explain）
+const DebugRouteHeader = "X-Debug-Route"
+
+// withRouteTrace 记录请求的账号和端点选择过程（始终写入日志）
+func withRouteTrace(r *http.Request) *http.Request {
+	return r.WithContext(store.WithRouteTrace(r.Context()))
+}
+
+// routeExplainAllowed 请求是否可以在响应中获得路由说明：需要 X-Debug-Route: explain，
+// 并同时携带有效的管理面板会话或管理 API 令牌（说明中包含账号池的状态）；租户管理员只能查看本租户的请求
+func routeExplainAllowed(r *http.Request) bool {
+	if !strings.EqualFold(strings.TrimSpace(r.Header.Get(DebugRouteHeader)), "explain") {
+		return false
+	}
+	token := auth.GetSessionToken(r)
+	if token == "" {
+		return false
+	}
+	if sessionTenant, _, _, ok := auth.SessionIdentity(token); ok {
+		if sessionTenant == "" {
+			return true
+		}
+		tenant, scoped := store.TenantFromContext(r.Context())
+		return scoped && tenant == sessionTenant
+	}
+	return store.GetPanelAccessStore().ByToken(token) != nil
+}
+
+// routeExplanation 响应中附带的路由说明，未请求或无权查看时为 nil
+func routeExplanation(r *http.Request) *store.RouteExplanation {
+	if !routeExplainAllowed(r) {
+		return nil
+	}
+	return store.RouteTraceFromContext(r.Context()).Explain()
+}
+
+// writeRouteError 写入错误响应，请求了路由说明时在错误对象之外附带 route
+func writeRouteError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	route := routeExplanation(r)
+	if route == nil {
+		WriteError(w, status, message)
+		return
+	}
+	WriteJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    getErrorType(status),
+		},
+		"route": route,
+	})
+}
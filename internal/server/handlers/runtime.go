@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/monitor"
+)
+
+// HandleGetRuntime 运行时指标：当前采样、空闲基线和采样历史
+func HandleGetRuntime(w http.ResponseWriter, r *http.Request) {
+	cfg := config.Get()
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"current":  monitor.Collect(),
+		"baseline": monitor.Baseline(),
+		"history":  monitor.History(),
+		"watchdog": map[string]interface{}{
+			"maxStreamMinutes": cfg.StreamMaxDuration,
+			"cancel":           cfg.StreamWatchdogCancel,
+		},
+	})
+}
+
+// HandleGetActive 进行中的请求和流式输出
+func HandleGetActive(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"active": monitor.Active()})
+}
+
+// HandleCancelActive 强制取消进行中的请求（客户端收到上游中断的错误）
+func HandleCancelActive(w http.ResponseWriter, r *http.Request) {
+	if !monitor.Cancel(r.PathValue("id")) {
+		WriteError(w, http.StatusNotFound, Message(w, "runtime.request_not_found"))
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// HandleGetGoroutines 按处理阶段统计的协程数（pprof 标签 stage）
+func HandleGetGoroutines(w http.ResponseWriter, r *http.Request) {
+	stages := monitor.GoroutinesByStage()
+	total := 0
+	for _, n := range stages {
+		total += n
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"total":  total,
+		"stages": stages,
+	})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"anti2api-golang/internal/selftest"
+)
+
+// maxSelftestStageTimeout 请求可指定的单阶段时间上限
+const maxSelftestStageTimeout = 5 * time.Minute
+
+// HandleSelftest 执行安装自检（POST /admin/selftest，请求体可选：{"skip":["stream"],"timeoutSeconds":30,"model":"..."}），
+// 以 SSE 逐个推送阶段结果（event: stage），最后推送完整报告（event: done）
+func HandleSelftest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Skip           []string `json:"skip"`
+		TimeoutSeconds int      `json:"timeoutSeconds"`
+		Model          string   `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		WriteError(w, http.StatusBadRequest, Message(w, "request.invalid_body", err))
+		return
+	}
+
+	opts := selftest.Options{
+		Skip:         make(map[string]bool),
+		StageTimeout: time.Duration(req.TimeoutSeconds) * time.Second,
+		Model:        req.Model,
+	}
+	if opts.StageTimeout < 0 || opts.StageTimeout > maxSelftestStageTimeout {
+		WriteError(w, http.StatusBadRequest, Message(w, "selftest.invalid_timeout", int(maxSelftestStageTimeout.Seconds())))
+		return
+	}
+	for _, stage := range req.Skip {
+		if !selftest.ValidStage(stage) {
+			WriteError(w, http.StatusBadRequest, Message(w, "selftest.unknown_stage", stage))
+			return
+		}
+		opts.Skip[stage] = true
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	writeEvent := func(event string, data interface{}) {
+		payload, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	report := selftest.Run(r.Context(), opts, func(result selftest.StageResult) {
+		writeEvent("stage", result)
+	})
+	writeEvent("done", report)
+}
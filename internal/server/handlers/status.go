@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/version"
+)
+
+// publicStatusTTL 公开状态的缓存时间
+const publicStatusTTL = 5 * time.Second
+
+// PublicStatus 公开状态页返回的字段（只包含汇总数据，新增字段前确认不含账号、Key、端点等信息）
+type PublicStatus struct {
+	Status        string             `json:"status"` // ok，没有可用账号时为 degraded
+	Version       string             `json:"version"`
+	UptimeSeconds int64              `json:"uptimeSeconds"`
+	Models        []string           `json:"models"`
+	Accounts      PublicAccountStats `json:"accounts"`
+	Today         PublicRequestStats `json:"today"`
+	GeneratedAt   time.Time          `json:"generatedAt"`
+}
+
+// PublicAccountStats 账号数量
+type PublicAccountStats struct {
+	Enabled int `json:"enabled"`
+	Total   int `json:"total"`
+}
+
+// PublicRequestStats 今日请求数（本地时区）
+type PublicRequestStats struct {
+	Requests int `json:"requests"`
+	Failures int `json:"failures"`
+}
+
+var publicStatusCache struct {
+	mu      sync.Mutex
+	body    []byte
+	expires time.Time
+}
+
+// HandlePublicStatus 公开状态（缓存几秒，频繁请求不会重复统计）
+func HandlePublicStatus(w http.ResponseWriter, r *http.Request) {
+	cache := &publicStatusCache
+	cache.mu.Lock()
+	now := time.Now()
+	if cache.body == nil || !now.Before(cache.expires) {
+		body, err := json.Marshal(buildPublicStatus(now))
+		if err != nil {
+			cache.mu.Unlock()
+			WriteError(w, http.StatusInternalServerError, Message(w, "status.encode_failed"))
+			return
+		}
+		cache.body = body
+		cache.expires = now.Add(publicStatusTTL)
+	}
+	body := cache.body
+	cache.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(publicStatusTTL.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// buildPublicStatus 汇总公开状态（不区分租户）
+func buildPublicStatus(now time.Time) PublicStatus {
+	accounts := store.GetAccountStore()
+	status := PublicStatus{
+		Status:        "ok",
+		Version:       version.Get().Version,
+		UptimeSeconds: version.Runtime().UptimeSeconds,
+		Models:        make([]string, 0, len(converter.SupportedModels)),
+		Accounts: PublicAccountStats{
+			Enabled: accounts.EnabledCount(),
+			Total:   accounts.Count(context.Background()),
+		},
+		GeneratedAt: now,
+	}
+	if status.Accounts.Enabled == 0 {
+		status.Status = "degraded"
+	}
+	for _, m := range converter.SupportedModels {
+		status.Models = append(status.Models, m.ID)
+	}
+
+	today := now.Format("2006-01-02")
+	for _, row := range store.GetUsageLedger().Range(today, today) {
+		status.Today.Requests += row.Requests
+		status.Today.Failures += row.Failures
+	}
+	return status
+}
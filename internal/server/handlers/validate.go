@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/validate"
+)
+
+// validationModels 校验器匹配使用的模型名（请求名和真实模型名）
+func validationModels(model string) []string {
+	return []string{model, converter.ResolveModelName(model)}
+}
+
+// responseText 获取用于校验的响应文本，纯工具调用的响应不校验
+func responseText(resp *converter.OpenAIChatCompletion) (string, bool) {
+	if len(resp.Choices) == 0 {
+		return "", false
+	}
+	msg := resp.Choices[0].Message
+	if msg.Content == "" && len(msg.ToolCalls) > 0 {
+		return "", false
+	}
+	return msg.Content, true
+}
+
+// validateResponse 校验非流式响应，未通过时附加纠正提示重试一次
+// 重试后仍未通过则返回最后一次响应，并在 validation_failed 中列出未通过的校验器
+func validateResponse(ctx context.Context, req *converter.OpenAIChatRequest, token *store.Account, resp *converter.OpenAIChatCompletion) (*converter.OpenAIChatCompletion, *store.ValidationResult) {
+	models := validationModels(req.Model)
+	if !validate.Enabled(models...) {
+		return resp, nil
+	}
+	text, ok := responseText(resp)
+	if !ok {
+		return resp, nil
+	}
+
+	failed := validate.Check(text, models...)
+	if len(failed) == 0 {
+		return resp, &store.ValidationResult{}
+	}
+
+	logger.Warn("Response failed validators %v, retrying with corrective note", failed)
+
+	retryReq := *req
+	retryReq.Messages = append(append([]converter.OpenAIMessage(nil), req.Messages...),
+		converter.OpenAIMessage{Role: "assistant", Content: text},
+		converter.OpenAIMessage{Role: "system", Content: validate.CorrectiveNote(failed)},
+	)
+
+	retryAntigravityReq := converter.ConvertOpenAIToAntigravity(&retryReq, token)
+	retryResp, err := api.GenerateContent(ctx, retryAntigravityReq, token)
+	if err != nil {
+		logger.Warn("Validation retry failed: %v", err)
+		validate.RecordRetry(false)
+		resp.ValidationFailed = failed
+		return resp, &store.ValidationResult{Failed: failed, Retried: true}
+	}
+
+	retried := converter.ConvertToOpenAIResponse(retryResp, req.Model, retryAntigravityReq.Request.Tools)
+	retried.PostProcessed += resp.PostProcessed
+	if text, ok = responseText(retried); ok {
+		failed = validate.Check(text, models...)
+	} else {
+		failed = nil
+	}
+	validate.RecordRetry(len(failed) == 0)
+
+	retried.ValidationFailed = failed
+	return retried, &store.ValidationResult{Failed: failed, Retried: true}
+}
+
+// validateStreamContent 流式响应只能事后校验，结果标记在结束 chunk 中
+func validateStreamContent(sw *api.StreamWriter, model, content string) *store.ValidationResult {
+	models := validationModels(model)
+	if !validate.Enabled(models...) || content == "" {
+		return nil
+	}
+	failed := validate.Check(content, models...)
+	sw.SetValidationFailed(failed)
+	return &store.ValidationResult{Failed: failed}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// accountHealth 账号列表中账号的健康分
+func accountHealth(t *testing.T, url, id string) store.AccountHealth {
+	t.Helper()
+	status, body := adminRequest(t, url, http.MethodGet, "/auth/accounts", "")
+	if status != http.StatusOK {
+		t.Fatalf("GET /auth/accounts: %d %s", status, body)
+	}
+	var resp struct {
+		Accounts []struct {
+			ID     string              `json:"id"`
+			Health store.AccountHealth `json:"health"`
+		} `json:"accounts"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range resp.Accounts {
+		if a.ID == id {
+			return a.Health
+		}
+	}
+	t.Fatalf("account %s not listed", id)
+	return store.AccountHealth{}
+}
+
+func TestAccountsListHealth(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("health-empty"))
+	testutil.StartUpstream(t, testutil.Reply("STOP"))
+	srv := newTestServer(t)
+
+	if h := accountHealth(t, srv.URL, "health-empty"); h.Score != store.NeutralHealthScore || h.Samples != 0 {
+		t.Fatalf("health before requests = %+v", h)
+	}
+
+	// 上游成功返回但没有内容：流式和非流式都记为空响应
+	postStream(t, srv.URL, "/v1/chat/completions", streamRequestBody)
+	first := logEntryFor(t, "health-empty@example.com")
+	if resp, body := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, body)
+	}
+	second := nextLogEntry(t, "health-empty@example.com", first.ID)
+	if !first.Success || !first.Empty || !second.Success || !second.Empty {
+		t.Fatalf("log entries = %+v, %+v", first, second)
+	}
+
+	h := accountHealth(t, srv.URL, "health-empty")
+	if h.Samples < 1.9 || h.SuccessRate != 1 || h.EmptyRate != 1 || h.LastAt == nil {
+		t.Fatalf("health after empty responses = %+v", h)
+	}
+}
+
+func TestNonEmptyResponseNotMarkedEmpty(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("health-content"))
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("Hello")))
+	srv := newTestServer(t)
+
+	postStream(t, srv.URL, "/v1/chat/completions", streamRequestBody)
+	if entry := logEntryFor(t, "health-content@example.com"); !entry.Success || entry.Empty {
+		t.Fatalf("log entry = %+v", entry)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/testutil"
+)
+
+// useHeartbeat 在测试期间设置流式心跳的间隔和格式
+func useHeartbeat(t *testing.T, interval int, style string) {
+	t.Helper()
+	cfg := config.Get()
+	previous, previousStyle := cfg.StreamHeartbeatInterval, cfg.StreamHeartbeatStyle
+	cfg.StreamHeartbeatInterval, cfg.StreamHeartbeatStyle = interval, style
+	t.Cleanup(func() { cfg.StreamHeartbeatInterval, cfg.StreamHeartbeatStyle = previous, previousStyle })
+}
+
+// thinkingUpstream 立即返回响应头，delay 后才输出数据块（模拟思考时间较长的模型）
+func thinkingUpstream(delay time.Duration, chunks ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(delay):
+			for _, c := range chunks {
+				w.Write([]byte("data: " + c + "\n\n"))
+			}
+		case <-r.Context().Done():
+		}
+	}
+}
+
+func TestStreamHeartbeatBeforeFirstChunk(t *testing.T) {
+	for _, style := range []string{api.HeartbeatStyleChunk, api.HeartbeatStyleComment} {
+		t.Run(style, func(t *testing.T) {
+			useHeartbeat(t, 1, style)
+			testutil.UseAccounts(t, testutil.Account("heartbeat"))
+			testutil.StartUpstream(t, thinkingUpstream(1500*time.Millisecond,
+				testutil.Chunk("", testutil.Text("Hello")),
+				testutil.Chunk("STOP"),
+			))
+			srv := newTestServer(t)
+
+			resp, err := http.DefaultClient.Do(streamRequest(t, srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var lines []string
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				if line := scanner.Text(); line != "" {
+					lines = append(lines, line)
+				}
+			}
+
+			heartbeat := func(line string) bool {
+				if style == api.HeartbeatStyleComment {
+					return line == ": keepalive"
+				}
+				return strings.Contains(line, `"delta":{},"finish_reason":null`)
+			}
+			first := -1
+			for i, line := range lines {
+				if strings.Contains(line, "Hello") {
+					first = i
+					break
+				}
+			}
+			if first < 0 {
+				t.Fatalf("content missing:\n%s", strings.Join(lines, "\n"))
+			}
+			beats := 0
+			for i, line := range lines {
+				if heartbeat(line) {
+					if i > first {
+						t.Errorf("heartbeat after the first chunk:\n%s", strings.Join(lines, "\n"))
+					}
+					beats++
+				}
+			}
+			if beats == 0 {
+				t.Errorf("no heartbeat before the first chunk:\n%s", strings.Join(lines, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/testutil"
+)
+
+// errorWriters 写出客户端可见错误消息的函数及消息参数的位置
+var errorWriters = map[string]int{
+	"WriteError":       2,
+	"WriteParamError":  2,
+	"writeRouteError":  3,
+	"WriteStreamError": 2,
+}
+
+// rawMessage 表达式是否为直接写在代码中的文本（字面量、字面量拼接或以字面量为格式的 Sprintf/Errorf/errors.New）
+func rawMessage(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return e.Kind == token.STRING
+	case *ast.BinaryExpr:
+		return rawMessage(e.X) || rawMessage(e.Y)
+	case *ast.CallExpr:
+		if sel, ok := e.Fun.(*ast.SelectorExpr); ok && len(e.Args) > 0 {
+			switch sel.Sel.Name {
+			case "Sprintf", "Errorf", "New":
+				return rawMessage(e.Args[0])
+			case "Error":
+				// errors.New("...").Error()
+				if call, ok := sel.X.(*ast.CallExpr); ok {
+					return rawMessage(call)
+				}
+			}
+		}
+	case *ast.SelectorExpr:
+		if call, ok := e.X.(*ast.CallExpr); ok {
+			return rawMessage(call)
+		}
+	}
+	return false
+}
+
+// TestNoRawResponseMessages 客户端可见的错误消息必须来自消息目录（handlers.Message），防止新增未翻译的文本
+func TestNoRawResponseMessages(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlerFiles, _ := filepath.Glob(filepath.Join("handlers", "*.go"))
+	files = append(files, handlerFiles...)
+
+	fset := token.NewFileSet()
+	checked := 0
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checked++
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.CallExpr:
+				name := ""
+				switch fn := node.Fun.(type) {
+				case *ast.Ident:
+					name = fn.Name
+				case *ast.SelectorExpr:
+					name = fn.Sel.Name
+				}
+				if i, ok := errorWriters[name]; ok && i < len(node.Args) && rawMessage(node.Args[i]) {
+					t.Errorf("%s: %s with a literal message, add it to the i18n catalogs", fset.Position(node.Pos()), name)
+				}
+			case *ast.KeyValueExpr:
+				// JSON 响应中的 {"error": "..."}、{"message": "..."}
+				if key, ok := node.Key.(*ast.BasicLit); ok && key.Kind == token.STRING {
+					if k, _ := strconv.Unquote(key.Value); (k == "error" || k == "message") && rawMessage(node.Value) {
+						t.Errorf("%s: literal %q in a response, add it to the i18n catalogs", fset.Position(node.Pos()), k)
+					}
+				}
+			}
+			return true
+		})
+	}
+	if checked < 10 {
+		t.Fatalf("only %d files checked", checked)
+	}
+}
+
+func TestErrorMessagesFollowAcceptLanguage(t *testing.T) {
+	testutil.UseAccounts(t)
+	srv := newTestServer(t)
+
+	tests := []struct {
+		language string
+		want     string
+	}{
+		{"", "No account is available to serve this request"},
+		{"en-US", "No account is available to serve this request"},
+		{"zh-CN,zh;q=0.9", "没有可用的账号处理此请求"},
+		{"fr, zh;q=0.5", "没有可用的账号处理此请求"},
+	}
+	for _, tt := range tests {
+		headers := map[string]string{}
+		if tt.language != "" {
+			headers["Accept-Language"] = tt.language
+		}
+		resp, raw := postChatJSON(t, srv.URL, keyLimitChat, headers)
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("%q: status %d %s", tt.language, resp.StatusCode, raw)
+		}
+		if e := decodeChatError(t, raw); e.Message != tt.want {
+			t.Errorf("%q: message = %q, want %q", tt.language, e.Message, tt.want)
+		}
+		if !strings.Contains(resp.Header.Get("Vary"), "Accept-Language") {
+			t.Errorf("%q: Vary = %q", tt.language, resp.Header.Get("Vary"))
+		}
+	}
+
+	// 未指定语言时使用 DEFAULT_LOCALE
+	cfg := config.Get()
+	previous := cfg.DefaultLocale
+	cfg.DefaultLocale = "zh"
+	t.Cleanup(func() { cfg.DefaultLocale = previous })
+	if _, raw := postChatJSON(t, srv.URL, keyLimitChat, nil); decodeChatError(t, raw).Message != "没有可用的账号处理此请求" {
+		t.Errorf("default locale zh: %s", raw)
+	}
+	if _, raw := postChatJSON(t, srv.URL, keyLimitChat, map[string]string{"Accept-Language": "en"}); decodeChatError(t, raw).Message != "No account is available to serve this request" {
+		t.Errorf("explicit en with default zh: %s", raw)
+	}
+}
+
+func TestAdminUnauthorizedLocalized(t *testing.T) {
+	srv := newTestServer(t)
+	for language, want := range map[string]string{"en": "Unauthorized", "zh": "未登录或登录已过期"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/auth/accounts", nil)
+		req.Header.Set("Accept-Language", language)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Error string `json:"error"`
+		}
+		decodeErr := json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || decodeErr != nil || body.Error != want {
+			t.Errorf("%s: %d %+v %v", language, resp.StatusCode, body, decodeErr)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/testutil"
+)
+
+// imageChat 带一张 data URL 图片的请求
+func imageChat(t *testing.T, mime, fixture string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "converter", "testdata", "images", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data)
+	return `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"` + url + `"}}]}]}`
+}
+
+func TestUnsupportedImageRejectedBeforeUpstream(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("image-check"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+
+	resp, raw := postChatJSON(t, srv.URL, imageChat(t, "image/png", "header.tiff"), nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status %d %s", resp.StatusCode, raw)
+	}
+	if e := decodeChatError(t, raw); e.Type != "invalid_request_error" || e.Code != converter.IssueUnsupportedImage ||
+		e.Param != "messages[0].content[1].image_url.url" || !strings.Contains(e.Message, "image/tiff") {
+		t.Fatalf("error = %+v", e)
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Fatalf("upstream received %d requests", n)
+	}
+}
+
+func TestMislabeledImageForwardedWithSniffedType(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("image-mislabel"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("a gradient")))
+	srv := newTestServer(t)
+
+	if resp, raw := postChatJSON(t, srv.URL, imageChat(t, "image/jpeg", "small.png"), nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d %s", resp.StatusCode, raw)
+	}
+	reqs := upstream.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("upstream received %d requests", len(reqs))
+	}
+	body := string(reqs[0].Body)
+	if !strings.Contains(body, `"mimeType":"image/png"`) || strings.Contains(body, "image/jpeg") {
+		t.Fatalf("upstream body: %.300s", body)
+	}
+}
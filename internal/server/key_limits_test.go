@@ -0,0 +1,212 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// testKeyID 测试 API Key 在用量台账中的 Key（哈希前缀）
+func testKeyID() string {
+	sum := sha256.Sum256([]byte(testAPIKey))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// useKeyLimits 通过管理接口设置测试 API Key 的阈值，测试结束时删除
+func useKeyLimits(t *testing.T, url, limits string) {
+	t.Helper()
+	status, body := adminRequest(t, url, http.MethodPut, "/admin/keys/"+testKeyID()+"/limits", limits)
+	if status != http.StatusOK {
+		t.Fatalf("PUT limits: %d %s", status, body)
+	}
+	t.Cleanup(func() { store.GetKeyLimitStore().Delete(testKeyID()) })
+}
+
+// keyLimitAudits 最近的阈值审计记录（新的在前）
+func keyLimitAudits(since time.Time) []store.AuditEntry {
+	var entries []store.AuditEntry
+	for _, e := range store.GetAuditLog().Recent(0) {
+		if e.Event == store.AuditKeyLimitExceeded && !e.Time.Before(since) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// recordKeyUsage 在用量台账中记录测试 API Key 在 at 时的 Token 用量
+func recordKeyUsage(at time.Time, tokens int) {
+	store.GetUsageLedger().Record(&store.LogEntry{
+		KeyID:        testKeyID(),
+		Model:        "key-limit-test",
+		Email:        "key-limits@example.com",
+		Timestamp:    at,
+		Success:      true,
+		PromptTokens: tokens,
+	})
+}
+
+const keyLimitChat = `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`
+
+func TestKeyLimitWarnAllowsRequest(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("key-warn"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+	useKeyLimits(t, srv.URL, `{"maxPromptTokens":{"limit":1,"action":"warn"}}`)
+
+	start := time.Now()
+	body := `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"` + strings.Repeat("hello ", 50) + `"}]}`
+	if resp, raw := postChatJSON(t, srv.URL, body, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, raw)
+	}
+	if n := len(upstream.Requests()); n != 1 {
+		t.Fatalf("upstream received %d requests", n)
+	}
+	audits := keyLimitAudits(start)
+	if len(audits) != 1 || audits[0].Principal != "key:"+testKeyID() || !strings.HasPrefix(audits[0].Detail, "maxPromptTokens ") ||
+		!strings.HasSuffix(audits[0].Detail, "> 1 (warn)") || audits[0].Path != "/v1/chat/completions" {
+		t.Fatalf("audit entries = %+v", audits)
+	}
+}
+
+func TestKeyLimitBlockRejectsRequest(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("key-block"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+	// 提示不超过告警阈值，提示加输出预算超过拦截阈值
+	useKeyLimits(t, srv.URL, `{"maxPromptTokens":{"limit":1000},"maxRequestTokens":{"limit":2000,"action":"block"}}`)
+
+	start := time.Now()
+	resp, body := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","max_tokens":5000,"messages":[{"role":"user","content":"hi"}]}`, nil)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status = %d %s", resp.StatusCode, body)
+	}
+	if e := decodeChatError(t, body); e.Code != "budget_exceeded" || e.Param != "maxRequestTokens" {
+		t.Fatalf("error = %+v", e)
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Fatalf("upstream received %d requests", n)
+	}
+	if audits := keyLimitAudits(start); len(audits) != 1 || !strings.HasSuffix(audits[0].Detail, "> 2000 (block)") {
+		t.Fatalf("audit entries = %+v", audits)
+	}
+
+	// 输出预算较小时放行
+	if resp, body := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("small request status = %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestKeyLimitDailyBudgetWindow(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("key-daily"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+
+	now := time.Now()
+	today := now.Format("2006-01-02")
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	used := store.GetUsageLedger().KeyTokens(testKeyID(), today)
+	limit := used + 500
+	useKeyLimits(t, srv.URL, `{"dailyTokens":{"limit":`+strconv.Itoa(limit)+`,"action":"block"}}`)
+
+	// 前一天的用量不计入当天预算
+	recordKeyUsage(midnight.Add(-time.Second), 1_000_000)
+	if resp, body := postChatJSON(t, srv.URL, keyLimitChat, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status with yesterday's usage = %d %s", resp.StatusCode, body)
+	}
+
+	recordKeyUsage(now, 1000)
+	resp, body := postChatJSON(t, srv.URL, keyLimitChat, nil)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status over budget = %d %s", resp.StatusCode, body)
+	}
+	if e := decodeChatError(t, body); e.Code != "budget_exceeded" || e.Param != "dailyTokens" {
+		t.Fatalf("error = %+v", e)
+	}
+	// 到本地时区零点后重置
+	retry, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if untilMidnight := int(midnight.Add(24 * time.Hour).Sub(now).Seconds()); err != nil || retry < 1 || retry > untilMidnight+2 {
+		t.Fatalf("Retry-After = %q, until midnight %ds", resp.Header.Get("Retry-After"), untilMidnight)
+	}
+	if n := len(upstream.Requests()); n != 1 {
+		t.Fatalf("upstream received %d requests", n)
+	}
+
+	// 用量接口显示当天的预算使用情况
+	status, raw := adminRequest(t, srv.URL, http.MethodGet, "/admin/usage/keys", "")
+	if status != http.StatusOK {
+		t.Fatalf("GET /admin/usage/keys: %d %s", status, raw)
+	}
+	var usage struct {
+		Date string `json:"date"`
+		Keys []struct {
+			Key      string           `json:"key"`
+			Limits   *store.KeyLimits `json:"limits"`
+			Standing []struct {
+				Name      string `json:"name"`
+				Limit     int    `json:"limit"`
+				Value     int    `json:"value"`
+				Exceeded  bool   `json:"exceeded"`
+				Remaining int    `json:"remaining"`
+			} `json:"standing"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &usage); err != nil {
+		t.Fatal(err)
+	}
+	if usage.Date != today {
+		t.Fatalf("date = %q", usage.Date)
+	}
+	found := false
+	for _, k := range usage.Keys {
+		if k.Key != testKeyID() {
+			continue
+		}
+		found = true
+		if k.Limits == nil || len(k.Standing) != 1 {
+			t.Fatalf("key usage = %+v", k)
+		}
+		s := k.Standing[0]
+		if s.Name != "dailyTokens" || s.Limit != limit || s.Value < used+1000 || !s.Exceeded || s.Remaining != 0 {
+			t.Fatalf("standing = %+v", s)
+		}
+	}
+	if !found {
+		t.Fatalf("key %s not listed: %s", testKeyID(), raw)
+	}
+
+	// 前一天的用量按日期查询
+	status, raw = adminRequest(t, srv.URL, http.MethodGet, "/admin/usage/keys?date="+midnight.Add(-time.Second).Format("2006-01-02"), "")
+	if status != http.StatusOK || !strings.Contains(string(raw), `"exceeded":true`) {
+		t.Fatalf("yesterday's usage: %d %s", status, raw)
+	}
+	if status, raw := adminRequest(t, srv.URL, http.MethodGet, "/admin/usage/keys?date=yesterday", ""); status != http.StatusBadRequest {
+		t.Fatalf("invalid date: %d %s", status, raw)
+	}
+}
+
+func TestKeyLimitsValidation(t *testing.T) {
+	srv := newTestServer(t)
+	for _, body := range []string{
+		`{"dailyTokens":{"limit":0}}`,
+		`{"maxPromptTokens":{"limit":10,"action":"drop"}}`,
+		`{"maxPromptTokens":`,
+	} {
+		if status, raw := adminRequest(t, srv.URL, http.MethodPut, "/admin/keys/validation-key/limits", body); status != http.StatusBadRequest {
+			t.Fatalf("%s: %d %s", body, status, raw)
+		}
+	}
+	if store.GetKeyLimitStore().Get("validation-key") != nil {
+		t.Fatal("invalid limits saved")
+	}
+	if status, _ := adminRequest(t, srv.URL, http.MethodDelete, "/admin/keys/validation-key/limits", ""); status != http.StatusNotFound {
+		t.Fatalf("delete missing limits: %d", status)
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/testutil"
+)
+
+// closeIdleConns 关闭测试客户端和上游客户端连接池中的空闲连接
+func closeIdleConns() {
+	http.DefaultClient.CloseIdleConnections()
+	api.GetClient().CloseIdleConnections()
+}
+
+// checkNoLeaks 执行 run 后没有遗留的协程（心跳 ticker、上游读取等）、打开的上游连接和进行中的请求。
+// 先执行一次初始化单例和连接池，之后的协程快照只包含常驻协程
+func checkNoLeaks(t *testing.T, run func(t *testing.T)) {
+	t.Helper()
+	run(t)
+	closeIdleConns()
+	conns := monitor.UpstreamConns()
+	snapshot := testutil.SnapshotGoroutines()
+
+	for i := 0; i < 3; i++ {
+		run(t)
+	}
+
+	snapshot.CheckLeaks(t, closeIdleConns)
+	// 响应体未关闭的上游连接不会回到连接池，关闭空闲连接后仍计为打开
+	if n := monitor.UpstreamConns(); n > conns {
+		t.Fatalf("%d upstream connections still open, %d before", n, conns)
+	}
+	if active := monitor.Active(); len(active) != 0 {
+		t.Fatalf("requests still tracked as active: %+v", active)
+	}
+}
+
+// postStream 发出流式请求并读完响应
+func postStream(t *testing.T, url, path, body string) string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s: %d %s", path, resp.StatusCode, data)
+	}
+	return string(data)
+}
+
+func TestNoLeaksInHandlerPaths(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("leaks"))
+	reply := testutil.Reply("STOP", testutil.Text("Hello"), testutil.Text(" world"))
+	testutil.StartUpstream(t, reply)
+	srv := newTestServer(t)
+
+	t.Run("chat", func(t *testing.T) {
+		checkNoLeaks(t, func(t *testing.T) {
+			if resp, body := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`, nil); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d %s", resp.StatusCode, body)
+			}
+		})
+	})
+
+	t.Run("chat stream", func(t *testing.T) {
+		checkNoLeaks(t, func(t *testing.T) {
+			if out := postStream(t, srv.URL, "/v1/chat/completions", streamRequestBody); !strings.Contains(out, "[DONE]") {
+				t.Fatalf("stream = %q", out)
+			}
+		})
+	})
+
+	t.Run("bypass stream", func(t *testing.T) {
+		checkNoLeaks(t, func(t *testing.T) {
+			postStream(t, srv.URL, "/v1/chat/completions", `{"model":"gemini-3-flash-bypass","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+		})
+	})
+
+	t.Run("gemini stream", func(t *testing.T) {
+		checkNoLeaks(t, func(t *testing.T) {
+			postStream(t, srv.URL, "/v1beta/models/gemini-2.5-flash:streamGenerateContent?alt=sse", `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`)
+		})
+	})
+
+	t.Run("raw gemini stream", func(t *testing.T) {
+		checkNoLeaks(t, func(t *testing.T) {
+			postStream(t, srv.URL, "/gemini/v1beta/models/gemini-2.5-flash:streamGenerateContent?alt=sse", `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`)
+		})
+	})
+
+	t.Run("upstream error", func(t *testing.T) {
+		upstream := testutil.StartUpstream(t, upstreamError(t, http.StatusBadRequest, "invalid_json_payload.json"))
+		checkNoLeaks(t, func(t *testing.T) {
+			req := streamRequest(t, srv.URL)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		})
+		if len(upstream.Requests()) == 0 {
+			t.Fatal("upstream not called")
+		}
+	})
+}
+
+func TestNoLeaksWithHeartbeat(t *testing.T) {
+	useHeartbeat(t, 1, api.HeartbeatStyleComment)
+	testutil.UseAccounts(t, testutil.Account("leaks-heartbeat"))
+	testutil.StartUpstream(t, thinkingUpstream(1200*time.Millisecond,
+		testutil.Chunk("", testutil.Text("Hello")),
+		testutil.Chunk("STOP"),
+	))
+	srv := newTestServer(t)
+
+	// 心跳 ticker 在流结束后停止
+	checkNoLeaks(t, func(t *testing.T) {
+		if out := postStream(t, srv.URL, "/v1/chat/completions", streamRequestBody); !strings.Contains(out, ": ") || !strings.Contains(out, "Hello") {
+			t.Fatalf("stream = %q", out)
+		}
+	})
+}
+
+func TestNoLeaksOnClientDisconnect(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("leaks-disconnect"))
+	upstreamDone := make(chan struct{}, 8)
+	testutil.StartUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		defer func() { upstreamDone <- struct{}{} }()
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: "+testutil.Chunk("", testutil.Text("first"))+"\n\n")
+		w.(http.Flusher).Flush()
+		// 直到代理关闭上游响应体（连接断开）才结束
+		<-r.Context().Done()
+	})
+	srv := newTestServer(t)
+
+	checkNoLeaks(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		resp, err := http.DefaultClient.Do(streamRequest(t, srv.URL).WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() && !strings.Contains(scanner.Text(), "first") {
+		}
+		// 客户端在收到第一段后断开
+		cancel()
+		resp.Body.Close()
+
+		select {
+		case <-upstreamDone:
+		case <-time.After(3 * time.Second):
+			t.Fatal("upstream response body not closed after the client disconnected")
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// errorsResponse GET /admin/logs/errors 的响应
+type errorsResponse struct {
+	Classes []string          `json:"classes"`
+	Matrix  store.ErrorMatrix `json:"matrix"`
+}
+
+// upstreamError 以 status 返回 api 包记录的上游错误响应体
+func upstreamError(t *testing.T, status int, fixture string) http.HandlerFunc {
+	body, err := os.ReadFile("../api/testdata/errors/" + fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	}
+}
+
+func TestFailedRequestTaggedWithErrorClass(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("errclass-schema"))
+	testutil.StartUpstream(t, upstreamError(t, http.StatusBadRequest, "invalid_json_payload.json"))
+	srv := newTestServer(t)
+
+	resp, body := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d %s", resp.StatusCode, body)
+	}
+	entry := logEntryFor(t, "errclass-schema@example.com")
+	if entry.ErrorClass != api.ErrorClassSchema || entry.Endpoint != testutil.EndpointKey || entry.Model != "gemini-2.5-flash" {
+		t.Fatalf("log entry class = %q, endpoint = %q, model = %q", entry.ErrorClass, entry.Endpoint, entry.Model)
+	}
+
+	status, raw := adminRequest(t, srv.URL, http.MethodGet, "/admin/logs/errors?window=30", "")
+	if status != http.StatusOK {
+		t.Fatalf("GET /admin/logs/errors: %d %s", status, raw)
+	}
+	var errs errorsResponse
+	if err := json.Unmarshal(raw, &errs); err != nil {
+		t.Fatal(err)
+	}
+	if errs.Matrix.WindowMinutes != 30 || len(errs.Classes) != len(api.ErrorClasses) {
+		t.Fatalf("window = %d, classes = %v", errs.Matrix.WindowMinutes, errs.Classes)
+	}
+	found := false
+	for _, cell := range errs.Matrix.Cells {
+		if cell.Class == api.ErrorClassSchema && cell.Model == "gemini-2.5-flash" && cell.Endpoint == testutil.EndpointKey {
+			for _, account := range cell.Accounts {
+				found = found || account == "errclass-schema@example.com"
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("schema cell for the failing account missing: %+v", errs.Matrix.Cells)
+	}
+	if errs.Matrix.ByClass[api.ErrorClassSchema].Count == 0 {
+		t.Errorf("byClass = %+v", errs.Matrix.ByClass)
+	}
+}
+
+func TestSuccessfulRequestNotClassified(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("errclass-ok"))
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("Hello")))
+	srv := newTestServer(t)
+
+	if resp, body := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, body)
+	}
+	// 成功的请求记录端点，没有错误分类
+	entry := logEntryFor(t, "errclass-ok@example.com")
+	if entry.ErrorClass != "" || entry.Endpoint != testutil.EndpointKey {
+		t.Fatalf("log entry class = %q, endpoint = %q", entry.ErrorClass, entry.Endpoint)
+	}
+}
+
+func TestLogsErrorsWindowValidation(t *testing.T) {
+	srv := newTestServer(t)
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"", http.StatusOK}, // 默认 60 分钟
+		{"?window=1", http.StatusOK},
+		{"?window=10080", http.StatusOK},
+		{"?window=0", http.StatusBadRequest},
+		{"?window=10081", http.StatusBadRequest},
+		{"?window=-5", http.StatusBadRequest},
+		{"?window=1h", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		status, body := adminRequest(t, srv.URL, http.MethodGet, "/admin/logs/errors"+tt.query, "")
+		if status != tt.status {
+			t.Errorf("GET /admin/logs/errors%s = %d %s, want %d", tt.query, status, body, tt.status)
+		}
+	}
+	_, body := adminRequest(t, srv.URL, http.MethodGet, "/admin/logs/errors", "")
+	var errs errorsResponse
+	if err := json.Unmarshal(body, &errs); err != nil || errs.Matrix.WindowMinutes != 60 {
+		t.Fatalf("default window = %d (%v)", errs.Matrix.WindowMinutes, err)
+	}
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"anti2api-golang/internal/testutil"
+)
+
+// testAPIKey 测试服务器接受的 API Key
+const testAPIKey = "sk-test"
+
+func TestMain(m *testing.M) {
+	os.Setenv("API_KEY", testAPIKey)
+	os.Setenv("PANEL_PASSWORD", "test-password")
+	os.Setenv("CHAOS_ENABLED", "true")
+	// 上游错误不在同一账号上重试，直接交给账号切换
+	os.Setenv("RETRY_MAX_ATTEMPTS", "1")
+	testutil.Main(m)
+}
+
+// newTestServer 以完整的中间件和路由启动服务器（不启动后台组件）
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(New().httpServer.Handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
@@ -1,14 +1,23 @@
 package server
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"anti2api-golang/internal/api"
 	"anti2api-golang/internal/auth"
 	"anti2api-golang/internal/config"
 	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/server/handlers"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/tracing"
+	"anti2api-golang/internal/utils"
 )
 
 // responseWriter 包装器用于捕获状态码（同时支持 Flusher 接口）
@@ -29,6 +38,93 @@ func (rw *responseWriter) Flush() {
 	}
 }
 
+// Unwrap 返回底层 ResponseWriter（供 http.ResponseController 与 api.CanFlush 判断真实能力）
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// rateLimitWriter 在写入响应头时附加账号池限额头（此时上游响应已记录，限额是最新的）
+type rateLimitWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	wroteHeader bool
+}
+
+func (rw *rateLimitWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.wroteHeader = true
+		api.SetRateLimitHeaders(rw.Header(), store.PoolRateLimitFor(rw.r.Context()), code)
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *rateLimitWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush 实现 http.Flusher 接口，支持流式响应
+func (rw *rateLimitWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 返回底层 ResponseWriter
+func (rw *rateLimitWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// RateLimitHeaders 为 API 响应附加按账号池汇总的 x-ratelimit-* 头，所有 429 响应带 Retry-After
+func RateLimitHeaders(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(&rateLimitWriter{ResponseWriter: w, r: r}, r)
+	}
+}
+
+// TraceRequests 为 API 请求创建根 span（按路由模式命名，不记录路径中的凭证等参数）；未开启追踪时不包装
+func TraceRequests(mux *http.ServeMux) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if !tracing.Enabled() {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, route := mux.Handler(r)
+			ctx, span := tracing.StartRequest(r.Context(), route, r.Header)
+			if span == nil {
+				next(w, r)
+				return
+			}
+			defer span.End()
+
+			span.SetAttr("http.request.method", r.Method)
+			span.SetAttr("http.route", route)
+			span.SetAttr("client.address", utils.ClientIP(r))
+			wrapper := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next(wrapper, r.WithContext(ctx))
+
+			span.SetAttr("http.response.status_code", wrapper.statusCode)
+			if wrapper.statusCode >= http.StatusInternalServerError {
+				span.SetError(fmt.Errorf("HTTP %d", wrapper.statusCode))
+			}
+		}
+	}
+}
+
+// RealIP 解析真实客户端 IP 并写入 context（仅信任 TRUSTED_PROXIES 中代理转发的头）
+func RealIP(next http.Handler) http.Handler {
+	trusted := utils.ParseTrustedProxies(config.Get().TrustedProxies)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := utils.ResolveClientIP(r.RemoteAddr, r.Header, trusted)
+		next.ServeHTTP(w, r.WithContext(utils.WithClientIP(r.Context(), ip)))
+	})
+}
+
 // RequestLogger 请求日志中间件
 func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -50,38 +146,32 @@ func RequestLogger(next http.Handler) http.Handler {
 }
 
 // RequireAPIKey API Key 验证中间件
+// 配置了租户时，租户的 API Key 会把请求限定在该租户内（写入 context，由 store 层过滤）
 func RequireAPIKey(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		cfg := config.Get()
 		apiKey := cfg.APIKey
+		tenants := store.GetTenantStore()
 
-		// 如果没有配置 API Key，跳过验证
-		if apiKey == "" {
-			next(w, r)
+		providedKey := handlers.ExtractAPIKey(r)
+
+		if tenant := tenants.ByAPIKey(providedKey); tenant != nil {
+			next(w, r.WithContext(store.WithTenant(r.Context(), tenant.Name)))
 			return
 		}
 
-		var providedKey string
-
-		// 1. Authorization header: Bearer sk-xxx 或直接 sk-xxx
-		if authHeader := r.Header.Get("Authorization"); authHeader != "" {
-			providedKey = strings.TrimPrefix(authHeader, "Bearer ")
-		}
-		// 2. x-goog-api-key header (Gemini 标准)
-		if providedKey == "" {
-			providedKey = r.Header.Get("x-goog-api-key")
-		}
-		// 3. Query 参数 ?key=
-		if providedKey == "" {
-			providedKey = r.URL.Query().Get("key")
+		// 如果没有配置 API Key 且没有配置租户，跳过验证
+		if apiKey == "" && !tenants.Enabled() {
+			next(w, r)
+			return
 		}
 
-		if providedKey != apiKey {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]interface{}{
+		// 只检查请求头和 URL，在读取请求体之前拒绝
+		if apiKey == "" || providedKey != apiKey {
+			handlers.CloseUnreadBody(w, r)
+			handlers.WriteJSON(handlers.NegotiatedWriter(w, r), http.StatusUnauthorized, map[string]interface{}{
 				"error": map[string]interface{}{
-					"message": "Invalid API Key",
+					"message": handlers.Message(w, "auth.invalid_api_key"),
 					"type":    "invalid_request_error",
 				},
 			})
@@ -92,6 +182,64 @@ func RequireAPIKey(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// RequirePublicStatus 公开状态页开关和访问令牌检查（未开启时返回 404，不暴露接口存在）
+func RequirePublicStatus(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get()
+		if !cfg.PublicStatus {
+			http.NotFound(w, r)
+			return
+		}
+		if cfg.PublicStatusToken != "" {
+			token := r.URL.Query().Get("token")
+			if token == "" {
+				token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.PublicStatusToken)) != 1 {
+				handlers.WriteError(w, http.StatusUnauthorized, handlers.Message(w, "auth.invalid_status_token"))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// LimitByIP 按客户端 IP 限制每分钟请求数（固定窗口，perMinute 为 0 时不限制）
+func LimitByIP(perMinute int) Middleware {
+	var (
+		mu        sync.Mutex
+		counts    = make(map[string]int)
+		windowEnd time.Time
+	)
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if perMinute <= 0 {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+			ip := utils.ClientIP(r)
+
+			mu.Lock()
+			if !now.Before(windowEnd) {
+				// 新窗口：清空计数，内存占用不超过一个窗口内的 IP 数
+				counts = make(map[string]int)
+				windowEnd = now.Add(time.Minute)
+			}
+			counts[ip]++
+			exceeded := counts[ip] > perMinute
+			retryAfter := int(windowEnd.Sub(now).Seconds()) + 1
+			mu.Unlock()
+
+			if exceeded {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				handlers.WriteError(w, http.StatusTooManyRequests, handlers.Message(w, "request.rate_limited"))
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
 // RequirePanelAuth 管理面板认证中间件
 func RequirePanelAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -101,16 +249,47 @@ func RequirePanelAuth(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		if !auth.ValidateSession(token) {
+		var principal store.Principal
+		tenant, user, role, ok := auth.SessionIdentity(token)
+		if ok {
+			principal = store.Principal{Name: user, Role: role}
+		} else if t := store.GetPanelAccessStore().ByToken(token); t != nil {
+			// 管理 API 令牌不属于任何租户
+			principal = store.Principal{Name: "token:" + t.Name, Role: t.Role}
+		} else {
 			handleUnauthorized(w, r)
 			return
 		}
 
+		ctx := store.WithPrincipal(r.Context(), principal)
+		// 租户管理员的请求限定在本租户内
+		if tenant != "" {
+			ctx = store.WithTenant(ctx, tenant)
+		}
+
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// RequireSuperAdmin 仅允许超级管理员（需在 RequirePanelAuth 之后）
+func RequireSuperAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, scoped := store.TenantFromContext(r.Context()); scoped {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": handlers.Message(w, "auth.super_admin_required"),
+			})
+			return
+		}
+
 		next(w, r)
 	}
 }
 
 func handleUnauthorized(w http.ResponseWriter, r *http.Request) {
+	handlers.CloseUnreadBody(w, r)
+
 	// API 请求返回 JSON
 	if strings.HasPrefix(r.URL.Path, "/auth/") ||
 		strings.HasPrefix(r.URL.Path, "/admin/api/") ||
@@ -118,7 +297,7 @@ func handleUnauthorized(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Unauthorized",
+			"error": handlers.Message(w, "auth.unauthorized"),
 		})
 		return
 	}
@@ -131,8 +310,8 @@ func handleUnauthorized(w http.ResponseWriter, r *http.Request) {
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Session-Token, x-goog-api-key")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Session-Token, x-goog-api-key, X-Antigravity-Endpoint, X-Stream-Coalesce-Ms, X-Defer-On-Exhaustion, X-Defer-Callback-URL")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"anti2api-golang/internal/converter"
+)
+
+// sdkGeminiModel Gemini SDK 的 Model（v1beta REST 资源中本服务会返回的字段）
+type sdkGeminiModel struct {
+	Name                       string   `json:"name"`
+	BaseModelID                string   `json:"baseModelId"`
+	Version                    string   `json:"version"`
+	DisplayName                string   `json:"displayName"`
+	Description                string   `json:"description"`
+	InputTokenLimit            int      `json:"inputTokenLimit"`
+	OutputTokenLimit           int      `json:"outputTokenLimit"`
+	SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+	Thinking                   bool     `json:"thinking"`
+	Temperature                *float64 `json:"temperature"`
+	MaxTemperature             *float64 `json:"maxTemperature"`
+	TopP                       *float64 `json:"topP"`
+	TopK                       *int     `json:"topK"`
+}
+
+// sdkGeminiModels Gemini SDK 的 ListModelsResponse
+type sdkGeminiModels struct {
+	Models        []sdkGeminiModel `json:"models"`
+	NextPageToken string           `json:"nextPageToken"`
+}
+
+// sdkAnthropicModel Anthropic SDK 的 ModelInfo
+type sdkAnthropicModel struct {
+	ID          string `json:"id"`
+	CreatedAt   string `json:"created_at"`
+	DisplayName string `json:"display_name"`
+	Type        string `json:"type"`
+}
+
+// sdkAnthropicModels Anthropic SDK 的模型列表分页
+type sdkAnthropicModels struct {
+	Data    []sdkAnthropicModel `json:"data"`
+	FirstID *string             `json:"first_id"`
+	HasMore bool                `json:"has_more"`
+	LastID  *string             `json:"last_id"`
+}
+
+// getModels 请求模型列表，状态码为 200 时按 SDK 结构严格解码（不允许未知字段）
+func getModels(t *testing.T, srv, path string, query url.Values, header map[string]string, out interface{}) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, srv+path+"?"+query.Encode(), nil)
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil {
+		t.Fatalf("decode %s %s: %v", path, data, err)
+	}
+	return resp.StatusCode
+}
+
+// modelIDs 注册表中全部模型的 ID（按列表顺序）
+func modelIDs() []string {
+	var ids []string
+	for _, m := range converter.ModelsWithLimits() {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+// checkModelWalk 翻页得到的模型与完整列表一致（没有重复或遗漏）
+func checkModelWalk(t *testing.T, got []string) {
+	t.Helper()
+	seen := make(map[string]bool)
+	for _, id := range got {
+		if seen[id] {
+			t.Errorf("model %s returned twice", id)
+		}
+		seen[id] = true
+	}
+	if want := modelIDs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("walked %v, want %v", got, want)
+	}
+}
+
+func TestGeminiModelsPagination(t *testing.T) {
+	srv := newTestServer(t)
+	const pageSize = 3
+	if len(modelIDs()) <= pageSize {
+		t.Fatalf("need more than %d models to paginate", pageSize)
+	}
+
+	var walked []string
+	token, pages := "", 0
+	for {
+		query := url.Values{"pageSize": {"3"}}
+		if token != "" {
+			query.Set("pageToken", token)
+		}
+		var page sdkGeminiModels
+		if status := getModels(t, srv.URL, "/v1beta/models", query, nil, &page); status != http.StatusOK {
+			t.Fatalf("page %d: status %d", pages, status)
+		}
+		if len(page.Models) == 0 || len(page.Models) > pageSize {
+			t.Fatalf("page %d has %d models", pages, len(page.Models))
+		}
+		for _, m := range page.Models {
+			if m.Name != "models/"+m.BaseModelID || m.DisplayName == "" {
+				t.Errorf("model = %+v", m)
+			}
+			walked = append(walked, m.BaseModelID)
+		}
+		pages++
+		if page.NextPageToken == "" {
+			break
+		}
+		token = page.NextPageToken
+	}
+	checkModelWalk(t, walked)
+
+	// 不指定 pageSize 时一页返回全部（默认页大小大于模型数量）
+	var all sdkGeminiModels
+	getModels(t, srv.URL, "/v1beta/models", nil, nil, &all)
+	if len(all.Models) != len(walked) || all.NextPageToken != "" {
+		t.Errorf("default page: %d models, next %q", len(all.Models), all.NextPageToken)
+	}
+
+	for _, query := range []url.Values{
+		{"pageToken": {"abc"}},
+		{"pageToken": {"-1"}},
+		{"pageToken": {"100000"}},
+		{"pageSize": {"x"}},
+		{"pageSize": {"-1"}},
+	} {
+		if status := getModels(t, srv.URL, "/v1beta/models", query, nil, nil); status != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query.Encode(), status)
+		}
+	}
+}
+
+func TestAnthropicModelsPagination(t *testing.T) {
+	srv := newTestServer(t)
+	anthropic := map[string]string{"anthropic-version": "2023-06-01"}
+	list := func(query url.Values) sdkAnthropicModels {
+		t.Helper()
+		var page sdkAnthropicModels
+		if status := getModels(t, srv.URL, "/v1/models", query, anthropic, &page); status != http.StatusOK {
+			t.Fatalf("%s: status %d", query.Encode(), status)
+		}
+		if len(page.Data) == 0 || *page.FirstID != page.Data[0].ID || *page.LastID != page.Data[len(page.Data)-1].ID {
+			t.Fatalf("%s: page = %+v", query.Encode(), page)
+		}
+		for _, m := range page.Data {
+			if m.Type != "model" || m.DisplayName == "" || m.CreatedAt == "" {
+				t.Errorf("model = %+v", m)
+			}
+		}
+		return page
+	}
+
+	// 向后翻页：after_id 为上一页的 last_id，直到 has_more 为 false
+	var forward []string
+	page := list(url.Values{"limit": {"3"}})
+	for {
+		for _, m := range page.Data {
+			forward = append(forward, m.ID)
+		}
+		if !page.HasMore {
+			break
+		}
+		page = list(url.Values{"limit": {"3"}, "after_id": {*page.LastID}})
+	}
+	checkModelWalk(t, forward)
+
+	// 从最后一个模型向前翻页：before_id 为上一页的 first_id
+	last := forward[len(forward)-1]
+	backward := []string{last}
+	page = list(url.Values{"limit": {"3"}, "before_id": {last}})
+	for {
+		ids := make([]string, 0, len(page.Data))
+		for _, m := range page.Data {
+			ids = append(ids, m.ID)
+		}
+		backward = append(ids, backward...)
+		if !page.HasMore {
+			break
+		}
+		page = list(url.Values{"limit": {"3"}, "before_id": {*page.FirstID}})
+	}
+	checkModelWalk(t, backward)
+
+	// 第一个模型之前没有模型
+	var empty sdkAnthropicModels
+	getModels(t, srv.URL, "/v1/models", url.Values{"before_id": {forward[0]}}, anthropic, &empty)
+	if len(empty.Data) != 0 || empty.HasMore || empty.FirstID != nil || empty.LastID != nil {
+		t.Errorf("before the first model: %+v", empty)
+	}
+
+	for _, query := range []url.Values{
+		{"after_id": {"no-such-model"}},
+		{"before_id": {"no-such-model"}},
+		{"after_id": {forward[0]}, "before_id": {last}},
+		{"limit": {"0"}},
+		{"limit": {"x"}},
+	} {
+		if status := getModels(t, srv.URL, "/v1/models", query, anthropic, nil); status != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query.Encode(), status)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/moderation"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// useModerationRules 写入审核规则文件并等待引擎加载（引擎最多每 5 秒检查一次文件），测试结束时删除
+func useModerationRules(t *testing.T, rules moderation.RuleFile) {
+	t.Helper()
+	path := filepath.Join(config.Get().DataDir, "moderation.json")
+	data, _ := json.Marshal(rules)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(path) })
+
+	deadline := time.Now().Add(10 * time.Second)
+	for moderation.Get().InlineMode() != rules.Inline {
+		if time.Now().After(deadline) {
+			t.Fatalf("moderation rules not loaded (inline %s)", moderation.Get().InlineMode())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestModerationTagLogsOnce(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("moderation-tag"))
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	useModerationRules(t, moderation.RuleFile{
+		Inline:     moderation.InlineTag,
+		Categories: map[string]moderation.CategoryRule{"probe": {Keywords: []string{"moderation-probe-word"}}},
+	})
+	srv := newTestServer(t)
+
+	start := time.Now()
+	resp, body := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"say moderation-probe-word"}]}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("X-Moderation-Flagged"); got != "probe" {
+		t.Errorf("X-Moderation-Flagged = %q, want probe", got)
+	}
+
+	// 标记模式下放行的请求只记录一条日志，命中的分类写入该条日志
+	entry := logEntryFor(t, "moderation-tag@example.com")
+	if !entry.Success || !reflect.DeepEqual(entry.Moderation, []string{"probe"}) {
+		t.Errorf("log entry success %v, moderation %v, want the categories on the request entry", entry.Success, entry.Moderation)
+	}
+	if logs, total := store.GetLogStore().List(context.Background(), 0, 10, store.LogFilter{From: start}); total != 1 {
+		t.Errorf("%d log entries for one tagged request: %+v", total, logs)
+	}
+}
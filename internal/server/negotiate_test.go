@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/testutil"
+)
+
+// postChat 以指定的 Key 和 Accept 发送非流式聊天请求，返回响应和响应体
+func postChat(t *testing.T, url, key, accept string) (*http.Response, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/v1/chat/completions", strings.NewReader(
+		`{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestNegotiatedCompletionMatchesJSON(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("negotiate"))
+	testutil.StartUpstream(t, testutil.Reply("STOP",
+		testutil.Thought("thinking"), testutil.Text("Hello"),
+		testutil.FunctionCall("call_1", "lookup", map[string]interface{}{"q": "go", "n": 3})))
+	srv := newTestServer(t)
+
+	decode := func(t *testing.T, accept string) converter.OpenAIChatCompletion {
+		resp, body := postChat(t, srv.URL, testAPIKey, accept)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Accept %q: status %d: %s", accept, resp.StatusCode, body)
+		}
+		var c converter.OpenAIChatCompletion
+		var err error
+		switch accept {
+		case "application/msgpack":
+			if ct := resp.Header.Get("Content-Type"); ct != "application/msgpack" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			err = testutil.UnmarshalMsgpack(body, &c)
+		case "application/x-ndjson":
+			if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if bytes.Count(body, []byte("\n")) != 1 || !bytes.HasSuffix(body, []byte("\n")) {
+				t.Errorf("NDJSON body is not one newline-terminated line: %q", body)
+			}
+			err = json.Unmarshal(body, &c)
+		default:
+			err = json.Unmarshal(body, &c)
+		}
+		if err != nil {
+			t.Fatalf("Accept %q: %v", accept, err)
+		}
+		// 每次请求不同的字段
+		c.ID, c.Created = "", 0
+		return c
+	}
+
+	want := decode(t, "")
+	if len(want.Choices) != 1 || want.Choices[0].Message.Content != "Hello" || len(want.Choices[0].Message.ToolCalls) != 1 {
+		t.Fatalf("unexpected JSON completion: %+v", want)
+	}
+	for _, accept := range []string{"application/msgpack", "application/x-ndjson"} {
+		if got := decode(t, accept); !reflect.DeepEqual(got, want) {
+			t.Errorf("Accept %s:\n got: %+v\nwant: %+v", accept, got, want)
+		}
+	}
+}
+
+func TestUnauthorizedUsesNegotiatedFormat(t *testing.T) {
+	srv := newTestServer(t)
+
+	type apiError struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"error"`
+	}
+
+	resp, body := postChat(t, srv.URL, "sk-wrong", "")
+	var want apiError
+	if err := json.Unmarshal(body, &want); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("JSON 401: status %d, %v: %s", resp.StatusCode, err, body)
+	}
+
+	for _, tc := range []struct {
+		accept, contentType string
+		decode              func([]byte, interface{}) error
+	}{
+		{"application/msgpack", "application/msgpack", testutil.UnmarshalMsgpack},
+		{"application/x-ndjson", "application/x-ndjson", json.Unmarshal},
+		{"application/json", "application/json", json.Unmarshal},
+	} {
+		resp, body := postChat(t, srv.URL, "sk-wrong", tc.accept)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Accept %s: status %d", tc.accept, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != tc.contentType {
+			t.Errorf("Accept %s: Content-Type = %q", tc.accept, ct)
+		}
+		if v := resp.Header.Get("Vary"); !strings.Contains(v, "Accept") {
+			t.Errorf("Accept %s: Vary = %q", tc.accept, v)
+		}
+		var got apiError
+		if err := tc.decode(body, &got); err != nil {
+			t.Fatalf("Accept %s: %v", tc.accept, err)
+		}
+		if got != want {
+			t.Errorf("Accept %s: error = %+v, want %+v", tc.accept, got, want)
+		}
+	}
+}
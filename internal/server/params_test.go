@@ -0,0 +1,210 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/testutil"
+)
+
+// unsupportedParamsRequest 带多个不支持参数的请求
+const unsupportedParamsRequest = `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}],` +
+	`"logit_bias":{"50256":-100},"audio":{"voice":"alloy"},"web_search_options":{},"user":"u-1"%s}`
+
+// postChatJSON 以 body 请求 /v1/chat/completions，header 中的键值追加到请求头
+func postChatJSON(t *testing.T, url, body string, header map[string]string) (*http.Response, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+// useUnsupportedParams 在测试期间设置 UNSUPPORTED_PARAMS
+func useUnsupportedParams(t *testing.T, mode string) {
+	t.Helper()
+	cfg := config.Get()
+	previous := cfg.UnsupportedParams
+	cfg.UnsupportedParams = mode
+	t.Cleanup(func() { cfg.UnsupportedParams = previous })
+}
+
+// completionWarnings 非流式响应中的 warnings 扩展字段
+func completionWarnings(t *testing.T, body []byte) []string {
+	t.Helper()
+	var completion struct {
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return completion.Warnings
+}
+
+func TestUnsupportedParamsModes(t *testing.T) {
+	dropped := []string{"audio", "logit_bias", "web_search_options"}
+
+	t.Run("drop", func(t *testing.T) {
+		testutil.UseAccounts(t, testutil.Account("params-drop"))
+		upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+		srv := newTestServer(t)
+
+		resp, body := postChatJSON(t, srv.URL, strings.Replace(unsupportedParamsRequest, "%s", "", 1),
+			map[string]string{"X-Unsupported-Params": "drop"})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d: %s", resp.StatusCode, body)
+		}
+		if h := resp.Header.Get("X-Dropped-Params"); h != "" {
+			t.Errorf("X-Dropped-Params = %q in drop mode", h)
+		}
+		if warnings := completionWarnings(t, body); len(warnings) != 0 {
+			t.Errorf("warnings = %q in drop mode", warnings)
+		}
+		// 不支持的参数不转发给上游
+		for _, param := range dropped {
+			if strings.Contains(string(upstream.Requests()[0].Body), param) {
+				t.Errorf("%s forwarded upstream", param)
+			}
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		testutil.UseAccounts(t, testutil.Account("params-error"))
+		upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+		srv := newTestServer(t)
+
+		resp, body := postChatJSON(t, srv.URL, strings.Replace(unsupportedParamsRequest, "%s", "", 1),
+			map[string]string{"X-Unsupported-Params": "error"})
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("status %d: %s", resp.StatusCode, body)
+		}
+		if !strings.Contains(string(body), "audio, logit_bias, web_search_options") {
+			t.Errorf("error does not list the parameters: %s", body)
+		}
+		if n := len(upstream.Requests()); n != 0 {
+			t.Errorf("%d upstream requests for a rejected request", n)
+		}
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		testutil.UseAccounts(t, testutil.Account("params-warn"))
+		testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+		srv := newTestServer(t)
+
+		resp, body := postChatJSON(t, srv.URL, strings.Replace(unsupportedParamsRequest, "%s", "", 1),
+			map[string]string{"X-Unsupported-Params": "warn"})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d: %s", resp.StatusCode, body)
+		}
+		if h := resp.Header.Get("X-Dropped-Params"); h != strings.Join(dropped, ",") {
+			t.Errorf("X-Dropped-Params = %q, want %q", h, strings.Join(dropped, ","))
+		}
+		warnings := strings.Join(completionWarnings(t, body), "\n")
+		for _, param := range dropped {
+			if !strings.Contains(warnings, "unsupported parameter dropped: "+param) {
+				t.Errorf("warnings %q do not mention %s", warnings, param)
+			}
+		}
+	})
+
+	t.Run("warn stream", func(t *testing.T) {
+		testutil.UseAccounts(t, testutil.Account("params-warn-stream"))
+		testutil.StartUpstream(t, testutil.StreamHandler(testutil.Chunk("STOP", testutil.Text("ok"))))
+		srv := newTestServer(t)
+
+		resp, body := postChatJSON(t, srv.URL, strings.Replace(unsupportedParamsRequest, "%s", `,"stream":true`, 1),
+			map[string]string{"X-Unsupported-Params": "warn"})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d: %s", resp.StatusCode, body)
+		}
+		if h := resp.Header.Get("X-Dropped-Params"); h != strings.Join(dropped, ",") {
+			t.Errorf("X-Dropped-Params = %q", h)
+		}
+		// 警告只出现在结束 chunk
+		if !strings.Contains(string(body), `"warnings":["unsupported parameter dropped: audio"`) {
+			t.Errorf("finish chunk has no warnings:\n%s", body)
+		}
+	})
+}
+
+func TestUnsupportedParamsConfigAndHeader(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("params-config"))
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+	body := strings.Replace(unsupportedParamsRequest, "%s", "", 1)
+
+	// 配置为 error 时不带请求头的请求被拒绝，请求头可以覆盖配置
+	useUnsupportedParams(t, "error")
+	if resp, data := postChatJSON(t, srv.URL, body, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("config error: status %d: %s", resp.StatusCode, data)
+	}
+	if resp, data := postChatJSON(t, srv.URL, body, map[string]string{"X-Unsupported-Params": "drop"}); resp.StatusCode != http.StatusOK {
+		t.Errorf("header drop over config error: status %d: %s", resp.StatusCode, data)
+	}
+
+	if resp, data := postChatJSON(t, srv.URL, body, map[string]string{"X-Unsupported-Params": "strict"}); resp.StatusCode != http.StatusBadRequest ||
+		!strings.Contains(string(data), "X-Unsupported-Params") {
+		t.Errorf("invalid header: status %d: %s", resp.StatusCode, data)
+	}
+
+	// 没有不支持参数的请求不受影响
+	if resp, data := postChat(t, srv.URL, testAPIKey, ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("plain request in error mode: status %d: %s", resp.StatusCode, data)
+	}
+}
+
+func TestExtraGenerationConfigForwarded(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("extra-gen-config"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+	cfg := config.Get()
+	prevAllow, prevDeny := cfg.ExtraGenConfigAllow, cfg.ExtraGenConfigDeny
+	cfg.ExtraGenConfigAllow, cfg.ExtraGenConfigDeny = []string{"seed", "temperature"}, []string{"candidateCount"}
+	t.Cleanup(func() { cfg.ExtraGenConfigAllow, cfg.ExtraGenConfigDeny = prevAllow, prevDeny })
+
+	const chat = `{"model":"gemini-2.5-flash","temperature":0.2,"messages":[{"role":"user","content":"hi"}],"extra_generation_config":%s}`
+	resp, body := postChatJSON(t, srv.URL, strings.Replace(chat, "%s", `{"seed":12345678901234567890,"temperature":0.9}`, 1), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	var sent struct {
+		Request struct {
+			GenerationConfig map[string]json.RawMessage `json:"generationConfig"`
+		} `json:"request"`
+	}
+	if err := json.Unmarshal(upstream.Requests()[0].Body, &sent); err != nil {
+		t.Fatal(err)
+	}
+	gen := sent.Request.GenerationConfig
+	if string(gen["seed"]) != "12345678901234567890" || string(gen["temperature"]) != "0.9" {
+		t.Errorf("upstream generationConfig = seed %s, temperature %s", gen["seed"], gen["temperature"])
+	}
+
+	// 不允许的字段（不在允许列表或在禁止列表中）返回 400，不发送到上游
+	for _, field := range []string{"candidateCount", "topK"} {
+		resp, body := postChatJSON(t, srv.URL, strings.Replace(chat, "%s", `{"`+field+`":2}`, 1), nil)
+		chatErr := decodeChatError(t, body)
+		if resp.StatusCode != http.StatusBadRequest || chatErr.Code != "invalid_param" || chatErr.Param != "extra_generation_config."+field {
+			t.Errorf("%s: status %d, error %+v", field, resp.StatusCode, chatErr)
+		}
+	}
+	if n := len(upstream.Requests()); n != 1 {
+		t.Errorf("upstream got %d requests, want only the allowed one", n)
+	}
+}
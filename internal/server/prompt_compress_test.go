@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// upstreamSystemText 上游收到的第 i 个请求中的系统提示
+func upstreamSystemText(t *testing.T, upstream *testutil.Upstream, i int) string {
+	t.Helper()
+	var body struct {
+		Request struct {
+			SystemInstruction struct {
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"systemInstruction"`
+		} `json:"request"`
+	}
+	requests := upstream.Requests()
+	if len(requests) <= i {
+		t.Fatalf("upstream received %d requests", len(requests))
+	}
+	if err := json.Unmarshal(requests[i].Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Request.SystemInstruction.Parts) == 0 {
+		return ""
+	}
+	return body.Request.SystemInstruction.Parts[0].Text
+}
+
+// nextLogEntry 等待 email 出现不同于 previous 的新日志
+func nextLogEntry(t *testing.T, email, previous string) store.LogEntry {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if entry := logEntryFor(t, email); entry.ID != previous {
+			return entry
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no new log entry for %s", email)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPromptCompressionEndToEnd(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("compress"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+
+	cfg := config.Get()
+	saved := *cfg
+	cfg.PromptCompression = true
+	cfg.PromptMinify = true
+	cfg.PromptReferenceTemplate = "[same instructions as before: {hash}]"
+	cfg.PromptReferenceTTL = 300
+	t.Cleanup(func() { *cfg = saved })
+	enabled := true
+	if err := converter.SetModelConfig("gemini-2.5-flash", converter.ModelConfig{ImplicitCache: &enabled}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { converter.DeleteModelConfig("gemini-2.5-flash") })
+
+	prompt := strings.Repeat("Follow the repository conventions.   \n\n\n", 100)
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":    "gemini-2.5-flash",
+		"messages": []map[string]string{{"role": "system", "content": prompt}, {"role": "user", "content": "hi"}},
+	})
+
+	// 首次请求：发送去除空白后的完整提示
+	if resp, raw := postChatJSON(t, srv.URL, string(body), nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, raw)
+	}
+	if got := upstreamSystemText(t, upstream, 0); got != converter.MinifyPrompt(prompt) || got == prompt {
+		t.Fatalf("first system prompt = %q", got)
+	}
+	first := logEntryFor(t, "compress@example.com")
+	if first.Compression != converter.CompressionMinify || first.CompressionSaved <= 0 {
+		t.Fatalf("first log entry compression = %q saved %d", first.Compression, first.CompressionSaved)
+	}
+
+	// 同一账号会话再次发送相同提示：替换为引用说明
+	if resp, raw := postChatJSON(t, srv.URL, string(body), nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, raw)
+	}
+	if got := upstreamSystemText(t, upstream, 1); !strings.HasPrefix(got, "[same instructions as before: ") {
+		t.Fatalf("second system prompt = %q", got)
+	}
+	second := nextLogEntry(t, "compress@example.com", first.ID)
+	if second.Compression != converter.CompressionReference || second.CompressionSaved <= first.CompressionSaved {
+		t.Fatalf("second log entry compression = %q saved %d", second.Compression, second.CompressionSaved)
+	}
+}
+
+func TestPromptCompressionOffByDefault(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("compress-off"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+	if config.Get().PromptCompression {
+		t.Fatal("prompt compression enabled by default")
+	}
+
+	prompt := "Be brief.   \n\n\n\nAnswer in English."
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":    "gemini-2.5-flash",
+		"messages": []map[string]string{{"role": "system", "content": prompt}, {"role": "user", "content": "hi"}},
+	})
+	if resp, raw := postChatJSON(t, srv.URL, string(body), nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, raw)
+	}
+	if got := upstreamSystemText(t, upstream, 0); got != prompt {
+		t.Fatalf("system prompt changed while compression is off: %q", got)
+	}
+	if entry := logEntryFor(t, "compress-off@example.com"); entry.Compression != "" || entry.CompressionSaved != 0 {
+		t.Fatalf("log entry compression = %q saved %d", entry.Compression, entry.CompressionSaved)
+	}
+}
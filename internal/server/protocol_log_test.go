@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+const geminiContents = `{"contents":[{"role":"user","parts":[{"text":"hi"}]},{"role":"model","parts":[{"text":"Hello"}]},{"role":"user","parts":[{"text":"more"}]}]}`
+
+func TestProtocolLogEntries(t *testing.T) {
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("Hello"), testutil.Text(" world")))
+	srv := newTestServer(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		protocol string
+		messages int
+	}{
+		{"openai", "/v1/chat/completions", `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`, store.ProtocolOpenAI, 1},
+		{"openai stream", "/v1/chat/completions", `{"model":"gemini-2.5-flash","stream":true,"messages":[{"role":"user","content":"hi"}]}`, store.ProtocolOpenAI, 1},
+		{"gemini", "/v1beta/models/gemini-2.5-flash:generateContent", geminiContents, store.ProtocolGemini, 3},
+		{"gemini stream", "/v1beta/models/gemini-2.5-flash:streamGenerateContent?alt=sse", geminiContents, store.ProtocolGemini, 3},
+		{"raw gemini", "/gemini/v1beta/models/gemini-2.5-flash:generateContent", geminiContents, store.ProtocolGemini, 3},
+		{"raw gemini stream", "/gemini/v1beta/models/gemini-2.5-flash:streamGenerateContent?alt=sse", geminiContents, store.ProtocolGemini, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := "protocol-" + strings.ReplaceAll(tt.name, " ", "-")
+			testutil.UseAccounts(t, testutil.Account(id))
+			postStream(t, srv.URL, tt.path, tt.body)
+
+			entry := logEntryFor(t, id+"@example.com")
+			if entry.Protocol != tt.protocol || entry.Model != "gemini-2.5-flash" || !entry.Success || entry.Status != http.StatusOK ||
+				entry.Path != strings.Split(tt.path, "?")[0] {
+				t.Fatalf("entry = %+v", entry)
+			}
+			if s := entry.Summary; s == nil || s.Model != "gemini-2.5-flash" || s.Messages != tt.messages || s.PromptTokens == 0 {
+				t.Fatalf("summary = %+v", entry.Summary)
+			}
+			// 上游返回的用量和回答文本
+			if entry.PromptTokens != 10 || entry.CompletionTokens != 5 || entry.Empty {
+				t.Fatalf("usage = %d/%d, empty %v", entry.PromptTokens, entry.CompletionTokens, entry.Empty)
+			}
+
+			// 日志详情中的请求快照带协议标记
+			status, raw := adminRequest(t, srv.URL, http.MethodGet, "/admin/logs/"+entry.ID, "")
+			if status != http.StatusOK {
+				t.Fatalf("GET log detail: %d %s", status, raw)
+			}
+			var detail struct {
+				Log struct {
+					Protocol string `json:"protocol"`
+					Detail   struct {
+						Request struct {
+							Protocol string          `json:"protocol"`
+							Body     json.RawMessage `json:"body"`
+						} `json:"request"`
+						Response struct {
+							ModelOutput string `json:"modelOutput"`
+						} `json:"response"`
+					} `json:"detail"`
+				} `json:"log"`
+			}
+			if err := json.Unmarshal(raw, &detail); err != nil {
+				t.Fatal(err)
+			}
+			req := detail.Log.Detail.Request
+			if detail.Log.Protocol != tt.protocol || req.Protocol != tt.protocol || len(req.Body) == 0 {
+				t.Fatalf("detail = %s", raw)
+			}
+			if tt.protocol == store.ProtocolGemini && !strings.Contains(string(req.Body), `"contents"`) {
+				t.Fatalf("request body = %s", req.Body)
+			}
+			if !strings.Contains(detail.Log.Detail.Response.ModelOutput, "Hello world") {
+				t.Fatalf("response content = %q", detail.Log.Detail.Response.ModelOutput)
+			}
+
+			// 用量台账按账号统计所有协议
+			today := time.Now().Format("2006-01-02")
+			var requests, tokens int
+			for _, row := range store.GetUsageLedger().Range(today, today) {
+				if row.Account == id+"@example.com" {
+					requests += row.Requests
+					tokens += row.PromptTokens + row.CompletionTokens
+				}
+			}
+			if requests != 1 || tokens != 15 {
+				t.Fatalf("ledger: %d requests, %d tokens", requests, tokens)
+			}
+		})
+	}
+}
+
+func TestGeminiUpstreamErrorLogged(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("protocol-gemini-error"))
+	testutil.StartUpstream(t, testutil.JSONHandler(http.StatusBadRequest, `{"error":{"code":400,"message":"bad contents","status":"INVALID_ARGUMENT"}}`))
+	srv := newTestServer(t)
+
+	for _, path := range []string{"/v1beta/models/gemini-2.5-flash:generateContent", "/gemini/v1beta/models/gemini-2.5-flash:streamGenerateContent?alt=sse"} {
+		prev := ""
+		if logs, _ := store.GetLogStore().List(context.Background(), 0, 1, store.LogFilter{Email: "protocol-gemini-error@example.com"}); len(logs) > 0 {
+			prev = logs[0].ID
+		}
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(geminiContents))
+		req.Header.Set("Authorization", "Bearer "+testAPIKey)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: status %d", path, resp.StatusCode)
+		}
+		entry := nextLogEntry(t, "protocol-gemini-error@example.com", prev)
+		if entry.Protocol != store.ProtocolGemini || entry.Success || entry.Status != http.StatusBadRequest || !strings.Contains(entry.Message, "bad contents") {
+			t.Fatalf("%s: entry = %+v", path, entry)
+		}
+	}
+}
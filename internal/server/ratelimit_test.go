@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// withHeaders 在 handler 的响应中附加上游限额头
+func withHeaders(handler http.HandlerFunc, kv ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i+1 < len(kv); i += 2 {
+			w.Header().Set(kv[i], kv[i+1])
+		}
+		handler(w, r)
+	}
+}
+
+func TestRateLimitHeadersScaledToPool(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("pool-limit-a"), testutil.Account("pool-limit-b"))
+	testutil.StartUpstream(t, withHeaders(testutil.Reply("STOP", testutil.Text("ok")),
+		"X-Ratelimit-Remaining-Requests", "10",
+		"X-Ratelimit-Reset-Requests", "60",
+	))
+	srv := newTestServer(t)
+
+	resp, body := postChat(t, srv.URL, testAPIKey, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	// 一个账号剩余 10 次，另一个未知账号按平均值估算
+	if got := resp.Header.Get("X-Ratelimit-Remaining-Requests"); got != "20" {
+		t.Errorf("remaining = %q, want 20 for the two-account pool", got)
+	}
+	if got := resp.Header.Get("X-Ratelimit-Reset-Requests"); got != "1m0s" && got != "59s" {
+		t.Errorf("reset = %q, want about a minute", got)
+	}
+
+	// 单个账号的原始值用于额度视图
+	recorded := 0
+	for _, id := range []string{"pool-limit-a", "pool-limit-b"} {
+		if snap, ok := store.AccountRateLimit(id); ok {
+			recorded++
+			if snap.Raw["X-Ratelimit-Remaining-Requests"] != "10" {
+				t.Errorf("%s raw = %v", id, snap.Raw)
+			}
+		}
+	}
+	if recorded != 1 {
+		t.Errorf("%d accounts recorded, want the one that served the request", recorded)
+	}
+}
+
+func TestUpstreamRateLimitRetryAfter(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("pool-limit-429"))
+	testutil.StartUpstream(t, withHeaders(
+		testutil.JSONHandler(http.StatusTooManyRequests, `{"error":{"code":429,"message":"quota","status":"RESOURCE_EXHAUSTED"}}`),
+		"Retry-After", "7",
+	))
+	srv := newTestServer(t)
+
+	resp, body := postChat(t, srv.URL, testAPIKey, "")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	// 所有账号都被限流，按上游要求的时间重试
+	if got := resp.Header.Get("Retry-After"); got != "7" && got != "6" {
+		t.Errorf("Retry-After = %q, want the upstream 7s", got)
+	}
+}
+
+func TestRateLimitHeadersAddRetryAfterToEvery429(t *testing.T) {
+	testutil.UseAccounts(t)
+	h := RateLimitHeaders(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want the 1s default", got)
+	}
+
+	// 自身限流器给出的窗口剩余时间保留，不被默认值覆盖
+	limited := RateLimitHeaders(LimitByIP(1)(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		limited(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	}
+	if got := w.Header().Get("Retry-After"); w.Code != http.StatusTooManyRequests || got != "60" && got != "61" {
+		t.Errorf("status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// readyz 请求 /readyz 并解码响应
+func readyz(t *testing.T, url string) (int, map[string]interface{}) {
+	t.Helper()
+	resp, err := http.Get(url + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestReadyzReportsLogging(t *testing.T) {
+	srv := newTestServer(t)
+
+	status, body := readyz(t, srv.URL)
+	if status != http.StatusOK || body["status"] != "ok" {
+		t.Fatalf("readyz = %d %v", status, body)
+	}
+	logging, ok := body["checks"].(map[string]interface{})["logging"].(map[string]interface{})
+	if !ok || logging["queueSize"] == nil {
+		t.Fatalf("logging check missing: %v", body)
+	}
+}
+
+func TestFailingLogBackendDoesNotAffectRequests(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("log-backend"))
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("Hello")))
+	srv := newTestServer(t)
+
+	// 日志文件位置被非空目录占用：每次保存都失败
+	path := filepath.Join(config.Get().DataDir, "logs.json")
+	saved := path + ".saved"
+	os.Rename(path, saved)
+	if err := os.MkdirAll(filepath.Join(path, "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(path)
+		os.Rename(saved, path)
+	})
+	logs := store.GetLogStore()
+	before := logs.Health()
+
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		resp, body := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: %d %s", i, resp.StatusCode, body)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("request %d took %v with a failing log backend", i, elapsed)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := logs.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	health := logs.Health()
+	if health.Errors <= before.Errors || health.Status != "degraded" {
+		t.Fatalf("health = %+v, want save errors counted", health)
+	}
+
+	// 日志子系统异常只作为警告，仍然就绪
+	status, body := readyz(t, srv.URL)
+	if status != http.StatusOK || body["status"] != "ok" {
+		t.Fatalf("readyz = %d %v", status, body)
+	}
+	if warnings, _ := body["warnings"].([]interface{}); len(warnings) != 1 {
+		t.Fatalf("warnings = %v, want the logging warning", body["warnings"])
+	}
+	logging := body["checks"].(map[string]interface{})["logging"].(map[string]interface{})
+	if logging["status"] != "degraded" || logging["lastError"] == "" {
+		t.Fatalf("logging check = %v", logging)
+	}
+}
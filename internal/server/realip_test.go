@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"anti2api-golang/internal/config"
+)
+
+// useTrustedProxies 在测试期间设置 TRUSTED_PROXIES（RealIP 在构造时读取）
+func useTrustedProxies(t *testing.T, proxies ...string) {
+	t.Helper()
+	cfg := config.Get()
+	previous := cfg.TrustedProxies
+	cfg.TrustedProxies = proxies
+	t.Cleanup(func() { cfg.TrustedProxies = previous })
+}
+
+// limitedHandler 每个客户端 IP 每分钟最多 perMinute 次请求
+func limitedHandler(perMinute int) http.Handler {
+	return RealIP(LimitByIP(perMinute)(func(w http.ResponseWriter, r *http.Request) {}))
+}
+
+// requestFrom 从 remote 发出、带 X-Forwarded-For 的请求
+func requestFrom(h http.Handler, remote, xff string) int {
+	r := httptest.NewRequest(http.MethodGet, "/status", nil)
+	r.RemoteAddr = remote
+	if xff != "" {
+		r.Header.Set("X-Forwarded-For", xff)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	useTrustedProxies(t, "10.0.0.1")
+	h := limitedHandler(2)
+
+	// 不受信任的对端每次伪造不同的 X-Forwarded-For，仍按对端地址计数
+	var codes []int
+	for i := 0; i < 3; i++ {
+		codes = append(codes, requestFrom(h, "203.0.113.7:5000", fmt.Sprintf("198.51.100.%d", i)))
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, want the third request limited", codes)
+	}
+}
+
+func TestRateLimitUsesClientBehindTrustedProxy(t *testing.T) {
+	useTrustedProxies(t, "10.0.0.1", "fd00::/8")
+	h := limitedHandler(1)
+
+	// 受信任代理转发的不同客户端分别计数
+	if code := requestFrom(h, "10.0.0.1:5000", "198.51.100.1"); code != http.StatusOK {
+		t.Errorf("first client: status %d, want 200", code)
+	}
+	if code := requestFrom(h, "10.0.0.1:5000", "198.51.100.2"); code != http.StatusOK {
+		t.Errorf("second client: status %d, want 200", code)
+	}
+	// 同一客户端经过另一个受信任代理仍按客户端计数
+	if code := requestFrom(h, "[fd00::1]:5000", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("repeated client: status %d, want 429", code)
+	}
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/pipeline"
+	"anti2api-golang/internal/server/handlers"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+// recoveredServer 以 Recover 中间件包装 handler 启动测试服务器
+func recoveredServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handlers.Recover(handler))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// panicLogEntry 等待 Recover 为 path 记录的失败日志
+func panicLogEntry(t *testing.T, path string) store.LogEntry {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		logs, _ := store.GetLogStore().List(context.Background(), 0, 50, store.LogFilter{})
+		for _, entry := range logs {
+			if entry.Path == path {
+				return entry
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no log entry for %s", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// pinnedAccount 在请求上下文中为会话选择账号（建立由 Recover 跟踪的绑定）
+func pinnedAccount(t *testing.T, r *http.Request, conversation string) *store.Account {
+	account, err := store.GetAccountStore().GetToken(store.WithConversation(r.Context(), conversation))
+	if err != nil {
+		t.Error(err)
+		panic(http.ErrAbortHandler)
+	}
+	return account
+}
+
+// checkReleased 会话绑定已被 Recover 解除
+func checkReleased(t *testing.T, conversation string) {
+	t.Helper()
+	if id := store.GetConversationMap().Get(conversation); id != "" {
+		t.Fatalf("conversation %s still bound to %s after panic", conversation, id)
+	}
+}
+
+// panicRenderer 用 StreamWriter 输出，在指定阶段 panic
+type panicRenderer struct {
+	sw      *api.StreamWriter
+	stage   string // content（第二段正文）、finish
+	content int
+}
+
+func (p *panicRenderer) Start()                                     { p.sw.WriteRole() }
+func (p *panicRenderer) Reasoning(text string)                      { p.sw.WriteReasoning(text) }
+func (p *panicRenderer) ToolCalls(calls []converter.OpenAIToolCall) { p.sw.WriteToolCalls(calls) }
+func (p *panicRenderer) Heartbeat() error                           { return p.sw.WriteHeartbeat() }
+func (p *panicRenderer) Error(err error, started bool)              {}
+func (p *panicRenderer) Content(text string) {
+	if p.content++; p.stage == "content" && p.content == 2 {
+		panic("renderer failed on second chunk")
+	}
+	p.sw.WriteContent(text)
+	p.sw.Flush()
+}
+func (p *panicRenderer) Finish(result *pipeline.Result) {
+	if p.stage == "finish" {
+		panic("renderer failed on finish")
+	}
+	p.sw.WriteFinish(result.FinishReason, result.Usage)
+}
+
+// streamingHandler 经过真实的 Orchestrator 输出流式响应，在 stage 阶段 panic
+func streamingHandler(t *testing.T, conversation, stage string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account := pinnedAccount(t, r, conversation)
+		api.SetStreamHeaders(w)
+		renderer := &panicRenderer{sw: api.NewStreamWriter(w, "chatcmpl-panic", time.Now().Unix(), "gemini-2.5-flash"), stage: stage}
+		o := &pipeline.Orchestrator{
+			Request:  &converter.AntigravityRequest{Model: "gemini-2.5-flash"},
+			Account:  account,
+			Model:    "gemini-2.5-flash",
+			Renderer: renderer,
+		}
+		if stage == "complete" {
+			o.OnComplete = func(*pipeline.Result) { panic("log callback failed") }
+		}
+		o.Run(r.Context())
+	}
+}
+
+// streamEvents 读取完整的 SSE 响应（连接被直接断开时返回错误）
+func streamEvents(t *testing.T, url string) ([]string, error) {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	var events []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			events = append(events, data)
+		}
+	}
+	return events, err
+}
+
+func TestRecoverStreamPanicStages(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("panic-stream"))
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("first"), testutil.Text("second"), testutil.Text("third")))
+
+	for _, stage := range []string{"content", "complete", "finish"} {
+		t.Run(stage, func(t *testing.T) {
+			conversation := "panic-conv-" + stage
+			srv := recoveredServer(t, streamingHandler(t, conversation, stage))
+
+			events, err := streamEvents(t, srv.URL+"/panic/"+stage)
+			if err != nil {
+				t.Fatalf("connection dropped: %v (events %q)", err, events)
+			}
+			// 已输出的正文保留，之后是结构化的错误块和 [DONE]
+			if len(events) < 3 || !strings.Contains(strings.Join(events, ""), "first") {
+				t.Fatalf("events = %q", events)
+			}
+			if events[len(events)-1] != "[DONE]" {
+				t.Fatalf("last event = %q, want [DONE]", events[len(events)-1])
+			}
+			var errChunk struct {
+				Error struct {
+					Message string `json:"message"`
+					Type    string `json:"type"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(events[len(events)-2]), &errChunk); err != nil || errChunk.Error.Message == "" {
+				t.Fatalf("error chunk = %q (%v)", events[len(events)-2], err)
+			}
+			if errChunk.Error.Type != api.ErrorType(http.StatusInternalServerError) {
+				t.Errorf("error type = %q", errChunk.Error.Type)
+			}
+			if stage == "content" && strings.Contains(strings.Join(events, ""), "third") {
+				t.Error("output continued after the panic")
+			}
+
+			entry := panicLogEntry(t, "/panic/"+stage)
+			if entry.Status != http.StatusInternalServerError || !strings.Contains(entry.Message, "panic") {
+				t.Errorf("log entry = %+v", entry)
+			}
+			checkReleased(t, conversation)
+		})
+	}
+}
+
+func TestRecoverPanicBeforeHeaders(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("panic-convert"))
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ignored")))
+	srv := recoveredServer(t, func(w http.ResponseWriter, r *http.Request) {
+		pinnedAccount(t, r, "panic-conv-convert")
+		// 上游响应没有候选结果时转换越界
+		converter.ConvertToOpenAIResponse(&converter.AntigravityResponse{}, "gemini-2.5-flash", nil)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	resp, err := http.Post(srv.URL+"/panic/convert", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if resp.StatusCode != http.StatusInternalServerError || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		t.Fatalf("status = %d, Content-Type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error.Message == "" {
+		t.Fatalf("error body: %+v (%v)", body, err)
+	}
+	// 错误信息不泄露 panic 内容
+	if strings.Contains(body.Error.Message, "index out of range") {
+		t.Errorf("panic value leaked to client: %q", body.Error.Message)
+	}
+
+	entry := panicLogEntry(t, "/panic/convert")
+	if entry.Status != http.StatusInternalServerError || !strings.Contains(entry.Message, "index out of range") {
+		t.Errorf("log entry = %+v", entry)
+	}
+	checkReleased(t, "panic-conv-convert")
+}
+
+func TestRecoverPanicAfterPartialJSON(t *testing.T) {
+	srv := recoveredServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"partial":`)
+		panic("encoder failed")
+	})
+
+	resp, err := http.Get(srv.URL + "/panic/partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	// 响应头已发送，无法改为错误响应，也不追加 SSE 错误块
+	if resp.StatusCode != http.StatusOK || string(body) != `{"partial":` {
+		t.Fatalf("response = %d %q", resp.StatusCode, body)
+	}
+	if entry := panicLogEntry(t, "/panic/partial"); entry.Status != http.StatusInternalServerError {
+		t.Errorf("log entry = %+v", entry)
+	}
+}
+
+func TestRecoverKeepsServing(t *testing.T) {
+	calls := 0
+	srv := recoveredServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls == 1 {
+			panic("first request fails")
+		}
+		io.WriteString(w, "ok")
+	})
+
+	for i, want := range []int{http.StatusInternalServerError, http.StatusOK} {
+		resp, err := http.Get(srv.URL + "/panic/serving")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("request %d status = %d, want %d", i, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestRecoverPassesAbortHandler(t *testing.T) {
+	srv := recoveredServer(t, func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	// ErrAbortHandler 按 net/http 的约定直接中断连接，不返回 500
+	if resp, err := http.Get(srv.URL + "/panic/abort"); err == nil {
+		resp.Body.Close()
+		t.Fatalf("aborted request got status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/server/handlers"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/utils"
+)
+
+// routeRoles 管理接口所需的最低角色。未列出的路由：GET 需要 viewer，其他方法需要 admin
+var routeRoles = map[string]string{
+	// 账号日常操作
+	"POST /auth/accounts/refresh-all":            store.RoleOperator,
+	"POST /auth/accounts/{index}/refresh":        store.RoleOperator,
+	"POST /auth/accounts/{index}/enable":         store.RoleOperator,
+	"POST /auth/accounts/{index}/drain":          store.RoleOperator,
+	"POST /auth/accounts/{index}/rotate-session": store.RoleOperator,
+	"POST /auth/accounts/rotate-sessions":        store.RoleOperator,
+
+	// 端点切换和请求处理
+	"POST /admin/endpoints":               store.RoleOperator,
+	"POST /admin/endpoints/mode":          store.RoleOperator,
+	"PUT /admin/endpoints/weights":        store.RoleOperator,
+	"POST /admin/endpoints/auto":          store.RoleOperator,
+	"DELETE /admin/active/{id}":           store.RoleOperator,
+	"POST /admin/quarantine/{id}/approve": store.RoleOperator,
+	"POST /admin/quarantine/{id}/reject":  store.RoleOperator,
+	"DELETE /admin/deferred/{id}":         store.RoleOperator,
+	"DELETE /admin/affinity/{key}":        store.RoleOperator,
+	"POST /admin/webhooks/test":           store.RoleOperator,
+	"POST /admin/postprocess/dry-run":     store.RoleOperator,
+
+	// 只读但涉及凭证或完整用量数据
+	"GET /auth/oauth/url":         store.RoleAdmin,
+	"GET /admin/usage/export":     store.RoleAdmin,
+	"GET /admin/audit":            store.RoleAdmin,
+	"GET /admin/debug/goroutines": store.RoleAdmin,
+}
+
+// requiredRole 路由所需的最低角色
+func requiredRole(pattern string) string {
+	if role, ok := routeRoles[pattern]; ok {
+		return role
+	}
+	if strings.HasPrefix(pattern, "GET ") {
+		return store.RoleViewer
+	}
+	return store.RoleAdmin
+}
+
+// RequireRole 检查请求身份的角色是否满足路由要求（需在 RequirePanelAuth 之后），
+// 拒绝的请求记入审计日志
+func RequireRole(pattern string) Middleware {
+	need := requiredRole(pattern)
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			principal, _ := store.PrincipalFromContext(r.Context())
+			if store.RoleAllows(principal.Role, need) {
+				next(w, r)
+				return
+			}
+
+			tenant, _ := store.TenantFromContext(r.Context())
+			logger.Warn("Panel request denied: %s (role %q) needs %s for %s", principal.Name, principal.Role, need, pattern)
+			store.GetAuditLog().Record(store.AuditEntry{
+				Event:        store.AuditDenied,
+				Principal:    principal.Name,
+				Role:         principal.Role,
+				RequiredRole: need,
+				Tenant:       tenant,
+				Method:       r.Method,
+				Path:         r.URL.Path,
+				Route:        pattern,
+				ClientIP:     utils.ClientIP(r),
+			})
+
+			handlers.CloseUnreadBody(w, r)
+			handlers.WriteJSON(w, http.StatusForbidden, map[string]interface{}{
+				"error": map[string]interface{}{
+					"message":       handlers.Message(w, "auth.role_required", need, principal.Role),
+					"type":          "permission_error",
+					"code":          "insufficient_role",
+					"required_role": need,
+					"role":          principal.Role,
+				},
+			})
+		}
+	}
+}
+
+// checkRouteRoles 启动时检查角色表中是否有未注册的路由（通常是路由改名后漏改）
+func checkRouteRoles(router *Router) {
+	registered := make(map[string]bool)
+	for _, route := range router.Routes() {
+		registered[route[0]] = true
+	}
+	for pattern := range routeRoles {
+		if !registered[pattern] {
+			logger.Warn("Role map entry %q does not match any registered route", pattern)
+		}
+	}
+}
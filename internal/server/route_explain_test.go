@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/auth"
+	"anti2api-golang/internal/server/handlers"
+	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/testutil"
+)
+
+const routeChatBody = `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`
+
+// useRouteAccounts 一个可用账号和四个因不同原因被排除的账号（按选择顺序）
+func useRouteAccounts(t *testing.T) {
+	t.Helper()
+	off := testutil.Account("route-off")
+	off.Enable = false
+	daily := testutil.Account("route-daily")
+	daily.Endpoint = "daily"
+	testutil.UseAccounts(t, off, daily, testutil.Account("route-cool"), testutil.Account("route-quota"), testutil.Account("route-ok"))
+
+	accounts := store.GetAccountStore()
+	accounts.MarkUnavailable("route-cool", time.Minute, "failover")
+	accounts.MarkRateLimited("route-quota", time.Minute)
+}
+
+// routeHeaders 请求路由说明的请求头（请求指定模拟上游的端点）
+func routeHeaders(session string) map[string]string {
+	header := map[string]string{
+		handlers.EndpointOverrideHeader: testutil.EndpointKey,
+		handlers.DebugRouteHeader:       "explain",
+	}
+	if session != "" {
+		header["X-Session-Token"] = session
+	}
+	return header
+}
+
+// decodeRoute 响应体中的 route 扩展（没有时为 nil）
+func decodeRoute(t *testing.T, body []byte) *store.RouteExplanation {
+	t.Helper()
+	var resp struct {
+		Route *store.RouteExplanation `json:"route"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return resp.Route
+}
+
+// checkRouteCandidates 唯一一次选择的候选账号及排除原因
+func checkRouteCandidates(t *testing.T, route *store.RouteExplanation, want [][2]string) store.RouteSelection {
+	t.Helper()
+	if route == nil || len(route.Selections) != 1 {
+		t.Fatalf("route = %+v, want one selection", route)
+	}
+	sel := route.Selections[0]
+	got := make([][2]string, len(sel.Candidates))
+	for i, c := range sel.Candidates {
+		got[i] = [2]string{c.ID, c.Excluded}
+		if (c.Excluded == store.RouteExcludedCooldown || c.Excluded == store.RouteExcludedQuota) && (c.Until == nil || !c.Until.After(time.Now())) {
+			t.Errorf("%s until = %v, want a future time", c.ID, c.Until)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("candidates = %v, want %v", got, want)
+	}
+	if sel.Endpoint != testutil.EndpointKey {
+		t.Errorf("selection endpoint = %q, want %q", sel.Endpoint, testutil.EndpointKey)
+	}
+	return sel
+}
+
+var routeExclusions = [][2]string{
+	{"route-off", store.RouteExcludedDisabled},
+	{"route-daily", store.RouteExcludedEndpoint},
+	{"route-cool", store.RouteExcludedCooldown},
+	{"route-quota", store.RouteExcludedQuota},
+}
+
+func TestRouteExplainCompletion(t *testing.T) {
+	useRouteAccounts(t)
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("Hello")))
+	srv := newTestServer(t)
+	session := auth.CreateSession("", "route-admin", store.RoleAdmin)
+
+	resp, body := postChatJSON(t, srv.URL, routeChatBody, routeHeaders(session))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, body)
+	}
+	route := decodeRoute(t, body)
+	sel := checkRouteCandidates(t, route, append(routeExclusions, [2]string{"route-ok", ""}))
+	if sel.Selected != "route-ok" || sel.Error != "" {
+		t.Errorf("selection = %+v, want route-ok", sel)
+	}
+	if len(route.Upstream) != 1 || route.Upstream[0].Account != "route-ok" || route.Upstream[0].Endpoint != testutil.EndpointKey || route.Upstream[0].Source != store.RouteEndpointOverride {
+		t.Errorf("upstream = %+v, want one override call", route.Upstream)
+	}
+
+	// 日志始终记录路由说明
+	entry := store.GetLogStore().GetByID(context.Background(), logEntryFor(t, "route-ok@example.com").ID)
+	if entry == nil || entry.Route == nil || entry.Route.Selections[0].Selected != "route-ok" {
+		t.Fatalf("log entry route = %+v", entry)
+	}
+}
+
+func TestRouteExplainRequiresPanelSession(t *testing.T) {
+	useRouteAccounts(t)
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("Hello")))
+	srv := newTestServer(t)
+	session := auth.CreateSession("", "route-admin", store.RoleAdmin)
+	if resp, body := postChatJSON(t, srv.URL, routeChatBody, routeHeaders(session)); resp.StatusCode != http.StatusOK || decodeRoute(t, body) == nil {
+		t.Fatalf("status = %d, no route with a panel session: %s", resp.StatusCode, body)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		header map[string]string
+	}{
+		{"no session", routeHeaders("")},
+		{"invalid session", routeHeaders("not-a-session")},
+		// 租户管理员不能查看其他请求的路由
+		{"other tenant", routeHeaders(auth.CreateSession("route-tenant", "route-tenant-admin", store.RoleAdmin))},
+		{"no debug header", map[string]string{handlers.EndpointOverrideHeader: testutil.EndpointKey, "X-Session-Token": session}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			previous := logEntryFor(t, "route-ok@example.com").ID
+			resp, body := postChatJSON(t, srv.URL, routeChatBody, tc.header)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d %s", resp.StatusCode, body)
+			}
+			if route := decodeRoute(t, body); route != nil {
+				t.Errorf("route returned: %+v", route)
+			}
+			// 不返回给客户端时日志照常记录
+			entry := store.GetLogStore().GetByID(context.Background(), nextLogEntry(t, "route-ok@example.com", previous).ID)
+			if entry == nil || entry.Route == nil {
+				t.Errorf("log entry route missing: %+v", entry)
+			}
+		})
+	}
+}
+
+func TestRouteExplainStream(t *testing.T) {
+	useRouteAccounts(t)
+	testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("Hello")))
+	srv := newTestServer(t)
+	session := auth.CreateSession("", "route-admin", store.RoleAdmin)
+
+	resp, body := postChatJSON(t, srv.URL, streamRequestBody, routeHeaders(session))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	// 只有结束 chunk 附带路由说明
+	var routes []*store.RouteExplanation
+	for _, line := range strings.Split(string(body), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		if route := decodeRoute(t, []byte(data)); route != nil {
+			if !strings.Contains(data, `"finish_reason":"stop"`) {
+				t.Errorf("route on a chunk before the end: %s", data)
+			}
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) != 1 {
+		t.Fatalf("%d chunks with a route, want 1", len(routes))
+	}
+	checkRouteCandidates(t, routes[0], append(routeExclusions, [2]string{"route-ok", ""}))
+}
+
+func TestRouteExplainNoAccount(t *testing.T) {
+	useRouteAccounts(t)
+	store.GetAccountStore().MarkRateLimited("route-ok", time.Minute)
+	srv := newTestServer(t)
+	session := auth.CreateSession("", "route-admin", store.RoleAdmin)
+
+	resp, body := postChatJSON(t, srv.URL, routeChatBody, routeHeaders(session))
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d %s", resp.StatusCode, body)
+	}
+	if e := decodeChatError(t, body); e.Message == "" {
+		t.Errorf("error object missing: %s", body)
+	}
+	// 503 附带每个账号被排除的原因
+	sel := checkRouteCandidates(t, decodeRoute(t, body), append(routeExclusions, [2]string{"route-ok", store.RouteExcludedQuota}))
+	if sel.Selected != "" || sel.Error == "" {
+		t.Errorf("selection = %+v, want an error without a selected account", sel)
+	}
+
+	// 没有请求路由说明时错误响应不变
+	_, body = postChatJSON(t, srv.URL, routeChatBody, map[string]string{handlers.EndpointOverrideHeader: testutil.EndpointKey})
+	if route := decodeRoute(t, body); route != nil {
+		t.Errorf("route returned without X-Debug-Route: %+v", route)
+	}
+}
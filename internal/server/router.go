@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Middleware 路由中间件
+type Middleware func(next http.HandlerFunc) http.HandlerFunc
+
+// Chain 有序中间件链（第一个为最外层）
+type Chain []Middleware
+
+// Then 将中间件链应用到处理函数
+func (c Chain) Then(h http.HandlerFunc) http.HandlerFunc {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
+
+// Router 按分组注册路由，同组路由共享同一条中间件链
+type Router struct {
+	mux    *http.ServeMux
+	routes map[string]string // pattern -> group name
+}
+
+// RouteGroup 路由分组
+type RouteGroup struct {
+	router   *Router
+	name     string
+	chain    Chain
+	perRoute []func(pattern string) Middleware
+}
+
+// NewRouter 创建路由器
+func NewRouter(mux *http.ServeMux) *Router {
+	return &Router{
+		mux:    mux,
+		routes: make(map[string]string),
+	}
+}
+
+// Group 创建路由分组
+func (r *Router) Group(name string, middlewares ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		router: r,
+		name:   name,
+		chain:  append(Chain{}, middlewares...),
+	}
+}
+
+// Routes 返回已注册的路由及其所属分组（按路由排序）
+func (r *Router) Routes() [][2]string {
+	result := make([][2]string, 0, len(r.routes))
+	for pattern, group := range r.routes {
+		result = append(result, [2]string{pattern, group})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	return result
+}
+
+// Name 分组名称
+func (g *RouteGroup) Name() string {
+	return g.name
+}
+
+// Chain 分组的中间件链
+func (g *RouteGroup) Chain() Chain {
+	return g.chain
+}
+
+// Use 追加中间件（只影响之后注册的路由）
+func (g *RouteGroup) Use(middlewares ...Middleware) {
+	g.chain = append(g.chain, middlewares...)
+}
+
+// UseForRoute 追加按路由生成的中间件（位于分组中间件链之内，只影响之后注册的路由）
+func (g *RouteGroup) UseForRoute(fn func(pattern string) Middleware) {
+	g.perRoute = append(g.perRoute, fn)
+}
+
+// HandleFunc 注册路由
+func (g *RouteGroup) HandleFunc(pattern string, h http.HandlerFunc) {
+	g.router.routes[pattern] = g.name
+	chain := g.chain
+	for _, fn := range g.perRoute {
+		chain = append(chain[:len(chain):len(chain)], fn(pattern))
+	}
+	g.router.mux.HandleFunc(pattern, chain.Then(h))
+}
+
+// Handle 注册 http.Handler
+func (g *RouteGroup) Handle(pattern string, h http.Handler) {
+	g.HandleFunc(pattern, h.ServeHTTP)
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/auth"
+	"anti2api-golang/internal/store"
+)
+
+// tag 在 trace 中记录进入和离开的中间件
+func tag(trace *[]string, name string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			*trace = append(*trace, name)
+			next(w, r)
+			*trace = append(*trace, "/"+name)
+		}
+	}
+}
+
+func TestRouteGroupChainOrder(t *testing.T) {
+	var trace []string
+	mux := http.NewServeMux()
+	router := NewRouter(mux)
+	group := router.Group("g", tag(&trace, "outer"), tag(&trace, "inner"))
+	group.UseForRoute(func(pattern string) Middleware { return tag(&trace, "route "+pattern) })
+	group.HandleFunc("GET /before", func(w http.ResponseWriter, r *http.Request) { trace = append(trace, "handler") })
+	// Use 只影响之后注册的路由，按路由生成的中间件始终位于分组链之内
+	group.Use(tag(&trace, "late"))
+	group.HandleFunc("GET /after", func(w http.ResponseWriter, r *http.Request) { trace = append(trace, "handler") })
+
+	for path, want := range map[string][]string{
+		"/before": {"outer", "inner", "route GET /before", "handler", "/route GET /before", "/inner", "/outer"},
+		"/after":  {"outer", "inner", "late", "route GET /after", "handler", "/route GET /after", "/late", "/inner", "/outer"},
+	} {
+		trace = nil
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		if !reflect.DeepEqual(trace, want) {
+			t.Errorf("%s: trace = %v, want %v", path, trace, want)
+		}
+	}
+
+	want := [][2]string{{"GET /after", "g"}, {"GET /before", "g"}}
+	if got := router.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Routes() = %v, want %v", got, want)
+	}
+}
+
+// routeGroupFor 按路径约定推断路由应属的分组
+func routeGroupFor(pattern string) string {
+	_, path, _ := strings.Cut(pattern, " ")
+	switch {
+	case path == "/healthz" || path == "/health" || path == "/readyz" || path == "/api/version":
+		return "health"
+	case path == "/api/public/status":
+		return "status"
+	case strings.HasPrefix(path, "/v1") || strings.HasPrefix(path, "/gemini/") || strings.HasPrefix(path, "/{credential}/"):
+		return "api"
+	}
+	return ""
+}
+
+func TestRouteGroupAssignment(t *testing.T) {
+	router := New().router
+	for _, route := range router.Routes() {
+		pattern, group := route[0], route[1]
+		if want := routeGroupFor(pattern); want != "" && group != want {
+			t.Errorf("%s registered in group %q, want %q", pattern, group, want)
+		}
+		if routeGroupFor(pattern) == "" && group != "panel" && group != "admin" && group != "public" {
+			t.Errorf("%s registered in group %q", pattern, group)
+		}
+	}
+}
+
+// concreteRequest 把路由模式替换为可以请求的路径（路径参数替换为占位值）
+func concreteRequest(pattern string) (string, string) {
+	method, path, _ := strings.Cut(pattern, " ")
+	path = strings.ReplaceAll(path, "{$}", "")
+	for strings.Contains(path, "{") {
+		start := strings.Index(path, "{")
+		end := strings.Index(path[start:], "}")
+		path = path[:start] + "x" + path[start+end+1:]
+	}
+	return method, path
+}
+
+func TestRouteGroupsRequireCredentials(t *testing.T) {
+	router := New().router
+	srv := newTestServer(t)
+	// 面板的页面请求被重定向到登录页，这里请求 JSON 并且不跟随重定向
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	for _, route := range router.Routes() {
+		pattern, group := route[0], route[1]
+		method, path := concreteRequest(pattern)
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		req.Header.Set("Accept", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		switch group {
+		case "panel", "admin", "api":
+			// 没有面板会话或 API Key 的请求在到达处理函数之前被拒绝
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("%s (%s): anonymous request got %d, want 401", pattern, group, resp.StatusCode)
+			}
+		case "health":
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("%s (%s): got %d, want 200 without credentials", pattern, group, resp.StatusCode)
+			}
+		}
+	}
+}
+
+func TestAdminGroupRejectsTenantAdmins(t *testing.T) {
+	router := New().router
+	srv := newTestServer(t)
+	token := auth.CreateSession("tenant-a", "alice", store.RoleAdmin)
+	t.Cleanup(func() { auth.DeleteSession(token) })
+
+	for _, route := range router.Routes() {
+		pattern, group := route[0], route[1]
+		method, path := concreteRequest(pattern)
+		if group != "admin" && !(group == "panel" && method == http.MethodGet) {
+			continue
+		}
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("X-Session-Token", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		// 全局设置只允许超级管理员，面板接口对租户管理员开放（限定在本租户内）
+		if group == "admin" && resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s: tenant admin got %d, want 403", pattern, resp.StatusCode)
+		}
+		if group == "panel" && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			t.Errorf("%s: tenant admin got %d", pattern, resp.StatusCode)
+		}
+	}
+}
@@ -4,14 +4,34 @@ import (
 	"net/http"
 	"strings"
 
+	"anti2api-golang/internal/config"
 	"anti2api-golang/internal/server/handlers"
 )
 
 // SetupRoutes 注册路由
-func SetupRoutes(mux *http.ServeMux) {
+// 路由按分组注册，新增路由只需选择分组即可获得该组的认证等中间件
+func SetupRoutes(mux *http.ServeMux, components *Registry) *Router {
+	router := NewRouter(mux)
+
+	// 健康检查：无中间件
+	health := router.Group("health")
+	// 公开页面：登录页、OAuth 回调、静态资源
+	public := router.Group("public")
+	// 管理面板：需要面板会话（租户管理员只能看到本租户的数据）
+	panel := router.Group("panel", RequirePanelAuth)
+	// 全局设置：仅超级管理员
+	admin := router.Group("admin", RequirePanelAuth, RequireSuperAdmin)
+	// 公开状态页：配置开启后无需登录（可选访问令牌），按 IP 限流（令牌错误的请求也计数）
+	status := router.Group("status", LimitByIP(config.Get().PublicStatusRateLimit), RequirePublicStatus)
+	// 对外 API（/v1、/v1beta、/gemini）：需要 API Key，响应附带账号池限额头，开启追踪时创建根 span
+	apiGroup := router.Group("api", TraceRequests(mux), RequireAPIKey, RateLimitHeaders)
+	// 管理接口按路由检查角色（viewer / operator / admin，见 roles.go）
+	panel.UseForRoute(RequireRole)
+	admin.UseForRoute(RequireRole)
+
 	// ===== 静态文件 =====
 	fileServer := http.FileServer(http.Dir("public/admin"))
-	mux.Handle("GET /admin/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	public.Handle("GET /admin/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 检查是否需要认证
 		path := r.URL.Path
 		if path == "/admin/" || path == "/admin/index.html" || path == "/admin/api.html" {
@@ -26,52 +46,131 @@ func SetupRoutes(mux *http.ServeMux) {
 	}))
 
 	// ===== 健康检查 =====
-	mux.HandleFunc("GET /healthz", handlers.HandleHealthz)
-	mux.HandleFunc("GET /health", handlers.HandleHealthz)
+	health.HandleFunc("GET /healthz", handlers.HandleHealthz)
+	health.HandleFunc("GET /health", handlers.HandleHealthz)
+	health.HandleFunc("GET /readyz", handlers.HandleReadyz)
+	health.HandleFunc("GET /api/version", handlers.HandleVersion)
+
+	// ===== 公开状态页 =====
+	status.HandleFunc("GET /api/public/status", handlers.HandlePublicStatus)
 
 	// ===== 根路径 =====
-	mux.HandleFunc("GET /{$}", handlers.HandleRoot)
-	mux.HandleFunc("GET /admin", handlers.HandleAdminRedirect)
+	public.HandleFunc("GET /{$}", handlers.HandleRoot)
+	public.HandleFunc("GET /admin", handlers.HandleAdminRedirect)
 
 	// ===== 管理面板登录 =====
-	mux.HandleFunc("GET /admin/login", handlers.HandleLoginPage)
-	mux.HandleFunc("POST /admin/login", handlers.HandleLogin)
-	mux.HandleFunc("POST /admin/logout", handlers.HandleLogout)
+	public.HandleFunc("GET /admin/login", handlers.HandleLoginPage)
+	public.HandleFunc("POST /admin/login", handlers.HandleLogin)
+	public.HandleFunc("POST /admin/logout", handlers.HandleLogout)
 
 	// ===== 管理面板 API（需要认证）=====
-	mux.HandleFunc("GET /admin/settings", RequirePanelAuth(handlers.HandleGetSettings))
-	mux.HandleFunc("GET /admin/endpoints", RequirePanelAuth(handlers.HandleGetEndpoints))
-	mux.HandleFunc("POST /admin/endpoints", RequirePanelAuth(handlers.HandleSetEndpoint))
-	mux.HandleFunc("POST /admin/endpoints/mode", RequirePanelAuth(handlers.HandleSetEndpointMode))
-	mux.HandleFunc("GET /admin/logs", RequirePanelAuth(handlers.HandleGetLogs))
-	mux.HandleFunc("GET /admin/logs/usage", RequirePanelAuth(handlers.HandleGetLogsUsage))
-	mux.HandleFunc("GET /admin/logs/{id}", RequirePanelAuth(handlers.HandleGetLogDetail))
+	panel.HandleFunc("GET /admin/logs", handlers.HandleGetLogs)
+	panel.HandleFunc("GET /admin/logs/usage", handlers.HandleGetLogsUsage)
+	panel.HandleFunc("GET /admin/logs/errors", handlers.HandleGetLogsErrors)
+	panel.HandleFunc("GET /admin/logs/{id}", handlers.HandleGetLogDetail)
+
+	// ===== 全局设置（仅超级管理员）=====
+	admin.HandleFunc("GET /admin/settings", handlers.HandleGetSettings)
+	admin.HandleFunc("PUT /admin/settings", handlers.HandleUpdateSettings)
+	admin.HandleFunc("GET /admin/endpoints", handlers.HandleGetEndpoints)
+	admin.HandleFunc("POST /admin/endpoints", handlers.HandleSetEndpoint)
+	admin.HandleFunc("POST /admin/endpoints/mode", handlers.HandleSetEndpointMode)
+	admin.HandleFunc("PUT /admin/endpoints/weights", handlers.HandleSetEndpointWeights)
+	admin.HandleFunc("POST /admin/endpoints/auto", handlers.HandleSetAutoFailover)
+	admin.HandleFunc("GET /admin/settings/headers", handlers.HandleGetUpstreamHeaders)
+	admin.HandleFunc("PUT /admin/settings/headers", handlers.HandleSetUpstreamHeaders)
+	admin.HandleFunc("GET /admin/webhooks", handlers.HandleGetWebhooks)
+	admin.HandleFunc("POST /admin/webhooks/test", handlers.HandleTestWebhooks)
+	admin.HandleFunc("GET /admin/debug", handlers.HandleGetDebug)
+	admin.HandleFunc("PUT /admin/debug", handlers.HandleSetDebug)
+	admin.HandleFunc("GET /admin/debug/goroutines", handlers.HandleGetGoroutines)
+	admin.HandleFunc("GET /admin/runtime", handlers.HandleGetRuntime)
+	admin.HandleFunc("GET /admin/components", handleGetComponents(components))
+	admin.HandleFunc("GET /admin/active", handlers.HandleGetActive)
+	admin.HandleFunc("DELETE /admin/active/{id}", handlers.HandleCancelActive)
+	admin.HandleFunc("GET /admin/models", handlers.HandleGetModelConfigs)
+	admin.HandleFunc("PUT /admin/models/{name}", handlers.HandleSetModelConfig)
+	admin.HandleFunc("DELETE /admin/models/{name}", handlers.HandleDeleteModelConfig)
+	admin.HandleFunc("GET /admin/models/probe", handlers.HandleGetCapabilityProbe)
+	admin.HandleFunc("POST /admin/models/probe", handlers.HandleRunCapabilityProbe)
+	admin.HandleFunc("GET /admin/chaos", handlers.HandleGetChaos)
+	admin.HandleFunc("POST /admin/chaos", handlers.HandleAddChaos)
+	admin.HandleFunc("DELETE /admin/chaos/{id}", handlers.HandleDeleteChaos)
+	admin.HandleFunc("GET /admin/moderation", handlers.HandleGetModerationStats)
+	admin.HandleFunc("GET /admin/quarantine", handlers.HandleGetQuarantine)
+	admin.HandleFunc("POST /admin/quarantine/{id}/approve", handlers.HandleApproveQuarantine)
+	admin.HandleFunc("POST /admin/quarantine/{id}/reject", handlers.HandleRejectQuarantine)
+	admin.HandleFunc("POST /admin/postprocess/dry-run", handlers.HandlePostProcessDryRun)
+	admin.HandleFunc("GET /admin/validators", handlers.HandleGetValidators)
+	admin.HandleFunc("GET /admin/spill", handlers.HandleGetSpillStats)
+	admin.HandleFunc("GET /admin/usage/export", handlers.HandleExportUsage)
+	admin.HandleFunc("GET /admin/usage/keys", handlers.HandleGetKeyUsage)
+	admin.HandleFunc("GET /admin/keys/limits", handlers.HandleGetKeyLimits)
+	admin.HandleFunc("PUT /admin/keys/{key}/limits", handlers.HandleSetKeyLimits)
+	admin.HandleFunc("DELETE /admin/keys/{key}/limits", handlers.HandleDeleteKeyLimits)
+	admin.HandleFunc("GET /admin/corpus", handlers.HandleGetCorpus)
+	admin.HandleFunc("POST /admin/corpus/start", handlers.HandleStartCorpus)
+	admin.HandleFunc("POST /admin/corpus/stop", handlers.HandleStopCorpus)
+	admin.HandleFunc("GET /admin/tenants", handlers.HandleGetTenants)
+	admin.HandleFunc("GET /admin/affinity", handlers.HandleGetAffinity)
+	admin.HandleFunc("DELETE /admin/affinity/{key}", handlers.HandleDeleteAffinity)
+	admin.HandleFunc("GET /admin/deferred", handlers.HandleGetDeferredQueue)
+	admin.HandleFunc("DELETE /admin/deferred/{id}", handlers.HandleCancelDeferred)
+	admin.HandleFunc("POST /admin/backup", handlers.HandleBackup)
+	admin.HandleFunc("POST /admin/restore", handlers.HandleRestore)
+	admin.HandleFunc("GET /admin/audit", handlers.HandleGetAudit)
+	admin.HandleFunc("POST /admin/selftest", handlers.HandleSelftest)
 
 	// ===== OAuth =====
-	mux.HandleFunc("GET /auth/oauth/url", RequirePanelAuth(handlers.HandleGetOAuthURL))
-	mux.HandleFunc("GET /oauth-callback", handlers.HandleOAuthCallback)
-	mux.HandleFunc("POST /auth/oauth/parse-url", RequirePanelAuth(handlers.HandleParseOAuthURL))
+	panel.HandleFunc("GET /auth/oauth/url", handlers.HandleGetOAuthURL)
+	public.HandleFunc("GET /oauth-callback", handlers.HandleOAuthCallback)
+	panel.HandleFunc("POST /auth/oauth/parse-url", handlers.HandleParseOAuthURL)
 
 	// ===== 账号管理（需要认证）=====
-	mux.HandleFunc("GET /auth/accounts", RequirePanelAuth(handlers.HandleGetAccounts))
-	mux.HandleFunc("POST /auth/accounts/import-toml", RequirePanelAuth(handlers.HandleImportTOML))
-	mux.HandleFunc("POST /auth/accounts/refresh-all", RequirePanelAuth(handlers.HandleRefreshAllAccounts))
-	mux.HandleFunc("POST /auth/accounts/{index}/refresh", RequirePanelAuth(handlers.HandleRefreshAccount))
-	mux.HandleFunc("POST /auth/accounts/{index}/enable", RequirePanelAuth(handlers.HandleToggleAccount))
-	mux.HandleFunc("DELETE /auth/accounts/{index}", RequirePanelAuth(handlers.HandleDeleteAccount))
+	panel.HandleFunc("GET /auth/accounts", handlers.HandleGetAccounts)
+	panel.HandleFunc("POST /auth/accounts", handlers.HandleAddAccount)
+	panel.HandleFunc("POST /auth/accounts/import-toml", handlers.HandleImportTOML)
+	panel.HandleFunc("GET /auth/accounts/jobs/{id}", handlers.HandleGetJob)
+	panel.HandleFunc("GET /auth/accounts/refresh-stats", handlers.HandleGetRefreshStats)
+	panel.HandleFunc("POST /auth/accounts/refresh-all", handlers.HandleRefreshAllAccounts)
+	panel.HandleFunc("POST /auth/accounts/{index}/refresh", handlers.HandleRefreshAccount)
+	panel.HandleFunc("POST /auth/accounts/{index}/enable", handlers.HandleToggleAccount)
+	panel.HandleFunc("POST /auth/accounts/{index}/drain", handlers.HandleDrainAccount)
+	panel.HandleFunc("POST /auth/accounts/{index}/rotate-session", handlers.HandleRotateSession)
+	panel.HandleFunc("POST /auth/accounts/rotate-sessions", handlers.HandleRotateAllSessions)
+	panel.HandleFunc("PATCH /auth/accounts/{index}", handlers.HandleUpdateAccount)
+	panel.HandleFunc("DELETE /auth/accounts/{index}", handlers.HandleDeleteAccount)
 
 	// ===== OpenAI 兼容 API =====
-	mux.HandleFunc("GET /v1/models", RequireAPIKey(handlers.HandleGetModels))
-	mux.HandleFunc("POST /v1/chat/completions", RequireAPIKey(handlers.HandleChatCompletions))
-	mux.HandleFunc("POST /v1/chat/completions/", RequireAPIKey(handlers.HandleChatCompletions))
-	mux.HandleFunc("POST /{credential}/v1/chat/completions", RequireAPIKey(handlers.HandleChatCompletionsWithCredential))
+	apiGroup.HandleFunc("GET /v1/models", handlers.HandleGetModels)
+	apiGroup.HandleFunc("POST /v1/chat/completions", handlers.HandleChatCompletions)
+	apiGroup.HandleFunc("POST /v1/chat/completions/", handlers.HandleChatCompletions)
+	apiGroup.HandleFunc("GET /v1/chat/completions/{id}", handlers.HandleGetStoredCompletion)
+	apiGroup.HandleFunc("DELETE /v1/chat/completions/{id}", handlers.HandleDeleteStoredCompletion)
+	apiGroup.HandleFunc("POST /v1/files", handlers.HandleUploadFile)
+	apiGroup.HandleFunc("GET /v1/files", handlers.HandleListFiles)
+	apiGroup.HandleFunc("GET /v1/files/{id}", handlers.HandleGetFile)
+	apiGroup.HandleFunc("GET /v1/files/{id}/content", handlers.HandleGetFileContent)
+	apiGroup.HandleFunc("DELETE /v1/files/{id}", handlers.HandleDeleteFile)
+	apiGroup.HandleFunc("POST /v1/batches", handlers.HandleCreateBatch)
+	apiGroup.HandleFunc("GET /v1/batches", handlers.HandleListBatches)
+	apiGroup.HandleFunc("GET /v1/batches/{id}", handlers.HandleGetBatch)
+	apiGroup.HandleFunc("GET /v1/deferred/{id}", handlers.HandleGetDeferred)
+	apiGroup.HandleFunc("POST /{credential}/v1/chat/completions", handlers.HandleChatCompletionsWithCredential)
+	apiGroup.HandleFunc("POST /v1/moderations", handlers.HandleModerations)
+	apiGroup.HandleFunc("POST /v1/debug/convert", handlers.HandleDebugConvert)
 
 	// ===== Gemini 兼容 API =====
-	mux.HandleFunc("GET /v1beta/models", RequireAPIKey(handlers.HandleGeminiModels))
-	mux.HandleFunc("POST /v1beta/models/", RequireAPIKey(handlers.HandleGeminiAPI))
+	apiGroup.HandleFunc("GET /v1beta/models", handlers.HandleGeminiModels)
+	apiGroup.HandleFunc("GET /v1beta/models/{model}", handlers.HandleGetGeminiModel)
+	apiGroup.HandleFunc("POST /v1beta/models/", handlers.HandleGeminiAPI)
 
 	// ===== 原始 Gemini 透传 =====
-	mux.HandleFunc("POST /gemini/v1beta/models/", RequireAPIKey(handlers.HandleRawGeminiAPI))
+	apiGroup.HandleFunc("POST /gemini/v1beta/models/", handlers.HandleRawGeminiAPI)
+
+	checkRouteRoles(router)
+
+	return router
 }
 
 // isStaticAsset 检查是否是静态资源
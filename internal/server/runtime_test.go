@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/testutil"
+)
+
+// startHeldStream 发出流式请求并读到第一段内容，上游在 release 关闭前不结束
+func startHeldStream(t *testing.T, url string) (*bufio.Reader, func()) {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(streamRequest(t, url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended before the first chunk: %v", err)
+		}
+		if strings.Contains(line, "first") {
+			return reader, func() { resp.Body.Close() }
+		}
+	}
+}
+
+// activeList 管理接口返回的进行中请求
+func activeList(t *testing.T, url string) []monitor.ActiveRequest {
+	t.Helper()
+	status, body := adminRequest(t, url, http.MethodGet, "/admin/active", "")
+	if status != http.StatusOK {
+		t.Fatalf("GET /admin/active: %d %s", status, body)
+	}
+	var resp struct {
+		Active []monitor.ActiveRequest `json:"active"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Active
+}
+
+// activeStreamFor 账号进行中的流式输出
+func activeStreamFor(t *testing.T, url, account string) monitor.ActiveRequest {
+	t.Helper()
+	for _, a := range activeList(t, url) {
+		if a.Kind == monitor.KindStream && a.Account == account {
+			return a
+		}
+	}
+	t.Fatalf("no active stream for %s", account)
+	return monitor.ActiveRequest{}
+}
+
+func TestAdminActiveCancelStream(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("active-cancel"))
+	release, released := make(chan struct{}), make(chan bool, 1)
+	defer close(release)
+	testutil.StartUpstream(t, heldStream(release, released))
+	srv := newTestServer(t)
+
+	reader, closeBody := startHeldStream(t, srv.URL)
+	defer closeBody()
+
+	a := activeStreamFor(t, srv.URL, "active-cancel")
+	if a.Model != "gemini-2.5-flash" || a.Cancelled {
+		t.Fatalf("active = %+v", a)
+	}
+
+	if status, body := adminRequest(t, srv.URL, http.MethodDelete, "/admin/active/stream-unknown", ""); status != http.StatusNotFound {
+		t.Fatalf("cancel unknown: %d %s", status, body)
+	}
+	if status, body := adminRequest(t, srv.URL, http.MethodDelete, "/admin/active/"+a.ID, ""); status != http.StatusOK {
+		t.Fatalf("cancel: %d %s", status, body)
+	}
+
+	// 流立即以 error 结束，不等待上游，也不报告为正常结束
+	done := make(chan string, 1)
+	go func() {
+		rest, _ := io.ReadAll(reader)
+		done <- string(rest)
+	}()
+	select {
+	case rest := <-done:
+		if !strings.Contains(rest, `"finish_reason":"error"`) || strings.Contains(rest, "second") {
+			t.Fatalf("stream after cancel = %q", rest)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream not ended after cancel")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(activeList(t, srv.URL)) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("still active after cancel: %+v", activeList(t, srv.URL))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAdminRuntime(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("runtime-stream"))
+	release, released := make(chan struct{}), make(chan bool, 1)
+	testutil.StartUpstream(t, heldStream(release, released))
+	srv := newTestServer(t)
+
+	cfg := config.Get()
+	saved := *cfg
+	t.Cleanup(func() { *cfg = saved })
+
+	_, closeBody := startHeldStream(t, srv.URL)
+	defer closeBody()
+	defer close(release)
+
+	if a := activeStreamFor(t, srv.URL, "runtime-stream"); a.Overdue {
+		t.Fatalf("stream overdue under the default limit: %+v", a)
+	}
+
+	cfg.StreamMaxDuration = 15
+	cfg.StreamWatchdogCancel = true
+	status, body := adminRequest(t, srv.URL, http.MethodGet, "/admin/runtime", "")
+	if status != http.StatusOK {
+		t.Fatalf("GET /admin/runtime: %d %s", status, body)
+	}
+	var runtime struct {
+		Current  monitor.Sample `json:"current"`
+		Watchdog struct {
+			MaxStreamMinutes int  `json:"maxStreamMinutes"`
+			Cancel           bool `json:"cancel"`
+		} `json:"watchdog"`
+	}
+	if err := json.Unmarshal(body, &runtime); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.Current.ActiveStreams < 1 || runtime.Current.AccountHolds["runtime-stream"] != 1 || runtime.Current.Goroutines == 0 {
+		t.Fatalf("current = %+v", runtime.Current)
+	}
+	if runtime.Watchdog.MaxStreamMinutes != 15 || !runtime.Watchdog.Cancel {
+		t.Fatalf("watchdog = %+v", runtime.Watchdog)
+	}
+}
+
+func TestAdminGoroutineStages(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("goroutine-stages"))
+	release, released := make(chan struct{}), make(chan bool, 1)
+	testutil.StartUpstream(t, heldStream(release, released))
+	srv := newTestServer(t)
+
+	_, closeBody := startHeldStream(t, srv.URL)
+	defer closeBody()
+	defer close(release)
+
+	status, body := adminRequest(t, srv.URL, http.MethodGet, "/admin/debug/goroutines", "")
+	if status != http.StatusOK {
+		t.Fatalf("GET /admin/debug/goroutines: %d %s", status, body)
+	}
+	var resp struct {
+		Total  int            `json:"total"`
+		Stages map[string]int `json:"stages"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	// 流式输出期间处理协程带 http 和 stream 阶段标签
+	if resp.Stages["stream"] == 0 || resp.Stages["http"] == 0 {
+		t.Fatalf("stages = %v", resp.Stages)
+	}
+	sum := 0
+	for _, n := range resp.Stages {
+		sum += n
+	}
+	if resp.Total != sum {
+		t.Fatalf("total %d != sum of stages %d", resp.Total, sum)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/testutil"
+)
+
+// accountSchedule 账号列表中的时间段状态
+type accountSchedule struct {
+	ID              string `json:"id"`
+	InSchedule      *bool  `json:"inSchedule"`
+	NextAvailableAt string `json:"nextAvailableAt"`
+}
+
+func listedSchedule(t *testing.T, url, id string) accountSchedule {
+	t.Helper()
+	status, body := adminRequest(t, url, http.MethodGet, "/auth/accounts", "")
+	if status != http.StatusOK {
+		t.Fatalf("GET /auth/accounts: %d %s", status, body)
+	}
+	var resp struct {
+		Accounts []accountSchedule `json:"accounts"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range resp.Accounts {
+		if a.ID == id {
+			return a
+		}
+	}
+	t.Fatalf("account %s not listed", id)
+	return accountSchedule{}
+}
+
+func TestAccountScheduleEnforced(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("scheduled"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+
+	// 两小时后开始的每日时间段（UTC）
+	start := time.Now().UTC().Add(2 * time.Hour).Truncate(time.Minute)
+	window := start.Format("15:04") + "-" + start.Add(time.Hour).Format("15:04")
+	if status, body := adminRequest(t, srv.URL, http.MethodPatch, "/auth/accounts/0", `{"schedule":{"timezone":"UTC","windows":["`+window+`"]}}`); status != http.StatusOK {
+		t.Fatalf("PATCH schedule: %d %s", status, body)
+	}
+
+	listed := listedSchedule(t, srv.URL, "scheduled")
+	if listed.InSchedule == nil || *listed.InSchedule || listed.NextAvailableAt != start.Format(time.RFC3339) {
+		t.Fatalf("listed = %+v, want next %s", listed, start.Format(time.RFC3339))
+	}
+
+	resp, raw := postChatJSON(t, srv.URL, keyLimitChat, map[string]string{"Accept-Language": "en"})
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d %s", resp.StatusCode, raw)
+	}
+	if e := decodeChatError(t, raw); !strings.Contains(e.Message, "outside their schedules") || !strings.Contains(e.Message, start.Format(time.RFC3339)) {
+		t.Fatalf("error = %+v", e)
+	}
+	retry, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if until := int(time.Until(start).Seconds()); err != nil || retry < until || retry > until+2 {
+		t.Fatalf("Retry-After = %q, want about %d", resp.Header.Get("Retry-After"), until)
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Fatalf("upstream received %d requests", n)
+	}
+
+	// 清除时间段后恢复可用
+	if status, body := adminRequest(t, srv.URL, http.MethodPatch, "/auth/accounts/0", `{"schedule":{"windows":[]}}`); status != http.StatusOK {
+		t.Fatalf("clear schedule: %d %s", status, body)
+	}
+	if listed := listedSchedule(t, srv.URL, "scheduled"); listed.InSchedule != nil || listed.NextAvailableAt != "" {
+		t.Fatalf("listed after clear = %+v", listed)
+	}
+	if resp, raw := postChatJSON(t, srv.URL, keyLimitChat, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status after clear = %d %s", resp.StatusCode, raw)
+	}
+}
+
+func TestAccountScheduleValidation(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("schedule-invalid"))
+	srv := newTestServer(t)
+
+	for _, body := range []string{
+		`{"schedule":{"windows":["mon 09:00"]}}`,
+		`{"schedule":{"windows":["someday 09:00-10:00"]}}`,
+		`{"schedule":{"timezone":"Nowhere/City","windows":["09:00-10:00"]}}`,
+	} {
+		if status, raw := adminRequest(t, srv.URL, http.MethodPatch, "/auth/accounts/0", body); status != http.StatusBadRequest {
+			t.Fatalf("%s: %d %s", body, status, raw)
+		}
+	}
+	if listed := listedSchedule(t, srv.URL, "schedule-invalid"); listed.InSchedule != nil {
+		t.Fatalf("invalid schedule saved: %+v", listed)
+	}
+}
@@ -0,0 +1,402 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/testutil"
+)
+
+// SDK 兼容性测试：重放从各 SDK 录制的原始请求（testdata/sdk/<sdk>/<case>.http），
+// 经过完整的中间件和处理函数请求模拟上游，按 SDK 解析响应时依赖的结构校验输出。
+// 响应结构以独立的结构体描述（DisallowUnknownFields），转换代码改变了响应形状时对应的 fixture 失败
+
+// sdkExtensions 本服务的扩展字段（SDK 忽略未知字段，这里列出已知的扩展，出现其他新字段时测试失败）
+type sdkExtensions struct {
+	ValidationFailed    json.RawMessage `json:"validation_failed"`
+	Truncated           json.RawMessage `json:"truncated"`
+	ToolCallsIncomplete json.RawMessage `json:"tool_calls_incomplete"`
+	Warnings            json.RawMessage `json:"warnings"`
+	Annotations         json.RawMessage `json:"annotations"`
+	Quarantine          json.RawMessage `json:"quarantine"`
+	ContentDigest       json.RawMessage `json:"content_digest"`
+	Route               json.RawMessage `json:"route"`
+}
+
+// sdkChatCompletion chat.completion / chat.completion.chunk
+type sdkChatCompletion struct {
+	ID                string      `json:"id"`
+	Object            string      `json:"object"`
+	Created           int64       `json:"created"`
+	Model             string      `json:"model"`
+	Choices           []sdkChoice `json:"choices"`
+	Usage             *sdkUsage   `json:"usage"`
+	SystemFingerprint *string     `json:"system_fingerprint"`
+	sdkExtensions
+}
+
+type sdkChoice struct {
+	Index        int             `json:"index"`
+	Message      *sdkMessage     `json:"message"`
+	Delta        *sdkMessage     `json:"delta"`
+	FinishReason *string         `json:"finish_reason"`
+	Logprobs     json.RawMessage `json:"logprobs"`
+}
+
+type sdkMessage struct {
+	Role        string          `json:"role"`
+	Content     *string         `json:"content"`
+	Refusal     *string         `json:"refusal"`
+	ToolCalls   []sdkToolCall   `json:"tool_calls"`
+	Reasoning   json.RawMessage `json:"reasoning"`
+	Annotations json.RawMessage `json:"annotations"`
+}
+
+type sdkToolCall struct {
+	Index    *int   `json:"index"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+	ThoughtSignature json.RawMessage `json:"thought_signature"`
+}
+
+type sdkUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// sdkFinishReasons SDK 接受的 finish_reason
+var sdkFinishReasons = map[string]bool{"stop": true, "length": true, "tool_calls": true, "content_filter": true, "function_call": true}
+
+// sdkFixture 一个录制的请求
+type sdkFixture struct {
+	path   string
+	req    *http.Request
+	body   []byte
+	params struct {
+		Stream        bool              `json:"stream"`
+		Tools         []json.RawMessage `json:"tools"`
+		StreamOptions struct {
+			IncludeUsage bool `json:"include_usage"`
+		} `json:"stream_options"`
+		Messages []struct {
+			Role string `json:"role"`
+		} `json:"messages"`
+	}
+}
+
+func loadSDKFixture(t *testing.T, path string) *sdkFixture {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 录制文件不含 Content-Length，请求头之后的内容都是请求体
+	r := bufio.NewReader(bytes.NewReader(data))
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		t.Fatalf("fixture %s: %v", path, err)
+	}
+	body, _ := io.ReadAll(r)
+	f := &sdkFixture{path: path, req: req, body: bytes.TrimSpace(body)}
+	if err := json.Unmarshal(f.body, &f.params); err != nil {
+		t.Fatalf("fixture %s: invalid body: %v", path, err)
+	}
+	return f
+}
+
+// replay 把录制的请求发送到测试服务器（请求头原样转发）
+func (f *sdkFixture) replay(t *testing.T, srv string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(f.req.Method, srv+f.req.RequestURI, bytes.NewReader(f.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range f.req.Header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("fixture %s: %v", f.path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func (f *sdkFixture) wantsToolCall() bool {
+	return strings.HasPrefix(filepath.Base(f.path), "tools")
+}
+
+// decodeStrict 按 SDK 结构解码，出现未知字段时失败
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func TestSDKFixtures(t *testing.T) {
+	paths, err := filepath.Glob("testdata/sdk/*/*.http")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no SDK fixtures found: %v", err)
+	}
+	testutil.UseAccounts(t, testutil.Account("sdk"))
+	srv := newTestServer(t)
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(strings.TrimPrefix(path, "testdata/sdk/"), ".http")
+		t.Run(name, func(t *testing.T) {
+			f := loadSDKFixture(t, path)
+			reply := testutil.Reply("STOP", testutil.Text("Hello"), testutil.Text(" there"))
+			if f.wantsToolCall() {
+				reply = testutil.Reply("STOP", testutil.FunctionCall("", "get_weather", map[string]interface{}{"city": "Berlin"}))
+			}
+			upstream := testutil.StartUpstream(t, reply)
+
+			resp := f.replay(t, srv.URL)
+			if resp.StatusCode != http.StatusOK {
+				body, _ := io.ReadAll(resp.Body)
+				t.Fatalf("fixture %s: status %d: %s", path, resp.StatusCode, body)
+			}
+			var msg sdkMessage
+			var finish string
+			if f.params.Stream {
+				msg, finish = checkStreamResponse(t, f, resp)
+			} else {
+				msg, finish = checkCompletionResponse(t, f, resp)
+			}
+			checkAssistantMessage(t, f, msg, finish)
+			checkUpstreamRequest(t, f, upstream.Requests())
+		})
+	}
+}
+
+// checkCompletionResponse 校验非流式响应，返回助手消息和 finish_reason
+func checkCompletionResponse(t *testing.T, f *sdkFixture, resp *http.Response) (sdkMessage, string) {
+	t.Helper()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("fixture %s: Content-Type %q", f.path, ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	var c sdkChatCompletion
+	if err := decodeStrict(body, &c); err != nil {
+		t.Fatalf("fixture %s: response does not match the SDK shape: %v\n%s", f.path, err, body)
+	}
+	checkEnvelope(t, f, &c, "chat.completion")
+	if len(c.Choices) != 1 {
+		t.Fatalf("fixture %s: %d choices", f.path, len(c.Choices))
+	}
+	choice := c.Choices[0]
+	if choice.Message == nil {
+		t.Fatalf("fixture %s: choice has no message", f.path)
+	}
+	if choice.FinishReason == nil {
+		t.Fatalf("fixture %s: finish_reason is null", f.path)
+	}
+	checkUsage(t, f, c.Usage)
+	return *choice.Message, *choice.FinishReason
+}
+
+// checkStreamResponse 校验 SSE 响应并像 SDK 一样按 index 累积增量，返回累积的消息和 finish_reason
+func checkStreamResponse(t *testing.T, f *sdkFixture, resp *http.Response) (sdkMessage, string) {
+	t.Helper()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("fixture %s: Content-Type %q", f.path, ct)
+	}
+
+	var msg sdkMessage
+	var content strings.Builder
+	var finish string
+	var id string
+	var last *sdkChatCompletion
+	calls := make(map[int]*sdkToolCall)
+	done := false
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 1<<20), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue
+		}
+		if done {
+			t.Fatalf("fixture %s: data after [DONE]: %s", f.path, line)
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			t.Fatalf("fixture %s: unexpected SSE line %q", f.path, line)
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+
+		var c sdkChatCompletion
+		if err := decodeStrict([]byte(data), &c); err != nil {
+			t.Fatalf("fixture %s: chunk does not match the SDK shape: %v\n%s", f.path, err, data)
+		}
+		checkEnvelope(t, f, &c, "chat.completion.chunk")
+		if id == "" {
+			id = c.ID
+		} else if c.ID != id {
+			t.Errorf("fixture %s: chunk id changed from %s to %s", f.path, id, c.ID)
+		}
+		last = &c
+		for _, choice := range c.Choices {
+			if choice.FinishReason != nil {
+				if finish != "" {
+					t.Errorf("fixture %s: more than one finish_reason", f.path)
+				}
+				finish = *choice.FinishReason
+			}
+			if choice.Delta == nil {
+				t.Fatalf("fixture %s: chunk choice has no delta", f.path)
+			}
+			if choice.Delta.Role != "" {
+				msg.Role = choice.Delta.Role
+			}
+			if choice.Delta.Content != nil {
+				content.WriteString(*choice.Delta.Content)
+			}
+			for _, d := range choice.Delta.ToolCalls {
+				// SDK 的流式累积按 index 合并工具调用片段
+				if d.Index == nil {
+					t.Fatalf("fixture %s: streamed tool call without index", f.path)
+				}
+				call, ok := calls[*d.Index]
+				if !ok {
+					call = &sdkToolCall{}
+					calls[*d.Index] = call
+				}
+				if d.ID != "" {
+					call.ID = d.ID
+				}
+				if d.Type != "" {
+					call.Type = d.Type
+				}
+				call.Function.Name += d.Function.Name
+				call.Function.Arguments += d.Function.Arguments
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("fixture %s: %v", f.path, err)
+	}
+	if !done {
+		t.Errorf("fixture %s: stream did not end with [DONE]", f.path)
+	}
+	if last == nil {
+		t.Fatalf("fixture %s: no chunks", f.path)
+	}
+	// stream_options.include_usage 时 SDK 从最后一个 chunk 读取用量
+	if f.params.StreamOptions.IncludeUsage {
+		checkUsage(t, f, last.Usage)
+	}
+
+	if content.Len() > 0 {
+		s := content.String()
+		msg.Content = &s
+	}
+	for i := 0; i < len(calls); i++ {
+		call, ok := calls[i]
+		if !ok {
+			t.Fatalf("fixture %s: tool call indexes are not contiguous", f.path)
+		}
+		msg.ToolCalls = append(msg.ToolCalls, *call)
+	}
+	return msg, finish
+}
+
+func checkEnvelope(t *testing.T, f *sdkFixture, c *sdkChatCompletion, object string) {
+	t.Helper()
+	if c.ID == "" || c.Created <= 0 || c.Model == "" {
+		t.Errorf("fixture %s: missing id/created/model: %+v", f.path, c)
+	}
+	if c.Object != object {
+		t.Errorf("fixture %s: object %q, want %q", f.path, c.Object, object)
+	}
+	for _, choice := range c.Choices {
+		if choice.FinishReason != nil && !sdkFinishReasons[*choice.FinishReason] {
+			t.Errorf("fixture %s: finish_reason %q is not accepted by the SDKs", f.path, *choice.FinishReason)
+		}
+	}
+}
+
+func checkUsage(t *testing.T, f *sdkFixture, u *sdkUsage) {
+	t.Helper()
+	if u == nil {
+		t.Errorf("fixture %s: usage missing", f.path)
+		return
+	}
+	if u.TotalTokens != u.PromptTokens+u.CompletionTokens || u.TotalTokens == 0 {
+		t.Errorf("fixture %s: inconsistent usage %+v", f.path, *u)
+	}
+}
+
+// checkAssistantMessage 校验助手消息：文本请求返回上游正文，工具请求返回可解析的工具调用
+func checkAssistantMessage(t *testing.T, f *sdkFixture, msg sdkMessage, finish string) {
+	t.Helper()
+	if msg.Role != "assistant" {
+		t.Errorf("fixture %s: role %q, want assistant", f.path, msg.Role)
+	}
+	if !f.wantsToolCall() {
+		if msg.Content == nil || *msg.Content != "Hello there" {
+			t.Errorf("fixture %s: content %s, want %q", f.path, mustJSON(msg.Content), "Hello there")
+		}
+		if finish != "stop" {
+			t.Errorf("fixture %s: finish_reason %q, want stop", f.path, finish)
+		}
+		return
+	}
+
+	if finish != "tool_calls" {
+		t.Errorf("fixture %s: finish_reason %q, want tool_calls", f.path, finish)
+	}
+	if len(msg.ToolCalls) != 1 {
+		t.Fatalf("fixture %s: %d tool calls, want 1", f.path, len(msg.ToolCalls))
+	}
+	call := msg.ToolCalls[0]
+	if call.ID == "" || call.Type != "function" || call.Function.Name != "get_weather" {
+		t.Errorf("fixture %s: malformed tool call %+v", f.path, call)
+	}
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil || args["city"] != "Berlin" {
+		t.Errorf("fixture %s: arguments %q do not parse as the call's JSON object", f.path, call.Function.Arguments)
+	}
+}
+
+// checkUpstreamRequest 校验转换后的上游请求保留了工具定义、工具结果和图片
+func checkUpstreamRequest(t *testing.T, f *sdkFixture, requests []testutil.Request) {
+	t.Helper()
+	if len(requests) != 1 {
+		t.Fatalf("fixture %s: upstream received %d requests", f.path, len(requests))
+	}
+	body := string(requests[0].Body)
+	if len(f.params.Tools) > 0 && !strings.Contains(body, `"functionDeclarations"`) {
+		t.Errorf("fixture %s: tools were not forwarded upstream", f.path)
+	}
+	for _, m := range f.params.Messages {
+		if m.Role == "tool" && !strings.Contains(body, `"functionResponse"`) {
+			t.Errorf("fixture %s: tool results were not forwarded upstream", f.path)
+			break
+		}
+	}
+	if strings.Contains(string(f.body), "data:image/png;base64,") && !strings.Contains(body, `"inlineData"`) {
+		t.Errorf("fixture %s: image was not forwarded upstream as inlineData", f.path)
+	}
+}
+
+func mustJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -1,23 +1,37 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"anti2api-golang/internal/api"
+	"anti2api-golang/internal/capability"
+	"anti2api-golang/internal/chaos"
 	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/converter"
 	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/notify"
+	"anti2api-golang/internal/persist"
+	"anti2api-golang/internal/server/handlers"
 	"anti2api-golang/internal/store"
+	"anti2api-golang/internal/tracing"
+	"anti2api-golang/internal/version"
 )
 
 // Server HTTP 服务器
 type Server struct {
 	httpServer *http.Server
+	router     *Router
 	config     *config.Config
+	components *Registry
 }
 
 // New 创建新服务器
@@ -25,20 +39,25 @@ func New() *Server {
 	cfg := config.Get()
 
 	mux := http.NewServeMux()
-	SetupRoutes(mux)
+	components := NewRegistry()
+	registerComponents(components)
+	router := SetupRoutes(mux, components)
 
 	// 应用中间件
-	handler := RequestLogger(CORS(mux))
+	handler := StreamWriteDeadline(time.Duration(cfg.StreamWriteTimeout)*time.Second, RealIP(RequestLogger(handlers.Localize(handlers.Recover(CORS(mux))))))
 
+	// ReadTimeout 覆盖请求头和请求体，请求体读完后 net/http 会清除读超时，不影响耗时较长的响应
 	return &Server{
 		httpServer: &http.Server{
-			Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-			Handler:      handler,
-			ReadTimeout:  time.Duration(cfg.Timeout) * time.Millisecond,
-			WriteTimeout: time.Duration(cfg.Timeout) * time.Millisecond,
-			IdleTimeout:  120 * time.Second,
+			Handler:           handler,
+			ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout) * time.Second,
+			ReadTimeout:       time.Duration(cfg.ReadTimeout) * time.Second,
+			WriteTimeout:      cfg.EffectiveWriteTimeout(),
+			IdleTimeout:       time.Duration(cfg.IdleTimeout) * time.Second,
 		},
-		config: cfg,
+		router:     router,
+		config:     cfg,
+		components: components,
 	}
 }
 
@@ -47,20 +66,34 @@ func (s *Server) Start() error {
 	// 初始化日志
 	logger.Init()
 
-	// 加载账号
-	store.GetAccountStore()
+	if chaos.Get().Enabled() {
+		logger.Warn("Chaos fault injection is enabled (CHAOS_ENABLED=true), do not use in production")
+	}
+
+	// 按依赖顺序启动后台组件（加载数据文件、后台任务）
+	if err := s.components.StartAll(context.Background()); err != nil {
+		return err
+	}
 
 	// 打印启动横幅
 	logger.Banner(s.config.Port, s.config.EndpointMode)
+	logger.Info("Build: %s", version.Get())
 
-	// 启动服务器
-	go func() {
-		logger.Info("Server listening on %s", s.httpServer.Addr)
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Error("Server error: %v", err)
-			os.Exit(1)
+	// 启动服务器（每个监听地址一个 listener，共用同一个 http.Server）
+	for _, addr := range s.config.ListenAddrs() {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("listen on %s: %w", addr, err)
 		}
-	}()
+		logger.Info("Server listening on %s", listener.Addr())
+
+		go func() {
+			if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+				logger.Error("Server error: %v", err)
+				os.Exit(1)
+			}
+		}()
+	}
 
 	// 等待中断信号
 	return s.waitForShutdown()
@@ -82,6 +115,198 @@ func (s *Server) waitForShutdown() error {
 		return err
 	}
 
+	// 逆序停止后台组件（写入待处理的日志、保存数据文件）
+	if err := s.components.StopAll(ctx); err != nil {
+		logger.Warn("Some components did not stop cleanly: %v", err)
+	}
+
 	logger.Info("Server stopped")
 	return nil
 }
+
+// registerComponents 注册后台组件：数据文件在启动时加载（损坏时从 .bak 恢复）并注册到备份，关闭时保存
+func registerComponents(reg *Registry) {
+	// 最先启动、最后停止，其他组件停止时产生的 span 也能导出
+	reg.Register(Component{
+		Name: "tracing",
+		Stop: func(ctx context.Context) error {
+			tracing.Shutdown(ctx)
+			return nil
+		},
+	})
+	reg.Register(Component{
+		Name: "settings",
+		Start: func(ctx context.Context) error {
+			store.GetTenantStore()
+			store.GetKeyLimitStore()
+			converter.ModelConfigEntries()
+			epMgr := config.GetEndpointManager()
+			persist.Register(persist.File{
+				Name:   "settings.json",
+				Path:   epMgr.SettingsPath(),
+				Reload: epMgr.ReloadSettings,
+			})
+			return nil
+		},
+	})
+	reg.Register(Component{
+		Name: "accounts",
+		Start: func(ctx context.Context) error {
+			store.GetAccountStore()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return store.GetAccountStore().Save()
+		},
+	})
+	// 后台提前刷新即将过期的 Token（先于账号存储停止，停止前等待正在进行的刷新）
+	reg.Register(Component{
+		Name:      "token-refresh",
+		DependsOn: []string{"accounts"},
+		Start: func(ctx context.Context) error {
+			store.StartTokenRefresher()
+			return nil
+		},
+		Stop: store.StopTokenRefresher,
+	})
+	// 定期探测模型能力（停止时中止进行中的探测）
+	reg.Register(Component{
+		Name:      "capability-probe",
+		DependsOn: []string{"accounts"},
+		Start: func(ctx context.Context) error {
+			capability.Start()
+			return nil
+		},
+		Stop: capability.Stop,
+	})
+	reg.Register(Component{
+		Name: "usage",
+		Start: func(ctx context.Context) error {
+			store.GetUsageLedger()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return store.GetUsageLedger().Flush()
+		},
+	})
+	// 日志写入时更新用量台账，先写完待处理的日志再保存台账
+	reg.Register(Component{
+		Name:      "logs",
+		DependsOn: []string{"usage", "accounts"},
+		Start: func(ctx context.Context) error {
+			store.GetLogStore()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return store.GetLogStore().Drain(ctx)
+		},
+		Timeout: 30 * time.Second,
+	})
+	// 保存的聊天完成（store: true），关闭时写入尚未保存的修改
+	reg.Register(Component{
+		Name: "completions",
+		Start: func(ctx context.Context) error {
+			store.GetCompletionStore()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return store.GetCompletionStore().Close(ctx)
+		},
+	})
+	reg.Register(Component{
+		Name:      "affinity",
+		DependsOn: []string{"accounts"},
+		Start: func(ctx context.Context) error {
+			store.GetConversationMap()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			if !config.Get().AffinityPersist {
+				return nil
+			}
+			return store.GetConversationMap().Save()
+		},
+	})
+	// 恢复延迟重试队列，关闭时等待进行中的重试结束后保存
+	reg.Register(Component{
+		Name:      "deferred",
+		DependsOn: []string{"accounts", "logs"},
+		Start: func(ctx context.Context) error {
+			store.GetDeferredStore()
+			handlers.StartDeferredWorker()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			err := handlers.StopDeferredWorker(ctx)
+			store.GetDeferredStore().Save()
+			return err
+		},
+		Timeout: 30 * time.Second,
+	})
+	// 错误预算触发的端点自动切换：发送 Webhook、记录审计日志，降级期间探测原端点
+	reg.Register(Component{
+		Name:      "endpoint-failover",
+		DependsOn: []string{"settings"},
+		Start: func(ctx context.Context) error {
+			config.SetEndpointEventHook(func(event config.EndpointEvent) {
+				logger.Warn("%s", event.Message())
+				notify.Fire(event.Type, event.Message(), map[string]interface{}{
+					"from":     event.From,
+					"to":       event.To,
+					"requests": event.Requests,
+					"errors":   event.Errors,
+				})
+				store.GetAuditLog().Record(store.AuditEntry{
+					Event:     event.Type,
+					Principal: "system",
+					Endpoint:  event.To,
+					Detail:    event.Message(),
+				})
+			})
+			api.StartEndpointProbation()
+			return nil
+		},
+		Stop: api.StopEndpointProbation,
+	})
+	// 运行时采样和流式输出看门狗
+	reg.Register(Component{
+		Name: "monitor",
+		Start: func(ctx context.Context) error {
+			monitor.Start()
+			return nil
+		},
+		Stop: monitor.Stop,
+	})
+	// 错误率告警
+	reg.Register(Component{
+		Name:      "error-alerts",
+		DependsOn: []string{"logs"},
+		Start: func(ctx context.Context) error {
+			notify.StartErrorRateMonitor(func(windowMinutes int) (int, int) {
+				total, failed := 0, 0
+				for _, stats := range store.GetLogStore().GetUsageStats(context.Background(), windowMinutes) {
+					total += stats.Count
+					failed += stats.Failed
+				}
+				return total, failed
+			})
+			return nil
+		},
+		Stop: notify.StopErrorRateMonitor,
+	})
+	// 定时用量报表（覆盖上一个间隔涉及的日期，按天和模型汇总）
+	reg.Register(Component{
+		Name:      "usage-report",
+		DependsOn: []string{"usage"},
+		Start: func(ctx context.Context) error {
+			notify.StartUsageReport(func(from, to time.Time) ([]byte, error) {
+				var buf bytes.Buffer
+				rows := store.GetUsageLedger().Range(from.Format("2006-01-02"), to.Format("2006-01-02"))
+				err := store.WriteUsageCSV(&buf, rows, []string{"model"})
+				return buf.Bytes(), err
+			})
+			return nil
+		},
+		Stop: notify.StopUsageReport,
+	})
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"anti2api-golang/internal/config"
+)
+
+// settingsResult PUT /admin/settings 的响应
+type settingsResult struct {
+	Success bool                  `json:"success"`
+	DryRun  bool                  `json:"dryRun"`
+	Message string                `json:"message"`
+	Errors  []config.SettingError `json:"errors"`
+	Diff    []config.SettingDiff  `json:"diff"`
+}
+
+// useEndpointSettings 测试结束时恢复端点模式、权重和上游请求头
+func useEndpointSettings(t *testing.T) {
+	t.Helper()
+	m := config.GetEndpointManager()
+	mode, weights := m.GetMode(), m.GetWeights()
+	headers, endpointHeaders := m.GetHeaders()
+	t.Cleanup(func() {
+		change := config.SettingsChange{Mode: &mode, Headers: &headers, EndpointHeaders: &endpointHeaders}
+		if len(weights) > 0 {
+			change.Weights = weights
+		}
+		if _, err := m.ApplySettings(change, false); err != nil {
+			t.Errorf("restore endpoint settings: %v", err)
+		}
+	})
+}
+
+// putSettings 以 admin 身份提交设置事务
+func putSettings(t *testing.T, url, body string) (int, settingsResult) {
+	t.Helper()
+	status, data := adminRequest(t, url, http.MethodPut, "/admin/settings", body)
+	var result settingsResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	return status, result
+}
+
+func settingErrorKeys(errs []config.SettingError) []string {
+	keys := make([]string, len(errs))
+	for i, e := range errs {
+		keys[i] = e.Key
+	}
+	return keys
+}
+
+func TestSettingsTransactionRejected(t *testing.T) {
+	useEndpointSettings(t)
+	srv := newTestServer(t)
+	m := config.GetEndpointManager()
+	mode := m.GetMode()
+	headers, _ := m.GetHeaders()
+
+	for _, tc := range []struct {
+		name string
+		body string
+		keys []string
+	}{
+		{
+			// 一组相关设置中任何一项无效，整个事务都不应用
+			name: "cross-field",
+			body: `{"settings":{"ENDPOINT_MODE":"weighted","ENDPOINT_WEIGHTS":{"daily":0},"UPSTREAM_HEADERS":{"X-Valid":"1"}}}`,
+			keys: []string{config.SettingEndpointMode, config.SettingEndpointWeights},
+		},
+		{
+			name: "valid mode with invalid headers",
+			body: `{"settings":{"ENDPOINT_MODE":"autopush","UPSTREAM_HEADERS":{"X Bad":"1"}}}`,
+			keys: []string{config.SettingUpstreamHeaders},
+		},
+		{
+			name: "unknown endpoint header target",
+			body: `{"settings":{"ENDPOINT_MODE":"autopush","UPSTREAM_ENDPOINT_HEADERS":{"staging":{"X-A":"1"}}}}`,
+			keys: []string{config.SettingEndpointHeaders},
+		},
+		{
+			// 类型错误、非运行时设置和无效日志级别与其他校验错误一起返回
+			name: "decode and runtime errors",
+			body: `{"settings":{"ENDPOINT_MODE":"autopush","ENDPOINT_WEIGHTS":"heavy","PORT":9000,"DEBUG":"loud"}}`,
+			keys: []string{"DEBUG", config.SettingEndpointWeights, "PORT"},
+		},
+		{
+			name: "auto failover not configured",
+			body: `{"settings":{"ENDPOINT_MODE":"autopush","ENDPOINT_AUTO_FAILOVER":true}}`,
+			keys: []string{config.SettingAutoFailover},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, result := putSettings(t, srv.URL, tc.body)
+			if status != http.StatusBadRequest || result.Success || result.Message == "" {
+				t.Fatalf("status %d, result %+v, want 400", status, result)
+			}
+			if got := settingErrorKeys(result.Errors); !reflect.DeepEqual(got, tc.keys) {
+				t.Errorf("error keys = %v (%+v), want %v", got, result.Errors, tc.keys)
+			}
+			current, _ := m.GetHeaders()
+			if m.GetMode() != mode || !reflect.DeepEqual(current, headers) {
+				t.Errorf("settings changed by a rejected transaction: mode %s, headers %v", m.GetMode(), current)
+			}
+
+			// dry run 返回同样的校验结果（状态码 200）
+			status, result = putSettings(t, srv.URL, tc.body[:len(tc.body)-1]+`,"dry_run":true}`)
+			if status != http.StatusOK || result.Success || !result.DryRun || !reflect.DeepEqual(settingErrorKeys(result.Errors), tc.keys) {
+				t.Errorf("dry run: status %d, result %+v", status, result)
+			}
+		})
+	}
+}
+
+func TestSettingsTransactionApplied(t *testing.T) {
+	useEndpointSettings(t)
+	srv := newTestServer(t)
+	m := config.GetEndpointManager()
+	if m.GetMode() == "autopush" {
+		t.Skip("endpoint mode already autopush")
+	}
+
+	status, preview := putSettings(t, srv.URL, `{"settings":{"ENDPOINT_MODE":"autopush","UPSTREAM_HEADERS":{"X-Settings-Test":"1"}},"dry_run":true}`)
+	if status != http.StatusOK || !preview.Success || !preview.DryRun {
+		t.Fatalf("dry run: status %d, result %+v", status, preview)
+	}
+	if m.GetMode() == "autopush" {
+		t.Fatal("dry run applied the mode")
+	}
+	want := []string{config.SettingEndpointMode, config.SettingUpstreamHeaders}
+	if got := diffKeysOf(preview.Diff); !reflect.DeepEqual(got, want) {
+		t.Errorf("dry run diff = %+v, want keys %v", preview.Diff, want)
+	}
+
+	status, result := putSettings(t, srv.URL, `{"settings":{"ENDPOINT_MODE":"autopush","UPSTREAM_HEADERS":{"X-Settings-Test":"1"}}}`)
+	if status != http.StatusOK || !result.Success || result.DryRun {
+		t.Fatalf("apply: status %d, result %+v", status, result)
+	}
+	if !reflect.DeepEqual(diffKeysOf(result.Diff), want) {
+		t.Errorf("applied diff = %+v, want keys %v", result.Diff, want)
+	}
+	headers, _ := m.GetHeaders()
+	if m.GetMode() != "autopush" || headers["X-Settings-Test"] != "1" {
+		t.Errorf("mode %s, headers %v after apply", m.GetMode(), headers)
+	}
+
+	// 再次提交相同的值没有变化
+	if status, result := putSettings(t, srv.URL, `{"settings":{"ENDPOINT_MODE":"autopush"}}`); status != http.StatusOK || len(result.Diff) != 0 {
+		t.Errorf("repeat: status %d, diff %+v", status, result.Diff)
+	}
+}
+
+func diffKeysOf(diff []config.SettingDiff) []string {
+	keys := make([]string, len(diff))
+	for i, d := range diff {
+		keys[i] = d.Key
+	}
+	return keys
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"anti2api-golang/internal/testutil"
+)
+
+// upstreamStopSequences 上游请求中的 generationConfig.stopSequences
+func upstreamStopSequences(t *testing.T, body []byte) []string {
+	t.Helper()
+	var req struct {
+		Request struct {
+			GenerationConfig struct {
+				StopSequences []string `json:"stopSequences"`
+			} `json:"generationConfig"`
+		} `json:"request"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+	return req.Request.GenerationConfig.StopSequences
+}
+
+func TestStopStringArrayOrNull(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("stop-shapes"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+
+	// 先取得不带 stop 时的默认停止序列
+	if resp, raw := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d %s", resp.StatusCode, raw)
+	}
+	defaults := upstreamStopSequences(t, upstream.Requests()[0].Body)
+
+	tests := []struct {
+		stop string
+		want []string
+	}{
+		{`"###"`, []string{"###"}},
+		{`["###","<END>"]`, []string{"###", "<END>"}},
+		{`null`, nil},
+	}
+	for i, tt := range tests {
+		body := `{"model":"gemini-2.5-flash","stream":true,"stop":` + tt.stop + `,"messages":[{"role":"user","content":"hi"}]}`
+		if resp, raw := postChatJSON(t, srv.URL, body, nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("stop %s: status = %d %s", tt.stop, resp.StatusCode, raw)
+		}
+		got := upstreamStopSequences(t, upstream.Requests()[i+1].Body)
+		want := append(append([]string{}, defaults...), tt.want...)
+		if len(got) != len(want) {
+			t.Fatalf("stop %s: stopSequences = %q, want %q", tt.stop, got, want)
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("stop %s: stopSequences = %q, want %q", tt.stop, got, want)
+			}
+		}
+	}
+
+	// 其他类型仍然返回 400
+	resp, raw := postChatJSON(t, srv.URL, `{"model":"gemini-2.5-flash","stop":{"seq":"###"},"messages":[{"role":"user","content":"hi"}]}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("object stop: status = %d %s", resp.StatusCode, raw)
+	}
+	if n := len(upstream.Requests()); n != len(tests)+1 {
+		t.Fatalf("upstream received %d requests", n)
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/testutil"
+)
+
+// updateGolden 用当前输出重写 testdata/stream 下的期望结果
+var updateGolden = flag.Bool("update", false, "rewrite golden stream files")
+
+// streamGoldenCases 流式响应的期望输出录制自拆分出 pipeline.Orchestrator 之前的 handleStreamRequest，
+// 之后只随有意的格式变化更新（工具调用增量带 index、结束 chunk 的 content_digest、按状态码确定的错误类型）
+var streamGoldenCases = []struct {
+	name     string
+	upstream http.HandlerFunc
+}{
+	{"text", testutil.Reply("STOP", testutil.Text("Hello"), testutil.Text(", world"))},
+	{"thinking", testutil.Reply("STOP", testutil.Thought("Considering the question"), testutil.Thought(" carefully"), testutil.Text("The answer is 42"))},
+	{"tool_call", testutil.Reply("STOP", testutil.Text("Checking"), testutil.FunctionCall("call_weather", "get_weather", map[string]interface{}{"city": "Paris"}))},
+	{"error", testutil.JSONHandler(http.StatusBadRequest, `{"error":{"code":400,"message":"Invalid argument","status":"INVALID_ARGUMENT"}}`)},
+}
+
+var (
+	goldenID      = regexp.MustCompile(`"id":"chatcmpl-[^"]*"`)
+	goldenCreated = regexp.MustCompile(`"created":\d+`)
+)
+
+// normalizeStream 替换每次请求不同的 id 和 created
+func normalizeStream(body []byte) []byte {
+	body = goldenID.ReplaceAll(body, []byte(`"id":"chatcmpl-golden"`))
+	return goldenCreated.ReplaceAll(body, []byte(`"created":0`))
+}
+
+func TestStreamGolden(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("golden"))
+	srv := newTestServer(t)
+
+	for _, tc := range streamGoldenCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.StartUpstream(t, tc.upstream)
+
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v1/chat/completions", strings.NewReader(
+				`{"model":"gemini-2.5-flash","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+			req.Header.Set("Authorization", "Bearer "+testAPIKey)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := normalizeStream(body)
+
+			path := filepath.Join("testdata", "stream", tc.name+".sse")
+			if *updateGolden {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("stream differs from %s\n got:\n%s\nwant:\n%s", path, got, want)
+			}
+		})
+	}
+}
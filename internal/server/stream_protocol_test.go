@@ -0,0 +1,224 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/testutil"
+)
+
+const streamRequestBody = `{"model":"gemini-2.5-flash","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+
+// heldStream 输出第一段正文后等待 release 关闭再结束的上游。客户端收到第一段后关闭 release，
+// 响应被整体缓冲时上游等到超时才结束，released 收到 false
+func heldStream(release <-chan struct{}, released chan<- bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		testutil.SSE(w, testutil.Chunk("", testutil.Text("first")))
+		select {
+		case <-release:
+			released <- true
+		case <-time.After(2 * time.Second):
+			released <- false
+		}
+		for _, c := range []string{testutil.Chunk("", testutil.Text(" second")), testutil.Chunk("STOP")} {
+			io.WriteString(w, "data: "+c+"\n\n")
+		}
+	}
+}
+
+// streamProtocol 一种客户端协议：send 发出流式请求并返回响应
+type streamProtocol struct {
+	name  string
+	proto string
+	send  func(t *testing.T) *http.Response
+}
+
+func streamRequest(t *testing.T, url string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, url+"/v1/chat/completions", strings.NewReader(streamRequestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// streamProtocols HTTP/2、HTTP/1.1 与 HTTP/1.0 客户端。
+// 服务器不接受 h2c（Go 1.22 标准库只在 TLS 上协商 HTTP/2），HTTP/2 经 TLS 测试，服务端使用相同的 HTTP/2 响应写入
+func streamProtocols(t *testing.T) []streamProtocol {
+	handler := New().httpServer.Handler
+
+	h2 := httptest.NewUnstartedServer(handler)
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	t.Cleanup(h2.Close)
+
+	h1 := httptest.NewServer(handler)
+	t.Cleanup(h1.Close)
+
+	return []streamProtocol{
+		{"http2", "HTTP/2.0", func(t *testing.T) *http.Response {
+			resp, err := h2.Client().Do(streamRequest(t, h2.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resp
+		}},
+		{"http1.1", "HTTP/1.1", func(t *testing.T) *http.Response {
+			resp, err := h1.Client().Do(streamRequest(t, h1.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resp
+		}},
+		{"http1.0", "HTTP/1.0", func(t *testing.T) *http.Response {
+			// http.Client 总是发送 HTTP/1.1，HTTP/1.0 请求直接写入连接
+			conn, err := net.Dial("tcp", h1.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { conn.Close() })
+			fmt.Fprintf(conn, "POST /v1/chat/completions HTTP/1.0\r\nHost: %s\r\nAuthorization: Bearer %s\r\n"+
+				"Content-Type: application/json\r\nContent-Length: %d\r\n\r\n%s",
+				h1.Listener.Addr(), testAPIKey, len(streamRequestBody), streamRequestBody)
+			req := streamRequest(t, h1.URL)
+			resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resp
+		}},
+	}
+}
+
+// streamContents 读取 SSE 事件，读到含 first 的正文后关闭 release，返回全部正文和是否收到 [DONE]
+func streamContents(t *testing.T, body io.Reader, release chan struct{}) (string, bool) {
+	t.Helper()
+	var content strings.Builder
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			return content.String(), true
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", data, err)
+		}
+		for _, c := range chunk.Choices {
+			content.WriteString(c.Delta.Content)
+			if c.Delta.Content == "first" {
+				close(release)
+			}
+		}
+	}
+	return content.String(), false
+}
+
+func TestStreamProtocols(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("proto"))
+
+	for _, p := range streamProtocols(t) {
+		t.Run(p.name, func(t *testing.T) {
+			release, released := make(chan struct{}), make(chan bool, 1)
+			testutil.StartUpstream(t, heldStream(release, released))
+
+			resp := p.send(t)
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				body, _ := io.ReadAll(resp.Body)
+				t.Fatalf("status %d: %s", resp.StatusCode, body)
+			}
+			if resp.Proto != p.proto {
+				t.Errorf("proto = %s, want %s", resp.Proto, p.proto)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if resp.ContentLength != -1 {
+				t.Errorf("ContentLength = %d, want unknown", resp.ContentLength)
+			}
+
+			switch p.proto {
+			case "HTTP/1.1":
+				if len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+					t.Errorf("Transfer-Encoding = %v, want chunked", resp.TransferEncoding)
+				}
+				if resp.Close {
+					t.Error("HTTP/1.1 stream should keep the connection open")
+				}
+			case "HTTP/1.0":
+				// HTTP/1.0 不支持 chunked，以关闭连接标记响应结束
+				if len(resp.TransferEncoding) != 0 {
+					t.Errorf("Transfer-Encoding = %v, want none", resp.TransferEncoding)
+				}
+				if !resp.Close {
+					t.Error("HTTP/1.0 stream should close the connection")
+				}
+			case "HTTP/2.0":
+				for _, h := range []string{"Connection", "Transfer-Encoding"} {
+					if v := resp.Header.Get(h); v != "" {
+						t.Errorf("HTTP/2 response has connection-specific header %s: %s", h, v)
+					}
+				}
+			}
+
+			content, finished := streamContents(t, resp.Body, release)
+			if content != "first second" || !finished {
+				t.Errorf("content = %q, done = %v", content, finished)
+			}
+			if !<-released {
+				t.Error("first chunk was not delivered before the upstream finished")
+			}
+		})
+	}
+}
+
+// noFlushWriter 不支持逐块刷新的 ResponseWriter（如整体缓冲响应的代理适配层）
+type noFlushWriter struct {
+	header http.Header
+	status int
+	body   strings.Builder
+}
+
+func (w *noFlushWriter) Header() http.Header         { return w.header }
+func (w *noFlushWriter) WriteHeader(status int)      { w.status = status }
+func (w *noFlushWriter) Write(p []byte) (int, error) { return w.body.WriteString(string(p)) }
+
+func TestStreamWithoutFlusherFailsFast(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("proto"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("unused")))
+
+	w := &noFlushWriter{header: http.Header{}}
+	New().httpServer.Handler.ServeHTTP(w, streamRequest(t, "http://example.com"))
+
+	if w.status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400: %s", w.status, w.body.String())
+	}
+	if ct := w.header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want a JSON error", ct)
+	}
+	if strings.Contains(w.body.String(), "data:") {
+		t.Errorf("SSE written to a non-flushing writer: %s", w.body.String())
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Errorf("upstream called %d times before the stream check", n)
+	}
+}
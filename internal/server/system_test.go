@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/testutil"
+)
+
+func TestSystemInContentsAppliesToAllPaths(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("system"))
+	upstream := testutil.StartUpstream(t, testutil.Reply("STOP", testutil.Text("ok")))
+	srv := newTestServer(t)
+
+	// bypass 模型解析为真实模型后使用同一配置
+	enabled := true
+	if err := converter.SetModelConfig("gemini-3-flash", converter.ModelConfig{SystemInContents: &enabled}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { converter.DeleteModelConfig("gemini-3-flash") })
+
+	for _, tc := range []struct {
+		name, model string
+		stream      bool
+	}{
+		{"non-stream", "gemini-3-flash", false},
+		{"stream", "gemini-3-flash", true},
+		{"bypass", "gemini-3-flash-bypass", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			before := len(upstream.Requests())
+			body := fmt.Sprintf(`{"model":%q,"stream":%v,"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}]}`,
+				tc.model, tc.stream)
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+testAPIKey)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d: %s", resp.StatusCode, data)
+			}
+
+			requests := upstream.Requests()
+			if len(requests) != before+1 {
+				t.Fatalf("upstream received %d requests, want 1", len(requests)-before)
+			}
+			var sent struct {
+				Request struct {
+					SystemInstruction json.RawMessage     `json:"systemInstruction"`
+					Contents          []converter.Content `json:"contents"`
+				} `json:"request"`
+			}
+			if err := json.Unmarshal(requests[before].Body, &sent); err != nil {
+				t.Fatal(err)
+			}
+			if sent.Request.SystemInstruction != nil {
+				t.Errorf("systemInstruction sent: %s", sent.Request.SystemInstruction)
+			}
+			parts := sent.Request.Contents[0].Parts
+			if len(parts) != 2 || !strings.HasPrefix(parts[0].Text, "Be brief.") || parts[1].Text != "hi" {
+				t.Errorf("first user parts = %+v, want the system text then the message", parts)
+			}
+		})
+	}
+}
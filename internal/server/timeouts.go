@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// streamDeadlineWriter 流式（SSE）响应不受服务器 WriteTimeout 限制：每次写入前设置写超时，写入后清除，
+// 只有被客户端阻塞的写入会超时（等待上游期间不计时）。非流式响应保持服务器的 WriteTimeout
+type streamDeadlineWriter struct {
+	http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+	checked bool
+	stream  bool
+}
+
+// isStream 首次写入时按 Content-Type 判断是否为流式响应
+func (w *streamDeadlineWriter) isStream() bool {
+	if !w.checked {
+		w.checked = true
+		w.stream = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+	}
+	return w.stream
+}
+
+func (w *streamDeadlineWriter) WriteHeader(code int) {
+	w.isStream()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *streamDeadlineWriter) Write(b []byte) (int, error) {
+	if !w.isStream() {
+		return w.ResponseWriter.Write(b)
+	}
+	w.rc.SetWriteDeadline(w.deadline())
+	defer w.rc.SetWriteDeadline(time.Time{})
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush 实现 http.Flusher 接口，支持流式响应
+func (w *streamDeadlineWriter) Flush() {
+	if w.isStream() {
+		w.rc.SetWriteDeadline(w.deadline())
+		defer w.rc.SetWriteDeadline(time.Time{})
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// deadline 单次写入的截止时间（timeout <= 0 时不限制）
+func (w *streamDeadlineWriter) deadline() time.Time {
+	if w.timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(w.timeout)
+}
+
+// Unwrap 返回底层 ResponseWriter
+func (w *streamDeadlineWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// StreamWriteDeadline 为流式响应按单次写入设置写超时（timeout <= 0 时流式响应不设写超时）
+func StreamWriteDeadline(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &streamDeadlineWriter{ResponseWriter: w, rc: http.NewResponseController(w), timeout: timeout}
+		next.ServeHTTP(sw, r)
+		// 结束响应（最后的 chunk）同样限制写入时间，避免不读取的客户端一直占用连接
+		if sw.stream {
+			sw.rc.SetWriteDeadline(sw.deadline())
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/testutil"
+)
+
+// 测试中的超时按比例缩短：写超时 300ms 相当于生产环境的分钟级，流持续其数倍时间
+const (
+	testReadTimeout  = 300 * time.Millisecond
+	testWriteTimeout = 300 * time.Millisecond
+)
+
+// timeoutServer 启动带读写超时的测试服务器
+func timeoutServer(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Config.ReadHeaderTimeout = testReadTimeout
+	srv.Config.ReadTimeout = testReadTimeout
+	srv.Config.WriteTimeout = testWriteTimeout
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// tickingStream 每隔 interval 输出一个 SSE 事件，共 n 个
+func tickingStream(n int, interval time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < n; i++ {
+			if _, err := fmt.Fprintf(w, "data: %d\n\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			time.Sleep(interval)
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	}
+}
+
+// readEvents 读取 SSE 响应中的 data 行，返回读到的事件和读取错误
+func readEvents(t *testing.T, url string) ([]string, error) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			events = append(events, data)
+		}
+	}
+	return events, scanner.Err()
+}
+
+func TestStreamOutlivesWriteTimeout(t *testing.T) {
+	// 流持续约 5 倍写超时
+	srv := timeoutServer(t, StreamWriteDeadline(time.Minute, tickingStream(10, 150*time.Millisecond)))
+
+	events, err := readEvents(t, srv.URL)
+	if err != nil {
+		t.Fatalf("stream cut: %v (got %d events)", err, len(events))
+	}
+	if len(events) != 11 || events[10] != "[DONE]" {
+		t.Fatalf("events = %v, want 10 ticks and [DONE]", events)
+	}
+}
+
+func TestStreamWithoutDeadlineWrapperIsCut(t *testing.T) {
+	// 对照组：没有按写入设置截止时间时，服务器 WriteTimeout 会切断长流
+	srv := timeoutServer(t, tickingStream(10, 150*time.Millisecond))
+
+	events, _ := readEvents(t, srv.URL)
+	if len(events) == 11 {
+		t.Fatalf("stream survived the server write timeout: %v", events)
+	}
+}
+
+func TestNonStreamKeepsWriteTimeout(t *testing.T) {
+	srv := timeoutServer(t, StreamWriteDeadline(time.Minute, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * testWriteTimeout)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok":true}`)
+	})))
+
+	resp, err := http.Get(srv.URL)
+	if err == nil {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		t.Fatalf("non-stream response past the write timeout delivered: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestStreamWriteBlockedByClientIsCut(t *testing.T) {
+	writeErr := make(chan error, 1)
+	srv := timeoutServer(t, StreamWriteDeadline(200*time.Millisecond, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunk := []byte("data: " + strings.Repeat("x", 64<<10) + "\n\n")
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				writeErr <- err
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	})))
+
+	// 客户端发出请求后不再读取响应
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n")
+
+	select {
+	case err := <-writeErr:
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("write error = %v, want timeout", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("write to a stalled client never timed out")
+	}
+}
+
+func TestStalledRequestBodyCutAtReadTimeout(t *testing.T) {
+	readErr := make(chan error, 1)
+	srv := timeoutServer(t, StreamWriteDeadline(time.Minute, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		readErr <- err
+	})))
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// 声明 100 字节的请求体，只发送 10 字节后停住
+	start := time.Now()
+	fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: test\r\nContent-Length: 100\r\n\r\n0123456789")
+
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Fatal("stalled body read succeeded")
+		}
+		if elapsed := time.Since(start); elapsed > 5*testReadTimeout {
+			t.Fatalf("body cut after %v, want about %v", elapsed, testReadTimeout)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("stalled request body was never cut")
+	}
+}
+
+func TestSlowHeadersCutAtReadHeaderTimeout(t *testing.T) {
+	called := make(chan struct{}, 1)
+	srv := timeoutServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- struct{}{}
+	}))
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	start := time.Now()
+	// slowloris：只发送部分请求头，之后每隔一段时间追加一个字节
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\n")
+	go func() {
+		for i := 0; i < 20; i++ {
+			time.Sleep(testReadTimeout / 3)
+			if _, err := conn.Write([]byte("X")); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	// 服务器关闭连接（客户端仍在写入时可能表现为 RST），而不是等到客户端读超时
+	if _, err := io.ReadAll(conn); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			t.Fatalf("connection not closed by server: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 5*testReadTimeout {
+		t.Fatalf("slow headers cut after %v, want about %v", elapsed, testReadTimeout)
+	}
+	select {
+	case <-called:
+		t.Fatal("handler called for incomplete headers")
+	default:
+	}
+}
+
+func TestLongChatStreamOutlivesWriteTimeout(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("long-stream"))
+	const ticks = 8
+	testutil.StartUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < ticks; i++ {
+			io.WriteString(w, "data: "+testutil.Chunk("", testutil.Text(fmt.Sprintf("tick%d ", i)))+"\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(testWriteTimeout / 2)
+		}
+		io.WriteString(w, "data: "+testutil.Chunk("STOP")+"\n\n")
+	})
+	srv := timeoutServer(t, New().httpServer.Handler)
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(streamRequest(t, srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("stream cut after %v: %v", time.Since(start), err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*testWriteTimeout {
+		t.Fatalf("stream took %v, want several write timeouts", elapsed)
+	}
+	for i := 0; i < ticks; i++ {
+		if !strings.Contains(string(body), fmt.Sprintf("tick%d", i)) {
+			t.Fatalf("tick%d missing from stream:\n%s", i, body)
+		}
+	}
+	if !strings.Contains(string(body), `"finish_reason":"stop"`) || !strings.Contains(string(body), "[DONE]") {
+		t.Fatalf("stream did not finish:\n%s", body)
+	}
+}
+
+func TestServerTimeoutsFromConfig(t *testing.T) {
+	cfg := config.Get()
+	saved := *cfg
+	t.Cleanup(func() { *cfg = saved })
+
+	cfg.ReadHeaderTimeout, cfg.ReadTimeout, cfg.IdleTimeout = 5, 30, 90
+	cfg.WriteTimeout, cfg.Timeout = 0, 120000
+	s := New().httpServer
+	if s.ReadHeaderTimeout != 5*time.Second || s.ReadTimeout != 30*time.Second || s.IdleTimeout != 90*time.Second {
+		t.Fatalf("read/idle timeouts = %v/%v/%v", s.ReadHeaderTimeout, s.ReadTimeout, s.IdleTimeout)
+	}
+	// 未配置写超时时为上游超时加 30 秒
+	if s.WriteTimeout != 150*time.Second {
+		t.Fatalf("default WriteTimeout = %v, want 150s", s.WriteTimeout)
+	}
+
+	cfg.WriteTimeout = 45
+	if got := New().httpServer.WriteTimeout; got != 45*time.Second {
+		t.Fatalf("WriteTimeout = %v, want 45s", got)
+	}
+}
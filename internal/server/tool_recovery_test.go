@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/testutil"
+)
+
+// recoveryRequest 声明 get_weather 工具的请求
+func recoveryRequest(stream bool) string {
+	return fmt.Sprintf(`{"model":"gemini-2.5-flash","stream":%v,"messages":[{"role":"user","content":"weather?"}],`+
+		`"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}]}`, stream)
+}
+
+// textCallUpstream 把工具调用写在正文中的上游（调用跨多个 chunk）
+var textCallUpstream = testutil.Reply("STOP",
+	testutil.Text("Let me check.\n<tool_"),
+	testutil.Text(`call>{"name": "get_weather", `),
+	testutil.Text(`"arguments": {"city": "Paris"}}</tool_call>`),
+)
+
+func useToolCallRecovery(t *testing.T) {
+	t.Helper()
+	enabled := true
+	if err := converter.SetModelConfig("gemini-2.5-flash", converter.ModelConfig{ToolCallRecovery: &enabled}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { converter.DeleteModelConfig("gemini-2.5-flash") })
+}
+
+func TestToolCallRecoveryStream(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("recovery-stream"))
+	testutil.StartUpstream(t, textCallUpstream)
+	useToolCallRecovery(t)
+	srv := newTestServer(t)
+
+	resp, body := postChatJSON(t, srv.URL, recoveryRequest(true), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	var content strings.Builder
+	var calls []converter.OpenAIToolCall
+	var finish string
+	for _, line := range strings.Split(string(body), "\n") {
+		if !strings.HasPrefix(line, "data: {") {
+			continue
+		}
+		var chunk converter.OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		choice := chunk.Choices[0]
+		content.WriteString(choice.Delta.Content)
+		// 首个增量携带 id 和名称，之后的增量按 index 追加参数
+		for _, tc := range choice.Delta.ToolCalls {
+			if tc.ID != "" {
+				calls = append(calls, tc)
+			} else if len(calls) > 0 {
+				calls[len(calls)-1].Function.Arguments += tc.Function.Arguments
+			}
+		}
+		if choice.FinishReason != nil {
+			finish = *choice.FinishReason
+		}
+	}
+	if strings.TrimSpace(content.String()) != "Let me check." {
+		t.Errorf("content = %q, want the call removed", content.String())
+	}
+	if len(calls) != 1 || calls[0].Function.Name != "get_weather" || calls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("tool calls = %+v", calls)
+	}
+	if finish != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", finish)
+	}
+}
+
+func TestToolCallRecoveryNonStream(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("recovery-json"))
+	testutil.StartUpstream(t, textCallUpstream)
+	srv := newTestServer(t)
+
+	decode := func() converter.Choice {
+		resp, body := postChatJSON(t, srv.URL, recoveryRequest(false), nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d: %s", resp.StatusCode, body)
+		}
+		var completion converter.OpenAIChatCompletion
+		if err := json.Unmarshal(body, &completion); err != nil {
+			t.Fatal(err)
+		}
+		return completion.Choices[0]
+	}
+
+	// 未开启时正文原样返回
+	if choice := decode(); len(choice.Message.ToolCalls) != 0 || *choice.FinishReason != "stop" {
+		t.Errorf("without recovery: %+v", choice)
+	}
+
+	useToolCallRecovery(t)
+	choice := decode()
+	if choice.Message.Content != "Let me check." || len(choice.Message.ToolCalls) != 1 || *choice.FinishReason != "tool_calls" {
+		t.Errorf("with recovery: content=%v calls=%+v finish=%s", choice.Message.Content, choice.Message.ToolCalls, *choice.FinishReason)
+	}
+}
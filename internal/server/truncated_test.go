@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/testutil"
+)
+
+// cutUpstream 输出 chunks 后直接关闭连接（不结束 chunked 编码），模拟上游连接中断
+func cutUpstream(chunks ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		testutil.SSE(w, chunks...)
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			panic(err)
+		}
+		conn.Close()
+	}
+}
+
+// streamChunks 发送流式请求，返回解析后的数据 chunk
+func streamChunks(t *testing.T, url string) []converter.OpenAIStreamChunk {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(streamRequest(t, url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks []converter.OpenAIStreamChunk
+	for _, line := range strings.Split(string(body), "\n") {
+		if !strings.HasPrefix(line, "data: {") {
+			continue
+		}
+		var chunk converter.OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) == 0 {
+		t.Fatalf("no chunks in %s", body)
+	}
+	return chunks
+}
+
+func TestTruncatedStreamReportsError(t *testing.T) {
+	text := testutil.Chunk("", testutil.Text("checking"))
+	call := testutil.Chunk("", testutil.FunctionCall("call-1", "delete_files", map[string]interface{}{"path": "/tmp"}))
+
+	for _, tc := range []struct {
+		name      string
+		handler   http.HandlerFunc
+		toolCalls bool
+	}{
+		{"connection cut after text", cutUpstream(text), false},
+		{"connection cut after tool call", cutUpstream(text, call), true},
+		{"closed without finish", testutil.StreamHandler(text, call), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			id := "truncated-" + strings.ReplaceAll(tc.name, " ", "-")
+			testutil.UseAccounts(t, testutil.Account(id))
+			testutil.StartUpstream(t, tc.handler)
+			srv := newTestServer(t)
+
+			chunks := streamChunks(t, srv.URL)
+			finish := chunks[len(chunks)-1]
+			if reason := finish.Choices[0].FinishReason; reason == nil || *reason != "error" {
+				t.Errorf("finish_reason = %v, want error", reason)
+			}
+			if !finish.Truncated || finish.ToolCallsIncomplete != tc.toolCalls {
+				t.Errorf("truncated = %v, tool_calls_incomplete = %v", finish.Truncated, finish.ToolCallsIncomplete)
+			}
+			// 任何 chunk 都不以 tool_calls 结束，客户端不会执行中断前的调用
+			for _, c := range chunks {
+				if r := c.Choices[0].FinishReason; r != nil && *r == "tool_calls" {
+					t.Errorf("chunk reports finish_reason tool_calls: %+v", c)
+				}
+			}
+
+			entry := logEntryFor(t, id+"@example.com")
+			if entry.Success || entry.Status != http.StatusBadGateway {
+				t.Errorf("log entry success = %v, status = %d, want a 502 failure", entry.Success, entry.Status)
+			}
+		})
+	}
+}
+
+func TestCompletedStreamReportsToolCalls(t *testing.T) {
+	testutil.UseAccounts(t, testutil.Account("truncated-complete"))
+	testutil.StartUpstream(t, testutil.Reply("STOP",
+		testutil.FunctionCall("call-1", "read_file", map[string]interface{}{"path": "a"})))
+	srv := newTestServer(t)
+
+	finish := streamChunks(t, srv.URL)
+	last := finish[len(finish)-1]
+	if reason := last.Choices[0].FinishReason; reason == nil || *reason != "tool_calls" || last.Truncated {
+		t.Errorf("finish = %+v, want tool_calls without the truncated flag", last)
+	}
+	if entry := logEntryFor(t, "truncated-complete@example.com"); !entry.Success {
+		t.Errorf("log entry = %+v, want success", entry)
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"anti2api-golang/internal/version"
+)
+
+func TestVersionEndpoint(t *testing.T) {
+	srv := newTestServer(t)
+
+	// 不需要 API Key，供监控脚本使用
+	resp, err := http.Get(srv.URL + "/api/version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	var got struct {
+		Build   version.Info         `json:"build"`
+		Runtime version.RuntimeStats `json:"runtime"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Build != version.Get() {
+		t.Errorf("build = %+v, want %+v", got.Build, version.Get())
+	}
+	if got.Runtime.Goroutines < 1 || got.Runtime.HeapAlloc == 0 {
+		t.Errorf("runtime = %+v", got.Runtime)
+	}
+}
+
+func TestSettingsIncludeVersion(t *testing.T) {
+	srv := newTestServer(t)
+	status, body := adminRequest(t, srv.URL, http.MethodGet, "/admin/settings", "")
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+	var got struct {
+		Version version.Info `json:"version"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != version.Get() {
+		t.Errorf("version = %+v, want %+v", got.Version, version.Get())
+	}
+}
@@ -1,37 +1,79 @@
 package store
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"anti2api-golang/internal/config"
 	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/notify"
+	"anti2api-golang/internal/persist"
+	"anti2api-golang/internal/tracing"
 	"anti2api-golang/internal/utils"
 )
 
 // Account 账号信息
 type Account struct {
-	AccessToken  string    `json:"access_token"`
-	RefreshToken string    `json:"refresh_token"`
-	ExpiresIn    int       `json:"expires_in"`
-	Timestamp    int64     `json:"timestamp"`
-	ProjectID    string    `json:"projectId,omitempty"`
-	Email        string    `json:"email,omitempty"`
-	Enable       bool      `json:"enable"`
-	CreatedAt    time.Time `json:"created_at"`
-	SessionID    string    `json:"-"` // 运行时生成，不持久化
+	ID             string             `json:"id"`             // 稳定 ID（v1 起）
+	Type           string             `json:"type,omitempty"` // 凭证类型：oauth（默认）、static、service_account
+	AccessToken    string             `json:"access_token"`
+	RefreshToken   string             `json:"refresh_token"`
+	ServiceAccount *ServiceAccountKey `json:"service_account,omitempty"` // 服务账号密钥（service_account 类型）
+	ExpiresIn      int                `json:"expires_in"`
+	Timestamp      int64              `json:"timestamp"`
+	ProjectID      string             `json:"projectId,omitempty"`
+	Email          string             `json:"email,omitempty"`
+	Enable         bool               `json:"enable"`
+	Endpoint       string             `json:"endpoint,omitempty"` // 固定使用的端点（为空则跟随全局端点模式）
+	Note           string             `json:"note,omitempty"`     // 备注（如归属、禁用原因）
+	Labels         map[string]string  `json:"labels,omitempty"`   // 标签
+	Tenant         string             `json:"tenant,omitempty"`   // 所属租户（为空表示不属于任何租户）
+	CreatedAt      time.Time          `json:"created_at"`
+	DrainingSince  *time.Time         `json:"draining_since,omitempty"` // 开始排空的时间（为空表示未排空）
+	Schedule       *AccountSchedule   `json:"schedule,omitempty"`       // 可用时间段（为空表示始终可用）
+	SessionID      string             `json:"-"`                        // 运行时生成，不持久化
+	Passthrough    bool               `json:"-"`                        // 客户端透传的临时凭证（不在账号存储中）
+	CooldownUntil  time.Time          `json:"-"`                        // 上游拒绝后暂停选用的截止时间（运行时）
+	CooldownReason string             `json:"-"`                        // 暂停选用的原因（见 CooldownRateLimited 等）
+
+	// 最近一次 Token 刷新（运行时，不持久化；被退避或限流跳过的不算）
+	LastRefreshAt    time.Time `json:"-"`
+	LastRefreshError string    `json:"-"` // 为空表示成功
+
+	// 会话轮换状态（运行时，不持久化）
+	SessionStartedAt    time.Time `json:"-"`
+	SessionRequests     int       `json:"-"` // 当前会话已处理的请求数
+	SessionRotations    int       `json:"-"` // 启动以来的轮换次数
+	SessionRotateReason string    `json:"-"` // 最近一次轮换的原因
 }
 
+// 备注与标签长度限制
+const (
+	MaxNoteLength       = 500
+	MaxLabels           = 10
+	MaxLabelKeyLength   = 32
+	MaxLabelValueLength = 64
+)
+
+// ErrTokenRevoked refresh_token 已被撤销（invalid_grant）
+var ErrTokenRevoked = errors.New("refresh token revoked")
+
 // AccountStore 账号存储
 type AccountStore struct {
 	mu           sync.RWMutex
 	accounts     []Account
 	currentIndex int
 	filePath     string
+	loadErr      error // 加载失败原因（此时拒绝写回文件）
 }
 
 var (
@@ -47,6 +89,12 @@ func GetAccountStore() *AccountStore {
 			filePath: filepath.Join(cfg.DataDir, "accounts.json"),
 		}
 		accountStore.Load()
+		persist.Register(persist.File{
+			Name:   "accounts.json",
+			Path:   accountStore.filePath,
+			Flush:  accountStore.Save,
+			Reload: accountStore.Load,
+		})
 	})
 	return accountStore
 }
@@ -62,23 +110,66 @@ func (s *AccountStore) Load() error {
 		return err
 	}
 
-	data, err := os.ReadFile(s.filePath)
+	// 文件损坏（被截断、无法解析）时回退到上一代 .bak
+	data, err := persist.ReadFile(s.filePath, persist.ValidJSON)
 	if err != nil {
 		if os.IsNotExist(err) {
 			s.accounts = []Account{}
+			s.loadErr = nil
 			return nil
 		}
+		// 文件与备份都不可用时同样拒绝覆盖
+		s.accounts = []Account{}
+		s.loadErr = err
+		logger.Error("Failed to load %s: %v", s.filePath, err)
 		return err
 	}
+	s.loadErr = nil
 
-	if err := json.Unmarshal(data, &s.accounts); err != nil {
+	migrated, from, err := migrateAccountFile(data)
+	if err != nil {
+		// 无法识别的文件不能被覆盖
 		s.accounts = []Account{}
+		s.loadErr = err
+		logger.Error("Failed to load %s: %v", s.filePath, err)
 		return err
 	}
 
-	// 为每个账号生成 SessionID
+	var file accountFile
+	if err := json.Unmarshal(migrated, &file); err != nil {
+		s.accounts = []Account{}
+		s.loadErr = err
+		logger.Error("Failed to load %s: %v", s.filePath, err)
+		return err
+	}
+	s.accounts = file.Accounts
+	if s.accounts == nil {
+		s.accounts = []Account{}
+	}
+
+	// 迁移前备份原文件，再写入新格式
+	if from != AccountFileVersion {
+		backup := fmt.Sprintf("%s.v%d.bak", s.filePath, from)
+		if err := os.WriteFile(backup, data, 0600); err != nil {
+			return fmt.Errorf("backup accounts file before migration: %w", err)
+		}
+		if err := s.saveUnlocked(); err != nil {
+			return err
+		}
+		logger.Info("Migrated %s from v%d to v%d (backup: %s)", s.filePath, from, AccountFileVersion, backup)
+	}
+
+	// 为每个账号生成 SessionID，补全缺失的 ID（手动编辑的文件）
+	missingID := false
 	for i := range s.accounts {
-		s.accounts[i].SessionID = utils.GenerateSessionID()
+		s.accounts[i].resetSession()
+		if s.accounts[i].ID == "" {
+			s.accounts[i].ID = utils.GenerateAccountID()
+			missingID = true
+		}
+	}
+	if missingID {
+		s.saveUnlocked()
 	}
 
 	logger.Info("Loaded %d accounts", len(s.accounts))
@@ -89,69 +180,251 @@ func (s *AccountStore) Load() error {
 func (s *AccountStore) Save() error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-
-	data, err := json.MarshalIndent(s.accounts, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(s.filePath, data, 0644)
+	return s.saveUnlocked()
 }
 
-// IsExpired 检查 Token 是否过期（提前 5 分钟刷新）
+// IsExpired 检查 Token 是否过期（可刷新的凭证提前 5 分钟刷新；静态令牌未设置过期时间时视为长期有效）
 func (a *Account) IsExpired() bool {
-	if a.Timestamp == 0 || a.ExpiresIn == 0 {
+	expiry := a.tokenExpiry()
+	if a.CredentialType() == CredentialStatic {
+		return !expiry.IsZero() && !time.Now().Before(expiry)
+	}
+	if expiry.IsZero() {
 		return true
 	}
-	expiresAt := a.Timestamp + int64(a.ExpiresIn*1000)
-	return time.Now().UnixMilli() >= expiresAt-300000
+	return !time.Now().Before(expiry.Add(-5 * time.Minute))
+}
+
+// GetToken 获取可用 Token（轮询 + 自动刷新，只选择对请求租户可见的账号）
+func (s *AccountStore) GetToken(ctx context.Context) (*Account, error) {
+	return s.getToken(ctx, "")
 }
 
-// GetToken 获取可用 Token（轮询 + 自动刷新）
-func (s *AccountStore) GetToken() (*Account, error) {
+// GetTokenForEndpoint 获取可在指定端点使用的 Token（未固定端点或固定为该端点的账号）
+func (s *AccountStore) GetTokenForEndpoint(ctx context.Context, endpoint string) (*Account, error) {
+	return s.getToken(ctx, endpoint)
+}
+
+// getToken 轮询获取 Token，endpoint 不为空时只选择兼容该端点的账号。
+// 请求开启了路由记录时记录候选账号的排除原因和会话保持的决定
+func (s *AccountStore) getToken(ctx context.Context, endpoint string) (*Account, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	route := RouteTraceFromContext(ctx).begin(endpoint)
 	if len(s.accounts) == 0 {
-		return nil, errors.New("没有可用的账号")
+		notify.Fire(notify.EventAccountsExhausted, "No accounts configured", nil)
+		err := errors.New("没有可用的账号")
+		route.finish(0, nil, err)
+		return nil, err
 	}
 
-	for attempts := 0; attempts < len(s.accounts); attempts++ {
-		account := &s.accounts[s.currentIndex]
-		s.currentIndex = (s.currentIndex + 1) % len(s.accounts)
+	now := time.Now()
+	compatible := func(account *Account) bool {
+		return endpoint == "" || account.Endpoint == "" || account.Endpoint == endpoint
+	}
+	eligible := func(account *Account) bool {
+		return account.Enable && VisibleTo(ctx, account.Tenant) && compatible(account)
+	}
+	usable := func(account *Account) bool {
+		return eligible(account) && account.InSchedule(now) && !account.InCooldown(now)
+	}
 
-		if !account.Enable {
-			continue
+	// 已绑定的会话继续使用原账号：排空账号在宽限期内保持，开启 CONVERSATION_AFFINITY 时所有账号都保持。
+	// 绑定的账号不可用时解除绑定，按轮询重新分配
+	conversation := conversationFromContext(ctx)
+	affinity := GetConversationMap()
+	if conversation != "" {
+		route.affinity(RouteAffinityUnbound)
+	}
+	if id := affinity.Get(conversation); id != "" {
+		if account := s.pinnedUnlocked(ctx, id, usable); account != nil {
+			affinity.Bind(conversation, account.ID)
+			useSessionUnlocked(ctx, account, true)
+			tracing.FromContext(ctx).SetAttr("account.pinned", true)
+			route.affinity(RouteAffinityPinned)
+			route.finish(s.indexOfUnlocked(account.ID), account, nil)
+			return account, nil
 		}
+		route.affinity(RouteAffinityReleased)
+	}
+
+	// 记录跳过的账号（开启追踪时写入账号选择 span）
+	var skippedUnavailable, skippedSchedule, skippedCooldown, skippedDraining, skippedRefresh int
+	if span := tracing.FromContext(ctx); span != nil {
+		defer func() {
+			span.SetAttr("account.candidates", len(s.accounts))
+			span.SetAttr("account.skipped.unavailable", skippedUnavailable)
+			span.SetAttr("account.skipped.schedule", skippedSchedule)
+			span.SetAttr("account.skipped.cooldown", skippedCooldown)
+			span.SetAttr("account.skipped.draining", skippedDraining)
+			span.SetAttr("account.skipped.refresh", skippedRefresh)
+		}()
+	}
 
-		if account.IsExpired() {
-			if err := s.refreshToken(account); err != nil {
-				logger.Warn("Token refresh failed for %s: %v", account.Email, err)
-				continue
+	var nextActive time.Time
+	for _, i := range s.selectionOrderUnlocked() {
+		account := &s.accounts[i]
+		s.currentIndex = (i + 1) % len(s.accounts)
+
+		if !eligible(account) {
+			skippedUnavailable++
+			// 对请求租户不可见的账号不出现在路由说明中
+			switch {
+			case !VisibleTo(ctx, account.Tenant):
+			case !account.Enable:
+				route.exclude(i, account, RouteExcludedDisabled, time.Time{})
+			default:
+				route.exclude(i, account, RouteExcludedEndpoint, time.Time{})
 			}
-			s.saveUnlocked()
+			continue
+		}
+		// 不在可用时间段内的账号与禁用账号一样跳过，记录最早可用时间
+		if !account.InSchedule(now) {
+			skippedSchedule++
+			next := account.Schedule.NextActive(now)
+			if !next.IsZero() && (nextActive.IsZero() || next.Before(nextActive)) {
+				nextActive = next
+			}
+			route.exclude(i, account, RouteExcludedSchedule, next)
+			continue
+		}
+		// 上游刚拒绝过的账号暂停选用
+		if account.InCooldown(now) {
+			skippedCooldown++
+			route.exclude(i, account, cooldownExclusion(account), account.CooldownUntil)
+			continue
+		}
+		// 排空中的账号不接收新会话
+		if account.IsDraining() {
+			skippedDraining++
+			route.exclude(i, account, RouteExcludedDraining, time.Time{})
+			continue
+		}
+		if !s.ensureFreshUnlocked(ctx, account) {
+			skippedRefresh++
+			route.exclude(i, account, RouteExcludedRefresh, time.Time{})
+			continue
 		}
 
+		affinity.Bind(conversation, account.ID)
+		reserve(ctx, conversation, account.ID)
+		useSessionUnlocked(ctx, account, false)
+		route.finish(i, account, nil)
 		return account, nil
 	}
 
-	return nil, errors.New("没有可用的 token")
+	notify.Fire(notify.EventAccountsExhausted, "All accounts are unavailable", map[string]interface{}{
+		"accounts": len(s.accounts),
+	})
+	if skippedSchedule > 0 && skippedSchedule+skippedUnavailable == len(s.accounts) {
+		// 其余账号都已禁用或不可见，只有等到时间段开始才有账号可用
+		err := &ScheduleError{Next: nextActive}
+		route.finish(0, nil, err)
+		return nil, err
+	}
+	err := errors.New("没有可用的 token")
+	route.finish(0, nil, err)
+	return nil, err
+}
+
+// indexOfUnlocked 按 ID 查找账号的索引，不存在时返回 -1（调用者必须持有锁）
+func (s *AccountStore) indexOfUnlocked(id string) int {
+	for i := range s.accounts {
+		if s.accounts[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// selectionOrderUnlocked 候选账号的尝试顺序：从轮询位置开始依次尝试，
+// healthiest 策略按健康分从高到低排列（同分时保持轮询顺序，调用者必须持有锁）
+func (s *AccountStore) selectionOrderUnlocked() []int {
+	order := make([]int, len(s.accounts))
+	for n := range order {
+		order[n] = (s.currentIndex + n) % len(s.accounts)
+	}
+	if config.Get().SelectionStrategy != StrategyHealthiest {
+		return order
+	}
+
+	health := GetHealthTracker()
+	scores := make([]float64, len(s.accounts))
+	for i := range s.accounts {
+		scores[i] = health.Score(&s.accounts[i])
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	return order
+}
+
+// pinnedUnlocked 返回会话绑定的账号，不应保持或不可用时返回 nil（不可用时解除绑定，调用者必须持有锁）
+func (s *AccountStore) pinnedUnlocked(ctx context.Context, id string, usable func(*Account) bool) *Account {
+	var account *Account
+	for i := range s.accounts {
+		if s.accounts[i].ID == id {
+			account = &s.accounts[i]
+			break
+		}
+	}
+	if account == nil {
+		GetConversationMap().Invalidate(conversationFromContext(ctx), UnbindUnhealthy)
+		return nil
+	}
+
+	if !account.keepsConversations() {
+		return nil
+	}
+	if !usable(account) || !s.ensureFreshUnlocked(ctx, account) {
+		GetConversationMap().Invalidate(conversationFromContext(ctx), UnbindUnhealthy)
+		return nil
+	}
+	return account
+}
+
+// ensureFreshUnlocked 过期时刷新 Token，刷新失败返回 false（refresh_token 被撤销时禁用账号，调用者必须持有锁）
+func (s *AccountStore) ensureFreshUnlocked(ctx context.Context, account *Account) bool {
+	if !account.IsExpired() {
+		return true
+	}
+	if err := s.refreshToken(account); err != nil {
+		logger.Warn("Token refresh failed for %s: %v", account.Email, err)
+		tracing.FromContext(ctx).AddEvent("account.refresh_failed",
+			"account.id", account.ID, "refresh.throttled", errors.Is(err, ErrRefreshThrottled))
+		s.disableOnRefreshErrorUnlocked(account, err)
+		return false
+	}
+	s.saveUnlocked()
+	return true
+}
+
+// disableOnRefreshErrorUnlocked 凭证已失效（refresh_token 被撤销、静态令牌过期）时禁用账号（调用者必须持有锁）
+func (s *AccountStore) disableOnRefreshErrorUnlocked(account *Account, err error) {
+	switch {
+	case errors.Is(err, ErrTokenRevoked):
+		disableWithNote(account, "refresh token revoked (invalid_grant)")
+		s.saveUnlocked()
+	case errors.Is(err, ErrCredentialExpired):
+		disableWithNote(account, "static access token expired")
+		s.saveUnlocked()
+	}
 }
 
 // GetTokenByProjectID 按 ProjectID 获取指定 Token
-func (s *AccountStore) GetTokenByProjectID(projectID string) (*Account, error) {
+func (s *AccountStore) GetTokenByProjectID(ctx context.Context, projectID string) (*Account, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	for i := range s.accounts {
 		account := &s.accounts[i]
-		if account.ProjectID == projectID && account.Enable {
+		if account.ProjectID == projectID && account.Enable && VisibleTo(ctx, account.Tenant) {
 			if account.IsExpired() {
 				if err := s.refreshToken(account); err != nil {
 					return nil, err
 				}
 				s.saveUnlocked()
 			}
+			useSessionUnlocked(ctx, account, false)
 			return account, nil
 		}
 	}
@@ -160,19 +433,20 @@ func (s *AccountStore) GetTokenByProjectID(projectID string) (*Account, error) {
 }
 
 // GetTokenByEmail 按 Email 获取指定 Token
-func (s *AccountStore) GetTokenByEmail(email string) (*Account, error) {
+func (s *AccountStore) GetTokenByEmail(ctx context.Context, email string) (*Account, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	for i := range s.accounts {
 		account := &s.accounts[i]
-		if account.Email == email && account.Enable {
+		if account.Email == email && account.Enable && VisibleTo(ctx, account.Tenant) {
 			if account.IsExpired() {
 				if err := s.refreshToken(account); err != nil {
 					return nil, err
 				}
 				s.saveUnlocked()
 			}
+			useSessionUnlocked(ctx, account, false)
 			return account, nil
 		}
 	}
@@ -181,36 +455,93 @@ func (s *AccountStore) GetTokenByEmail(email string) (*Account, error) {
 }
 
 // refreshToken 刷新 Token（内部方法，需要已持有锁）
+// 所有刷新都经过刷新闸门：全局限流、单账号退避、OAuth 端点异常时全局暂停
 func (s *AccountStore) refreshToken(account *Account) error {
-	// 这里调用 OAuth 刷新逻辑
-	// 实际实现在 auth/oauth.go 中
-	return refreshAccountToken(account)
+	return s.refreshTokenGated(account, false)
+}
+
+// refreshTokenGated 刷新 Token，force 为 true 时忽略单账号退避（手动刷新）
+func (s *AccountStore) refreshTokenGated(account *Account, force bool) error {
+	g := getRefreshGate()
+	if err := g.acquire(account, force); err != nil {
+		return err
+	}
+
+	// 按凭证类型获取新的 access_token（OAuth、服务账号的实现在 auth 包中）
+	err := refreshCredentials(account)
+	g.record(account, err)
+	account.LastRefreshAt = time.Now()
+	account.LastRefreshError = ""
+	if err != nil {
+		account.LastRefreshError = err.Error()
+	}
+	return err
 }
 
 // saveUnlocked 保存（内部方法，不加锁）
 func (s *AccountStore) saveUnlocked() error {
-	data, err := json.MarshalIndent(s.accounts, "", "  ")
+	// 加载失败（如版本过新）时拒绝覆盖原文件
+	if s.loadErr != nil {
+		return fmt.Errorf("accounts file not loaded: %w", s.loadErr)
+	}
+
+	data, err := json.MarshalIndent(accountFile{
+		Version:  AccountFileVersion,
+		Accounts: s.accounts,
+	}, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.filePath, data, 0644)
+	return persist.WriteFile(s.filePath, data, 0644)
 }
 
-// GetAll 获取所有账号
-func (s *AccountStore) GetAll() []Account {
+// IndexedAccount 带全局索引的账号
+type IndexedAccount struct {
+	Index int
+	Account
+}
+
+// GetAll 获取对请求租户可见的账号（Index 为全局索引，用于按索引操作）
+func (s *AccountStore) GetAll(ctx context.Context) []IndexedAccount {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	result := make([]Account, len(s.accounts))
-	copy(result, s.accounts)
+	result := make([]IndexedAccount, 0, len(s.accounts))
+	for i, a := range s.accounts {
+		if VisibleTo(ctx, a.Tenant) {
+			result = append(result, IndexedAccount{Index: i, Account: a})
+		}
+	}
 	return result
 }
 
-// Count 获取账号数量
-func (s *AccountStore) Count() int {
+// Count 获取对请求租户可见的账号数量
+func (s *AccountStore) Count(ctx context.Context) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, a := range s.accounts {
+		if VisibleTo(ctx, a.Tenant) {
+			count++
+		}
+	}
+	return count
+}
+
+// accountAtUnlocked 按索引获取账号（对请求租户不可见时视为不存在）
+func (s *AccountStore) accountAtUnlocked(ctx context.Context, index int) (*Account, error) {
+	if index < 0 || index >= len(s.accounts) || !VisibleTo(ctx, s.accounts[index].Tenant) {
+		return nil, errors.New("索引超出范围")
+	}
+	return &s.accounts[index], nil
+}
+
+// LoadError accounts.json 加载失败的原因（加载成功时为 nil）
+func (s *AccountStore) LoadError() error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return len(s.accounts)
+	return s.loadErr
 }
 
 // EnabledCount 获取启用的账号数量
@@ -227,12 +558,18 @@ func (s *AccountStore) EnabledCount() int {
 	return count
 }
 
-// Clear 清空所有账号
-func (s *AccountStore) Clear() error {
+// Clear 清空对请求租户可见的账号
+func (s *AccountStore) Clear(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.accounts = []Account{}
+	kept := []Account{}
+	for _, a := range s.accounts {
+		if !VisibleTo(ctx, a.Tenant) {
+			kept = append(kept, a)
+		}
+	}
+	s.accounts = kept
 	s.currentIndex = 0
 	return s.saveUnlocked()
 }
@@ -242,37 +579,118 @@ func (s *AccountStore) Add(account Account) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if _, err := s.addUnlocked(account); err != nil {
+		return err
+	}
+	return s.saveUnlocked()
+}
+
+// ErrAccountExists 已存在相同邮箱或相同凭证的账号（需要 overwrite 覆盖）
+var ErrAccountExists = errors.New("已存在相同邮箱或凭证的账号")
+
+// Create 添加单个账号并返回保存后的账号。同一租户内已有相同邮箱的账号，或已有相同 refresh_token 的账号时
+// 返回 ErrAccountExists，overwrite 为 true 时按 Add 的规则更新已有账号；账号归属请求租户
+func (s *AccountStore) Create(ctx context.Context, account Account, overwrite bool) (IndexedAccount, error) {
+	if tenant, ok := TenantFromContext(ctx); ok {
+		account.Tenant = tenant
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !overwrite {
+		for i := range s.accounts {
+			if account.sameAs(&s.accounts[i]) {
+				return IndexedAccount{}, ErrAccountExists
+			}
+		}
+	}
+	if _, err := s.addUnlocked(account); err != nil {
+		return IndexedAccount{}, err
+	}
+	if err := s.saveUnlocked(); err != nil {
+		return IndexedAccount{}, err
+	}
+	for i, a := range s.accounts {
+		if a.Email == account.Email && a.RefreshToken == account.RefreshToken && a.AccessToken == account.AccessToken {
+			return IndexedAccount{Index: i, Account: a}, nil
+		}
+	}
+	return IndexedAccount{}, errors.New("账号保存后未找到")
+}
+
+// sameAs 新账号 a 是否与已有账号 existing 相同：同一租户内邮箱相同（不属于租户的账号与所有租户比较），
+// 或 refresh_token、静态 access_token 相同
+func (a *Account) sameAs(existing *Account) bool {
+	if a.Email != "" && existing.Email == a.Email && (a.Tenant == "" || existing.Tenant == "" || existing.Tenant == a.Tenant) {
+		return true
+	}
+	if a.RefreshToken != "" && existing.RefreshToken == a.RefreshToken {
+		return true
+	}
+	return a.CredentialType() == CredentialStatic && a.AccessToken != "" && existing.AccessToken == a.AccessToken
+}
+
+// addUnlocked 添加或更新账号但不保存，返回是否更新了已有账号（调用者必须持有锁）
+func (s *AccountStore) addUnlocked(account Account) (bool, error) {
 	// 生成 SessionID
-	account.SessionID = utils.GenerateSessionID()
+	account.resetSession()
 
 	// 设置创建时间
 	if account.CreatedAt.IsZero() {
 		account.CreatedAt = time.Now()
 	}
 
-	// 检查是否已存在（按 email 或 refresh_token）
+	// 检查是否已存在（按同一租户内的 email、refresh_token 或静态 access_token）
 	for i, a := range s.accounts {
-		if (account.Email != "" && a.Email == account.Email) ||
-			(account.RefreshToken != "" && a.RefreshToken == account.RefreshToken) {
-			// 更新现有账号，保留创建时间
+		if account.sameAs(&a) {
+			// 不允许覆盖其他租户的账号
+			if account.Tenant != "" && a.Tenant != "" && account.Tenant != a.Tenant {
+				return false, errors.New("账号已属于其他租户")
+			}
+			// 更新现有账号，保留 ID、创建时间、租户、备注、标签和可用时间段
+			account.ID = a.ID
 			account.CreatedAt = a.CreatedAt
+			if account.Tenant == "" {
+				account.Tenant = a.Tenant
+			}
+			if account.Note == "" {
+				account.Note = a.Note
+			}
+			if account.Labels == nil {
+				account.Labels = a.Labels
+			}
+			if account.Schedule == nil {
+				account.Schedule = a.Schedule
+			}
+			if account.DrainingSince == nil {
+				account.DrainingSince = a.DrainingSince
+			}
 			s.accounts[i] = account
-			return s.saveUnlocked()
+			return true, nil
 		}
 	}
 
+	if account.ID == "" {
+		account.ID = utils.GenerateAccountID()
+	}
 	s.accounts = append(s.accounts, account)
-	return s.saveUnlocked()
+	return false, nil
 }
 
-// Delete 删除账号
-func (s *AccountStore) Delete(index int) error {
+// Delete 删除账号（排空宽限期内的账号需要 force）
+func (s *AccountStore) Delete(ctx context.Context, index int, force bool) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if index < 0 || index >= len(s.accounts) {
-		return errors.New("索引超出范围")
+	account, err := s.accountAtUnlocked(ctx, index)
+	if err != nil {
+		return err
+	}
+	if account.inDrainGrace() && !force {
+		return ErrAccountDraining
 	}
+	GetConversationMap().InvalidateAccount(account.ID, UnbindDeleted)
 
 	s.accounts = append(s.accounts[:index], s.accounts[index+1:]...)
 
@@ -285,110 +703,232 @@ func (s *AccountStore) Delete(index int) error {
 }
 
 // SetEnable 设置账号启用状态
-func (s *AccountStore) SetEnable(index int, enable bool) error {
+func (s *AccountStore) SetEnable(ctx context.Context, index int, enable bool) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if index < 0 || index >= len(s.accounts) {
-		return errors.New("索引超出范围")
+	account, err := s.accountAtUnlocked(ctx, index)
+	if err != nil {
+		return err
 	}
 
-	s.accounts[index].Enable = enable
+	account.Enable = enable
 	return s.saveUnlocked()
 }
 
-// RefreshAccount 刷新指定账号的 Token
-func (s *AccountStore) RefreshAccount(index int) error {
+// SetEndpoint 设置账号固定端点（空字符串表示取消固定）
+func (s *AccountStore) SetEndpoint(ctx context.Context, index int, endpoint string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if index < 0 || index >= len(s.accounts) {
-		return errors.New("索引超出范围")
+	account, err := s.accountAtUnlocked(ctx, index)
+	if err != nil {
+		return err
+	}
+	if endpoint != "" {
+		if _, ok := config.APIEndpoints[endpoint]; !ok {
+			return errors.New("无效的端点: " + endpoint)
+		}
+	}
+
+	account.Endpoint = endpoint
+	return s.saveUnlocked()
+}
+
+// SetNote 设置账号备注
+func (s *AccountStore) SetNote(ctx context.Context, index int, note string) error {
+	if err := ValidateNote(note); err != nil {
+		return err
 	}
 
-	if err := s.refreshToken(&s.accounts[index]); err != nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.accountAtUnlocked(ctx, index)
+	if err != nil {
 		return err
 	}
 
+	account.Note = note
 	return s.saveUnlocked()
 }
 
-// RefreshAll 刷新所有账号的 Token
-func (s *AccountStore) RefreshAll() (int, int) {
+// SetProjectID 设置账号的 projectId
+func (s *AccountStore) SetProjectID(ctx context.Context, index int, projectID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	success := 0
-	failed := 0
+	account, err := s.accountAtUnlocked(ctx, index)
+	if err != nil {
+		return err
+	}
 
-	for i := range s.accounts {
-		if err := s.refreshToken(&s.accounts[i]); err != nil {
-			failed++
-			logger.Warn("Refresh failed for account %d: %v", i, err)
-		} else {
-			success++
+	account.ProjectID = strings.TrimSpace(projectID)
+	return s.saveUnlocked()
+}
+
+// SetLabels 设置账号标签（整体替换）
+func (s *AccountStore) SetLabels(ctx context.Context, index int, labels map[string]string) error {
+	if err := ValidateLabels(labels); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.accountAtUnlocked(ctx, index)
+	if err != nil {
+		return err
+	}
+
+	if len(labels) == 0 {
+		labels = nil
+	}
+	account.Labels = labels
+	return s.saveUnlocked()
+}
+
+// SetSchedule 设置账号可用时间段（整体替换，nil 或没有时间段时清除）
+func (s *AccountStore) SetSchedule(ctx context.Context, index int, schedule *AccountSchedule) error {
+	if schedule != nil && len(schedule.Windows) == 0 {
+		schedule = nil
+	}
+	if schedule != nil {
+		if err := schedule.Validate(); err != nil {
+			return err
 		}
 	}
 
-	s.saveUnlocked()
-	return success, failed
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.accountAtUnlocked(ctx, index)
+	if err != nil {
+		return err
+	}
+
+	account.Schedule = schedule
+	return s.saveUnlocked()
 }
 
-// ImportFromTOML 从 TOML 导入账号
-func (s *AccountStore) ImportFromTOML(tomlData map[string]interface{}) (int, error) {
-	accounts, ok := tomlData["accounts"].([]map[string]interface{})
-	if !ok {
-		return 0, errors.New("无效的 TOML 格式")
+// SetTenant 设置账号所属租户（仅超级管理员）
+func (s *AccountStore) SetTenant(ctx context.Context, index int, tenant string) error {
+	if _, scoped := TenantFromContext(ctx); scoped {
+		return errors.New("只有超级管理员可以修改账号租户")
 	}
 
-	imported := 0
-	for _, acc := range accounts {
-		account := Account{
-			Enable: true,
-		}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		if v, ok := acc["access_token"].(string); ok {
-			account.AccessToken = v
-		}
-		if v, ok := acc["refresh_token"].(string); ok {
-			account.RefreshToken = v
-		}
-		if v, ok := acc["expires_in"].(int64); ok {
-			account.ExpiresIn = int(v)
-		} else if v, ok := acc["expires_in"].(float64); ok {
-			account.ExpiresIn = int(v)
-		}
-		if v, ok := acc["timestamp"].(int64); ok {
-			account.Timestamp = v
-		} else if v, ok := acc["timestamp"].(float64); ok {
-			account.Timestamp = int64(v)
-		}
-		if v, ok := acc["projectId"].(string); ok {
-			account.ProjectID = v
-		}
-		if v, ok := acc["email"].(string); ok {
-			account.Email = v
+	account, err := s.accountAtUnlocked(ctx, index)
+	if err != nil {
+		return err
+	}
+
+	account.Tenant = tenant
+	return s.saveUnlocked()
+}
+
+// disableWithNote 禁用账号并在备注中追加原因（需要已持有锁）
+func disableWithNote(account *Account, reason string) {
+	account.Enable = false
+
+	line := "[" + time.Now().Format("2006-01-02 15:04") + "] 系统禁用: " + reason
+	note := line
+	if account.Note != "" {
+		note = account.Note + "\n" + line
+	}
+	// 超长时保留最新的内容
+	if r := []rune(note); len(r) > MaxNoteLength {
+		note = string(r[len(r)-MaxNoteLength:])
+	}
+	account.Note = note
+
+	logger.Warn("Account %s disabled: %s", account.Email, reason)
+}
+
+// ValidateNote 校验备注长度
+func ValidateNote(note string) error {
+	if utf8.RuneCountInString(note) > MaxNoteLength {
+		return fmt.Errorf("备注不能超过 %d 个字符", MaxNoteLength)
+	}
+	return nil
+}
+
+// ValidateLabels 校验标签数量和长度
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return fmt.Errorf("标签不能超过 %d 个", MaxLabels)
+	}
+	for k, v := range labels {
+		if k == "" || utf8.RuneCountInString(k) > MaxLabelKeyLength {
+			return fmt.Errorf("标签名长度必须在 1~%d 个字符之间", MaxLabelKeyLength)
 		}
-		if v, ok := acc["enable"].(bool); ok {
-			account.Enable = v
+		if utf8.RuneCountInString(v) > MaxLabelValueLength {
+			return fmt.Errorf("标签值不能超过 %d 个字符", MaxLabelValueLength)
 		}
+	}
+	return nil
+}
 
-		if account.RefreshToken != "" {
-			if err := s.Add(account); err == nil {
-				imported++
-			}
+// Matches 检查账号是否匹配搜索关键字（email、projectId、备注、标签，不区分大小写）
+func (a *Account) Matches(q string) bool {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if q == "" {
+		return true
+	}
+	if strings.Contains(strings.ToLower(a.Email), q) ||
+		strings.Contains(strings.ToLower(a.ProjectID), q) ||
+		strings.Contains(strings.ToLower(a.Note), q) {
+		return true
+	}
+	for k, v := range a.Labels {
+		if strings.Contains(strings.ToLower(k), q) ||
+			strings.Contains(strings.ToLower(v), q) ||
+			strings.ToLower(k+"="+v) == q {
+			return true
 		}
 	}
-
-	return imported, nil
+	return false
 }
 
-// 占位函数，实际实现在 auth 包中
-var refreshAccountToken = func(account *Account) error {
-	return errors.New("token refresh not implemented")
+// RefreshAccount 刷新指定账号的 Token
+func (s *AccountStore) RefreshAccount(ctx context.Context, index int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.accountAtUnlocked(ctx, index)
+	if err != nil {
+		return err
+	}
+
+	if err := s.refreshTokenGated(account, true); err != nil {
+		return err
+	}
+
+	return s.saveUnlocked()
 }
 
-// SetRefreshFunc 设置刷新函数
-func SetRefreshFunc(fn func(*Account) error) {
-	refreshAccountToken = fn
+// RefreshAll 刷新对请求租户可见的所有账号的 Token
+func (s *AccountStore) RefreshAll(ctx context.Context) (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	success := 0
+	failed := 0
+
+	for i := range s.accounts {
+		if !VisibleTo(ctx, s.accounts[i].Tenant) {
+			continue
+		}
+		if err := s.refreshToken(&s.accounts[i]); err != nil {
+			failed++
+			logger.Warn("Refresh failed for account %d: %v", i, err)
+		} else {
+			success++
+		}
+	}
+
+	s.saveUnlocked()
+	return success, failed
 }
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// tenantAccount 属于 tenant 的账号
+func tenantAccount(id, tenant string) Account {
+	a := freshAccount(id)
+	a.Tenant = tenant
+	return a
+}
+
+func TestCreateRejectsDuplicateEmailInSameTenant(t *testing.T) {
+	s := newTestStore(t, tenantAccount("dup", "t1"))
+
+	dup := freshAccount("dup-again")
+	dup.Email = "dup@example.com"
+	if _, err := s.Create(WithTenant(context.Background(), "t1"), dup, false); !errors.Is(err, ErrAccountExists) {
+		t.Fatalf("Create = %v, want ErrAccountExists", err)
+	}
+	// 不限租户的管理员与所有租户的账号比较
+	if _, err := s.Create(context.Background(), dup, false); !errors.Is(err, ErrAccountExists) {
+		t.Fatalf("Create without tenant = %v, want ErrAccountExists", err)
+	}
+	if len(s.accounts) != 1 || s.accounts[0].RefreshToken != "refresh-dup" {
+		t.Errorf("existing account changed: %+v", s.accounts)
+	}
+}
+
+func TestCreateAllowsSameEmailInOtherTenant(t *testing.T) {
+	s := newTestStore(t, tenantAccount("shared", "t1"))
+
+	other := freshAccount("shared-t2")
+	other.Email = "shared@example.com"
+	created, err := s.Create(WithTenant(context.Background(), "t2"), other, false)
+	if err != nil {
+		t.Fatalf("Create in another tenant: %v", err)
+	}
+	if created.Tenant != "t2" || created.ID == s.accounts[0].ID {
+		t.Errorf("created %+v, want a separate account in t2", created.Account)
+	}
+	if len(s.accounts) != 2 || s.accounts[0].Tenant != "t1" || s.accounts[0].RefreshToken != "refresh-shared" {
+		t.Errorf("accounts = %+v, want the t1 account untouched", s.accounts)
+	}
+}
+
+func TestCreateRejectsDuplicateRefreshToken(t *testing.T) {
+	s := newTestStore(t, freshAccount("rt"))
+	original := s.accounts[0]
+
+	renamed := freshAccount("rt-renamed")
+	renamed.RefreshToken = original.RefreshToken
+	if _, err := s.Create(context.Background(), renamed, false); !errors.Is(err, ErrAccountExists) {
+		t.Fatalf("Create = %v, want ErrAccountExists for a refresh token that is already stored", err)
+	}
+	if len(s.accounts) != 1 || s.accounts[0].Email != original.Email {
+		t.Fatalf("existing account was replaced: %+v", s.accounts)
+	}
+
+	// overwrite 时更新已有账号，保留 ID
+	updated, err := s.Create(context.Background(), renamed, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.accounts) != 1 || updated.ID != original.ID || updated.Email != renamed.Email {
+		t.Errorf("overwrite = %+v, want account %s updated in place", updated.Account, original.ID)
+	}
+}
@@ -0,0 +1,431 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+)
+
+// 解除绑定原因
+const (
+	UnbindUnhealthy = "unhealthy" // 绑定的账号不可用（禁用、刷新失败、不可见）
+	UnbindDeleted   = "deleted"   // 账号被删除
+	UnbindManual    = "manual"    // 管理员手动解除
+	UnbindAborted   = "aborted"   // 建立绑定的请求异常终止（panic）
+)
+
+// Binding 会话与账号的绑定
+type Binding struct {
+	Key       string    `json:"key"`
+	AccountID string    `json:"accountId"`
+	BoundAt   time.Time `json:"boundAt"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Hits      int       `json:"hits"` // 绑定后命中的请求数
+
+	ReboundFrom string `json:"reboundFrom,omitempty"` // 后台刷新失败后改绑前的账号 ID
+}
+
+// AffinityStats 会话绑定统计
+type AffinityStats struct {
+	Entries    int     `json:"entries"`
+	MaxEntries int     `json:"maxEntries"`
+	TTLMinutes int     `json:"ttlMinutes"`
+	Lookups    int     `json:"lookups"`
+	Hits       int     `json:"hits"`
+	HitRate    float64 `json:"hitRate"`
+	Evictions  int     `json:"evictions"` // 超出条目上限被淘汰
+	Expired    int     `json:"expired"`   // 超过 TTL 未活动被清理
+	Rebinds    int     `json:"rebinds"`   // 绑定账号不可用后改绑
+	Unbinds    int     `json:"unbinds"`   // 手动解除、账号删除或请求异常终止
+}
+
+// ConversationMap 会话到账号的绑定（LRU，按条目数和 TTL 淘汰，线程安全）
+type ConversationMap struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element // 值为 *Binding
+	order   *list.List               // 最近使用的在前
+
+	lastPrune time.Time
+	stats     AffinityStats
+}
+
+var (
+	conversationMap     *ConversationMap
+	conversationMapOnce sync.Once
+)
+
+// GetConversationMap 获取会话绑定单例（AFFINITY_PERSIST 开启时加载上次保存的绑定）
+func GetConversationMap() *ConversationMap {
+	conversationMapOnce.Do(func() {
+		conversationMap = newConversationMap()
+		if config.Get().AffinityPersist {
+			if err := conversationMap.load(affinityFile()); err != nil && !os.IsNotExist(err) {
+				logger.Warn("Failed to load conversation affinity: %v", err)
+			}
+		}
+	})
+	return conversationMap
+}
+
+func newConversationMap() *ConversationMap {
+	return &ConversationMap{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func affinityFile() string {
+	return filepath.Join(config.Get().DataDir, "affinity.json")
+}
+
+// affinityTTL 绑定的有效期（不短于排空宽限期，保证排空账号上的会话在宽限期内不丢失）
+func affinityTTL() time.Duration {
+	ttl := time.Duration(config.Get().AffinityTTLMinutes) * time.Minute
+	if grace := DrainGracePeriod(); grace > ttl {
+		ttl = grace
+	}
+	return ttl
+}
+
+// Get 返回会话绑定的账号 ID（过期的绑定视为不存在），计入命中率
+func (m *ConversationMap) Get(key string) string {
+	if key == "" {
+		return ""
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stats.Lookups++
+	elem, ok := m.entries[key]
+	if !ok {
+		return ""
+	}
+	b := elem.Value.(*Binding)
+	if time.Since(b.LastSeen) > affinityTTL() {
+		m.removeLocked(elem)
+		m.stats.Expired++
+		return ""
+	}
+	m.stats.Hits++
+	return b.AccountID
+}
+
+// Bind 将会话绑定到账号（已绑定到同一账号时刷新活动时间），超出条目上限时淘汰最久未使用的绑定
+func (m *ConversationMap) Bind(key, accountID string) {
+	if key == "" || accountID == "" {
+		return
+	}
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.entries[key]; ok {
+		b := elem.Value.(*Binding)
+		if b.AccountID == accountID {
+			b.Hits++
+		} else {
+			b.AccountID = accountID
+			b.BoundAt = now
+			b.Hits = 0
+			b.ReboundFrom = ""
+		}
+		b.LastSeen = now
+		m.order.MoveToFront(elem)
+	} else {
+		m.entries[key] = m.order.PushFront(&Binding{Key: key, AccountID: accountID, BoundAt: now, LastSeen: now})
+	}
+
+	if max := config.Get().AffinityMaxEntries; max > 0 {
+		for m.order.Len() > max {
+			m.removeLocked(m.order.Back())
+			m.stats.Evictions++
+		}
+	}
+	m.pruneLocked(now)
+}
+
+// Invalidate 解除会话绑定，unhealthy 原因计入改绑次数
+func (m *ConversationMap) Invalidate(key, reason string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[key]
+	if !ok {
+		return false
+	}
+	m.removeLocked(elem)
+	m.countUnbindLocked(reason, 1)
+	return true
+}
+
+// invalidateBinding 会话仍绑定在指定账号时解除绑定（已被其他请求改绑时保留）
+func (m *ConversationMap) invalidateBinding(key, accountID, reason string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[key]
+	if !ok || elem.Value.(*Binding).AccountID != accountID {
+		return false
+	}
+	m.removeLocked(elem)
+	m.countUnbindLocked(reason, 1)
+	return true
+}
+
+// InvalidatePrefix 按会话标识前缀解除绑定（管理接口只展示脱敏的前缀），返回解除的数量
+func (m *ConversationMap) InvalidatePrefix(prefix, reason string) int {
+	if prefix == "" {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for key, elem := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			m.removeLocked(elem)
+			removed++
+		}
+	}
+	m.countUnbindLocked(reason, removed)
+	return removed
+}
+
+// InvalidateAccount 解除账号上的所有绑定
+func (m *ConversationMap) InvalidateAccount(accountID, reason string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for _, elem := range m.entries {
+		if elem.Value.(*Binding).AccountID == accountID {
+			m.removeLocked(elem)
+			removed++
+		}
+	}
+	m.countUnbindLocked(reason, removed)
+	return removed
+}
+
+// RebindAccount 将账号上的所有绑定改绑到另一个账号（计入改绑次数），返回改绑的会话标识
+func (m *ConversationMap) RebindAccount(fromID, toID string) []string {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+	for key, elem := range m.entries {
+		b := elem.Value.(*Binding)
+		if b.AccountID != fromID {
+			continue
+		}
+		b.AccountID = toID
+		b.BoundAt = now
+		b.Hits = 0
+		b.ReboundFrom = fromID
+		keys = append(keys, key)
+	}
+	m.stats.Rebinds += len(keys)
+	return keys
+}
+
+// pinnedCounts 有未过期绑定的账号 ID 及其绑定数
+func (m *ConversationMap) pinnedCounts() map[string]int {
+	ttl := affinityTTL()
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, elem := range m.entries {
+		if b := elem.Value.(*Binding); now.Sub(b.LastSeen) <= ttl {
+			counts[b.AccountID]++
+		}
+	}
+	return counts
+}
+
+// CountAccount 账号上未过期的绑定数
+func (m *ConversationMap) CountAccount(accountID string) int {
+	ttl := affinityTTL()
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, elem := range m.entries {
+		b := elem.Value.(*Binding)
+		if b.AccountID == accountID && now.Sub(b.LastSeen) <= ttl {
+			count++
+		}
+	}
+	return count
+}
+
+// Bindings 未过期的绑定（最近使用的在前）
+func (m *ConversationMap) Bindings() []Binding {
+	ttl := affinityTTL()
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bindings := make([]Binding, 0, m.order.Len())
+	for elem := m.order.Front(); elem != nil; elem = elem.Next() {
+		b := elem.Value.(*Binding)
+		if now.Sub(b.LastSeen) <= ttl {
+			bindings = append(bindings, *b)
+		}
+	}
+	return bindings
+}
+
+// Stats 绑定统计
+func (m *ConversationMap) Stats() AffinityStats {
+	cfg := config.Get()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Entries = m.order.Len()
+	stats.MaxEntries = cfg.AffinityMaxEntries
+	stats.TTLMinutes = int(affinityTTL() / time.Minute)
+	if stats.Lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(stats.Lookups)
+	}
+	return stats
+}
+
+// Save 保存未过期的绑定（最近使用的优先，最多 AffinityMaxEntries 条）
+func (m *ConversationMap) Save() error {
+	data, err := json.Marshal(m.Bindings())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(affinityFile(), data, 0644)
+}
+
+// load 加载保存的绑定，丢弃已过期的记录
+func (m *ConversationMap) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var bindings []Binding
+	if err := json.Unmarshal(data, &bindings); err != nil {
+		return err
+	}
+
+	// 按活动时间从旧到新插入，保持 LRU 顺序
+	sort.Slice(bindings, func(i, j int) bool { return bindings[i].LastSeen.Before(bindings[j].LastSeen) })
+	ttl := affinityTTL()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range bindings {
+		b := bindings[i]
+		if b.Key == "" || b.AccountID == "" || time.Since(b.LastSeen) > ttl {
+			continue
+		}
+		if elem, ok := m.entries[b.Key]; ok {
+			m.order.Remove(elem)
+		}
+		m.entries[b.Key] = m.order.PushFront(&b)
+	}
+	if max := config.Get().AffinityMaxEntries; max > 0 {
+		for m.order.Len() > max {
+			m.removeLocked(m.order.Back())
+		}
+	}
+	logger.Info("Loaded %d conversation bindings", m.order.Len())
+	return nil
+}
+
+// pruneLocked 每分钟清理一次过期的绑定（从最久未使用的一端开始）
+func (m *ConversationMap) pruneLocked(now time.Time) {
+	if now.Sub(m.lastPrune) < time.Minute {
+		return
+	}
+	m.lastPrune = now
+	ttl := affinityTTL()
+	for elem := m.order.Back(); elem != nil; {
+		b := elem.Value.(*Binding)
+		if now.Sub(b.LastSeen) <= ttl {
+			break
+		}
+		prev := elem.Prev()
+		m.removeLocked(elem)
+		m.stats.Expired++
+		elem = prev
+	}
+}
+
+func (m *ConversationMap) removeLocked(elem *list.Element) {
+	m.order.Remove(elem)
+	delete(m.entries, elem.Value.(*Binding).Key)
+}
+
+func (m *ConversationMap) countUnbindLocked(reason string, n int) {
+	if reason == UnbindUnhealthy {
+		m.stats.Rebinds += n
+	} else {
+		m.stats.Unbinds += n
+	}
+}
+
+// Reservations 请求期间新建立的会话绑定，请求异常终止时由恢复中间件解除
+type Reservations struct {
+	mu       sync.Mutex
+	bindings []Binding
+}
+
+type reservationsContextKey struct{}
+
+// WithReservations 为请求创建绑定记录
+func WithReservations(ctx context.Context) (context.Context, *Reservations) {
+	res := &Reservations{}
+	return context.WithValue(ctx, reservationsContextKey{}, res), res
+}
+
+// reserve 记录请求新建立的绑定
+func reserve(ctx context.Context, key, accountID string) {
+	res, _ := ctx.Value(reservationsContextKey{}).(*Reservations)
+	if res == nil || key == "" {
+		return
+	}
+	res.mu.Lock()
+	res.bindings = append(res.bindings, Binding{Key: key, AccountID: accountID})
+	res.mu.Unlock()
+}
+
+// Release 解除请求建立的绑定，返回解除的数量
+func (r *Reservations) Release(reason string) int {
+	r.mu.Lock()
+	bindings := r.bindings
+	r.bindings = nil
+	r.mu.Unlock()
+
+	released := 0
+	m := GetConversationMap()
+	for _, b := range bindings {
+		if m.invalidateBinding(b.Key, b.AccountID, reason) {
+			released++
+		}
+	}
+	return released
+}
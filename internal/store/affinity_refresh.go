@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+)
+
+// affinityRefreshLead 后台提前刷新绑定账号 Token 的时间（早于选择账号时 5 分钟的刷新窗口，
+// 避免会话的下一轮请求因刷新失败被迫改绑）
+const affinityRefreshLead = 15 * time.Minute
+
+// expiresWithin 可刷新凭证的 Token 是否将在 d 内过期（静态令牌无法刷新，不计入）
+func (a *Account) expiresWithin(d time.Duration, now time.Time) bool {
+	if a.CredentialType() == CredentialStatic {
+		return false
+	}
+	expiry := a.tokenExpiry()
+	return expiry.IsZero() || expiry.Sub(now) <= d
+}
+
+// keepsConversations 已绑定的会话是否继续使用该账号：排空账号在宽限期内保持，开启 CONVERSATION_AFFINITY 时所有账号都保持
+func (a *Account) keepsConversations() bool {
+	return a.inDrainGrace() || (config.Get().ConversationAffinity && !a.IsDraining())
+}
+
+// atRisk 绑定在该账号上的会话下一轮是否可能需要改绑（账号已禁用、Token 已过期或即将过期）
+func (a *Account) atRisk(now time.Time) bool {
+	return !a.Enable || a.IsExpired() || a.expiresWithin(affinityRefreshLead, now)
+}
+
+// ConversationsAtRisk 绑定账号可能无法继续服务的会话数（只统计对请求租户可见的账号）
+func ConversationsAtRisk(ctx context.Context) int {
+	counts := GetConversationMap().pinnedCounts()
+	if len(counts) == 0 {
+		return 0
+	}
+	now := time.Now()
+	total := 0
+	for _, a := range GetAccountStore().GetAll(ctx) {
+		if n := counts[a.ID]; n > 0 && a.keepsConversations() && a.atRisk(now) {
+			total += n
+		}
+	}
+	return total
+}
+
+// pinnedRefreshDue 有会话绑定的账号是否需要提前刷新（早于普通账号的刷新窗口）
+func (a *Account) pinnedRefreshDue(pinned int, now time.Time) bool {
+	return pinned > 0 && a.keepsConversations() && a.expiresWithin(affinityRefreshLead, now)
+}
+
+// rebindPinned 把绑定在 fromID 上的会话改绑到同租户的其他可用账号并记录日志，返回改绑的会话数。
+// 不持有账号存储锁；候选账号需要刷新时逐个加锁刷新，与后台刷新一致
+func (s *AccountStore) rebindPinned(fromID string, counts map[string]int) int {
+	candidates := s.rebindCandidates(fromID, counts)
+	var target *Account
+	for _, id := range candidates {
+		if target = s.prepareRebindTarget(id); target != nil {
+			break
+		}
+	}
+
+	s.mu.RLock()
+	var fromEmail string
+	if i := s.indexOfUnlocked(fromID); i >= 0 {
+		fromEmail = s.accounts[i].Email
+	}
+	s.mu.RUnlock()
+
+	if target == nil {
+		logger.Warn("No healthy account to take over %d conversation(s) pinned to %s", counts[fromID], fromEmail)
+		return 0
+	}
+	keys := GetConversationMap().RebindAccount(fromID, target.ID)
+	for _, key := range keys {
+		// 日志中只记录会话标识的前缀（与管理接口展示的一致）
+		if len(key) > 8 {
+			key = key[:8]
+		}
+		logger.Warn("Conversation %s rebound from %s to %s: token refresh failed", key, fromEmail, target.Email)
+	}
+	counts[target.ID] += len(keys)
+	counts[fromID] = 0
+	return len(keys)
+}
+
+// rebindCandidates 可以接管会话的账号 ID：同租户、端点兼容、当前可用，绑定会话少的优先
+func (s *AccountStore) rebindCandidates(fromID string, counts map[string]int) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.indexOfUnlocked(fromID)
+	if i < 0 {
+		return nil
+	}
+	from := s.accounts[i]
+	now := time.Now()
+	var candidates []string
+	for i := range s.accounts {
+		a := &s.accounts[i]
+		if a.ID == from.ID || a.Tenant != from.Tenant || !a.rebindEligible(now) {
+			continue
+		}
+		if a.Endpoint != "" && a.Endpoint != from.Endpoint {
+			continue
+		}
+		candidates = append(candidates, a.ID)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return counts[candidates[i]] < counts[candidates[j]]
+	})
+	return candidates
+}
+
+// rebindEligible 账号当前是否可以接管会话
+func (a *Account) rebindEligible(now time.Time) bool {
+	return a.Enable && !a.IsDraining() && a.InSchedule(now) && !a.InCooldown(now)
+}
+
+// prepareRebindTarget 加锁后重新检查候选账号，Token 即将过期时先刷新；不可用时返回 nil，否则返回账号副本
+func (s *AccountStore) prepareRebindTarget(id string) *Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOfUnlocked(id)
+	if i < 0 {
+		return nil
+	}
+	a := &s.accounts[i]
+	now := time.Now()
+	if !a.rebindEligible(now) {
+		return nil
+	}
+	if !a.expiresWithin(affinityRefreshLead, now) {
+		if a.IsExpired() {
+			return nil
+		}
+		target := *a
+		return &target
+	}
+	if err := s.refreshToken(a); err != nil {
+		logger.Warn("Token refresh failed for %s: %v", a.Email, err)
+		s.disableOnRefreshErrorUnlocked(a, err)
+		return nil
+	}
+	s.saveUnlocked()
+	target := *a
+	return &target
+}
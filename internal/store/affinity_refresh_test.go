@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// pin 把会话绑定到账号（测试结束时解除）
+func pin(t *testing.T, accountID string, keys ...string) {
+	t.Helper()
+	m := GetConversationMap()
+	for _, key := range keys {
+		m.Bind(key, accountID)
+	}
+	t.Cleanup(func() { m.InvalidateAccount(accountID, UnbindManual) })
+}
+
+func TestRefreshExpiringRefreshesPinnedAccountsFirst(t *testing.T) {
+	// unpinned 在刷新窗口内；pinned-* 只在会话绑定的提前刷新时间内
+	s := newTestStore(t,
+		expiringAccount("rp-unpinned", 30*time.Second),
+		expiringAccount("rp-pinned-one", 12*time.Minute),
+		expiringAccount("rp-pinned-two", 12*time.Minute),
+		expiringAccount("rp-idle", 12*time.Minute),
+	)
+	pin(t, "rp-pinned-one", "rp-conv-a")
+	pin(t, "rp-pinned-two", "rp-conv-b", "rp-conv-c")
+	refreshCalls()
+
+	refreshed, failed := s.RefreshExpiring(time.Minute, nil)
+	if refreshed != 3 || failed != 0 {
+		t.Fatalf("refreshed=%d failed=%d, want 3/0", refreshed, failed)
+	}
+	calls := refreshCalls()
+	want := []string{"rp-pinned-two", "rp-pinned-one", "rp-unpinned"}
+	if len(calls) != len(want) {
+		t.Fatalf("refresh calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("refresh calls = %v, want %v", calls, want)
+		}
+	}
+}
+
+func TestRefreshFailureRebindsPinnedConversations(t *testing.T) {
+	s := newTestStore(t,
+		expiringAccount("rb-failing", 12*time.Minute),
+		freshAccount("rb-busy"),
+		expiringAccount("rb-idle", 10*time.Minute), // 接管前需要先刷新
+	)
+	pin(t, "rb-failing", "rb-conv-a", "rb-conv-b")
+	pin(t, "rb-busy", "rb-conv-c")
+	t.Cleanup(func() { GetConversationMap().InvalidateAccount("rb-idle", UnbindManual) })
+	failRefresh(t, "rb-failing", errors.New("oauth unavailable"))
+	refreshCalls()
+
+	_, failed := s.RefreshExpiring(time.Minute, nil)
+	if failed != 1 {
+		t.Fatalf("failed = %d, want 1", failed)
+	}
+	m := GetConversationMap()
+	for _, key := range []string{"rb-conv-a", "rb-conv-b"} {
+		if got := m.Get(key); got != "rb-idle" {
+			t.Errorf("%s bound to %q, want rb-idle (fewest conversations)", key, got)
+		}
+	}
+	if got := m.Get("rb-conv-c"); got != "rb-busy" {
+		t.Errorf("unrelated conversation moved to %q", got)
+	}
+	calls := refreshCalls()
+	if len(calls) != 2 || calls[0] != "rb-failing" || calls[1] != "rb-idle" {
+		t.Errorf("refresh calls = %v, want the failing account then the takeover candidate", calls)
+	}
+}
+
+func TestExpiredPinnedAccountNextRequestSucceeds(t *testing.T) {
+	expired := freshAccount("mid-expired")
+	expired.ExpiresIn = 0
+	s := newTestStore(t, expired, freshAccount("mid-healthy"))
+	pin(t, "mid-expired", "mid-conv")
+	t.Cleanup(func() { GetConversationMap().InvalidateAccount("mid-healthy", UnbindManual) })
+	failRefresh(t, "mid-expired", errors.New("oauth unavailable"))
+
+	s.RefreshExpiring(time.Minute, nil)
+	refreshCalls()
+
+	// 会话的下一轮请求直接使用接管的账号，不再尝试刷新失败的账号
+	account, err := s.GetToken(WithConversation(context.Background(), "mid-conv"))
+	if err != nil {
+		t.Fatalf("next turn failed: %v", err)
+	}
+	if account.ID != "mid-healthy" {
+		t.Errorf("next turn used %s, want mid-healthy", account.ID)
+	}
+	if calls := refreshCalls(); len(calls) != 0 {
+		t.Errorf("next turn refreshed %v", calls)
+	}
+}
+
+func TestRefreshThrottledKeepsUsablePinnedAccount(t *testing.T) {
+	s := newTestStore(t, expiringAccount("th-pinned", 12*time.Minute), freshAccount("th-other"))
+	pin(t, "th-pinned", "th-conv")
+	t.Cleanup(func() { GetConversationMap().InvalidateAccount("th-other", UnbindManual) })
+	failRefresh(t, "th-pinned", errors.New("oauth unavailable"))
+
+	s.RefreshExpiring(time.Minute, nil)
+	GetConversationMap().Bind("th-conv", "th-pinned")
+	// 第二轮被退避跳过，Token 仍可用，会话保持原账号
+	refreshCalls()
+	s.RefreshExpiring(time.Minute, nil)
+	if got := GetConversationMap().Get("th-conv"); got != "th-pinned" {
+		t.Errorf("conversation moved to %q while the token is still usable", got)
+	}
+	if calls := refreshCalls(); len(calls) != 0 {
+		t.Errorf("backed-off account was refreshed again: %v", calls)
+	}
+}
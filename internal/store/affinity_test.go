@@ -0,0 +1,502 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/config"
+)
+
+// useAffinityLimits 在测试期间设置绑定条目上限和 TTL（排空宽限期设为 0，不影响 TTL）
+func useAffinityLimits(t *testing.T, maxEntries, ttlMinutes int) {
+	t.Helper()
+	cfg := config.Get()
+	previous := [3]int{cfg.AffinityMaxEntries, cfg.AffinityTTLMinutes, cfg.DrainGraceMinutes}
+	cfg.AffinityMaxEntries, cfg.AffinityTTLMinutes, cfg.DrainGraceMinutes = maxEntries, ttlMinutes, 0
+	t.Cleanup(func() {
+		cfg.AffinityMaxEntries, cfg.AffinityTTLMinutes, cfg.DrainGraceMinutes = previous[0], previous[1], previous[2]
+	})
+}
+
+// age 把绑定的最后活动时间提前 d
+func (m *ConversationMap) age(key string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.entries[key].Value.(*Binding)
+	b.LastSeen = b.LastSeen.Add(-d)
+}
+
+// keys 按最近使用顺序返回全部绑定的会话标识（包括已过期的）
+func (m *ConversationMap) keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for elem := m.order.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(*Binding).Key)
+	}
+	return keys
+}
+
+// checkConsistent 索引与 LRU 链表一致
+func (m *ConversationMap) checkConsistent(t *testing.T) {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.entries) != m.order.Len() {
+		t.Fatalf("index has %d entries, list has %d", len(m.entries), m.order.Len())
+	}
+	for elem := m.order.Front(); elem != nil; elem = elem.Next() {
+		key := elem.Value.(*Binding).Key
+		if m.entries[key] != elem {
+			t.Fatalf("index entry for %s does not point at its list element", key)
+		}
+	}
+}
+
+func TestConversationMapBindGetInvalidate(t *testing.T) {
+	useAffinityLimits(t, 100, 30)
+	m := newConversationMap()
+
+	if id := m.Get("conv-a"); id != "" {
+		t.Fatalf("unbound conversation = %q", id)
+	}
+	m.Bind("conv-a", "acc-1")
+	m.Bind("conv-a", "acc-1")
+	if id := m.Get("conv-a"); id != "acc-1" {
+		t.Fatalf("Get = %q, want acc-1", id)
+	}
+	if b := m.Bindings(); len(b) != 1 || b[0].Hits != 1 {
+		t.Fatalf("bindings = %+v, want one binding with 1 hit", b)
+	}
+
+	// 改绑到其他账号时重置命中数
+	m.Bind("conv-a", "acc-2")
+	if b := m.Bindings(); b[0].AccountID != "acc-2" || b[0].Hits != 0 {
+		t.Fatalf("rebound binding = %+v", b[0])
+	}
+
+	// 空的会话标识或账号不绑定
+	m.Bind("", "acc-1")
+	m.Bind("conv-b", "")
+	if m.Get("") != "" || m.Get("conv-b") != "" {
+		t.Fatal("empty key or account was bound")
+	}
+
+	if !m.Invalidate("conv-a", UnbindManual) || m.Invalidate("conv-a", UnbindManual) {
+		t.Fatal("Invalidate should succeed exactly once")
+	}
+	if m.Get("conv-a") != "" {
+		t.Fatal("invalidated conversation still bound")
+	}
+
+	stats := m.Stats()
+	// "" 不计入查找
+	if stats.Lookups != 4 || stats.Hits != 1 || stats.HitRate != 0.25 || stats.Unbinds != 1 || stats.Entries != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	m.checkConsistent(t)
+}
+
+func TestConversationMapLRUEviction(t *testing.T) {
+	useAffinityLimits(t, 3, 30)
+	m := newConversationMap()
+
+	for _, key := range []string{"a", "b", "c"} {
+		m.Bind(key, "acc")
+	}
+	// 再次绑定 a 使其成为最近使用的，之后淘汰最久未使用的 b
+	m.Bind("a", "acc")
+	m.Bind("d", "acc")
+	if got := fmt.Sprint(m.keys()); got != "[d a c]" {
+		t.Fatalf("keys = %s, want [d a c]", got)
+	}
+	m.Bind("e", "acc")
+	if got := fmt.Sprint(m.keys()); got != "[e d a]" {
+		t.Fatalf("keys = %s, want [e d a]", got)
+	}
+	if stats := m.Stats(); stats.Evictions != 2 || stats.Entries != 3 || stats.MaxEntries != 3 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	m.checkConsistent(t)
+}
+
+func TestConversationMapUnlimitedEntries(t *testing.T) {
+	useAffinityLimits(t, 0, 30)
+	m := newConversationMap()
+	for i := 0; i < 500; i++ {
+		m.Bind(fmt.Sprintf("conv-%d", i), "acc")
+	}
+	if stats := m.Stats(); stats.Entries != 500 || stats.Evictions != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestConversationMapTTL(t *testing.T) {
+	useAffinityLimits(t, 100, 30)
+	m := newConversationMap()
+
+	m.Bind("stale", "acc")
+	m.Bind("fresh", "acc")
+	m.age("stale", 31*time.Minute)
+	m.age("fresh", 29*time.Minute)
+
+	if m.Get("stale") != "" {
+		t.Fatal("expired binding returned")
+	}
+	if m.Get("fresh") != "acc" {
+		t.Fatal("binding within TTL dropped")
+	}
+	if stats := m.Stats(); stats.Expired != 1 || stats.Entries != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// 过期但未被查找的绑定不出现在列表和计数中，Bind 时清理
+	m.age("fresh", 2*time.Minute)
+	if len(m.Bindings()) != 0 || m.CountAccount("acc") != 0 {
+		t.Fatal("expired binding listed")
+	}
+	// 清理每分钟最多执行一次
+	m.Bind("new", "acc")
+	if got := fmt.Sprint(m.keys()); got != "[new fresh]" {
+		t.Fatalf("keys = %s, want prune throttled", got)
+	}
+	m.mu.Lock()
+	m.lastPrune = m.lastPrune.Add(-time.Minute)
+	m.mu.Unlock()
+	m.Bind("new", "acc")
+	if got := fmt.Sprint(m.keys()); got != "[new]" {
+		t.Fatalf("keys = %s, want expired bindings pruned", got)
+	}
+	if stats := m.Stats(); stats.Expired != 2 {
+		t.Fatalf("expired = %d, want 2", stats.Expired)
+	}
+}
+
+func TestConversationMapTTLCoversDrainGrace(t *testing.T) {
+	useAffinityLimits(t, 100, 5)
+	config.Get().DrainGraceMinutes = 60
+
+	m := newConversationMap()
+	m.Bind("draining", "acc")
+	m.age("draining", 30*time.Minute)
+	// TTL 不短于排空宽限期
+	if m.Get("draining") != "acc" {
+		t.Fatal("binding dropped within the drain grace period")
+	}
+	if stats := m.Stats(); stats.TTLMinutes != 60 {
+		t.Fatalf("ttl = %d minutes, want 60", stats.TTLMinutes)
+	}
+}
+
+func TestConversationMapAccountOperations(t *testing.T) {
+	useAffinityLimits(t, 100, 30)
+	m := newConversationMap()
+	for _, key := range []string{"a1", "a2", "a3"} {
+		m.Bind(key, "acc-a")
+	}
+	m.Bind("b1", "acc-b")
+
+	if n := m.CountAccount("acc-a"); n != 3 {
+		t.Fatalf("CountAccount = %d", n)
+	}
+	if counts := m.pinnedCounts(); counts["acc-a"] != 3 || counts["acc-b"] != 1 {
+		t.Fatalf("pinnedCounts = %v", counts)
+	}
+
+	// 改绑计入 rebinds，记录原账号
+	keys := m.RebindAccount("acc-a", "acc-c")
+	if len(keys) != 3 || m.Get("a1") != "acc-c" {
+		t.Fatalf("rebound keys = %v", keys)
+	}
+	for _, b := range m.Bindings() {
+		if b.AccountID == "acc-c" && b.ReboundFrom != "acc-a" {
+			t.Errorf("binding %s reboundFrom = %q", b.Key, b.ReboundFrom)
+		}
+	}
+
+	// 账号不可用时解除计入 rebinds，删除计入 unbinds
+	if n := m.InvalidateAccount("acc-c", UnbindUnhealthy); n != 3 {
+		t.Fatalf("InvalidateAccount = %d", n)
+	}
+	if n := m.InvalidateAccount("acc-b", UnbindDeleted); n != 1 {
+		t.Fatalf("InvalidateAccount = %d", n)
+	}
+	if stats := m.Stats(); stats.Rebinds != 6 || stats.Unbinds != 1 || stats.Entries != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestConversationMapInvalidatePrefix(t *testing.T) {
+	useAffinityLimits(t, 100, 30)
+	m := newConversationMap()
+	m.Bind("abcdef-1", "acc")
+	m.Bind("abcdef-2", "acc")
+	m.Bind("xyz", "acc")
+
+	if n := m.InvalidatePrefix("", UnbindManual); n != 0 {
+		t.Fatalf("empty prefix removed %d", n)
+	}
+	if n := m.InvalidatePrefix("abcdef", UnbindManual); n != 2 {
+		t.Fatalf("removed %d, want 2", n)
+	}
+	if got := fmt.Sprint(m.keys()); got != "[xyz]" {
+		t.Fatalf("keys = %s", got)
+	}
+	if stats := m.Stats(); stats.Unbinds != 2 {
+		t.Fatalf("unbinds = %d", stats.Unbinds)
+	}
+}
+
+func TestConversationMapPersistence(t *testing.T) {
+	useAffinityLimits(t, 100, 30)
+	m := newConversationMap()
+	m.Bind("old", "acc-1")
+	m.Bind("mid", "acc-2")
+	m.Bind("new", "acc-1")
+	m.Bind("expired", "acc-3")
+	m.age("old", 3*time.Minute)
+	m.age("mid", 2*time.Minute)
+	m.age("new", 30*time.Second)
+	m.age("expired", time.Hour)
+	t.Cleanup(func() { os.Remove(affinityFile()) })
+
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后恢复未过期的绑定，保持 LRU 顺序
+	restored := newConversationMap()
+	if err := restored.load(affinityFile()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(restored.keys()); got != "[new mid old]" {
+		t.Fatalf("restored keys = %s, want [new mid old]", got)
+	}
+	if restored.Get("mid") != "acc-2" {
+		t.Fatal("restored binding lost its account")
+	}
+	restored.checkConsistent(t)
+
+	// 条目上限变小后只恢复最近使用的
+	config.Get().AffinityMaxEntries = 2
+	limited := newConversationMap()
+	if err := limited.load(affinityFile()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(limited.keys()); got != "[new mid]" {
+		t.Fatalf("limited keys = %s, want [new mid]", got)
+	}
+
+	// 保存后过期的绑定在加载时丢弃
+	config.Get().AffinityMaxEntries = 100
+	config.Get().AffinityTTLMinutes = 1
+	short := newConversationMap()
+	if err := short.load(affinityFile()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(short.keys()); got != "[new]" {
+		t.Fatalf("keys with short TTL = %s, want [new]", got)
+	}
+}
+
+func TestConversationMapLoadErrors(t *testing.T) {
+	useAffinityLimits(t, 100, 30)
+	m := newConversationMap()
+	if err := m.load(t.TempDir() + "/missing.json"); !os.IsNotExist(err) {
+		t.Fatalf("missing file err = %v", err)
+	}
+	path := t.TempDir() + "/affinity.json"
+	os.WriteFile(path, []byte("{not json"), 0644)
+	if err := m.load(path); err == nil {
+		t.Fatal("invalid file loaded")
+	}
+	if m.Stats().Entries != 0 {
+		t.Fatal("entries added from invalid file")
+	}
+}
+
+func TestConversationMapConcurrentBindsAndInvalidations(t *testing.T) {
+	useAffinityLimits(t, 50, 30)
+	m := newConversationMap()
+
+	const workers = 16
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprintf("conv-%d", rng.Intn(80))
+				account := fmt.Sprintf("acc-%d", rng.Intn(4))
+				switch rng.Intn(8) {
+				case 0:
+					m.Invalidate(key, UnbindManual)
+				case 1:
+					m.InvalidateAccount(account, UnbindUnhealthy)
+				case 2:
+					m.RebindAccount(account, fmt.Sprintf("acc-%d", rng.Intn(4)))
+				case 3:
+					m.InvalidatePrefix(key, UnbindManual)
+				case 4:
+					m.Get(key)
+				default:
+					m.Bind(key, account)
+				}
+			}
+		}(w)
+	}
+	// 同时读取统计和列表
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			m.Stats()
+			m.Bindings()
+			m.pinnedCounts()
+		}
+	}()
+	wg.Wait()
+	<-done
+
+	m.checkConsistent(t)
+	stats := m.Stats()
+	if stats.Entries > 50 {
+		t.Fatalf("entries = %d, exceeds the limit", stats.Entries)
+	}
+	if stats.Hits > stats.Lookups {
+		t.Fatalf("hits %d > lookups %d", stats.Hits, stats.Lookups)
+	}
+}
+
+func TestConcurrentGetTokenKeepsConversationsPinned(t *testing.T) {
+	s := newTestStore(t, freshAccount("cc-1"), freshAccount("cc-2"), freshAccount("cc-3"))
+	m := GetConversationMap()
+	t.Cleanup(func() {
+		for _, id := range []string{"cc-1", "cc-2", "cc-3"} {
+			m.InvalidateAccount(id, UnbindManual)
+		}
+	})
+
+	// 每个会话的并发请求都落在同一个账号上
+	const conversations = 12
+	results := make([][]string, conversations)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for c := 0; c < conversations; c++ {
+		for r := 0; r < 8; r++ {
+			wg.Add(1)
+			go func(c int) {
+				defer wg.Done()
+				ctx := WithConversation(context.Background(), fmt.Sprintf("cc-conv-%d", c))
+				account, err := s.GetToken(ctx)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				results[c] = append(results[c], account.ID)
+				mu.Unlock()
+			}(c)
+		}
+	}
+	wg.Wait()
+
+	for c, ids := range results {
+		for _, id := range ids {
+			if id != ids[0] {
+				t.Fatalf("conversation %d served by %v", c, ids)
+			}
+		}
+	}
+}
+
+func TestGetTokenRebindsConversationFromUnhealthyAccount(t *testing.T) {
+	s := newTestStore(t, freshAccount("rh-1"), freshAccount("rh-2"))
+	m := GetConversationMap()
+	t.Cleanup(func() {
+		m.InvalidateAccount("rh-1", UnbindManual)
+		m.InvalidateAccount("rh-2", UnbindManual)
+	})
+	ctx := WithConversation(context.Background(), "rh-conv")
+
+	first, err := s.GetToken(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if account, _ := s.GetToken(ctx); account.ID != first.ID {
+			t.Fatalf("request %d moved to %s", i, account.ID)
+		}
+	}
+
+	// 绑定的账号被禁用后改绑到其他账号，计入 rebinds
+	before := m.Stats().Rebinds
+	s.mu.Lock()
+	for i := range s.accounts {
+		if s.accounts[i].ID == first.ID {
+			s.accounts[i].Enable = false
+		}
+	}
+	s.mu.Unlock()
+
+	second, err := s.GetToken(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID == first.ID {
+		t.Fatal("conversation stayed on the disabled account")
+	}
+	if m.Get("rh-conv") != second.ID {
+		t.Fatalf("binding = %q, want %s", m.Get("rh-conv"), second.ID)
+	}
+	if rebinds := m.Stats().Rebinds - before; rebinds != 1 {
+		t.Fatalf("rebinds = %d, want 1", rebinds)
+	}
+}
+
+func TestReservationsReleaseOnlyOwnBindings(t *testing.T) {
+	s := newTestStore(t, freshAccount("rs-1"), freshAccount("rs-2"))
+	m := GetConversationMap()
+	t.Cleanup(func() {
+		m.InvalidateAccount("rs-1", UnbindManual)
+		m.InvalidateAccount("rs-2", UnbindManual)
+	})
+
+	ctx, res := WithReservations(WithConversation(context.Background(), "rs-conv"))
+	account, err := s.GetToken(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 其他请求已把会话改绑到别的账号时，释放不影响新的绑定
+	other := "rs-1"
+	if account.ID == other {
+		other = "rs-2"
+	}
+	m.Bind("rs-conv", other)
+	if n := res.Release(UnbindAborted); n != 0 {
+		t.Fatalf("released %d bindings owned by another request", n)
+	}
+	if m.Get("rs-conv") != other {
+		t.Fatal("binding made by another request removed")
+	}
+
+	// 请求自己建立的绑定被解除
+	m.Invalidate("rs-conv", UnbindManual)
+	ctx, res = WithReservations(WithConversation(context.Background(), "rs-conv"))
+	if _, err := s.GetToken(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := res.Release(UnbindAborted); n != 1 || m.Get("rs-conv") != "" {
+		t.Fatalf("released %d, binding %q", n, m.Get("rs-conv"))
+	}
+	// 重复释放无效
+	if n := res.Release(UnbindAborted); n != 0 {
+		t.Fatalf("second release = %d", n)
+	}
+}
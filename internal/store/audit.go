@@ -0,0 +1,112 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+)
+
+// maxAuditEntries 内存中保留的最近审计记录数（完整记录追加到 audit.jsonl）
+const maxAuditEntries = 500
+
+// 审计事件
+const (
+	AuditDenied    = "denied"     // 角色不足被拒绝的管理接口请求
+	AuditLogSearch = "log_search" // 日志全文搜索（涉及请求和输出内容）
+
+	// API Key 超过用量阈值（warn 和 block 都记录，Principal 为 key:<Key 哈希前缀>）
+	AuditKeyLimitExceeded = "key_limit_exceeded"
+
+	// 错误预算触发的端点自动切换（Principal 为 system）
+	AuditEndpointDowngraded = "endpoint_downgraded"
+	AuditEndpointRestored   = "endpoint_restored"
+)
+
+// AuditEntry 审计记录
+type AuditEntry struct {
+	Time         time.Time `json:"time"`
+	Event        string    `json:"event"`
+	Principal    string    `json:"principal"`
+	Role         string    `json:"role"`
+	RequiredRole string    `json:"requiredRole,omitempty"`
+	Tenant       string    `json:"tenant,omitempty"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Route        string    `json:"route,omitempty"`
+	ClientIP     string    `json:"clientIp,omitempty"`
+	Query        string    `json:"query,omitempty"`      // 搜索内容
+	DurationMs   int64     `json:"durationMs,omitempty"` // 执行时间
+	Endpoint     string    `json:"endpoint,omitempty"`   // 切换后的端点
+	Detail       string    `json:"detail,omitempty"`     // 事件说明
+}
+
+// AuditLog 管理接口审计日志
+type AuditLog struct {
+	mu       sync.Mutex
+	entries  []AuditEntry
+	filePath string
+}
+
+var (
+	auditLog     *AuditLog
+	auditLogOnce sync.Once
+)
+
+// GetAuditLog 获取审计日志单例
+func GetAuditLog() *AuditLog {
+	auditLogOnce.Do(func() {
+		auditLog = &AuditLog{
+			filePath: filepath.Join(config.Get().DataDir, "audit.jsonl"),
+		}
+	})
+	return auditLog
+}
+
+// Record 记录审计事件（写入文件失败时只保留在内存中）
+func (a *AuditLog) Record(entry AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries = append(a.entries, entry)
+	if len(a.entries) > maxAuditEntries {
+		a.entries = a.entries[len(a.entries)-maxAuditEntries:]
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(a.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Warn("Failed to write audit log: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		logger.Warn("Failed to write audit log: %v", err)
+	}
+}
+
+// Recent 最近的审计记录（新的在前）
+func (a *AuditLog) Recent(limit int) []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if limit <= 0 || limit > len(a.entries) {
+		limit = len(a.entries)
+	}
+	result := make([]AuditEntry, 0, limit)
+	for i := len(a.entries) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, a.entries[i])
+	}
+	return result
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/utils"
+)
+
+// 批处理状态
+const (
+	BatchValidating = "validating"
+	BatchInProgress = "in_progress"
+	BatchCompleted  = "completed"
+	BatchFailed     = "failed"
+)
+
+// batchRetention 已结束批处理的保留时间
+const batchRetention = 24 * time.Hour
+
+// ErrBatchQuota API Key 的未结束批处理数达到上限
+var ErrBatchQuota = errors.New("too many active batches for this API key")
+
+// Batch OpenAI 兼容的批处理对象
+type Batch struct {
+	ID               string            `json:"id"`
+	Object           string            `json:"object"` // batch
+	Endpoint         string            `json:"endpoint"`
+	Errors           *BatchErrors      `json:"errors"`
+	InputFileID      string            `json:"input_file_id"`
+	CompletionWindow string            `json:"completion_window"`
+	Status           string            `json:"status"`
+	OutputFileID     *string           `json:"output_file_id"`
+	ErrorFileID      *string           `json:"error_file_id"`
+	CreatedAt        int64             `json:"created_at"`
+	InProgressAt     *int64            `json:"in_progress_at"`
+	CompletedAt      *int64            `json:"completed_at"`
+	FailedAt         *int64            `json:"failed_at"`
+	RequestCounts    BatchCounts       `json:"request_counts"`
+	Metadata         map[string]string `json:"metadata"`
+
+	keyHash string
+}
+
+// BatchErrors 批处理校验错误
+type BatchErrors struct {
+	Object string       `json:"object"` // list
+	Data   []BatchError `json:"data"`
+}
+
+// BatchError 单条校验错误
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    *int   `json:"line"`
+}
+
+// BatchCounts 请求计数
+type BatchCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// BatchStore 内存中的批处理列表（重启后丢失）
+type BatchStore struct {
+	mu      sync.Mutex
+	batches map[string]*Batch
+}
+
+var (
+	batchStore     *BatchStore
+	batchStoreOnce sync.Once
+)
+
+// GetBatchStore 获取批处理存储单例
+func GetBatchStore() *BatchStore {
+	batchStoreOnce.Do(func() {
+		batchStore = &BatchStore{batches: make(map[string]*Batch)}
+	})
+	return batchStore
+}
+
+// Create 创建批处理（状态为 validating），maxActive 为每个 Key 未结束批处理数上限（0 为不限）
+func (s *BatchStore) Create(keyHash, endpoint, inputFileID, window string, metadata map[string]string, maxActive int) (*Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanupUnlocked()
+	if maxActive > 0 {
+		active := 0
+		for _, b := range s.batches {
+			if b.keyHash == keyHash && !b.finished() {
+				active++
+			}
+		}
+		if active >= maxActive {
+			return nil, ErrBatchQuota
+		}
+	}
+
+	batch := &Batch{
+		ID:               "batch_" + utils.GenerateSecureToken(12),
+		Object:           "batch",
+		Endpoint:         endpoint,
+		InputFileID:      inputFileID,
+		CompletionWindow: window,
+		Status:           BatchValidating,
+		CreatedAt:        time.Now().Unix(),
+		Metadata:         metadata,
+		keyHash:          keyHash,
+	}
+	s.batches[batch.ID] = batch
+	copied := *batch
+	return &copied, nil
+}
+
+// Update 修改批处理（update 在锁内执行）
+func (s *BatchStore) Update(id string, update func(b *Batch)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if batch, ok := s.batches[id]; ok {
+		update(batch)
+	}
+}
+
+// Get 获取批处理（只能访问同一 API Key 创建的批处理）
+func (s *BatchStore) Get(id, keyHash string) *Batch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch, ok := s.batches[id]
+	if !ok || batch.keyHash != keyHash {
+		return nil
+	}
+	copied := *batch
+	return &copied
+}
+
+// List 列出 API Key 的批处理（新的在前）
+func (s *BatchStore) List(keyHash string) []Batch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanupUnlocked()
+	list := make([]Batch, 0)
+	for _, b := range s.batches {
+		if b.keyHash == keyHash {
+			list = append(list, *b)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt > list[j].CreatedAt })
+	return list
+}
+
+func (b *Batch) finished() bool {
+	return b.Status == BatchCompleted || b.Status == BatchFailed
+}
+
+// cleanupUnlocked 清理超过保留时间的已结束批处理
+func (s *BatchStore) cleanupUnlocked() {
+	cutoff := time.Now().Add(-batchRetention).Unix()
+	for id, b := range s.batches {
+		if !b.finished() {
+			continue
+		}
+		endedAt := b.CreatedAt
+		if b.CompletedAt != nil {
+			endedAt = *b.CompletedAt
+		} else if b.FailedAt != nil {
+			endedAt = *b.FailedAt
+		}
+		if endedAt < cutoff {
+			delete(s.batches, id)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+)
+
+// ErrBlobNotFound 数据不存在（已被淘汰或进程重启后被清理）
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore 大块数据存储（缓冲的响应体等）
+type BlobStore interface {
+	Put(data []byte) (string, error)
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// SpillStats 落盘统计
+type SpillStats struct {
+	Dir          string `json:"dir"`
+	ThresholdKB  int    `json:"thresholdKb"`
+	BudgetMB     int    `json:"budgetMb"`
+	Blobs        int    `json:"blobs"`        // 当前落盘的数据块数
+	Bytes        int64  `json:"bytes"`        // 当前落盘字节数
+	SpilledTotal int64  `json:"spilledTotal"` // 累计落盘次数
+	SpilledBytes int64  `json:"spilledBytes"` // 累计落盘字节数
+	ReadBacks    int64  `json:"readBacks"`    // 累计读回次数
+	Evicted      int64  `json:"evicted"`      // 超出磁盘预算被淘汰的数据块数
+}
+
+// diskBlob 落盘数据块
+type diskBlob struct {
+	size      int64
+	createdAt time.Time
+}
+
+// DiskBlobStore 临时目录中的落盘存储
+// 目录在启动时清空，不保证进程重启后数据仍然存在；超出磁盘预算时淘汰最旧的数据块
+type DiskBlobStore struct {
+	mu     sync.Mutex
+	dir    string
+	budget int64
+	blobs  map[string]*diskBlob
+	stats  SpillStats
+}
+
+var (
+	spillStore     *DiskBlobStore
+	spillStoreOnce sync.Once
+)
+
+// GetSpillStore 获取落盘存储单例
+func GetSpillStore() *DiskBlobStore {
+	spillStoreOnce.Do(func() {
+		cfg := config.Get()
+		dir := cfg.SpillDir
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "anti2api-spill")
+		}
+		spillStore = NewDiskBlobStore(dir, int64(cfg.SpillMaxMB)*1024*1024)
+		spillStore.stats.ThresholdKB = cfg.SpillThresholdKB
+		spillStore.stats.BudgetMB = cfg.SpillMaxMB
+	})
+	return spillStore
+}
+
+// NewDiskBlobStore 创建落盘存储（清空目录中的遗留数据）
+func NewDiskBlobStore(dir string, budget int64) *DiskBlobStore {
+	if err := os.RemoveAll(dir); err != nil {
+		logger.Warn("Failed to clean spill dir %s: %v", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		logger.Warn("Failed to create spill dir %s: %v", dir, err)
+	}
+	return &DiskBlobStore{
+		dir:    dir,
+		budget: budget,
+		blobs:  make(map[string]*diskBlob),
+		stats:  SpillStats{Dir: dir},
+	}
+}
+
+// ShouldSpill 检查数据是否超过落盘阈值
+func ShouldSpill(size int) bool {
+	threshold := config.Get().SpillThresholdKB
+	return threshold > 0 && size > threshold*1024
+}
+
+func (s *DiskBlobStore) path(key string) string {
+	return filepath.Join(s.dir, key)
+}
+
+// Put 写入数据（先写临时文件再重命名，避免读到写了一半的文件）
+func (s *DiskBlobStore) Put(data []byte) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(buf)
+
+	tmp := s.path(key + ".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, s.path(key)); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blobs[key] = &diskBlob{size: int64(len(data)), createdAt: time.Now()}
+	s.stats.Blobs++
+	s.stats.Bytes += int64(len(data))
+	s.stats.SpilledTotal++
+	s.stats.SpilledBytes += int64(len(data))
+	s.evictUnlocked(key)
+	return key, nil
+}
+
+// evictUnlocked 超出磁盘预算时淘汰最旧的数据块（不淘汰刚写入的 keep）
+func (s *DiskBlobStore) evictUnlocked(keep string) {
+	if s.budget <= 0 || s.stats.Bytes <= s.budget {
+		return
+	}
+
+	keys := make([]string, 0, len(s.blobs))
+	for key := range s.blobs {
+		if key != keep {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return s.blobs[keys[i]].createdAt.Before(s.blobs[keys[j]].createdAt)
+	})
+
+	for _, key := range keys {
+		if s.stats.Bytes <= s.budget {
+			break
+		}
+		s.removeUnlocked(key)
+		s.stats.Evicted++
+	}
+}
+
+func (s *DiskBlobStore) removeUnlocked(key string) {
+	blob, ok := s.blobs[key]
+	if !ok {
+		return
+	}
+	os.Remove(s.path(key))
+	delete(s.blobs, key)
+	s.stats.Blobs--
+	s.stats.Bytes -= blob.size
+}
+
+// Get 读回数据
+func (s *DiskBlobStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	_, ok := s.blobs[key]
+	if ok {
+		s.stats.ReadBacks++
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+	data, err := os.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+	return data, err
+}
+
+// Delete 删除数据
+func (s *DiskBlobStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeUnlocked(key)
+	return nil
+}
+
+// Stats 获取落盘统计
+func (s *DiskBlobStore) Stats() SpillStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
@@ -0,0 +1,341 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/persist"
+)
+
+// StoredCompletion 保存的聊天完成（store: true）
+type StoredCompletion struct {
+	ID         string          `json:"id"`
+	KeyHash    string          `json:"keyHash"` // 创建该记录的 API Key 哈希
+	CreatedAt  time.Time       `json:"createdAt"`
+	Completion json.RawMessage `json:"completion"`
+	Request    json.RawMessage `json:"request,omitempty"`
+	Blob       string          `json:"blob,omitempty"`      // 落盘数据的 key（Completion 较大时）
+	SpillSize  int             `json:"spillSize,omitempty"` // 落盘数据大小
+}
+
+func (c *StoredCompletion) size() int {
+	return len(c.Completion) + len(c.Request) + c.SpillSize
+}
+
+// release 释放落盘数据
+func (c *StoredCompletion) release() {
+	if c.Blob != "" {
+		GetSpillStore().Delete(c.Blob)
+	}
+}
+
+// completionSaveDelay 修改后延迟保存的时间，合并短时间内的多次修改
+const completionSaveDelay = time.Second
+
+// CompletionStore 聊天完成存储（带 TTL、总容量上限和每个 Key 的配额）。
+// 记录按创建时间排列，淘汰从最旧的一端进行；修改由单个后台协程延迟写入文件
+type CompletionStore struct {
+	mu        sync.RWMutex
+	items     map[string]*completionEntry
+	order     *list.List            // 全部记录，从旧到新（值为 *completionEntry）
+	byKey     map[string]*list.List // 每个 API Key 的记录，从旧到新
+	totalSize int
+	filePath  string
+	ttl       time.Duration
+	maxSize   int
+	keyQuota  int
+
+	dirty  bool
+	saveCh chan struct{} // 通知后台协程有未保存的修改
+	saveMu sync.Mutex    // 串行化文件写入
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// completionEntry 记录及其在两个列表中的位置
+type completionEntry struct {
+	item *StoredCompletion
+	all  *list.Element
+	key  *list.Element
+}
+
+var (
+	completionStore     *CompletionStore
+	completionStoreOnce sync.Once
+)
+
+// GetCompletionStore 获取聊天完成存储单例
+func GetCompletionStore() *CompletionStore {
+	completionStoreOnce.Do(func() {
+		cfg := config.Get()
+		completionStore = newCompletionStore(
+			filepath.Join(cfg.DataDir, "completions.json"),
+			time.Duration(cfg.CompletionStoreTTL)*time.Hour,
+			cfg.CompletionStoreMaxMB*1024*1024,
+			cfg.CompletionStoreKeyQuota,
+		)
+		completionStore.Load()
+		monitor.Go("completion-save", completionStore.saveLoop)
+	})
+	return completionStore
+}
+
+func newCompletionStore(filePath string, ttl time.Duration, maxSize, keyQuota int) *CompletionStore {
+	return &CompletionStore{
+		items:    make(map[string]*completionEntry),
+		order:    list.New(),
+		byKey:    make(map[string]*list.List),
+		filePath: filePath,
+		ttl:      ttl,
+		maxSize:  maxSize,
+		keyQuota: keyQuota,
+		saveCh:   make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Load 加载已保存的聊天完成
+func (s *CompletionStore) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := persist.ReadFile(s.filePath, persist.ValidJSON)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var items []*StoredCompletion
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		// 落盘目录启动时已清空，落盘的记录无法恢复
+		if item.Blob != "" {
+			continue
+		}
+		if old, ok := s.items[item.ID]; ok {
+			s.removeUnlocked(old)
+		}
+		s.insertUnlocked(item)
+	}
+	s.evictUnlocked("")
+	return nil
+}
+
+// Add 保存聊天完成，超出配额或容量时淘汰最旧的记录
+func (s *CompletionStore) Add(item *StoredCompletion) {
+	if item.CreatedAt.IsZero() {
+		item.CreatedAt = time.Now()
+	}
+
+	// 较大的响应落盘，内存中只保留 key
+	if ShouldSpill(len(item.Completion)) {
+		if key, err := GetSpillStore().Put(item.Completion); err != nil {
+			logger.Warn("Failed to spill completion %s: %v", item.ID, err)
+		} else {
+			item.Blob = key
+			item.SpillSize = len(item.Completion)
+			item.Completion = nil
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.items[item.ID]; ok {
+		s.removeUnlocked(old)
+	}
+	s.insertUnlocked(item)
+	s.evictUnlocked(item.KeyHash)
+	s.markDirtyUnlocked()
+}
+
+// insertUnlocked 按创建时间插入（新记录通常在末尾，只需向前比较很少几项）
+func (s *CompletionStore) insertUnlocked(item *StoredCompletion) {
+	e := &completionEntry{item: item}
+	e.all = insertByTime(s.order, e)
+	keyList, ok := s.byKey[item.KeyHash]
+	if !ok {
+		keyList = list.New()
+		s.byKey[item.KeyHash] = keyList
+	}
+	e.key = insertByTime(keyList, e)
+	s.items[item.ID] = e
+	s.totalSize += item.size()
+}
+
+func insertByTime(l *list.List, e *completionEntry) *list.Element {
+	for at := l.Back(); at != nil; at = at.Prev() {
+		if !e.item.CreatedAt.Before(at.Value.(*completionEntry).item.CreatedAt) {
+			return l.InsertAfter(e, at)
+		}
+	}
+	return l.PushFront(e)
+}
+
+// removeUnlocked 删除记录并释放落盘数据
+func (s *CompletionStore) removeUnlocked(e *completionEntry) {
+	s.order.Remove(e.all)
+	if keyList := s.byKey[e.item.KeyHash]; keyList != nil {
+		keyList.Remove(e.key)
+		if keyList.Len() == 0 {
+			delete(s.byKey, e.item.KeyHash)
+		}
+	}
+	delete(s.items, e.item.ID)
+	s.totalSize -= e.item.size()
+	e.item.release()
+}
+
+// evictUnlocked 淘汰过期记录、超出 Key 配额和总容量的记录（都从最旧的一端开始）
+func (s *CompletionStore) evictUnlocked(keyHash string) {
+	if s.ttl > 0 {
+		cutoff := time.Now().Add(-s.ttl)
+		for front := s.order.Front(); front != nil; front = s.order.Front() {
+			e := front.Value.(*completionEntry)
+			if !e.item.CreatedAt.Before(cutoff) {
+				break
+			}
+			s.removeUnlocked(e)
+		}
+	}
+	if keyHash != "" && s.keyQuota > 0 {
+		for keyList := s.byKey[keyHash]; keyList != nil && keyList.Len() > s.keyQuota; keyList = s.byKey[keyHash] {
+			s.removeUnlocked(keyList.Front().Value.(*completionEntry))
+		}
+	}
+	for s.maxSize > 0 && s.totalSize > s.maxSize && s.order.Len() > 0 {
+		s.removeUnlocked(s.order.Front().Value.(*completionEntry))
+	}
+}
+
+// markDirtyUnlocked 标记有未保存的修改并通知后台协程
+func (s *CompletionStore) markDirtyUnlocked() {
+	s.dirty = true
+	select {
+	case s.saveCh <- struct{}{}:
+	default:
+	}
+}
+
+// saveLoop 后台写入：收到修改通知后等待 completionSaveDelay 合并后续修改，再写入一次
+func (s *CompletionStore) saveLoop() {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.saveCh:
+		}
+		timer := time.NewTimer(completionSaveDelay)
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := s.Flush(); err != nil {
+			logger.Warn("Failed to save completions: %v", err)
+		}
+	}
+}
+
+// Flush 写入未保存的修改（按创建时间从旧到新）
+func (s *CompletionStore) Flush() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	// 记录加入后不再修改，复制指针即可在锁外编码
+	items := make([]*StoredCompletion, 0, s.order.Len())
+	for e := s.order.Front(); e != nil; e = e.Next() {
+		items = append(items, e.Value.(*completionEntry).item)
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	data, err := json.Marshal(items)
+	if err == nil {
+		err = persist.WriteFile(s.filePath, data, 0644)
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// Close 停止后台写入协程并写入未保存的修改
+func (s *CompletionStore) Close(ctx context.Context) error {
+	s.once.Do(func() { close(s.stop) })
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.Flush()
+}
+
+// Get 按 ID 获取（仅返回同一 API Key 创建的记录）
+func (s *CompletionStore) Get(id, keyHash string) *StoredCompletion {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.items[id]
+	if !ok || e.item.KeyHash != keyHash {
+		return nil
+	}
+	item := e.item
+	if s.ttl > 0 && time.Since(item.CreatedAt) > s.ttl {
+		return nil
+	}
+	if item.Blob == "" {
+		return item
+	}
+
+	// 读回落盘数据（可能已因磁盘预算被淘汰）
+	data, err := GetSpillStore().Get(item.Blob)
+	if err != nil {
+		if !errors.Is(err, ErrBlobNotFound) {
+			logger.Warn("Failed to read spilled completion %s: %v", id, err)
+		}
+		return nil
+	}
+	loaded := *item
+	loaded.Completion = data
+	return &loaded
+}
+
+// Delete 删除（仅允许删除同一 API Key 创建的记录）
+func (s *CompletionStore) Delete(id, keyHash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.items[id]
+	if !ok || e.item.KeyHash != keyHash {
+		return false
+	}
+	s.removeUnlocked(e)
+	s.markDirtyUnlocked()
+	return true
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testCompletion(id, key string, created time.Time, size int) *StoredCompletion {
+	body, _ := json.Marshal(map[string]string{"id": id, "pad": string(make([]byte, size))})
+	return &StoredCompletion{ID: id, KeyHash: key, CreatedAt: created, Completion: body}
+}
+
+func completionIDs(s *CompletionStore) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ids []string
+	for e := s.order.Front(); e != nil; e = e.Next() {
+		ids = append(ids, e.Value.(*completionEntry).item.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []string) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func TestCompletionStoreKeyQuotaEvictsOldestOfKey(t *testing.T) {
+	s := newCompletionStore(filepath.Join(t.TempDir(), "c.json"), 0, 0, 2)
+	base := time.Now()
+	s.Add(testCompletion("a1", "a", base, 0))
+	s.Add(testCompletion("b1", "b", base.Add(time.Second), 0))
+	s.Add(testCompletion("a2", "a", base.Add(2*time.Second), 0))
+	s.Add(testCompletion("a3", "a", base.Add(3*time.Second), 0))
+
+	if got := completionIDs(s); !equalIDs(got, []string{"b1", "a2", "a3"}) {
+		t.Errorf("ids = %v", got)
+	}
+	if s.Get("a1", "a") != nil {
+		t.Error("a1 should have been evicted")
+	}
+	if s.Get("b1", "b") == nil {
+		t.Error("other key's completion was evicted")
+	}
+}
+
+func TestCompletionStoreSizeCapEvictsOldest(t *testing.T) {
+	one := testCompletion("c0", "k", time.Now(), 100).size()
+	s := newCompletionStore(filepath.Join(t.TempDir(), "c.json"), 0, one*2, 0)
+	base := time.Now()
+	for i := 0; i < 4; i++ {
+		s.Add(testCompletion(fmt.Sprintf("c%d", i), "k", base.Add(time.Duration(i)*time.Second), 100))
+	}
+	if got := completionIDs(s); !equalIDs(got, []string{"c2", "c3"}) {
+		t.Errorf("ids = %v", got)
+	}
+	if s.totalSize > one*2 {
+		t.Errorf("total size %d exceeds cap %d", s.totalSize, one*2)
+	}
+}
+
+func TestCompletionStoreTTLAndOrdering(t *testing.T) {
+	s := newCompletionStore(filepath.Join(t.TempDir(), "c.json"), time.Hour, 0, 0)
+	now := time.Now()
+	s.Add(testCompletion("new", "k", now, 0))
+	// 创建时间更早的记录插入到前面，过期的记录在下一次 Add 时淘汰
+	s.Add(testCompletion("mid", "k", now.Add(-30*time.Minute), 0))
+	s.Add(testCompletion("old", "k", now.Add(-2*time.Hour), 0))
+	if got := completionIDs(s); !equalIDs(got, []string{"mid", "new"}) {
+		t.Errorf("ids = %v", got)
+	}
+
+	// 替换同一 ID 不重复计算大小
+	s.Add(testCompletion("mid", "k", now.Add(-30*time.Minute), 10))
+	if got := completionIDs(s); !equalIDs(got, []string{"mid", "new"}) {
+		t.Errorf("ids after replace = %v", got)
+	}
+	want := testCompletion("mid", "k", now, 10).size() + testCompletion("new", "k", now, 0).size()
+	if s.totalSize != want {
+		t.Errorf("total size = %d, want %d", s.totalSize, want)
+	}
+}
+
+func TestCompletionStoreFlushAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "c.json")
+	s := newCompletionStore(path, 0, 0, 0)
+	base := time.Now()
+	s.Add(testCompletion("a", "k", base, 0))
+	s.Add(testCompletion("b", "k", base.Add(time.Second), 0))
+	s.Add(testCompletion("c", "k", base.Add(2*time.Second), 0))
+	if !s.Delete("b", "k") {
+		t.Fatal("delete failed")
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Fatal("file written before Flush: writes should be deferred to the background writer")
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newCompletionStore(path, 0, 0, 0)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := completionIDs(loaded); !equalIDs(got, []string{"a", "c"}) {
+		t.Errorf("reloaded ids = %v", got)
+	}
+}
+
+func TestCompletionStoreSingleWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "c.json")
+	s := newCompletionStore(path, 0, 0, 0)
+	go s.saveLoop()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				s.Add(testCompletion(fmt.Sprintf("w%d-%d", w, i), "k", time.Time{}, 10))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newCompletionStore(path, 0, 0, 0)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(completionIDs(loaded)); n != 400 {
+		t.Errorf("reloaded %d completions, want 400", n)
+	}
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/notify"
+)
+
+// 暂停选用的原因
+const (
+	CooldownFailover    = "failover"        // 请求切换账号时上游拒绝了该账号
+	CooldownRateLimited = "rate_limited"    // 上游返回 429（配额耗尽）
+	CooldownRejected    = "unauthenticated" // 上游拒绝了 access_token（恢复后先刷新 Token）
+)
+
+// InCooldown 账号是否因上游错误暂停选用（运行时状态，重启后清除；到期后选择账号时自然恢复，无需后台清理）
+func (a *Account) InCooldown(now time.Time) bool {
+	return now.Before(a.CooldownUntil)
+}
+
+// MarkUnavailable 请求切换账号时暂停选用失败的账号（不影响启用状态）
+func (s *AccountStore) MarkUnavailable(id string, d time.Duration, reason string) {
+	s.setCooldown(id, d, CooldownFailover, reason)
+}
+
+// MarkRateLimited 上游返回 429 时暂停选用账号 d 时长
+func (s *AccountStore) MarkRateLimited(id string, d time.Duration) {
+	s.setCooldown(id, d, CooldownRateLimited, "upstream rate limited")
+}
+
+// MarkUnauthenticated 上游拒绝 access_token 时暂停选用账号 d 时长，并使可刷新凭证的 Token 过期，
+// 恢复后被选中时先刷新（refresh_token 已被撤销时由刷新流程禁用账号）。access_token 可能只是过期或时钟偏差，不直接禁用
+func (s *AccountStore) MarkUnauthenticated(id string, d time.Duration) {
+	s.setCooldown(id, d, CooldownRejected, "upstream UNAUTHENTICATED")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.accounts {
+		account := &s.accounts[i]
+		if account.ID == id && account.CredentialType() != CredentialStatic {
+			account.ExpiresIn = 0
+			return
+		}
+	}
+}
+
+// setCooldown 延长账号的暂停时间（已有更晚的截止时间时保持不变）；账号开始暂停时发送告警
+func (s *AccountStore) setCooldown(id string, d time.Duration, kind, reason string) {
+	if id == "" || d <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.accounts {
+		account := &s.accounts[i]
+		if account.ID != id {
+			continue
+		}
+		// 已在暂停中的账号保留最初的原因（429 后请求切换账号时仍显示为限流）
+		now := time.Now()
+		opened := !account.InCooldown(now)
+		if opened {
+			account.CooldownReason = kind
+		}
+		if until := now.Add(d); until.After(account.CooldownUntil) {
+			account.CooldownUntil = until
+		}
+		logger.Warn("Account %s unavailable for %s: %s", account.Email, d, reason)
+		if opened {
+			notify.Fire(notify.EventCircuitOpen, "Account paused after upstream rejection", map[string]interface{}{
+				"account": account.Email,
+				"reason":  kind,
+				"detail":  reason,
+				"until":   account.CooldownUntil,
+			})
+			s.checkCooldownStormUnlocked(now)
+		}
+		return
+	}
+}
+
+// checkCooldownStormUnlocked 暂停选用的账号占启用账号的比例达到 COOLDOWN_STORM_THRESHOLD 时发送告警（至少 2 个账号）
+func (s *AccountStore) checkCooldownStormUnlocked(now time.Time) {
+	threshold := config.Get().CooldownStorm
+	if threshold <= 0 {
+		return
+	}
+	enabled, cooling := 0, 0
+	for i := range s.accounts {
+		if !s.accounts[i].Enable {
+			continue
+		}
+		enabled++
+		if s.accounts[i].InCooldown(now) {
+			cooling++
+		}
+	}
+	if cooling < 2 || cooling*100 < enabled*threshold {
+		return
+	}
+	notify.Fire(notify.EventCooldownStorm, "Many accounts are paused at the same time", map[string]interface{}{
+		"paused":    cooling,
+		"enabled":   enabled,
+		"threshold": threshold,
+	})
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/notify"
+)
+
+func TestMarkUnauthenticatedKeepsAccountEnabled(t *testing.T) {
+	s := newTestStore(t, freshAccount("a"))
+
+	s.MarkUnauthenticated("a", time.Minute)
+
+	account := s.accounts[0]
+	if !account.Enable {
+		t.Fatal("account was disabled; a rejected access token must only pause the account")
+	}
+	if !account.InCooldown(time.Now()) || account.CooldownReason != CooldownRejected {
+		t.Fatalf("cooldown = %v (%q), want active %q", account.CooldownUntil, account.CooldownReason, CooldownRejected)
+	}
+	if !account.IsExpired() {
+		t.Fatal("access token should be expired so the next selection refreshes it")
+	}
+}
+
+func TestMarkUnauthenticatedKeepsStaticToken(t *testing.T) {
+	static := freshAccount("s")
+	static.Type = CredentialStatic
+	static.RefreshToken = ""
+	static.ExpiresIn = 0
+	s := newTestStore(t, static)
+
+	s.MarkUnauthenticated("s", time.Minute)
+
+	if account := s.accounts[0]; !account.Enable || account.IsExpired() {
+		t.Fatalf("static account enable=%v expired=%v, want enabled and not expired", account.Enable, account.IsExpired())
+	}
+}
+
+func TestCooldownKeepsFirstReason(t *testing.T) {
+	s := newTestStore(t, freshAccount("a"))
+
+	s.MarkRateLimited("a", time.Minute)
+	s.MarkUnavailable("a", 2*time.Minute, "failover")
+
+	account := s.accounts[0]
+	if account.CooldownReason != CooldownRateLimited {
+		t.Fatalf("reason = %q, want %q", account.CooldownReason, CooldownRateLimited)
+	}
+	if until := time.Until(account.CooldownUntil); until < time.Minute+30*time.Second {
+		t.Fatalf("cooldown was not extended: %v left", until)
+	}
+}
+
+// forAccount 匹配指定账号的事件
+func forAccount(email string) func(map[string]interface{}) bool {
+	return func(details map[string]interface{}) bool { return details["account"] == email }
+}
+
+func TestCooldownFiresCircuitOpenOnce(t *testing.T) {
+	s := newTestStore(t, freshAccount("open-a"), freshAccount("open-b"), freshAccount("open-c"))
+
+	s.MarkRateLimited("open-a", time.Minute)
+	payload, ok := waitWebhook(t, notify.EventCircuitOpen, forAccount("open-a@example.com"), 5*time.Second)
+	if !ok {
+		t.Fatal("no circuit_breaker_open event when the account entered cooldown")
+	}
+	if payload.Details["reason"] != CooldownRateLimited {
+		t.Errorf("details = %v", payload.Details)
+	}
+
+	// 已在暂停中的账号延长暂停时不再告警
+	s.MarkUnavailable("open-a", 2*time.Minute, "failover")
+	if p, ok := waitWebhook(t, notify.EventCircuitOpen, forAccount("open-a@example.com"), 200*time.Millisecond); ok {
+		t.Errorf("extending a cooldown fired another event: %+v", p)
+	}
+}
+
+func TestCooldownStorm(t *testing.T) {
+	disabled := freshAccount("storm-d")
+	disabled.Enable = false
+	s := newTestStore(t, freshAccount("storm-a"), freshAccount("storm-b"), freshAccount("storm-c"), freshAccount("storm-e"), disabled)
+	// 其他测试的账号数不同，按启用账号数区分本测试的事件
+	ofThisStore := func(details map[string]interface{}) bool { return details["enabled"] == float64(4) }
+
+	// 阈值 50%：4 个启用账号中第 2 个暂停时触发（禁用账号不计入）
+	s.MarkRateLimited("storm-a", time.Minute)
+	if _, ok := waitWebhook(t, notify.EventCooldownStorm, ofThisStore, 200*time.Millisecond); ok {
+		t.Fatal("one paused account should not be a storm")
+	}
+	s.MarkUnauthenticated("storm-b", time.Minute)
+	payload, ok := waitWebhook(t, notify.EventCooldownStorm, ofThisStore, 5*time.Second)
+	if !ok {
+		t.Fatal("no cooldown_storm event with half of the enabled accounts paused")
+	}
+	if payload.Details["paused"] != float64(2) || payload.Details["threshold"] != float64(50) {
+		t.Errorf("details = %v", payload.Details)
+	}
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 凭证类型
+const (
+	CredentialOAuth          = "oauth"           // Google OAuth refresh_token（默认）
+	CredentialStatic         = "static"          // 长期 access_token，不刷新，过期后停用
+	CredentialServiceAccount = "service_account" // 服务账号 JSON 密钥，通过 JWT 换取 access_token
+)
+
+// ErrCredentialExpired 静态 access_token 已过期（无法刷新）
+var ErrCredentialExpired = errors.New("static access token expired")
+
+// CredentialProvider 账号凭证：获取新的 access_token 及其过期时间（零值表示不过期）。
+// 由刷新流程在持有账号存储锁时调用，实现可以更新所属账号的凭证字段（如轮换后的 refresh_token）
+type CredentialProvider interface {
+	Token(ctx context.Context) (string, time.Time, error)
+}
+
+// ServiceAccountKey 服务账号 JSON 密钥中使用的字段
+type ServiceAccountKey struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id,omitempty"`
+	TokenURI     string `json:"token_uri,omitempty"`
+	ProjectID    string `json:"project_id,omitempty"`
+}
+
+// RSAKey 解析 PEM 格式的私钥（PKCS#8 或 PKCS#1）
+func (k *ServiceAccountKey) RSAKey() (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return nil, errors.New("private_key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("private_key is not an RSA key")
+		}
+		return rsaKey, nil
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("private_key is not a valid RSA private key")
+	}
+	return key, nil
+}
+
+// Validate 检查密钥字段
+func (k *ServiceAccountKey) Validate() error {
+	if k.ClientEmail == "" {
+		return errors.New("missing client_email")
+	}
+	if k.PrivateKey == "" {
+		return errors.New("missing private_key")
+	}
+	_, err := k.RSAKey()
+	return err
+}
+
+// ParseServiceAccountJSON 解析服务账号 JSON 密钥文件
+func ParseServiceAccountJSON(data string) (*ServiceAccountKey, error) {
+	var key ServiceAccountKey
+	if err := json.Unmarshal([]byte(data), &key); err != nil {
+		return nil, fmt.Errorf("invalid service account JSON: %v", err)
+	}
+	return &key, nil
+}
+
+var (
+	credentialMu        sync.RWMutex
+	credentialProviders = map[string]func(*Account) CredentialProvider{
+		CredentialStatic: func(a *Account) CredentialProvider { return staticCredential{account: a} },
+	}
+)
+
+// RegisterCredentialProvider 注册凭证类型的实现（OAuth、服务账号由 auth 包注册）
+func RegisterCredentialProvider(credType string, factory func(*Account) CredentialProvider) {
+	credentialMu.Lock()
+	defer credentialMu.Unlock()
+	credentialProviders[credType] = factory
+}
+
+// CredentialType 账号的凭证类型（未设置时为 oauth）
+func (a *Account) CredentialType() string {
+	if a.Type == "" {
+		return CredentialOAuth
+	}
+	return a.Type
+}
+
+// Credentials 账号的凭证实现
+func (a *Account) Credentials() (CredentialProvider, error) {
+	credentialMu.RLock()
+	factory, ok := credentialProviders[a.CredentialType()]
+	credentialMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported credential type %q", a.CredentialType())
+	}
+	return factory(a), nil
+}
+
+// ValidCredentialType 是否为支持的凭证类型
+func ValidCredentialType(credType string) bool {
+	switch credType {
+	case "", CredentialOAuth, CredentialStatic, CredentialServiceAccount:
+		return true
+	}
+	return false
+}
+
+// tokenExpiry access_token 的过期时间（零值表示未知或不过期）
+func (a *Account) tokenExpiry() time.Time {
+	if a.Timestamp == 0 || a.ExpiresIn == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(a.Timestamp + int64(a.ExpiresIn)*1000)
+}
+
+// setToken 更新 access_token 及过期时间
+func (a *Account) setToken(token string, expiry time.Time) {
+	now := time.Now()
+	a.AccessToken = token
+	a.Timestamp = now.UnixMilli()
+	a.ExpiresIn = 0
+	if !expiry.IsZero() {
+		a.ExpiresIn = int(expiry.Sub(now).Seconds())
+	}
+}
+
+// refreshCredentials 通过凭证实现获取新的 access_token
+func refreshCredentials(account *Account) error {
+	provider, err := account.Credentials()
+	if err != nil {
+		return err
+	}
+	token, expiry, err := provider.Token(context.Background())
+	if err != nil {
+		return err
+	}
+	account.setToken(token, expiry)
+	return nil
+}
+
+// ValidateCredentials 获取一次 access_token 以校验尚未保存的账号的凭证（不持有账号存储锁）
+func ValidateCredentials(ctx context.Context, account *Account) error {
+	provider, err := account.Credentials()
+	if err != nil {
+		return err
+	}
+	token, expiry, err := provider.Token(ctx)
+	if err != nil {
+		return err
+	}
+	account.setToken(token, expiry)
+	return nil
+}
+
+// staticCredential 静态 access_token：不刷新，过期时间到达后返回 ErrCredentialExpired
+type staticCredential struct {
+	account *Account
+}
+
+func (c staticCredential) Token(ctx context.Context) (string, time.Time, error) {
+	expiry := c.account.tokenExpiry()
+	if !expiry.IsZero() && !time.Now().Before(expiry) {
+		return "", time.Time{}, ErrCredentialExpired
+	}
+	return c.account.AccessToken, expiry, nil
+}
+
+// setStaticExpiry 设置静态令牌的过期时间（零值表示不过期）
+func (a *Account) setStaticExpiry(expiry time.Time) {
+	a.setToken(a.AccessToken, expiry)
+	if !expiry.IsZero() && a.ExpiresIn == 0 {
+		// ExpiresIn 为 0 表示不过期，恰好到期时记为已过期
+		a.ExpiresIn = -1
+	}
+}
+
+// unescapePEM TOML 单行字符串中的 \n 转义还原为换行
+func unescapePEM(key string) string {
+	return strings.ReplaceAll(key, `\n`, "\n")
+}
@@ -0,0 +1,307 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/persist"
+	"anti2api-golang/internal/utils"
+)
+
+// 延迟请求状态
+const (
+	DeferredQueued     = "queued"
+	DeferredInProgress = "in_progress"
+	DeferredCompleted  = "completed" // 上游返回成功
+	DeferredFailed     = "failed"    // 重试时返回了不可重试的错误
+	DeferredExpired    = "expired"   // 超过最长等待时间仍无可用账号
+	DeferredCancelled  = "cancelled" // 管理员取消
+)
+
+var (
+	// ErrDeferredQueueFull 延迟队列已满
+	ErrDeferredQueueFull = errors.New("deferred queue is full")
+	// ErrDeferredQuota API Key 等待重试的请求数达到上限
+	ErrDeferredQuota = errors.New("too many deferred requests for this API key")
+)
+
+// DeferredResponse 重试得到的响应
+type DeferredResponse struct {
+	StatusCode int             `json:"status_code"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// DeferredRequest 等待账号恢复后重试的请求（非流式 /v1/chat/completions）
+type DeferredRequest struct {
+	ID          string            `json:"id"`
+	KeyHash     string            `json:"keyHash"` // 创建该请求的 API Key 哈希
+	Tenant      string            `json:"tenant,omitempty"`
+	Model       string            `json:"model"`
+	Body        json.RawMessage   `json:"body"` // 客户端请求（OpenAI 格式）
+	CallbackURL string            `json:"callbackUrl,omitempty"`
+	Status      string            `json:"status"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	Deadline    time.Time         `json:"deadline"` // 超过后不再重试
+	NextAttempt time.Time         `json:"nextAttempt"`
+	FinishedAt  *time.Time        `json:"finishedAt,omitempty"`
+	Attempts    int               `json:"attempts"`
+	LastError   string            `json:"lastError,omitempty"`
+	Response    *DeferredResponse `json:"response,omitempty"`
+
+	// Authorization 原请求的认证头（只在内存中保留，重启后恢复的请求不带 API Key 重试）
+	Authorization string `json:"-"`
+}
+
+// Pending 是否仍在等待重试
+func (d *DeferredRequest) Pending() bool {
+	return d.Status == DeferredQueued || d.Status == DeferredInProgress
+}
+
+// DeferredStats 队列统计
+type DeferredStats struct {
+	Total    int            `json:"total"`
+	Pending  int            `json:"pending"`
+	MaxQueue int            `json:"maxQueue"`
+	ByStatus map[string]int `json:"byStatus"`
+}
+
+// DeferredStore 延迟重试队列（持久化到 deferred.json）
+type DeferredStore struct {
+	mu       sync.Mutex
+	items    map[string]*DeferredRequest
+	filePath string
+}
+
+var (
+	deferredStore     *DeferredStore
+	deferredStoreOnce sync.Once
+)
+
+// GetDeferredStore 获取延迟队列单例
+func GetDeferredStore() *DeferredStore {
+	deferredStoreOnce.Do(func() {
+		deferredStore = &DeferredStore{
+			items:    make(map[string]*DeferredRequest),
+			filePath: filepath.Join(config.Get().DataDir, "deferred.json"),
+		}
+		if err := deferredStore.load(); err != nil {
+			logger.Warn("Failed to load deferred queue: %v", err)
+		}
+	})
+	return deferredStore
+}
+
+func (s *DeferredStore) load() error {
+	data, err := persist.ReadFile(s.filePath, persist.ValidJSON)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var items []*DeferredRequest
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		// 重启前正在执行的请求重新排队
+		if item.Status == DeferredInProgress {
+			item.Status = DeferredQueued
+		}
+		s.items[item.ID] = item
+	}
+	return nil
+}
+
+func (s *DeferredStore) saveUnlocked() {
+	data, err := json.Marshal(s.sortedUnlocked())
+	if err != nil {
+		logger.Warn("Failed to encode deferred queue: %v", err)
+		return
+	}
+	if err := persist.WriteFile(s.filePath, data, 0644); err != nil {
+		logger.Warn("Failed to save deferred queue: %v", err)
+	}
+}
+
+// sortedUnlocked 按创建时间从旧到新排序
+func (s *DeferredStore) sortedUnlocked() []*DeferredRequest {
+	items := make([]*DeferredRequest, 0, len(s.items))
+	for _, item := range s.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].CreatedAt.Before(items[j].CreatedAt) })
+	return items
+}
+
+// Enqueue 加入队列（检查队列上限和 API Key 配额），返回副本
+func (s *DeferredStore) Enqueue(item *DeferredRequest) (*DeferredRequest, error) {
+	cfg := config.Get()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanupUnlocked()
+	pending, keyPending := 0, 0
+	for _, d := range s.items {
+		if d.Pending() {
+			pending++
+			if d.KeyHash == item.KeyHash {
+				keyPending++
+			}
+		}
+	}
+	if cfg.DeferredMaxQueue > 0 && pending >= cfg.DeferredMaxQueue {
+		return nil, ErrDeferredQueueFull
+	}
+	if cfg.DeferredKeyQuota > 0 && keyPending >= cfg.DeferredKeyQuota {
+		return nil, ErrDeferredQuota
+	}
+
+	now := time.Now()
+	item.ID = "defer_" + utils.GenerateSecureToken(12)
+	item.Status = DeferredQueued
+	item.CreatedAt = now
+	item.NextAttempt = now.Add(time.Duration(cfg.DeferredRetryInterval) * time.Second)
+	s.items[item.ID] = item
+	s.saveUnlocked()
+
+	copied := *item
+	return &copied, nil
+}
+
+// Get 获取延迟请求（只能访问同一 API Key 创建的请求）
+func (s *DeferredStore) Get(id, keyHash string) *DeferredRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[id]
+	if !ok || item.KeyHash != keyHash {
+		return nil
+	}
+	copied := *item
+	return &copied
+}
+
+// List 所有延迟请求（旧的在前）
+func (s *DeferredStore) List() []DeferredRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanupUnlocked()
+	list := make([]DeferredRequest, 0, len(s.items))
+	for _, item := range s.sortedUnlocked() {
+		list = append(list, *item)
+	}
+	return list
+}
+
+// Stats 队列统计
+func (s *DeferredStore) Stats() DeferredStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := DeferredStats{
+		Total:    len(s.items),
+		MaxQueue: config.Get().DeferredMaxQueue,
+		ByStatus: make(map[string]int),
+	}
+	for _, item := range s.items {
+		stats.ByStatus[item.Status]++
+		if item.Pending() {
+			stats.Pending++
+		}
+	}
+	return stats
+}
+
+// Due 到达重试时间的请求（旧的在前），超过最长等待时间的请求标记为 expired 并单独返回
+func (s *DeferredStore) Due(now time.Time) (due, expired []DeferredRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for _, item := range s.sortedUnlocked() {
+		if item.Status != DeferredQueued {
+			continue
+		}
+		if !now.Before(item.Deadline) {
+			item.Status = DeferredExpired
+			item.FinishedAt = &now
+			expired = append(expired, *item)
+			changed = true
+			continue
+		}
+		if !now.Before(item.NextAttempt) {
+			due = append(due, *item)
+		}
+	}
+	if changed {
+		s.saveUnlocked()
+	}
+	return due, expired
+}
+
+// Update 修改延迟请求并保存（update 在锁内执行），返回修改后的副本
+func (s *DeferredStore) Update(id string, update func(d *DeferredRequest)) *DeferredRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return nil
+	}
+	update(item)
+	s.saveUnlocked()
+	copied := *item
+	return &copied
+}
+
+// Cancel 取消等待中的请求，已结束的请求直接删除
+func (s *DeferredStore) Cancel(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return false
+	}
+	if item.Pending() {
+		now := time.Now()
+		item.Status = DeferredCancelled
+		item.FinishedAt = &now
+	} else {
+		delete(s.items, id)
+	}
+	s.saveUnlocked()
+	return true
+}
+
+// Save 保存队列
+func (s *DeferredStore) Save() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveUnlocked()
+}
+
+// cleanupUnlocked 删除超过保存时长的已结束请求
+func (s *DeferredStore) cleanupUnlocked() {
+	ttl := time.Duration(config.Get().DeferredResultTTL) * time.Minute
+	if ttl <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-ttl)
+	for id, item := range s.items {
+		if item.FinishedAt != nil && item.FinishedAt.Before(cutoff) {
+			delete(s.items, id)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"anti2api-golang/internal/config"
+)
+
+// ErrAccountDraining 账号仍在排空宽限期内（删除需要 force）
+var ErrAccountDraining = errors.New("账号正在排空（宽限期未结束），需要 force 参数强制删除")
+
+// DrainGracePeriod 排空宽限期：期间已固定到该账号的会话继续使用它，之后不再保持
+func DrainGracePeriod() time.Duration {
+	return time.Duration(config.Get().DrainGraceMinutes) * time.Minute
+}
+
+// IsDraining 账号是否处于排空状态（不再接收新会话）
+func (a *Account) IsDraining() bool {
+	return a.DrainingSince != nil
+}
+
+// DrainEndsAt 排空宽限期结束时间（未排空时为零值）
+func (a *Account) DrainEndsAt() time.Time {
+	if a.DrainingSince == nil {
+		return time.Time{}
+	}
+	return a.DrainingSince.Add(DrainGracePeriod())
+}
+
+// inDrainGrace 账号处于排空状态且仍在宽限期内
+func (a *Account) inDrainGrace() bool {
+	return a.IsDraining() && time.Now().Before(a.DrainEndsAt())
+}
+
+// SetDraining 设置账号排空状态（重复设置不会重置开始时间）
+func (s *AccountStore) SetDraining(ctx context.Context, index int, draining bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.accountAtUnlocked(ctx, index)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case draining && account.DrainingSince == nil:
+		now := time.Now()
+		account.DrainingSince = &now
+	case !draining:
+		account.DrainingSince = nil
+	}
+	return s.saveUnlocked()
+}
+
+type conversationContextKey struct{}
+
+// WithConversation 将会话标识写入 context，GetToken 据此保持会话绑定（排空账号上的已有会话、CONVERSATION_AFFINITY）
+func WithConversation(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, conversationContextKey{}, key)
+}
+
+func conversationFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(conversationContextKey{}).(string)
+	return key
+}
+
+// PinnedConversations 仍绑定在账号上的会话数
+func PinnedConversations(accountID string) int {
+	return GetConversationMap().CountAccount(accountID)
+}
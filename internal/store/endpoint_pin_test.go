@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+// pinnedAccount 固定到 endpoint 的账号
+func pinnedAccount(id, endpoint string) Account {
+	a := freshAccount(id)
+	a.Endpoint = endpoint
+	return a
+}
+
+// picks 连续选择 n 次账号，返回选中的账号 ID
+func picks(t *testing.T, n int, get func() (*Account, error)) []string {
+	t.Helper()
+	ids := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		account, err := get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, account.ID)
+	}
+	return ids
+}
+
+func TestGetTokenForEndpointSkipsAccountsPinnedElsewhere(t *testing.T) {
+	s := newTestStore(t,
+		pinnedAccount("pin-prod", "production"),
+		pinnedAccount("pin-daily", "daily"),
+		freshAccount("pin-any"),
+	)
+	ctx := context.Background()
+
+	// 只轮询兼容 daily 的账号：固定到 daily 的和未固定的
+	got := picks(t, 4, func() (*Account, error) { return s.GetTokenForEndpoint(ctx, "daily") })
+	want := []string{"pin-daily", "pin-any", "pin-daily", "pin-any"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("daily picks = %v, want %v", got, want)
+		}
+	}
+
+	// 未指定端点时固定端点的账号照常参与轮询
+	seen := make(map[string]bool)
+	for _, id := range picks(t, 3, func() (*Account, error) { return s.GetToken(ctx) }) {
+		seen[id] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("GetToken picked %v, want all three accounts", seen)
+	}
+}
+
+func TestGetTokenForEndpointWithoutCompatibleAccount(t *testing.T) {
+	s := newTestStore(t, pinnedAccount("only-prod", "production"))
+	if account, err := s.GetTokenForEndpoint(context.Background(), "daily"); err == nil {
+		t.Fatalf("picked %s pinned to production for a daily request", account.ID)
+	}
+	if _, err := s.GetToken(context.Background()); err != nil {
+		t.Fatalf("GetToken without endpoint: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/utils"
+)
+
+// 文件用途
+const (
+	FilePurposeBatch       = "batch"        // 上传的批处理请求（JSONL）
+	FilePurposeBatchOutput = "batch_output" // 批处理生成的结果文件
+)
+
+var (
+	// ErrFileTooLarge 文件超过单个文件大小上限
+	ErrFileTooLarge = errors.New("file exceeds the maximum allowed size")
+	// ErrFileQuota API Key 的文件数达到上限
+	ErrFileQuota = errors.New("file quota exceeded for this API key")
+	// ErrFileStorageFull 文件总容量已满
+	ErrFileStorageFull = errors.New("file storage is full")
+)
+
+// StoredFile OpenAI 兼容的文件对象（内容保存在落盘存储中，重启后丢失）
+type StoredFile struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"` // file
+	Bytes     int    `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+	Status    string `json:"status"` // processed
+
+	keyHash string
+	blob    string
+}
+
+// FileStore 批处理文件存储（带 TTL、单文件大小上限、总容量上限和每个 Key 的配额）
+type FileStore struct {
+	mu       sync.Mutex
+	files    map[string]*StoredFile
+	blobs    *DiskBlobStore
+	total    int
+	ttl      time.Duration
+	maxFile  int
+	maxTotal int
+	keyQuota int
+}
+
+var (
+	fileStore     *FileStore
+	fileStoreOnce sync.Once
+)
+
+// GetFileStore 获取文件存储单例
+func GetFileStore() *FileStore {
+	fileStoreOnce.Do(func() {
+		cfg := config.Get()
+		maxTotal := cfg.FilesMaxMB * 1024 * 1024
+		fileStore = &FileStore{
+			files: make(map[string]*StoredFile),
+			// 总容量由 FileStore 控制，落盘存储本身不淘汰
+			blobs:    NewDiskBlobStore(filepath.Join(os.TempDir(), "anti2api-files"), 0),
+			ttl:      time.Duration(cfg.FilesTTLHours) * time.Hour,
+			maxFile:  cfg.FilesMaxSizeMB * 1024 * 1024,
+			maxTotal: maxTotal,
+			keyQuota: cfg.FilesKeyQuota,
+		}
+	})
+	return fileStore
+}
+
+// MaxFileSize 单个文件大小上限（字节，0 为不限）
+func (s *FileStore) MaxFileSize() int {
+	return s.maxFile
+}
+
+// Add 保存文件内容，返回文件对象
+func (s *FileStore) Add(keyHash, filename, purpose string, data []byte) (*StoredFile, error) {
+	if s.maxFile > 0 && len(data) > s.maxFile {
+		return nil, ErrFileTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanupUnlocked()
+	if s.keyQuota > 0 {
+		count := 0
+		for _, f := range s.files {
+			if f.keyHash == keyHash {
+				count++
+			}
+		}
+		if count >= s.keyQuota {
+			return nil, ErrFileQuota
+		}
+	}
+	if s.maxTotal > 0 && s.total+len(data) > s.maxTotal {
+		return nil, ErrFileStorageFull
+	}
+
+	blob, err := s.blobs.Put(data)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	file := &StoredFile{
+		ID:        "file-" + utils.GenerateSecureToken(12),
+		Object:    "file",
+		Bytes:     len(data),
+		CreatedAt: now.Unix(),
+		Filename:  filename,
+		Purpose:   purpose,
+		Status:    "processed",
+		keyHash:   keyHash,
+		blob:      blob,
+	}
+	if s.ttl > 0 {
+		file.ExpiresAt = now.Add(s.ttl).Unix()
+	}
+	s.files[file.ID] = file
+	s.total += len(data)
+	return file, nil
+}
+
+// Get 获取文件对象（只能访问同一 API Key 创建的文件）
+func (s *FileStore) Get(id, keyHash string) *StoredFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.getUnlocked(id, keyHash)
+	if file == nil {
+		return nil
+	}
+	copied := *file
+	return &copied
+}
+
+// Content 读取文件内容
+func (s *FileStore) Content(id, keyHash string) ([]byte, error) {
+	s.mu.Lock()
+	file := s.getUnlocked(id, keyHash)
+	s.mu.Unlock()
+
+	if file == nil {
+		return nil, ErrBlobNotFound
+	}
+	return s.blobs.Get(file.blob)
+}
+
+// List 列出 API Key 的文件（新的在前），purpose 为空时不过滤
+func (s *FileStore) List(keyHash, purpose string) []StoredFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanupUnlocked()
+	list := make([]StoredFile, 0)
+	for _, f := range s.files {
+		if f.keyHash == keyHash && (purpose == "" || f.Purpose == purpose) {
+			list = append(list, *f)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt > list[j].CreatedAt })
+	return list
+}
+
+// Delete 删除文件
+func (s *FileStore) Delete(id, keyHash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.getUnlocked(id, keyHash)
+	if file == nil {
+		return false
+	}
+	s.removeUnlocked(file)
+	return true
+}
+
+func (s *FileStore) getUnlocked(id, keyHash string) *StoredFile {
+	file, ok := s.files[id]
+	if !ok || file.keyHash != keyHash {
+		return nil
+	}
+	if file.expired(time.Now()) {
+		s.removeUnlocked(file)
+		return nil
+	}
+	return file
+}
+
+func (s *FileStore) removeUnlocked(file *StoredFile) {
+	s.blobs.Delete(file.blob)
+	delete(s.files, file.ID)
+	s.total -= file.Bytes
+}
+
+// cleanupUnlocked 删除过期的文件
+func (s *FileStore) cleanupUnlocked() {
+	now := time.Now()
+	for _, file := range s.files {
+		if file.expired(now) {
+			s.removeUnlocked(file)
+		}
+	}
+}
+
+func (f *StoredFile) expired(now time.Time) bool {
+	return f.ExpiresAt > 0 && now.Unix() >= f.ExpiresAt
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+)
+
+// 账号选择策略
+const (
+	StrategyRoundRobin = "round_robin" // 轮询（默认）
+	StrategyHealthiest = "healthiest"  // 优先选择健康分最高的账号，同分时按轮询顺序
+)
+
+// 健康分计算参数
+const (
+	NeutralHealthScore = 0.75             // 没有近期记录时的健康分（低于稳定的账号，高于经常失败的账号）
+	healthPriorWeight  = 5.0              // 样本较少时向中性分收缩的先验权重
+	healthLatencyRef   = 10 * time.Second // 延迟得分为 0.5 的中位延迟
+	healthLatencySize  = 50               // 计算中位延迟保留的最近成功请求数
+	healthSuccessShare = 0.6              // 成功率权重
+	healthEmptyShare   = 0.25             // 非空响应率权重
+	healthLatencyShare = 0.15             // 延迟得分权重
+)
+
+// AccountHealth 账号健康分（0~1，越高越健康）
+type AccountHealth struct {
+	Score           float64    `json:"score"`
+	SuccessRate     float64    `json:"successRate"`     // 按时间衰减加权的成功率
+	EmptyRate       float64    `json:"emptyRate"`       // 成功请求中空响应的比例
+	MedianLatencyMs int64      `json:"medianLatencyMs"` // 最近成功请求的中位耗时
+	Samples         float64    `json:"samples"`         // 衰减后的有效样本数
+	LastAt          *time.Time `json:"lastAt,omitempty"`
+}
+
+// healthState 单个账号的衰减计数
+type healthState struct {
+	total   float64
+	success float64
+	empty   float64
+	latency []int64 // 环形缓冲
+	next    int
+	lastAt  time.Time
+}
+
+// HealthTracker 按账号（email 或 projectId）统计的滚动健康分
+type HealthTracker struct {
+	mu       sync.Mutex
+	accounts map[string]*healthState
+}
+
+var (
+	healthTracker     *HealthTracker
+	healthTrackerOnce sync.Once
+)
+
+// GetHealthTracker 获取健康分统计单例
+func GetHealthTracker() *HealthTracker {
+	healthTrackerOnce.Do(func() {
+		healthTracker = &HealthTracker{accounts: make(map[string]*healthState)}
+	})
+	return healthTracker
+}
+
+// healthHalfLife 计数衰减的半衰期
+func healthHalfLife() time.Duration {
+	minutes := config.Get().HealthHalfLife
+	if minutes <= 0 {
+		minutes = 30
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// decayFactor 经过 elapsed 后旧记录保留的权重
+func decayFactor(elapsed, halfLife time.Duration) float64 {
+	if elapsed <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, float64(elapsed)/float64(halfLife))
+}
+
+// Record 记录一次请求结果（由日志写入时调用）
+func (t *HealthTracker) Record(entry *LogEntry) {
+	key := getAccountKey(entry.Email, entry.ProjectID)
+	if key == "unknown" || entry.Email == PassthroughBucket {
+		return
+	}
+	at := entry.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.accounts[key]
+	if !ok {
+		st = &healthState{}
+		t.accounts[key] = st
+	}
+	st.record(at, entry.Success, entry.Empty, entry.DurationMs, healthHalfLife())
+}
+
+func (st *healthState) record(at time.Time, success, empty bool, durationMs int64, halfLife time.Duration) {
+	if !st.lastAt.IsZero() {
+		f := decayFactor(at.Sub(st.lastAt), halfLife)
+		st.total *= f
+		st.success *= f
+		st.empty *= f
+	}
+	if at.After(st.lastAt) {
+		st.lastAt = at
+	}
+
+	st.total++
+	if !success {
+		return
+	}
+	st.success++
+	if empty {
+		st.empty++
+	}
+	if len(st.latency) < healthLatencySize {
+		st.latency = append(st.latency, durationMs)
+	} else {
+		st.latency[st.next] = durationMs
+		st.next = (st.next + 1) % healthLatencySize
+	}
+}
+
+// health 按当前时间计算健康分：计数继续衰减，样本越少越接近中性分
+func (st *healthState) health(now time.Time, halfLife time.Duration) AccountHealth {
+	f := decayFactor(now.Sub(st.lastAt), halfLife)
+	total, success, empty := st.total*f, st.success*f, st.empty*f
+
+	h := AccountHealth{Score: NeutralHealthScore, Samples: total}
+	lastAt := st.lastAt
+	h.LastAt = &lastAt
+	if total <= 0 {
+		return h
+	}
+	h.SuccessRate = success / total
+	if success > 0 {
+		h.EmptyRate = empty / success
+	}
+	latencyScore := 0.5
+	if len(st.latency) > 0 {
+		h.MedianLatencyMs = medianInt64(st.latency)
+		ref := float64(healthLatencyRef.Milliseconds())
+		latencyScore = ref / (ref + float64(h.MedianLatencyMs))
+	}
+
+	raw := healthSuccessShare*h.SuccessRate + healthEmptyShare*(1-h.EmptyRate) + healthLatencyShare*latencyScore
+	confidence := total / (total + healthPriorWeight)
+	h.Score = NeutralHealthScore + (raw-NeutralHealthScore)*confidence
+	return h
+}
+
+func medianInt64(values []int64) int64 {
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Get 账号的健康分（没有记录时为中性分）
+func (t *HealthTracker) Get(email, projectID string) AccountHealth {
+	key := getAccountKey(email, projectID)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.accounts[key]
+	if !ok {
+		return AccountHealth{Score: NeutralHealthScore}
+	}
+	return st.health(time.Now(), healthHalfLife())
+}
+
+// Score 账号的健康分
+func (t *HealthTracker) Score(account *Account) float64 {
+	return t.Get(account.Email, account.ProjectID).Score
+}
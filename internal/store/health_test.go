@@ -0,0 +1,303 @@
+package store
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/config"
+)
+
+const testHalfLife = 30 * time.Minute
+
+// healthRecord 合成历史中的一次请求
+type healthRecord struct {
+	at         time.Duration // 相对起始时间
+	success    bool
+	empty      bool
+	durationMs int64
+}
+
+// replay 按顺序记录合成历史
+func replay(records []healthRecord) (*healthState, time.Time) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	st := &healthState{}
+	for _, r := range records {
+		st.record(start.Add(r.at), r.success, r.empty, r.durationMs, testHalfLife)
+	}
+	return st, start
+}
+
+// repeat n 次相同结果的请求，间隔 1 秒
+func repeat(n int, from time.Duration, success, empty bool, durationMs int64) []healthRecord {
+	records := make([]healthRecord, n)
+	for i := range records {
+		records[i] = healthRecord{from + time.Duration(i)*time.Second, success, empty, durationMs}
+	}
+	return records
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+// expectedScore 按权重和样本数计算的健康分
+func expectedScore(successRate, emptyRate, latencyScore, samples float64) float64 {
+	raw := healthSuccessShare*successRate + healthEmptyShare*(1-emptyRate) + healthLatencyShare*latencyScore
+	return NeutralHealthScore + (raw-NeutralHealthScore)*samples/(samples+healthPriorWeight)
+}
+
+func TestHealthScore(t *testing.T) {
+	latency1s := 10000.0 / 11000.0 // 中位耗时 1 秒时的延迟得分
+	tests := []struct {
+		name    string
+		records []healthRecord
+		success float64
+		empty   float64
+		median  int64
+		score   float64
+	}{
+		{"reliable", repeat(20, 0, true, false, 1000), 1, 0, 1000, expectedScore(1, 0, latency1s, 20)},
+		{"half failing", append(repeat(10, 0, true, false, 1000), repeat(10, 0, false, false, 0)...), 0.5, 0, 1000, expectedScore(0.5, 0, latency1s, 20)},
+		{"half empty", append(repeat(10, 0, true, false, 1000), repeat(10, 0, true, true, 1000)...), 1, 0.5, 1000, expectedScore(1, 0.5, latency1s, 20)},
+		// 没有成功请求时没有延迟数据，延迟得分取 0.5
+		{"all failing", repeat(20, 0, false, false, 0), 0, 0, 0, expectedScore(0, 0, 0.5, 20)},
+		{"slow", repeat(20, 0, true, false, 30000), 1, 0, 30000, expectedScore(1, 0, 0.25, 20)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, _ := replay(tt.records)
+			// 在最后一次记录时计算（不额外衰减）
+			h := st.health(st.lastAt, testHalfLife)
+			// 间隔 1 秒的记录衰减很小，有效样本数略少于请求数
+			if h.Samples > float64(len(tt.records)) || h.Samples < float64(len(tt.records))-0.5 {
+				t.Fatalf("samples = %v", h.Samples)
+			}
+			if math.Abs(h.SuccessRate-tt.success) > 0.01 || math.Abs(h.EmptyRate-tt.empty) > 0.01 || h.MedianLatencyMs != tt.median {
+				t.Fatalf("health = %+v", h)
+			}
+			if math.Abs(h.Score-tt.score) > 0.01 {
+				t.Fatalf("score = %v, want %v", h.Score, tt.score)
+			}
+		})
+	}
+}
+
+func TestHealthScoreOrdering(t *testing.T) {
+	score := func(records []healthRecord) float64 {
+		st, _ := replay(records)
+		return st.health(st.lastAt, testHalfLife).Score
+	}
+	reliable := score(repeat(20, 0, true, false, 1000))
+	flaky := score(append(repeat(10, 0, true, false, 1000), repeat(10, 0, false, false, 0)...))
+	emptyish := score(append(repeat(10, 0, true, false, 1000), repeat(10, 0, true, true, 1000)...))
+	failing := score(repeat(20, 0, false, false, 0))
+
+	if !(reliable > NeutralHealthScore && NeutralHealthScore > flaky && flaky > failing) {
+		t.Fatalf("reliable %v, neutral %v, flaky %v, failing %v", reliable, NeutralHealthScore, flaky, failing)
+	}
+	// 失败比空响应扣分更多
+	if emptyish <= flaky || emptyish >= reliable {
+		t.Fatalf("emptyish %v should rank between flaky %v and reliable %v", emptyish, flaky, reliable)
+	}
+}
+
+func TestHealthScoreShrinksFewSamples(t *testing.T) {
+	one, _ := replay(repeat(1, 0, false, false, 0))
+	many, _ := replay(repeat(50, 0, false, false, 0))
+	oneScore := one.health(one.lastAt, testHalfLife).Score
+	manyScore := many.health(many.lastAt, testHalfLife).Score
+	// 一次失败只稍微降低健康分
+	if !approx(oneScore, expectedScore(0, 0, 0.5, 1)) || oneScore < 0.6 {
+		t.Fatalf("one failure score = %v", oneScore)
+	}
+	if manyScore >= oneScore {
+		t.Fatalf("50 failures %v should score below one failure %v", manyScore, oneScore)
+	}
+
+	var empty healthState
+	if h := empty.health(time.Now(), testHalfLife); h.Score != NeutralHealthScore || h.Samples != 0 {
+		t.Fatalf("no history = %+v", h)
+	}
+}
+
+func TestHealthMedianLatency(t *testing.T) {
+	if m := medianInt64([]int64{300, 100, 200}); m != 200 {
+		t.Fatalf("odd median = %d", m)
+	}
+	if m := medianInt64([]int64{400, 100, 300, 200}); m != 250 {
+		t.Fatalf("even median = %d", m)
+	}
+
+	// 只保留最近的成功请求耗时
+	records := repeat(healthLatencySize, 0, true, false, 60000)
+	records = append(records, repeat(healthLatencySize, time.Minute, true, false, 500)...)
+	records = append(records, repeat(5, 2*time.Minute, false, false, 90000)...) // 失败不计入
+	st, _ := replay(records)
+	if h := st.health(st.lastAt, testHalfLife); h.MedianLatencyMs != 500 || len(st.latency) != healthLatencySize {
+		t.Fatalf("median = %d over %d samples", h.MedianLatencyMs, len(st.latency))
+	}
+}
+
+func TestDecayFactor(t *testing.T) {
+	tests := []struct {
+		elapsed time.Duration
+		want    float64
+	}{
+		{0, 1},
+		{-time.Minute, 1}, // 乱序记录不放大旧计数
+		{testHalfLife, 0.5},
+		{2 * testHalfLife, 0.25},
+		{testHalfLife / 2, math.Sqrt(0.5)},
+	}
+	for _, tt := range tests {
+		if got := decayFactor(tt.elapsed, testHalfLife); !approx(got, tt.want) {
+			t.Errorf("decayFactor(%v) = %v, want %v", tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestHealthDecaysTowardNeutral(t *testing.T) {
+	// 糟糕的一小时：持续失败
+	var bad []healthRecord
+	for i := 0; i < 60; i++ {
+		bad = append(bad, healthRecord{time.Duration(i) * time.Minute, false, false, 0})
+	}
+	st, start := replay(bad)
+	end := start.Add(59 * time.Minute)
+
+	previous := st.health(end, testHalfLife)
+	if previous.Score > 0.4 {
+		t.Fatalf("score after a bad hour = %v", previous.Score)
+	}
+	// 之后没有请求：健康分逐步回升，不超过中性分
+	for _, idle := range []time.Duration{30 * time.Minute, time.Hour, 2 * time.Hour, 5 * time.Hour} {
+		h := st.health(end.Add(idle), testHalfLife)
+		if h.Score <= previous.Score || h.Score > NeutralHealthScore {
+			t.Fatalf("score after %v idle = %v (previous %v)", idle, h.Score, previous.Score)
+		}
+		if h.SuccessRate != 0 {
+			t.Fatalf("success rate changed while idle: %v", h.SuccessRate)
+		}
+		previous = h
+	}
+	if NeutralHealthScore-previous.Score > 0.01 {
+		t.Fatalf("score after 5h idle = %v, want close to neutral", previous.Score)
+	}
+	if previous.Samples >= 1 {
+		t.Fatalf("samples after 5h idle = %v", previous.Samples)
+	}
+	// 半衰期后有效样本数减半
+	if h := st.health(end.Add(testHalfLife), testHalfLife); !approx(h.Samples, st.total/2) {
+		t.Fatalf("samples after one half-life = %v, want %v", h.Samples, st.total/2)
+	}
+}
+
+func TestHealthRecoversAfterBadHour(t *testing.T) {
+	records := repeat(30, 0, false, false, 0)
+	// 两小时（4 个半衰期）后恢复正常
+	records = append(records, repeat(30, 2*time.Hour, true, false, 1000)...)
+	st, _ := replay(records)
+	h := st.health(st.lastAt, testHalfLife)
+	if h.SuccessRate < 0.9 || h.Score <= NeutralHealthScore {
+		t.Fatalf("health after recovery = %+v", h)
+	}
+
+	// 乱序到达的旧记录不回退 lastAt
+	lastAt := st.lastAt
+	st.record(lastAt.Add(-time.Hour), true, false, 1000, testHalfLife)
+	if !st.lastAt.Equal(lastAt) {
+		t.Fatalf("lastAt moved back to %v", st.lastAt)
+	}
+}
+
+func TestHealthTrackerRecord(t *testing.T) {
+	tracker := &HealthTracker{accounts: make(map[string]*healthState)}
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		tracker.Record(&LogEntry{Email: "health-record@example.com", Timestamp: now, Success: false})
+	}
+	tracker.Record(&LogEntry{ProjectID: "health-project", Timestamp: now, Success: true, Empty: true, DurationMs: 800})
+	// 没有账号和透传请求不计入
+	tracker.Record(&LogEntry{Timestamp: now, Success: false})
+	tracker.Record(&LogEntry{Email: PassthroughBucket, Timestamp: now, Success: false})
+
+	if len(tracker.accounts) != 2 {
+		t.Fatalf("tracked %d accounts", len(tracker.accounts))
+	}
+	if h := tracker.Get("health-record@example.com", "other-project"); h.SuccessRate != 0 || h.Score >= NeutralHealthScore || h.LastAt == nil {
+		t.Fatalf("email health = %+v", h)
+	}
+	if h := tracker.Get("", "health-project"); h.EmptyRate != 1 || h.MedianLatencyMs != 800 {
+		t.Fatalf("project health = %+v", h)
+	}
+	if h := tracker.Get("health-unknown@example.com", ""); h.Score != NeutralHealthScore || h.LastAt != nil {
+		t.Fatalf("unknown account health = %+v", h)
+	}
+}
+
+// useSelectionStrategy 在测试期间设置账号选择策略
+func useSelectionStrategy(t *testing.T, strategy string) {
+	t.Helper()
+	cfg := config.Get()
+	previous := cfg.SelectionStrategy
+	cfg.SelectionStrategy = strategy
+	t.Cleanup(func() { cfg.SelectionStrategy = previous })
+}
+
+// recordHealth 在全局健康统计中记录 n 次请求结果
+func recordHealth(email string, n int, success bool) {
+	for i := 0; i < n; i++ {
+		GetHealthTracker().Record(&LogEntry{Email: email, Timestamp: time.Now(), Success: success, DurationMs: 1000})
+	}
+}
+
+// pickCounts 连续获取 n 次 Token，按账号 ID 统计
+func pickCounts(t *testing.T, s *AccountStore, n int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		account, err := s.GetToken(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[account.ID]++
+	}
+	return counts
+}
+
+func TestHealthiestStrategyPrefersHealthyAccounts(t *testing.T) {
+	s := newTestStore(t, freshAccount("hs-bad"), freshAccount("hs-new"), freshAccount("hs-good"))
+	recordHealth("hs-bad@example.com", 20, false)
+	recordHealth("hs-good@example.com", 20, true)
+
+	useSelectionStrategy(t, StrategyHealthiest)
+	if counts := pickCounts(t, s, 6); counts["hs-good"] != 6 {
+		t.Fatalf("healthiest picks = %v", counts)
+	}
+
+	// 最健康的账号不可用时选择次优的账号
+	s.accounts[2].Enable = false
+	if counts := pickCounts(t, s, 4); counts["hs-new"] != 4 {
+		t.Fatalf("picks without the healthiest account = %v", counts)
+	}
+
+	// 轮询策略不看健康分
+	s.accounts[2].Enable = true
+	useSelectionStrategy(t, StrategyRoundRobin)
+	if counts := pickCounts(t, s, 6); counts["hs-bad"] != 2 || counts["hs-new"] != 2 || counts["hs-good"] != 2 {
+		t.Fatalf("round robin picks = %v", counts)
+	}
+}
+
+func TestHealthiestStrategyRoundRobinsTies(t *testing.T) {
+	s := newTestStore(t, freshAccount("hs-tie-a"), freshAccount("hs-tie-b"), freshAccount("hs-tie-bad"))
+	recordHealth("hs-tie-bad@example.com", 20, false)
+
+	useSelectionStrategy(t, StrategyHealthiest)
+	// 没有记录的账号同为中性分，按轮询顺序交替
+	if counts := pickCounts(t, s, 6); counts["hs-tie-a"] != 3 || counts["hs-tie-b"] != 3 {
+		t.Fatalf("tied picks = %v", counts)
+	}
+}
@@ -0,0 +1,271 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/utils"
+)
+
+// importSaveEvery 导入时每处理多少条保存一次（避免每条都写文件）
+const importSaveEvery = 100
+
+// ImportIssue 导入中被跳过或出错的条目
+type ImportIssue struct {
+	Index  int    `json:"index"` // [[accounts]] 序号（从 1 开始）
+	Line   int    `json:"line"`  // 表头所在行号
+	Reason string `json:"reason"`
+}
+
+// ImportReport 导入结果
+type ImportReport struct {
+	Total     int           `json:"total"`     // [[accounts]] 条目数（预先统计）
+	Processed int           `json:"processed"` // 已处理条目数
+	Imported  int           `json:"imported"`  // 新增
+	Updated   int           `json:"updated"`   // 更新已有账号
+	Skipped   []ImportIssue `json:"skipped"`
+	Errored   []ImportIssue `json:"errored"`
+}
+
+// ImportOptions 导入选项
+type ImportOptions struct {
+	FilterDisabled bool                      // 跳过 enable = false 的账号
+	Progress       func(report ImportReport) // 进度回调（每批保存后调用）
+}
+
+// CountTOMLAccounts 统计 TOML 中的 [[accounts]] 条目数（用于显示进度）
+func CountTOMLAccounts(data string) int {
+	count := 0
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[[") && strings.TrimSpace(strings.Trim(line, "[]")) == "accounts" {
+			count++
+		}
+	}
+	return count
+}
+
+// ImportTOML 逐条解析并导入 [[accounts]]（租户管理员导入的账号归属其租户）。
+// 单条格式错误只记录在报告中，不影响其他条目
+func (s *AccountStore) ImportTOML(ctx context.Context, r io.Reader, total int, opts ImportOptions) (*ImportReport, error) {
+	scope, scoped := TenantFromContext(ctx)
+	report := &ImportReport{Total: total, Skipped: []ImportIssue{}, Errored: []ImportIssue{}}
+	scanner := utils.NewTOMLScanner(r)
+
+	// 每条单独加锁，导入期间不阻塞正常请求
+	for {
+		table, err := scanner.Next()
+		if err != nil {
+			s.Save()
+			return report, err
+		}
+		if table == nil {
+			break
+		}
+		if table.Name != "accounts" {
+			continue
+		}
+		report.Processed++
+		issue := ImportIssue{Index: table.Index + 1, Line: table.Line}
+
+		if table.Err != nil {
+			issue.Reason = table.Err.Error()
+			report.Errored = append(report.Errored, issue)
+		} else if account, err := accountFromTOML(table.Values); err != nil {
+			issue.Reason = err.Error()
+			report.Errored = append(report.Errored, issue)
+		} else if opts.FilterDisabled && !account.Enable {
+			issue.Reason = "disabled"
+			report.Skipped = append(report.Skipped, issue)
+		} else {
+			if scoped {
+				account.Tenant = scope
+			}
+			s.mu.Lock()
+			updated, err := s.addUnlocked(account)
+			s.mu.Unlock()
+			switch {
+			case err != nil:
+				issue.Reason = err.Error()
+				report.Errored = append(report.Errored, issue)
+			case updated:
+				report.Updated++
+			default:
+				report.Imported++
+			}
+		}
+
+		if report.Processed%importSaveEvery == 0 {
+			s.Save()
+			if opts.Progress != nil {
+				opts.Progress(*report)
+			}
+		}
+	}
+
+	if report.Processed == 0 {
+		if err := scanner.RootErr(); err != nil {
+			return report, err
+		}
+		return report, errors.New("无效的 TOML 格式：没有 [[accounts]] 条目")
+	}
+	return report, s.Save()
+}
+
+// accountFromTOML 将 [[accounts]] 表转换为账号
+func accountFromTOML(acc map[string]interface{}) (Account, error) {
+	account := Account{
+		Enable: true,
+	}
+
+	if v, ok := acc["type"].(string); ok {
+		if !ValidCredentialType(v) {
+			return account, fmt.Errorf("unknown credential type %q (expected oauth, static or service_account)", v)
+		}
+		account.Type = v
+	}
+	if v, ok := acc["access_token"].(string); ok {
+		account.AccessToken = v
+	}
+	if v, ok := acc["refresh_token"].(string); ok {
+		account.RefreshToken = v
+	}
+	if v, ok := acc["expires_in"].(int64); ok {
+		account.ExpiresIn = int(v)
+	} else if v, ok := acc["expires_in"].(float64); ok {
+		account.ExpiresIn = int(v)
+	}
+	if v, ok := acc["timestamp"].(int64); ok {
+		account.Timestamp = v
+	} else if v, ok := acc["timestamp"].(float64); ok {
+		account.Timestamp = int64(v)
+	}
+	if v, ok := acc["projectId"].(string); ok {
+		account.ProjectID = v
+	}
+	if v, ok := acc["email"].(string); ok {
+		account.Email = v
+	}
+	if err := credentialsFromTOML(acc, &account); err != nil {
+		return account, err
+	}
+	if v, ok := acc["enable"].(bool); ok {
+		account.Enable = v
+	}
+	if v, ok := acc["endpoint"].(string); ok {
+		if _, valid := config.APIEndpoints[v]; !valid {
+			return account, fmt.Errorf("unknown endpoint %q", v)
+		}
+		account.Endpoint = v
+	}
+	if v, ok := acc["tenant"].(string); ok {
+		account.Tenant = v
+	}
+	if v, ok := acc["note"].(string); ok {
+		if err := ValidateNote(v); err != nil {
+			return account, err
+		}
+		account.Note = v
+	}
+	// labels = ["owner=alice", "team=ops"]
+	if v, ok := acc["labels"].([]interface{}); ok {
+		labels := make(map[string]string)
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				if key, value, found := strings.Cut(str, "="); found {
+					labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+				}
+			}
+		}
+		if len(labels) > 0 {
+			if err := ValidateLabels(labels); err != nil {
+				return account, err
+			}
+			account.Labels = labels
+		}
+	}
+	// schedule = ["mon-fri 09:00-18:00"]，schedule_timezone = "Asia/Shanghai"
+	if v, ok := acc["schedule"].([]interface{}); ok && len(v) > 0 {
+		schedule := &AccountSchedule{}
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				schedule.Windows = append(schedule.Windows, str)
+			}
+		}
+		if tz, ok := acc["schedule_timezone"].(string); ok {
+			schedule.Timezone = tz
+		}
+		if err := schedule.Validate(); err != nil {
+			return account, err
+		}
+		account.Schedule = schedule
+	}
+	return account, nil
+}
+
+// credentialsFromTOML 按凭证类型校验并读取凭证字段
+func credentialsFromTOML(acc map[string]interface{}, account *Account) error {
+	switch account.CredentialType() {
+	case CredentialOAuth:
+		if account.RefreshToken == "" {
+			return errors.New("missing refresh_token")
+		}
+
+	case CredentialStatic:
+		// type = "static"：access_token 必填，expires_at 可选（Unix 秒或 RFC3339），不填表示不过期
+		if account.AccessToken == "" {
+			return errors.New("static account: missing access_token")
+		}
+		switch v := acc["expires_at"].(type) {
+		case nil:
+			// 未填写时沿用 expires_in + timestamp（也未填写则不过期）
+		case int64:
+			account.setStaticExpiry(time.Unix(v, 0))
+		case float64:
+			account.setStaticExpiry(time.Unix(int64(v), 0))
+		case string:
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return fmt.Errorf("static account: invalid expires_at %q (expected unix seconds or RFC3339)", v)
+			}
+			account.setStaticExpiry(t)
+		default:
+			return errors.New("static account: invalid expires_at (expected unix seconds or RFC3339)")
+		}
+
+	case CredentialServiceAccount:
+		// type = "service_account"：service_account_json 为完整的 JSON 密钥，
+		// 或者直接填写 client_email + private_key（可选 private_key_id、token_uri）
+		key := &ServiceAccountKey{}
+		if v, ok := acc["service_account_json"].(string); ok {
+			parsed, err := ParseServiceAccountJSON(v)
+			if err != nil {
+				return fmt.Errorf("service account: %v", err)
+			}
+			key = parsed
+		} else {
+			key.ClientEmail, _ = acc["client_email"].(string)
+			if v, ok := acc["private_key"].(string); ok {
+				key.PrivateKey = unescapePEM(v)
+			}
+			key.PrivateKeyID, _ = acc["private_key_id"].(string)
+			key.TokenURI, _ = acc["token_uri"].(string)
+		}
+		if err := key.Validate(); err != nil {
+			return fmt.Errorf("service account: %v", err)
+		}
+		account.ServiceAccount = key
+		if account.Email == "" {
+			account.Email = key.ClientEmail
+		}
+		if account.ProjectID == "" {
+			account.ProjectID = key.ProjectID
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/utils"
+)
+
+// jobRetention 已结束任务的保留时间
+const jobRetention = time.Hour
+
+// 任务状态
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Job 后台任务（如大批量导入），通过任务 ID 查询进度
+type Job struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Status     string      `json:"status"`
+	Progress   interface{} `json:"progress,omitempty"` // 当前进度（任务类型相关）
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+	tenant     string
+}
+
+// JobStore 内存中的任务列表（重启后丢失）
+type JobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+var (
+	jobStore     *JobStore
+	jobStoreOnce sync.Once
+)
+
+// GetJobStore 获取任务存储单例
+func GetJobStore() *JobStore {
+	jobStoreOnce.Do(func() {
+		jobStore = &JobStore{jobs: make(map[string]*Job)}
+	})
+	return jobStore
+}
+
+// Start 创建任务并在后台执行 run；run 通过 update 报告进度，返回值作为最终进度
+func (s *JobStore) Start(ctx context.Context, jobType string, run func(update func(progress interface{})) (interface{}, error)) *Job {
+	tenant, _ := TenantFromContext(ctx)
+	job := &Job{
+		ID:        utils.GenerateJobID(),
+		Type:      jobType,
+		Status:    JobRunning,
+		CreatedAt: time.Now(),
+		tenant:    tenant,
+	}
+
+	s.mu.Lock()
+	s.cleanupUnlocked()
+	s.jobs[job.ID] = job
+	snapshot := *job
+	s.mu.Unlock()
+
+	go func() {
+		result, err := run(func(progress interface{}) {
+			s.mu.Lock()
+			job.Progress = progress
+			s.mu.Unlock()
+		})
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		now := time.Now()
+		job.FinishedAt = &now
+		job.Progress = result
+		job.Status = JobCompleted
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+		}
+	}()
+
+	return &snapshot
+}
+
+// Get 获取对请求租户可见的任务
+func (s *JobStore) Get(ctx context.Context, id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok || !VisibleTo(ctx, job.tenant) {
+		return nil, false
+	}
+	snapshot := *job
+	return &snapshot, true
+}
+
+// cleanupUnlocked 清理过期的已结束任务
+func (s *JobStore) cleanupUnlocked() {
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > jobRetention {
+			delete(s.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/persist"
+)
+
+// 超出阈值时的处理方式
+const (
+	KeyLimitWarn  = "warn"  // 发送告警，请求继续处理
+	KeyLimitBlock = "block" // 拒绝请求（429 budget_exceeded）
+)
+
+// KeyThreshold 单项阈值
+type KeyThreshold struct {
+	Limit  int    `json:"limit"`
+	Action string `json:"action"` // warn（默认）或 block
+}
+
+// KeyLimits API Key 的用量阈值（按 Key 哈希前缀配置，与用量台账的 key 一致）
+type KeyLimits struct {
+	Key              string        `json:"key"`
+	Note             string        `json:"note,omitempty"`
+	MaxPromptTokens  *KeyThreshold `json:"maxPromptTokens,omitempty"`  // 单次请求的估算提示 Token
+	MaxRequestTokens *KeyThreshold `json:"maxRequestTokens,omitempty"` // 单次请求的估算总 Token（提示 + 输出预算）
+	DailyTokens      *KeyThreshold `json:"dailyTokens,omitempty"`      // 每天（本地时区）的 Token 用量
+	UpdatedAt        time.Time     `json:"updatedAt"`
+}
+
+// Validate 校验阈值配置
+func (l *KeyLimits) Validate() error {
+	if l.Key == "" {
+		return errors.New("key is required")
+	}
+	for name, t := range map[string]*KeyThreshold{
+		"maxPromptTokens":  l.MaxPromptTokens,
+		"maxRequestTokens": l.MaxRequestTokens,
+		"dailyTokens":      l.DailyTokens,
+	} {
+		if t == nil {
+			continue
+		}
+		if t.Limit <= 0 {
+			return fmt.Errorf("%s.limit must be positive", name)
+		}
+		switch t.Action {
+		case "":
+			t.Action = KeyLimitWarn
+		case KeyLimitWarn, KeyLimitBlock:
+		default:
+			return fmt.Errorf("%s.action must be %s or %s", name, KeyLimitWarn, KeyLimitBlock)
+		}
+	}
+	return nil
+}
+
+// KeyLimitStore API Key 阈值配置（持久化到 key_limits.json）
+type KeyLimitStore struct {
+	mu       sync.RWMutex
+	limits   map[string]*KeyLimits
+	filePath string
+}
+
+var (
+	keyLimitStore     *KeyLimitStore
+	keyLimitStoreOnce sync.Once
+)
+
+// GetKeyLimitStore 获取 API Key 阈值配置单例
+func GetKeyLimitStore() *KeyLimitStore {
+	keyLimitStoreOnce.Do(func() {
+		keyLimitStore = &KeyLimitStore{
+			limits:   make(map[string]*KeyLimits),
+			filePath: filepath.Join(config.Get().DataDir, "key_limits.json"),
+		}
+		if err := keyLimitStore.load(); err != nil {
+			logger.Warn("Failed to load key limits: %v", err)
+		}
+		persist.Register(persist.File{
+			Name:   "key_limits.json",
+			Path:   keyLimitStore.filePath,
+			Reload: keyLimitStore.load,
+		})
+	})
+	return keyLimitStore
+}
+
+func (s *KeyLimitStore) load() error {
+	data, err := persist.ReadFile(s.filePath, persist.ValidJSON)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var list []*KeyLimits
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	limits := make(map[string]*KeyLimits, len(list))
+	for _, l := range list {
+		if err := l.Validate(); err != nil {
+			logger.Warn("Ignoring invalid key limits for %q: %v", l.Key, err)
+			continue
+		}
+		limits[l.Key] = l
+	}
+
+	s.mu.Lock()
+	s.limits = limits
+	s.mu.Unlock()
+	return nil
+}
+
+// saveUnlocked 保存配置（调用者必须持有锁）
+func (s *KeyLimitStore) saveUnlocked() error {
+	data, err := json.MarshalIndent(s.listUnlocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return persist.WriteFile(s.filePath, data, 0644)
+}
+
+func (s *KeyLimitStore) listUnlocked() []KeyLimits {
+	list := make([]KeyLimits, 0, len(s.limits))
+	for _, l := range s.limits {
+		list = append(list, *l)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// List 所有 API Key 的阈值配置
+func (s *KeyLimitStore) List() []KeyLimits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.listUnlocked()
+}
+
+// Get 获取 API Key 的阈值配置（未配置时返回 nil）
+func (s *KeyLimitStore) Get(key string) *KeyLimits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l, ok := s.limits[key]
+	if !ok {
+		return nil
+	}
+	copied := *l
+	return &copied
+}
+
+// Set 设置 API Key 的阈值配置（覆盖原有配置）
+func (s *KeyLimitStore) Set(l KeyLimits) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	l.UpdatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits[l.Key] = &l
+	return s.saveUnlocked()
+}
+
+// Delete 删除 API Key 的阈值配置
+func (s *KeyLimitStore) Delete(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.limits[key]; !ok {
+		return false, nil
+	}
+	delete(s.limits, key)
+	return true, s.saveUnlocked()
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyLimitsValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits KeyLimits
+		err    string
+	}{
+		{"no thresholds", KeyLimits{Key: "k"}, ""},
+		{"missing key", KeyLimits{DailyTokens: &KeyThreshold{Limit: 10}}, "key is required"},
+		{"zero limit", KeyLimits{Key: "k", MaxPromptTokens: &KeyThreshold{Limit: 0}}, "maxPromptTokens.limit must be positive"},
+		{"negative limit", KeyLimits{Key: "k", DailyTokens: &KeyThreshold{Limit: -1, Action: KeyLimitBlock}}, "dailyTokens.limit must be positive"},
+		{"unknown action", KeyLimits{Key: "k", MaxRequestTokens: &KeyThreshold{Limit: 10, Action: "drop"}}, "maxRequestTokens.action must be warn or block"},
+		{"block", KeyLimits{Key: "k", MaxRequestTokens: &KeyThreshold{Limit: 10, Action: KeyLimitBlock}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.Validate()
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("Validate() = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	// 未指定处理方式时默认只告警
+	limits := KeyLimits{Key: "k", MaxPromptTokens: &KeyThreshold{Limit: 10}, DailyTokens: &KeyThreshold{Limit: 10, Action: KeyLimitBlock}}
+	if err := limits.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if limits.MaxPromptTokens.Action != KeyLimitWarn || limits.DailyTokens.Action != KeyLimitBlock {
+		t.Fatalf("actions = %q, %q", limits.MaxPromptTokens.Action, limits.DailyTokens.Action)
+	}
+}
+
+// newTestKeyLimitStore 独立的阈值配置存储（文件位于测试的临时目录）
+func newTestKeyLimitStore(t *testing.T) *KeyLimitStore {
+	t.Helper()
+	return &KeyLimitStore{limits: make(map[string]*KeyLimits), filePath: filepath.Join(t.TempDir(), "key_limits.json")}
+}
+
+func TestKeyLimitStorePersists(t *testing.T) {
+	s := newTestKeyLimitStore(t)
+	if err := s.Set(KeyLimits{Key: "b", DailyTokens: &KeyThreshold{Limit: 1000, Action: KeyLimitBlock}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(KeyLimits{Key: "a", Note: "ci", MaxPromptTokens: &KeyThreshold{Limit: 150000}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(KeyLimits{Key: "c", MaxPromptTokens: &KeyThreshold{Limit: -5}}); err == nil {
+		t.Fatal("invalid limits saved")
+	}
+
+	// Get 返回副本
+	got := s.Get("a")
+	if got == nil || got.Note != "ci" || got.MaxPromptTokens.Action != KeyLimitWarn || got.UpdatedAt.IsZero() {
+		t.Fatalf("Get(a) = %+v", got)
+	}
+	got.Note = "changed"
+	if s.Get("a").Note != "ci" {
+		t.Fatal("Get returned the stored limits")
+	}
+	if s.Get("c") != nil {
+		t.Fatal("rejected limits stored")
+	}
+
+	reloaded := &KeyLimitStore{filePath: s.filePath}
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	list := reloaded.List()
+	if len(list) != 2 || list[0].Key != "a" || list[1].Key != "b" || list[1].DailyTokens.Limit != 1000 || list[1].DailyTokens.Action != KeyLimitBlock {
+		t.Fatalf("reloaded = %+v", list)
+	}
+
+	if deleted, err := s.Delete("a"); !deleted || err != nil {
+		t.Fatalf("Delete(a) = %v, %v", deleted, err)
+	}
+	if deleted, _ := s.Delete("a"); deleted {
+		t.Fatal("deleted twice")
+	}
+	if err := reloaded.load(); err != nil || len(reloaded.List()) != 1 {
+		t.Fatalf("after delete: %+v, %v", reloaded.List(), err)
+	}
+}
+
+func TestKeyLimitStoreSkipsInvalidEntries(t *testing.T) {
+	s := newTestKeyLimitStore(t)
+	data := `[{"key":"ok","dailyTokens":{"limit":10}},{"key":"bad","dailyTokens":{"limit":10,"action":"drop"}},{"dailyTokens":{"limit":10}}]`
+	if err := os.WriteFile(s.filePath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	if list := s.List(); len(list) != 1 || list[0].Key != "ok" || list[0].DailyTokens.Action != KeyLimitWarn {
+		t.Fatalf("loaded = %+v", list)
+	}
+}
+
+func TestKeyTokensDailyWindow(t *testing.T) {
+	l := &UsageLedger{rows: make(map[string]*DailyUsage)}
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	today, yesterday := midnight.Format("2006-01-02"), midnight.Add(-time.Second).Format("2006-01-02")
+
+	record := func(key string, at time.Time, prompt, completion int) {
+		l.Record(&LogEntry{KeyID: key, Model: "m", Email: "a@example.com", Timestamp: at, PromptTokens: prompt, CompletionTokens: completion, Success: true})
+	}
+	// 零点前一秒计入前一天，零点计入当天
+	record("window-key", midnight.Add(-time.Second), 5000, 1000)
+	record("window-key", midnight, 100, 20)
+	record("window-key", midnight.Add(time.Hour), 300, 80)
+	record("other-key", midnight, 9999, 0)
+
+	if got := l.KeyTokens("window-key", yesterday); got != 6000 {
+		t.Errorf("yesterday = %d, want 6000", got)
+	}
+	if got := l.KeyTokens("window-key", today); got != 500 {
+		t.Errorf("today = %d, want 500", got)
+	}
+	if got := l.KeyTokens("missing-key", today); got != 0 {
+		t.Errorf("unknown key = %d", got)
+	}
+}
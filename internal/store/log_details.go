@@ -0,0 +1,147 @@
+package store
+
+import (
+	"reflect"
+	"time"
+)
+
+// detailSlot 保存在内存中的日志详情
+type detailSlot struct {
+	detail *LogDetail
+	size   int64
+}
+
+// DetailMemoryStats 日志详情内存占用统计
+type DetailMemoryStats struct {
+	Bytes   int64 `json:"bytes"`   // 当前占用（估算）
+	Budget  int64 `json:"budget"`  // 预算上限，0 为不限
+	Entries int   `json:"entries"` // 持有详情的日志数
+	Evicted int64 `json:"evicted"` // 因超出预算被丢弃的详情数（摘要保留）
+}
+
+// putDetailUnlocked 保存日志详情并按预算从最旧的详情开始淘汰（调用者必须持有写锁）
+func (s *LogStore) putDetailUnlocked(id string, detail *LogDetail) {
+	size := approxSize(reflect.ValueOf(detail))
+	s.details[id] = &detailSlot{detail: detail, size: size}
+	s.detailQueue = append(s.detailQueue, id)
+	s.detailBytes += size
+
+	for s.maxDetailBytes > 0 && s.detailBytes > s.maxDetailBytes && s.detailHead < len(s.detailQueue) {
+		if s.dropDetailUnlocked(s.detailQueue[s.detailHead]) {
+			s.evictedDetails++
+		}
+		s.detailQueue[s.detailHead] = ""
+		s.detailHead++
+	}
+	s.compactDetailQueueUnlocked()
+}
+
+// skipStaleDetailsUnlocked 跳过队列头部已随日志删除的详情
+func (s *LogStore) skipStaleDetailsUnlocked() {
+	for s.detailHead < len(s.detailQueue) {
+		if _, ok := s.details[s.detailQueue[s.detailHead]]; ok {
+			break
+		}
+		s.detailQueue[s.detailHead] = ""
+		s.detailHead++
+	}
+	s.compactDetailQueueUnlocked()
+}
+
+// dropDetailUnlocked 删除日志详情，返回是否存在
+func (s *LogStore) dropDetailUnlocked(id string) bool {
+	slot, ok := s.details[id]
+	if !ok {
+		return false
+	}
+	s.detailBytes -= slot.size
+	delete(s.details, id)
+	return true
+}
+
+// compactDetailQueueUnlocked 队列头部的空位超过一半时整体前移（摊还 O(1)）
+func (s *LogStore) compactDetailQueueUnlocked() {
+	if s.detailHead < 64 || s.detailHead*2 < len(s.detailQueue) {
+		return
+	}
+	n := copy(s.detailQueue, s.detailQueue[s.detailHead:])
+	s.detailQueue = s.detailQueue[:n]
+	s.detailHead = 0
+}
+
+// resetDetailsUnlocked 清空所有详情
+func (s *LogStore) resetDetailsUnlocked() {
+	s.details = make(map[string]*detailSlot)
+	s.detailQueue = nil
+	s.detailHead = 0
+	s.detailBytes = 0
+}
+
+// DetailMemory 返回日志详情的内存占用统计
+func (s *LogStore) DetailMemory() DetailMemoryStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return DetailMemoryStats{
+		Bytes:   s.detailBytes,
+		Budget:  s.maxDetailBytes,
+		Entries: len(s.details),
+		Evicted: s.evictedDetails,
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// approxSize 估算值占用的内存字节数（字符串和切片按内容长度计算，不精确统计分配器开销）
+func approxSize(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return 8
+		}
+		return 8 + approxSize(v.Elem())
+	case reflect.String:
+		return 16 + int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() {
+			return 24
+		}
+		// 字节切片（如图片数据）不逐个遍历
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return 24 + int64(v.Len())
+		}
+		size := int64(24)
+		for i := 0; i < v.Len(); i++ {
+			size += approxSize(v.Index(i))
+		}
+		return size
+	case reflect.Array:
+		size := int64(0)
+		for i := 0; i < v.Len(); i++ {
+			size += approxSize(v.Index(i))
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() {
+			return 8
+		}
+		size := int64(48)
+		iter := v.MapRange()
+		for iter.Next() {
+			size += approxSize(iter.Key()) + approxSize(iter.Value())
+		}
+		return size
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return 24
+		}
+		size := int64(0)
+		for i := 0; i < v.NumField(); i++ {
+			size += approxSize(v.Field(i))
+		}
+		return size
+	default:
+		return int64(v.Type().Size())
+	}
+}
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// newTestLogStore 创建独立的日志存储（不启动写入队列），budget 为详情内存预算
+func newTestLogStore(t *testing.T, maxLogs int, budget int64) *LogStore {
+	t.Helper()
+	return &LogStore{
+		filePath:       filepath.Join(t.TempDir(), "logs.json"),
+		maxLogs:        maxLogs,
+		usageCache:     make(map[string]*UsageStats),
+		details:        make(map[string]*detailSlot),
+		maxDetailBytes: budget,
+	}
+}
+
+// detailEntry 请求体为 size 字节的日志
+func detailEntry(i, size int) LogEntry {
+	return LogEntry{
+		ID:     fmt.Sprintf("log-%d", i),
+		Status: 200,
+		Model:  "gemini-2.5-flash",
+		Detail: &LogDetail{Request: &RequestSnapshot{
+			Protocol: "openai",
+			Body:     map[string]interface{}{"image": strings.Repeat("x", size)},
+		}},
+	}
+}
+
+// checkDetailQueue 队列中有效的部分与详情一一对应，空位不会无限增长
+func checkDetailQueue(t *testing.T, s *LogStore) {
+	t.Helper()
+	live := s.detailQueue[s.detailHead:]
+	if len(live) < len(s.details) {
+		t.Fatalf("queue holds %d ids for %d details", len(live), len(s.details))
+	}
+	if len(s.detailQueue) > 2*len(live)+64 {
+		t.Fatalf("queue grew to %d slots for %d live ids", len(s.detailQueue), len(live))
+	}
+}
+
+func TestLogDetailBudgetStress(t *testing.T) {
+	const budget = 16 << 20
+	const size = 200 << 10
+	s := newTestLogStore(t, 1000, budget)
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	// 写入约 30 倍于预算的详情
+	for i := 0; i < 2500; i++ {
+		s.insert(detailEntry(i, size))
+		if s.detailBytes > budget {
+			t.Fatalf("after %d inserts detail memory is %d bytes, budget %d", i+1, s.detailBytes, budget)
+		}
+	}
+	checkDetailQueue(t, s)
+
+	stats := s.DetailMemory()
+	if stats.Bytes < budget*9/10 {
+		t.Errorf("detail memory %d bytes, want within 10%% of the %d budget", stats.Bytes, budget)
+	}
+	// 估算值与保留的请求体实际大小相差不超过 10%
+	var actual int64
+	for _, slot := range s.details {
+		actual += int64(len(slot.detail.Request.Body.(map[string]interface{})["image"].(string)))
+	}
+	if diff := stats.Bytes - actual; diff < 0 || diff > actual/10 {
+		t.Errorf("accounted %d bytes for %d bytes of bodies", stats.Bytes, actual)
+	}
+	if stats.Entries != len(s.details) || stats.Evicted == 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// 堆上只保留预算内的详情（外加日志摘要）
+	runtime.GC()
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	if grown := int64(after.HeapAlloc) - int64(before.HeapAlloc); grown > budget*11/10 {
+		t.Errorf("heap grew by %d bytes, budget %d", grown, budget)
+	}
+	runtime.KeepAlive(s)
+}
+
+func TestLogDetailEvictsOldestKeepingSummary(t *testing.T) {
+	one := approxSize(reflect.ValueOf(detailEntry(0, 1000).Detail))
+	s := newTestLogStore(t, 100, 3*one)
+	for i := 0; i < 5; i++ {
+		s.insert(detailEntry(i, 1000))
+	}
+
+	// 最旧的两条只保留摘要
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		entry := s.GetByID(ctx, fmt.Sprintf("log-%d", i))
+		if entry == nil {
+			t.Fatalf("log-%d summary was dropped", i)
+		}
+		if kept := i >= 2; entry.HasDetail != kept || (entry.Detail != nil) != kept {
+			t.Errorf("log-%d: hasDetail = %v, detail = %v, want kept=%v", i, entry.HasDetail, entry.Detail != nil, kept)
+		}
+	}
+	list, _ := s.List(ctx, 0, 0, LogFilter{})
+	for _, entry := range list {
+		if _, kept := s.details[entry.ID]; entry.HasDetail != kept || entry.Detail != nil {
+			t.Errorf("list entry %s: hasDetail = %v", entry.ID, entry.HasDetail)
+		}
+	}
+	if stats := s.DetailMemory(); stats.Entries != 3 || stats.Evicted != 2 || stats.Bytes != 3*one {
+		t.Errorf("stats = %+v, want 3 details of %d bytes and 2 evicted", stats, one)
+	}
+}
+
+func TestLogDetailLargerThanBudget(t *testing.T) {
+	s := newTestLogStore(t, 100, 4<<10)
+	s.insert(detailEntry(0, 100))
+	s.insert(detailEntry(1, 64<<10))
+
+	// 超出预算的详情立即丢弃，之前的详情也让出空间
+	if stats := s.DetailMemory(); stats.Bytes != 0 || stats.Entries != 0 || stats.Evicted != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if entry := s.GetByID(context.Background(), "log-1"); entry == nil || entry.HasDetail {
+		t.Errorf("log-1 = %+v, want the summary without detail", entry)
+	}
+}
+
+func TestLogDetailUnlimitedBudget(t *testing.T) {
+	s := newTestLogStore(t, 100, 0)
+	for i := 0; i < 50; i++ {
+		s.insert(detailEntry(i, 10<<10))
+	}
+	if stats := s.DetailMemory(); stats.Entries != 50 || stats.Evicted != 0 {
+		t.Errorf("stats = %+v, want every detail kept", stats)
+	}
+}
+
+func TestLogDetailDroppedWithEntry(t *testing.T) {
+	s := newTestLogStore(t, 10, 0)
+	for i := 0; i < 1000; i++ {
+		s.insert(detailEntry(i, 1000))
+	}
+	checkDetailQueue(t, s)
+	if len(s.logs) != 10 || len(s.details) != 10 {
+		t.Fatalf("%d logs and %d details, want 10 of each", len(s.logs), len(s.details))
+	}
+	// 按条数淘汰不计入预算淘汰
+	var want int64
+	for _, slot := range s.details {
+		want += slot.size
+	}
+	if stats := s.DetailMemory(); stats.Bytes != want || stats.Evicted != 0 {
+		t.Errorf("stats = %+v, want %d bytes", stats, want)
+	}
+	if entry := s.GetByID(context.Background(), "log-999"); entry == nil || !entry.HasDetail {
+		t.Errorf("newest entry = %+v", entry)
+	}
+
+	if err := s.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := s.DetailMemory(); stats.Bytes != 0 || stats.Entries != 0 {
+		t.Errorf("stats after Clear = %+v", stats)
+	}
+}
+
+func TestLogStoreSaveLoadKeepsOrderWithoutDetails(t *testing.T) {
+	s := newTestLogStore(t, 100, 0)
+	for i := 0; i < 3; i++ {
+		s.insert(detailEntry(i, 100))
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := newTestLogStore(t, 100, 0)
+	reloaded.filePath = s.filePath
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	list, _ := reloaded.List(context.Background(), 0, 0, LogFilter{})
+	for _, entry := range list {
+		ids = append(ids, entry.ID)
+		if entry.HasDetail {
+			t.Errorf("%s has a detail after reload", entry.ID)
+		}
+	}
+	if strings.Join(ids, ",") != "log-2,log-1,log-0" {
+		t.Errorf("ids = %v, want newest first", ids)
+	}
+}
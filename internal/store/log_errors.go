@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// unclassifiedError 没有分类的失败日志（分类功能上线前的日志、本地拒绝的请求）
+const unclassifiedError = "unknown"
+
+// ErrorCell 错误矩阵中的一格（分类 × 模型 × 端点）
+type ErrorCell struct {
+	Class    string   `json:"class"`
+	Model    string   `json:"model"`
+	Endpoint string   `json:"endpoint"`
+	Count    int      `json:"count"`
+	Previous int      `json:"previous"` // 上一个窗口的次数
+	Delta    int      `json:"delta"`
+	Accounts []string `json:"accounts"` // 当前窗口内出错的账号
+}
+
+// ErrorTrend 某个分类在当前窗口与上一个窗口的对比
+type ErrorTrend struct {
+	Count    int `json:"count"`
+	Previous int `json:"previous"`
+	Delta    int `json:"delta"`
+}
+
+// ErrorMatrix 失败请求按分类、模型、端点的分布
+type ErrorMatrix struct {
+	WindowMinutes    int                   `json:"windowMinutes"`
+	Requests         int                   `json:"requests"`         // 当前窗口内的请求数
+	PreviousRequests int                   `json:"previousRequests"` // 上一个窗口内的请求数
+	Failed           ErrorTrend            `json:"failed"`
+	ByClass          map[string]ErrorTrend `json:"byClass"`
+	Cells            []ErrorCell           `json:"cells"` // 按当前窗口次数从多到少
+}
+
+type errorCellKey struct {
+	class, model, endpoint string
+}
+
+// GetErrorMatrix 统计最近一个窗口内的失败请求，并与紧邻的上一个窗口对比
+func (s *LogStore) GetErrorMatrix(ctx context.Context, window time.Duration) ErrorMatrix {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	current := now.Add(-window)
+	previous := current.Add(-window)
+
+	matrix := ErrorMatrix{
+		WindowMinutes: int(window / time.Minute),
+		ByClass:       make(map[string]ErrorTrend),
+	}
+	cells := make(map[errorCellKey]*ErrorCell)
+	accounts := make(map[errorCellKey]map[string]bool)
+
+	for i := range s.logs {
+		log := &s.logs[i]
+		if log.Timestamp.Before(previous) || !VisibleTo(ctx, log.Tenant) {
+			continue
+		}
+		inCurrent := !log.Timestamp.Before(current)
+		if inCurrent {
+			matrix.Requests++
+		} else {
+			matrix.PreviousRequests++
+		}
+		if log.Success {
+			continue
+		}
+
+		class := log.ErrorClass
+		if class == "" {
+			class = unclassifiedError
+		}
+		key := errorCellKey{class: class, model: log.Model, endpoint: log.Endpoint}
+		cell, ok := cells[key]
+		if !ok {
+			cell = &ErrorCell{Class: class, Model: log.Model, Endpoint: log.Endpoint}
+			cells[key] = cell
+			accounts[key] = make(map[string]bool)
+		}
+
+		trend := matrix.ByClass[class]
+		if inCurrent {
+			cell.Count++
+			trend.Count++
+			matrix.Failed.Count++
+			if log.Email != "" || log.ProjectID != "" {
+				accounts[key][getAccountKey(log.Email, log.ProjectID)] = true
+			}
+		} else {
+			cell.Previous++
+			trend.Previous++
+			matrix.Failed.Previous++
+		}
+		trend.Delta = trend.Count - trend.Previous
+		matrix.ByClass[class] = trend
+	}
+	matrix.Failed.Delta = matrix.Failed.Count - matrix.Failed.Previous
+
+	matrix.Cells = make([]ErrorCell, 0, len(cells))
+	for key, cell := range cells {
+		cell.Delta = cell.Count - cell.Previous
+		cell.Accounts = make([]string, 0, len(accounts[key]))
+		for account := range accounts[key] {
+			cell.Accounts = append(cell.Accounts, account)
+		}
+		sort.Strings(cell.Accounts)
+		matrix.Cells = append(matrix.Cells, *cell)
+	}
+	sort.Slice(matrix.Cells, func(i, j int) bool {
+		a, b := matrix.Cells[i], matrix.Cells[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Delta != b.Delta {
+			return a.Delta > b.Delta
+		}
+		return a.Class+a.Model+a.Endpoint < b.Class+b.Model+b.Endpoint
+	})
+	return matrix
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// failedEntry 指定时间之前失败的请求日志
+func failedEntry(ago time.Duration, class, model, endpoint, email string) LogEntry {
+	return LogEntry{
+		Timestamp:  time.Now().Add(-ago),
+		Status:     500,
+		Model:      model,
+		Endpoint:   endpoint,
+		ErrorClass: class,
+		Email:      email,
+		ProjectID:  "project",
+	}
+}
+
+func TestErrorMatrixWindows(t *testing.T) {
+	s := newTestLogStore(t, 1000, 0)
+	entries := []LogEntry{
+		// 上一个窗口（60-120 分钟前）
+		failedEntry(90*time.Minute, "quota", "gemini-2.5-pro", "prod", "a@example.com"),
+		failedEntry(70*time.Minute, "quota", "gemini-2.5-pro", "prod", "a@example.com"),
+		failedEntry(65*time.Minute, "auth", "claude-sonnet-4-5", "prod", "b@example.com"),
+		{Timestamp: time.Now().Add(-80 * time.Minute), Status: 200, Success: true, Model: "gemini-2.5-pro"},
+		// 当前窗口：claude 在 prod 上开始大量失败
+		failedEntry(30*time.Minute, "transport", "claude-sonnet-4-5", "prod", "a@example.com"),
+		failedEntry(20*time.Minute, "transport", "claude-sonnet-4-5", "prod", "b@example.com"),
+		failedEntry(10*time.Minute, "transport", "claude-sonnet-4-5", "prod", "b@example.com"),
+		failedEntry(5*time.Minute, "quota", "gemini-2.5-pro", "prod", "a@example.com"),
+		{Timestamp: time.Now().Add(-5 * time.Minute), Status: 400, Model: "gemini-2.5-pro"}, // 本地拒绝，没有分类和账号
+		{Timestamp: time.Now().Add(-time.Minute), Status: 200, Success: true, Model: "claude-sonnet-4-5"},
+		// 超出两个窗口，不统计
+		failedEntry(3*time.Hour, "safety", "gemini-2.5-flash", "daily", "c@example.com"),
+	}
+	for _, e := range entries {
+		s.insert(e)
+	}
+
+	m := s.GetErrorMatrix(context.Background(), time.Hour)
+	if m.WindowMinutes != 60 || m.Requests != 6 || m.PreviousRequests != 4 {
+		t.Fatalf("window = %d, requests = %d/%d", m.WindowMinutes, m.Requests, m.PreviousRequests)
+	}
+	if m.Failed != (ErrorTrend{Count: 5, Previous: 3, Delta: 2}) {
+		t.Errorf("failed = %+v", m.Failed)
+	}
+	wantClasses := map[string]ErrorTrend{
+		"transport": {Count: 3, Previous: 0, Delta: 3},
+		"quota":     {Count: 1, Previous: 2, Delta: -1},
+		"auth":      {Count: 0, Previous: 1, Delta: -1},
+		"unknown":   {Count: 1, Previous: 0, Delta: 1},
+	}
+	if !reflect.DeepEqual(m.ByClass, wantClasses) {
+		t.Errorf("byClass = %+v", m.ByClass)
+	}
+
+	// 按当前窗口次数排序，账号去重
+	want := []ErrorCell{
+		{Class: "transport", Model: "claude-sonnet-4-5", Endpoint: "prod", Count: 3, Delta: 3,
+			Accounts: []string{getAccountKey("a@example.com", "project"), getAccountKey("b@example.com", "project")}},
+		{Class: "unknown", Model: "gemini-2.5-pro", Count: 1, Delta: 1, Accounts: []string{}},
+		{Class: "quota", Model: "gemini-2.5-pro", Endpoint: "prod", Count: 1, Previous: 2, Delta: -1,
+			Accounts: []string{getAccountKey("a@example.com", "project")}},
+		{Class: "auth", Model: "claude-sonnet-4-5", Endpoint: "prod", Previous: 1, Delta: -1, Accounts: []string{}},
+	}
+	if !reflect.DeepEqual(m.Cells, want) {
+		t.Fatalf("cells =\n%+v\nwant\n%+v", m.Cells, want)
+	}
+}
+
+func TestErrorMatrixTenantScope(t *testing.T) {
+	s := newTestLogStore(t, 1000, 0)
+	own := failedEntry(time.Minute, "quota", "gemini-2.5-pro", "prod", "a@example.com")
+	own.Tenant = "team-a"
+	other := failedEntry(time.Minute, "auth", "gemini-2.5-pro", "prod", "b@example.com")
+	other.Tenant = "team-b"
+	s.insert(own)
+	s.insert(other)
+
+	m := s.GetErrorMatrix(WithTenant(context.Background(), "team-a"), time.Hour)
+	if m.Requests != 1 || len(m.Cells) != 1 || m.Cells[0].Class != "quota" {
+		t.Fatalf("tenant matrix = %+v", m)
+	}
+	if m := s.GetErrorMatrix(context.Background(), time.Hour); len(m.Cells) != 2 {
+		t.Fatalf("admin matrix has %d cells, want 2", len(m.Cells))
+	}
+}
+
+func TestErrorMatrixEmpty(t *testing.T) {
+	m := newTestLogStore(t, 1000, 0).GetErrorMatrix(context.Background(), 15*time.Minute)
+	// 空结果序列化为 [] 和 {}，不是 null
+	if m.Cells == nil || m.ByClass == nil || m.WindowMinutes != 15 {
+		t.Fatalf("empty matrix = %+v", m)
+	}
+}
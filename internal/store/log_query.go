@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LogFilter 日志查询条件（零值表示不过滤）
+type LogFilter struct {
+	Model   string
+	Email   string // 不区分大小写
+	Status  int
+	Success *bool
+	From    time.Time // 包含
+	To      time.Time // 不包含
+}
+
+func (f *LogFilter) matches(log *LogEntry) bool {
+	if f.Model != "" && log.Model != f.Model {
+		return false
+	}
+	if f.Email != "" && !strings.EqualFold(log.Email, f.Email) {
+		return false
+	}
+	if f.Status != 0 && log.Status != f.Status {
+		return false
+	}
+	if f.Success != nil && log.Success != *f.Success {
+		return false
+	}
+	if !f.From.IsZero() && log.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !log.Timestamp.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// List 分页查询对请求租户可见的日志（最新的在前，不含详情），返回本页日志和符合条件的总数
+func (s *LogStore) List(ctx context.Context, offset, limit int, filter LogFilter) ([]LogEntry, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]LogEntry, 0)
+	total := 0
+	for i := len(s.logs) - 1; i >= 0; i-- {
+		log := s.logs[i]
+		if !VisibleTo(ctx, log.Tenant) || !filter.matches(&log) {
+			continue
+		}
+		total++
+		if total <= offset || (limit > 0 && len(result) >= limit) {
+			continue
+		}
+		_, log.HasDetail = s.details[log.ID] // 详情可能已因内存预算被丢弃
+		result = append(result, log)
+	}
+	return result, total
+}
+
+// 全文搜索命中的位置
+const (
+	MatchedInPrompt = "prompt"
+	MatchedInOutput = "output"
+)
+
+// LogSearch 日志全文搜索条件：在保留的请求消息文本和模型输出中查找
+type LogSearch struct {
+	Query   string         // 不区分大小写的子串
+	Pattern *regexp.Regexp // 非空时按正则匹配（忽略 Query）
+	MaxScan int            // 最多检查的日志条数（从最新的开始），0 为不限
+}
+
+// LogSearchStats 搜索执行情况
+type LogSearchStats struct {
+	Scanned   int  `json:"scanned"`   // 检查过内容的日志数
+	Truncated bool `json:"truncated"` // 达到检查上限，更早的日志未搜索
+}
+
+func (q *LogSearch) match(text string) bool {
+	if text == "" {
+		return false
+	}
+	if q.Pattern != nil {
+		return q.Pattern.MatchString(text)
+	}
+	return strings.Contains(strings.ToLower(text), strings.ToLower(q.Query))
+}
+
+// Search 在符合过滤条件的日志中全文搜索（最新的在前，不含详情），每条结果的 MatchedIn 标明命中位置。
+// 只搜索仍保留详情的日志，内容与日志详情中记录的一致（已按捕获级别脱敏）
+func (s *LogStore) Search(ctx context.Context, offset, limit int, filter LogFilter, search LogSearch) ([]LogEntry, int, LogSearchStats) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]LogEntry, 0)
+	total := 0
+	var stats LogSearchStats
+	for i := len(s.logs) - 1; i >= 0; i-- {
+		log := s.logs[i]
+		if !VisibleTo(ctx, log.Tenant) || !filter.matches(&log) {
+			continue
+		}
+		slot, ok := s.details[log.ID]
+		if !ok {
+			continue
+		}
+		if search.MaxScan > 0 && stats.Scanned >= search.MaxScan {
+			stats.Truncated = true
+			break
+		}
+		stats.Scanned++
+
+		var matchedIn []string
+		if search.match(requestText(slot.detail.Request)) {
+			matchedIn = append(matchedIn, MatchedInPrompt)
+		}
+		if resp := slot.detail.Response; resp != nil && search.match(resp.ModelOutput) {
+			matchedIn = append(matchedIn, MatchedInOutput)
+		}
+		if len(matchedIn) == 0 {
+			continue
+		}
+
+		total++
+		if total <= offset || (limit > 0 && len(result) >= limit) {
+			continue
+		}
+		log.HasDetail = true
+		log.MatchedIn = matchedIn
+		result = append(result, log)
+	}
+	return result, total, stats
+}
+
+// searchTextKeys 请求体中作为消息文本搜索的字段（不含模型名、角色、图片数据等）
+var searchTextKeys = map[string]bool{
+	"content":           true,
+	"text":              true,
+	"prompt":            true,
+	"input":             true,
+	"instructions":      true,
+	"system":            true,
+	"arguments":         true,
+	"reasoning":         true,
+	"reasoning_content": true,
+}
+
+// requestText 提取请求快照中的消息文本（任意协议，按字段名识别），各段以换行分隔
+func requestText(req *RequestSnapshot) string {
+	if req == nil || req.Body == nil {
+		return ""
+	}
+	// 内存中的请求体是协议结构体，从文件加载的是 JSON 解码后的值，统一按 JSON 结构遍历
+	data, err := json.Marshal(req.Body)
+	if err != nil {
+		return ""
+	}
+	var body interface{}
+	if json.Unmarshal(data, &body) != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	var walk func(v interface{}, text bool)
+	walk = func(v interface{}, text bool) {
+		switch v := v.(type) {
+		case string:
+			if text && v != "" {
+				sb.WriteString(v)
+				sb.WriteByte('\n')
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item, text)
+			}
+		case map[string]interface{}:
+			for key, item := range v {
+				walk(item, searchTextKeys[key])
+			}
+		}
+	}
+	walk(body, false)
+	return sb.String()
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"anti2api-golang/internal/logger"
+)
+
+// 日志写入策略：fail-open。请求处理只负责把日志放入有界队列，由后台协程写入存储；
+// 队列已满或存储出错时丢弃并计数，不会阻塞或影响客户端请求
+
+// logHealthWindow 最近出现丢弃或错误多久内视为降级
+const logHealthWindow = 5 * time.Minute
+
+// logWarnInterval 丢弃/错误告警的最小间隔
+const logWarnInterval = time.Minute
+
+// LogHealth 日志子系统状态
+type LogHealth struct {
+	Status      string     `json:"status"` // ok、degraded
+	Queued      int        `json:"queued"`
+	QueueSize   int        `json:"queueSize"`
+	Written     int64      `json:"written"`
+	Dropped     int64      `json:"dropped"` // 队列已满丢弃的日志
+	Errors      int64      `json:"errors"`  // 写入或保存失败次数
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+	LastDropAt  *time.Time `json:"lastDropAt,omitempty"`
+}
+
+// logQueue 日志写入队列
+type logQueue struct {
+	entries chan LogEntry
+	pending atomic.Int64 // 已入队未处理完的日志数
+
+	written atomic.Int64
+	dropped atomic.Int64
+	errors  atomic.Int64
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+	lastDropAt  time.Time
+	lastWarnAt  time.Time
+	unreported  int64 // 上次告警后新增的丢弃/错误数
+}
+
+func newLogQueue(size int) *logQueue {
+	if size <= 0 {
+		size = 1
+	}
+	return &logQueue{entries: make(chan LogEntry, size)}
+}
+
+// Add 添加日志（不阻塞：队列已满时丢弃并计数）
+func (s *LogStore) Add(entry LogEntry) {
+	q := s.queue
+	q.pending.Add(1)
+	select {
+	case q.entries <- entry:
+	default:
+		q.pending.Add(-1)
+		q.dropped.Add(1)
+		q.recordProblem("", true)
+	}
+}
+
+// runQueue 后台写入协程：队列排空后保存一次
+func (s *LogStore) runQueue() {
+	q := s.queue
+	for entry := range q.entries {
+		if err := s.safeInsert(entry); err != nil {
+			q.errors.Add(1)
+			q.recordProblem(err.Error(), false)
+		} else {
+			q.written.Add(1)
+		}
+
+		if len(q.entries) == 0 {
+			s.mu.RLock()
+			err := s.saveUnlocked()
+			s.mu.RUnlock()
+			if err != nil {
+				q.errors.Add(1)
+				q.recordProblem("save: "+err.Error(), false)
+			}
+		}
+		q.pending.Add(-1)
+	}
+}
+
+// safeInsert 写入日志，存储层 panic 视为错误（不影响后续日志）
+func (s *LogStore) safeInsert(entry LogEntry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	s.insert(entry)
+	return nil
+}
+
+// recordProblem 记录丢弃或错误，按间隔输出告警
+func (q *logQueue) recordProblem(errMsg string, dropped bool) {
+	now := time.Now()
+
+	q.mu.Lock()
+	if dropped {
+		q.lastDropAt = now
+	} else {
+		q.lastError = errMsg
+		q.lastErrorAt = now
+	}
+	q.unreported++
+	if now.Sub(q.lastWarnAt) < logWarnInterval {
+		q.mu.Unlock()
+		return
+	}
+	q.lastWarnAt = now
+	count := q.unreported
+	q.unreported = 0
+	q.mu.Unlock()
+
+	logger.Warn("Log subsystem degraded: %d writes dropped or failed since last warning (total dropped=%d, errors=%d)",
+		count, q.dropped.Load(), q.errors.Load())
+}
+
+// Drain 等待队列中的日志写入完成（关闭服务时调用）
+func (s *LogStore) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for s.queue.pending.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Health 日志子系统状态（最近出现丢弃、错误或队列接近满时为 degraded）
+func (s *LogStore) Health() LogHealth {
+	q := s.queue
+	q.mu.Lock()
+	health := LogHealth{
+		Status:    "ok",
+		Queued:    len(q.entries),
+		QueueSize: cap(q.entries),
+		Written:   q.written.Load(),
+		Dropped:   q.dropped.Load(),
+		Errors:    q.errors.Load(),
+		LastError: q.lastError,
+	}
+	lastErrorAt, lastDropAt := q.lastErrorAt, q.lastDropAt
+	q.mu.Unlock()
+
+	if !lastErrorAt.IsZero() {
+		health.LastErrorAt = &lastErrorAt
+	}
+	if !lastDropAt.IsZero() {
+		health.LastDropAt = &lastDropAt
+	}
+	recent := func(t time.Time) bool { return !t.IsZero() && time.Since(t) < logHealthWindow }
+	if recent(lastErrorAt) || recent(lastDropAt) || health.Queued*5 >= health.QueueSize*4 {
+		health.Status = "degraded"
+	}
+	return health
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newQueuedLogStore 带写入队列和后台写入协程的日志存储
+func newQueuedLogStore(t *testing.T, queueSize int) *LogStore {
+	t.Helper()
+	s := newTestLogStore(t, 1000, 0)
+	s.queue = newLogQueue(queueSize)
+	go s.runQueue()
+	t.Cleanup(func() { close(s.queue.entries) })
+	return s
+}
+
+// hangBackend 持有存储的写锁，模拟卡住的存储后端，返回恢复函数
+func hangBackend(s *LogStore) (release func()) {
+	s.mu.Lock()
+	var once sync.Once
+	return func() { once.Do(s.mu.Unlock) }
+}
+
+// waitInFlight 等待后台协程取走一条日志并卡在存储上
+func waitInFlight(t *testing.T, s *LogStore) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.queue.entries) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("writer never picked up the first entry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLogAddDoesNotBlockOnHangingBackend(t *testing.T) {
+	const queueSize = 8
+	s := newQueuedLogStore(t, queueSize)
+	release := hangBackend(s)
+	defer release()
+
+	s.Add(LogEntry{ID: "in-flight", Status: 200})
+	waitInFlight(t, s)
+
+	// 模拟并发的请求处理：每次写日志都立即返回
+	const requests, perRequest = 20, 50
+	var wg sync.WaitGroup
+	latencies := make(chan time.Duration, requests*perRequest)
+	for r := 0; r < requests; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perRequest; i++ {
+				start := time.Now()
+				s.Add(LogEntry{ID: "req", Status: 200})
+				latencies <- time.Since(start)
+			}
+		}()
+	}
+	wg.Wait()
+	close(latencies)
+	var slowest time.Duration
+	for d := range latencies {
+		slowest = max(slowest, d)
+	}
+	if slowest > 100*time.Millisecond {
+		t.Fatalf("Add blocked for %v with a hanging backend", slowest)
+	}
+
+	// 队列容纳 queueSize 条，其余丢弃并计数
+	health := s.Health()
+	if health.Dropped != requests*perRequest-queueSize {
+		t.Fatalf("dropped = %d, want %d", health.Dropped, requests*perRequest-queueSize)
+	}
+	if health.Status != "degraded" || health.Queued != queueSize || health.LastDropAt == nil {
+		t.Fatalf("health = %+v, want degraded with a full queue", health)
+	}
+
+	// 后端恢复后写入队列中的日志
+	release()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	health = s.Health()
+	if health.Written != queueSize+1 || health.Queued != 0 {
+		t.Fatalf("health after recovery = %+v, want %d written", health, queueSize+1)
+	}
+	if logs, _ := s.List(context.Background(), 0, 0, LogFilter{}); len(logs) != queueSize+1 {
+		t.Fatalf("%d logs stored, want %d", len(logs), queueSize+1)
+	}
+}
+
+func TestLogDrainRespectsContext(t *testing.T) {
+	s := newQueuedLogStore(t, 4)
+	release := hangBackend(s)
+	defer release()
+
+	s.Add(LogEntry{ID: "stuck", Status: 200})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := s.Drain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Drain = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Drain returned after %v", elapsed)
+	}
+}
+
+func TestLogSaveErrorsCounted(t *testing.T) {
+	s := newQueuedLogStore(t, 16)
+	// 日志文件位置被一个非空目录占用，保存失败
+	if err := os.MkdirAll(filepath.Join(s.filePath, "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		s.Add(LogEntry{ID: "entry", Status: 200})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := s.Drain(ctx)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	health := s.Health()
+	// 日志仍写入内存，保存失败计为错误
+	if health.Written != 3 || health.Errors != 3 || health.Dropped != 0 {
+		t.Fatalf("health = %+v, want 3 written and 3 save errors", health)
+	}
+	if health.Status != "degraded" || !strings.HasPrefix(health.LastError, "save: ") || health.LastErrorAt == nil {
+		t.Fatalf("health = %+v", health)
+	}
+}
+
+func TestLogInsertPanicCountedAsError(t *testing.T) {
+	s := newQueuedLogStore(t, 16)
+	// 详情表缺失时写入详情会 panic，模拟存储层的异常
+	s.details = nil
+
+	s.Add(detailEntry(1, 10))
+	s.Add(LogEntry{ID: "after", Status: 200})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	health := s.Health()
+	if health.Errors != 1 || health.Written != 1 || !strings.HasPrefix(health.LastError, "panic: ") {
+		t.Fatalf("health = %+v, want one panic error and the next entry written", health)
+	}
+}
+
+func TestLogHealthOK(t *testing.T) {
+	s := newQueuedLogStore(t, 16)
+	s.Add(LogEntry{ID: "ok", Status: 200})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	health := s.Health()
+	if health.Status != "ok" || health.Written != 1 || health.QueueSize != 16 || health.LastErrorAt != nil || health.LastDropAt != nil {
+		t.Fatalf("health = %+v", health)
+	}
+
+	// 问题超过观察窗口后恢复为 ok
+	s.queue.mu.Lock()
+	s.queue.lastDropAt = time.Now().Add(-logHealthWindow - time.Second)
+	s.queue.mu.Unlock()
+	if health := s.Health(); health.Status != "ok" || health.LastDropAt == nil {
+		t.Fatalf("health with an old drop = %+v", health)
+	}
+}
+
+func TestLogProblemWarningsRateLimited(t *testing.T) {
+	q := newLogQueue(1)
+	q.recordProblem("first", false)
+	warnedAt := q.lastWarnAt
+	for i := 0; i < 10; i++ {
+		q.recordProblem("", true)
+	}
+	// 间隔内不重复告警，累计到下一次告警
+	if q.lastWarnAt != warnedAt || q.unreported != 10 {
+		t.Fatalf("lastWarnAt moved or unreported = %d", q.unreported)
+	}
+	q.lastWarnAt = q.lastWarnAt.Add(-logWarnInterval)
+	q.recordProblem("later", false)
+	if q.unreported != 0 || q.lastError != "later" {
+		t.Fatalf("unreported = %d, lastError = %q after the interval", q.unreported, q.lastError)
+	}
+}
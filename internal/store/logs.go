@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -8,8 +9,27 @@ import (
 	"time"
 
 	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/persist"
 )
 
+// 客户端请求协议（日志中请求快照的格式）
+const (
+	ProtocolOpenAI    = "openai"
+	ProtocolGemini    = "gemini"
+	ProtocolAnthropic = "anthropic"
+	ProtocolResponses = "responses"
+)
+
+// RequestSummary 各协议请求的通用摘要
+type RequestSummary struct {
+	Model        string `json:"model,omitempty"`
+	Messages     int    `json:"messages"`     // 消息数（Gemini 为 contents 数）
+	PromptTokens int    `json:"promptTokens"` // 本地估算的提示 Token
+	Images       int    `json:"images,omitempty"`
+	Tools        int    `json:"tools,omitempty"` // 函数声明数
+}
+
 // LogEntry 日志条目
 type LogEntry struct {
 	ID         string      `json:"id"`
@@ -21,22 +41,66 @@ type LogEntry struct {
 	Model      string      `json:"model"`
 	Method     string      `json:"method"`
 	Path       string      `json:"path"`
+	Protocol   string      `json:"protocol,omitempty"`   // 客户端请求协议（旧日志为空，按 openai 处理）
+	Summary    *RequestSummary `json:"summary,omitempty"` // 请求摘要
 	DurationMs int64       `json:"durationMs"`
 	Message    string      `json:"message,omitempty"`
 	HasDetail  bool        `json:"hasDetail"`
+	MatchedIn  []string    `json:"matchedIn,omitempty"`  // 全文搜索命中的位置（prompt、output），只在搜索结果中出现
+	Moderation []string    `json:"moderation,omitempty"` // 内容审核命中的分类
+	Quarantine []string    `json:"quarantine,omitempty"` // 工具调用隔离规则命中（rule:action）
+	PostProcessed int      `json:"postProcessed,omitempty"` // 生效的后处理规则数
+	Empty      bool        `json:"empty,omitempty"`      // 上游成功返回但没有内容和工具调用
+	Compression string     `json:"compression,omitempty"` // 系统提示压缩方式（minify、reference）
+	CompressionSaved int   `json:"compressionSaved,omitempty"` // 压缩节省的估算 Token 数
+	Chaos      bool        `json:"chaos,omitempty"`      // 由故障注入产生的失败
+	ErrorClass string      `json:"errorClass,omitempty"` // 失败分类（auth、quota、safety、schema、timeout、transport、unknown）
+	Endpoint   string      `json:"endpoint,omitempty"`   // 上游端点
+	Tenant     string      `json:"tenant,omitempty"`     // 所属租户
+	ClientIP   string      `json:"clientIp,omitempty"`   // 客户端 IP（经受信任代理解析）
+	UsageWarning string    `json:"usageWarning,omitempty"` // 上游用量与估算严重不符
+	Warnings   []string    `json:"warnings,omitempty"`   // 请求处理警告（丢弃的参数、降级转换的内容）
+	KeyID      string      `json:"keyId,omitempty"`      // API Key 哈希前缀（用量归属）
+	Fallbacks  int         `json:"fallbacks,omitempty"`  // 上游拒绝账号后切换账号的次数（账号字段为最终处理请求的账号）
+	Route      *RouteExplanation `json:"route,omitempty"` // 账号和端点的选择过程（从账号池选择账号的请求）
+	Passthrough string     `json:"passthrough,omitempty"` // 透传凭证的哈希前缀
+	TraceID    string      `json:"traceId,omitempty"`    // 链路追踪 ID（已采样的请求）
+	PromptTokens int       `json:"promptTokens,omitempty"`
+	CompletionTokens int   `json:"completionTokens,omitempty"`
+	Stream     *StreamStats `json:"stream,omitempty"`    // 流式输出统计
+	Validation *ValidationResult `json:"validation,omitempty"` // 响应校验结果
 	Detail     *LogDetail  `json:"detail,omitempty"`
 }
 
+// ValidationResult 响应校验结果
+type ValidationResult struct {
+	Failed  []string `json:"failed,omitempty"` // 最终未通过的校验器
+	Retried bool     `json:"retried"`          // 是否因校验失败重试过
+}
+
+// StreamStats 流式输出统计（用于调整增量合并间隔）
+type StreamStats struct {
+	CoalesceMs    int     `json:"coalesceMs"`
+	Deltas        int     `json:"deltas"`        // 上游增量数
+	Chunks        int     `json:"chunks"`        // 实际输出的内容 chunk 数
+	AvgDeltaBytes float64 `json:"avgDeltaBytes"` // 合并前平均 chunk 大小
+	AvgChunkBytes float64 `json:"avgChunkBytes"` // 合并后平均 chunk 大小
+}
+
 // LogDetail 日志详情
 type LogDetail struct {
 	Request  *RequestSnapshot  `json:"request,omitempty"`
 	Response *ResponseSnapshot `json:"response,omitempty"`
+	UpstreamHeaders map[string]string `json:"upstreamHeaders,omitempty"` // 发往上游的请求头（调试捕获，Authorization 已脱敏）
+	UsageEvents interface{} `json:"usageEvents,omitempty"` // 上游发送的原始 usageMetadata 序列（调试捕获）
+	TokenBudget interface{} `json:"tokenBudget,omitempty"` // 回答与思考预算的计算过程（调试捕获）
 }
 
 // RequestSnapshot 请求快照
 type RequestSnapshot struct {
-	Headers map[string]string `json:"headers,omitempty"`
-	Body    interface{}       `json:"body,omitempty"`
+	Protocol string            `json:"protocol,omitempty"` // Body 的格式
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     interface{}       `json:"body,omitempty"`
 }
 
 // ResponseSnapshot 响应快照
@@ -57,13 +121,22 @@ type UsageStats struct {
 	Models      []string   `json:"models,omitempty"`
 }
 
-// LogStore 日志存储
+// LogStore 日志存储（内存中按时间从旧到新保存，插入为摊还 O(1)）
 type LogStore struct {
 	mu         sync.RWMutex
-	logs       []LogEntry
+	logs       []LogEntry // 不含详情，详情单独保存并计入内存预算
 	filePath   string
 	maxLogs    int
 	usageCache map[string]*UsageStats // 按 email 或 projectId 缓存用量
+
+	details        map[string]*detailSlot // 按日志 ID 保存的详情
+	detailQueue    []string               // 持有详情的日志 ID（从旧到新），从 detailHead 开始有效
+	detailHead     int
+	detailBytes    int64 // 详情占用的内存（估算）
+	maxDetailBytes int64 // 详情内存预算，超出时从最旧的详情开始丢弃（0 为不限）
+	evictedDetails int64
+
+	queue *logQueue // 写入队列（Add 不阻塞请求）
 }
 
 // getAccountKey 获取账号的唯一标识（优先 email，其次 projectId）
@@ -86,12 +159,26 @@ var (
 func GetLogStore() *LogStore {
 	logStoreOnce.Do(func() {
 		cfg := config.Get()
+		maxLogs := cfg.LogMaxEntries
+		if maxLogs < 1 {
+			maxLogs = 1000
+		}
 		logStore = &LogStore{
-			filePath:   filepath.Join(cfg.DataDir, "logs.json"),
-			maxLogs:    1000, // 最多保存 1000 条日志
-			usageCache: make(map[string]*UsageStats),
+			filePath:       filepath.Join(cfg.DataDir, "logs.json"),
+			maxLogs:        maxLogs,
+			usageCache:     make(map[string]*UsageStats),
+			details:        make(map[string]*detailSlot),
+			maxDetailBytes: int64(cfg.LogDetailMaxMB) << 20,
+			queue:          newLogQueue(cfg.LogQueueSize),
 		}
 		logStore.Load()
+		monitor.Go("log-queue", logStore.runQueue)
+		persist.Register(persist.File{
+			Name:   "logs.json",
+			Path:   logStore.filePath,
+			Flush:  logStore.Save,
+			Reload: logStore.Load,
+		})
 	})
 	return logStore
 }
@@ -107,10 +194,12 @@ func (s *LogStore) Load() error {
 		return err
 	}
 
-	data, err := os.ReadFile(s.filePath)
+	s.resetDetailsUnlocked()
+	data, err := persist.ReadFile(s.filePath, persist.ValidJSON)
 	if err != nil {
+		s.logs = []LogEntry{}
+		s.rebuildUsageCache()
 		if os.IsNotExist(err) {
-			s.logs = []LogEntry{}
 			return nil
 		}
 		return err
@@ -120,6 +209,13 @@ func (s *LogStore) Load() error {
 		s.logs = []LogEntry{}
 		return err
 	}
+	// 文件中最新的在前（调小 LOG_MAX_ENTRIES 后只保留最新的部分）
+	if len(s.logs) > s.maxLogs {
+		s.logs = s.logs[:s.maxLogs]
+	}
+	for i, j := 0, len(s.logs)-1; i < j; i, j = i+1, j-1 {
+		s.logs[i], s.logs[j] = s.logs[j], s.logs[i]
+	}
 
 	// 重建用量缓存
 	s.rebuildUsageCache()
@@ -134,22 +230,21 @@ func (s *LogStore) Save() error {
 }
 
 func (s *LogStore) saveUnlocked() error {
-	// 保存时不保存详情，减少文件大小
-	logsWithoutDetail := make([]LogEntry, len(s.logs))
+	// 详情不落盘（内存中的日志本身不含详情），文件中最新的在前
+	newestFirst := make([]LogEntry, len(s.logs))
 	for i, log := range s.logs {
-		logsWithoutDetail[i] = log
-		logsWithoutDetail[i].Detail = nil
+		newestFirst[len(s.logs)-1-i] = log
 	}
 
-	data, err := json.MarshalIndent(logsWithoutDetail, "", "  ")
+	data, err := json.MarshalIndent(newestFirst, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.filePath, data, 0644)
+	return persist.WriteFile(s.filePath, data, 0644)
 }
 
-// Add 添加日志
-func (s *LogStore) Add(entry LogEntry) {
+// insert 写入日志（由写入队列调用）
+func (s *LogStore) insert(entry LogEntry) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -158,60 +253,51 @@ func (s *LogStore) Add(entry LogEntry) {
 		entry.Timestamp = time.Now()
 	}
 
-	// 设置 HasDetail
+	// 详情单独保存，计入内存预算
 	entry.HasDetail = entry.Detail != nil
+	if entry.Detail != nil {
+		s.putDetailUnlocked(entry.ID, entry.Detail)
+		entry.Detail = nil
+	}
 
-	// 添加到头部（最新的在前）
-	s.logs = append([]LogEntry{entry}, s.logs...)
+	s.logs = append(s.logs, entry)
 
-	// 限制数量
-	if len(s.logs) > s.maxLogs {
-		s.logs = s.logs[:s.maxLogs]
+	// 限制数量（丢弃最旧的日志及其详情）
+	if over := len(s.logs) - s.maxLogs; over > 0 {
+		for _, old := range s.logs[:over] {
+			s.dropDetailUnlocked(old.ID)
+		}
+		s.logs = s.logs[over:]
+		s.skipStaleDetailsUnlocked()
 	}
 
 	// 更新用量缓存
 	s.updateUsageCache(&entry)
-
-	// 异步保存
-	go func() {
-		s.mu.RLock()
-		defer s.mu.RUnlock()
-		s.saveUnlocked()
-	}()
-}
-
-// GetAll 获取所有日志（不含详情）
-func (s *LogStore) GetAll(limit int) []LogEntry {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	if limit <= 0 || limit > len(s.logs) {
-		limit = len(s.logs)
-	}
-
-	result := make([]LogEntry, limit)
-	for i := 0; i < limit; i++ {
-		result[i] = s.logs[i]
-		result[i].Detail = nil // 列表不返回详情
-	}
-	return result
+	GetUsageLedger().Record(&entry)
+	GetHealthTracker().Record(&entry)
 }
 
 // GetByID 按 ID 获取日志（含详情）
-func (s *LogStore) GetByID(id string) *LogEntry {
+func (s *LogStore) GetByID(ctx context.Context, id string) *LogEntry {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	for _, log := range s.logs {
-		if log.ID == id {
+	for i := len(s.logs) - 1; i >= 0; i-- {
+		log := s.logs[i]
+		if log.ID == id && VisibleTo(ctx, log.Tenant) {
+			log.HasDetail = false
+			if slot, ok := s.details[id]; ok {
+				log.Detail = slot.detail
+				log.HasDetail = true
+			}
 			return &log
 		}
 	}
 	return nil
 }
 
-// GetUsageStats 获取用量统计
-func (s *LogStore) GetUsageStats(windowMinutes int) []UsageStats {
+// GetUsageStats 获取对请求租户可见的用量统计
+func (s *LogStore) GetUsageStats(ctx context.Context, windowMinutes int) []UsageStats {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -222,7 +308,7 @@ func (s *LogStore) GetUsageStats(windowMinutes int) []UsageStats {
 	modelMap := make(map[string]map[string]bool)
 
 	for _, log := range s.logs {
-		if log.Timestamp.Before(cutoff) {
+		if log.Timestamp.Before(cutoff) || !VisibleTo(ctx, log.Tenant) {
 			continue
 		}
 
@@ -281,13 +367,30 @@ func (s *LogStore) GetAccountUsage(projectID string) *UsageStats {
 	return nil
 }
 
-// GetAllAccountsUsage 获取所有账号的用量
-func (s *LogStore) GetAllAccountsUsage() map[string]*UsageStats {
+// GetAllAccountsUsage 获取对请求租户可见的账号的用量
+func (s *LogStore) GetAllAccountsUsage(ctx context.Context) map[string]*UsageStats {
+	// 租户请求只返回本租户账号的用量（先取账号列表，避免同时持有两个锁）
+	var visible map[string]bool
+	if _, scoped := TenantFromContext(ctx); scoped {
+		visible = make(map[string]bool)
+		for _, a := range GetAccountStore().GetAll(ctx) {
+			if a.Email != "" {
+				visible[a.Email] = true
+			}
+			if a.ProjectID != "" {
+				visible[a.ProjectID] = true
+			}
+		}
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	result := make(map[string]*UsageStats)
 	for k, v := range s.usageCache {
+		if visible != nil && !visible[k] {
+			continue
+		}
 		copied := *v
 		result[k] = &copied
 	}
@@ -391,5 +494,6 @@ func (s *LogStore) Clear() error {
 
 	s.logs = []LogEntry{}
 	s.usageCache = make(map[string]*UsageStats)
+	s.resetDetailsUnlocked()
 	return s.saveUnlocked()
 }
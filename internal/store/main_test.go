@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/notify"
+)
+
+// TestMain 所有测试共用一个临时数据目录（config 在首次读取时确定 DATA_DIR）
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "anti2api-store-test")
+	if err != nil {
+		panic(err)
+	}
+	sink := httptest.NewServer(http.HandlerFunc(recordWebhook))
+	os.Setenv("DATA_DIR", dir)
+	os.Setenv("CONVERSATION_AFFINITY", "true")
+	os.Setenv("WEBHOOK_URLS", sink.URL)
+	os.Setenv("WEBHOOK_COOLDOWN", "0")
+	RegisterCredentialProvider(CredentialOAuth, func(a *Account) CredentialProvider {
+		return testCredentials{id: a.ID}
+	})
+	code := m.Run()
+	sink.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// webhookPayloads 告警 Webhook 收到的事件（冷却为 0，每次触发都会发送）
+var webhookPayloads = make(chan notify.Payload, 100)
+
+func recordWebhook(w http.ResponseWriter, r *http.Request) {
+	var payload notify.Payload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err == nil {
+		select {
+		case webhookPayloads <- payload:
+		default:
+		}
+	}
+}
+
+// waitWebhook 等待类型为 event 且 match 返回 true 的事件（其他测试异步发送的事件被丢弃），超时返回 false
+func waitWebhook(t *testing.T, event string, match func(details map[string]interface{}) bool, timeout time.Duration) (notify.Payload, bool) {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case p := <-webhookPayloads:
+			if p.Event == event && match(p.Details) {
+				return p, true
+			}
+		case <-deadline:
+			return notify.Payload{}, false
+		}
+	}
+}
+
+// newTestStore 创建独立的账号存储（文件位于测试的临时目录）
+func newTestStore(t *testing.T, accounts ...Account) *AccountStore {
+	t.Helper()
+	s := &AccountStore{filePath: filepath.Join(t.TempDir(), "accounts.json")}
+	for _, a := range accounts {
+		if _, err := s.addUnlocked(a); err != nil {
+			t.Fatalf("add account: %v", err)
+		}
+	}
+	return s
+}
+
+// freshAccount 启用且 Token 一小时后过期的 OAuth 账号
+func freshAccount(id string) Account {
+	return Account{
+		ID:           id,
+		Email:        id + "@example.com",
+		AccessToken:  "access-" + id,
+		RefreshToken: "refresh-" + id,
+		ExpiresIn:    3600,
+		Timestamp:    time.Now().UnixMilli(),
+		Enable:       true,
+	}
+}
+
+// testCredentials 测试用的凭证实现：按账号 ID 返回 testCredentialErrors 中设置的错误，记录调用顺序
+type testCredentials struct{ id string }
+
+var (
+	testCredentialMu     sync.Mutex
+	testCredentialErrors = make(map[string]error)
+	testCredentialCalls  []string
+)
+
+func (c testCredentials) Token(ctx context.Context) (string, time.Time, error) {
+	testCredentialMu.Lock()
+	defer testCredentialMu.Unlock()
+	testCredentialCalls = append(testCredentialCalls, c.id)
+	if err := testCredentialErrors[c.id]; err != nil {
+		return "", time.Time{}, err
+	}
+	return "refreshed-" + c.id, time.Now().Add(time.Hour), nil
+}
+
+// failRefresh 让账号的 Token 刷新返回 err，并清空调用记录（测试结束时恢复）
+func failRefresh(t *testing.T, id string, err error) {
+	t.Helper()
+	testCredentialMu.Lock()
+	testCredentialErrors[id] = err
+	testCredentialMu.Unlock()
+	t.Cleanup(func() {
+		testCredentialMu.Lock()
+		delete(testCredentialErrors, id)
+		testCredentialMu.Unlock()
+	})
+}
+
+// refreshCalls 返回并清空 Token 刷新的调用记录
+func refreshCalls() []string {
+	testCredentialMu.Lock()
+	defer testCredentialMu.Unlock()
+	calls := testCredentialCalls
+	testCredentialCalls = nil
+	return calls
+}
+
+// expiringAccount Token 将在 d 后过期的账号
+func expiringAccount(id string, d time.Duration) Account {
+	a := freshAccount(id)
+	a.ExpiresIn = int(d / time.Second)
+	return a
+}
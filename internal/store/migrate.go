@@ -0,0 +1,99 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"anti2api-golang/internal/utils"
+)
+
+// AccountFileVersion 当前 accounts.json 格式版本
+//
+//	v0: 账号数组（无版本号）
+//	v1: {"version": 1, "accounts": [...]}，每个账号带稳定 ID
+const AccountFileVersion = 1
+
+// accountFile accounts.json 的版本化格式
+type accountFile struct {
+	Version  int       `json:"version"`
+	Accounts []Account `json:"accounts"`
+}
+
+// accountMigration 将 accounts.json 从版本 i 迁移到 i+1
+type accountMigration func(data []byte) ([]byte, error)
+
+// accountMigrations 迁移链，下标为源版本
+var accountMigrations = []accountMigration{
+	migrateAccountsV0ToV1,
+}
+
+// migrateAccountsV0ToV1 数组包装为带版本号的结构，并为每个账号生成 ID
+func migrateAccountsV0ToV1(data []byte) ([]byte, error) {
+	var accounts []json.RawMessage
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, err
+	}
+
+	migrated := make([]json.RawMessage, 0, len(accounts))
+	for _, raw := range accounts {
+		// 按原始字段处理，不依赖当前的 Account 结构
+		var fields map[string]interface{}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+		if id, _ := fields["id"].(string); id == "" {
+			fields["id"] = utils.GenerateAccountID()
+		}
+		out, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		migrated = append(migrated, out)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"version":  1,
+		"accounts": migrated,
+	})
+}
+
+// detectAccountFileVersion 识别 accounts.json 的格式版本
+func detectAccountFileVersion(data []byte) (int, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] == '[' {
+		return 0, nil
+	}
+
+	var header struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(trimmed, &header); err != nil {
+		return 0, err
+	}
+	if header.Version == nil {
+		return 0, fmt.Errorf("missing version field")
+	}
+	return *header.Version, nil
+}
+
+// migrateAccountFile 按迁移链将数据升级到当前版本，返回升级后的数据和原始版本
+func migrateAccountFile(data []byte) ([]byte, int, error) {
+	from, err := detectAccountFileVersion(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if from > AccountFileVersion {
+		return nil, from, fmt.Errorf("accounts file version %d is newer than supported version %d, refusing to load (upgrade the server or restore a backup)", from, AccountFileVersion)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("[]")
+	}
+
+	for v := from; v < AccountFileVersion; v++ {
+		if data, err = accountMigrations[v](data); err != nil {
+			return nil, from, fmt.Errorf("migrate accounts file v%d to v%d: %w", v, v+1, err)
+		}
+	}
+	return data, from, nil
+}
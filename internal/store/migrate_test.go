@@ -0,0 +1,140 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadFixture 将 testdata 中的 accounts 文件复制到临时目录并加载，返回存储、原始内容和加载错误
+func loadFixture(t *testing.T, name string) (*AccountStore, []byte, error) {
+	t.Helper()
+	original, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	if err := os.WriteFile(path, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &AccountStore{filePath: path}
+	return s, original, s.Load()
+}
+
+// savedFile 读取存储写入的 accounts 文件
+func savedFile(t *testing.T, s *AccountStore) accountFile {
+	t.Helper()
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file accountFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("saved file is not the versioned format: %v\n%s", err, data)
+	}
+	return file
+}
+
+func TestMigrateAccountsV0(t *testing.T) {
+	s, original, err := loadFixture(t, "accounts_v0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.accounts) != 2 {
+		t.Fatalf("loaded %d accounts, want 2", len(s.accounts))
+	}
+	one, two := s.accounts[0], s.accounts[1]
+	if one.Email != "one@example.com" || one.AccessToken != "ya29.legacy-one" || one.RefreshToken != "1//legacy-one" ||
+		one.ProjectID != "legacy-project-one" || one.ExpiresIn != 3599 || one.Timestamp != 1735689600000 || !one.Enable {
+		t.Errorf("first account fields changed: %+v", one)
+	}
+	if two.Email != "two@example.com" || two.Enable {
+		t.Errorf("second account fields changed: %+v", two)
+	}
+	// v1 为每个账号生成稳定 ID
+	if !strings.HasPrefix(one.ID, "acc-") || !strings.HasPrefix(two.ID, "acc-") || one.ID == two.ID {
+		t.Errorf("ids = %q, %q, want distinct generated ids", one.ID, two.ID)
+	}
+
+	// 迁移后写入新格式，原文件保存为备份
+	file := savedFile(t, s)
+	if file.Version != AccountFileVersion || len(file.Accounts) != 2 || file.Accounts[0].ID != one.ID {
+		t.Errorf("saved file = %+v", file)
+	}
+	backup, err := os.ReadFile(s.filePath + ".v0.bak")
+	if err != nil || !bytes.Equal(backup, original) {
+		t.Errorf("backup = %q (%v), want the original v0 file", backup, err)
+	}
+
+	// 再次加载不再迁移，ID 保持不变
+	reloaded := &AccountStore{filePath: s.filePath}
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.accounts[0].ID != one.ID || reloaded.accounts[1].ID != two.ID {
+		t.Errorf("ids changed on reload: %q, %q", reloaded.accounts[0].ID, reloaded.accounts[1].ID)
+	}
+}
+
+func TestLoadAccountsV1(t *testing.T) {
+	s, original, err := loadFixture(t, "accounts_v1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.accounts) != 1 {
+		t.Fatalf("loaded %d accounts, want 1", len(s.accounts))
+	}
+	a := s.accounts[0]
+	if a.ID != "acc-v1-fixture" || a.Email != "current@example.com" || a.Note != "kept as is" || a.Labels["team"] != "infra" {
+		t.Errorf("account = %+v", a)
+	}
+	// 当前版本不迁移：不写备份，不改写文件
+	if _, err := os.Stat(s.filePath + ".v1.bak"); !os.IsNotExist(err) {
+		t.Errorf("backup written for a current file: %v", err)
+	}
+	if data, _ := os.ReadFile(s.filePath); !bytes.Equal(data, original) {
+		t.Error("current version file was rewritten on load")
+	}
+}
+
+func TestRefuseFutureAccountsVersion(t *testing.T) {
+	s, original, err := loadFixture(t, "accounts_v99.json")
+	if err == nil || !strings.Contains(err.Error(), "version 99") {
+		t.Fatalf("Load = %v, want an error naming version 99", err)
+	}
+	if len(s.accounts) != 0 || s.LoadError() == nil {
+		t.Errorf("accounts = %+v, loadErr = %v", s.accounts, s.LoadError())
+	}
+
+	// 不能覆盖较新版本的文件
+	if err := s.Add(freshAccount("after-refusal")); err == nil {
+		t.Error("Add should fail while the file is not loaded")
+	}
+	if err := s.Save(); err == nil {
+		t.Error("Save should refuse to overwrite a newer file")
+	}
+	if data, _ := os.ReadFile(s.filePath); !bytes.Equal(data, original) {
+		t.Errorf("future version file was modified:\n%s", data)
+	}
+	if matches, _ := filepath.Glob(s.filePath + ".v*.bak"); len(matches) != 0 {
+		t.Errorf("backup written for a refused file: %v", matches)
+	}
+}
+
+func TestRefuseUnversionedAccountsObject(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	original := []byte(`{"accounts":[{"email":"x@example.com"}]}`)
+	if err := os.WriteFile(path, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &AccountStore{filePath: path}
+	if err := s.Load(); err == nil {
+		t.Fatal("Load should reject an object without a version")
+	}
+	if err := s.Save(); err == nil {
+		t.Error("Save should refuse to overwrite an unrecognised file")
+	}
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/persist"
+)
+
+// 管理接口角色（权限依次递增）
+const (
+	RoleViewer   = "viewer"   // 只读：看板、日志、账号
+	RoleOperator = "operator" // 启用/禁用、刷新、排空账号，切换端点，处理待审批请求
+	RoleAdmin    = "admin"    // 导入、删除、导出、Key 管理和全局设置
+)
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// ValidRole 是否为有效角色
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAllows 角色 have 是否满足 need 的要求
+func RoleAllows(have, need string) bool {
+	return roleRanks[have] >= roleRanks[need] && roleRanks[have] > 0
+}
+
+// PanelUser 额外的面板用户
+type PanelUser struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// AdminToken 管理 API 令牌（X-Session-Token 或 Authorization: Bearer 传入，不区分租户）
+type AdminToken struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Role  string `json:"role"`
+}
+
+// PanelAccessStore 面板用户和管理 API 令牌（data/panel_access.json）。
+// PANEL_USER 始终为 admin，租户管理员的角色在 tenants.json 中配置
+type PanelAccessStore struct {
+	mu       sync.RWMutex
+	users    []PanelUser
+	tokens   []AdminToken
+	filePath string
+}
+
+var (
+	panelAccessStore     *PanelAccessStore
+	panelAccessStoreOnce sync.Once
+)
+
+// GetPanelAccessStore 获取面板用户和令牌配置单例
+func GetPanelAccessStore() *PanelAccessStore {
+	panelAccessStoreOnce.Do(func() {
+		panelAccessStore = &PanelAccessStore{
+			filePath: filepath.Join(config.Get().DataDir, "panel_access.json"),
+		}
+		if err := panelAccessStore.load(); err != nil {
+			logger.Warn("Failed to load panel access config: %v", err)
+		}
+		persist.Register(persist.File{
+			Name:   "panel_access.json",
+			Path:   panelAccessStore.filePath,
+			Reload: panelAccessStore.load,
+		})
+	})
+	return panelAccessStore
+}
+
+func (s *PanelAccessStore) load() error {
+	data, err := persist.ReadFile(s.filePath, persist.ValidJSON)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var file struct {
+		Users  []PanelUser  `json:"users"`
+		Tokens []AdminToken `json:"tokens"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+
+	users := make([]PanelUser, 0, len(file.Users))
+	for _, u := range file.Users {
+		if u.User == "" || u.Password == "" || !ValidRole(u.Role) {
+			logger.Warn("Ignoring invalid panel user %q: user, password and a role (%s, %s, %s) are required", u.User, RoleViewer, RoleOperator, RoleAdmin)
+			continue
+		}
+		users = append(users, u)
+	}
+	tokens := make([]AdminToken, 0, len(file.Tokens))
+	for _, t := range file.Tokens {
+		if len(t.Token) < 16 || !ValidRole(t.Role) {
+			logger.Warn("Ignoring invalid admin token %q: token must be at least 16 characters and role must be %s, %s or %s", t.Name, RoleViewer, RoleOperator, RoleAdmin)
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+
+	s.mu.Lock()
+	s.users = users
+	s.tokens = tokens
+	s.mu.Unlock()
+	return nil
+}
+
+// ByCredentials 按用户名密码查找面板用户
+func (s *PanelAccessStore) ByCredentials(user, password string) *PanelUser {
+	if user == "" || password == "" {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := range s.users {
+		u := s.users[i]
+		if u.User == user && subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1 {
+			return &u
+		}
+	}
+	return nil
+}
+
+// ByToken 按令牌查找管理 API 令牌
+func (s *PanelAccessStore) ByToken(token string) *AdminToken {
+	if token == "" {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(s.tokens[i].Token), []byte(token)) == 1 {
+			t := s.tokens[i]
+			return &t
+		}
+	}
+	return nil
+}
+
+// PanelRoleOrDefault 租户管理员的角色（未配置时为 admin，仍只能访问本租户的数据）
+func (t *Tenant) PanelRoleOrDefault() string {
+	if ValidRole(t.PanelRole) {
+		return t.PanelRole
+	}
+	return RoleAdmin
+}
+
+// Principal 管理接口请求的身份
+type Principal struct {
+	Name string // 用户名或令牌名称（令牌为 token:名称）
+	Role string
+}
+
+// principalContextKey 管理接口请求身份的 context key
+type principalContextKey struct{}
+
+// WithPrincipal 返回携带请求身份的 context（面板认证中间件设置）
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext 获取管理接口请求的身份
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
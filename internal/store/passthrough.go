@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"anti2api-golang/internal/utils"
+)
+
+// PassthroughBucket 透传凭证请求在用量统计中的归属
+const PassthroughBucket = "passthrough"
+
+// NewPassthroughAccount 使用客户端提供的上游凭证构造临时账号（不保存、不参与轮询）。
+// 未指定项目时生成随机项目 ID
+func NewPassthroughAccount(ctx context.Context, accessToken, projectID string) *Account {
+	if projectID == "" {
+		projectID = utils.GenerateProjectID()
+	}
+	tenant, _ := TenantFromContext(ctx)
+	return &Account{
+		AccessToken: accessToken,
+		ProjectID:   projectID,
+		Enable:      true,
+		Tenant:      tenant,
+		SessionID:   utils.GenerateSessionID(),
+		Passthrough: true,
+	}
+}
+
+// PassthroughHash 透传凭证的哈希前缀（日志中只记录该值）
+func PassthroughHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:])[:12]
+}
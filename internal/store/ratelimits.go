@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimitSnapshot 上游在最近一次响应中返回的单个账号限额
+type RateLimitSnapshot struct {
+	RemainingRequests *int64            `json:"remainingRequests,omitempty"`
+	RemainingTokens   *int64            `json:"remainingTokens,omitempty"`
+	ResetRequests     *time.Time        `json:"resetRequests,omitempty"` // 请求数限额重置时间
+	ResetTokens       *time.Time        `json:"resetTokens,omitempty"`   // Token 限额重置时间
+	RetryAt           *time.Time        `json:"retryAt,omitempty"`       // 429 时上游要求的重试时间
+	Raw               map[string]string `json:"raw,omitempty"`           // 上游原始限额头
+	UpdatedAt         time.Time         `json:"updatedAt"`
+
+	usageCount int // 记录时该账号在用量统计中的请求数
+}
+
+// PoolRateLimit 按账号池汇总的限额（nil 为未知）
+type PoolRateLimit struct {
+	RemainingRequests *int64
+	RemainingTokens   *int64
+	ResetRequests     time.Duration // 整个池恢复到初始状态的时间
+	ResetTokens       time.Duration
+	RetryAfter        time.Duration // 所有账号都被限流时，最早恢复可用的时间
+}
+
+var (
+	rateLimitsMu sync.Mutex
+	rateLimits   = make(map[string]RateLimitSnapshot) // 账号 ID -> 最近一次的上游限额
+)
+
+// RecordRateLimit 记录账号最近一次的上游限额（透传凭证不记录）
+func RecordRateLimit(account *Account, snap RateLimitSnapshot) {
+	if account == nil || account.Passthrough || account.ID == "" {
+		return
+	}
+	if usage := GetLogStore().GetAccountUsage(getAccountKey(account.Email, account.ProjectID)); usage != nil {
+		snap.usageCount = usage.Count
+	}
+
+	rateLimitsMu.Lock()
+	defer rateLimitsMu.Unlock()
+	rateLimits[account.ID] = snap
+}
+
+// AccountRateLimit 获取账号最近一次的上游限额
+func AccountRateLimit(id string) (RateLimitSnapshot, bool) {
+	rateLimitsMu.Lock()
+	defer rateLimitsMu.Unlock()
+	snap, ok := rateLimits[id]
+	return snap, ok
+}
+
+// PoolRateLimitFor 汇总对请求租户可用的账号（启用且未排空）的限额
+func PoolRateLimitFor(ctx context.Context) PoolRateLimit {
+	accounts := GetAccountStore().GetAll(ctx)
+
+	var snaps []RateLimitSnapshot
+	var keys []string
+	usable := 0
+	rateLimitsMu.Lock()
+	for _, a := range accounts {
+		if !a.Enable || a.IsDraining() {
+			continue
+		}
+		usable++
+		if snap, ok := rateLimits[a.ID]; ok {
+			snaps = append(snaps, snap)
+			keys = append(keys, getAccountKey(a.Email, a.ProjectID))
+		}
+	}
+	rateLimitsMu.Unlock()
+
+	// 快照之后各账号已发出的请求（不持有限额锁时查询用量统计）
+	used := make([]int, len(snaps))
+	logStore := GetLogStore()
+	for i, key := range keys {
+		if usage := logStore.GetAccountUsage(key); usage != nil && usage.Count > snaps[i].usageCount {
+			used[i] = usage.Count - snaps[i].usageCount
+		}
+	}
+	return ScalePoolRateLimit(snaps, used, usable, time.Now())
+}
+
+// ScalePoolRateLimit 将各账号的上游限额汇总为账号池限额（accounts 为可用账号总数）：
+//   - 重置时间已过的值视为未知（窗口已刷新）
+//   - 剩余请求数扣除快照之后该账号已发出的请求（used，来自用量统计）
+//   - 没有有效值的账号按已知账号的平均剩余量估算
+//   - 重置时间取已知账号中最晚的一个
+//   - 所有账号都被限流时，RetryAfter 为最早恢复的时间
+func ScalePoolRateLimit(snaps []RateLimitSnapshot, used []int, accounts int, now time.Time) PoolRateLimit {
+	var pool PoolRateLimit
+	if accounts < len(snaps) {
+		accounts = len(snaps)
+	}
+
+	var requests, tokens []int64
+	limited := 0
+	var earliestRetry time.Duration
+	for i, snap := range snaps {
+		exhausted := false
+		if snap.RemainingRequests != nil && !resetPassed(snap.ResetRequests, now) {
+			remaining := *snap.RemainingRequests
+			if i < len(used) {
+				remaining -= int64(used[i])
+			}
+			if remaining < 0 {
+				remaining = 0
+			}
+			requests = append(requests, remaining)
+			exhausted = remaining == 0
+			pool.ResetRequests = maxDuration(pool.ResetRequests, until(snap.ResetRequests, now))
+		}
+		if snap.RemainingTokens != nil && !resetPassed(snap.ResetTokens, now) {
+			tokens = append(tokens, *snap.RemainingTokens)
+			pool.ResetTokens = maxDuration(pool.ResetTokens, until(snap.ResetTokens, now))
+		}
+
+		// 账号当前不可用的时间：429 要求的重试时间，或请求数已用完时的重置时间
+		var wait time.Duration
+		if snap.RetryAt != nil && snap.RetryAt.After(now) {
+			wait = snap.RetryAt.Sub(now)
+		} else if exhausted {
+			wait = until(snap.ResetRequests, now)
+		}
+		if wait > 0 {
+			limited++
+			if earliestRetry == 0 || wait < earliestRetry {
+				earliestRetry = wait
+			}
+		}
+	}
+
+	pool.RemainingRequests = scaleRemaining(requests, accounts)
+	pool.RemainingTokens = scaleRemaining(tokens, accounts)
+	if limited > 0 && limited == accounts {
+		pool.RetryAfter = earliestRetry
+	}
+	return pool
+}
+
+// scaleRemaining 已知账号求和，其余账号按已知账号的平均值估算
+func scaleRemaining(known []int64, accounts int) *int64 {
+	if len(known) == 0 {
+		return nil
+	}
+	var sum int64
+	for _, v := range known {
+		sum += v
+	}
+	if unknown := accounts - len(known); unknown > 0 {
+		sum += int64(unknown) * sum / int64(len(known))
+	}
+	return &sum
+}
+
+func resetPassed(reset *time.Time, now time.Time) bool {
+	return reset != nil && !reset.After(now)
+}
+
+func until(t *time.Time, now time.Time) time.Duration {
+	if t == nil || !t.After(now) {
+		return 0
+	}
+	return t.Sub(now)
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+// limitSnap 剩余 requests 个请求、resetIn 后重置的账号限额（requests 小于 0 表示未知）
+func limitSnap(requests int64, resetIn time.Duration, now time.Time) RateLimitSnapshot {
+	var snap RateLimitSnapshot
+	if requests >= 0 {
+		snap.RemainingRequests = &requests
+	}
+	if resetIn != 0 {
+		reset := now.Add(resetIn)
+		snap.ResetRequests = &reset
+	}
+	return snap
+}
+
+func int64Value(p *int64) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func TestScalePoolRateLimit(t *testing.T) {
+	now := time.Now()
+	retryIn := func(snap RateLimitSnapshot, d time.Duration) RateLimitSnapshot {
+		at := now.Add(d)
+		snap.RetryAt = &at
+		return snap
+	}
+
+	for _, tc := range []struct {
+		name       string
+		snaps      []RateLimitSnapshot
+		used       []int
+		accounts   int
+		requests   interface{}
+		reset      time.Duration
+		retryAfter time.Duration
+	}{
+		{"no snapshots", nil, nil, 3, nil, 0, 0},
+		{"single account", []RateLimitSnapshot{limitSnap(10, time.Minute, now)}, nil, 1, int64(10), time.Minute, 0},
+		// 未知账号按已知账号的平均剩余量估算
+		{"scaled to the pool", []RateLimitSnapshot{limitSnap(10, time.Minute, now)}, nil, 4, int64(40), time.Minute, 0},
+		{"average of known accounts", []RateLimitSnapshot{limitSnap(10, time.Minute, now), limitSnap(20, 2*time.Minute, now)}, nil, 3, int64(45), 2 * time.Minute, 0},
+		// 快照之后已发出的请求从剩余量中扣除
+		{"requests since the snapshot", []RateLimitSnapshot{limitSnap(10, time.Minute, now), limitSnap(10, time.Minute, now)}, []int{3, 0}, 2, int64(17), time.Minute, 0},
+		{"usage beyond the snapshot", []RateLimitSnapshot{limitSnap(2, time.Minute, now), limitSnap(10, time.Minute, now)}, []int{5}, 2, int64(10), time.Minute, 0},
+		// 重置时间已过的快照视为未知
+		{"reset passed", []RateLimitSnapshot{limitSnap(0, -time.Second, now), limitSnap(8, time.Minute, now)}, nil, 2, int64(16), time.Minute, 0},
+		{"all resets passed", []RateLimitSnapshot{limitSnap(0, -time.Second, now)}, nil, 1, nil, 0, 0},
+		{"unknown remaining", []RateLimitSnapshot{limitSnap(-1, time.Minute, now)}, nil, 1, nil, 0, 0},
+		{"more snapshots than accounts", []RateLimitSnapshot{limitSnap(5, time.Minute, now), limitSnap(5, time.Minute, now)}, nil, 1, int64(10), time.Minute, 0},
+		// 所有账号都被限流时给出最早恢复的时间
+		{"every account limited", []RateLimitSnapshot{
+			retryIn(limitSnap(-1, 0, now), 30*time.Second),
+			retryIn(limitSnap(-1, 0, now), 10*time.Second),
+		}, nil, 2, nil, 0, 10 * time.Second},
+		{"one account still available", []RateLimitSnapshot{retryIn(limitSnap(-1, 0, now), 30*time.Second)}, nil, 2, nil, 0, 0},
+		{"retry time passed", []RateLimitSnapshot{retryIn(limitSnap(-1, 0, now), -time.Second)}, nil, 1, nil, 0, 0},
+		// 请求数用完的账号在重置时恢复
+		{"exhausted until reset", []RateLimitSnapshot{
+			limitSnap(0, 40*time.Second, now),
+			limitSnap(3, 20*time.Second, now),
+		}, []int{0, 3}, 2, int64(0), 40 * time.Second, 20 * time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pool := ScalePoolRateLimit(tc.snaps, tc.used, tc.accounts, now)
+			if got := int64Value(pool.RemainingRequests); got != tc.requests {
+				t.Errorf("remaining requests = %v, want %v", got, tc.requests)
+			}
+			if pool.ResetRequests != tc.reset {
+				t.Errorf("reset = %v, want %v", pool.ResetRequests, tc.reset)
+			}
+			if pool.RetryAfter != tc.retryAfter {
+				t.Errorf("retry after = %v, want %v", pool.RetryAfter, tc.retryAfter)
+			}
+		})
+	}
+}
+
+func TestScalePoolRateLimitTokens(t *testing.T) {
+	now := time.Now()
+	tokens := int64(1000)
+	reset := now.Add(30 * time.Second)
+	snaps := []RateLimitSnapshot{
+		{RemainingTokens: &tokens, ResetTokens: &reset},
+		limitSnap(5, time.Minute, now),
+	}
+
+	// Token 限额不扣除请求数
+	pool := ScalePoolRateLimit(snaps, []int{100, 0}, 4, now)
+	if got := int64Value(pool.RemainingTokens); got != int64(4000) {
+		t.Errorf("remaining tokens = %v, want 4000", got)
+	}
+	if pool.ResetTokens != 30*time.Second {
+		t.Errorf("token reset = %v", pool.ResetTokens)
+	}
+	if got := int64Value(pool.RemainingRequests); got != int64(20) {
+		t.Errorf("remaining requests = %v, want 20", got)
+	}
+}
+
+func TestRecordRateLimitSkipsPassthrough(t *testing.T) {
+	requests := int64(7)
+	RecordRateLimit(&Account{ID: "limit-pass", Passthrough: true}, RateLimitSnapshot{RemainingRequests: &requests})
+	if _, ok := AccountRateLimit("limit-pass"); ok {
+		t.Error("passthrough credentials should not be recorded")
+	}
+
+	RecordRateLimit(&Account{ID: "limit-stored", Email: "limit-stored@example.com"}, RateLimitSnapshot{RemainingRequests: &requests})
+	if snap, ok := AccountRateLimit("limit-stored"); !ok || *snap.RemainingRequests != 7 {
+		t.Errorf("snapshot = %+v, %v", snap, ok)
+	}
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// truncate 截掉文件后半部分，模拟写入途中被杀死
+func truncate(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAccountsRecoverFromTruncatedFile(t *testing.T) {
+	s := newTestStore(t, freshAccount("gen-one"))
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(freshAccount("gen-two")); err != nil {
+		t.Fatal(err)
+	}
+	truncate(t, s.filePath)
+
+	// 重新启动：回退到上一代而不是以空账号启动
+	reloaded := &AccountStore{filePath: s.filePath}
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.accounts) != 1 || reloaded.accounts[0].Email != "gen-one@example.com" {
+		t.Fatalf("accounts = %+v, want the previous generation", reloaded.accounts)
+	}
+	if reloaded.LoadError() != nil {
+		t.Errorf("LoadError = %v after recovery", reloaded.LoadError())
+	}
+	// 恢复后可以继续写入
+	if err := reloaded.Add(freshAccount("gen-three")); err != nil {
+		t.Errorf("Add after recovery: %v", err)
+	}
+}
+
+func TestAccountsRefuseToStartEmptyWhenBackupIsCorrupted(t *testing.T) {
+	s := newTestStore(t, freshAccount("lost-one"))
+	s.Save()
+	s.Add(freshAccount("lost-two"))
+	truncate(t, s.filePath)
+	truncate(t, s.filePath+".bak")
+	corrupted, _ := os.ReadFile(s.filePath)
+
+	reloaded := &AccountStore{filePath: s.filePath}
+	err := reloaded.Load()
+	if err == nil || !strings.Contains(err.Error(), "corrupted") || reloaded.LoadError() == nil {
+		t.Fatalf("Load = %v, want a corruption error", err)
+	}
+	// 不能用空账号列表覆盖损坏的文件
+	if err := reloaded.Add(freshAccount("lost-three")); err == nil {
+		t.Error("Add should fail while the file is not loaded")
+	}
+	if data, _ := os.ReadFile(s.filePath); string(data) != string(corrupted) {
+		t.Errorf("corrupted file was overwritten:\n%s", data)
+	}
+}
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+)
+
+// 刷新退避参数
+const (
+	refreshBackoffBase = 30 * time.Second
+)
+
+// OAuthStatusError OAuth 端点返回的非 200 状态（由 auth 包返回，用于判断是否暂停刷新）
+type OAuthStatusError struct {
+	Status int
+	Body   string
+}
+
+func (e *OAuthStatusError) Error() string {
+	return fmt.Sprintf("token refresh failed: HTTP %d", e.Status)
+}
+
+// ErrRefreshThrottled 刷新被退避、限流或全局暂停跳过
+var ErrRefreshThrottled = errors.New("token refresh throttled")
+
+// RefreshStats 刷新统计
+type RefreshStats struct {
+	Attempts    int64      `json:"attempts"`
+	Successes   int64      `json:"successes"`
+	Failures    int64      `json:"failures"`
+	Skipped     int64      `json:"skipped"` // 因退避/限流/暂停跳过的次数
+	BackingOff  int        `json:"backingOff"`
+	Paused      bool       `json:"paused"`
+	PausedUntil *time.Time `json:"pausedUntil,omitempty"`
+	PauseReason string     `json:"pauseReason,omitempty"`
+	RatePerMin  int        `json:"ratePerMin"`
+}
+
+// refreshBackoff 单个账号的退避状态
+type refreshBackoff struct {
+	failures    int
+	nextAttempt time.Time
+}
+
+// refreshGate 刷新闸门：全局限流 + 单账号指数退避 + OAuth 端点异常时全局暂停
+type refreshGate struct {
+	mu          sync.Mutex
+	ratePerMin  int
+	maxBackoff  time.Duration
+	pauseFor    time.Duration
+	recent      []time.Time // 最近一分钟的刷新时间
+	backoff     map[string]*refreshBackoff
+	pausedUntil time.Time
+	pauseReason string
+	stats       RefreshStats
+}
+
+var (
+	gate     *refreshGate
+	gateOnce sync.Once
+)
+
+func getRefreshGate() *refreshGate {
+	gateOnce.Do(func() {
+		cfg := config.Get()
+		gate = &refreshGate{
+			ratePerMin: cfg.RefreshRateLimit,
+			maxBackoff: time.Duration(cfg.RefreshBackoffMax) * time.Second,
+			pauseFor:   time.Duration(cfg.RefreshPause) * time.Second,
+			backoff:    make(map[string]*refreshBackoff),
+		}
+	})
+	return gate
+}
+
+// refreshKey 退避状态的 key
+func refreshKey(account *Account) string {
+	if account.RefreshToken != "" {
+		return account.RefreshToken
+	}
+	return account.Email
+}
+
+// acquire 检查是否允许刷新，force 为 true 时忽略单账号退避（手动刷新）
+func (g *refreshGate) acquire(account *Account, force bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Before(g.pausedUntil) {
+		g.stats.Skipped++
+		return fmt.Errorf("%w: paused until %s (%s)", ErrRefreshThrottled, g.pausedUntil.Format(time.RFC3339), g.pauseReason)
+	}
+
+	if !force {
+		if b, ok := g.backoff[refreshKey(account)]; ok && now.Before(b.nextAttempt) {
+			g.stats.Skipped++
+			return fmt.Errorf("%w: backing off until %s", ErrRefreshThrottled, b.nextAttempt.Format(time.RFC3339))
+		}
+	}
+
+	if g.ratePerMin > 0 {
+		cutoff := now.Add(-time.Minute)
+		kept := g.recent[:0]
+		for _, t := range g.recent {
+			if t.After(cutoff) {
+				kept = append(kept, t)
+			}
+		}
+		g.recent = kept
+		if len(g.recent) >= g.ratePerMin {
+			g.stats.Skipped++
+			return fmt.Errorf("%w: rate limit %d/min reached", ErrRefreshThrottled, g.ratePerMin)
+		}
+		g.recent = append(g.recent, now)
+	}
+
+	g.stats.Attempts++
+	return nil
+}
+
+// record 记录刷新结果
+func (g *refreshGate) record(account *Account, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := refreshKey(account)
+	if err == nil {
+		g.stats.Successes++
+		delete(g.backoff, key)
+		return
+	}
+
+	g.stats.Failures++
+
+	// OAuth 端点被限流或故障时暂停所有刷新
+	var statusErr *OAuthStatusError
+	if errors.As(err, &statusErr) && (statusErr.Status == 429 || statusErr.Status >= 500) {
+		g.pausedUntil = time.Now().Add(g.pauseFor)
+		g.pauseReason = fmt.Sprintf("OAuth endpoint returned %d", statusErr.Status)
+		logger.Warn("Token refresh paused for %s: %s", g.pauseFor, g.pauseReason)
+		return
+	}
+
+	b, ok := g.backoff[key]
+	if !ok {
+		b = &refreshBackoff{}
+		g.backoff[key] = b
+	}
+	b.failures++
+
+	delay := refreshBackoffBase << (b.failures - 1)
+	if delay > g.maxBackoff || delay <= 0 {
+		delay = g.maxBackoff
+	}
+	b.nextAttempt = time.Now().Add(delay)
+}
+
+// Stats 返回刷新统计
+func (g *refreshGate) Stats() RefreshStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	stats := g.stats
+	stats.RatePerMin = g.ratePerMin
+
+	now := time.Now()
+	for _, b := range g.backoff {
+		if now.Before(b.nextAttempt) {
+			stats.BackingOff++
+		}
+	}
+	if now.Before(g.pausedUntil) {
+		until := g.pausedUntil
+		stats.Paused = true
+		stats.PausedUntil = &until
+		stats.PauseReason = g.pauseReason
+	}
+	return stats
+}
+
+// GetRefreshStats 获取 Token 刷新统计
+func GetRefreshStats() RefreshStats {
+	return getRefreshGate().Stats()
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// credentialFakeOAuth 请求 fakeOAuth 的凭证类型（只在测试中注册）
+const credentialFakeOAuth = "fake_oauth"
+
+// fakeOAuth 模拟 OAuth Token 端点：记录调用次数，按 status 返回
+type fakeOAuth struct {
+	server *httptest.Server
+	calls  atomic.Int32
+	status atomic.Int32
+}
+
+// startFakeOAuth 启动模拟的 OAuth 端点，注册为 credentialFakeOAuth 类型账号的刷新目标
+func startFakeOAuth(t *testing.T) *fakeOAuth {
+	t.Helper()
+	f := &fakeOAuth{}
+	f.status.Store(http.StatusOK)
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.calls.Add(1)
+		w.WriteHeader(int(f.status.Load()))
+		fmt.Fprint(w, `{"access_token":"oauth-token","expires_in":3600}`)
+	}))
+	t.Cleanup(f.server.Close)
+	RegisterCredentialProvider(credentialFakeOAuth, func(a *Account) CredentialProvider {
+		return fakeOAuthCredential{url: f.server.URL}
+	})
+	return f
+}
+
+// fakeOAuthCredential 与 auth 包相同：非 200 状态返回 OAuthStatusError
+type fakeOAuthCredential struct{ url string }
+
+func (c fakeOAuthCredential) Token(ctx context.Context) (string, time.Time, error) {
+	resp, err := http.Post(c.url, "application/x-www-form-urlencoded", strings.NewReader("grant_type=refresh_token"))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, &OAuthStatusError{Status: resp.StatusCode, Body: string(body)}
+	}
+	return "oauth-token", time.Now().Add(time.Hour), nil
+}
+
+// oauthAccount Token 已过期、通过 fakeOAuth 刷新的账号
+func oauthAccount(id string) Account {
+	a := freshAccount(id)
+	a.Type = credentialFakeOAuth
+	a.Timestamp = time.Now().Add(-2 * time.Hour).UnixMilli()
+	return a
+}
+
+// useRefreshGate 用独立的刷新闸门替换全局闸门（测试结束时恢复）
+func useRefreshGate(t *testing.T, ratePerMin int, maxBackoff, pauseFor time.Duration) *refreshGate {
+	t.Helper()
+	previous := getRefreshGate()
+	gate = &refreshGate{
+		ratePerMin: ratePerMin,
+		maxBackoff: maxBackoff,
+		pauseFor:   pauseFor,
+		backoff:    make(map[string]*refreshBackoff),
+	}
+	t.Cleanup(func() { gate = previous })
+	return gate
+}
+
+func TestRefreshBackoffSkipsRepeatedFailures(t *testing.T) {
+	g := useRefreshGate(t, 0, time.Hour, 5*time.Minute)
+	oauth := startFakeOAuth(t)
+	oauth.status.Store(http.StatusBadRequest)
+	s := newTestStore(t, oauthAccount("backoff"))
+
+	for i := 0; i < 3; i++ {
+		if _, failed := s.RefreshAll(context.Background()); failed != 1 {
+			t.Fatalf("RefreshAll %d: failed = %d, want 1", i, failed)
+		}
+	}
+	if n := oauth.calls.Load(); n != 1 {
+		t.Errorf("OAuth endpoint called %d times, want 1 (later attempts back off)", n)
+	}
+	stats := g.Stats()
+	if stats.Attempts != 1 || stats.Failures != 1 || stats.Skipped != 2 || stats.BackingOff != 1 || stats.Paused {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// 手动刷新忽略退避，再次失败后退避时间翻倍
+	if err := s.RefreshAccount(context.Background(), 0); err == nil || errors.Is(err, ErrRefreshThrottled) {
+		t.Fatalf("RefreshAccount = %v, want the OAuth error", err)
+	}
+	if n := oauth.calls.Load(); n != 2 {
+		t.Errorf("OAuth endpoint called %d times after a manual refresh, want 2", n)
+	}
+	wait := time.Until(g.backoff[refreshKey(&s.accounts[0])].nextAttempt)
+	if wait < refreshBackoffBase || wait > 2*refreshBackoffBase {
+		t.Errorf("backoff after two failures = %v, want %v", wait, 2*refreshBackoffBase)
+	}
+}
+
+func TestRefreshBackoffIsCapped(t *testing.T) {
+	g := useRefreshGate(t, 0, 45*time.Second, 5*time.Minute)
+	oauth := startFakeOAuth(t)
+	oauth.status.Store(http.StatusBadRequest)
+	s := newTestStore(t, oauthAccount("capped"))
+
+	for i := 0; i < 5; i++ {
+		s.RefreshAccount(context.Background(), 0)
+	}
+	wait := time.Until(g.backoff[refreshKey(&s.accounts[0])].nextAttempt)
+	if wait > 45*time.Second || wait < 40*time.Second {
+		t.Errorf("backoff after five failures = %v, want the 45s cap", wait)
+	}
+}
+
+func TestRefreshSuccessClearsBackoff(t *testing.T) {
+	g := useRefreshGate(t, 0, time.Hour, 5*time.Minute)
+	oauth := startFakeOAuth(t)
+	oauth.status.Store(http.StatusBadRequest)
+	s := newTestStore(t, oauthAccount("recovers"))
+	s.RefreshAll(context.Background())
+
+	oauth.status.Store(http.StatusOK)
+	if err := s.RefreshAccount(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if s.accounts[0].AccessToken != "oauth-token" {
+		t.Errorf("access token = %q, want the refreshed token", s.accounts[0].AccessToken)
+	}
+	if stats := g.Stats(); stats.BackingOff != 0 || stats.Successes != 1 {
+		t.Errorf("stats = %+v, want the backoff cleared", stats)
+	}
+	// 不再退避，定时刷新可以直接请求
+	if success, _ := s.RefreshAll(context.Background()); success != 1 || oauth.calls.Load() != 3 {
+		t.Errorf("RefreshAll after recovery: success=%d calls=%d", success, oauth.calls.Load())
+	}
+}
+
+func TestRefreshGlobalRateLimit(t *testing.T) {
+	g := useRefreshGate(t, 2, time.Hour, 5*time.Minute)
+	oauth := startFakeOAuth(t)
+	s := newTestStore(t, oauthAccount("rate-a"), oauthAccount("rate-b"), oauthAccount("rate-c"), oauthAccount("rate-d"))
+
+	success, failed := s.RefreshAll(context.Background())
+	if success != 2 || failed != 2 {
+		t.Errorf("RefreshAll = %d/%d, want 2 refreshed and 2 throttled", success, failed)
+	}
+	if n := oauth.calls.Load(); n != 2 {
+		t.Errorf("OAuth endpoint called %d times, want the 2/min limit", n)
+	}
+	// 手动刷新同样受全局限流约束
+	if err := s.RefreshAccount(context.Background(), 3); !errors.Is(err, ErrRefreshThrottled) {
+		t.Errorf("RefreshAccount = %v, want ErrRefreshThrottled", err)
+	}
+	if stats := g.Stats(); stats.Attempts != 2 || stats.Skipped != 3 || stats.RatePerMin != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestRefreshPausedWhenOAuthEndpointFails(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			g := useRefreshGate(t, 0, time.Hour, 5*time.Minute)
+			oauth := startFakeOAuth(t)
+			oauth.status.Store(int32(status))
+			s := newTestStore(t, oauthAccount("paused-a"), oauthAccount("paused-b"), oauthAccount("paused-c"))
+
+			// 第一个账号收到错误后暂停，其余账号不再请求端点
+			if _, failed := s.RefreshAll(context.Background()); failed != 3 {
+				t.Errorf("failed = %d, want 3", failed)
+			}
+			if n := oauth.calls.Load(); n != 1 {
+				t.Errorf("OAuth endpoint called %d times, want 1 before pausing", n)
+			}
+
+			// 暂停期间的手动刷新和请求时的刷新都被跳过
+			oauth.status.Store(http.StatusOK)
+			if err := s.RefreshAccount(context.Background(), 1); !errors.Is(err, ErrRefreshThrottled) {
+				t.Errorf("RefreshAccount = %v, want ErrRefreshThrottled", err)
+			}
+			if _, err := s.GetToken(context.Background()); err == nil {
+				t.Error("GetToken should fail while every account needs a paused refresh")
+			}
+			if n := oauth.calls.Load(); n != 1 {
+				t.Errorf("OAuth endpoint called %d times while paused", n)
+			}
+
+			stats := g.Stats()
+			if !stats.Paused || stats.PausedUntil == nil || !strings.Contains(stats.PauseReason, fmt.Sprint(status)) {
+				t.Errorf("stats = %+v, want paused because of %d", stats, status)
+			}
+			// 暂停不计入单账号退避，账号也不被禁用
+			if stats.BackingOff != 0 {
+				t.Errorf("%d accounts backing off, want 0", stats.BackingOff)
+			}
+			for _, a := range s.accounts {
+				if !a.Enable {
+					t.Errorf("%s disabled by a paused refresh", a.ID)
+				}
+			}
+		})
+	}
+}
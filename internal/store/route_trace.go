@@ -0,0 +1,230 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+)
+
+// 候选账号被排除的原因
+const (
+	RouteExcludedDisabled = "disabled"       // 账号已停用
+	RouteExcludedEndpoint = "endpoint"       // 账号固定的端点与请求指定的端点不同
+	RouteExcludedSchedule = "off_schedule"   // 不在可用时间段内（until 为下次可用时间）
+	RouteExcludedCooldown = "cooldown"       // 上游拒绝后暂停选用（until 为恢复时间）
+	RouteExcludedQuota    = "over_quota"     // 上游返回 429 后暂停选用（until 为恢复时间）
+	RouteExcludedDraining = "draining"       // 排空中，不接收新会话
+	RouteExcludedRefresh  = "refresh_failed" // Token 已过期且刷新失败
+)
+
+// 会话保持的决定
+const (
+	RouteAffinityNone     = "none"     // 请求没有会话标识
+	RouteAffinityUnbound  = "unbound"  // 会话尚未绑定账号
+	RouteAffinityPinned   = "pinned"   // 沿用会话绑定的账号
+	RouteAffinityReleased = "released" // 绑定的账号不保持会话或已不可用，重新选择
+)
+
+// 端点的选择方式
+const (
+	RouteEndpointOverride = "override" // 请求头指定
+	RouteEndpointAccount  = "account"  // 账号固定的端点
+	RouteEndpointMode     = "mode"     // 全局端点模式
+)
+
+// RouteCandidate 一个候选账号（Excluded 为空表示被选中）
+type RouteCandidate struct {
+	Index    int        `json:"index"`
+	ID       string     `json:"id"`
+	Excluded string     `json:"excluded,omitempty"`
+	Until    *time.Time `json:"until,omitempty"`
+}
+
+// RouteSelection 一次账号选择。候选按尝试顺序列出，选中的账号之后的账号未被检查，不列出
+type RouteSelection struct {
+	Failover   *RouteFailover   `json:"failover,omitempty"` // 由上游拒绝账号触发的重新选择
+	Endpoint   string           `json:"endpoint,omitempty"` // 请求指定的端点（只选择兼容的账号）
+	Affinity   string           `json:"affinity"`
+	Candidates []RouteCandidate `json:"candidates"`
+	Selected   string           `json:"selected,omitempty"` // 选中的账号 ID
+	Error      string           `json:"error,omitempty"`
+}
+
+// RouteFailover 切换账号的原因
+type RouteFailover struct {
+	From  string `json:"from"` // 被上游拒绝的账号 ID
+	Error string `json:"error"`
+}
+
+// RouteRetry 同一账号的一次上游重试（Status 为触发重试的上游状态码）
+type RouteRetry struct {
+	Attempt int   `json:"attempt"`
+	Status  int   `json:"status"`
+	DelayMs int64 `json:"delayMs"`
+}
+
+// RouteUpstream 一次上游调用的端点选择（Circuit 为全局端点模式下的自动切换状态）
+type RouteUpstream struct {
+	Account  string                     `json:"account,omitempty"`
+	Endpoint string                     `json:"endpoint"`
+	Source   string                     `json:"source"`
+	Mode     string                     `json:"mode,omitempty"`
+	Circuit  *config.AutoFailoverStatus `json:"circuit,omitempty"`
+}
+
+// RouteExplanation 请求的路由说明（写入日志，X-Debug-Route: explain 时附加到响应）
+type RouteExplanation struct {
+	Strategy   string           `json:"strategy,omitempty"` // 账号选择策略（没有从账号池选择时为空）
+	Selections []RouteSelection `json:"selections"`
+	Retries    []RouteRetry     `json:"retries,omitempty"`
+	Upstream   []RouteUpstream  `json:"upstream,omitempty"`
+}
+
+// RouteTrace 单个请求的路由决策记录（nil 时所有方法为空操作）
+type RouteTrace struct {
+	mu       sync.Mutex
+	explain  RouteExplanation
+	failover *RouteFailover // 下一次选择的触发原因
+}
+
+type routeTraceContextKey struct{}
+
+// WithRouteTrace 返回记录路由决策的 context（已有记录时沿用）
+func WithRouteTrace(ctx context.Context) context.Context {
+	if RouteTraceFromContext(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, routeTraceContextKey{}, &RouteTrace{})
+}
+
+// RouteTraceFromContext 获取请求的路由决策记录（未开启时为 nil）
+func RouteTraceFromContext(ctx context.Context) *RouteTrace {
+	t, _ := ctx.Value(routeTraceContextKey{}).(*RouteTrace)
+	return t
+}
+
+// Explain 路由说明的快照，没有任何记录时返回 nil
+func (t *RouteTrace) Explain() *RouteExplanation {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.explain.Selections) == 0 && len(t.explain.Upstream) == 0 {
+		return nil
+	}
+	e := t.explain
+	e.Selections = append([]RouteSelection(nil), e.Selections...)
+	for i := range e.Selections {
+		e.Selections[i].Candidates = append([]RouteCandidate(nil), e.Selections[i].Candidates...)
+	}
+	e.Retries = append([]RouteRetry(nil), e.Retries...)
+	e.Upstream = append([]RouteUpstream(nil), e.Upstream...)
+	return &e
+}
+
+// Failover 记录上游拒绝账号的原因，下一次账号选择标记为切换
+func (t *RouteTrace) Failover(from string, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.failover = &RouteFailover{From: from, Error: err.Error()}
+	t.mu.Unlock()
+}
+
+// Retry 记录一次上游重试
+func (t *RouteTrace) Retry(attempt, status int, delay time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.explain.Retries = append(t.explain.Retries, RouteRetry{Attempt: attempt, Status: status, DelayMs: delay.Milliseconds()})
+	t.mu.Unlock()
+}
+
+// Upstream 记录一次上游调用的端点选择
+func (t *RouteTrace) Upstream(u RouteUpstream) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.explain.Upstream = append(t.explain.Upstream, u)
+	t.mu.Unlock()
+}
+
+// routeSelection 正在进行的账号选择（nil 时为空操作，由 getToken 在持有账号存储锁时使用）
+type routeSelection struct {
+	trace *RouteTrace
+	sel   RouteSelection
+}
+
+// begin 开始记录一次账号选择
+func (t *RouteTrace) begin(endpoint string) *routeSelection {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	failover := t.failover
+	t.failover = nil
+	t.mu.Unlock()
+	return &routeSelection{trace: t, sel: RouteSelection{Failover: failover, Endpoint: endpoint, Affinity: RouteAffinityNone}}
+}
+
+func (r *routeSelection) affinity(decision string) {
+	if r != nil {
+		r.sel.Affinity = decision
+	}
+}
+
+func (r *routeSelection) exclude(index int, account *Account, reason string, until time.Time) {
+	if r == nil {
+		return
+	}
+	c := RouteCandidate{Index: index, ID: account.ID, Excluded: reason}
+	if !until.IsZero() {
+		c.Until = &until
+	}
+	r.sel.Candidates = append(r.sel.Candidates, c)
+}
+
+// finish 记录选择结果（account 为 nil 表示没有可用的账号）
+func (r *routeSelection) finish(index int, account *Account, err error) {
+	if r == nil {
+		return
+	}
+	if account != nil {
+		r.sel.Candidates = append(r.sel.Candidates, RouteCandidate{Index: index, ID: account.ID})
+		r.sel.Selected = account.ID
+	}
+	if err != nil {
+		r.sel.Error = err.Error()
+	}
+
+	t := r.trace
+	t.mu.Lock()
+	if t.explain.Strategy == "" {
+		t.explain.Strategy = selectionStrategy()
+	}
+	t.explain.Selections = append(t.explain.Selections, r.sel)
+	t.mu.Unlock()
+}
+
+// selectionStrategy 当前的账号选择策略
+func selectionStrategy() string {
+	if config.Get().SelectionStrategy == StrategyHealthiest {
+		return StrategyHealthiest
+	}
+	return StrategyRoundRobin
+}
+
+// cooldownExclusion 暂停选用的排除原因（429 视为超出配额）
+func cooldownExclusion(account *Account) string {
+	if account.CooldownReason == CooldownRateLimited {
+		return RouteExcludedQuota
+	}
+	return RouteExcludedCooldown
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// routeCandidates 候选账号的 ID 和排除原因
+func routeCandidates(sel RouteSelection) [][2]string {
+	got := make([][2]string, len(sel.Candidates))
+	for i, c := range sel.Candidates {
+		got[i] = [2]string{c.ID, c.Excluded}
+	}
+	return got
+}
+
+func TestRouteTraceExclusions(t *testing.T) {
+	off := freshAccount("rt-off")
+	off.Enable = false
+	drain := freshAccount("rt-drain")
+	since := time.Now()
+	drain.DrainingSince = &since
+	s := newTestStore(t,
+		off,
+		pinnedAccount("rt-prod", "production"),
+		freshAccount("rt-cool"),
+		freshAccount("rt-quota"),
+		drain,
+		freshAccount("rt-ok"),
+	)
+	s.MarkUnavailable("rt-cool", time.Minute, "failover")
+	s.MarkRateLimited("rt-quota", 2*time.Minute)
+
+	ctx := WithRouteTrace(context.Background())
+	account, err := s.GetTokenForEndpoint(ctx, "daily")
+	if err != nil || account.ID != "rt-ok" {
+		t.Fatalf("picked %v, err %v, want rt-ok", account, err)
+	}
+
+	explain := RouteTraceFromContext(ctx).Explain()
+	if explain == nil || len(explain.Selections) != 1 {
+		t.Fatalf("explain = %+v, want one selection", explain)
+	}
+	if explain.Strategy != StrategyRoundRobin {
+		t.Errorf("strategy = %q, want %q", explain.Strategy, StrategyRoundRobin)
+	}
+	sel := explain.Selections[0]
+	if sel.Endpoint != "daily" || sel.Affinity != RouteAffinityNone || sel.Selected != "rt-ok" || sel.Error != "" {
+		t.Errorf("selection = %+v", sel)
+	}
+	want := [][2]string{
+		{"rt-off", RouteExcludedDisabled},
+		{"rt-prod", RouteExcludedEndpoint},
+		{"rt-cool", RouteExcludedCooldown},
+		{"rt-quota", RouteExcludedQuota},
+		{"rt-drain", RouteExcludedDraining},
+		{"rt-ok", ""},
+	}
+	if got := routeCandidates(sel); !reflect.DeepEqual(got, want) {
+		t.Fatalf("candidates = %v, want %v", got, want)
+	}
+
+	// 暂停选用的账号带恢复时间，其余账号没有
+	for i, c := range sel.Candidates {
+		if c.Index != i {
+			t.Errorf("%s index = %d, want %d", c.ID, c.Index, i)
+		}
+		switch c.ID {
+		case "rt-cool", "rt-quota":
+			if c.Until == nil || !c.Until.Equal(s.accounts[i].CooldownUntil) {
+				t.Errorf("%s until = %v, want %v", c.ID, c.Until, s.accounts[i].CooldownUntil)
+			}
+		default:
+			if c.Until != nil {
+				t.Errorf("%s until = %v, want none", c.ID, c.Until)
+			}
+		}
+	}
+}
+
+func TestRouteTraceNoAccountAvailable(t *testing.T) {
+	s := newTestStore(t, freshAccount("rt-a"), freshAccount("rt-b"))
+	s.MarkRateLimited("rt-a", time.Minute)
+	s.MarkUnavailable("rt-b", time.Minute, "failover")
+
+	ctx := WithRouteTrace(context.Background())
+	if account, err := s.GetToken(ctx); err == nil {
+		t.Fatalf("picked %s with every account cooling down", account.ID)
+	}
+	sel := RouteTraceFromContext(ctx).Explain().Selections[0]
+	want := [][2]string{{"rt-a", RouteExcludedQuota}, {"rt-b", RouteExcludedCooldown}}
+	if got := routeCandidates(sel); !reflect.DeepEqual(got, want) || sel.Selected != "" || sel.Error == "" {
+		t.Errorf("selection = %+v, want candidates %v and an error", sel, want)
+	}
+}
+
+func TestRouteTraceFailover(t *testing.T) {
+	s := newTestStore(t, freshAccount("rt-first"), freshAccount("rt-second"))
+	ctx := WithRouteTrace(context.Background())
+	trace := RouteTraceFromContext(ctx)
+
+	first, err := s.GetToken(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MarkUnavailable(first.ID, time.Minute, "failover")
+	trace.Failover(first.ID, errors.New("upstream 503"))
+	trace.Retry(1, 503, 250*time.Millisecond)
+	if _, err := s.GetToken(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只有切换后的那次选择记录切换原因
+	explain := trace.Explain()
+	if len(explain.Selections) != 2 || explain.Selections[0].Failover != nil {
+		t.Fatalf("selections = %+v", explain.Selections)
+	}
+	if f := explain.Selections[1].Failover; f == nil || f.From != first.ID || f.Error != "upstream 503" {
+		t.Errorf("failover = %+v, want from %s", f, first.ID)
+	}
+	if !reflect.DeepEqual(explain.Retries, []RouteRetry{{Attempt: 1, Status: 503, DelayMs: 250}}) {
+		t.Errorf("retries = %+v", explain.Retries)
+	}
+
+	// 快照与后续记录互不影响
+	explain.Selections[0].Candidates[0].ID = "changed"
+	if trace.Explain().Selections[0].Candidates[0].ID == "changed" {
+		t.Error("Explain returned the trace's own candidates")
+	}
+}
+
+func TestRouteTraceDisabled(t *testing.T) {
+	// 没有开启记录时选择照常进行，所有方法为空操作
+	s := newTestStore(t, freshAccount("rt-plain"))
+	ctx := context.Background()
+	if _, err := s.GetToken(ctx); err != nil {
+		t.Fatal(err)
+	}
+	trace := RouteTraceFromContext(ctx)
+	trace.Failover("rt-plain", errors.New("x"))
+	trace.Retry(1, 500, time.Second)
+	trace.Upstream(RouteUpstream{Endpoint: "daily"})
+	if trace != nil || trace.Explain() != nil {
+		t.Errorf("trace = %+v without WithRouteTrace", trace)
+	}
+
+	// 已有记录时沿用，没有任何记录时 Explain 为 nil
+	traced := WithRouteTrace(ctx)
+	if RouteTraceFromContext(WithRouteTrace(traced)) != RouteTraceFromContext(traced) {
+		t.Error("WithRouteTrace replaced an existing trace")
+	}
+	if e := RouteTraceFromContext(traced).Explain(); e != nil {
+		t.Errorf("Explain = %+v before any selection", e)
+	}
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxScheduleWindows 单个账号最多的可用时间段数
+const MaxScheduleWindows = 20
+
+// AccountSchedule 账号可用时间段：当前时间落在任一时间段内时账号可用，否则像禁用账号一样被跳过
+type AccountSchedule struct {
+	Timezone string   `json:"timezone,omitempty"` // IANA 时区（如 Asia/Shanghai），为空使用服务器本地时区
+	Windows  []string `json:"windows"`            // 如 "mon-fri 09:00-18:00"、"sat,sun 22:00-06:00"（结束早于开始表示跨零点）、"08:00-12:00"（每天）
+}
+
+// scheduleWindow 解析后的时间段（分钟数按当地墙上时间计算，夏令时切换当天按实际钟面时间判断）
+type scheduleWindow struct {
+	days  [7]bool // 按 time.Weekday 索引，时间段开始的日期
+	start int     // 开始（当天第几分钟）
+	end   int     // 结束（不含），不大于 start 时延续到次日
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Validate 校验时区和时间段格式
+func (s *AccountSchedule) Validate() error {
+	if _, _, err := s.parse(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parse 解析时区和时间段
+func (s *AccountSchedule) parse() (*time.Location, []scheduleWindow, error) {
+	loc, err := scheduleLocation(s.Timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(s.Windows) == 0 {
+		return nil, nil, errors.New("schedule must have at least one window")
+	}
+	if len(s.Windows) > MaxScheduleWindows {
+		return nil, nil, fmt.Errorf("schedule has more than %d windows", MaxScheduleWindows)
+	}
+	windows := make([]scheduleWindow, 0, len(s.Windows))
+	for _, raw := range s.Windows {
+		w, err := parseScheduleWindow(raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid schedule window %q: %v", raw, err)
+		}
+		windows = append(windows, w)
+	}
+	return loc, windows, nil
+}
+
+// scheduleLocations 已加载的时区（LoadLocation 每次都会读取时区文件）
+var scheduleLocations sync.Map
+
+func scheduleLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	if loc, ok := scheduleLocations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule timezone %q", name)
+	}
+	scheduleLocations.Store(name, loc)
+	return loc, nil
+}
+
+// parseScheduleWindow 解析 "[days] HH:MM-HH:MM"，days 为逗号分隔的星期或范围（mon-fri），省略或 * 表示每天
+func parseScheduleWindow(raw string) (scheduleWindow, error) {
+	var w scheduleWindow
+	fields := strings.Fields(strings.ToLower(raw))
+	var daysPart, timePart string
+	switch len(fields) {
+	case 1:
+		daysPart, timePart = "*", fields[0]
+	case 2:
+		daysPart, timePart = fields[0], fields[1]
+	default:
+		return w, errors.New(`expected "[days] HH:MM-HH:MM"`)
+	}
+
+	if daysPart == "*" {
+		for d := range w.days {
+			w.days[d] = true
+		}
+	} else {
+		for _, item := range strings.Split(daysPart, ",") {
+			from, to, isRange := strings.Cut(item, "-")
+			first, ok := weekdayNames[from]
+			if !ok {
+				return w, fmt.Errorf("unknown day %q", from)
+			}
+			last := first
+			if isRange {
+				if last, ok = weekdayNames[to]; !ok {
+					return w, fmt.Errorf("unknown day %q", to)
+				}
+			}
+			// 范围可以跨周末（如 fri-mon）
+			for d := first; ; d = (d + 1) % 7 {
+				w.days[d] = true
+				if d == last {
+					break
+				}
+			}
+		}
+	}
+
+	startRaw, endRaw, ok := strings.Cut(timePart, "-")
+	if !ok {
+		return w, errors.New("expected a time range HH:MM-HH:MM")
+	}
+	var err error
+	if w.start, err = parseClock(startRaw, false); err != nil {
+		return w, err
+	}
+	if w.end, err = parseClock(endRaw, true); err != nil {
+		return w, err
+	}
+	if w.start == w.end {
+		return w, errors.New("window start and end are equal (use 00:00-24:00 for a whole day)")
+	}
+	return w, nil
+}
+
+// parseClock 解析 HH:MM，返回当天第几分钟（allowEnd 时允许 24:00）
+func parseClock(s string, allowEnd bool) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	if !ok || len(h) == 0 || len(h) > 2 || len(m) != 2 {
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", s)
+	}
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if err1 != nil || err2 != nil || minute < 0 || minute > 59 || hour < 0 || hour > 24 || (hour == 24 && (minute != 0 || !allowEnd)) {
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// contains 当地星期和分钟数是否落在时间段内（跨零点的时间段按开始日期匹配星期）
+func (w scheduleWindow) contains(day time.Weekday, minute int) bool {
+	if w.end > w.start {
+		return w.days[day] && minute >= w.start && minute < w.end
+	}
+	return (w.days[day] && minute >= w.start) || (w.days[(day+6)%7] && minute < w.end)
+}
+
+// ActiveAt 指定时间是否在可用时间段内（格式无效时视为始终可用，保存前已校验）
+func (s *AccountSchedule) ActiveAt(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	loc, windows, err := s.parse()
+	if err != nil {
+		return true
+	}
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	for _, w := range windows {
+		if w.contains(local.Weekday(), minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextActive 从 t 开始最早的可用时间（t 已在时间段内时返回 t，没有可用时间段时返回零值）
+func (s *AccountSchedule) NextActive(t time.Time) time.Time {
+	if s.ActiveAt(t) {
+		return t
+	}
+	loc, windows, err := s.parse()
+	if err != nil {
+		return time.Time{}
+	}
+	local := t.In(loc)
+	var next time.Time
+	// 最多向后找 8 天，覆盖每周一次的时间段
+	for offset := 0; offset <= 8; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, loc)
+		for _, w := range windows {
+			if !w.days[day.Weekday()] {
+				continue
+			}
+			start := time.Date(day.Year(), day.Month(), day.Day(), w.start/60, w.start%60, 0, 0, loc)
+			// 夏令时跳过的钟面时间会被 time.Date 按切换前的偏移规范到更早的时间，顺延到切换之后；
+			// 整段被跳过的时间段当天不可用
+			if minute := start.Hour()*60 + start.Minute(); minute != w.start {
+				start = start.Add(time.Duration(w.start-minute) * time.Minute)
+				if !w.contains(start.Weekday(), start.Hour()*60+start.Minute()) {
+					continue
+				}
+			}
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+		if !next.IsZero() {
+			break
+		}
+	}
+	return next
+}
+
+// InSchedule 账号当前是否在可用时间段内（未设置时间段时始终可用）
+func (a *Account) InSchedule(now time.Time) bool {
+	return a.Schedule.ActiveAt(now)
+}
+
+// ScheduleError 所有候选账号都不在可用时间段内
+type ScheduleError struct {
+	Next time.Time // 最早有账号可用的时间（零值表示未知）
+}
+
+func (e *ScheduleError) Error() string {
+	if e.Next.IsZero() {
+		return "没有可用的 token：所有账号都不在可用时间段内"
+	}
+	return fmt.Sprintf("没有可用的 token：所有账号都不在可用时间段内，最早 %s 可用", e.Next.Format(time.RFC3339))
+}
+
+// RetryAfter 距离最早可用时间的秒数（至少 1 秒）
+func (e *ScheduleError) RetryAfter(now time.Time) int {
+	if e.Next.IsZero() {
+		return 0
+	}
+	return max(int(e.Next.Sub(now).Seconds())+1, 1)
+}
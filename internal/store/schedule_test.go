@@ -0,0 +1,308 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %s unavailable: %v", name, err)
+	}
+	return loc
+}
+
+func TestScheduleValidate(t *testing.T) {
+	tooMany := make([]string, MaxScheduleWindows+1)
+	for i := range tooMany {
+		tooMany[i] = "10:00-11:00"
+	}
+	tests := []struct {
+		name     string
+		schedule AccountSchedule
+		err      string
+	}{
+		{"weekdays", AccountSchedule{Windows: []string{"mon-fri 09:00-18:00"}}, ""},
+		{"overnight", AccountSchedule{Timezone: "Asia/Shanghai", Windows: []string{"sat,sun 22:00-06:00"}}, ""},
+		{"every day", AccountSchedule{Windows: []string{"08:00-12:00", "* 00:00-24:00"}}, ""},
+		{"range across weekend", AccountSchedule{Windows: []string{"FRI-MON 9:30-10:00"}}, ""},
+		{"no windows", AccountSchedule{}, "schedule must have at least one window"},
+		{"too many windows", AccountSchedule{Windows: tooMany}, fmt.Sprintf("schedule has more than %d windows", MaxScheduleWindows)},
+		{"unknown timezone", AccountSchedule{Timezone: "Mars/Olympus", Windows: []string{"10:00-11:00"}}, `invalid schedule timezone "Mars/Olympus"`},
+		{"unknown day", AccountSchedule{Windows: []string{"funday 10:00-11:00"}}, `unknown day "funday"`},
+		{"unknown range end", AccountSchedule{Windows: []string{"mon-fry 10:00-11:00"}}, `unknown day "fry"`},
+		{"extra field", AccountSchedule{Windows: []string{"mon tue 10:00-11:00"}}, `expected "[days] HH:MM-HH:MM"`},
+		{"no range", AccountSchedule{Windows: []string{"mon 10:00"}}, "expected a time range HH:MM-HH:MM"},
+		{"bad clock", AccountSchedule{Windows: []string{"9-10"}}, `invalid time "9"`},
+		{"bad minute", AccountSchedule{Windows: []string{"10:60-11:00"}}, `invalid time "10:60"`},
+		{"hour out of range", AccountSchedule{Windows: []string{"10:00-25:00"}}, `invalid time "25:00"`},
+		{"24:00 start", AccountSchedule{Windows: []string{"24:00-01:00"}}, `invalid time "24:00"`},
+		{"empty window", AccountSchedule{Windows: []string{"10:00-10:00"}}, "window start and end are equal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schedule.Validate()
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("Validate() = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestScheduleActiveAt(t *testing.T) {
+	shanghai := mustLocation(t, "Asia/Shanghai")
+	// 2026-10-12 为周一
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, shanghai) }
+
+	weekdays := &AccountSchedule{Timezone: "Asia/Shanghai", Windows: []string{"mon-fri 09:00-18:00"}}
+	overnight := &AccountSchedule{Timezone: "Asia/Shanghai", Windows: []string{"fri 22:00-06:00"}}
+	wrapped := &AccountSchedule{Timezone: "Asia/Shanghai", Windows: []string{"sat-mon 10:00-11:00"}}
+	tests := []struct {
+		name     string
+		schedule *AccountSchedule
+		at       time.Time
+		want     bool
+	}{
+		{"no schedule", nil, at(12, 3, 0), true},
+		{"weekday start", weekdays, at(12, 9, 0), true},
+		{"weekday before start", weekdays, at(12, 8, 59), false},
+		{"weekday end exclusive", weekdays, at(16, 18, 0), false},
+		{"saturday", weekdays, at(17, 12, 0), false},
+		// 跨零点的时间段按开始日期匹配星期
+		{"friday night", overnight, at(16, 23, 0), true},
+		{"saturday morning", overnight, at(17, 5, 59), true},
+		{"saturday end", overnight, at(17, 6, 0), false},
+		{"friday morning", overnight, at(16, 5, 0), false},
+		{"thursday night", overnight, at(15, 23, 0), false},
+		{"range wraps sunday", wrapped, at(18, 10, 30), true},
+		{"range wraps monday", wrapped, at(19, 10, 30), true},
+		{"outside wrapped range", wrapped, at(20, 10, 30), false},
+		// 按时间段的时区判断：上海 09:00 为 UTC 01:00
+		{"utc instant", weekdays, time.Date(2026, 10, 12, 1, 0, 0, 0, time.UTC), true},
+		{"utc instant before", weekdays, time.Date(2026, 10, 12, 0, 59, 0, 0, time.UTC), false},
+		// 格式无效时视为始终可用
+		{"invalid", &AccountSchedule{Windows: []string{"bogus"}}, at(17, 12, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.ActiveAt(tt.at); got != tt.want {
+				t.Fatalf("ActiveAt(%s) = %v", tt.at, got)
+			}
+		})
+	}
+}
+
+func TestScheduleNextActive(t *testing.T) {
+	shanghai := mustLocation(t, "Asia/Shanghai")
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, shanghai) }
+
+	weekdays := &AccountSchedule{Timezone: "Asia/Shanghai", Windows: []string{"mon-fri 09:00-18:00", "sat 13:00-14:00"}}
+	tests := []struct {
+		name     string
+		schedule *AccountSchedule
+		from     time.Time
+		want     time.Time
+	}{
+		{"already active", weekdays, at(14, 10, 0), at(14, 10, 0)},
+		{"later today", weekdays, at(14, 7, 30), at(14, 9, 0)},
+		{"tomorrow", weekdays, at(14, 18, 0), at(15, 9, 0)},
+		{"saturday window", weekdays, at(16, 18, 0), at(17, 13, 0)},
+		{"after saturday window", weekdays, at(17, 14, 0), at(19, 9, 0)},
+		// 每周一次的时间段：刚结束时下一次在 7 天后
+		{"weekly", &AccountSchedule{Timezone: "Asia/Shanghai", Windows: []string{"wed 10:00-11:00"}}, at(14, 11, 0), at(21, 10, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.NextActive(tt.from); !got.Equal(tt.want) {
+				t.Fatalf("NextActive = %s, want %s", got, tt.want)
+			}
+			if !tt.schedule.ActiveAt(tt.want) {
+				t.Fatal("next active time is not active")
+			}
+		})
+	}
+
+	if got := (&AccountSchedule{Windows: []string{"bogus"}}).NextActive(at(14, 10, 0)); !got.Equal(at(14, 10, 0)) {
+		t.Fatalf("invalid schedule NextActive = %s", got)
+	}
+}
+
+func TestScheduleDaylightSaving(t *testing.T) {
+	mustLocation(t, "America/New_York")
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	// 2026-03-08 02:00 EST 跳到 03:00 EDT：按钟面时间判断，UTC 时间随偏移变化
+	business := &AccountSchedule{Timezone: "America/New_York", Windows: []string{"mon-fri 09:00-17:00"}}
+	if !business.ActiveAt(utc(3, 6, 14, 0)) || business.ActiveAt(utc(3, 6, 13, 30)) {
+		t.Error("EST business hours should start at 14:00 UTC")
+	}
+	if !business.ActiveAt(utc(3, 9, 13, 0)) || business.ActiveAt(utc(3, 9, 12, 30)) {
+		t.Error("EDT business hours should start at 13:00 UTC")
+	}
+	// 周五收工后下一次是周一 09:00 EDT（而不是按 EST 偏移的 14:00 UTC）
+	if got := business.NextActive(utc(3, 6, 23, 0)); !got.Equal(utc(3, 9, 13, 0)) {
+		t.Errorf("next after DST start = %s", got.UTC())
+	}
+
+	// 被跳过的钟面时间：02:00-03:00 当天不存在，下一次是次日
+	skipped := &AccountSchedule{Timezone: "America/New_York", Windows: []string{"02:00-03:00"}}
+	if skipped.ActiveAt(utc(3, 8, 7, 0)) || skipped.ActiveAt(utc(3, 8, 7, 30)) {
+		t.Error("skipped wall clock hour should not be active")
+	}
+	if got := skipped.NextActive(utc(3, 8, 5, 0)); !got.Equal(utc(3, 9, 6, 0)) || !skipped.ActiveAt(got) {
+		t.Errorf("next after skipped hour = %s", got.UTC())
+	}
+	// 部分被跳过的时间段从切换后开始
+	partial := &AccountSchedule{Timezone: "America/New_York", Windows: []string{"02:00-04:00"}}
+	if got := partial.NextActive(utc(3, 8, 5, 0)); !got.Equal(utc(3, 8, 7, 0)) || !partial.ActiveAt(got) {
+		t.Errorf("next for partially skipped window = %s", got.UTC())
+	}
+
+	// 2026-11-01 02:00 EDT 回拨到 01:00 EST：重复的钟面时间两次都可用
+	repeated := &AccountSchedule{Timezone: "America/New_York", Windows: []string{"01:00-02:00"}}
+	if !repeated.ActiveAt(utc(11, 1, 5, 30)) || !repeated.ActiveAt(utc(11, 1, 6, 30)) || repeated.ActiveAt(utc(11, 1, 7, 0)) {
+		t.Error("repeated wall clock hour should be active twice")
+	}
+	if got := repeated.NextActive(utc(11, 1, 4, 30)); !got.Equal(utc(11, 1, 5, 0)) {
+		t.Errorf("next before DST end = %s", got.UTC())
+	}
+	// 回拨后第二天按 EST 偏移
+	if got := repeated.NextActive(utc(11, 1, 7, 0)); !got.Equal(utc(11, 2, 6, 0)) {
+		t.Errorf("next after DST end = %s", got.UTC())
+	}
+}
+
+func TestScheduleErrorRetryAfter(t *testing.T) {
+	now := time.Now()
+	if (&ScheduleError{}).RetryAfter(now) != 0 {
+		t.Error("unknown next time should have no Retry-After")
+	}
+	if got := (&ScheduleError{Next: now.Add(90 * time.Second)}).RetryAfter(now); got != 91 {
+		t.Errorf("RetryAfter = %d", got)
+	}
+	if got := (&ScheduleError{Next: now.Add(-time.Minute)}).RetryAfter(now); got != 1 {
+		t.Errorf("RetryAfter in the past = %d", got)
+	}
+}
+
+// scheduleFromNow 从 now 之后 offset 开始、持续一小时的每日时间段（UTC）
+func scheduleFromNow(now time.Time, offset time.Duration) (*AccountSchedule, time.Time) {
+	start := now.UTC().Add(offset).Truncate(time.Minute)
+	end := start.Add(time.Hour)
+	return &AccountSchedule{Timezone: "UTC", Windows: []string{start.Format("15:04") + "-" + end.Format("15:04")}}, start
+}
+
+func TestGetTokenSkipsOffScheduleAccounts(t *testing.T) {
+	now := time.Now()
+	later, laterStart := scheduleFromNow(now, 3*time.Hour)
+	sooner, soonerStart := scheduleFromNow(now, 2*time.Hour)
+	active := &AccountSchedule{Timezone: "UTC", Windows: []string{"00:00-24:00"}}
+
+	off1, off2, on := freshAccount("sched-off-1"), freshAccount("sched-off-2"), freshAccount("sched-on")
+	off1.Schedule, off2.Schedule, on.Schedule = later, sooner, active
+	s := newTestStore(t, off1, off2, on)
+	for i := 0; i < 3; i++ {
+		account, err := s.GetToken(context.Background())
+		if err != nil || account.ID != "sched-on" {
+			t.Fatalf("GetToken = %v, %v", account, err)
+		}
+	}
+
+	// 所有账号都不在时间段内（其余账号禁用）时返回最早的可用时间
+	disabled := freshAccount("sched-disabled")
+	disabled.Enable = false
+	s = newTestStore(t, off1, off2, disabled)
+	_, err := s.GetToken(context.Background())
+	var scheduleErr *ScheduleError
+	if !errors.As(err, &scheduleErr) || !scheduleErr.Next.Equal(soonerStart) || scheduleErr.Next.Equal(laterStart) {
+		t.Fatalf("GetToken error = %v", err)
+	}
+	if !strings.Contains(err.Error(), soonerStart.Format(time.RFC3339)) {
+		t.Fatalf("error message = %q", err.Error())
+	}
+
+	// 还有账号因其他原因不可用时不是时间段错误
+	draining := freshAccount("sched-draining")
+	since := now.Add(-time.Minute)
+	draining.DrainingSince = &since
+	s = newTestStore(t, off1, draining)
+	if _, err := s.GetToken(context.Background()); err == nil || errors.As(err, &scheduleErr) {
+		t.Fatalf("GetToken with draining account = %v", err)
+	}
+}
+
+func TestSetSchedule(t *testing.T) {
+	s := newTestStore(t, freshAccount("sched-set"))
+	ctx := context.Background()
+
+	if err := s.SetSchedule(ctx, 0, &AccountSchedule{Windows: []string{"mon 25:00-26:00"}}); err == nil {
+		t.Fatal("invalid schedule saved")
+	}
+	if s.accounts[0].Schedule != nil {
+		t.Fatal("invalid schedule applied")
+	}
+	if err := s.SetSchedule(ctx, 0, &AccountSchedule{Timezone: "UTC", Windows: []string{"mon-fri 09:00-18:00"}}); err != nil {
+		t.Fatal(err)
+	}
+	if sch := s.accounts[0].Schedule; sch == nil || sch.Timezone != "UTC" || len(sch.Windows) != 1 {
+		t.Fatalf("schedule = %+v", sch)
+	}
+	// 没有时间段时清除
+	if err := s.SetSchedule(ctx, 0, &AccountSchedule{Timezone: "UTC"}); err != nil || s.accounts[0].Schedule != nil {
+		t.Fatalf("clear schedule: %v, %+v", err, s.accounts[0].Schedule)
+	}
+	if err := s.SetSchedule(ctx, 5, nil); err == nil {
+		t.Fatal("out of range index accepted")
+	}
+}
+
+func TestImportTOMLSchedule(t *testing.T) {
+	s := newTestStore(t)
+	data := `
+[[accounts]]
+email = "night@example.com"
+refresh_token = "refresh-night"
+schedule = ["sat,sun 22:00-06:00", "mon-fri 20:00-23:00"]
+schedule_timezone = "Asia/Shanghai"
+
+[[accounts]]
+email = "bad-window@example.com"
+refresh_token = "refresh-bad-window"
+schedule = ["mon 9-10"]
+
+[[accounts]]
+email = "bad-zone@example.com"
+refresh_token = "refresh-bad-zone"
+schedule = ["mon 09:00-10:00"]
+schedule_timezone = "Nowhere/City"
+`
+	report, err := s.ImportTOML(context.Background(), strings.NewReader(data), 3, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 1 || len(report.Errored) != 2 || !strings.Contains(report.Errored[0].Reason, `invalid time "9"`) ||
+		!strings.Contains(report.Errored[1].Reason, "Nowhere/City") {
+		t.Fatalf("report = %+v", report)
+	}
+	sch := s.accounts[0].Schedule
+	if sch == nil || sch.Timezone != "Asia/Shanghai" || len(sch.Windows) != 2 || sch.Windows[0] != "sat,sun 22:00-06:00" {
+		t.Fatalf("schedule = %+v", sch)
+	}
+
+	// 重新导入不带时间段时保留原有时间段
+	report, err = s.ImportTOML(context.Background(), strings.NewReader("[[accounts]]\nemail = \"night@example.com\"\nrefresh_token = \"refresh-night-2\"\n"), 1, ImportOptions{})
+	if err != nil || report.Updated != 1 {
+		t.Fatalf("re-import = %+v, %v", report, err)
+	}
+	if s.accounts[0].Schedule == nil || s.accounts[0].RefreshToken != "refresh-night-2" {
+		t.Fatalf("after re-import: %+v", s.accounts[0])
+	}
+}
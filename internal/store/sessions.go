@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/utils"
+)
+
+// 会话轮换原因
+const (
+	SessionRotateRequests = "requests" // 达到 SESSION_ROTATE_REQUESTS
+	SessionRotateAge      = "age"      // 达到 SESSION_ROTATE_HOURS
+	SessionRotateClient   = "client"   // 请求头要求新会话
+	SessionRotateManual   = "manual"   // 面板手动轮换
+)
+
+type freshSessionContextKey struct{}
+
+// WithFreshSession 要求本次请求使用的账号先生成新的 SessionID
+func WithFreshSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshSessionContextKey{}, true)
+}
+
+func freshSessionRequested(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshSessionContextKey{}).(bool)
+	return fresh
+}
+
+// resetSession 生成新的 SessionID 并重新开始计数
+func (a *Account) resetSession() {
+	a.SessionID = utils.GenerateSessionID()
+	a.SessionStartedAt = time.Now()
+	a.SessionRequests = 0
+}
+
+// rotateSessionUnlocked 轮换账号会话并记录（调用者必须持有写锁，正在获取 Token 的请求不会看到中间状态）
+func rotateSessionUnlocked(account *Account, reason string) {
+	requests, age := account.SessionRequests, time.Since(account.SessionStartedAt).Round(time.Second)
+	account.resetSession()
+	account.SessionRotations++
+	account.SessionRotateReason = reason
+	logger.Info("Session rotated for %s (id=%s): reason=%s, requests=%d, age=%s",
+		account.Email, account.ID, reason, requests, age)
+}
+
+// useSessionUnlocked 账号被选中处理请求时调用：按策略轮换会话后计数（调用者必须持有写锁）。
+// pinned 为 true 表示请求属于已固定到该账号的会话，此时保持原 SessionID
+func useSessionUnlocked(ctx context.Context, account *Account, pinned bool) {
+	if account.SessionStartedAt.IsZero() {
+		account.SessionStartedAt = time.Now()
+	}
+	if !pinned {
+		if reason := sessionRotateReason(ctx, account); reason != "" {
+			rotateSessionUnlocked(account, reason)
+		}
+	}
+	account.SessionRequests++
+}
+
+// sessionRotateReason 返回需要轮换的原因，不需要时返回空字符串
+func sessionRotateReason(ctx context.Context, account *Account) string {
+	if freshSessionRequested(ctx) {
+		return SessionRotateClient
+	}
+	cfg := config.Get()
+	if cfg.SessionRotateRequests > 0 && account.SessionRequests >= cfg.SessionRotateRequests {
+		return SessionRotateRequests
+	}
+	if cfg.SessionRotateHours > 0 && time.Since(account.SessionStartedAt) >= time.Duration(cfg.SessionRotateHours)*time.Hour {
+		return SessionRotateAge
+	}
+	return ""
+}
+
+// RotateSession 手动轮换指定账号的会话
+func (s *AccountStore) RotateSession(ctx context.Context, index int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.accountAtUnlocked(ctx, index)
+	if err != nil {
+		return err
+	}
+	rotateSessionUnlocked(account, SessionRotateManual)
+	return nil
+}
+
+// RotateAllSessions 手动轮换对请求租户可见的所有账号的会话，返回轮换数量
+func (s *AccountStore) RotateAllSessions(ctx context.Context) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rotated := 0
+	for i := range s.accounts {
+		if VisibleTo(ctx, s.accounts[i].Tenant) {
+			rotateSessionUnlocked(&s.accounts[i], SessionRotateManual)
+			rotated++
+		}
+	}
+	return rotated
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/persist"
+)
+
+// Tenant 租户（data/tenants.json），按 API Key 分组隔离账号、日志和用量
+type Tenant struct {
+	Name          string   `json:"name"`
+	APIKeys       []string `json:"apiKeys"`
+	PanelUser     string   `json:"panelUser,omitempty"`     // 租户管理员用户名
+	PanelPassword string   `json:"panelPassword,omitempty"` // 租户管理员密码
+	PanelRole     string   `json:"panelRole,omitempty"`     // 租户管理员角色（viewer、operator、admin），默认 admin
+	Corpus        bool     `json:"corpus,omitempty"`        // 允许录制该租户的请求到评测语料
+
+	ToolResultMode  string `json:"toolResultMode,omitempty"`  // tool 结果超限处理方式，为空时使用 TOOL_RESULT_MODE
+	ToolResultMaxKB *int   `json:"toolResultMaxKB,omitempty"` // tool 结果大小上限，为空时使用 TOOL_RESULT_MAX_KB
+}
+
+// TenantStore 租户配置
+type TenantStore struct {
+	mu      sync.RWMutex
+	tenants []Tenant
+}
+
+var (
+	tenantStore     *TenantStore
+	tenantStoreOnce sync.Once
+)
+
+// GetTenantStore 获取租户配置单例（未配置 tenants.json 时为单租户模式）
+func GetTenantStore() *TenantStore {
+	tenantStoreOnce.Do(func() {
+		tenantStore = &TenantStore{}
+		tenantStore.Load()
+		persist.Register(persist.File{
+			Name:   "tenants.json",
+			Path:   filepath.Join(config.Get().DataDir, "tenants.json"),
+			Reload: tenantStore.Load,
+		})
+	})
+	return tenantStore
+}
+
+// Load 加载租户配置
+func (s *TenantStore) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := filepath.Join(config.Get().DataDir, "tenants.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var tenants []Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		logger.Warn("Invalid tenants config %s: %v", path, err)
+		return err
+	}
+
+	valid := tenants[:0]
+	for _, t := range tenants {
+		if t.Name == "" {
+			logger.Warn("Ignoring tenant without name in %s", path)
+			continue
+		}
+		valid = append(valid, t)
+	}
+	s.tenants = valid
+
+	logger.Info("Loaded %d tenants", len(s.tenants))
+	return nil
+}
+
+// Enabled 是否配置了租户
+func (s *TenantStore) Enabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.tenants) > 0
+}
+
+// ByAPIKey 按 API Key 查找租户
+func (s *TenantStore) ByAPIKey(key string) *Tenant {
+	if key == "" {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := range s.tenants {
+		for _, k := range s.tenants[i].APIKeys {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+				t := s.tenants[i]
+				return &t
+			}
+		}
+	}
+	return nil
+}
+
+// ByPanelCredentials 按租户管理员账号密码查找租户
+func (s *TenantStore) ByPanelCredentials(user, password string) *Tenant {
+	if user == "" || password == "" {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := range s.tenants {
+		t := s.tenants[i]
+		if t.PanelUser == user && t.PanelPassword != "" &&
+			subtle.ConstantTimeCompare([]byte(t.PanelPassword), []byte(password)) == 1 {
+			return &t
+		}
+	}
+	return nil
+}
+
+// List 列出租户
+func (s *TenantStore) List() []Tenant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Tenant, len(s.tenants))
+	copy(result, s.tenants)
+	return result
+}
+
+// tenantContextKey 请求所属租户的 context key
+type tenantContextKey struct{}
+
+// WithTenant 返回携带租户的 context（认证中间件设置）
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext 获取请求所属租户，未设置表示超级管理员（可见全部数据）
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(string)
+	return tenant, ok
+}
+
+// VisibleTo 检查属于 tenant 的数据对当前请求是否可见
+func VisibleTo(ctx context.Context, tenant string) bool {
+	scope, ok := TenantFromContext(ctx)
+	return !ok || scope == tenant
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+)
+
+// tokenRefresher 后台 Token 刷新协程
+type tokenRefresher struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	refresher   *tokenRefresher
+	refresherMu sync.Mutex
+)
+
+// StartTokenRefresher 启动后台刷新：定期刷新 Token 即将过期的已启用账号（TOKEN_REFRESH_INTERVAL 为 0 时不启动）
+func StartTokenRefresher() {
+	cfg := config.Get()
+	interval := time.Duration(cfg.TokenRefreshInterval) * time.Second
+	window := time.Duration(cfg.TokenRefreshWindow) * time.Minute
+	if interval <= 0 {
+		return
+	}
+
+	refresherMu.Lock()
+	defer refresherMu.Unlock()
+	if refresher != nil {
+		return
+	}
+	r := &tokenRefresher{stop: make(chan struct{}), done: make(chan struct{})}
+	refresher = r
+
+	monitor.Go("token-refresh", func() {
+		defer close(r.done)
+		timer := time.NewTimer(jitter(interval))
+		defer timer.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-timer.C:
+			}
+			GetAccountStore().RefreshExpiring(window, r.stop)
+			timer.Reset(jitter(interval))
+		}
+	})
+}
+
+// StopTokenRefresher 停止后台刷新并等待正在进行的刷新结束
+func StopTokenRefresher(ctx context.Context) error {
+	refresherMu.Lock()
+	r := refresher
+	refresher = nil
+	refresherMu.Unlock()
+	if r == nil {
+		return nil
+	}
+
+	close(r.stop)
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// jitter 在 d 的 ±20% 内随机取值，避免多个实例同时刷新
+func jitter(d time.Duration) time.Duration {
+	return d*4/5 + time.Duration(rand.Int63n(int64(d)*2/5+1))
+}
+
+// refreshLead 账号的提前刷新时间：window 加上按账号 ID 固定的 0~50% 偏移，
+// 同时导入、过期时间相同的账号分散在不同轮次刷新
+func refreshLead(a *Account, window time.Duration) time.Duration {
+	h := fnv.New32a()
+	h.Write([]byte(a.ID))
+	return window + time.Duration(h.Sum32()%1000)*window/2000
+}
+
+// RefreshExpiring 刷新 Token 将在 window（加按账号的偏移）内过期的已启用账号，stop 关闭时停止。
+// 有会话绑定的账号提前 affinityRefreshLead 刷新并优先处理（绑定会话多的先刷新），刷新失败时把会话改绑到其他账号。
+// 每个账号单独加锁，避免长时间阻塞请求；失败的账号由刷新闸门退避。返回刷新成功和失败的账号数
+func (s *AccountStore) RefreshExpiring(window time.Duration, stop <-chan struct{}) (refreshed, failed int) {
+	counts := GetConversationMap().pinnedCounts()
+	now := time.Now()
+	s.mu.RLock()
+	var due []string
+	for i := range s.accounts {
+		a := &s.accounts[i]
+		if a.Enable && (a.pinnedRefreshDue(counts[a.ID], now) || a.expiresWithin(refreshLead(a, window), now)) {
+			due = append(due, a.ID)
+		}
+	}
+	s.mu.RUnlock()
+	sort.SliceStable(due, func(i, j int) bool {
+		return counts[due[i]] > counts[due[j]]
+	})
+
+	rebound := 0
+	for _, id := range due {
+		select {
+		case <-stop:
+			return refreshed, failed
+		default:
+		}
+
+		ok, rebind, err := s.refreshExpiringAccount(id, window, counts[id])
+		switch {
+		case err != nil:
+			failed++
+		case ok:
+			refreshed++
+		}
+		// 在释放账号锁之后改绑会话
+		if rebind {
+			rebound += s.rebindPinned(id, counts)
+		}
+	}
+	if refreshed > 0 || failed > 0 || rebound > 0 {
+		logger.Info("Background token refresh: %d refreshed, %d failed, %d conversation(s) rebound", refreshed, failed, rebound)
+	}
+	return refreshed, failed
+}
+
+// refreshExpiringAccount 刷新单个账号（加锁后重新检查，期间可能已被请求刷新、禁用或删除）。
+// rebind 表示账号有会话绑定且刷新失败，需要改绑（被限流或退避跳过、Token 仍可用时等下一轮再试）
+func (s *AccountStore) refreshExpiringAccount(id string, window time.Duration, pinned int) (refreshed, rebind bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOfUnlocked(id)
+	if i < 0 {
+		return false, false, nil
+	}
+	account := &s.accounts[i]
+	now := time.Now()
+	pinnedDue := account.pinnedRefreshDue(pinned, now)
+	if !account.Enable || !(pinnedDue || account.expiresWithin(refreshLead(account, window), now)) {
+		return false, false, nil
+	}
+	if err := s.refreshToken(account); err != nil {
+		if errors.Is(err, ErrRefreshThrottled) {
+			return false, pinnedDue && account.IsExpired(), nil
+		}
+		logger.Warn("Background token refresh failed for %s: %v", account.Email, err)
+		s.disableOnRefreshErrorUnlocked(account, err)
+		return false, pinnedDue, err
+	}
+	s.saveUnlocked()
+	return true, false, nil
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// UsageGroupFields 用量导出支持的分组维度（日期始终参与分组）
+var UsageGroupFields = []string{"model", "account", "key"}
+
+// ParseUsageGroupBy 解析逗号分隔的分组维度，空值默认按模型分组
+func ParseUsageGroupBy(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return []string{"model"}, nil
+	}
+	var fields []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" || seen[field] {
+			continue
+		}
+		valid := false
+		for _, f := range UsageGroupFields {
+			if f == field {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unsupported group_by field %q (allowed: %s)", field, strings.Join(UsageGroupFields, ", "))
+		}
+		seen[field] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func usageGroupValue(row *DailyUsage, field string) string {
+	switch field {
+	case "model":
+		return row.Model
+	case "account":
+		return row.Account
+	case "key":
+		return row.Key
+	}
+	return ""
+}
+
+// WriteUsageCSV 按日期及分组维度汇总并写出 CSV，末尾附加合计行。
+// rows 需按日期排序（UsageLedger.Range 的返回顺序），每天的数据写完即刷新
+func WriteUsageCSV(w io.Writer, rows []DailyUsage, groupBy []string) error {
+	cw := csv.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+
+	header := append([]string{"date"}, groupBy...)
+	header = append(header, "requests", "failures", "prompt_tokens", "completion_tokens", "total_tokens")
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	var total DailyUsage
+	writeRow := func(prefix []string, u *DailyUsage) error {
+		record := append(prefix,
+			strconv.Itoa(u.Requests),
+			strconv.Itoa(u.Failures),
+			strconv.Itoa(u.PromptTokens),
+			strconv.Itoa(u.CompletionTokens),
+			strconv.Itoa(u.PromptTokens+u.CompletionTokens),
+		)
+		return cw.Write(record)
+	}
+
+	for start := 0; start < len(rows); {
+		date := rows[start].Date
+		end := start
+		groups := make(map[string]*DailyUsage)
+		var order []string
+		for ; end < len(rows) && rows[end].Date == date; end++ {
+			row := &rows[end]
+			parts := make([]string, len(groupBy))
+			for i, field := range groupBy {
+				parts[i] = usageGroupValue(row, field)
+			}
+			k := strings.Join(parts, "\x00")
+			g, ok := groups[k]
+			if !ok {
+				g = &DailyUsage{}
+				groups[k] = g
+				order = append(order, k)
+			}
+			g.Requests += row.Requests
+			g.Failures += row.Failures
+			g.PromptTokens += row.PromptTokens
+			g.CompletionTokens += row.CompletionTokens
+		}
+
+		for _, k := range order {
+			g := groups[k]
+			prefix := []string{date}
+			if len(groupBy) > 0 {
+				prefix = append(prefix, strings.Split(k, "\x00")...)
+			}
+			if err := writeRow(prefix, g); err != nil {
+				return err
+			}
+			total.Requests += g.Requests
+			total.Failures += g.Failures
+			total.PromptTokens += g.PromptTokens
+			total.CompletionTokens += g.CompletionTokens
+		}
+
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		start = end
+	}
+
+	prefix := make([]string, 1+len(groupBy))
+	prefix[0] = "total"
+	if err := writeRow(prefix, &total); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
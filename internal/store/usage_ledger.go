@@ -0,0 +1,195 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+	"anti2api-golang/internal/monitor"
+	"anti2api-golang/internal/persist"
+)
+
+// usageLedgerFlushInterval 用量台账落盘间隔
+const usageLedgerFlushInterval = 30 * time.Second
+
+// DailyUsage 按天、模型、账号、API Key 汇总的用量
+type DailyUsage struct {
+	Date             string `json:"date"` // YYYY-MM-DD（本地时区）
+	Model            string `json:"model"`
+	Account          string `json:"account"` // email 或 projectId
+	Key              string `json:"key"`     // API Key 哈希前缀
+	Tenant           string `json:"tenant,omitempty"`
+	Requests         int    `json:"requests"`
+	Failures         int    `json:"failures"`
+	PromptTokens     int    `json:"promptTokens"`
+	CompletionTokens int    `json:"completionTokens"`
+}
+
+// UsageLedger 用量台账：与日志不同，不受条数上限影响，用于长期统计和导出
+type UsageLedger struct {
+	mu       sync.Mutex
+	rows     map[string]*DailyUsage
+	filePath string
+	dirty    bool
+}
+
+var (
+	usageLedger     *UsageLedger
+	usageLedgerOnce sync.Once
+)
+
+// GetUsageLedger 获取用量台账单例
+func GetUsageLedger() *UsageLedger {
+	usageLedgerOnce.Do(func() {
+		cfg := config.Get()
+		usageLedger = &UsageLedger{
+			rows:     make(map[string]*DailyUsage),
+			filePath: filepath.Join(cfg.DataDir, "usage_daily.json"),
+		}
+		if err := usageLedger.load(); err != nil {
+			logger.Warn("Failed to load usage ledger: %v", err)
+		}
+		persist.Register(persist.File{
+			Name:   "usage_daily.json",
+			Path:   usageLedger.filePath,
+			Flush:  usageLedger.Flush,
+			Reload: usageLedger.reload,
+		})
+		monitor.Go("usage-ledger", usageLedger.flushLoop)
+	})
+	return usageLedger
+}
+
+func (l *UsageLedger) load() error {
+	data, err := persist.ReadFile(l.filePath, persist.ValidJSON)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var rows []*DailyUsage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		l.rows[usageRowKey(row.Date, row.Model, row.Account, row.Key)] = row
+	}
+	return nil
+}
+
+// reload 丢弃内存中的台账，从磁盘重新加载（恢复备份后调用）
+func (l *UsageLedger) reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rows = make(map[string]*DailyUsage)
+	l.dirty = false
+	return l.load()
+}
+
+func usageRowKey(date, model, account, key string) string {
+	return strings.Join([]string{date, model, account, key}, "\x00")
+}
+
+// Record 累加一条日志的用量
+func (l *UsageLedger) Record(entry *LogEntry) {
+	date := entry.Timestamp.Local().Format("2006-01-02")
+	account := getAccountKey(entry.Email, entry.ProjectID)
+	k := usageRowKey(date, entry.Model, account, entry.KeyID)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	row, ok := l.rows[k]
+	if !ok {
+		row = &DailyUsage{Date: date, Model: entry.Model, Account: account, Key: entry.KeyID, Tenant: entry.Tenant}
+		l.rows[k] = row
+	}
+	row.Requests++
+	if !entry.Success {
+		row.Failures++
+	}
+	row.PromptTokens += entry.PromptTokens
+	row.CompletionTokens += entry.CompletionTokens
+	l.dirty = true
+}
+
+// Range 返回 [from, to] 日期范围内（含两端，格式 YYYY-MM-DD）的用量，按日期、模型、账号、Key 排序
+func (l *UsageLedger) Range(from, to string) []DailyUsage {
+	l.mu.Lock()
+	rows := make([]DailyUsage, 0, len(l.rows))
+	for _, row := range l.rows {
+		if (from != "" && row.Date < from) || (to != "" && row.Date > to) {
+			continue
+		}
+		rows = append(rows, *row)
+	}
+	l.mu.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		return a.Key < b.Key
+	})
+	return rows
+}
+
+// KeyTokens API Key 在指定日期（YYYY-MM-DD）的 Token 用量（提示 + 输出）
+func (l *UsageLedger) KeyTokens(key, date string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	total := 0
+	for _, row := range l.rows {
+		if row.Key == key && row.Date == date {
+			total += row.PromptTokens + row.CompletionTokens
+		}
+	}
+	return total
+}
+
+// Flush 将台账写入磁盘
+func (l *UsageLedger) Flush() error {
+	l.mu.Lock()
+	if !l.dirty {
+		l.mu.Unlock()
+		return nil
+	}
+	rows := make([]*DailyUsage, 0, len(l.rows))
+	for _, row := range l.rows {
+		copied := *row
+		rows = append(rows, &copied)
+	}
+	l.dirty = false
+	l.mu.Unlock()
+
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	return persist.WriteFile(l.filePath, data, 0644)
+}
+
+// flushLoop 定期落盘（进程异常退出时最多丢失一个间隔的统计）
+func (l *UsageLedger) flushLoop() {
+	ticker := time.NewTicker(usageLedgerFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := l.Flush(); err != nil {
+			logger.Warn("Failed to save usage ledger: %v", err)
+		}
+	}
+}
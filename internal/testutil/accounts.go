@@ -0,0 +1,54 @@
+package testutil
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/store"
+)
+
+// Account 请求模拟上游的账号（Token 一小时后过期，不需要刷新）
+func Account(id string) store.Account {
+	return store.Account{
+		ID:           id,
+		Email:        id + "@example.com",
+		AccessToken:  "access-" + id,
+		RefreshToken: "refresh-" + id,
+		ExpiresIn:    3600,
+		Timestamp:    time.Now().UnixMilli(),
+		Enable:       true,
+		Endpoint:     EndpointKey,
+		ProjectID:    "project-" + id,
+	}
+}
+
+// UseAccounts 用 accounts 替换账号存储的内容（写入数据目录后重新加载），测试结束时清空
+func UseAccounts(t testing.TB, accounts ...store.Account) {
+	t.Helper()
+	writeAccounts(t, accounts)
+	t.Cleanup(func() { writeAccounts(t, nil) })
+}
+
+func writeAccounts(t testing.TB, accounts []store.Account) {
+	if accounts == nil {
+		accounts = []store.Account{}
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"version":  store.AccountFileVersion,
+		"accounts": accounts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(config.Get().DataDir, "accounts.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.GetAccountStore().Load(); err != nil {
+		t.Fatal(err)
+	}
+}
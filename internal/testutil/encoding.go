@@ -0,0 +1,36 @@
+package testutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encodings 上游响应支持的压缩格式
+var Encodings = []string{"gzip", "br", "zstd"}
+
+// Compress 按 Content-Encoding 压缩数据（写入内存不会失败，未知格式时 panic）
+func Compress(encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			panic(err)
+		}
+		w = zw
+	default:
+		panic("unknown encoding " + encoding)
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,94 @@
+package testutil
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// leakIgnored 测试中按需启动、常驻的运行时协程（不属于被测代码）
+var leakIgnored = []string{
+	"os/signal.signal_recv",
+	"runtime.ensureSigM",
+	"testing.(*T).Run",
+	"testing.runTests",
+}
+
+// Goroutines 协程快照：CheckLeaks 只检查快照之后启动的协程（同 goleak.IgnoreCurrent）
+type Goroutines map[string]bool
+
+// SnapshotGoroutines 记录当前运行的协程
+func SnapshotGoroutines() Goroutines {
+	snapshot := make(Goroutines)
+	for id := range goroutineStacks() {
+		snapshot[id] = true
+	}
+	return snapshot
+}
+
+// CheckLeaks 等待快照之后启动的协程全部退出，超时后报告仍在运行的协程调用栈。
+// settle 在每次检查前调用（如关闭连接池中刚归还的空闲连接）
+func (g Goroutines) CheckLeaks(t testing.TB, settle ...func()) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		for _, fn := range settle {
+			fn()
+		}
+		leaked := g.leaked()
+		if len(leaked) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutine(s) leaked:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (g Goroutines) leaked() []string {
+	var leaked []string
+	for id, stack := range goroutineStacks() {
+		if g[id] || ignoredStack(stack) {
+			continue
+		}
+		leaked = append(leaked, stack)
+	}
+	return leaked
+}
+
+func ignoredStack(stack string) bool {
+	for _, fn := range leakIgnored {
+		if strings.Contains(stack, fn) {
+			return true
+		}
+	}
+	return false
+}
+
+// goroutineStacks 当前所有协程的调用栈（按协程 ID）
+func goroutineStacks() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[string]string)
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		// 每段以 "goroutine <id> [<状态>]:" 开始
+		header, _, _ := strings.Cut(string(stack), "\n")
+		fields := strings.Fields(header)
+		if len(fields) < 2 || fields[0] != "goroutine" {
+			continue
+		}
+		stacks[fields[1]] = string(stack)
+	}
+	return stacks
+}
@@ -0,0 +1,197 @@
+// Package testutil 测试使用的模拟上游（只在 _test.go 中引用）
+package testutil
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"anti2api-golang/internal/config"
+)
+
+// EndpointKey 模拟上游的端点键（账号的 Endpoint 设为该值即请求模拟上游）
+const EndpointKey = "fake"
+
+// Request 模拟上游收到的请求
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Upstream 模拟的 Antigravity 上游（HTTPS）
+type Upstream struct {
+	Server *httptest.Server
+
+	mu       sync.Mutex
+	handler  http.HandlerFunc
+	requests []Request
+}
+
+var (
+	shared     *Upstream
+	sharedOnce sync.Once
+)
+
+// StartUpstream 设置本次测试的上游处理函数并返回模拟上游。
+// 系统证书池在进程内只加载一次，因此同一测试进程共用一个 TLS 服务器（首次调用时启动，
+// 证书通过 SSL_CERT_FILE 信任），测试结束时清空处理函数和请求记录；使用它的测试不能并行
+func StartUpstream(t testing.TB, handler http.HandlerFunc) *Upstream {
+	t.Helper()
+	sharedOnce.Do(func() {
+		u := &Upstream{}
+		u.Server = httptest.NewTLSServer(http.HandlerFunc(u.serve))
+		certFile := filepath.Join(os.TempDir(), "anti2api-test-upstream.pem")
+		cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: u.Server.Certificate().Raw})
+		if err := os.WriteFile(certFile, cert, 0o644); err != nil {
+			panic(err)
+		}
+		os.Setenv("SSL_CERT_FILE", certFile)
+		config.APIEndpoints[EndpointKey] = config.Endpoint{
+			Key:   EndpointKey,
+			Label: "Test",
+			Host:  strings.TrimPrefix(u.Server.URL, "https://"),
+		}
+		shared = u
+	})
+
+	shared.mu.Lock()
+	shared.handler = handler
+	shared.requests = nil
+	shared.mu.Unlock()
+	t.Cleanup(func() {
+		shared.mu.Lock()
+		shared.handler = nil
+		shared.mu.Unlock()
+	})
+	return shared
+}
+
+func (u *Upstream) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	u.mu.Lock()
+	u.requests = append(u.requests, Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+	handler := u.handler
+	u.mu.Unlock()
+
+	if handler == nil {
+		http.Error(w, "no handler", http.StatusServiceUnavailable)
+		return
+	}
+	handler(w, r)
+}
+
+// Requests 本次测试中上游收到的请求
+func (u *Upstream) Requests() []Request {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]Request(nil), u.requests...)
+}
+
+// Part 上游响应中的一个 part
+type Part map[string]interface{}
+
+// Text 正文 part
+func Text(text string) Part {
+	return Part{"text": text}
+}
+
+// Thought 思考 part
+func Thought(text string) Part {
+	return Part{"text": text, "thought": true}
+}
+
+// FunctionCall 工具调用 part
+func FunctionCall(id, name string, args map[string]interface{}) Part {
+	return Part{"functionCall": map[string]interface{}{"id": id, "name": name, "args": args}}
+}
+
+// Chunk 一个上游响应（finishReason 为空表示未结束）
+func Chunk(finishReason string, parts ...Part) string {
+	return chunk(finishReason, nil, parts)
+}
+
+func chunk(finishReason string, usage map[string]interface{}, parts []Part) string {
+	if parts == nil {
+		parts = []Part{}
+	}
+	candidate := map[string]interface{}{
+		"content": map[string]interface{}{"role": "model", "parts": parts},
+	}
+	if finishReason != "" {
+		candidate["finishReason"] = finishReason
+	}
+	response := map[string]interface{}{"candidates": []interface{}{candidate}}
+	if usage != nil {
+		response["usageMetadata"] = usage
+	}
+	data, _ := json.Marshal(map[string]interface{}{"response": response})
+	return string(data)
+}
+
+// Reply 按请求方式返回 parts 的上游：流式请求每个 part 一个 chunk，结束 chunk 带 finishReason 和用量；
+// 非流式请求在一个响应中返回全部 parts
+func Reply(finishReason string, parts ...Part) http.HandlerFunc {
+	usage := map[string]interface{}{"promptTokenCount": 10, "candidatesTokenCount": 5, "totalTokenCount": 15}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "streamGenerateContent") {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, chunk(finishReason, usage, parts))
+			return
+		}
+		chunks := make([]string, 0, len(parts)+1)
+		for _, p := range parts {
+			chunks = append(chunks, Chunk("", p))
+		}
+		chunks = append(chunks, chunk(finishReason, usage, nil))
+		SSE(w, chunks...)
+	}
+}
+
+// SSE 按上游流式格式写出 chunks 并逐个刷新
+func SSE(w http.ResponseWriter, chunks ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	for _, c := range chunks {
+		io.WriteString(w, "data: "+c+"\n\n")
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// StreamHandler 返回 chunks 后正常结束的流式上游
+func StreamHandler(chunks ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		SSE(w, chunks...)
+	}
+}
+
+// JSONHandler 返回固定状态码和 JSON 响应体的上游
+func JSONHandler(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}
+}
+
+// Main 以临时数据目录运行包的测试（config 在首次读取时确定 DATA_DIR），在 TestMain 中调用
+func Main(m *testing.M) {
+	dir, err := os.MkdirTemp("", "anti2api-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("DATA_DIR", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
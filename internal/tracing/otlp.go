@@ -0,0 +1,266 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"anti2api-golang/internal/logger"
+)
+
+const (
+	exportQueueSize = 4096            // 待导出 span 队列长度，满时丢弃
+	exportBatchSize = 256             // 单次导出的最大 span 数
+	exportInterval  = 5 * time.Second // 定时导出间隔
+)
+
+// exporter 后台批量导出 span（OTLP/HTTP JSON）
+type exporter struct {
+	url        string
+	service    string
+	queue      chan *Span
+	flushReq   chan chan struct{}
+	dropped    atomic.Int64
+	httpClient *http.Client
+}
+
+func newExporter(endpoint, service string) *exporter {
+	e := &exporter{
+		url:        tracesURL(endpoint),
+		service:    service,
+		queue:      make(chan *Span, exportQueueSize),
+		flushReq:   make(chan chan struct{}),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	logger.Info("Tracing enabled, exporting to %s", e.url)
+	go e.run()
+	return e
+}
+
+// tracesURL 地址只有主机时补全 OTLP 默认路径 /v1/traces
+func tracesURL(endpoint string) string {
+	endpoint = strings.TrimRight(endpoint, "/")
+	if u, err := url.Parse(endpoint); err == nil && u.Path == "" {
+		return endpoint + "/v1/traces"
+	}
+	return endpoint
+}
+
+// enqueue 提交 span，队列满时丢弃（不阻塞请求）
+func (e *exporter) enqueue(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// flush 导出队列中已有的 span，ctx 结束时放弃等待
+func (e *exporter) flush(ctx context.Context) {
+	done := make(chan struct{})
+	select {
+	case e.flushReq <- done:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, exportBatchSize)
+	send := func() {
+		if n := e.dropped.Swap(0); n > 0 {
+			logger.Warn("Tracing queue full, %d spans dropped", n)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			logger.Warn("Trace export failed (%d spans): %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= exportBatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case done := <-e.flushReq:
+			for drained := false; !drained; {
+				select {
+				case s := <-e.queue:
+					batch = append(batch, s)
+					if len(batch) >= exportBatchSize {
+						send()
+					}
+				default:
+					drained = true
+				}
+			}
+			send()
+			close(done)
+		}
+	}
+}
+
+// export 发送一批 span
+func (e *exporter) export(spans []*Span) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.httpClient.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ===== OTLP JSON 编码 =====
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Events            []otlpEvent     `json:"events,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	Name         string          `json:"name"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 2 = ERROR
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func (e *exporter) encode(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: unixNano(s.start),
+			EndTimeUnixNano:   unixNano(s.end),
+			Attributes:        encodeAttributes(s.attrs),
+		}
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for _, ev := range s.events {
+			span.Events = append(span.Events, otlpEvent{
+				TimeUnixNano: unixNano(ev.time),
+				Name:         ev.name,
+				Attributes:   encodeAttributes(ev.attrs),
+			})
+		}
+		if s.failed {
+			span.Status = &otlpStatus{Code: 2, Message: s.errMsg}
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: encodeAttributes([]attribute{{"service.name", e.service}})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "anti2api-golang"},
+			Spans: out,
+		}},
+	}}}
+}
+
+func encodeAttributes(attrs []attribute) []otlpAttribute {
+	if len(attrs) == 0 {
+		return nil
+	}
+	out := make([]otlpAttribute, 0, len(attrs))
+	for _, a := range attrs {
+		out = append(out, otlpAttribute{Key: a.key, Value: encodeValue(a.value)})
+	}
+	return out
+}
+
+// encodeValue OTLP AnyValue（64 位整数按 JSON 映射编码为字符串）
+func encodeValue(v interface{}) map[string]interface{} {
+	switch val := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": val}
+	case bool:
+		return map[string]interface{}{"boolValue": val}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(val)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(val, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": val}
+	case time.Duration:
+		return map[string]interface{}{"intValue": strconv.FormatInt(val.Milliseconds(), 10)}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,254 @@
+// Package tracing 轻量链路追踪：按 W3C Trace Context 生成 span，以 OTLP/HTTP JSON 导出。
+// 未配置 OTLP_ENDPOINT 时所有函数都是空操作，返回的 *Span 为 nil，其方法可安全调用
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/internal/config"
+)
+
+// span 类型（OTLP SpanKind）
+const (
+	kindInternal = 1
+	kindServer   = 2
+	kindClient   = 3
+)
+
+// Span 一次操作的追踪记录，nil 表示未采样
+type Span struct {
+	exporter *exporter
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+
+	mu     sync.Mutex
+	end    time.Time
+	attrs  []attribute
+	events []event
+	errMsg string
+	failed bool
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+type event struct {
+	name  string
+	time  time.Time
+	attrs []attribute
+}
+
+type spanContextKey struct{}
+
+var (
+	tracer     *exporter
+	tracerOnce sync.Once
+)
+
+// getExporter 按配置创建导出器，未配置地址时返回 nil
+func getExporter() *exporter {
+	tracerOnce.Do(func() {
+		cfg := config.Get()
+		if cfg.TraceEndpoint != "" {
+			tracer = newExporter(cfg.TraceEndpoint, cfg.TraceServiceName)
+		}
+	})
+	return tracer
+}
+
+// Enabled 是否开启追踪
+func Enabled() bool {
+	return getExporter() != nil
+}
+
+// StartRequest 为入站请求创建根 span；请求带有效 traceparent 时延续调用方的追踪和采样决定
+func StartRequest(ctx context.Context, name string, header http.Header) (context.Context, *Span) {
+	e := getExporter()
+	if e == nil {
+		return ctx, nil
+	}
+
+	span := &Span{exporter: e, name: name, kind: kindServer, start: time.Now()}
+	if traceID, parentID, sampled, ok := parseTraceparent(header.Get("traceparent")); ok {
+		if !sampled {
+			return ctx, nil
+		}
+		span.traceID, span.parentID = traceID, parentID
+	} else {
+		if !sample(config.Get().TraceSamplePercent) {
+			return ctx, nil
+		}
+		putUint64(span.traceID[:8], rand.Uint64())
+		putUint64(span.traceID[8:], rand.Uint64())
+	}
+	putUint64(span.spanID[:], rand.Uint64())
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// Start 创建子 span；ctx 中没有已采样的 span 时返回 nil
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return startChild(ctx, name, kindInternal)
+}
+
+// StartClient 创建出站调用的子 span
+func StartClient(ctx context.Context, name string) (context.Context, *Span) {
+	return startChild(ctx, name, kindClient)
+}
+
+func startChild(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		exporter: parent.exporter,
+		traceID:  parent.traceID,
+		parentID: parent.spanID,
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+	}
+	putUint64(span.spanID[:], rand.Uint64())
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// FromContext 返回 ctx 中当前的 span
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// TraceID 返回 ctx 所属追踪的 ID（十六进制），未采样时为空
+func TraceID(ctx context.Context) string {
+	return FromContext(ctx).TraceID()
+}
+
+// Inject 配置开启传播时为出站请求写入 traceparent 请求头
+func Inject(ctx context.Context, header http.Header) {
+	span := FromContext(ctx)
+	if span == nil || !config.Get().TracePropagate {
+		return
+	}
+	header.Set("traceparent", "00-"+hex.EncodeToString(span.traceID[:])+"-"+hex.EncodeToString(span.spanID[:])+"-01")
+}
+
+// TraceID 追踪 ID（十六进制）
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SetAttr 设置属性（string、bool、整数、float64，其他类型按字符串导出）
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.attrs {
+		if s.attrs[i].key == key {
+			s.attrs[i].value = value
+			return
+		}
+	}
+	s.attrs = append(s.attrs, attribute{key, value})
+}
+
+// AddEvent 记录事件，kv 为交替的属性名和值
+func (s *Span) AddEvent(name string, kv ...interface{}) {
+	if s == nil {
+		return
+	}
+	ev := event{name: name, time: time.Now()}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if key, ok := kv[i].(string); ok {
+			ev.attrs = append(ev.attrs, attribute{key, kv[i+1]})
+		}
+	}
+	s.mu.Lock()
+	s.events = append(s.events, ev)
+	s.mu.Unlock()
+}
+
+// SetError 标记 span 失败，err 为 nil 时不做任何事
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.failed = true
+	s.errMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// End 结束 span 并提交导出，重复调用无效
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+	s.exporter.enqueue(s)
+}
+
+// Shutdown 导出剩余的 span（关闭服务时调用）
+func Shutdown(ctx context.Context) {
+	if e := getExporter(); e != nil {
+		e.flush(ctx)
+	}
+}
+
+// parseTraceparent 解析 W3C traceparent：00-<32 位 trace-id>-<16 位 parent-id>-<flags>
+func parseTraceparent(v string) (traceID [16]byte, parentID [8]byte, sampled bool, ok bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentID, false, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return traceID, parentID, false, false
+	}
+	if traceID == [16]byte{} || parentID == [8]byte{} {
+		return traceID, parentID, false, false
+	}
+	return traceID, parentID, flags[0]&1 == 1, true
+}
+
+// sample 按比例采样
+func sample(percent int) bool {
+	if percent >= 100 {
+		return true
+	}
+	return percent > 0 && rand.IntN(100) < percent
+}
+
+func putUint64(b []byte, v uint64) {
+	for i := range b {
+		b[i] = byte(v >> (8 * (len(b) - 1 - i)))
+	}
+}
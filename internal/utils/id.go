@@ -67,3 +67,13 @@ func randomAlphanumeric(length int) string {
 	}
 	return string(result)
 }
+
+// GenerateAccountID 生成账号 ID (acc-{uuid})
+func GenerateAccountID() string {
+	return "acc-" + uuid.New().String()
+}
+
+// GenerateJobID 生成后台任务 ID (job-{uuid})
+func GenerateJobID() string {
+	return "job-" + uuid.New().String()
+}
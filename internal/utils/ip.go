@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ParseTrustedProxies 解析受信任代理列表（IP 或 CIDR），忽略无效项
+func ParseTrustedProxies(entries []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			entry = ip.String() + "/" + strconv.Itoa(bits)
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveClientIP 解析真实客户端 IP
+// 仅当直连对端属于受信任代理时才使用 X-Forwarded-For / X-Real-IP，
+// X-Forwarded-For 从右向左跳过受信任代理，取第一个不受信任的地址
+func ResolveClientIP(remoteAddr string, header http.Header, trusted []*net.IPNet) string {
+	peer := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		peer = host
+	}
+
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil || !isTrusted(peerIP, trusted) {
+		return peer
+	}
+
+	if xff := header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				// 无法解析的地址可能是伪造的，停止继续向左查找
+				break
+			}
+			if !isTrusted(ip, trusted) || i == 0 {
+				return ip.String()
+			}
+		}
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+
+	return peer
+}
+
+// clientIPKey 客户端 IP 的 context key
+type clientIPKey struct{}
+
+// WithClientIP 返回携带客户端 IP 的 context
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP 获取请求的客户端 IP（由 RealIP 中间件解析），未解析时返回直连地址
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,75 @@
+package utils_test
+
+import (
+	"net/http"
+	"testing"
+
+	"anti2api-golang/internal/utils"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	nets := utils.ParseTrustedProxies([]string{" 10.0.0.1 ", "172.16.0.0/12", "::1", "fd00::/8", "", "proxy.local", "10.0.0.0/33"})
+	var got []string
+	for _, n := range nets {
+		got = append(got, n.String())
+	}
+	want := []string{"10.0.0.1/32", "172.16.0.0/12", "::1/128", "fd00::/8"}
+	if len(got) != len(want) {
+		t.Fatalf("trusted = %v, want %v (invalid entries ignored)", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("trusted = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestResolveClientIP(t *testing.T) {
+	trusted := utils.ParseTrustedProxies([]string{"10.0.0.0/8", "fd00::/8"})
+	for _, tc := range []struct {
+		name   string
+		remote string
+		xff    []string
+		realIP string
+		want   string
+	}{
+		{name: "direct", remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "spoofed xff from untrusted peer", remote: "203.0.113.7:5000", xff: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "spoofed real ip from untrusted peer", remote: "203.0.113.7:5000", realIP: "198.51.100.1", want: "203.0.113.7"},
+		{name: "trusted proxy", remote: "10.0.0.2:5000", xff: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		// 客户端自带的 X-Forwarded-For 排在左侧，取最右侧不受信任的地址
+		{name: "client prepends spoofed hop", remote: "10.0.0.2:5000", xff: []string{"1.1.1.1, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "proxy chain", remote: "10.0.0.2:5000", xff: []string{"198.51.100.1, 10.0.0.3", "10.0.0.4"}, want: "198.51.100.1"},
+		{name: "all hops trusted", remote: "10.0.0.2:5000", xff: []string{"10.0.0.5, 10.0.0.3"}, want: "10.0.0.5"},
+		{name: "unparseable hop", remote: "10.0.0.2:5000", xff: []string{"198.51.100.1, garbage"}, realIP: "198.51.100.9", want: "198.51.100.9"},
+		{name: "real ip from trusted proxy", remote: "10.0.0.2:5000", realIP: "198.51.100.1", want: "198.51.100.1"},
+		{name: "ipv6 peer", remote: "[2001:db8::1]:5000", xff: []string{"198.51.100.1"}, want: "2001:db8::1"},
+		{name: "ipv6 trusted proxy", remote: "[fd00::2]:5000", xff: []string{"2001:db8::7"}, want: "2001:db8::7"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			header := make(http.Header)
+			for _, v := range tc.xff {
+				header.Add("X-Forwarded-For", v)
+			}
+			if tc.realIP != "" {
+				header.Set("X-Real-IP", tc.realIP)
+			}
+			if got := utils.ResolveClientIP(tc.remote, header, trusted); got != tc.want {
+				t.Errorf("client IP = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClientIPWithoutMiddleware(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.7:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := utils.ClientIP(r); got != "203.0.113.7" {
+		t.Errorf("ClientIP = %s, want the peer address", got)
+	}
+	r = r.WithContext(utils.WithClientIP(r.Context(), "198.51.100.1"))
+	if got := utils.ClientIP(r); got != "198.51.100.1" {
+		t.Errorf("ClientIP = %s, want the resolved address", got)
+	}
+}
@@ -0,0 +1,125 @@
+package utils_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"anti2api-golang/internal/converter"
+	"anti2api-golang/internal/testutil"
+	"anti2api-golang/internal/utils"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// sampleCompletion 覆盖各种长度前缀的完成响应（fix/8/16/32 位字符串，超过 15 个元素的数组）
+func sampleCompletion() *converter.OpenAIChatCompletion {
+	stop, tools := "stop", "tool_calls"
+	index := 0
+	c := &converter.OpenAIChatCompletion{
+		ID:      "chatcmpl-abc",
+		Object:  "chat.completion",
+		Created: 1792100000,
+		Model:   "gemini-2.5-pro",
+		Usage:   &converter.Usage{PromptTokens: 70000, CompletionTokens: 255, TotalTokens: 70255},
+		Warnings: []string{
+			"dropped unsupported parameter: logit_bias",
+			"类型不匹配：参数已修正",
+		},
+		Choices: []converter.Choice{{
+			Index: 0,
+			Message: converter.Message{
+				Role:      "assistant",
+				Content:   strings.Repeat("长文本", 40000),
+				Reasoning: strings.Repeat("r", 300),
+				ToolCalls: []converter.OpenAIToolCall{{
+					Index:            &index,
+					ID:               "call_1",
+					Type:             "function",
+					Function:         converter.OpenAIFunctionCall{Name: "get_weather", Arguments: `{"city":"Paris","days":3}`},
+					ThoughtSignature: strings.Repeat("s", 40),
+				}},
+			},
+			FinishReason: &tools,
+		}},
+	}
+	for i := 1; i < 20; i++ {
+		c.Choices = append(c.Choices, converter.Choice{
+			Index:        i,
+			Message:      converter.Message{Role: "assistant", Content: fmt.Sprintf("choice %d", i)},
+			FinishReason: &stop,
+		})
+	}
+	return c
+}
+
+func TestMsgpackRoundTripMatchesJSON(t *testing.T) {
+	completion := sampleCompletion()
+
+	packed, err := utils.MarshalMsgpack(completion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromMsgpack converter.OpenAIChatCompletion
+	if err := testutil.UnmarshalMsgpack(packed, &fromMsgpack); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(completion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON converter.OpenAIChatCompletion
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fromMsgpack, fromJSON) {
+		t.Errorf("msgpack round trip differs from JSON:\nmsgpack: %+v\njson:    %+v", fromMsgpack, fromJSON)
+	}
+	if len(packed) >= len(data) {
+		t.Errorf("msgpack (%d bytes) is not smaller than JSON (%d bytes)", len(packed), len(data))
+	}
+}
+
+func TestMsgpackScalars(t *testing.T) {
+	values := map[string]interface{}{
+		"nil":      nil,
+		"true":     true,
+		"false":    false,
+		"fixint":   float64(127),
+		"negfix":   float64(-32),
+		"int8":     float64(-128),
+		"uint8":    float64(255),
+		"int16":    float64(-32768),
+		"uint16":   float64(65535),
+		"int32":    float64(-2147483648),
+		"uint32":   float64(4294967295),
+		"int64":    float64(-1 << 40),
+		"uint64":   float64(1 << 40),
+		"float":    1.5,
+		"negfloat": -0.25,
+		"empty":    "",
+		"str8":     strings.Repeat("a", 200),
+		"list":     []interface{}{float64(1), "two", nil, map[string]interface{}{}},
+		"nested":   map[string]interface{}{"a": []interface{}{}},
+	}
+
+	packed, err := utils.MarshalMsgpack(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := testutil.UnmarshalMsgpack(packed, &got); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range values {
+		if !reflect.DeepEqual(got[k], want) {
+			t.Errorf("%s: got %#v, want %#v", k, got[k], want)
+		}
+	}
+}
@@ -1,83 +1,193 @@
 package utils
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"strconv"
 	"strings"
 )
 
-// ParseTOML 解析 TOML 格式字符串
-func ParseTOML(input string) (map[string]interface{}, error) {
-	result := make(map[string]interface{})
-	var currentArrayName string
-	var currentArray []map[string]interface{}
-	var currentObj map[string]interface{}
+// TOMLTable [[name]] 数组中的一个表
+type TOMLTable struct {
+	Name   string                 // 数组名
+	Index  int                    // 在同名数组中的序号（从 0 开始）
+	Line   int                    // 表头所在行号（从 1 开始）
+	Values map[string]interface{} // 键值
+	Err    error                  // 表内第一处格式错误（含行号）
+}
+
+// TOMLScanner 逐表解析 TOML（大文件无需一次性构建完整结果）
+type TOMLScanner struct {
+	scanner *bufio.Scanner
+	line    int
+	counts  map[string]int
+	root    map[string]interface{}
+	rootErr error
+	pending *TOMLTable // 已读到表头、尚未返回的表
+	current *TOMLTable
+	done    bool
+	err     error
+}
 
-	lines := strings.Split(input, "\n")
+// NewTOMLScanner 创建逐表解析器
+func NewTOMLScanner(r io.Reader) *TOMLScanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &TOMLScanner{
+		scanner: scanner,
+		counts:  make(map[string]int),
+		root:    make(map[string]interface{}),
+	}
+}
 
-	for _, rawLine := range lines {
-		line := stripInlineComment(strings.TrimSpace(rawLine))
+// Next 返回下一个 [[table]]，结束时返回 nil。格式错误记录在表的 Err 中，不中断解析；
+// 返回的 error 仅表示读取失败（如单行过长）
+func (t *TOMLScanner) Next() (*TOMLTable, error) {
+	if t.pending != nil {
+		t.current, t.pending = t.pending, nil
+	}
+	for !t.done && t.scanner.Scan() {
+		t.line++
+		line := stripInlineComment(strings.TrimSpace(t.scanner.Text()))
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
 
 		// [[table]] 数组
 		if strings.HasPrefix(line, "[[") && strings.HasSuffix(line, "]]") {
-			section := strings.TrimSpace(line[2 : len(line)-2])
-
-			// 保存之前的对象
-			if currentObj != nil && currentArrayName != "" {
-				if result[currentArrayName] == nil {
-					result[currentArrayName] = []map[string]interface{}{}
-				}
-				currentArray = result[currentArrayName].([]map[string]interface{})
-				currentArray = append(currentArray, currentObj)
-				result[currentArrayName] = currentArray
+			name := strings.TrimSpace(line[2 : len(line)-2])
+			table := &TOMLTable{Name: name, Index: t.counts[name], Line: t.line, Values: make(map[string]interface{})}
+			t.counts[name]++
+			if name == "" {
+				table.Err = fmt.Errorf("line %d: empty table name", t.line)
 			}
-
-			currentArrayName = section
-			currentObj = make(map[string]interface{})
+			if prev := t.current; prev != nil {
+				t.current, t.pending = nil, table
+				return prev, nil
+			}
+			t.current = table
 			continue
 		}
 
-		// [table] 单个表
+		// [table] 单个表：之后的键值归入顶层
 		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			// 保存之前的对象
-			if currentObj != nil && currentArrayName != "" {
-				if result[currentArrayName] == nil {
-					result[currentArrayName] = []map[string]interface{}{}
+			if prev := t.current; prev != nil {
+				t.current = nil
+				return prev, nil
+			}
+			continue
+		}
+
+		key, value, err := parseKeyValue(line)
+		if err != nil {
+			err = t.lineError(err)
+			if t.current != nil {
+				if t.current.Err == nil {
+					t.current.Err = err
 				}
-				currentArray = result[currentArrayName].([]map[string]interface{})
-				currentArray = append(currentArray, currentObj)
-				result[currentArrayName] = currentArray
+			} else if t.rootErr == nil {
+				t.rootErr = err
 			}
-			currentArrayName = ""
-			currentObj = nil
 			continue
 		}
+		if t.current != nil {
+			t.current.Values[key] = value
+		} else {
+			t.root[key] = value
+		}
+	}
+
+	if !t.done {
+		t.done = true
+		t.err = t.scanner.Err()
+		if t.err != nil {
+			t.err = fmt.Errorf("line %d: %w", t.line+1, t.err)
+		}
+	}
+	if prev := t.current; prev != nil {
+		t.current = nil
+		return prev, nil
+	}
+	return nil, t.err
+}
 
-		// key = value
-		if idx := strings.Index(line, "="); idx != -1 {
-			key := strings.TrimSpace(line[:idx])
-			value := parseValue(strings.TrimSpace(line[idx+1:]))
+// Root 顶层键值（读取完所有表后完整）
+func (t *TOMLScanner) Root() map[string]interface{} {
+	return t.root
+}
 
-			if currentObj != nil {
-				currentObj[key] = value
-			} else {
-				result[key] = value
-			}
+// RootErr 顶层键值中的第一处格式错误
+func (t *TOMLScanner) RootErr() error {
+	return t.rootErr
+}
+
+func (t *TOMLScanner) lineError(err error) error {
+	if t.current != nil {
+		return fmt.Errorf("line %d ([[%s]] #%d): %w", t.line, t.current.Name, t.current.Index+1, err)
+	}
+	return fmt.Errorf("line %d: %w", t.line, err)
+}
+
+// parseKeyValue 解析 key = value 行
+func parseKeyValue(line string) (string, interface{}, error) {
+	idx := strings.Index(line, "=")
+	if idx == -1 {
+		return "", nil, fmt.Errorf("expected key = value, got %q", truncateForError(line))
+	}
+	key := strings.TrimSpace(line[:idx])
+	if key == "" {
+		return "", nil, fmt.Errorf("missing key before '='")
+	}
+	raw := strings.TrimSpace(line[idx+1:])
+	if raw == "" {
+		return "", nil, fmt.Errorf("missing value for key %q", key)
+	}
+	for _, quote := range []string{`"`, `'`} {
+		if strings.HasPrefix(raw, quote) && (len(raw) < 2 || !strings.HasSuffix(raw, quote)) {
+			return "", nil, fmt.Errorf("unterminated string for key %q", key)
 		}
 	}
+	return key, parseValue(raw), nil
+}
+
+func truncateForError(s string) string {
+	if len(s) > 40 {
+		return s[:40] + "..."
+	}
+	return s
+}
 
-	// 保存最后一个对象
-	if currentObj != nil && currentArrayName != "" {
-		if result[currentArrayName] == nil {
-			result[currentArrayName] = []map[string]interface{}{}
+// ParseTOML 解析 TOML 格式字符串，格式错误时返回第一处错误（含行号和表序号）
+func ParseTOML(input string) (map[string]interface{}, error) {
+	scanner := NewTOMLScanner(strings.NewReader(input))
+	tables := make(map[string][]map[string]interface{})
+	var firstErr error
+
+	for {
+		table, err := scanner.Next()
+		if err != nil {
+			return nil, err
+		}
+		if table == nil {
+			break
 		}
-		currentArray = result[currentArrayName].([]map[string]interface{})
-		currentArray = append(currentArray, currentObj)
-		result[currentArrayName] = currentArray
+		if table.Err != nil && firstErr == nil {
+			firstErr = table.Err
+		}
+		tables[table.Name] = append(tables[table.Name], table.Values)
+	}
+	if firstErr == nil {
+		firstErr = scanner.RootErr()
+	}
+	if firstErr != nil {
+		return nil, firstErr
 	}
 
+	result := scanner.Root()
+	for name, values := range tables {
+		result[name] = values
+	}
 	return result, nil
 }
 
@@ -141,13 +251,28 @@ func parseArray(content string) []interface{} {
 		return result
 	}
 
-	// 简单解析，不处理嵌套
-	parts := strings.Split(content, ",")
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p != "" {
-			result = append(result, parseValue(p))
+	// 简单解析，不处理嵌套；引号内的逗号不作为分隔符
+	var quote rune
+	start := 0
+	for i, c := range content {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			result = appendArrayItem(result, content[start:i])
+			start = i + 1
 		}
 	}
+	return appendArrayItem(result, content[start:])
+}
+
+func appendArrayItem(result []interface{}, item string) []interface{} {
+	if item = strings.TrimSpace(item); item != "" {
+		result = append(result, parseValue(item))
+	}
 	return result
 }
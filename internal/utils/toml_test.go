@@ -0,0 +1,31 @@
+package utils_test
+
+import (
+	"reflect"
+	"testing"
+
+	"anti2api-golang/internal/utils"
+)
+
+func TestParseTOMLArrays(t *testing.T) {
+	doc, err := utils.ParseTOML(`
+[[accounts]]
+schedule = ["sat,sun 22:00-06:00", 'mon, tue 09:00-18:00', "08:00-12:00"] # comment
+ports = [1, 2, 3]
+empty = []
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := doc["accounts"].([]map[string]interface{})[0]
+	// 引号内的逗号不拆分
+	if got, want := acc["schedule"], []interface{}{"sat,sun 22:00-06:00", "mon, tue 09:00-18:00", "08:00-12:00"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("schedule = %#v", got)
+	}
+	if got, want := acc["ports"], []interface{}{int64(1), int64(2), int64(3)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ports = %#v", got)
+	}
+	if got := acc["empty"].([]interface{}); len(got) != 0 {
+		t.Errorf("empty = %#v", got)
+	}
+}
@@ -0,0 +1,75 @@
+package validate
+
+import "unicode"
+
+// languageNames 语言代码对应的名称（用于纠正提示）
+var languageNames = map[string]string{
+	"zh": "Chinese",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"ru": "Russian",
+	"ar": "Arabic",
+	"th": "Thai",
+	"en": "English",
+}
+
+// DetectLanguage 按文字系统粗略检测主要语言，无法判断时返回空字符串
+// 拉丁字母统一视为 en；含假名即判定为 ja（日文混用汉字）
+func DetectLanguage(text string) string {
+	counts := make(map[string]int)
+	kana := 0
+	total := 0
+
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+			counts["ja"]++
+		case unicode.Is(unicode.Han, r):
+			counts["zh"]++
+		case unicode.Is(unicode.Hangul, r):
+			counts["ko"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["ru"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+		case unicode.Is(unicode.Thai, r):
+			counts["th"]++
+		case unicode.Is(unicode.Latin, r):
+			counts["en"]++
+		default:
+			continue
+		}
+		total++
+	}
+
+	if total == 0 {
+		return ""
+	}
+
+	// 日文中汉字通常多于假名，有一定比例的假名即视为日文
+	if kana > 0 && kana*9 >= counts["zh"] {
+		counts["ja"] += counts["zh"]
+		counts["zh"] = 0
+	}
+
+	best, bestCount := "", 0
+	for lang, n := range counts {
+		if n > bestCount || (n == bestCount && lang < best) {
+			best, bestCount = lang, n
+		}
+	}
+
+	// CJK 字符信息密度高，代码、专有名词中的拉丁字母不应压过正文语言
+	if best == "en" {
+		cjk := counts["zh"] + counts["ja"] + counts["ko"]
+		if cjk*3 >= bestCount {
+			for _, lang := range []string{"ja", "zh", "ko"} {
+				if counts[lang] > 0 && counts[lang] >= counts["ja"] && counts[lang] >= counts["zh"] && counts[lang] >= counts["ko"] {
+					return lang
+				}
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,243 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"anti2api-golang/internal/config"
+	"anti2api-golang/internal/logger"
+)
+
+// 校验器类型
+const (
+	TypeJSON     = "json"     // 响应必须是合法 JSON（允许 ```json 代码块包裹）
+	TypeRegex    = "regex"    // 响应必须匹配正则
+	TypeLanguage = "language" // 响应的主要语言
+)
+
+// Validator 响应校验器（data/validators.json）
+type Validator struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Pattern  string   `json:"pattern,omitempty"`  // regex
+	Language string   `json:"language,omitempty"` // language: zh, ja, ko, ru, en 等
+	Models   []string `json:"models,omitempty"`   // 模型名或别名，为空时作用于所有模型
+	Hint     string   `json:"hint,omitempty"`     // 重试时附加的纠正提示，为空时自动生成
+
+	re *regexp.Regexp
+}
+
+// validatorFile 配置文件格式
+type validatorFile struct {
+	Validators []Validator `json:"validators"`
+}
+
+// counter 单个校验器的统计
+type counter struct {
+	Checks int64 `json:"checks"`
+	Failed int64 `json:"failed"`
+}
+
+var (
+	validators     []Validator
+	validatorsOnce sync.Once
+
+	statsMu sync.Mutex
+	stats   = make(map[string]*counter)
+	retries int64
+	fixed   int64 // 重试后通过的次数
+)
+
+// loadValidators 加载校验器配置
+func loadValidators() {
+	path := filepath.Join(config.Get().DataDir, "validators.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	var file validatorFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		logger.Warn("Invalid response validators %s: %v", path, err)
+		return
+	}
+
+	for i, v := range file.Validators {
+		if v.Name == "" {
+			v.Name = fmt.Sprintf("%s-%d", v.Type, i+1)
+		}
+		switch v.Type {
+		case TypeJSON:
+		case TypeRegex:
+			re, err := regexp.Compile(v.Pattern)
+			if err != nil {
+				logger.Warn("Invalid validator pattern %q: %v", v.Pattern, err)
+				continue
+			}
+			v.re = re
+		case TypeLanguage:
+			if v.Language == "" {
+				logger.Warn("Validator %s requires language", v.Name)
+				continue
+			}
+			v.Language = strings.ToLower(v.Language)
+		default:
+			logger.Warn("Unknown validator type: %s", v.Type)
+			continue
+		}
+		validators = append(validators, v)
+	}
+
+	logger.Info("Loaded %d response validators", len(validators))
+}
+
+// Validators 获取已加载的校验器
+func Validators() []Validator {
+	validatorsOnce.Do(loadValidators)
+	return validators
+}
+
+// appliesTo 检查校验器是否作用于指定模型（任一名称匹配即可）
+func (v *Validator) appliesTo(models []string) bool {
+	if len(v.Models) == 0 {
+		return true
+	}
+	for _, m := range v.Models {
+		for _, name := range models {
+			if m == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// check 执行单个校验
+func (v *Validator) check(text string) bool {
+	switch v.Type {
+	case TypeJSON:
+		return json.Valid([]byte(stripCodeFence(text)))
+	case TypeRegex:
+		return v.re.MatchString(text)
+	case TypeLanguage:
+		return DetectLanguage(text) == v.Language
+	}
+	return true
+}
+
+// hint 纠正提示
+func (v *Validator) hint() string {
+	if v.Hint != "" {
+		return v.Hint
+	}
+	switch v.Type {
+	case TypeJSON:
+		return "The response must be valid JSON only, without any surrounding text."
+	case TypeRegex:
+		return fmt.Sprintf("The response must match the pattern %s.", v.Pattern)
+	case TypeLanguage:
+		return fmt.Sprintf("The response must be written in %s.", languageNames[v.Language])
+	}
+	return ""
+}
+
+// Enabled 检查指定模型是否有生效的校验器
+func Enabled(models ...string) bool {
+	for i := range Validators() {
+		if validators[i].appliesTo(models) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check 校验完整响应，返回未通过的校验器名称（同时计入统计）
+func Check(text string, models ...string) []string {
+	var failed []string
+	for i := range Validators() {
+		v := &validators[i]
+		if !v.appliesTo(models) {
+			continue
+		}
+		ok := v.check(text)
+		record(v.Name, ok)
+		if !ok {
+			failed = append(failed, v.Name)
+		}
+	}
+	return failed
+}
+
+// CorrectiveNote 生成重试时附加的系统提示
+func CorrectiveNote(failed []string) string {
+	var hints []string
+	for i := range Validators() {
+		v := &validators[i]
+		for _, name := range failed {
+			if v.Name == name {
+				hints = append(hints, v.hint())
+			}
+		}
+	}
+	return "Your previous answer did not meet the required format. " + strings.Join(hints, " ")
+}
+
+// RecordRetry 记录一次重试及其结果
+func RecordRetry(passed bool) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	retries++
+	if passed {
+		fixed++
+	}
+}
+
+func record(name string, ok bool) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	c, exists := stats[name]
+	if !exists {
+		c = &counter{}
+		stats[name] = c
+	}
+	c.Checks++
+	if !ok {
+		c.Failed++
+	}
+}
+
+// Stats 获取校验统计
+func Stats() map[string]interface{} {
+	statsMu.Lock()
+	byValidator := make(map[string]counter, len(stats))
+	for name, c := range stats {
+		byValidator[name] = *c
+	}
+	r, f := retries, fixed
+	statsMu.Unlock()
+
+	return map[string]interface{}{
+		"validators":  Validators(),
+		"byValidator": byValidator,
+		"retries":     r,
+		"fixed":       f,
+	}
+}
+
+// stripCodeFence 去掉 Markdown 代码块包裹
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```")
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
@@ -0,0 +1,64 @@
+package version
+
+import (
+	"runtime"
+	"time"
+)
+
+// 构建信息，通过 -ldflags "-X anti2api-golang/internal/version.Version=..." 注入
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// startTime 进程启动时间（用于计算运行时长）
+var startTime = time.Now()
+
+// Info 构建信息
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// RuntimeStats 运行时状态
+type RuntimeStats struct {
+	Uptime        string `json:"uptime"`
+	UptimeSeconds int64  `json:"uptimeSeconds"`
+	Goroutines    int    `json:"goroutines"`
+	HeapAlloc     uint64 `json:"heapAlloc"` // 堆上正在使用的字节数
+	HeapSys       uint64 `json:"heapSys"`   // 从系统申请的堆内存字节数
+	NumGC         uint32 `json:"numGC"`
+}
+
+// Get 返回构建信息
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// String 单行描述，用于 version 命令和启动日志
+func (i Info) String() string {
+	return "anti2api " + i.Version + " (commit " + i.Commit + ", built " + i.BuildDate + ", " + i.GoVersion + ")"
+}
+
+// Runtime 返回当前运行时状态
+func Runtime() RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	uptime := time.Since(startTime)
+	return RuntimeStats{
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: int64(uptime.Seconds()),
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     mem.HeapAlloc,
+		HeapSys:       mem.HeapSys,
+		NumGC:         mem.NumGC,
+	}
+}
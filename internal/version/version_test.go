@@ -0,0 +1,29 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestInfoFromBuildFlags(t *testing.T) {
+	// 模拟 -ldflags -X 注入的值
+	saved := [3]string{Version, Commit, BuildDate}
+	Version, Commit, BuildDate = "v1.4.0", "abc1234", "2026-10-01T00:00:00Z"
+	t.Cleanup(func() { Version, Commit, BuildDate = saved[0], saved[1], saved[2] })
+
+	info := Get()
+	if info.Version != "v1.4.0" || info.Commit != "abc1234" || info.BuildDate != "2026-10-01T00:00:00Z" || info.GoVersion != runtime.Version() {
+		t.Errorf("info = %+v", info)
+	}
+	want := "anti2api v1.4.0 (commit abc1234, built 2026-10-01T00:00:00Z, " + runtime.Version() + ")"
+	if got := info.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestRuntime(t *testing.T) {
+	stats := Runtime()
+	if stats.Goroutines < 1 || stats.HeapAlloc == 0 || stats.HeapSys < stats.HeapAlloc || stats.UptimeSeconds < 0 || stats.Uptime == "" {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -5,7 +5,9 @@ const tomlStatusEl = document.getElementById('tomlStatus');
 const listEl = document.getElementById('accountsList');
 const refreshBtn = document.getElementById('refreshBtn');
 const refreshAllBtn = document.getElementById('refreshAllBtn');
+const rotateSessionsBtn = document.getElementById('rotateSessionsBtn');
 const logsRefreshBtn = document.getElementById('logsRefreshBtn');
+const logSearchInput = document.getElementById('logSearchInput');
 const hourlyUsageEl = document.getElementById('hourlyUsage');
 const manageStatusEl = document.getElementById('manageStatus');
 const callbackUrlInput = document.getElementById('callbackUrlInput');
@@ -14,6 +16,7 @@ const logsEl = document.getElementById('logs');
 const usageStatusEl = document.getElementById('usageStatus');
 const settingsGrid = document.getElementById('settingsGrid');
 const settingsStatusEl = document.getElementById('settingsStatus');
+const buildVersionEl = document.getElementById('buildVersion');
 const settingsRefreshBtn = document.getElementById('settingsRefreshBtn');
 const importTomlBtn = document.getElementById('importTomlBtn');
 const tomlInput = document.getElementById('tomlInput');
@@ -42,6 +45,8 @@ let filteredAccounts = [];
 let currentPage = 1;
 const LOG_PAGE_SIZE = 20;
 let logsData = [];
+let logDetailMemory = null;
+let logHealth = null;
 let logCurrentPage = 1;
 let statusFilter = 'all';
 let errorOnly = false;
@@ -160,6 +165,27 @@ async function refreshAllAccountsBatch() {
   }
 }
 
+async function rotateAllSessions() {
+  if (!confirm('确认为所有账号生成新的会话 ID 吗？')) return;
+  if (rotateSessionsBtn) rotateSessionsBtn.disabled = true;
+  try {
+    const { rotated = 0 } = await fetchJson('/auth/accounts/rotate-sessions', { method: 'POST' });
+    setStatus(`已轮换 ${rotated} 个账号的会话。`, 'success', manageStatusEl);
+    await refreshAccounts();
+  } catch (e) {
+    setStatus('轮换会话失败: ' + e.message, 'error', manageStatusEl);
+  } finally {
+    if (rotateSessionsBtn) rotateSessionsBtn.disabled = false;
+  }
+}
+
+function renderSession(session) {
+  if (!session) return '';
+  const started = session.startedAt ? new Date(session.startedAt).toLocaleString() : '未使用';
+  const reason = session.lastRotateReason ? `，最近轮换原因：${escapeHtml(session.lastRotateReason)}` : '';
+  return `<div class="account-meta">会话：${started} 起 ${session.requests || 0} 次请求，已轮换 ${session.rotations || 0} 次${reason}</div>`;
+}
+
 function bindAccountActions() {
   document.querySelectorAll('[data-action="refresh"]')?.forEach(btn => {
     btn.addEventListener('click', async () => {
@@ -200,6 +226,22 @@ function bindAccountActions() {
     });
   });
 
+  document.querySelectorAll('[data-action="rotate-session"]')?.forEach(btn => {
+    btn.addEventListener('click', async () => {
+      const idx = btn.dataset.index;
+      btn.disabled = true;
+      try {
+        await fetchJson(`/auth/accounts/${idx}/rotate-session`, { method: 'POST' });
+        setStatus('已生成新的会话 ID', 'success', manageStatusEl);
+        refreshAccounts();
+      } catch (e) {
+        setStatus('轮换会话失败: ' + e.message, 'error', manageStatusEl);
+      } finally {
+        btn.disabled = false;
+      }
+    });
+  });
+
   document.querySelectorAll('[data-action="delete"]')?.forEach(btn => {
     btn.addEventListener('click', async () => {
       const idx = btn.dataset.index;
@@ -218,6 +260,29 @@ function bindAccountActions() {
     });
   });
 
+  document.querySelectorAll('[data-action="note"]')?.forEach(btn => {
+    btn.addEventListener('click', async () => {
+      const idx = Number(btn.dataset.index);
+      const acc = accountsData.find(a => a.index === idx);
+      const note = prompt('账号备注（最多 500 字）', acc?.note || '');
+      if (note === null) return;
+      btn.disabled = true;
+      try {
+        await fetchJson(`/auth/accounts/${idx}`, {
+          method: 'PATCH',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ note })
+        });
+        setStatus('备注已保存', 'success', manageStatusEl);
+        refreshAccounts();
+      } catch (e) {
+        setStatus('保存备注失败: ' + e.message, 'error', manageStatusEl);
+      } finally {
+        btn.disabled = false;
+      }
+    });
+  });
+
   document.querySelectorAll('[data-action="reauthorize"]')?.forEach(btn => {
     btn.addEventListener('click', () => {
       replaceIndex = Number(btn.dataset.index);
@@ -232,12 +297,42 @@ async function refreshAccounts() {
     const data = await fetchJson('/auth/accounts');
     accountsData = data.accounts || [];
     updateFilteredAccounts();
+    if (data.refresh?.paused) {
+      const until = new Date(data.refresh.pausedUntil).toLocaleTimeString();
+      setStatus(`⚠️ Token 刷新已全局暂停至 ${until}（${data.refresh.pauseReason}）`, 'warning', manageStatusEl);
+    } else if (data.conversationsAtRisk > 0) {
+      setStatus(`⚠️ ${data.conversationsAtRisk} 个会话绑定的账号 Token 即将过期或不可用，后台刷新失败时会改绑到其他账号`, 'warning', manageStatusEl);
+    }
+    if (data.recoveries?.length) {
+      const files = data.recoveries.map(rec => rec.path).join('、');
+      setStatus(`⚠️ 数据文件损坏，已从备份恢复：${files}（上次保存后的修改已丢失，请检查日志）`, 'error', manageStatusEl);
+    }
     loadHourlyUsage();
   } catch (e) {
     listEl.textContent = '加载失败: ' + e.message;
   }
 }
 
+function renderRateLimit(limit) {
+  if (!limit) return '';
+  const parts = [];
+  if (limit.remainingRequests !== undefined) parts.push(`剩余请求 ${limit.remainingRequests}`);
+  if (limit.remainingTokens !== undefined) parts.push(`剩余 Token ${limit.remainingTokens}`);
+  if (limit.resetRequests) parts.push(`重置于 ${new Date(limit.resetRequests).toLocaleTimeString()}`);
+  if (limit.retryAt && new Date(limit.retryAt) > new Date()) {
+    parts.push(`限流至 ${new Date(limit.retryAt).toLocaleTimeString()}`);
+  }
+  if (!parts.length) return '';
+  return `<div class="account-meta">⏱️ 上游限额：${parts.join(' · ')}（${new Date(limit.updatedAt).toLocaleTimeString()}）</div>`;
+}
+
+function renderCooldown(acc) {
+  if (!acc.cooldownUntil) return '';
+  const until = new Date(acc.cooldownUntil).toLocaleTimeString();
+  const text = acc.cooldownReason === 'rate_limited' ? `配额耗尽，限流至 ${until}` : `上游拒绝，暂停选用至 ${until}`;
+  return `<div class="account-meta">⏳ ${text}</div>`;
+}
+
 function renderAccountsList() {
   if (!filteredAccounts.length) {
     listEl.textContent = accountsData.length ? '没有符合筛选条件的凭证。' : '暂无账号，请先添加一个。';
@@ -263,8 +358,15 @@ function renderAccountsList() {
           <div class="account-header">
             <div class="account-info">
               <div class="account-title">${displayName}${acc.projectId ? ` <span class="badge">${acc.projectId}</span>` : ''
-        }</div>
+        }${acc.credentialType && acc.credentialType !== 'oauth' ? ` <span class="badge">🔑 ${escapeHtml(acc.credentialType)}</span>` : ''
+        }${acc.endpoint ? ` <span class="badge">📌 ${escapeHtml(acc.endpoint)}</span>` : ''}${Object.entries(acc.labels || {})
+          .map(([k, v]) => ` <span class="badge">🏷️ ${escapeHtml(k)}=${escapeHtml(v)}</span>`)
+          .join('')}</div>
               <div class="account-meta">创建时间：${created}</div>
+              ${acc.note ? `<div class="account-meta" style="white-space: pre-line">📝 ${escapeHtml(acc.note)}</div>` : ''}
+              ${renderRateLimit(acc.rateLimit)}
+              ${renderCooldown(acc)}
+              ${renderSession(acc.session)}
             </div>
             <div class="account-status">
               <div class="status-pill ${statusClass}">${statusText}</div>
@@ -284,6 +386,8 @@ function renderAccountsList() {
                 <button class="mini-btn" data-action="toggle" data-enable="${acc.enable}" data-index="${acc.index}">${acc.enable ? '⏸️ 停用' : '▶️ 启用'
         }</button>
                 <button class="mini-btn" data-action="reauthorize" data-index="${acc.index}">🔑 重新授权</button>
+                <button class="mini-btn" data-action="note" data-index="${acc.index}">📝 备注</button>
+                <button class="mini-btn" data-action="rotate-session" data-index="${acc.index}">🔄 轮换会话</button>
                 <button class="mini-btn danger" data-action="delete" data-index="${acc.index}">🗑️ 删除</button>
               </div>
             </div>
@@ -382,12 +486,20 @@ function renderSettings(groups) {
   settingsGrid.innerHTML = html;
 }
 
+function renderBuildVersion(info) {
+  if (!buildVersionEl || !info) return;
+  const commit = info.commit && info.commit !== 'unknown' ? ` · ${info.commit.slice(0, 12)}` : '';
+  const built = info.buildDate && info.buildDate !== 'unknown' ? ` · 构建于 ${info.buildDate}` : '';
+  buildVersionEl.textContent = `版本 ${info.version}${commit}${built} · ${info.goVersion}`;
+}
+
 async function loadSettings() {
   if (!settingsGrid) return;
   settingsGrid.textContent = '加载中...';
   try {
     const data = await fetchJson('/admin/settings');
     renderSettings(data.groups || []);
+    renderBuildVersion(data.version);
     if (data.updatedAt) {
       setStatus(`已更新：${new Date(data.updatedAt).toLocaleString()}`, 'success', settingsStatusEl);
     }
@@ -404,8 +516,11 @@ async function loadLogs() {
   if (logPrevPageBtn) logPrevPageBtn.disabled = true;
   if (logNextPageBtn) logNextPageBtn.disabled = true;
   try {
-    const data = await fetchJson('/admin/logs?limit=200');
+    const search = logSearchInput?.value.trim();
+    const data = await fetchJson('/admin/logs?limit=200' + (search ? `&search=${encodeURIComponent(search)}` : ''));
     logsData = data.logs || [];
+    logDetailMemory = data.detailMemory || null;
+    logHealth = data.health || null;
     logCurrentPage = 1;
     renderLogs();
   } catch (e) {
@@ -419,10 +534,24 @@ async function fetchLogDetail(logId) {
   if (logDetailCache.has(logId)) return logDetailCache.get(logId);
   const data = await fetchJson(`/admin/logs/${logId}`);
   const detail = data.log;
+  if (detail && data.traceUrl) detail.traceUrl = data.traceUrl;
   logDetailCache.set(logId, detail);
   return detail;
 }
 
+const PROTOCOL_LABELS = { openai: 'OpenAI', gemini: 'Gemini', anthropic: 'Anthropic', responses: 'Responses' };
+
+// 请求协议和摘要（旧日志没有协议字段，按 OpenAI 格式处理）
+function formatLogSummary(log) {
+  const protocol = PROTOCOL_LABELS[log.protocol || 'openai'] || log.protocol;
+  const summary = log.summary;
+  if (!summary) return protocol;
+  const parts = [protocol, `${summary.messages} 条消息`, `约 ${summary.promptTokens} tokens`];
+  if (summary.images) parts.push(`${summary.images} 张图片`);
+  if (summary.tools) parts.push(`${summary.tools} 个工具`);
+  return parts.join(' | ');
+}
+
 function renderLogDetailContent(detail, container) {
   if (!container) return;
   if (!detail) {
@@ -439,7 +568,12 @@ function renderLogDetailContent(detail, container) {
     responseSnapshot?.body ||
     responseSnapshot;
 
+  const traceLink = detail.traceUrl
+    ? `<a href="${escapeHtml(detail.traceUrl)}" target="_blank" rel="noopener">${escapeHtml(detail.traceId)}</a>`
+    : escapeHtml(detail.traceId || '');
+
   container.innerHTML = `
+    ${detail.traceId ? `<div class="log-detail-block"><h4>链路追踪</h4><p>${traceLink}</p></div>` : ''}
     <details class="log-detail-section" open>
       <summary>模型回答</summary>
       <div class="log-detail-body">
@@ -448,7 +582,7 @@ function renderLogDetailContent(detail, container) {
     </details>
 
     <details class="log-detail-section">
-      <summary>用户完整请求体</summary>
+      <summary>用户完整请求体（${escapeHtml(PROTOCOL_LABELS[requestSnapshot?.protocol || 'openai'] || requestSnapshot.protocol)} 格式）</summary>
       <div class="log-detail-body">
         <pre>${formatJson(requestSnapshot?.body || requestSnapshot || '暂无请求')}</pre>
       </div>
@@ -606,6 +740,8 @@ function renderLogs() {
             <div class="log-time">${time}</div>
             <div class="log-meta">模型：${log.model || '未知模型'} | 项目：${log.projectId || '未知项目'}</div>
             <div class="log-meta">${pathText}</div>
+            ${log.matchedIn?.length ? `<div class="log-meta">🔍 命中：${log.matchedIn.map(m => (m === 'prompt' ? '请求' : '输出')).join('、')}</div>` : ''}
+            <div class="log-meta">${escapeHtml(formatLogSummary(log))}</div>
             <div class="log-meta">${statusText} | ${durationText}</div>
             ${errorHint}
             ${errorButton}
@@ -618,7 +754,17 @@ function renderLogs() {
     .join('');
 
   if (logPaginationInfo) {
-    logPaginationInfo.textContent = `第 ${logCurrentPage} / ${totalPages} 页，共 ${logsData.length} 条`;
+    let text = `第 ${logCurrentPage} / ${totalPages} 页，共 ${logsData.length} 条`;
+    if (logDetailMemory) {
+      const usedMB = (logDetailMemory.bytes / 1048576).toFixed(1);
+      const budget = logDetailMemory.budget ? `${(logDetailMemory.budget / 1048576).toFixed(0)} MB` : '不限';
+      text += ` · 详情内存 ${usedMB} MB / ${budget}`;
+      if (logDetailMemory.evicted) text += `（已丢弃 ${logDetailMemory.evicted} 条旧详情）`;
+    }
+    if (logHealth && logHealth.status !== 'ok') {
+      text += ` · ⚠️ 日志写入异常（丢弃 ${logHealth.dropped} 条，失败 ${logHealth.errors} 次）`;
+    }
+    logPaginationInfo.textContent = text;
   }
   if (logPrevPageBtn) logPrevPageBtn.disabled = logCurrentPage === 1;
   if (logNextPageBtn) logNextPageBtn.disabled = logCurrentPage === totalPages;
@@ -891,6 +1037,18 @@ if (refreshAllBtn) {
   });
 }
 
+if (rotateSessionsBtn) {
+  rotateSessionsBtn.addEventListener('click', () => {
+    rotateAllSessions();
+  });
+}
+
+if (logSearchInput) {
+  logSearchInput.addEventListener('keydown', e => {
+    if (e.key === 'Enter') loadLogs();
+  });
+}
+
 if (logsRefreshBtn) {
   logsRefreshBtn.addEventListener('click', async () => {
     try {
@@ -949,12 +1107,27 @@ async function loadEndpoints() {
     const data = await fetchJson('/admin/endpoints');
     currentEndpointMode = data.mode || 'daily';
     endpointModeSelect.value = currentEndpointMode;
-    setStatus(`当前模式: ${getModeLabel(currentEndpointMode)}`, 'success', endpointStatusEl);
+    setStatus(`当前模式: ${getModeLabel(currentEndpointMode)}${describeAutoFailover(data.auto)}`, 'success', endpointStatusEl);
   } catch (e) {
     setStatus('加载端点失败: ' + e.message, 'error', endpointStatusEl);
   }
 }
 
+// 错误预算自动切换状态（未配置备用端点时不显示）
+function describeAutoFailover(auto) {
+  if (!auto || auto.state === 'disabled') return '';
+  switch (auto.state) {
+    case 'degraded':
+      return ` · 已因错误率自动从 ${getModeLabel(auto.degradedFrom)} 切换，正在探测原端点`;
+    case 'suspended':
+      return ' · 自动切换已暂停（手动设置了模式）';
+    case 'monitoring':
+      return ` · 自动切换监控中（${auto.windowErrors}/${auto.windowRequests} 失败）`;
+    default:
+      return '';
+  }
+}
+
 function getModeLabel(mode) {
   const labels = {
     'daily': 'Daily',
@@ -1003,6 +1176,65 @@ if (switchEndpointBtn) {
   switchEndpointBtn.addEventListener('click', switchEndpointMode);
 }
 
+// ===== 安装自检 =====
+
+const selftestBtn = document.getElementById('selftestBtn');
+const selftestList = document.getElementById('selftestList');
+const selftestStatusEl = document.getElementById('selftestStatus');
+const selftestIcons = { pass: '✅', fail: '❌', skip: '⏭️' };
+
+function renderSelftestStage(stage) {
+  const item = document.createElement('li');
+  const hint = stage.hint ? `<span class="selftest-hint">${escapeHtml(stage.hint)}</span>` : '';
+  item.innerHTML = `${selftestIcons[stage.status] || ''} <strong>${escapeHtml(stage.stage)}</strong> ` +
+    `(${stage.durationMs}ms) ${escapeHtml(stage.message)}${hint}`;
+  selftestList.appendChild(item);
+}
+
+async function runSelftest() {
+  selftestBtn.disabled = true;
+  selftestList.innerHTML = '';
+  setStatus('自检进行中...', 'info', selftestStatusEl);
+
+  try {
+    const res = await fetch('/admin/selftest', { method: 'POST', credentials: 'same-origin' });
+    if (!res.ok) {
+      const data = await res.json().catch(() => ({}));
+      throw new Error((data.error && data.error.message) || data.error || `HTTP ${res.status}`);
+    }
+
+    // 逐个读取 SSE 事件（event: stage / event: done）
+    const reader = res.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) break;
+      buffer += decoder.decode(value, { stream: true });
+      let sep;
+      while ((sep = buffer.indexOf('\n\n')) >= 0) {
+        const block = buffer.slice(0, sep);
+        buffer = buffer.slice(sep + 2);
+        const event = (block.match(/^event: (.*)$/m) || [])[1];
+        const data = JSON.parse((block.match(/^data: (.*)$/m) || [])[1] || '{}');
+        if (event === 'stage') {
+          renderSelftestStage(data);
+        } else if (event === 'done') {
+          setStatus(data.passed ? '✓ 自检通过' : '✗ 自检未通过', data.passed ? 'success' : 'error', selftestStatusEl);
+        }
+      }
+    }
+  } catch (e) {
+    setStatus('自检失败: ' + e.message, 'error', selftestStatusEl);
+  } finally {
+    selftestBtn.disabled = false;
+  }
+}
+
+if (selftestBtn) {
+  selftestBtn.addEventListener('click', runSelftest);
+}
+
 refreshAccounts();
 loadLogs();
 loadHourlyUsage();
@@ -58,8 +58,13 @@ if [ "$NEED_BUILD" = true ]; then
         rm -f "${BINARY_NAME}"
     fi
 
-    # 编译
-    if go build -ldflags="-s -w" -o "${BINARY_NAME}" "${CMD_DIR}"; then
+    # 编译（注入版本、提交和构建时间）
+    VERSION_PKG="anti2api-golang/internal/version"
+    VERSION=$(git describe --tags --always --dirty 2>/dev/null || echo dev)
+    COMMIT=$(git rev-parse HEAD 2>/dev/null || echo unknown)
+    BUILD_DATE=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+    LDFLAGS="-s -w -X ${VERSION_PKG}.Version=${VERSION} -X ${VERSION_PKG}.Commit=${COMMIT} -X ${VERSION_PKG}.BuildDate=${BUILD_DATE}"
+    if go build -ldflags="${LDFLAGS}" -o "${BINARY_NAME}" "${CMD_DIR}"; then
         echo -e "${GREEN}✓ Build successful${NC}"
 
         # 显示二进制文件大小